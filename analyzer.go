@@ -38,7 +38,7 @@ func (a Analyzer) DeriveManifestAndLock(path string, n gps.ProjectRoot) (gps.Man
 	// Ignore warnings irrelevant to user.
 	m, _, err := readManifest(f)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, gps.MalformedManifestError{Err: err}
 	}
 
 	return m, nil, nil
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/golang/dep/gps"
 	"github.com/golang/dep/internal/test"
 )
 
@@ -100,6 +101,9 @@ func TestAnalyzerDeriveManifestAndLockInvalidManifest(t *testing.T) {
 	if m != nil || l != nil || err == nil {
 		t.Fatalf("expected manifest & lock & err to be nil: m -> %#v l -> %#v err-> %#v", m, l, err)
 	}
+	if _, ok := err.(gps.MalformedManifestError); !ok {
+		t.Fatalf("expected a gps.MalformedManifestError, got %T", err)
+	}
 }
 
 func TestAnalyzerInfo(t *testing.T) {
@@ -0,0 +1,135 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/verify"
+	"github.com/pkg/errors"
+)
+
+// ConstraintBump describes a change to the constraint on a single project in a
+// Manifest, as produced by Manifest.BumpConstraint.
+type ConstraintBump struct {
+	ProjectRoot gps.ProjectRoot
+	// Old is the constraint on the project prior to the bump, or nil if there
+	// was none.
+	Old gps.Constraint
+	// New is the constraint on the project after the bump.
+	New gps.Constraint
+	// Override indicates that the bump was applied to an override, rather than
+	// to a regular constraint.
+	Override bool
+	// Manifest is a copy of the original manifest, with the bump applied.
+	Manifest *Manifest
+}
+
+// BumpConstraint computes a new constraint on the named project that admits the
+// provided version, and returns it along with a copy of the manifest that has
+// the new constraint in place. The receiver is not modified.
+//
+// If the version is a semantic version, the new constraint is a caret range
+// starting at that version. If widen is true, the new constraint instead admits
+// everything the old one did, in addition to that caret range; this is only
+// possible when the old constraint is itself a semver range or version.
+// Non-semver versions are always used as exact constraints.
+//
+// If the project has an override, the override is bumped, as it is the
+// constraint that is actually in effect.
+func (m *Manifest) BumpConstraint(pr gps.ProjectRoot, to gps.Version, widen bool) (ConstraintBump, error) {
+	if to == nil {
+		return ConstraintBump{}, errors.Errorf("no version provided to bump %s to", pr)
+	}
+
+	b := ConstraintBump{
+		ProjectRoot: pr,
+		Manifest:    m.dup(),
+	}
+
+	pcs := b.Manifest.Constraints
+	if pp, has := b.Manifest.Ovr[pr]; has && pp.Constraint != nil {
+		pcs, b.Override = b.Manifest.Ovr, true
+	}
+	pp := pcs[pr]
+	b.Old = pp.Constraint
+
+	var err error
+	b.New, err = bumpedConstraint(b.Old, to, widen)
+	if err != nil {
+		return ConstraintBump{}, errors.Wrapf(err, "could not bump constraint on %s", pr)
+	}
+
+	pp.Constraint = b.New
+	pcs[pr] = pp
+	return b, nil
+}
+
+func bumpedConstraint(old gps.Constraint, to gps.Version, widen bool) (gps.Constraint, error) {
+	if pv, ok := to.(gps.PairedVersion); ok {
+		to = pv.Unpair()
+	}
+
+	if to.Type() != gps.IsSemver {
+		if widen && old != nil {
+			return nil, errors.Errorf("cannot widen %s to include non-semver version %s", old, to)
+		}
+		return to, nil
+	}
+
+	body := fmt.Sprintf("^%s", to)
+	if widen && old != nil {
+		if gps.IsAny(old) {
+			return old, nil
+		}
+		if v, ok := old.(gps.Version); ok && v.Type() != gps.IsSemver {
+			return nil, errors.Errorf("cannot widen non-semver constraint %s to include %s", old, to)
+		}
+		body = fmt.Sprintf("%s || %s", old, body)
+	}
+
+	return gps.NewSemverConstraint(body)
+}
+
+// Impact solves the project using the bumped manifest in place of its own, and
+// reports how the resulting lock would differ from the project's current lock.
+//
+// The bumped project is allowed to change even if it is already locked, so the
+// delta reflects the version the solver would move to under the new
+// constraint. Only the projects that would change are included; as the new
+// lock has yet to be hashed, differences in the hashes of projects do not
+// count.
+func (b ConstraintBump) Impact(ctx context.Context, p *Project, sm gps.SourceManager) (verify.LockDelta, error) {
+	params := p.MakeParams()
+	params.Manifest = b.Manifest
+	if params.Lock != nil && p.ChangedLock.HasProjectWithRoot(b.ProjectRoot) {
+		params.ToChange = []gps.ProjectRoot{b.ProjectRoot}
+	}
+
+	s, err := gps.Prepare(params, sm)
+	if err != nil {
+		return verify.LockDelta{}, errors.Wrap(err, "prepare solver")
+	}
+
+	soln, err := s.Solve(ctx)
+	if err != nil {
+		return verify.LockDelta{}, err
+	}
+
+	var l gps.Lock
+	if p.Lock != nil {
+		l = p.Lock
+	}
+
+	ld := verify.DiffLocks(l, LockFromSolution(soln, b.Manifest.PruneOptions))
+	for pr, lpd := range ld.ProjectDeltas {
+		if !lpd.Changed(anyExceptHash) {
+			delete(ld.ProjectDeltas, pr)
+		}
+	}
+	return ld, nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/golang/dep/gps/verify"
+)
+
+// bumpSourceManager serves projects that each hold a single package without
+// imports, at the given versions.
+type bumpSourceManager struct {
+	gps.SourceManager
+	versions map[gps.ProjectRoot][]gps.PairedVersion
+}
+
+func (sm bumpSourceManager) SourceExists(gps.ProjectIdentifier) (bool, error) {
+	return true, nil
+}
+
+func (sm bumpSourceManager) SyncSourceFor(gps.ProjectIdentifier) error {
+	return nil
+}
+
+func (sm bumpSourceManager) ListVersions(id gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	return sm.versions[id.ProjectRoot], nil
+}
+
+func (sm bumpSourceManager) RevisionPresentIn(id gps.ProjectIdentifier, r gps.Revision) (bool, error) {
+	for _, pv := range sm.versions[id.ProjectRoot] {
+		if pv.Revision() == r {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (sm bumpSourceManager) ListPackages(id gps.ProjectIdentifier, _ gps.Version) (pkgtree.PackageTree, error) {
+	ip := string(id.ProjectRoot)
+	return pkgtree.PackageTree{
+		ImportRoot: ip,
+		Packages: map[string]pkgtree.PackageOrErr{
+			ip: {P: pkgtree.Package{ImportPath: ip, Name: "p"}},
+		},
+	}, nil
+}
+
+func (sm bumpSourceManager) GetManifestAndLock(gps.ProjectIdentifier, gps.Version, gps.ProjectAnalyzer) (gps.Manifest, gps.Lock, error) {
+	return NewManifest(), nil, nil
+}
+
+func (sm bumpSourceManager) DeduceProjectRoot(ip string) (gps.ProjectRoot, error) {
+	return gps.ProjectRoot(ip), nil
+}
+
+func (sm bumpSourceManager) SourceURLsForPath(string) ([]*url.URL, error) {
+	return nil, nil
+}
+
+func TestManifestBumpConstraint(t *testing.T) {
+	mkc := func(body string) gps.Constraint {
+		c, err := gps.NewSemverConstraint(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	m := NewManifest()
+	m.Constraints["github.com/a/semver"] = gps.ProjectProperties{
+		Source:     "https://example.com/a/semver",
+		Constraint: mkc("^1.0.0"),
+	}
+	m.Constraints["github.com/a/branch"] = gps.ProjectProperties{
+		Constraint: gps.NewBranch("master"),
+	}
+	m.Constraints["github.com/a/any"] = gps.ProjectProperties{
+		Constraint: gps.Any(),
+	}
+	m.Constraints["github.com/a/overridden"] = gps.ProjectProperties{
+		Constraint: mkc("^1.0.0"),
+	}
+	m.Ovr["github.com/a/overridden"] = gps.ProjectProperties{
+		Constraint: mkc("~1.2.0"),
+	}
+
+	cases := []struct {
+		name     string
+		pr       gps.ProjectRoot
+		to       gps.Version
+		widen    bool
+		want     string
+		override bool
+		err      bool
+	}{
+		{"replace semver", "github.com/a/semver", gps.NewVersion("v2.1.0"), false, "2.1.0", false, false},
+		{"widen semver", "github.com/a/semver", gps.NewVersion("v2.1.0"), true, "1.0.0 || 2.1.0", false, false},
+		{"paired version", "github.com/a/semver", gps.NewVersion("v2.1.0").Pair("abc123"), false, "2.1.0", false, false},
+		{"new project", "github.com/a/new", gps.NewVersion("v0.3.0"), true, "0.3.0", false, false},
+		{"widen any", "github.com/a/any", gps.NewVersion("v0.3.0"), true, "*", false, false},
+		{"branch to semver", "github.com/a/branch", gps.NewVersion("v1.0.0"), false, "1.0.0", false, false},
+		{"widen branch", "github.com/a/branch", gps.NewVersion("v1.0.0"), true, "", false, true},
+		{"semver to branch", "github.com/a/semver", gps.NewBranch("develop"), false, "develop", false, false},
+		{"widen to branch", "github.com/a/semver", gps.NewBranch("develop"), true, "", false, true},
+		{"override", "github.com/a/overridden", gps.NewVersion("v1.5.0"), false, "1.5.0", true, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b, err := m.BumpConstraint(c.pr, c.to, c.widen)
+			if c.err {
+				if err == nil {
+					t.Fatalf("expected an error, got constraint %s", b.New)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if b.New.ImpliedCaretString() != c.want {
+				t.Errorf("expected new constraint %s, got %s", c.want, b.New.ImpliedCaretString())
+			}
+			if b.Override != c.override {
+				t.Errorf("expected override to be %v, got %v", c.override, b.Override)
+			}
+
+			pcs, origpcs := b.Manifest.Constraints, m.Constraints
+			if c.override {
+				pcs, origpcs = b.Manifest.Ovr, m.Ovr
+			}
+			pp, origpp := pcs[c.pr], origpcs[c.pr]
+			if pp.Constraint.String() != b.New.String() {
+				t.Errorf("bumped manifest has constraint %s, expected %s", pp.Constraint, b.New)
+			}
+			if pp.Source != origpp.Source {
+				t.Errorf("expected source %q to be preserved, got %q", origpp.Source, pp.Source)
+			}
+			if (b.Old == nil) != (origpp.Constraint == nil) || b.Old != nil && b.Old.String() != origpp.Constraint.String() {
+				t.Errorf("expected old constraint %s, got %s", origpp.Constraint, b.Old)
+			}
+		})
+	}
+
+	if m.Constraints["github.com/a/semver"].Constraint.String() != mkc("^1.0.0").String() {
+		t.Errorf("original manifest was modified: %s", m.Constraints["github.com/a/semver"].Constraint)
+	}
+	if _, has := m.Constraints["github.com/a/new"]; has {
+		t.Error("original manifest gained a constraint on a new project")
+	}
+}
+
+func TestConstraintBumpImpact(t *testing.T) {
+	td, err := ioutil.TempDir("", "bump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+
+	sm := bumpSourceManager{versions: map[gps.ProjectRoot][]gps.PairedVersion{
+		"github.com/a/bumped": {
+			gps.NewVersion("v2.0.0").Pair("rev3"),
+			gps.NewVersion("v1.1.0").Pair("rev2"),
+			gps.NewVersion("v1.0.0").Pair("rev1"),
+		},
+		"github.com/a/same": {
+			gps.NewVersion("v1.1.0").Pair("rev5"),
+			gps.NewVersion("v1.0.0").Pair("rev4"),
+		},
+	}}
+
+	m := NewManifest()
+	c, err := gps.NewSemverConstraint("^1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Constraints["github.com/a/bumped"] = gps.ProjectProperties{Constraint: c}
+	m.Constraints["github.com/a/same"] = gps.ProjectProperties{Constraint: c}
+
+	mklp := func(pr gps.ProjectRoot, v gps.Version) gps.LockedProject {
+		return verify.VerifiableProject{
+			LockedProject: gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: pr}, v, []string{"."}),
+			PruneOpts:     m.PruneOptions.PruneOptionsFor(pr),
+			Digest:        verify.VersionedDigest{HashVersion: verify.HashVersion, Digest: []byte("digest")},
+		}
+	}
+	lock := &Lock{
+		SolveMeta: SolveMeta{InputImports: []string{"github.com/a/bumped", "github.com/a/same"}},
+		P: []gps.LockedProject{
+			mklp("github.com/a/bumped", gps.NewVersion("v1.1.0").Pair("rev2")),
+			mklp("github.com/a/same", gps.NewVersion("v1.0.0").Pair("rev4")),
+		},
+	}
+	p := &Project{
+		AbsRoot:    td,
+		ImportRoot: "example.com/root",
+		Manifest:   m,
+		Lock:       lock,
+		RootPackageTree: pkgtree.PackageTree{
+			ImportRoot: "example.com/root",
+			Packages: map[string]pkgtree.PackageOrErr{
+				"example.com/root": {P: pkgtree.Package{
+					ImportPath: "example.com/root",
+					Name:       "root",
+					Imports:    []string{"github.com/a/bumped", "github.com/a/same"},
+				}},
+			},
+		},
+	}
+	p.ChangedLock = lock.dup()
+
+	b, err := m.BumpConstraint("github.com/a/bumped", gps.NewVersion("v2.0.0"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, err := b.Impact(context.Background(), p, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pd, has := ld.ProjectDeltas["github.com/a/bumped"]
+	if !has {
+		t.Fatalf("expected a delta for the bumped project, got %v", ld.ProjectDeltas)
+	}
+	if pd.RevisionBefore != "rev2" || pd.RevisionAfter != "rev3" {
+		t.Errorf("expected the bumped project to move from rev2 to rev3, got %s to %s", pd.RevisionBefore, pd.RevisionAfter)
+	}
+	if pd.VersionBefore.String() != "v1.1.0" || pd.VersionAfter.String() != "v2.0.0" {
+		t.Errorf("expected the bumped project to move from v1.1.0 to v2.0.0, got %s to %s", pd.VersionBefore, pd.VersionAfter)
+	}
+	if _, has := ld.ProjectDeltas["github.com/a/same"]; has {
+		t.Errorf("expected no delta for the project that did not change, got %+v", ld.ProjectDeltas["github.com/a/same"])
+	}
+}
@@ -37,6 +37,11 @@ more information on what it means to be "in sync.")
 If your workflow necessitates that you modify the contents of vendor, you can
 force check to ignore hash mismatches on a per-project basis by naming
 project roots in Gopkg.toml's "noverify" list.
+
+Check also lists any projects in Gopkg.lock whose digests are identical. These
+are very likely the same repository under different import paths - a fork, an
+alias, or a case variant - and worth consolidating, but they do not cause check
+to fail.
 `
 
 type checkCommand struct {
@@ -194,7 +199,23 @@ func (cmd *checkCommand) Run(ctx *dep.Ctx, args []string) error {
 				// This will double-print if the hash version is zero, but
 				// that's a rare case that really only occurs before the first
 				// run with a version of dep >=0.5.0, so it's fine.
-				logger.Printf("%s: hash algorithm mismatch, want version %v%s\n", pr, verify.HashVersion, nvSuffix)
+				logger.Printf("%s: digest in Gopkg.lock uses an unsupported hash algorithm%s\n", pr, nvSuffix)
+			}
+		}
+	}
+
+	if p.Lock != nil {
+		if dups := verify.FindDuplicates(p.Lock); len(dups) > 0 {
+			if fail {
+				logger.Println()
+			}
+			logger.Println("# possible duplicate projects:")
+			for _, prs := range dups {
+				names := make([]string, len(prs))
+				for i, pr := range prs {
+					names[i] = string(pr)
+				}
+				logger.Printf("%s: identical contents, consider using only one\n", strings.Join(names, ", "))
 			}
 		}
 	}
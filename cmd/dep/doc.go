@@ -89,7 +89,7 @@
 //
 // Usage:
 //
-//  ensure [-update | -add] [-no-vendor | -vendor-only] [-dry-run] [<spec>...]
+//  ensure [-update | -add] [-no-vendor | -vendor-only] [-no-downgrade] [-dry-run] [<spec>...]
 //
 // Project spec:
 //
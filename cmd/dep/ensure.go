@@ -6,15 +6,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"go/build"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/dep"
 	"github.com/golang/dep/gps"
@@ -110,6 +113,11 @@ dep ensure -update -no-vendor
 
     As above, but only modify Gopkg.lock; leave vendor/ unchanged.
 
+dep ensure -update -no-downgrade github.com/pkg/foo
+
+    Update github.com/pkg/foo, but fail rather than move any other dependency
+    in Gopkg.lock to an older version than it is currently locked to.
+
 dep ensure -no-vendor -dry-run
 
     This fails with a non zero exit code if Gopkg.lock is not up to date with
@@ -125,7 +133,7 @@ var (
 
 func (cmd *ensureCommand) Name() string { return "ensure" }
 func (cmd *ensureCommand) Args() string {
-	return "[-update | -add] [-no-vendor | -vendor-only] [-dry-run] [-v] [<spec>...]"
+	return "[-update | -add] [-no-vendor | -vendor-only] [-no-downgrade] [-dry-run] [-v] [<spec>...]"
 }
 func (cmd *ensureCommand) ShortHelp() string { return ensureShortHelp }
 func (cmd *ensureCommand) LongHelp() string  { return ensureLongHelp }
@@ -138,15 +146,17 @@ func (cmd *ensureCommand) Register(fs *flag.FlagSet) {
 	fs.BoolVar(&cmd.vendorOnly, "vendor-only", false, "populate vendor/ from Gopkg.lock without updating it first")
 	fs.BoolVar(&cmd.noVendor, "no-vendor", false, "update Gopkg.lock (if needed), but do not update vendor/")
 	fs.BoolVar(&cmd.dryRun, "dry-run", false, "only report the changes that would be made")
+	fs.BoolVar(&cmd.noDowngrade, "no-downgrade", false, "fail rather than move any dependency not named with -update to an older version than is in Gopkg.lock")
 }
 
 type ensureCommand struct {
-	examples   bool
-	update     bool
-	add        bool
-	noVendor   bool
-	vendorOnly bool
-	dryRun     bool
+	examples    bool
+	update      bool
+	add         bool
+	noVendor    bool
+	vendorOnly  bool
+	dryRun      bool
+	noDowngrade bool
 }
 
 func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
@@ -179,6 +189,14 @@ func (cmd *ensureCommand) Run(ctx *dep.Ctx, args []string) error {
 	if ctx.Verbose {
 		params.TraceLogger = ctx.Err
 	}
+	params.NoDowngrades = cmd.noDowngrade
+	params.FetchBudget = ctx.FetchBudget
+	params.MajorVersions = ctx.MajorVersions
+	params.Prereleases = ctx.Prereleases
+	params.Preference = ctx.Preference
+	if err := loadVersionSnapshot(ctx, &params); err != nil {
+		return err
+	}
 
 	if cmd.vendorOnly {
 		return cmd.runVendorOnly(ctx, args, p, sm, params)
@@ -234,6 +252,9 @@ func (cmd *ensureCommand) validateFlags() error {
 			// TODO(sdboyer) can't think of anything not snarky right now
 			return errors.New("really?")
 		}
+		if cmd.noDowngrade {
+			return errors.New("-vendor-only makes -no-downgrade a no-op; cannot pass them together")
+		}
 	}
 	return nil
 }
@@ -251,25 +272,36 @@ func (cmd *ensureCommand) runDefault(ctx *dep.Ctx, args []string, p *dep.Project
 		return errors.New("dep ensure only takes spec arguments with -add or -update")
 	}
 
-	if err := ctx.ValidateParams(sm, params); err != nil {
-		return err
-	}
-
 	var solve bool
 	lock := p.ChangedLock
-	if lock != nil {
-		lsat := verify.LockSatisfiesInputs(p.Lock, p.Manifest, params.RootPackageTree)
-		if !lsat.Satisfied() {
-			if ctx.Verbose {
-				ctx.Out.Printf("# Gopkg.lock is out of sync with Gopkg.toml and project imports:\n%s\n\n", sprintLockUnsat(lsat))
-			}
-			solve = true
-		} else if cmd.noVendor {
-			// The user said not to touch vendor/, so definitely nothing to do.
+	if p.InputsUnchanged() {
+		// Neither the imports nor the manifest have changed since the lock was
+		// solved, so it cannot be out of sync with them.
+		if ctx.Verbose {
+			ctx.Out.Println("# Gopkg.lock inputs are unchanged, no solve needed")
+		}
+		if cmd.noVendor {
 			return nil
 		}
 	} else {
-		solve = true
+		if err := ctx.ValidateParams(sm, params); err != nil {
+			return err
+		}
+
+		if lock != nil {
+			lsat := verify.LockSatisfiesInputs(p.Lock, p.Manifest, params.RootPackageTree)
+			if !lsat.Satisfied() {
+				if ctx.Verbose {
+					ctx.Out.Printf("# Gopkg.lock is out of sync with Gopkg.toml and project imports:\n%s\n\n", sprintLockUnsat(lsat))
+				}
+				solve = true
+			} else if cmd.noVendor {
+				// The user said not to touch vendor/, so definitely nothing to do.
+				return nil
+			}
+		} else {
+			solve = true
+		}
 	}
 
 	if solve {
@@ -280,9 +312,18 @@ func (cmd *ensureCommand) runDefault(ctx *dep.Ctx, args []string, p *dep.Project
 
 		solution, err := solver.Solve(context.TODO())
 		if err != nil {
-			return handleAllTheFailuresOfTheWorld(err)
+			return handleAllTheFailuresOfTheWorld(minimizeSolveFailure(ctx, params, sm, err))
 		}
 		lock = dep.LockFromSolution(solution, p.Manifest.PruneOptions)
+		recordLockAudit(ctx, p, lock, solution)
+		reportSubstitutions(ctx, solution)
+		reportMajorVersionWarnings(ctx, solution)
+		if err := saveVersionSnapshot(ctx, solution); err != nil {
+			return err
+		}
+	}
+	if err := recordInputsDigest(ctx, p, lock); err != nil {
+		return err
 	}
 
 	dw, err := dep.NewDeltaWriter(p, lock, cmd.vendorBehavior())
@@ -317,6 +358,7 @@ func (cmd *ensureCommand) runVendorOnly(ctx *dep.Ctx, args []string, p *dep.Proj
 	if err != nil {
 		return err
 	}
+	dw.DigestAlgorithm = p.Manifest.DigestAlgorithm
 
 	if cmd.dryRun {
 		return dw.PrintPreparedActions(ctx.Out, ctx.Verbose)
@@ -358,10 +400,20 @@ func (cmd *ensureCommand) runUpdate(ctx *dep.Ctx, args []string, p *dep.Project,
 		// TODO(sdboyer) special handling for warning cases as described in spec
 		// - e.g., named projects did not upgrade even though newer versions
 		// were available.
-		return handleAllTheFailuresOfTheWorld(err)
+		return handleAllTheFailuresOfTheWorld(minimizeSolveFailure(ctx, params, sm, err))
 	}
 
-	dw, err := dep.NewDeltaWriter(p, dep.LockFromSolution(solution, p.Manifest.PruneOptions), cmd.vendorBehavior())
+	lock := dep.LockFromSolution(solution, p.Manifest.PruneOptions)
+	recordLockAudit(ctx, p, lock, solution)
+	reportSubstitutions(ctx, solution)
+	reportMajorVersionWarnings(ctx, solution)
+	if err := saveVersionSnapshot(ctx, solution); err != nil {
+		return err
+	}
+	if err := recordInputsDigest(ctx, p, lock); err != nil {
+		return err
+	}
+	dw, err := dep.NewDeltaWriter(p, lock, cmd.vendorBehavior())
 	if err != nil {
 		return err
 	}
@@ -394,7 +446,7 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 		}
 	} else {
 		// We'll only hit this branch if Gopkg.lock did not exist.
-		rm, _ := p.RootPackageTree.ToReachMap(true, true, false, p.Manifest.IgnoredPackages())
+		rm, _ := p.RootPackageTree.ToReachMap(true, true, false, gps.IgnoredAndExternalPackages(p.Manifest))
 		for _, imp := range rm.FlattenFn(paths.IsStandardImportPath) {
 			exmap[imp] = true
 		}
@@ -587,7 +639,7 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 	solution, err := solver.Solve(context.TODO())
 	if err != nil {
 		// TODO(sdboyer) detect if the failure was specifically about some of the -add arguments
-		return handleAllTheFailuresOfTheWorld(err)
+		return handleAllTheFailuresOfTheWorld(minimizeSolveFailure(ctx, params, sm, err))
 	}
 
 	// Prep post-actions and feedback from adds.
@@ -630,7 +682,17 @@ func (cmd *ensureCommand) runAdd(ctx *dep.Ctx, args []string, p *dep.Project, sm
 	}
 	sort.Strings(reqlist)
 
-	dw, err := dep.NewDeltaWriter(p, dep.LockFromSolution(solution, p.Manifest.PruneOptions), cmd.vendorBehavior())
+	lock := dep.LockFromSolution(solution, p.Manifest.PruneOptions)
+	recordLockAudit(ctx, p, lock, solution)
+	reportSubstitutions(ctx, solution)
+	reportMajorVersionWarnings(ctx, solution)
+	if err := saveVersionSnapshot(ctx, solution); err != nil {
+		return err
+	}
+	if err := recordInputsDigest(ctx, p, lock); err != nil {
+		return err
+	}
+	dw, err := dep.NewDeltaWriter(p, lock, cmd.vendorBehavior())
 	if err != nil {
 		return err
 	}
@@ -852,3 +914,121 @@ func validateUpdateArgs(ctx *dep.Ctx, args []string, p *dep.Project, sm gps.Sour
 
 	return nil
 }
+
+// recordLockAudit populates the audit trail on a newly solved lock if auditing
+// was requested, or if the project's existing lock already carries one.
+func recordLockAudit(ctx *dep.Ctx, p *dep.Project, l *dep.Lock, soln gps.Solution) {
+	if ctx.LockAudit || (p.Lock != nil && p.Lock.Audit != nil) {
+		l.RecordAudit(soln, p.Lock, time.Now())
+	}
+}
+
+// reportSubstitutions warns of each project that the solution retrieves from a
+// fallback source, as its declared source could not be reached.
+func reportSubstitutions(ctx *dep.Ctx, soln gps.Solution) {
+	substs := soln.Substitutions()
+	prs := make([]string, 0, len(substs))
+	for pr := range substs {
+		prs = append(prs, string(pr))
+	}
+	sort.Strings(prs)
+
+	for _, pr := range prs {
+		sub := substs[gps.ProjectRoot(pr)]
+		src := pr
+		if sub.Declared != "" {
+			src = sub.Declared
+		}
+		ctx.Err.Printf("Warning: %s could not be reached, so %s is being retrieved from the fallback source %s, which has its locked revision %s\n", src, pr, sub.Substitute, sub.Revision)
+	}
+}
+
+// reportMajorVersionWarnings warns of each project for which the solution
+// selected a version whose major version is not reflected in its import path,
+// under a constraint that also admits earlier major versions.
+func reportMajorVersionWarnings(ctx *dep.Ctx, soln gps.Solution) {
+	warnings := soln.MajorVersionWarnings()
+	prs := make([]string, 0, len(warnings))
+	for pr := range warnings {
+		prs = append(prs, string(pr))
+	}
+	sort.Strings(prs)
+
+	for _, pr := range prs {
+		ctx.Err.Printf("Warning: %s %s, and may not be compatible with them\n", pr, warnings[gps.ProjectRoot(pr)])
+	}
+}
+
+// versionSnapshotPath returns the path of the version snapshot file named by
+// $DEPVERSIONSNAPSHOT, relative to the working directory, or the empty string
+// if it is not set.
+func versionSnapshotPath(ctx *dep.Ctx) string {
+	if ctx.VersionSnapshot == "" || filepath.IsAbs(ctx.VersionSnapshot) {
+		return ctx.VersionSnapshot
+	}
+	return filepath.Join(ctx.WorkingDir, ctx.VersionSnapshot)
+}
+
+// loadVersionSnapshot arranges for the solve to use the versions recorded in
+// the version snapshot file, if there is one, or else to capture them so that
+// saveVersionSnapshot can create it.
+func loadVersionSnapshot(ctx *dep.Ctx, params *gps.SolveParameters) error {
+	path := versionSnapshotPath(ctx)
+	if path == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		params.CaptureVersions = true
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "could not read version snapshot")
+	}
+
+	var vs gps.VersionSnapshot
+	if err := json.Unmarshal(b, &vs); err != nil {
+		return errors.Wrapf(err, "could not parse version snapshot %s", path)
+	}
+	params.VersionSnapshot = vs
+	if ctx.Verbose {
+		ctx.Err.Printf("Using the versions of %d projects recorded in %s\n", len(vs), path)
+	}
+	return nil
+}
+
+// saveVersionSnapshot writes the versions captured by the solve to the version
+// snapshot file, if they were captured.
+func saveVersionSnapshot(ctx *dep.Ctx, soln gps.Solution) error {
+	vs := soln.VersionSnapshot()
+	if vs == nil {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(vs, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not encode version snapshot")
+	}
+	path := versionSnapshotPath(ctx)
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0666); err != nil {
+		return errors.Wrap(err, "could not write version snapshot")
+	}
+	if ctx.Verbose {
+		ctx.Err.Printf("Recorded the versions of %d projects in %s\n", len(vs), path)
+	}
+	return nil
+}
+
+// recordInputsDigest records the digest of the project's current inputs on a
+// lock if it was requested, or if the project's existing lock already carries
+// one.
+func recordInputsDigest(ctx *dep.Ctx, p *dep.Project, l *dep.Lock) error {
+	if ctx.InputsDigest || (p.Lock != nil && p.Lock.SolveMeta.InputsDigest != "") {
+		digest, err := p.InputsDigest()
+		if err != nil {
+			return err
+		}
+		l.SolveMeta.InputsDigest = digest
+	}
+	return nil
+}
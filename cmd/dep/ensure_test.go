@@ -45,6 +45,12 @@ func TestInvalidEnsureFlagCombinations(t *testing.T) {
 	}
 	ec.noVendor = false
 
+	ec.noDowngrade = true
+	if err := ec.validateFlags(); err == nil {
+		t.Error("-vendor-only with -no-downgrade should fail validation")
+	}
+	ec.noDowngrade = false
+
 	// Also verify that the plain ensure path takes no args. This is a shady
 	// test, as lots of other things COULD return errors, and we don't check
 	// anything other than the error being non-nil. For now, it works well
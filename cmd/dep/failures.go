@@ -7,6 +7,7 @@ package main
 import (
 	"context"
 
+	"github.com/golang/dep"
 	"github.com/golang/dep/gps"
 	"github.com/pkg/errors"
 )
@@ -19,5 +20,24 @@ func handleAllTheFailuresOfTheWorld(err error) error {
 		return nil
 	}
 
+	// A SolveFailure can explain itself at more length than its Error method
+	// does, with the constraints that led to the conflict.
+	if sf, ok := err.(*gps.SolveFailure); ok {
+		return errors.Errorf("Solving failure: %s", sf.String())
+	}
 	return errors.Wrap(err, "Solving failure")
 }
+
+// minimizeSolveFailure narrows a SolveFailure down to a minimal set of
+// conflicting requirements, if $DEPMINIMIZE is set, by solving again with the
+// provided params and sm. Other errors are returned as they are.
+func minimizeSolveFailure(ctx *dep.Ctx, params gps.SolveParameters, sm gps.SourceManager, err error) error {
+	sf, ok := err.(*gps.SolveFailure)
+	if !ok || !ctx.MinimizeFailure {
+		return err
+	}
+	if merr := sf.Minimize(context.TODO(), params, sm); merr != nil {
+		ctx.Err.Printf("Unable to minimize the solve failure: %s\n", merr)
+	}
+	return err
+}
@@ -170,25 +170,12 @@ func contains(a []string, b string) bool {
 func getProjectPropertiesFromVersion(v gps.Version) gps.ProjectProperties {
 	pp := gps.ProjectProperties{}
 
-	// extract version and ignore if it's revision only
-	switch tv := v.(type) {
-	case gps.PairedVersion:
-		v = tv.Unpair()
-	case gps.Revision:
+	// ignore the version if it's revision only
+	if _, ok := v.(gps.Revision); ok {
 		return pp
 	}
 
-	switch v.Type() {
-	case gps.IsBranch, gps.IsVersion:
-		pp.Constraint = v
-	case gps.IsSemver:
-		c, err := gps.NewSemverConstraintIC(v.String())
-		if err != nil {
-			panic(err)
-		}
-		pp.Constraint = c
-	}
-
+	pp.Constraint = gps.SuggestConstraint(v, nil)
 	return pp
 }
 
@@ -137,11 +137,18 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 		Manifest:        p.Manifest,
 		Lock:            p.Lock,
 		ProjectAnalyzer: rootAnalyzer,
+		FetchBudget:     ctx.FetchBudget,
+		MajorVersions:   ctx.MajorVersions,
+		Prereleases:     ctx.Prereleases,
+		Preference:      ctx.Preference,
 	}
 
 	if ctx.Verbose {
 		params.TraceLogger = ctx.Err
 	}
+	if err := loadVersionSnapshot(ctx, &params); err != nil {
+		return errors.Wrap(err, "init failed")
+	}
 
 	if err := ctx.ValidateParams(sm, params); err != nil {
 		return errors.Wrapf(err, "init failed: validation of solve parameters failed")
@@ -154,12 +161,21 @@ func (cmd *initCommand) Run(ctx *dep.Ctx, args []string) error {
 
 	soln, err := s.Solve(context.TODO())
 	if err != nil {
-		err = handleAllTheFailuresOfTheWorld(err)
+		err = handleAllTheFailuresOfTheWorld(minimizeSolveFailure(ctx, params, sm, err))
 		return errors.Wrap(err, "init failed: unable to solve the dependency graph")
 	}
-	p.Lock = dep.LockFromSolution(soln, p.Manifest.PruneOptions)
+	l := dep.LockFromSolution(soln, p.Manifest.PruneOptions)
+	recordLockAudit(ctx, p, l, soln)
+	reportMajorVersionWarnings(ctx, soln)
+	if err := saveVersionSnapshot(ctx, soln); err != nil {
+		return errors.Wrap(err, "init failed")
+	}
+	p.Lock = l
 
 	rootAnalyzer.FinalizeRootManifestAndLock(p.Manifest, p.Lock, copyLock)
+	if err := recordInputsDigest(ctx, p, p.Lock); err != nil {
+		return errors.Wrap(err, "init failed: unable to compute the inputs digest")
+	}
 
 	// Pass timestamp (yyyyMMddHHmmss format) as suffix to backup name.
 	vendorbak, err := dep.BackupVendor(filepath.Join(root, "vendor"), time.Now().Format("20060102150405"))
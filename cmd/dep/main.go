@@ -12,15 +12,18 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/golang/dep"
+	"github.com/golang/dep/gps"
 	"github.com/golang/dep/internal/fs"
 )
 
@@ -195,14 +198,120 @@ func (c *Config) Run() int {
 				}
 			}
 
+			// Private patterns default to those used by the go command.
+			private := getEnv(c.Env, "DEPPRIVATE")
+			if private == "" {
+				private = getEnv(c.Env, "GOPRIVATE")
+			}
+
+			// Vendor normalization uses SOURCE_DATE_EPOCH, if set, as the
+			// timestamp for all files, in keeping with reproducible build tools.
+			normalize := getEnv(c.Env, "DEPNORMALIZE") != ""
+			vendorModTime := defaultNormalizedModTime
+			if env := getEnv(c.Env, "SOURCE_DATE_EPOCH"); normalize && env != "" {
+				secs, err := strconv.ParseInt(env, 10, 64)
+				if err != nil {
+					errLogger.Printf("dep: failed to parse $SOURCE_DATE_EPOCH %q: %v\n", env, err)
+					return errorExitCode
+				}
+				vendorModTime = time.Unix(secs, 0)
+			}
+
+			var fetchBudget int64
+			if env := getEnv(c.Env, "DEPFETCHBUDGET"); env != "" {
+				var err error
+				fetchBudget, err = parseByteSize(env)
+				if err != nil {
+					errLogger.Printf("dep: failed to parse $DEPFETCHBUDGET size %q: %v\n", env, err)
+					return errorExitCode
+				}
+			}
+
+			var concurrency int
+			if env := getEnv(c.Env, "DEPCONCURRENCY"); env != "" {
+				n, err := strconv.Atoi(env)
+				if err != nil || n <= 0 {
+					errLogger.Printf("dep: $DEPCONCURRENCY must be a positive number, got %q\n", env)
+					return errorExitCode
+				}
+				concurrency = n
+			}
+
+			var majorVersions gps.MajorVersionPolicy
+			if env := getEnv(c.Env, "DEPMAJORVERSIONS"); env != "" {
+				var err error
+				majorVersions, err = gps.ParseMajorVersionPolicy(env)
+				if err != nil {
+					errLogger.Printf("dep: failed to parse $DEPMAJORVERSIONS: %v\n", err)
+					return errorExitCode
+				}
+			}
+
+			var prereleases gps.PrereleasePolicy
+			if env := getEnv(c.Env, "DEPPRERELEASES"); env != "" {
+				var err error
+				prereleases, err = gps.ParsePrereleasePolicy(env)
+				if err != nil {
+					errLogger.Printf("dep: failed to parse $DEPPRERELEASES: %v\n", err)
+					return errorExitCode
+				}
+			}
+
+			var preference gps.VersionPreference
+			if env := getEnv(c.Env, "DEPPREFERENCE"); env != "" {
+				var err error
+				preference, err = gps.ParseVersionPreference(env)
+				if err != nil {
+					errLogger.Printf("dep: failed to parse $DEPPREFERENCE: %v\n", err)
+					return errorExitCode
+				}
+			}
+
+			importRewrites, err := gps.ParseImportRewrites(getEnv(c.Env, "DEPREWRITE"))
+			if err != nil {
+				errLogger.Printf("dep: failed to parse $DEPREWRITE: %v\n", err)
+				return errorExitCode
+			}
+
+			tokens, err := gps.ParseHostTokens(getEnv(c.Env, "DEPTOKENS"))
+			if err != nil {
+				errLogger.Printf("dep: failed to parse $DEPTOKENS: %v\n", err)
+				return errorExitCode
+			}
+			creds := gps.VCSCredentials{
+				SSHKey: getEnv(c.Env, "DEPSSHKEY"),
+				Netrc:  getEnv(c.Env, "DEPNETRC"),
+				Tokens: tokens,
+			}
+
 			// Set up dep context.
 			ctx := &dep.Ctx{
-				Out:            outLogger,
-				Err:            errLogger,
-				Verbose:        verbose,
-				DisableLocking: getEnv(c.Env, "DEPNOLOCK") != "",
-				Cachedir:       cachedir,
-				CacheAge:       cacheAge,
+				Out:             outLogger,
+				Err:             errLogger,
+				Verbose:         verbose,
+				DisableLocking:  getEnv(c.Env, "DEPNOLOCK") != "",
+				LockAudit:       getEnv(c.Env, "DEPLOCKAUDIT") != "",
+				InputsDigest:    getEnv(c.Env, "DEPINPUTSDIGEST") != "",
+				PrivatePatterns: private,
+				SourceProtocols: getEnv(c.Env, "DEPPROTOCOL"),
+				SourceMirrors:   getEnv(c.Env, "DEPMIRROR"),
+				Registries:      getEnv(c.Env, "DEPREGISTRY"),
+				InheritVCSAuth:  getEnv(c.Env, "DEPVCSAUTH") != "",
+				VCSCredentials:  creds,
+				CacheRefs:       getEnv(c.Env, "DEPREFCACHE") != "",
+				Offline:         getEnv(c.Env, "DEPOFFLINE") != "",
+				MinimizeFailure: getEnv(c.Env, "DEPMINIMIZE") != "",
+				NormalizeVendor: normalize,
+				VendorModTime:   vendorModTime,
+				ImportRewrites:  importRewrites,
+				Cachedir:        cachedir,
+				CacheAge:        cacheAge,
+				FetchBudget:     fetchBudget,
+				Concurrency:     concurrency,
+				VersionSnapshot: getEnv(c.Env, "DEPVERSIONSNAPSHOT"),
+				MajorVersions:   majorVersions,
+				Prereleases:     prereleases,
+				Preference:      preference,
 			}
 
 			GOPATHS := filepath.SplitList(getEnv(c.Env, "GOPATH"))
@@ -343,6 +452,43 @@ func parseArgs(args []string) (cmdName string, printCmdUsage bool, exit bool) {
 	return cmdName, printCmdUsage, exit
 }
 
+// defaultNormalizedModTime is the timestamp applied to vendored files by
+// DEPNORMALIZE when SOURCE_DATE_EPOCH is not set. It is the earliest time
+// representable in a zip archive, which avoids surprising tools that treat the
+// Unix epoch as an unset time.
+var defaultNormalizedModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// byteSizeSuffixes are the unit suffixes accepted by parseByteSize.
+var byteSizeSuffixes = []struct {
+	suffix string
+	mult   int64
+}{
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// parseByteSize parses a number of bytes, optionally followed by a K, M or G
+// suffix, in either case, for kibibytes, mebibytes or gibibytes respectively.
+func parseByteSize(s string) (int64, error) {
+	num, mult := strings.ToUpper(s), int64(1)
+	for _, u := range byteSizeSuffixes {
+		if strings.HasSuffix(num, u.suffix) {
+			num, mult = strings.TrimSuffix(num, u.suffix), u.mult
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > math.MaxInt64/mult {
+		return 0, fmt.Errorf("size out of range")
+	}
+	return n * mult, nil
+}
+
 // getEnv returns the last instance of an environment variable.
 func getEnv(env []string, key string) string {
 	for i := len(env) - 1; i >= 0; i-- {
@@ -1126,7 +1126,7 @@ func (cmd *statusCommand) runStatusAll(ctx *dep.Ctx, out outputter, p *dep.Proje
 		return false, errCount, err
 	}
 
-	rm, _ := ptree.ToReachMap(true, true, false, p.Manifest.IgnoredPackages())
+	rm, _ := ptree.ToReachMap(true, true, false, gps.IgnoredAndExternalPackages(p.Manifest))
 
 	external := rm.FlattenFn(paths.IsStandardImportPath)
 	roots := make(map[gps.ProjectRoot][]string, len(external))
@@ -39,15 +39,35 @@ import (
 //	}
 //
 type Ctx struct {
-	WorkingDir     string        // Where to execute.
-	GOPATH         string        // Selected Go path, containing WorkingDir.
-	GOPATHs        []string      // Other Go paths.
-	ExplicitRoot   string        // An explicitly-set path to use as the project root.
-	Out, Err       *log.Logger   // Required loggers.
-	Verbose        bool          // Enables more verbose logging.
-	DisableLocking bool          // When set, no lock file will be created to protect against simultaneous dep processes.
-	Cachedir       string        // Cache directory loaded from environment.
-	CacheAge       time.Duration // Maximum valid age of cached source data. <=0: Don't cache.
+	WorkingDir      string                 // Where to execute.
+	GOPATH          string                 // Selected Go path, containing WorkingDir.
+	GOPATHs         []string               // Other Go paths.
+	ExplicitRoot    string                 // An explicitly-set path to use as the project root.
+	Out, Err        *log.Logger            // Required loggers.
+	Verbose         bool                   // Enables more verbose logging.
+	DisableLocking  bool                   // When set, no lock file will be created to protect against simultaneous dep processes.
+	Cachedir        string                 // Cache directory loaded from environment.
+	CacheAge        time.Duration          // Maximum valid age of cached source data. <=0: Don't cache.
+	LockAudit       bool                   // When set, the lock records how and when each project's version was selected.
+	InputsDigest    bool                   // When set, the lock records a digest of the inputs it was solved from.
+	PrivatePatterns string                 // Comma-separated glob patterns of import paths to treat as private.
+	SourceProtocols string                 // Comma-separated pattern=protocol preferences for fetching sources.
+	SourceMirrors   string                 // Comma-separated prefix=url locations from which to fetch sources instead.
+	Registries      string                 // Comma-separated prefix=url registries from which to retrieve projects before their sources.
+	InheritVCSAuth  bool                   // When set, VCS commands use the user's authentication configuration.
+	VCSCredentials  gps.VCSCredentials     // Credentials with which git authenticates to private sources.
+	CacheRefs       bool                   // When set, the refs advertised by git sources are cached between runs.
+	Offline         bool                   // When set, sources are only read from the local cache, never from the network.
+	MinimizeFailure bool                   // When set, solve failures are narrowed down to a minimal set of conflicting requirements.
+	NormalizeVendor bool                   // When set, vendored files are given normalized modes and timestamps.
+	VendorModTime   time.Time              // The timestamp given to vendored files when NormalizeVendor is set.
+	ImportRewrites  []gps.ImportRewrite    // Rules for rewriting the import paths of vendored Go source files.
+	FetchBudget     int64                  // If positive, the maximum number of bytes a solve may fetch from upstream sources.
+	Concurrency     int                    // If positive, the number of sources whose versions may be listed, or which may be synced, at once.
+	VersionSnapshot string                 // If set, the file from which to replay, or to which to record, the versions visible to a solve.
+	MajorVersions   gps.MajorVersionPolicy // Whether major versions not reflected in import paths are admissible under constraints that admit earlier ones.
+	Prereleases     gps.PrereleasePolicy   // Which prerelease versions semver constraints admit.
+	Preference      gps.VersionPreference  // Which admissible versions are tried first when solving.
 }
 
 // SetPaths sets the WorkingDir and GOPATHs fields. If GOPATHs is empty, then
@@ -108,13 +128,35 @@ func (c *Ctx) SourceManager() (*gps.SourceMgr, error) {
 	}
 
 	return gps.NewSourceManager(gps.SourceManagerConfig{
-		CacheAge:       c.CacheAge,
-		Cachedir:       cachedir,
-		Logger:         c.Out,
-		DisableLocking: c.DisableLocking,
+		CacheAge:        c.CacheAge,
+		Cachedir:        cachedir,
+		Logger:          c.Out,
+		DisableLocking:  c.DisableLocking,
+		PrivatePatterns: c.PrivatePatterns,
+		SourceProtocols: c.SourceProtocols,
+		SourceMirrors:   c.SourceMirrors,
+		InheritVCSAuth:  c.InheritVCSAuth,
+		Credentials:     c.VCSCredentials,
+		Offline:         c.Offline,
+		Normalize:       c.exportNormalization(),
+		ImportRewrites:  c.ImportRewrites,
+
+		CacheRefAdvertisements: c.CacheRefs,
+		SourceConcurrency:      c.Concurrency,
+		SourceRegistries:       c.Registries,
 	})
 }
 
+func (c *Ctx) exportNormalization() gps.ExportNormalization {
+	if !c.NormalizeVendor {
+		return gps.ExportNormalization{}
+	}
+	return gps.ExportNormalization{
+		Modes:   true,
+		ModTime: c.VendorModTime,
+	}
+}
+
 // LoadProject starts from the current working directory and searches up the
 // directory tree for a project root.  The search stops when a file with the name
 // ManifestName (Gopkg.toml, by default) is located.
@@ -149,10 +191,16 @@ func (c *Ctx) LoadProject() (*Project, error) {
 	} else {
 		ip, err := c.ImportForAbs(p.AbsRoot)
 		if err != nil {
-			return nil, errors.Wrap(err, "root project import")
+			// The project may be reached via a symlink from outside of any
+			// GOPATH, in which case only the resolved root yields an import path.
+			var rerr error
+			if ip, rerr = c.ImportForAbs(p.ResolvedAbsRoot); rerr != nil {
+				return nil, errors.Wrap(err, "root project import")
+			}
 		}
 		p.ImportRoot = gps.ProjectRoot(ip)
 	}
+	p.ImportAliases = c.importAliasesFor(p)
 
 	mp := filepath.Join(p.AbsRoot, ManifestName)
 	mf, err := os.Open(mp)
@@ -174,6 +222,15 @@ func (c *Ctx) LoadProject() (*Project, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "error while parsing %s", mp)
 	}
+	if p.Manifest.Base != "" {
+		p.Manifest, warns, err = inheritBaseManifests(p.Manifest, p.AbsRoot)
+		for _, warn := range warns {
+			c.Err.Printf("dep: WARNING: %v\n", warn)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error while composing %s with its base", mp)
+		}
+	}
 
 	// Parse in the root package tree.
 	ptree, err := p.parseRootPackageTree()
@@ -196,12 +253,14 @@ func (c *Ctx) LoadProject() (*Project, error) {
 		if p.Lock != nil {
 			p.ChangedLock = p.Lock.dup()
 			p.ChangedLock.SolveMeta.InputImports = externalImportList(ptree, p.Manifest)
+			p.ChangedLock.SolveMeta.ExternalImports = externallySatisfiedImports(ptree, p.Manifest)
 
 			for k, lp := range p.ChangedLock.Projects() {
 				vp := lp.(verify.VerifiableProject)
 				vp.PruneOpts = p.Manifest.PruneOptions.PruneOptionsFor(lp.Ident().ProjectRoot)
 				p.ChangedLock.P[k] = vp
 			}
+			p.ChangedLock.recordMetadata(p.Manifest)
 		}
 
 	} else if !os.IsNotExist(err) {
@@ -214,7 +273,7 @@ func (c *Ctx) LoadProject() (*Project, error) {
 }
 
 func externalImportList(rpt pkgtree.PackageTree, m gps.RootManifest) []string {
-	rm, _ := rpt.ToReachMap(true, true, false, m.IgnoredPackages())
+	rm, _ := rpt.ToReachMap(true, true, false, gps.IgnoredAndExternalPackages(m))
 	reach := rm.FlattenFn(paths.IsStandardImportPath)
 	req := m.RequiredPackages()
 
@@ -240,6 +299,25 @@ func externalImportList(rpt pkgtree.PackageTree, m gps.RootManifest) []string {
 	return reach
 }
 
+// externallySatisfiedImports returns the imports from the package tree that
+// the manifest declares to be satisfied externally. It mirrors the solver's
+// computation of Solution.ExternalImports.
+func externallySatisfiedImports(rpt pkgtree.PackageTree, m *Manifest) []string {
+	ext := m.ExternalPackages()
+	if ext.Len() == 0 {
+		return nil
+	}
+
+	rm, _ := rpt.ToReachMap(true, true, false, m.IgnoredPackages())
+	var imps []string
+	for _, ip := range rm.FlattenFn(nil) {
+		if ext.IsIgnored(ip) {
+			imps = append(imps, ip)
+		}
+	}
+	return imps
+}
+
 // DetectProjectGOPATH attempt to find the GOPATH containing the project.
 //
 //  If p.AbsRoot is not a symlink and is within a GOPATH, the GOPATH containing p.AbsRoot is returned.
@@ -308,6 +386,30 @@ func (c *Ctx) detectGOPATH(path string) (string, error) {
 	return "", errors.Errorf("%s is not within a known GOPATH/src", path)
 }
 
+// importAliasesFor returns the import paths, other than p.ImportRoot, under
+// which the project's packages could be imported given its location within
+// GOPATH. This only yields results when the import root has been set
+// explicitly, as otherwise the import root is itself derived from GOPATH.
+func (c *Ctx) importAliasesFor(p *Project) []string {
+	var aliases []string
+	for _, root := range []string{p.AbsRoot, p.ResolvedAbsRoot} {
+		ip, err := c.ImportForAbs(root)
+		if err != nil || ip == string(p.ImportRoot) {
+			continue
+		}
+
+		var seen bool
+		for _, alias := range aliases {
+			seen = seen || alias == ip
+		}
+		if !seen {
+			aliases = append(aliases, ip)
+		}
+	}
+
+	return aliases
+}
+
 // ImportForAbs returns the import path for an absolute project path by trimming the
 // `$GOPATH/src/` prefix.  Returns an error for paths equal to, or without this prefix.
 func (c *Ctx) ImportForAbs(path string) (string, error) {
@@ -10,6 +10,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
@@ -215,6 +216,76 @@ func TestExplicitRootProject(t *testing.T) {
 	}
 }
 
+func TestLoadProjectImportAliases(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir(filepath.Join("src", "test1", "sub"))
+	h.TempFile(filepath.Join("src", "test1", ManifestName), "")
+	h.TempFile(filepath.Join("src", "test1", "main.go"), "package main\nimport _ \"test1/sub\"\n")
+	h.TempFile(filepath.Join("src", "test1", "sub", "sub.go"), "package sub\nimport _ \"github.com/user/module/sub\"\n")
+
+	ctx := &Ctx{
+		Out: discardLogger(),
+		Err: discardLogger(),
+	}
+	if err := ctx.SetPaths(h.Path(filepath.Join("src", "test1")), h.Path(".")); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	ctx.ExplicitRoot = "github.com/user/module"
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		t.Fatalf("LoadProject failed: %+v", err)
+	}
+
+	if !reflect.DeepEqual(p.ImportAliases, []string{"test1"}) {
+		t.Errorf("expected GOPATH-derived import path to be an alias, got %v", p.ImportAliases)
+	}
+
+	// Both the alias and the explicit root refer to the project itself, so
+	// neither should be seen as external.
+	if reach := externalImportList(p.RootPackageTree, p.Manifest); len(reach) != 0 {
+		t.Errorf("expected no external imports, got %v", reach)
+	}
+}
+
+func TestLoadProjectThroughSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir(filepath.Join("go", "src", "real", "path"))
+	h.TempFile(filepath.Join("go", "src", "real", "path", ManifestName), "")
+	h.TempDir("elsewhere")
+	link := filepath.Join(h.Path("elsewhere"), "link")
+	if err := os.Symlink(h.Path(filepath.Join("go", "src", "real", "path")), link); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &Ctx{
+		Out: discardLogger(),
+		Err: discardLogger(),
+	}
+	if err := ctx.SetPaths(link, h.Path("go")); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	p, err := ctx.LoadProject()
+	if err != nil {
+		t.Fatalf("LoadProject failed: %+v", err)
+	}
+	if p.ImportRoot != "real/path" {
+		t.Errorf("expected import root to come from the resolved root, got %q", p.ImportRoot)
+	}
+	if len(p.ImportAliases) != 0 {
+		t.Errorf("expected no import aliases, got %v", p.ImportAliases)
+	}
+}
+
 func TestLoadProjectNotFoundErrors(t *testing.T) {
 	tg := test.NewHelper(t)
 	defer tg.Cleanup()
@@ -0,0 +1,59 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "strings"
+
+// AnalyzerChain is a ProjectAnalyzer that consults several ProjectAnalyzers in
+// priority order, so that projects whose dependencies are declared in
+// different formats - such as those of other dependency management tools - can
+// all feed the solver.
+//
+// The analyzers are tried in the order in which they were given, and the first
+// to derive a Manifest or a Lock for a project is the one whose results are
+// used; the rest are not consulted. If an analyzer fails, analysis fails with
+// its error, rather than falling through to the next, as the failing analyzer
+// recognized the project's files, but found them to be malformed. If no
+// analyzer derives anything, the project has neither a Manifest nor a Lock.
+type AnalyzerChain struct {
+	analyzers []ProjectAnalyzer
+}
+
+// NewAnalyzerChain returns an AnalyzerChain that tries each of the provided
+// analyzers in turn, highest priority first.
+func NewAnalyzerChain(analyzers ...ProjectAnalyzer) *AnalyzerChain {
+	return &AnalyzerChain{
+		analyzers: append([]ProjectAnalyzer(nil), analyzers...),
+	}
+}
+
+// DeriveManifestAndLock returns the Manifest and Lock derived by the first
+// analyzer in the chain to derive either for the project at path.
+func (c *AnalyzerChain) DeriveManifestAndLock(path string, importRoot ProjectRoot) (Manifest, Lock, error) {
+	for _, a := range c.analyzers {
+		m, l, err := a.DeriveManifestAndLock(path, importRoot)
+		if err != nil {
+			return nil, nil, err
+		}
+		if m != nil || l != nil {
+			return m, l, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// Info reports the chain's info. Its name is made up of the name and version
+// of each analyzer in the chain, in order, so that results cached for one
+// chain are never reused for another that might analyze projects differently.
+func (c *AnalyzerChain) Info() ProjectAnalyzerInfo {
+	names := make([]string, len(c.analyzers))
+	for i, a := range c.analyzers {
+		names[i] = a.Info().String()
+	}
+	return ProjectAnalyzerInfo{
+		Name:    "chain(" + strings.Join(names, ",") + ")",
+		Version: 1,
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// fileAnalyzer derives a manifest for projects containing its file, and fails
+// to analyze those in which the file is empty.
+type fileAnalyzer struct {
+	file string
+	m    Manifest
+}
+
+func (a fileAnalyzer) DeriveManifestAndLock(path string, _ ProjectRoot) (Manifest, Lock, error) {
+	fi, err := os.Stat(filepath.Join(path, a.file))
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi.Size() == 0 {
+		return nil, nil, errors.Errorf("%s is empty", a.file)
+	}
+	return a.m, nil, nil
+}
+
+func (a fileAnalyzer) Info() ProjectAnalyzerInfo {
+	return ProjectAnalyzerInfo{Name: a.file, Version: 2}
+}
+
+func TestAnalyzerChain(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "gps-analyzer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dep := &SimpleManifest{Deps: ProjectConstraints{"dep": {Constraint: Any()}}}
+	glide := &SimpleManifest{Deps: ProjectConstraints{"glide": {Constraint: Any()}}}
+	chain := NewAnalyzerChain(fileAnalyzer{file: "Gopkg.toml", m: dep}, fileAnalyzer{file: "glide.yaml", m: glide})
+
+	if got, want := chain.Info().String(), "chain(Gopkg.toml.2,glide.yaml.2).1"; got != want {
+		t.Errorf("expected the chain's info to be %q, got %q", want, got)
+	}
+
+	cases := []struct {
+		name  string
+		files map[string]string
+		want  Manifest
+		err   bool
+	}{
+		{name: "none"},
+		{name: "glide", files: map[string]string{"glide.yaml": "x"}, want: glide},
+		{name: "both", files: map[string]string{"Gopkg.toml": "x", "glide.yaml": "x"}, want: dep},
+		// A malformed file fails the analysis, rather than falling through.
+		{name: "malformed", files: map[string]string{"Gopkg.toml": "", "glide.yaml": "x"}, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := filepath.Join(tmp, c.name)
+			if err := os.Mkdir(dir, 0777); err != nil {
+				t.Fatal(err)
+			}
+			for f, body := range c.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(body), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			m, l, err := chain.DeriveManifestAndLock(dir, "root")
+			if (err != nil) != c.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if m != c.want || l != nil {
+				t.Errorf("expected manifest %v from the chain, got %v", c.want, m)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// binarySniffLen is the number of leading bytes of a file that are examined to
+// decide whether it is binary. It is the same heuristic git uses.
+const binarySniffLen = 8000
+
+// ArtifactPolicy describes which files in a dependency's tree should be
+// flagged as artifacts - committed binaries and unusually large files - and
+// what should be done with them.
+//
+// The zero value flags nothing.
+type ArtifactPolicy struct {
+	// Binaries indicates that files with binary content should be flagged.
+	Binaries bool
+	// SizeThreshold is the size, in bytes, at or above which a file is
+	// flagged as large. If it is not positive, file sizes are not checked.
+	SizeThreshold int64
+	// Exclude indicates that flagged files should be removed from exported
+	// trees. It is honored by SourceManagers, and ignored by the solver.
+	Exclude bool
+}
+
+func (p ArtifactPolicy) enabled() bool {
+	return p.Binaries || p.SizeThreshold > 0
+}
+
+// Artifact describes a file flagged under an ArtifactPolicy.
+type Artifact struct {
+	// Path is the slash-separated path to the file, relative to the root of
+	// the tree in which it was found.
+	Path string
+	// Size is the size of the file, in bytes.
+	Size int64
+	// Binary indicates that the file has binary content.
+	Binary bool
+	// Large indicates that the file's size is at or above the threshold.
+	Large bool
+}
+
+// FindArtifacts walks the tree beneath root and returns all the files flagged
+// by the provided policy, sorted by path. VCS metadata directories and
+// symlinks are skipped.
+func FindArtifacts(root string, p ArtifactPolicy) ([]Artifact, error) {
+	if !p.enabled() {
+		return nil, nil
+	}
+
+	var arts []Artifact
+	buf := make([]byte, binarySniffLen)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			switch info.Name() {
+			case ".bzr", ".git", ".hg", ".svn":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		a := Artifact{
+			Size:  info.Size(),
+			Large: p.SizeThreshold > 0 && info.Size() >= p.SizeThreshold,
+		}
+		if p.Binaries {
+			if a.Binary, err = isBinaryFile(path, buf); err != nil {
+				return err
+			}
+		}
+
+		if a.Binary || a.Large {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			a.Path = filepath.ToSlash(rel)
+			arts = append(arts, a)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to scan %s for artifacts", root)
+	}
+
+	sort.Slice(arts, func(i, j int) bool { return arts[i].Path < arts[j].Path })
+	return arts, nil
+}
+
+// isBinaryFile reports whether the file at path appears to be binary, which is
+// taken to be the case if there is a NUL byte among its leading bytes.
+func isBinaryFile(path string, buf []byte) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return bytes.IndexByte(buf[:n], 0) != -1, nil
+}
+
+// excludeArtifacts removes all files flagged by the policy from the tree
+// beneath root, if the policy calls for their exclusion.
+func excludeArtifacts(root string, p ArtifactPolicy) error {
+	if !p.Exclude {
+		return nil
+	}
+
+	arts, err := FindArtifacts(root, p)
+	if err != nil {
+		return err
+	}
+	for _, a := range arts {
+		if err := os.Remove(filepath.Join(root, filepath.FromSlash(a.Path))); err != nil {
+			return errors.Wrapf(err, "failed to exclude artifact %s", a.Path)
+		}
+	}
+	return nil
+}
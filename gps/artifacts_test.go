@@ -0,0 +1,75 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestFindArtifacts(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile("root/main.go", "package main")
+	h.TempFile("root/bin/tool", "\x7fELF\x00\x01")
+	h.TempFile("root/testdata/huge.json", strings.Repeat("x", 2048))
+	h.TempFile("root/.git/objects/pack", "\x00\x00")
+
+	cases := []struct {
+		name string
+		p    ArtifactPolicy
+		want []Artifact
+	}{
+		{"zero policy", ArtifactPolicy{}, nil},
+		{"binaries", ArtifactPolicy{Binaries: true}, []Artifact{
+			{Path: "bin/tool", Size: 6, Binary: true},
+		}},
+		{"large", ArtifactPolicy{SizeThreshold: 1024}, []Artifact{
+			{Path: "testdata/huge.json", Size: 2048, Large: true},
+		}},
+		{"both", ArtifactPolicy{Binaries: true, SizeThreshold: 1024}, []Artifact{
+			{Path: "bin/tool", Size: 6, Binary: true},
+			{Path: "testdata/huge.json", Size: 2048, Large: true},
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := FindArtifacts(h.Path("root"), c.p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("unexpected artifacts:\n\t(GOT): %v\n\t(WNT): %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestExcludeArtifacts(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile("root/main.go", "package main")
+	h.TempFile("root/bin/tool", "\x7fELF\x00\x01")
+
+	p := ArtifactPolicy{Binaries: true}
+	if err := excludeArtifacts(h.Path("root"), p); err != nil {
+		t.Fatal(err)
+	}
+	h.MustExist(filepath.Join(h.Path("root"), "bin", "tool"))
+
+	p.Exclude = true
+	if err := excludeArtifacts(h.Path("root"), p); err != nil {
+		t.Fatal(err)
+	}
+	h.MustNotExist(filepath.Join(h.Path("root"), "bin", "tool"))
+	h.MustExist(h.Path("root/main.go"))
+}
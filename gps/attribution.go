@@ -0,0 +1,155 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// PackageAttribution explains why a package from a selected project is part
+// of a Solution.
+type PackageAttribution struct {
+	// Direct indicates that the package is imported by the root project's own
+	// packages, or is required by its manifest.
+	Direct bool
+
+	// TestOnly indicates that the package is only needed by the root project's
+	// tests: none of the packages reached from its non-test code import it.
+	// The tests of dependencies are never considered.
+	TestOnly bool
+
+	// ImportedBy lists the packages that import the package, including those
+	// of the root project and those of the package's own project.
+	ImportedBy []string
+}
+
+// attributePackages traces the imports from the root project through the
+// selected projects, to attribute each of their packages to what imports it.
+func (s *solver) attributePackages(lps []LockedProject) (map[ProjectRoot]map[string]PackageAttribution, error) {
+	type attribution struct {
+		direct, test bool
+		by           map[string]bool
+	}
+	attrs := make(map[string]*attribution)
+	ptrees := make(map[ProjectRoot]pkgtree.PackageTree)
+
+	// owner returns the selected project that holds the package, if any.
+	owner := func(pkg string) (LockedProject, bool) {
+		var best LockedProject
+		for _, lp := range lps {
+			pr := string(lp.Ident().ProjectRoot)
+			if pkg != pr && !strings.HasPrefix(pkg, pr+"/") {
+				continue
+			}
+			if best == nil || len(pr) > len(best.Ident().ProjectRoot) {
+				best = lp
+			}
+		}
+		return best, best != nil
+	}
+
+	// visit records the import of pkg by importer, which is empty for a
+	// required package, and returns whether pkg's own imports remain to be
+	// followed. Packages not in any selected project, such as the root's own,
+	// are not recorded.
+	visit := func(pkg, importer string, test bool) bool {
+		if s.stdLibFn(pkg) || s.rd.ir.IsIgnored(pkg) {
+			return false
+		}
+		if _, has := owner(pkg); !has {
+			return false
+		}
+
+		a, seen := attrs[pkg]
+		if !seen {
+			a = &attribution{test: test, by: make(map[string]bool)}
+			attrs[pkg] = a
+		}
+		if _, fromRoot := s.rd.rpt.Packages[importer]; fromRoot || importer == "" {
+			a.direct = true
+		}
+		if importer != "" {
+			a.by[importer] = true
+		}
+		return !seen
+	}
+
+	// Everything reached from the root's non-test code is traced first, so
+	// that whatever the tests then reach that has not already been seen is
+	// only needed by them.
+	var queue []string
+	for _, test := range []bool{false, true} {
+		for pkg := range s.rd.req {
+			if !test && visit(pkg, "", false) {
+				queue = append(queue, pkg)
+			}
+		}
+		for path, perr := range s.rd.rpt.Packages {
+			if perr.Err != nil || s.rd.ir.IsIgnored(path) {
+				continue
+			}
+			imports := perr.P.Imports
+			if test {
+				imports = perr.P.TestImports
+			}
+			for _, pkg := range imports {
+				if visit(pkg, path, test) {
+					queue = append(queue, pkg)
+				}
+			}
+		}
+
+		for len(queue) > 0 {
+			pkg := queue[0]
+			queue = queue[1:]
+
+			lp, _ := owner(pkg)
+			pr := lp.Ident().ProjectRoot
+			ptree, has := ptrees[pr]
+			if !has {
+				var err error
+				ptree, err = s.b.ListPackages(lp.Ident(), lp.Version())
+				if err != nil {
+					return nil, err
+				}
+				ptrees[pr] = ptree
+			}
+
+			perr, has := ptree.Packages[pkg]
+			if !has || perr.Err != nil {
+				continue
+			}
+			for _, imp := range perr.P.Imports {
+				if visit(imp, pkg, attrs[pkg].test) {
+					queue = append(queue, imp)
+				}
+			}
+		}
+	}
+
+	m := make(map[ProjectRoot]map[string]PackageAttribution)
+	for pkg, a := range attrs {
+		lp, _ := owner(pkg)
+		pr := lp.Ident().ProjectRoot
+		if m[pr] == nil {
+			m[pr] = make(map[string]PackageAttribution)
+		}
+
+		by := make([]string, 0, len(a.by))
+		for imp := range a.by {
+			by = append(by, imp)
+		}
+		sort.Strings(by)
+		m[pr][pkg] = PackageAttribution{
+			Direct:     a.direct,
+			TestOnly:   a.test,
+			ImportedBy: by,
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPackageAttributions(t *testing.T) {
+	fix := bimodalFixture{
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "root/foo"),
+				pkg("root/foo", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0"),
+				pkg("a", "a/internal"),
+				pkg("a/internal", "b/util"),
+				pkg("a/unused", "c"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+				pkg("b/util"),
+			),
+			dsp(mkDepspec("c 1.0.0"),
+				pkg("c", "b/util"),
+			),
+		},
+	}
+
+	// The root's tests also import c, and a, which its code already imports.
+	ptree := fix.rootTree()
+	rp := ptree.Packages["root"]
+	rp.P.TestImports = []string{"a", "c"}
+	ptree.Packages["root"] = rp
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: ptree,
+		Manifest:        fix.rootmanifest(),
+		Lock:            dummyLock{},
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	soln, err := fixSolve(params, newbmSM(fix), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[ProjectRoot]map[string]PackageAttribution{
+		"a": {
+			"a":          {Direct: true, ImportedBy: []string{"root", "root/foo"}},
+			"a/internal": {ImportedBy: []string{"a"}},
+		},
+		"b": {
+			"b/util": {ImportedBy: []string{"a/internal", "c"}},
+		},
+		"c": {
+			"c": {Direct: true, TestOnly: true, ImportedBy: []string{"root"}},
+		},
+	}
+	if got := soln.PackageAttributions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected package attributions:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// redacted replaces credentials in URLs recorded in the network audit log.
+const redacted = "redacted"
+
+// NetworkAuditEntry records a single operation during which a SourceMgr
+// contacted, or may have contacted, a network destination.
+type NetworkAuditEntry struct {
+	// Host is the host, and port if one was given, of the destination.
+	Host string
+	// URL is the destination, with any credentials redacted.
+	URL string
+	// Operation describes what was done, such as fetching go-get metadata or
+	// initializing a local source cache.
+	Operation string
+	// Bytes is the size of the response body for HTTP requests. It is zero
+	// for operations carried out by VCS tools, whose transfers are not
+	// observable.
+	Bytes int64
+	// Start is the time at which the operation began, and Duration how long
+	// it took.
+	Start    time.Time
+	Duration time.Duration
+	// Failed indicates that the operation returned an error. Errors are not
+	// recorded, as they may contain credentials.
+	Failed bool
+}
+
+// networkAudit is a concurrency-safe log of network operations. A SourceMgr has
+// one in its sourceSettings when auditing is enabled.
+type networkAudit struct {
+	mu      sync.Mutex
+	entries []NetworkAuditEntry
+}
+
+func (na *networkAudit) record(e NetworkAuditEntry) {
+	na.mu.Lock()
+	na.entries = append(na.entries, e)
+	na.mu.Unlock()
+}
+
+func (na *networkAudit) list() []NetworkAuditEntry {
+	na.mu.Lock()
+	defer na.mu.Unlock()
+	return append([]NetworkAuditEntry(nil), na.entries...)
+}
+
+// newAuditEntry creates an entry for an operation of the given type against
+// dest, starting now.
+func newAuditEntry(dest string, typ callType) NetworkAuditEntry {
+	e := NetworkAuditEntry{
+		URL:       redactURL(dest),
+		Operation: typ.String(),
+		Start:     time.Now(),
+	}
+	if u, err := url.Parse(dest); err == nil {
+		e.Host = u.Host
+	}
+	return e
+}
+
+// auditNetwork wraps f so that each invocation is recorded in the network
+// audit log na, if it is not nil, as an operation of the given type against
+// dest.
+func auditNetwork(na *networkAudit, dest string, typ callType, f func(context.Context) error) func(context.Context) error {
+	if na == nil {
+		return f
+	}
+	return func(ctx context.Context) error {
+		e := newAuditEntry(dest, typ)
+		err := f(ctx)
+		e.Duration = time.Since(e.Start)
+		e.Failed = err != nil
+		na.record(e)
+		return err
+	}
+}
+
+// auditedBody counts the bytes read from an HTTP response body, and records
+// its audit entry when it is closed.
+type auditedBody struct {
+	io.ReadCloser
+	na     *networkAudit
+	e      NetworkAuditEntry
+	closed bool
+}
+
+func (b *auditedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.e.Bytes += int64(n)
+	if err != nil && err != io.EOF {
+		b.e.Failed = true
+	}
+	return n, err
+}
+
+func (b *auditedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if !b.closed {
+		b.closed = true
+		b.e.Duration = time.Since(b.e.Start)
+		b.na.record(b.e)
+	}
+	return err
+}
+
+// redactURL returns the URL with any user information, and the values of any
+// query parameters, replaced. Strings that cannot be parsed as URLs are
+// replaced entirely, as there is no telling where credentials may lurk.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return redacted
+	}
+
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k, vs := range q {
+			// go-get=1 is added by dep itself, and is known to be harmless.
+			if k == "go-get" {
+				continue
+			}
+			for i := range vs {
+				vs[i] = redacted
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
@@ -5,12 +5,15 @@
 package gps
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"sync/atomic"
 
 	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pkg/errors"
 )
 
 // sourceBridge is an adapter to SourceManagers that tailor operations for a
@@ -25,10 +28,21 @@ type sourceBridge interface {
 	ExportProject(ProjectIdentifier, Version, string) error
 	DeduceProjectRoot(ip string) (ProjectRoot, error)
 
+	exportForScan(ProjectIdentifier, Version, string) error
+
+	repository(ProjectIdentifier) (string, bool)
 	listVersions(ProjectIdentifier) ([]Version, error)
+	deprecations(ProjectIdentifier) ([]Deprecation, error)
 	verifyRootDir(path string) error
 	vendorCodeExists(ProjectIdentifier) (bool, error)
 	breakLock()
+	prefetchVersions([]ProjectIdentifier)
+	setContext(context.Context)
+	prefetchLock(context.Context) *lockPrefetch
+	meterTransfers() *transferMeter
+	meterCache() *cacheMeter
+	substitutions() map[ProjectRoot]SourceSubstitution
+	listedVersions() VersionSnapshot
 }
 
 // bridge is an adapter around a proper SourceManager. It provides localized
@@ -41,6 +55,12 @@ type bridge struct {
 	// The underlying, adapted-to SourceManager
 	sm SourceManager
 
+	// The context of the current solve run, under which the SourceManager's
+	// operations are run if it is a ContextSourceManager. Guarded by ctxmut,
+	// as operations are also run from other goroutines.
+	ctxmut sync.RWMutex
+	ctx    context.Context
+
 	// The solver which we're assisting.
 	//
 	// The link between solver and bridge is circular, which is typically a bit
@@ -54,12 +74,31 @@ type bridge struct {
 	// current solve run.
 	vlists map[ProjectIdentifier][]Version
 
+	// Map of project root name to the deprecation notices for its versions,
+	// gathered from all available DeprecationProviders.
+	depr map[ProjectIdentifier][]Deprecation
+
 	// Indicates whether lock breaking has already been run
 	lockbroken int32
 
 	// Whether to sort version lists for downgrade.
 	down bool
 
+	// The identifiers through which projects are retrieved, for those with
+	// fallback sources, and the substitutions made among them. Guarded by
+	// substmut, as SyncSourceFor is called from other goroutines.
+	substmut sync.Mutex
+	subst    map[ProjectIdentifier]ProjectIdentifier
+	substs   map[ProjectRoot]SourceSubstitution
+
+	// The versions listed for each project so far, if they are being captured
+	// for the solution's VersionSnapshot.
+	listed VersionSnapshot
+
+	// The location of the repository that each project is retrieved from by
+	// default, or the empty string if it could not be deduced.
+	repos map[ProjectRoot]string
+
 	// The cancellation context provided to the solver. Threading it through the
 	// various solver methods is needlessly verbose so long as we maintain the
 	// lifetime guarantees that a solver can only be run once.
@@ -69,12 +108,20 @@ type bridge struct {
 
 // mkBridge creates a bridge
 func mkBridge(s *solver, sm SourceManager, down bool) *bridge {
-	return &bridge{
+	b := &bridge{
 		sm:     sm,
 		s:      s,
 		down:   down,
 		vlists: make(map[ProjectIdentifier][]Version),
+		depr:   make(map[ProjectIdentifier][]Deprecation),
+		subst:  make(map[ProjectIdentifier]ProjectIdentifier),
+		substs: make(map[ProjectRoot]SourceSubstitution),
+		repos:  make(map[ProjectRoot]string),
 	}
+	if s.capture {
+		b.listed = make(VersionSnapshot)
+	}
+	return b
 }
 
 func (b *bridge) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
@@ -82,8 +129,12 @@ func (b *bridge) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectA
 		return b.s.rd.rm, b.s.rd.rl, nil
 	}
 
-	b.s.mtr.push("b-gmal")
-	m, l, e := b.sm.GetManifestAndLock(id, v, an)
+	b.s.mtr.prefetch.claim(id.ProjectRoot)
+	b.s.mtr.pushSource("b-gmal", id)
+	id = b.sourceFor(id)
+	b.s.mtr.watch(id)
+	m, l, e := b.ops().GetManifestAndLock(id, v, an)
+	b.chargeFetch(id)
 	b.s.mtr.pop()
 	return m, l, e
 }
@@ -93,8 +144,8 @@ func (b *bridge) listVersions(id ProjectIdentifier) ([]Version, error) {
 		return vl, nil
 	}
 
-	b.s.mtr.push("b-list-versions")
-	pvl, err := b.sm.ListVersions(id)
+	b.s.mtr.pushSource("b-list-versions", id)
+	pvl, err := b.listPairedVersions(id)
 	if err != nil {
 		b.s.mtr.pop()
 		return nil, err
@@ -106,27 +157,149 @@ func (b *bridge) listVersions(id ProjectIdentifier) ([]Version, error) {
 	} else {
 		SortForUpgrade(vl)
 	}
+	b.orderByRecency(id, vl)
+
+	if ch, ok := b.s.rd.channelFor(id.ProjectRoot); ok {
+		sortForChannel(vl, ch, b.down)
+	}
+
+	if b.s.scorer != nil {
+		scores, err := b.s.scorer.ScoreVersions(id, append([]Version(nil), vl...))
+		if err != nil {
+			b.s.mtr.pop()
+			return nil, err
+		}
+		preferHigherScores(vl, scores)
+	}
+
+	if b.s.selector != nil {
+		if vl, err = selectVersions(b.s.selector, id, vl); err != nil {
+			b.s.mtr.pop()
+			return nil, err
+		}
+	}
+
+	ds, err := b.deprecations(id)
+	if err != nil {
+		b.s.mtr.pop()
+		return nil, err
+	}
+	preferNonDeprecated(vl, ds)
 
 	b.vlists[id] = vl
 	b.s.mtr.pop()
 	return vl, nil
 }
 
+// listPairedVersions retrieves the versions of the project from the
+// SourceManager, restricted to those that existed at the solver's AsOf time, if
+// it has one.
+//
+// If the project's source could not be reached, the solve is aborted; carrying
+// on would only lead to misleading reports that no version was acceptable.
+//
+// If a fallback source has been substituted for the project's own, only the
+// versions at the revision for which it was vetted are listed. If the solver
+// was given a VersionSnapshot that covers the project, its versions are taken
+// from that instead, without consulting the SourceManager at all.
+func (b *bridge) listPairedVersions(id ProjectIdentifier) (pvl []PairedVersion, err error) {
+	defer func() {
+		if b.listed != nil && err == nil {
+			b.listed[id] = pvl
+		}
+	}()
+	if spvl, has := b.s.vsnap[id]; has {
+		return append([]PairedVersion(nil), spvl...), nil
+	}
+
+	b.s.mtr.prefetch.claim(id.ProjectRoot)
+	sid := b.sourceFor(id)
+	b.s.mtr.watch(sid)
+	b.s.events.notify(SourceSyncStarted{Ident: sid})
+	if b.s.asOf.IsZero() {
+		pvl, err = b.ops().ListVersions(sid)
+	} else {
+		pvl, err = b.listVersionsAsOf(sid)
+	}
+	b.s.events.notify(SourceSyncFinished{Ident: sid, Err: err})
+	b.chargeFetch(sid)
+
+	if ue, ok := errors.Cause(err).(*SourceUnreachableError); ok {
+		b.s.abort(ue)
+	}
+	if sid != id && err == nil {
+		pvl = onlyRevision(pvl, lockedRevision(b.s.rd.rlm[id.ProjectRoot]))
+	}
+	return pvl, err
+}
+
+// deprecations returns the deprecation notices for the project from the
+// SourceManager, if it is a DeprecationProvider, followed by those from the
+// provider in the SolveParameters, if any.
+//
+// Notices from the SourceManager are incidental to listing the project's
+// versions, so if they cannot be read, the project is treated as having none.
+func (b *bridge) deprecations(id ProjectIdentifier) ([]Deprecation, error) {
+	if ds, exists := b.depr[id]; exists {
+		return ds, nil
+	}
+
+	ds, err := b.sourceDeprecations(id)
+	if err != nil {
+		ds = nil
+	}
+	if b.s.deprp != nil {
+		pds, err := b.s.deprp.Deprecations(id)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, pds...)
+	}
+
+	b.depr[id] = ds
+	return ds, nil
+}
+
+// sourceDeprecations returns the SourceManager's deprecation notices for the
+// project's source, looked up under the context of the current solve run if
+// the SourceManager supports it.
+func (b *bridge) sourceDeprecations(id ProjectIdentifier) ([]Deprecation, error) {
+	id = b.sourceFor(id)
+	switch dp := b.sm.(type) {
+	case ContextDeprecationProvider:
+		return dp.DeprecationsContext(b.solveContext(), id)
+	case DeprecationProvider:
+		return dp.Deprecations(id)
+	}
+	return nil, nil
+}
+
 func (b *bridge) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
-	b.s.mtr.push("b-rev-present-in")
-	i, e := b.sm.RevisionPresentIn(id, r)
+	b.s.mtr.pushSource("b-rev-present-in", id)
+	id = b.sourceFor(id)
+	b.s.mtr.watch(id)
+	i, e := b.ops().RevisionPresentIn(id, r)
+	b.chargeFetch(id)
 	b.s.mtr.pop()
 	return i, e
 }
 
 func (b *bridge) SourceExists(id ProjectIdentifier) (bool, error) {
-	b.s.mtr.push("b-source-exists")
-	i, e := b.sm.SourceExists(id)
+	b.s.mtr.pushSource("b-source-exists", id)
+	id = b.sourceFor(id)
+	b.s.mtr.watch(id)
+	i, e := b.ops().SourceExists(id)
+	b.chargeFetch(id)
 	b.s.mtr.pop()
 	return i, e
 }
 
 func (b *bridge) vendorCodeExists(id ProjectIdentifier) (bool, error) {
+	// A tools solve may have no root directory, and so no vendor directory.
+	if b.s.rd.dir == "" {
+		return false, nil
+	}
+
 	fi, err := os.Stat(filepath.Join(b.s.rd.dir, "vendor", string(id.ProjectRoot)))
 	if err != nil {
 		return false, err
@@ -147,14 +320,44 @@ func (b *bridge) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageT
 		return b.s.rd.rpt, nil
 	}
 
-	b.s.mtr.push("b-list-pkgs")
-	pt, err := b.sm.ListPackages(id, v)
+	b.s.mtr.prefetch.claim(id.ProjectRoot)
+	b.s.mtr.pushSource("b-list-pkgs", id)
+	id = b.sourceFor(id)
+	b.s.mtr.watch(id)
+	pt, err := b.ops().ListPackages(id, v)
+	b.chargeFetch(id)
 	b.s.mtr.pop()
-	return pt, err
+	if err != nil {
+		return pt, err
+	}
+	return pt.ForContexts(b.s.ctxs), nil
 }
 
 func (b *bridge) ExportProject(id ProjectIdentifier, v Version, path string) error {
-	panic("bridge should never be used to ExportProject")
+	b.s.mtr.pushSource("b-export", id)
+	err := b.sm.ExportProject(b.solveContext(), b.sourceFor(id), v, path)
+	b.s.mtr.pop()
+	return err
+}
+
+// exportForScan exports the project for scanning for artifacts. If the
+// SourceManager excludes artifacts from the trees it exports, they are left in
+// place, so that the scan finds them.
+func (b *bridge) exportForScan(id ProjectIdentifier, v Version, path string) error {
+	ue, ok := b.sm.(unexcludedExporter)
+	if !ok {
+		return b.ExportProject(id, v, path)
+	}
+	b.s.mtr.pushSource("b-export", id)
+	err := ue.exportUnexcluded(b.solveContext(), b.sourceFor(id), v, path)
+	b.s.mtr.pop()
+	return err
+}
+
+// unexcludedExporter is implemented by SourceManagers, such as SourceMgr, that
+// can export trees without excluding artifacts from them.
+type unexcludedExporter interface {
+	exportUnexcluded(context.Context, ProjectIdentifier, Version, string) error
 }
 
 // verifyRoot ensures that the provided path to the project root is in good
@@ -172,7 +375,7 @@ func (b *bridge) verifyRootDir(path string) error {
 
 func (b *bridge) DeduceProjectRoot(ip string) (ProjectRoot, error) {
 	b.s.mtr.push("b-deduce-proj-root")
-	pr, e := b.sm.DeduceProjectRoot(ip)
+	pr, e := b.ops().DeduceProjectRoot(ip)
 	b.s.mtr.pop()
 	return pr, e
 }
@@ -183,6 +386,7 @@ func (b *bridge) DeduceProjectRoot(ip string) (ProjectRoot, error) {
 //
 // Projects that have already been selected are skipped, as it's generally unlikely that the
 // solver will have to backtrack through and fully populate their version queues.
+// Nothing is prefetched in a deterministic solve.
 func (b *bridge) breakLock() {
 	// No real conceivable circumstance in which multiple calls are made to
 	// this, but being that this is the entrance point to a bunch of async work,
@@ -190,7 +394,7 @@ func (b *bridge) breakLock() {
 	//
 	// We avoid using a sync.Once here, as there's no reason for other callers
 	// to block until completion.
-	if !atomic.CompareAndSwapInt32(&b.lockbroken, 0, 1) {
+	if b.s.determ || !atomic.CompareAndSwapInt32(&b.lockbroken, 0, 1) {
 		return
 	}
 
@@ -199,10 +403,10 @@ func (b *bridge) breakLock() {
 			pi, v := lp.Ident(), lp.Version()
 			go func() {
 				// Sync first
-				b.sm.SyncSourceFor(pi)
+				b.ops().SyncSourceFor(pi)
 				// Preload the package info for the locked version, too, as
 				// we're more likely to need that
-				b.sm.ListPackages(pi, v)
+				b.ops().ListPackages(pi, v)
 			}()
 		}
 	}
@@ -210,6 +414,170 @@ func (b *bridge) breakLock() {
 
 func (b *bridge) SyncSourceFor(id ProjectIdentifier) error {
 	// we don't track metrics here b/c this is often called in its own goroutine
-	// by the solver, and the metrics design is for wall time on a single thread
-	return b.sm.SyncSourceFor(id)
+	// by the solver, and the metrics design is for wall time on a single thread.
+	// The bytes it fetches are counted, though; they are charged against the
+	// fetch budget the next time the solver itself asks for the project. Nor
+	// is it reported to the SolveListener, as it may still be running after the
+	// solve has returned.
+	id = b.sourceFor(id)
+	b.s.mtr.watch(id)
+	err := b.ops().SyncSourceFor(id)
+	b.s.mtr.xfer.update(id)
+	return err
+}
+
+// prefetchVersions asks the SourceManager to list the versions of the provided
+// projects in the background, if it can, unless they will be taken from a
+// version snapshot, or have been listed already, or the solve is deterministic.
+func (b *bridge) prefetchVersions(ids []ProjectIdentifier) {
+	vp, ok := b.sm.(VersionPrefetcher)
+	if !ok || !b.s.asOf.IsZero() || b.s.determ {
+		return
+	}
+
+	var fetch []ProjectIdentifier
+	for _, id := range ids {
+		if _, has := b.s.vsnap[id]; has {
+			continue
+		}
+		if _, has := b.vlists[id]; has {
+			continue
+		}
+		// Which source a project with fallbacks is retrieved from may take
+		// network activity to establish, so leave that until it is needed.
+		if len(b.s.fallbacks[id.ProjectRoot]) > 0 {
+			continue
+		}
+		fetch = append(fetch, id)
+	}
+	if len(fetch) > 0 {
+		vp.PrefetchVersions(fetch)
+	}
+}
+
+// setContext sets the context of the current solve run.
+func (b *bridge) setContext(ctx context.Context) {
+	b.ctxmut.Lock()
+	b.ctx = ctx
+	b.ctxmut.Unlock()
+}
+
+// solveContext returns the context of the current solve run.
+func (b *bridge) solveContext() context.Context {
+	b.ctxmut.RLock()
+	defer b.ctxmut.RUnlock()
+	if b.ctx == nil {
+		return context.TODO()
+	}
+	return b.ctx
+}
+
+// ops returns the SourceManager's operations, run under the context of the
+// current solve run.
+func (b *bridge) ops() sourceOps {
+	return b.opsUnder(b.solveContext())
+}
+
+// opsUnder returns the SourceManager's operations, run under ctx if the
+// SourceManager supports it.
+func (b *bridge) opsUnder(ctx context.Context) sourceOps {
+	if csm, ok := b.sm.(ContextSourceManager); ok {
+		return contextOps{csm: csm, ctx: ctx}
+	}
+	return b.sm
+}
+
+// sourceOps are the SourceManager operations that the bridge runs on behalf
+// of the solver.
+type sourceOps interface {
+	SourceExists(ProjectIdentifier) (bool, error)
+	SyncSourceFor(ProjectIdentifier) error
+	ListVersions(ProjectIdentifier) ([]PairedVersion, error)
+	RevisionPresentIn(ProjectIdentifier, Revision) (bool, error)
+	ListPackages(ProjectIdentifier, Version) (pkgtree.PackageTree, error)
+	GetManifestAndLock(ProjectIdentifier, Version, ProjectAnalyzer) (Manifest, Lock, error)
+	DeduceProjectRoot(ip string) (ProjectRoot, error)
+}
+
+// contextOps runs a ContextSourceManager's operations under a context.
+type contextOps struct {
+	csm ContextSourceManager
+	ctx context.Context
+}
+
+func (o contextOps) SourceExists(id ProjectIdentifier) (bool, error) {
+	return o.csm.SourceExistsContext(o.ctx, id)
+}
+
+func (o contextOps) SyncSourceFor(id ProjectIdentifier) error {
+	return o.csm.SyncSourceForContext(o.ctx, id)
+}
+
+func (o contextOps) ListVersions(id ProjectIdentifier) ([]PairedVersion, error) {
+	return o.csm.ListVersionsContext(o.ctx, id)
+}
+
+func (o contextOps) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
+	return o.csm.RevisionPresentInContext(o.ctx, id, r)
+}
+
+func (o contextOps) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
+	return o.csm.ListPackagesContext(o.ctx, id, v)
+}
+
+func (o contextOps) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
+	return o.csm.GetManifestAndLockContext(o.ctx, id, v, an)
+}
+
+func (o contextOps) DeduceProjectRoot(ip string) (ProjectRoot, error) {
+	return o.csm.DeduceProjectRootContext(o.ctx, ip)
+}
+
+// listedVersions returns the versions listed for each project so far in the
+// solve, or nil if they are not being captured.
+func (b *bridge) listedVersions() VersionSnapshot {
+	return b.listed
+}
+
+// meterTransfers sets up accounting for the bytes fetched during the solve, if
+// the SourceManager can count them. The projects in the root lock are watched
+// immediately, as they may be prefetched before the solver asks for them.
+func (b *bridge) meterTransfers() *transferMeter {
+	tc, ok := b.sm.(TransferCounter)
+	if !ok {
+		return nil
+	}
+
+	tm := newTransferMeter(tc, b.s.fetchBudget)
+	for _, lp := range b.s.rd.rl.Projects() {
+		tm.watch(lp.Ident())
+	}
+	return tm
+}
+
+// meterCache sets up accounting for the lookups in the SourceManager's caches
+// during the solve, if it counts them. The projects in the root lock are
+// watched immediately, as they may be prefetched before the solver asks for
+// them.
+func (b *bridge) meterCache() *cacheMeter {
+	cc, ok := b.sm.(CacheCounter)
+	if !ok {
+		return nil
+	}
+
+	cm := newCacheMeter(cc)
+	for _, lp := range b.s.rd.rl.Projects() {
+		cm.watch(lp.Ident())
+	}
+	return cm
+}
+
+// chargeFetch brings the count of bytes fetched for the project up to date,
+// and aborts the solve if they have taken it over its fetch budget. It must
+// only be called from the solver's own goroutine.
+func (b *bridge) chargeFetch(id ProjectIdentifier) {
+	b.s.mtr.xfer.update(id)
+	if err := b.s.mtr.xfer.exceeded(); err != nil {
+		b.s.abort(err)
+	}
 }
@@ -0,0 +1,188 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CacheGCOptions determines which source repositories CollectGarbage evicts
+// from a SourceMgr's cache directory. Repositories are evicted if they meet
+// either condition; with neither set, nothing is.
+type CacheGCOptions struct {
+	// UnusedSince, if not zero, evicts the repositories that have not been
+	// used by a SourceMgr since then.
+	UnusedSince time.Time
+	// MaxBytes, if positive, is the budget for the total size of the
+	// repositories in the cache. The least recently used are evicted until
+	// those left fit within it.
+	MaxBytes int64
+	// DryRun reports what would be evicted, without removing anything.
+	DryRun bool
+}
+
+// CacheGCResult reports what CollectGarbage evicted.
+type CacheGCResult struct {
+	// Evicted holds the paths of the repositories that were evicted, least
+	// recently used first.
+	Evicted []string
+	// Reclaimed is the number of bytes the evicted repositories occupied.
+	Reclaimed int64
+	// Remaining is the number of bytes the repositories left occupy.
+	Remaining int64
+}
+
+// cachedRepo is a source repository in a cache directory.
+type cachedRepo struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// CollectGarbage evicts the source repositories in the cache directory that
+// are unused since the time, or beyond the size budget, that the options give.
+// Evicted repositories are cloned again if they are needed later; the metadata
+// cached about their sources is kept.
+//
+// The repositories of the sources the SourceMgr has already set up are never
+// evicted, as they may be in use by a solve that is in progress, and no new
+// sources are set up until collection is done. Unless the cache directory is
+// shared, the SourceMgr holds the lock on it, so no other process is using the
+// rest; otherwise, the repositories that other processes have locked are left
+// alone.
+func (sm *SourceMgr) CollectGarbage(opts CacheGCOptions) (CacheGCResult, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return CacheGCResult{}, ErrSourceManagerIsReleased
+	}
+
+	sc := sm.srcCoord
+	sc.srcmut.Lock()
+	defer sc.srcmut.Unlock()
+
+	inUse := make(map[string]bool, len(sc.srcs))
+	for _, sg := range sc.srcs {
+		if ls, ok := sg.src.(localSource); ok {
+			inUse[filepath.Clean(ls.localPath())] = true
+		}
+	}
+
+	repos, err := cachedRepos(cacheDir{root: sc.cachedir, layout: sc.layout})
+	if err != nil {
+		return CacheGCResult{}, err
+	}
+
+	var res CacheGCResult
+	for _, r := range planCacheGC(repos, inUse, opts) {
+		var rl *fileLock
+		if sc.locksDir != "" {
+			rl = newFileLock(repoLockPath(sc.locksDir, r.path), staleLockAge)
+			if rl.TryLock() != nil {
+				continue
+			}
+		}
+		var err error
+		if !opts.DryRun {
+			err = os.RemoveAll(r.path)
+		}
+		if rl != nil {
+			rl.Unlock()
+		}
+		if err != nil {
+			return res, errors.Wrapf(err, "failed to evict %s", r.path)
+		}
+		res.Evicted = append(res.Evicted, r.path)
+		res.Reclaimed += r.size
+	}
+	for _, r := range repos {
+		res.Remaining += r.size
+	}
+	res.Remaining -= res.Reclaimed
+	return res, nil
+}
+
+// planCacheGC returns the repositories, none of whose paths are in inUse,
+// that the options evict, least recently used first. It sorts repos from least
+// to most recently used.
+func planCacheGC(repos []cachedRepo, inUse map[string]bool, opts CacheGCOptions) []cachedRepo {
+	sort.SliceStable(repos, func(i, j int) bool {
+		return repos[i].lastUsed.Before(repos[j].lastUsed)
+	})
+
+	var total int64
+	for _, r := range repos {
+		total += r.size
+	}
+
+	var evict []cachedRepo
+	for _, r := range repos {
+		if inUse[r.path] {
+			continue
+		}
+		stale := !opts.UnusedSince.IsZero() && r.lastUsed.Before(opts.UnusedSince)
+		over := opts.MaxBytes > 0 && total > opts.MaxBytes
+		if stale || over {
+			evict = append(evict, r)
+			total -= r.size
+		}
+	}
+	return evict
+}
+
+// cachedRepos returns the source repositories in the cache directory. A
+// repository was last used when its directory was last modified, which the
+// sourceCoordinator also does as it sets up the source.
+func cachedRepos(cd cacheDir) ([]cachedRepo, error) {
+	names, err := cd.sources()
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]cachedRepo, 0, len(names))
+	for _, name := range names {
+		path := filepath.Clean(cd.sourcePathFor(name))
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to stat %s", path)
+		}
+		repos = append(repos, cachedRepo{
+			path:     path,
+			size:     dirSize(path),
+			lastUsed: fi.ModTime(),
+		})
+	}
+	return repos, nil
+}
+
+// dirSize returns the number of bytes occupied by the regular files in the
+// tree at path. Files that cannot be read are skipped.
+func dirSize(path string) int64 {
+	var n int64
+	filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			n += fi.Size()
+		}
+		return nil
+	})
+	return n
+}
+
+// localSource is a source with a local repository.
+type localSource interface {
+	source
+	localPath() string
+}
+
+// markSourceUsed records that the repository at path is being used, for
+// CollectGarbage, if it exists.
+func markSourceUsed(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	sm, clean := mkNaiveSM(t)
+	defer clean()
+
+	// Each repository is 100 bytes, and a day more recently used than the
+	// last.
+	now := time.Now()
+	cd := cacheDir{root: sm.cachedir}
+	var paths []string
+	for i, name := range []string{"https---example.com-old", "https---example.com-mid", "https---example.com-new"} {
+		path := cd.sourcePathFor(name)
+		if err := os.MkdirAll(filepath.Join(path, ".git"), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, ".git", "pack"), make([]byte, 100), 0666); err != nil {
+			t.Fatal(err)
+		}
+		used := now.Add(time.Duration(i-3) * 24 * time.Hour)
+		if err := os.Chtimes(path, used, used); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	res, err := sm.CollectGarbage(CacheGCOptions{MaxBytes: 150, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CacheGCResult{Evicted: paths[:2], Reclaimed: 200, Remaining: 100}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("unexpected dry run result:\n\t(GOT): %+v\n\t(WNT): %+v", res, want)
+	}
+	if _, err = os.Stat(paths[0]); err != nil {
+		t.Errorf("expected a dry run to leave %s alone: %s", paths[0], err)
+	}
+
+	res, err = sm.CollectGarbage(CacheGCOptions{UnusedSince: now.Add(-60 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = CacheGCResult{Evicted: paths[:1], Reclaimed: 100, Remaining: 200}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("unexpected result:\n\t(GOT): %+v\n\t(WNT): %+v", res, want)
+	}
+	if _, err = os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be evicted", paths[0])
+	}
+
+	res, err = sm.CollectGarbage(CacheGCOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Evicted) != 0 || res.Remaining != 200 {
+		t.Errorf("expected nothing to be evicted without options, got %+v", res)
+	}
+}
+
+func TestPlanCacheGCSkipsInUse(t *testing.T) {
+	now := time.Now()
+	repos := []cachedRepo{
+		{path: "new", size: 10, lastUsed: now},
+		{path: "old", size: 10, lastUsed: now.Add(-2 * time.Hour)},
+		{path: "older", size: 10, lastUsed: now.Add(-3 * time.Hour)},
+	}
+	evict := planCacheGC(repos, map[string]bool{"older": true}, CacheGCOptions{MaxBytes: 10})
+
+	var got []string
+	for _, r := range evict {
+		got = append(got, r.path)
+	}
+	// The repository in use can't be evicted, so the budget isn't met.
+	if want := []string{"old", "new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected to evict %v, got %v", want, got)
+	}
+}
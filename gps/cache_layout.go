@@ -0,0 +1,257 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/golang/dep/internal/fs"
+	"github.com/pkg/errors"
+)
+
+// CacheLayout is a version of the layout in which a SourceMgr keeps the
+// contents of its cache directory.
+//
+// The layout of a cache directory is recorded in it, and when a SourceMgr is
+// created with a different layout than the one its cache directory is in, the
+// cache is migrated to the new layout, by moving what is already there, rather
+// than discarding it.
+type CacheLayout int
+
+const (
+	// CacheLayoutV1 is the original layout: the repository of each source is
+	// kept in a directory named after its URL, under the sources directory,
+	// and the persistent cache of metadata, and any cached ref
+	// advertisements, in the root of the cache directory alongside them.
+	CacheLayoutV1 CacheLayout = iota + 1
+	// CacheLayoutV2 shards the repositories of sources into a directory per
+	// host, under the repos directory, so that no one directory grows too
+	// large to list efficiently, and keeps the metadata apart from them,
+	// under the metadata directory.
+	CacheLayoutV2
+)
+
+// DefaultCacheLayout is the layout of a SourceMgr's cache directory, unless
+// configured otherwise. It may change between releases, in which case cache
+// directories are migrated as they are first used.
+const DefaultCacheLayout = CacheLayoutV1
+
+// cacheLayoutFilename is the name of the file, in the root of a cache
+// directory, that records its layout. A cache directory without one is in
+// CacheLayoutV1, which predates it.
+const cacheLayoutFilename = "layout"
+
+func (l CacheLayout) String() string {
+	return fmt.Sprintf("v%d", l)
+}
+
+func (l CacheLayout) valid() bool {
+	return l >= CacheLayoutV1 && l <= CacheLayoutV2
+}
+
+// cacheDir is a cache directory, laid out according to a CacheLayout. The zero
+// layout is CacheLayoutV1.
+type cacheDir struct {
+	root   string
+	layout CacheLayout
+}
+
+// sourcesDir returns the directory under which source repositories are kept.
+func (cd cacheDir) sourcesDir() string {
+	if cd.layout == CacheLayoutV2 {
+		return filepath.Join(cd.root, "repos")
+	}
+	return filepath.Join(cd.root, "sources")
+}
+
+// metadataDir returns the directory in which the persistent cache of metadata
+// about sources is kept.
+func (cd cacheDir) metadataDir() string {
+	if cd.layout == CacheLayoutV2 {
+		return filepath.Join(cd.root, "metadata")
+	}
+	return cd.root
+}
+
+// refsDir returns the directory in which ref advertisements are cached.
+func (cd cacheDir) refsDir() string {
+	return filepath.Join(cd.metadataDir(), "refs")
+}
+
+// sourcePath returns the path of the repository for the source at sourceURL.
+func (cd cacheDir) sourcePath(sourceURL string) string {
+	return cd.sourcePathFor(sanitizer.Replace(sourceURL))
+}
+
+// sourcePathFor returns the path of the repository with the sanitized name.
+func (cd cacheDir) sourcePathFor(name string) string {
+	if cd.layout == CacheLayoutV2 {
+		return filepath.Join(cd.sourcesDir(), hostShard(name), name)
+	}
+	return filepath.Join(cd.sourcesDir(), name)
+}
+
+// sources returns the sanitized names of the repositories in the cache.
+func (cd cacheDir) sources() ([]string, error) {
+	dirs := []string{cd.sourcesDir()}
+	if cd.layout == CacheLayoutV2 {
+		shards, err := readDirNames(cd.sourcesDir())
+		if err != nil {
+			return nil, err
+		}
+		dirs = dirs[:0]
+		for _, s := range shards {
+			dirs = append(dirs, filepath.Join(cd.sourcesDir(), s))
+		}
+	}
+
+	var names []string
+	for _, dir := range dirs {
+		ns, err := readDirNames(dir)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, ns...)
+	}
+	return names, nil
+}
+
+// readDirNames returns the names of the directories in dir, which need not
+// exist.
+func readDirNames(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list %s", dir)
+	}
+	var names []string
+	for _, fi := range fis {
+		if fi.IsDir() {
+			names = append(names, fi.Name())
+		}
+	}
+	return names, nil
+}
+
+// hostShard returns the name of the shard for the repository with the given
+// sanitized name: the host from its URL, as sanitized. Sanitizing replaces each
+// ":", "/" and "+" with "-", and doubles each "-" that was already there, so
+// the host is what follows the scheme and any user, up to the first lone "-".
+func hostShard(name string) string {
+	s := name
+	if i := strings.Index(s, "---"); i >= 0 {
+		s = s[i+len("---"):]
+	}
+	if i := strings.Index(s, "@"); i >= 0 {
+		s = s[i+1:]
+	}
+
+	var host []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] == '-' {
+			if i+1 >= len(s) || s[i+1] != '-' {
+				break
+			}
+			i++
+		}
+		host = append(host, s[i])
+	}
+	if h := string(host); h != "" && h != "." && h != ".." {
+		return h
+	}
+	return "_"
+}
+
+// readCacheLayout returns the layout the cache directory at root is in.
+func readCacheLayout(root string) (CacheLayout, error) {
+	b, err := ioutil.ReadFile(filepath.Join(root, cacheLayoutFilename))
+	if os.IsNotExist(err) {
+		return CacheLayoutV1, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read cache layout")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if l := CacheLayout(n); err == nil && l.valid() {
+		return l, nil
+	}
+	return 0, errors.Errorf("unknown cache layout %q in %s", strings.TrimSpace(string(b)), root)
+}
+
+// migrateCache moves the contents of the cache directory at root into the
+// provided layout, if it is in another one, and records the new layout. The
+// caller must hold the lock on the cache directory.
+//
+// Each step only moves what is still in its old location, so a migration that
+// is interrupted is resumed the next time the cache is opened. Anything
+// already at a new location takes precedence over its counterpart at the old
+// one, which is discarded.
+func migrateCache(root string, to CacheLayout, logger *log.Logger) error {
+	from, err := readCacheLayout(root)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	logger.Printf("Migrating cache %s from layout %s to %s", root, from, to)
+
+	src, dst := cacheDir{root: root, layout: from}, cacheDir{root: root, layout: to}
+	names, err := src.sources()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = moveCacheEntry(src.sourcePathFor(name), dst.sourcePathFor(name)); err != nil {
+			return err
+		}
+	}
+	if err = moveCacheEntry(filepath.Join(src.metadataDir(), boltCacheFilename), filepath.Join(dst.metadataDir(), boltCacheFilename)); err != nil {
+		return err
+	}
+	if err = moveCacheEntry(src.refsDir(), dst.refsDir()); err != nil {
+		return err
+	}
+	removeEmptyDirs(src.sourcesDir())
+	if src.metadataDir() != root {
+		removeEmptyDirs(src.metadataDir())
+	}
+
+	layout := []byte(strconv.Itoa(int(to)) + "\n")
+	return errors.Wrap(ioutil.WriteFile(filepath.Join(root, cacheLayoutFilename), layout, 0666), "failed to record cache layout")
+}
+
+// moveCacheEntry moves the file or directory at from to to, if from exists.
+func moveCacheEntry(from, to string) error {
+	if _, err := os.Lstat(from); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return errors.Wrapf(os.RemoveAll(from), "failed to remove %s, superseded by %s", from, to)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return errors.Wrapf(err, "failed to create %s", filepath.Dir(to))
+	}
+	return errors.Wrapf(fs.RenameWithFallback(from, to), "failed to move %s to %s", from, to)
+}
+
+// removeEmptyDirs removes dir, and any directories under it, if they contain
+// nothing else.
+func removeEmptyDirs(dir string) {
+	names, _ := readDirNames(dir)
+	for _, name := range names {
+		removeEmptyDirs(filepath.Join(dir, name))
+	}
+	// Remove fails on directories that are not empty.
+	os.Remove(dir)
+}
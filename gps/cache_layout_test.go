@@ -0,0 +1,137 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHostShard(t *testing.T) {
+	cases := map[string]string{
+		"https://github.com/sdboyer/gpkt":     "github.com",
+		"ssh://git@my-host.example.com/a/b":   "my-host.example.com",
+		"git+ssh://git@bitbucket.org/foo/bar": "bitbucket.org",
+		"git@gitlab.com:foo/bar.git":          "gitlab.com",
+		"https://example.com:8443/foo":        "example.com",
+		"":                                    "_",
+	}
+	for u, want := range cases {
+		if got := hostShard(sanitizer.Replace(u)); got != want {
+			t.Errorf("expected the shard for %q to be %q, got %q", u, want, got)
+		}
+	}
+}
+
+func TestMigrateCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "gps-cache-layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	touch := func(path string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(path), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	urls := []string{"https://github.com/sdboyer/gpkt", "https://bitbucket.org/sdboyer/withbm"}
+	v1 := cacheDir{root: root, layout: CacheLayoutV1}
+	v2 := cacheDir{root: root, layout: CacheLayoutV2}
+	for _, u := range urls {
+		touch(filepath.Join(v1.sourcePath(u), ".git", "HEAD"))
+	}
+	touch(filepath.Join(v1.metadataDir(), boltCacheFilename))
+	touch(filepath.Join(v1.refsDir(), "refs.json"))
+
+	logger := log.New(ioutil.Discard, "", 0)
+	for _, c := range []struct {
+		from, to cacheDir
+	}{{from: v1, to: v2}, {from: v2, to: v1}} {
+		if err = migrateCache(root, c.to.layout, logger); err != nil {
+			t.Fatalf("failed to migrate to %s: %s", c.to.layout, err)
+		}
+		if l, err := readCacheLayout(root); err != nil || l != c.to.layout {
+			t.Fatalf("expected the cache to be recorded as %s, got %s (%v)", c.to.layout, l, err)
+		}
+		for _, u := range urls {
+			if !exists(filepath.Join(c.to.sourcePath(u), ".git", "HEAD")) {
+				t.Errorf("expected %s to have moved to %s", u, c.to.sourcePath(u))
+			}
+			if exists(c.from.sourcePath(u)) {
+				t.Errorf("expected %s to be gone from %s", u, c.from.sourcePath(u))
+			}
+		}
+		if !exists(filepath.Join(c.to.metadataDir(), boltCacheFilename)) || !exists(filepath.Join(c.to.refsDir(), "refs.json")) {
+			t.Errorf("expected the metadata to have moved to %s", c.to.metadataDir())
+		}
+		if exists(c.from.sourcesDir()) {
+			t.Errorf("expected the old sources directory %s to be removed", c.from.sourcesDir())
+		}
+	}
+
+	// A repository that is already present in the new layout supersedes the
+	// one left in the old.
+	if err = migrateCache(root, CacheLayoutV2, logger); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(v1.sourcePath(urls[0]), "stale")
+	touch(stale)
+	if err = ioutil.WriteFile(filepath.Join(root, cacheLayoutFilename), []byte("1\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err = migrateCache(root, CacheLayoutV2, logger); err != nil {
+		t.Fatal(err)
+	}
+	if exists(stale) || exists(filepath.Join(v2.sourcePath(urls[0]), "stale")) {
+		t.Error("expected the stale repository to be discarded")
+	}
+}
+
+func TestSourceManagerCacheLayout(t *testing.T) {
+	cpath, err := ioutil.TempDir("", "smcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cpath)
+
+	if _, err = NewSourceManager(SourceManagerConfig{Cachedir: cpath, CacheLayout: 7}); err == nil {
+		t.Fatal("expected an unknown cache layout to be rejected")
+	}
+
+	sm, err := NewSourceManager(SourceManagerConfig{Cachedir: cpath, CacheLayout: CacheLayoutV2, CacheAge: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.Release()
+	for _, p := range []string{"repos", filepath.Join("metadata", boltCacheFilename), cacheLayoutFilename} {
+		if _, err = os.Stat(filepath.Join(cpath, p)); err != nil {
+			t.Errorf("expected %s in the new cache layout: %s", p, err)
+		}
+	}
+
+	// The default layout migrates the cache back.
+	sm, err = NewSourceManager(SourceManagerConfig{Cachedir: cpath, CacheAge: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.Release()
+	for _, p := range []string{"sources", boltCacheFilename} {
+		if _, err = os.Stat(filepath.Join(cpath, p)); err != nil {
+			t.Errorf("expected %s in the default cache layout: %s", p, err)
+		}
+	}
+}
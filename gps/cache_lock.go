@@ -0,0 +1,405 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The cache lock is a file, created exclusively by the process that holds the
+// lock, recording the PID and host of that process. Exclusive creation works
+// the same way on every platform and on network filesystems, unlike advisory
+// locks.
+//
+// While it holds the lock, a process touches the file periodically, so that
+// its modification time serves as a heartbeat. A lock is stale, and may be
+// taken over, if its heartbeat stops for longer than staleLockAge, or if its
+// owner ran on this host and has exited; the former recovers locks left by
+// crashed processes on other hosts sharing the cache.
+
+const (
+	// staleLockAge is how long a lock's heartbeat may stop before the lock is
+	// considered abandoned.
+	staleLockAge = 2 * time.Minute
+	// lockHeartbeat is how often the holder of a lock renews its heartbeat.
+	lockHeartbeat = staleLockAge / 8
+	// cacheLockRetry is how often a lock on the cache directory, or the
+	// departure of the processes sharing it, is polled for.
+	cacheLockRetry = time.Second
+	// repoLockRetry is how often a lock on a source's repository is polled
+	// for. Those are held only for single operations.
+	repoLockRetry = 50 * time.Millisecond
+	// sharedLockPrefix begins the names of the files in the locks directory
+	// that register the processes sharing the cache.
+	sharedLockPrefix = "shared-"
+	// repoLockPrefix begins the names of the lock files in the locks
+	// directory that guard the sources' repositories.
+	repoLockPrefix = "repo-"
+)
+
+// A cache directory is either used by a single process, which holds the cache
+// lock throughout, or shared by processes that each hold the cache lock only
+// while they open the cache, register themselves in its locks directory, and
+// then lock each source's repository in that directory for as long as they
+// operate on it. A process requiring the cache to itself waits, holding the
+// cache lock, until every registered process is done with it.
+
+// CacheLockOwner describes the process holding the lock on a cache directory.
+type CacheLockOwner struct {
+	PID  int    `json:"pid"`
+	Host string `json:"host"`
+	// Acquired is when the process took the lock.
+	Acquired time.Time `json:"acquired"`
+	// Heartbeat is when the process last renewed the lock.
+	Heartbeat time.Time `json:"-"`
+}
+
+func (o CacheLockOwner) String() string {
+	return fmt.Sprintf("process %d on %s, since %s", o.PID, o.Host, o.Acquired.Format(time.RFC3339))
+}
+
+// isSelf reports whether the owner is this process.
+func (o CacheLockOwner) isSelf() bool {
+	return o.PID == os.Getpid() && o.Host == lockHost()
+}
+
+// isStale reports whether the lock has been abandoned by its owner, as of now.
+func (o CacheLockOwner) isStale(now time.Time, age time.Duration) bool {
+	if o.Host == lockHost() && !processExists(o.PID) {
+		return true
+	}
+	return now.Sub(o.Heartbeat) > age
+}
+
+// lockHost returns the name of this host, as recorded in lock files.
+func lockHost() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return h
+}
+
+// BreakCacheLock removes the lock on the cache directory, whether or not its
+// owner is still running, and returns the owner it had. It reports no error if
+// the cache directory is not locked.
+//
+// It is for recovering from a lock that is known to be abandoned, but is not
+// yet considered stale.
+func BreakCacheLock(cachedir string) (CacheLockOwner, error) {
+	path := filepath.Join(cachedir, cacheLockFilename)
+	owner, _, err := readLockFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return owner, err
+	}
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return owner, errors.Wrapf(err, "failed to remove %s", path)
+	}
+	return owner, nil
+}
+
+// lockHeldError indicates that a lock is held by another process, which is
+// still running.
+type lockHeldError struct {
+	path  string
+	owner CacheLockOwner
+}
+
+func (e *lockHeldError) Error() string {
+	return fmt.Sprintf("%s is held by %s", e.path, e.owner)
+}
+
+// Temporary reports that the lock may be taken once its owner releases it.
+func (e *lockHeldError) Temporary() bool {
+	return true
+}
+
+// CacheBusyError indicates that a lock on a cache directory, or on a
+// repository within it, was not taken within the time the SourceManager was
+// configured to wait for it.
+type CacheBusyError struct {
+	// Path is the lock file, or in the case of a cache that is shared by
+	// other processes, the directory in which they are registered.
+	Path string
+	// Owner is the process, or one of the processes, holding the lock.
+	Owner CacheLockOwner
+	// Waited is how long the lock was waited for.
+	Waited time.Duration
+}
+
+func (e *CacheBusyError) Error() string {
+	return fmt.Sprintf("%s is held by %s; gave up after %s", e.Path, e.Owner, e.Waited)
+}
+
+// Temporary reports that the lock may be taken once its owner releases it.
+func (e *CacheBusyError) Temporary() bool {
+	return true
+}
+
+// waitLock calls try, which attempts to take a lock, until it stops failing
+// with a *lockHeldError, every retry interval, and returns what it last
+// returned. notify, if not nil, is called with each such failure. If the lock
+// is not taken within timeout, waitLock gives up with a *CacheBusyError; a
+// zero timeout waits indefinitely, and a negative one not at all.
+func waitLock(ctx context.Context, try func() error, timeout, retry time.Duration, notify func(error)) error {
+	start := time.Now()
+	for {
+		err := try()
+		he, ok := err.(*lockHeldError)
+		if !ok {
+			return err
+		}
+
+		waited := time.Since(start)
+		if timeout < 0 || (timeout > 0 && waited >= timeout) {
+			return &CacheBusyError{Path: he.path, Owner: he.owner, Waited: waited}
+		}
+		if notify != nil {
+			notify(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+// sharedCacheSeq distinguishes the registrations of the SourceManagers in this
+// process that share a cache directory.
+var sharedCacheSeq int32
+
+// shareCachedir registers this process as sharing the cache directory, and
+// returns the registration, which the process holds until it is done with the
+// cache. The caller must hold the lock on the cache directory.
+func shareCachedir(cachedir string) (locker, error) {
+	locksDir := filepath.Join(cachedir, cacheLocksDirectory)
+	if err := os.MkdirAll(locksDir, 0777); err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", locksDir)
+	}
+
+	name := fmt.Sprintf("%s%s-%d-%d", sharedLockPrefix, lockHost(), os.Getpid(), atomic.AddInt32(&sharedCacheSeq, 1))
+	lf := newFileLock(filepath.Join(locksDir, name), staleLockAge)
+	if err := lf.TryLock(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+// tryUnshared succeeds if no process is registered as sharing the cache whose
+// locks directory is locksDir, and otherwise fails with a *lockHeldError naming
+// one of them. Registrations that are stale are removed.
+func tryUnshared(locksDir string) error {
+	names, err := ioutil.ReadDir(locksDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	for _, fi := range names {
+		if !strings.HasPrefix(fi.Name(), sharedLockPrefix) {
+			continue
+		}
+		path := filepath.Join(locksDir, fi.Name())
+		owner, data, err := readLockFile(path)
+		switch {
+		case os.IsNotExist(err):
+			continue
+		case err != nil:
+			return err
+		case owner.isStale(now, staleLockAge):
+			if err = takeOverLockFile(path, data); err != nil {
+				return err
+			}
+			continue
+		}
+		return &lockHeldError{path: locksDir, owner: owner}
+	}
+	return nil
+}
+
+// repoLockPath returns the lock file in the locks directory guarding the
+// repository at repo, whose name in the cache is unique to its source.
+func repoLockPath(locksDir, repo string) string {
+	return filepath.Join(locksDir, repoLockPrefix+filepath.Base(repo))
+}
+
+// fileLock is a locker backed by a lock file, as described above.
+type fileLock struct {
+	path string
+	age  time.Duration
+
+	mu   sync.Mutex
+	held []byte // The contents of the lock file while it is held.
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newFileLock(path string, age time.Duration) *fileLock {
+	return &fileLock{path: path, age: age}
+}
+
+// TryLock takes the lock if it is free or stale, and returns a temporary
+// error if it is held by another process.
+func (l *fileLock) TryLock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held != nil {
+		return errors.Errorf("%s is already locked", l.path)
+	}
+
+	owner := CacheLockOwner{
+		PID:      os.Getpid(),
+		Host:     lockHost(),
+		Acquired: time.Now().UTC(),
+	}
+	contents, err := json.Marshal(owner)
+	if err != nil {
+		return err
+	}
+
+	// Taking over a stale lock frees it for another attempt, which may lose
+	// to another process that also saw it was stale.
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			_, err = f.Write(contents)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(l.path)
+				return errors.Wrapf(err, "failed to write %s", l.path)
+			}
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+
+		cur, data, err := readLockFile(l.path)
+		switch {
+		case os.IsNotExist(err):
+			// The lock was released as it was read.
+			continue
+		case err != nil:
+			return err
+		case attempt > 0 || !cur.isStale(time.Now(), l.age):
+			return &lockHeldError{path: l.path, owner: cur}
+		}
+		if err = takeOverLockFile(l.path, data); err != nil {
+			return err
+		}
+	}
+
+	l.held = contents
+	l.stop, l.done = make(chan struct{}), make(chan struct{})
+	go l.heartbeat(l.stop, l.done)
+	return nil
+}
+
+// Unlock releases the lock, removing the lock file unless it has been taken
+// over by another process.
+func (l *fileLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held == nil {
+		return errors.Errorf("%s is not locked", l.path)
+	}
+
+	close(l.stop)
+	<-l.done
+	defer func() { l.held = nil }()
+
+	if _, data, err := readLockFile(l.path); err != nil || !bytes.Equal(data, l.held) {
+		return errors.Errorf("%s was taken over by another process", l.path)
+	}
+	return os.Remove(l.path)
+}
+
+// heartbeat renews the lock file's modification time until stop is closed, as
+// long as the lock remains held.
+func (l *fileLock) heartbeat(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	t := time.NewTicker(lockHeartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			// The contents never change while the lock is held, so they can be
+			// read without l.mu, which Unlock holds while it waits for us.
+			if _, data, err := readLockFile(l.path); err == nil && bytes.Equal(data, l.held) {
+				os.Chtimes(l.path, now, now)
+			}
+		}
+	}
+}
+
+// readLockFile returns the owner recorded in the lock file at path, and the
+// file's raw contents.
+func readLockFile(path string) (CacheLockOwner, []byte, error) {
+	var owner CacheLockOwner
+	fi, err := os.Stat(path)
+	if err != nil {
+		return owner, nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return owner, nil, err
+	}
+
+	if err = json.Unmarshal(data, &owner); err != nil {
+		owner = CacheLockOwner{}
+		// Older versions recorded only the PID of the owner, which was always
+		// on this host. A lock file that was left half written records no
+		// owner at all, so only its heartbeat can show that it is stale.
+		if pid, perr := strconv.Atoi(strings.TrimSpace(string(data))); perr == nil {
+			owner.PID, owner.Host = pid, lockHost()
+		}
+	}
+	owner.Heartbeat = fi.ModTime()
+	return owner, data, nil
+}
+
+// takeOverLockFile removes the stale lock file at path, whose contents were
+// observed to be data. If another process replaced the lock file since it was
+// observed, the replacement is restored.
+func takeOverLockFile(path string, data []byte) error {
+	tomb := fmt.Sprintf("%s.stale.%d", path, os.Getpid())
+	if err := os.Rename(path, tomb); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to take over stale lock %s", path)
+	}
+	defer os.Remove(tomb)
+
+	if got, err := ioutil.ReadFile(tomb); err == nil && !bytes.Equal(got, data) {
+		// Linking fails if yet another process has locked path meanwhile,
+		// which leaves that process with the lock.
+		os.Link(tomb, path)
+	}
+	return nil
+}
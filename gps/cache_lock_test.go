@@ -0,0 +1,277 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// exitedPID returns the PID of a process that has exited.
+func exitedPID(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.ProcessState.Pid()
+}
+
+func writeLockFile(t *testing.T, path string, data []byte, heartbeat time.Time) {
+	if err := ioutil.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, heartbeat, heartbeat); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mkLockOwner(t *testing.T, pid int, host string) []byte {
+	data, err := json.Marshal(CacheLockOwner{PID: pid, Host: host, Acquired: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, cacheLockFilename)
+
+	l := newFileLock(path, staleLockAge)
+	if err = l.TryLock(); err != nil {
+		t.Fatalf("unexpected error taking free lock: %v", err)
+	}
+	owner, _, err := readLockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !owner.isSelf() {
+		t.Errorf("expected the lock to record this process as its owner, got %s", owner)
+	}
+
+	err = newFileLock(path, staleLockAge).TryLock()
+	if he, ok := err.(*lockHeldError); !ok || !he.Temporary() {
+		t.Errorf("expected a temporary *lockHeldError taking a held lock, got %T: %v", err, err)
+	}
+
+	if err = l.Unlock(); err != nil {
+		t.Fatalf("unexpected error releasing lock: %v", err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file to be removed on release, got %v", err)
+	}
+}
+
+func TestFileLockStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, cacheLockFilename)
+
+	now := time.Now()
+	dead := exitedPID(t)
+	for _, test := range []struct {
+		name      string
+		data      []byte
+		heartbeat time.Time
+		stale     bool
+	}{
+		{"live", mkLockOwner(t, os.Getpid(), lockHost()), now, false},
+		{"exited", mkLockOwner(t, dead, lockHost()), now, true},
+		{"remote", mkLockOwner(t, dead, "elsewhere"), now, false},
+		{"remote abandoned", mkLockOwner(t, dead, "elsewhere"), now.Add(-2 * staleLockAge), true},
+		{"legacy", []byte(strconv.Itoa(dead) + "\n"), now, true},
+		{"half written", nil, now, false},
+		{"half written abandoned", nil, now.Add(-2 * staleLockAge), true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			writeLockFile(t, path, test.data, test.heartbeat)
+			defer os.Remove(path)
+
+			l := newFileLock(path, staleLockAge)
+			err := l.TryLock()
+			if !test.stale {
+				if _, ok := err.(*lockHeldError); !ok {
+					t.Errorf("expected the lock to be held, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected the stale lock to be taken over, got %v", err)
+			}
+			if owner, _, _ := readLockFile(path); !owner.isSelf() {
+				t.Errorf("expected the lock to record this process as its owner, got %s", owner)
+			}
+			if err = l.Unlock(); err != nil {
+				t.Errorf("unexpected error releasing lock: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileLockTakenOver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, cacheLockFilename)
+
+	l := newFileLock(path, staleLockAge)
+	if err = l.TryLock(); err != nil {
+		t.Fatal(err)
+	}
+
+	owner, err := BreakCacheLock(dir)
+	if err != nil {
+		t.Fatalf("unexpected error breaking lock: %v", err)
+	}
+	if !owner.isSelf() {
+		t.Errorf("expected the broken lock to have been owned by this process, got %s", owner)
+	}
+
+	other := mkLockOwner(t, os.Getpid()+1, "elsewhere")
+	writeLockFile(t, path, other, time.Now())
+	if err = l.Unlock(); err == nil {
+		t.Error("expected an error releasing a lock that was taken over")
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != string(other) {
+		t.Errorf("expected releasing a lock that was taken over to leave the new owner's lock file, got %q", data)
+	}
+
+	if owner, err = BreakCacheLock(filepath.Join(dir, "unlocked")); err != nil || owner.PID != 0 {
+		t.Errorf("expected breaking no lock to do nothing, got %s, %v", owner, err)
+	}
+}
+
+func TestWaitLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, cacheLockFilename)
+
+	held := newFileLock(path, staleLockAge)
+	if err = held.TryLock(); err != nil {
+		t.Fatal(err)
+	}
+
+	var notified int
+	l := newFileLock(path, staleLockAge)
+	err = waitLock(context.Background(), l.TryLock, 50*time.Millisecond, 10*time.Millisecond, func(error) { notified++ })
+	if be, ok := err.(*CacheBusyError); !ok || be.Path != path || !be.Owner.isSelf() || be.Waited < 50*time.Millisecond {
+		t.Errorf("expected a *CacheBusyError for %s after the timeout, got %T: %v", path, err, err)
+	}
+	if notified == 0 {
+		t.Error("expected to be notified while waiting")
+	}
+
+	if err = waitLock(context.Background(), l.TryLock, -1, time.Hour, nil); err == nil {
+		t.Error("expected a negative timeout not to wait for a held lock")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = waitLock(ctx, l.TryLock, 0, time.Hour, nil); err != context.Canceled {
+		t.Errorf("expected waiting to stop when the context is canceled, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		held.Unlock()
+	}()
+	if err = waitLock(context.Background(), l.TryLock, 0, 10*time.Millisecond, nil); err != nil {
+		t.Fatalf("expected to take the lock once it was released, got %v", err)
+	}
+	l.Unlock()
+}
+
+func TestSharedCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	shared := SourceManagerConfig{Cachedir: dir, SharedCache: true, LockTimeout: -1}
+	sm1, err := NewSourceManager(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm2, err := NewSourceManager(shared)
+	if err != nil {
+		t.Fatalf("expected a second SourceManager to share the cache, got %v", err)
+	}
+
+	exclusive := SourceManagerConfig{Cachedir: dir, LockTimeout: 50 * time.Millisecond}
+	_, err = NewSourceManager(exclusive)
+	if be, ok := err.(*CacheBusyError); !ok || !be.Owner.isSelf() {
+		t.Errorf("expected a *CacheBusyError while the cache is shared, got %T: %v", err, err)
+	}
+
+	sm1.Release()
+	sm2.Release()
+	sm, err := NewSourceManager(exclusive)
+	if err != nil {
+		t.Fatalf("expected the cache to be free once the sharing SourceManagers were released, got %v", err)
+	}
+	sm.Release()
+
+	// Another process using the cache exclusively keeps it from being shared.
+	writeLockFile(t, filepath.Join(dir, cacheLockFilename), mkLockOwner(t, os.Getpid()+1, "elsewhere"), time.Now())
+	_, err = NewSourceManager(shared)
+	if be, ok := err.(*CacheBusyError); !ok || be.Owner.Host != "elsewhere" {
+		t.Errorf("expected a *CacheBusyError sharing a cache in exclusive use, got %T: %v", err, err)
+	}
+}
+
+func TestRepoLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	locksDir := filepath.Join(dir, cacheLocksDirectory)
+	if err = os.MkdirAll(locksDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	repo := filepath.Join(dir, "sources", "https---example.com-repo")
+	held := newFileLock(repoLockPath(locksDir, repo), staleLockAge)
+	if err = held.TryLock(); err != nil {
+		t.Fatal(err)
+	}
+	defer held.Unlock()
+
+	sg := &sourceGateway{
+		repoLock:    newFileLock(repoLockPath(locksDir, repo), staleLockAge),
+		lockTimeout: 20 * time.Millisecond,
+	}
+	if err = sg.lock(context.Background()); err == nil {
+		t.Fatal("expected the gateway not to take a repository locked by another holder")
+	}
+	if _, ok := err.(*CacheBusyError); !ok {
+		t.Errorf("expected a *CacheBusyError, got %T: %v", err, err)
+	}
+
+	// The gateway's own lock must have been released along the way.
+	sg.mu.Lock()
+	sg.mu.Unlock()
+}
@@ -0,0 +1,21 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package gps
+
+import "syscall"
+
+// processExists reports whether a process with the given PID is running on
+// this host.
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	// Signal 0 checks that the process exists without signalling it. EPERM
+	// means that it exists, but belongs to another user.
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
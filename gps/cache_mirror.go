@@ -0,0 +1,518 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CacheStore is a remote object store, such as an S3 or GCS bucket, to which
+// a SourceMgr's cache directory can be replicated with PushCache, and from
+// which it can be seeded with PullCache. Objects are named by slash-separated
+// keys.
+//
+// gps provides only DirCacheStore; implementations for particular object
+// stores are left to tools, so as not to depend on their client libraries.
+type CacheStore interface {
+	// Get returns the contents of the object with the key, or
+	// ErrCacheObjectNotExist if there is none.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Put stores what is read from r as the object with the key, replacing
+	// any existing object.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// List returns the keys of all the objects whose keys have the prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Delete removes the object with the key, if there is one.
+	Delete(ctx context.Context, key string) error
+}
+
+// ErrCacheObjectNotExist is returned by a CacheStore's Get method when there is
+// no object with the requested key.
+var ErrCacheObjectNotExist = errors.New("no such object in cache store")
+
+// CacheSyncStats reports what was transferred by PushCache or PullCache.
+type CacheSyncStats struct {
+	Files   int   // Number of files uploaded or downloaded.
+	Bytes   int64 // Total size of the files uploaded or downloaded.
+	Removed int   // Number of local files removed by PullCache.
+}
+
+// A replicated cache is stored as a manifest, describing every file and
+// directory in the cache, and objects holding the contents of its files, keyed
+// by their digest so that files with the same contents are stored only once.
+const (
+	cacheManifestKey      = "manifest.json"
+	cacheObjectsPrefix    = "objects/"
+	cacheManifestVersion  = 1
+	cacheLockFilename     = "sm.lock"
+	cacheLocksDirectory   = "locks"
+	cacheSourcesDirectory = "sources"
+	cacheReposDirectory   = "repos"
+)
+
+type cacheManifest struct {
+	Version int                  `json:"version"`
+	Files   map[string]cacheFile `json:"files"`
+}
+
+type cacheFile struct {
+	Mode   os.FileMode `json:"mode"`
+	Size   int64       `json:"size,omitempty"`
+	Digest string      `json:"digest,omitempty"`
+}
+
+// cacheUnit returns the unit of replication to which the slash-separated path
+// within a cache directory belongs: the directory of the source under the
+// sources directory, or under its host's directory under the repos directory,
+// or otherwise the path itself. Each unit is replicated as a whole, so that a
+// repository is never assembled from files from two different caches.
+func cacheUnit(p string) string {
+	parts := strings.SplitN(p, "/", 4)
+	if parts[0] == cacheSourcesDirectory && len(parts) > 1 {
+		return parts[0] + "/" + parts[1]
+	}
+	if parts[0] == cacheReposDirectory && len(parts) > 2 {
+		return parts[0] + "/" + parts[1] + "/" + parts[2]
+	}
+	return p
+}
+
+// scanCache describes the contents of the cache directory, keyed by their
+// slash-separated paths within it. Only regular files and directories are
+// replicated, and the lock files never are.
+func scanCache(cachedir string) (map[string]cacheFile, error) {
+	files := make(map[string]cacheFile)
+	err := filepath.Walk(cachedir, func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(cachedir, fpath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." || rel == cacheLockFilename {
+			return nil
+		}
+		if rel == cacheLocksDirectory && fi.IsDir() {
+			return filepath.SkipDir
+		}
+
+		switch {
+		case fi.IsDir():
+			files[rel] = cacheFile{Mode: os.ModeDir | fi.Mode().Perm()}
+		case fi.Mode().IsRegular():
+			digest, err := digestFile(fpath)
+			if err != nil {
+				return err
+			}
+			files[rel] = cacheFile{Mode: fi.Mode().Perm(), Size: fi.Size(), Digest: digest}
+		}
+		return nil
+	})
+	return files, errors.Wrapf(err, "failed to scan cache directory %s", cachedir)
+}
+
+func digestFile(fpath string) (string, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func readCacheManifest(ctx context.Context, store CacheStore) (cacheManifest, error) {
+	m := cacheManifest{
+		Version: cacheManifestVersion,
+		Files:   make(map[string]cacheFile),
+	}
+	rc, err := store.Get(ctx, cacheManifestKey)
+	if err == ErrCacheObjectNotExist {
+		return m, nil
+	} else if err != nil {
+		return m, errors.Wrap(err, "failed to read cache manifest")
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return m, errors.Wrap(err, "failed to decode cache manifest")
+	}
+	if m.Version != cacheManifestVersion {
+		return m, errors.Errorf("unsupported cache manifest version %d", m.Version)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]cacheFile)
+	}
+	for p := range m.Files {
+		if err := checkCachePath(p); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// checkCachePath ensures that a slash-separated path from a cache manifest
+// names something within the cache directory other than its locks. Anyone who
+// can write to the store can write its manifest, so its paths are not trusted.
+func checkCachePath(p string) error {
+	lp := filepath.Clean(filepath.FromSlash(p))
+	up := ".." + string(filepath.Separator)
+	if p == "" || path.Clean(p) != p || lp == "." || lp == ".." || strings.HasPrefix(lp, up) ||
+		filepath.IsAbs(lp) || filepath.VolumeName(lp) != "" || path.IsAbs(p) {
+		return errors.Errorf("cache manifest has path %q outside the cache directory", p)
+	}
+	if p == cacheLockFilename || p == cacheLocksDirectory || strings.HasPrefix(p, cacheLocksDirectory+"/") {
+		return errors.Errorf("cache manifest has path %q reserved for locks", p)
+	}
+	return nil
+}
+
+// PushCache replicates the cache directory of a SourceMgr to the store.
+//
+// Each source in the cache replaces the store's copy of it, if any, and the
+// sources that are only in the store are left there, so that many machines may
+// push their caches to the same store. The remaining contents of the cache,
+// such as its metadata database, replace the store's copies outright. Files
+// whose contents the store already has are not uploaded again.
+//
+// The cache directory is locked while it is pushed, so no SourceMgr may be
+// using it, nor may another push or pull of it be under way. Pushes from
+// other machines may run at the same time, but only one of them will take
+// effect.
+func PushCache(ctx context.Context, cachedir string, store CacheStore) (CacheSyncStats, error) {
+	var stats CacheSyncStats
+	lf, err := lockCachedir(cachedir, false, false, 0)
+	if err != nil {
+		return stats, err
+	}
+	defer lf.Unlock()
+
+	local, err := scanCache(cachedir)
+	if err != nil {
+		return stats, err
+	}
+	m, err := readCacheManifest(ctx, store)
+	if err != nil {
+		return stats, err
+	}
+
+	have := make(map[string]bool, len(m.Files))
+	for _, f := range m.Files {
+		if f.Digest != "" {
+			have[f.Digest] = true
+		}
+	}
+
+	units := make(map[string]bool)
+	for p := range local {
+		units[cacheUnit(p)] = true
+	}
+	for p := range m.Files {
+		if units[cacheUnit(p)] {
+			delete(m.Files, p)
+		}
+	}
+
+	for _, p := range sortedCachePaths(local) {
+		f := local[p]
+		m.Files[p] = f
+		if f.Digest == "" || have[f.Digest] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		if err := putCacheObject(ctx, store, filepath.Join(cachedir, filepath.FromSlash(p)), f.Digest); err != nil {
+			return stats, errors.Wrapf(err, "failed to upload %s", p)
+		}
+		have[f.Digest] = true
+		stats.Files++
+		stats.Bytes += f.Size
+	}
+
+	// The manifest goes last, so that it never refers to missing objects.
+	b, err := json.Marshal(m)
+	if err != nil {
+		return stats, errors.Wrap(err, "failed to encode cache manifest")
+	}
+	if err := store.Put(ctx, cacheManifestKey, bytes.NewReader(b)); err != nil {
+		return stats, errors.Wrap(err, "failed to write cache manifest")
+	}
+	return stats, nil
+}
+
+func putCacheObject(ctx context.Context, store CacheStore, fpath, digest string) error {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return store.Put(ctx, cacheObjectsPrefix+digest, f)
+}
+
+// PullCache seeds a SourceMgr's cache directory from a cache that has been
+// pushed to the store with PushCache.
+//
+// Each source in the store replaces the local copy of it, if any, so that it
+// exactly matches the store, while those sources only in the local cache are
+// left alone. The remaining contents of the store, such as the metadata
+// database, replace the local copies outright. Files that are already present
+// locally with the same contents are not downloaded again.
+//
+// The cache directory is locked while it is pulled, so no SourceMgr may be
+// using it, nor may another push or pull of it be under way.
+func PullCache(ctx context.Context, cachedir string, store CacheStore) (CacheSyncStats, error) {
+	var stats CacheSyncStats
+	if err := os.MkdirAll(cachedir, 0777); err != nil {
+		return stats, errors.Wrapf(err, "failed to create cache directory %s", cachedir)
+	}
+	lf, err := lockCachedir(cachedir, false, false, 0)
+	if err != nil {
+		return stats, err
+	}
+	defer lf.Unlock()
+
+	m, err := readCacheManifest(ctx, store)
+	if err != nil {
+		return stats, err
+	}
+	local, err := scanCache(cachedir)
+	if err != nil {
+		return stats, err
+	}
+
+	// Parents sort before their children, so directories are created before
+	// what they contain.
+	for _, p := range sortedCachePaths(m.Files) {
+		f := m.Files[p]
+		lpath := filepath.Join(cachedir, filepath.FromSlash(p))
+		cur, has := local[p]
+		if has && cur.Mode.IsDir() != f.Mode.IsDir() {
+			if err := os.RemoveAll(lpath); err != nil {
+				return stats, errors.Wrapf(err, "failed to remove %s", lpath)
+			}
+			has = false
+		}
+
+		if f.Mode.IsDir() {
+			if err := os.MkdirAll(lpath, f.Mode.Perm()); err != nil {
+				return stats, errors.Wrapf(err, "failed to create %s", lpath)
+			}
+			continue
+		}
+		if has && cur.Digest == f.Digest {
+			if cur.Mode != f.Mode {
+				if err := os.Chmod(lpath, f.Mode); err != nil {
+					return stats, errors.Wrapf(err, "failed to set mode of %s", lpath)
+				}
+			}
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		if err := getCacheObject(ctx, store, lpath, f); err != nil {
+			return stats, errors.Wrapf(err, "failed to download %s", p)
+		}
+		stats.Files++
+		stats.Bytes += f.Size
+	}
+
+	units := make(map[string]bool)
+	for p := range m.Files {
+		units[cacheUnit(p)] = true
+	}
+	// Remove children before their parents.
+	lpaths := sortedCachePaths(local)
+	for i := len(lpaths) - 1; i >= 0; i-- {
+		p := lpaths[i]
+		if _, has := m.Files[p]; has || !units[cacheUnit(p)] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(cachedir, filepath.FromSlash(p))); err != nil {
+			return stats, errors.Wrapf(err, "failed to remove %s", p)
+		}
+		if !local[p].Mode.IsDir() {
+			stats.Removed++
+		}
+	}
+	return stats, nil
+}
+
+// getCacheObject downloads the object with the file's contents to lpath,
+// replacing whatever is there only once the download has been verified.
+func getCacheObject(ctx context.Context, store CacheStore, lpath string, f cacheFile) error {
+	rc, err := store.Get(ctx, cacheObjectsPrefix+f.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(lpath), "."+filepath.Base(lpath))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), rc)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if digest := hex.EncodeToString(h.Sum(nil)); digest != f.Digest {
+		return errors.Errorf("object has digest %s, not %s", digest, f.Digest)
+	}
+
+	if err := os.Chmod(tmp.Name(), f.Mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), lpath)
+}
+
+// PruneCacheStore deletes the objects in the store that are no longer referred
+// to by its cache manifest, as pushes leave behind the objects for files that
+// have since changed. It returns the number of objects deleted.
+//
+// It must not be run while any push to the store is under way, as it may
+// delete objects that the push is about to refer to.
+func PruneCacheStore(ctx context.Context, store CacheStore) (int, error) {
+	m, err := readCacheManifest(ctx, store)
+	if err != nil {
+		return 0, err
+	}
+	keep := make(map[string]bool, len(m.Files))
+	for _, f := range m.Files {
+		if f.Digest != "" {
+			keep[cacheObjectsPrefix+f.Digest] = true
+		}
+	}
+
+	keys, err := store.List(ctx, cacheObjectsPrefix)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list objects in cache store")
+	}
+	var n int
+	for _, key := range keys {
+		if keep[key] {
+			continue
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			return n, errors.Wrapf(err, "failed to delete %s", key)
+		}
+		n++
+	}
+	return n, nil
+}
+
+func sortedCachePaths(files map[string]cacheFile) []string {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// DirCacheStore is a CacheStore that keeps its objects as files under a local
+// directory. It can replicate a cache to a network filesystem, or to a bucket
+// mounted as one.
+type DirCacheStore string
+
+func (d DirCacheStore) path(key string) string {
+	return filepath.Join(string(d), filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// Get opens the file for the key.
+func (d DirCacheStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(d.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrCacheObjectNotExist
+	}
+	return f, err
+}
+
+// Put writes the file for the key, replacing any existing one only once it is
+// complete.
+func (d DirCacheStore) Put(ctx context.Context, key string, r io.Reader) error {
+	fpath := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(fpath), 0777); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fpath), "."+filepath.Base(fpath))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fpath)
+}
+
+// List walks the directory for the files whose keys have the prefix.
+func (d DirCacheStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.Walk(string(d), func(fpath string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fpath == string(d) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(string(d), fpath)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// Delete removes the file for the key.
+func (d DirCacheStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(d.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
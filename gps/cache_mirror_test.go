@@ -0,0 +1,127 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestCacheMirror(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	ctx := context.Background()
+
+	h.TempDir("store")
+	store := DirCacheStore(h.Path("store"))
+
+	// A repository with an empty directory, whose structure must survive.
+	h.TempFile("ci/sources/a/.git/HEAD", "ref: refs/heads/master\n")
+	h.TempFile("ci/sources/a/.git/packed-refs", "abc123 refs/heads/master\n")
+	h.TempDir("ci/sources/a/.git/refs/heads")
+	h.TempFile("ci/sources/b/.hg/store", "b")
+	h.TempFile("ci/"+boltCacheFilename, "metadata")
+	// A lock file left behind by a crashed process, which is taken over.
+	h.TempFile("ci/sm.lock", "")
+	old := time.Now().Add(-2 * staleLockAge)
+	h.Must(os.Chtimes(h.Path("ci/sm.lock"), old, old))
+	h.Must(os.Chmod(h.Path("ci/"+boltCacheFilename), 0600))
+
+	stats, err := PushCache(ctx, h.Path("ci"), store)
+	h.Must(err)
+	if stats.Files != 4 {
+		t.Errorf("expected 4 files to be uploaded, got %+v", stats)
+	}
+	// Nothing has changed, so nothing more is uploaded.
+	stats, err = PushCache(ctx, h.Path("ci"), store)
+	h.Must(err)
+	if stats.Files != 0 {
+		t.Errorf("expected no files to be uploaded again, got %+v", stats)
+	}
+
+	h.TempDir("laptop")
+	stats, err = PullCache(ctx, h.Path("laptop"), store)
+	h.Must(err)
+	if stats.Files != 4 {
+		t.Errorf("expected 4 files to be downloaded, got %+v", stats)
+	}
+	want, err := scanCache(h.Path("ci"))
+	h.Must(err)
+	got, err := scanCache(h.Path("laptop"))
+	h.Must(err)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pulled cache differs from the pushed one:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	// Another machine pushes a different version of a, and a new source, c.
+	h.TempFile("ci2/sources/a/.git/HEAD", "ref: refs/heads/master\n")
+	h.TempFile("ci2/sources/a/.git/packed-refs", "def456 refs/heads/master\n")
+	h.TempFile("ci2/sources/c/.git/HEAD", "ref: refs/heads/master\n")
+	_, err = PushCache(ctx, h.Path("ci2"), store)
+	h.Must(err)
+
+	// The laptop's own source stays, but its copy of a comes to match ci2's,
+	// without the files ci2 lacks.
+	h.TempFile("laptop/sources/d/.git/HEAD", "ref: refs/heads/master\n")
+	h.TempFile("laptop/sources/a/.git/FETCH_HEAD", "abc123\n")
+	stats, err = PullCache(ctx, h.Path("laptop"), store)
+	h.Must(err)
+	if stats.Files != 2 || stats.Removed != 1 {
+		t.Errorf("expected 2 files to be downloaded and 1 removed, got %+v", stats)
+	}
+	h.MustExist(h.Path("laptop/sources/d/.git/HEAD"))
+	h.MustExist(h.Path("laptop/sources/b/.hg/store"))
+	h.MustExist(h.Path("laptop/sources/c/.git/HEAD"))
+	h.MustNotExist(filepath.Join(h.Path("laptop"), "sources/a/.git/refs"))
+	h.MustNotExist(filepath.Join(h.Path("laptop"), "sources/a/.git/FETCH_HEAD"))
+	b, err := ioutil.ReadFile(h.Path("laptop/sources/a/.git/packed-refs"))
+	h.Must(err)
+	if string(b) != "def456 refs/heads/master\n" {
+		t.Errorf("expected a to be updated, got packed-refs %q", b)
+	}
+
+	// The object with a's old packed-refs is no longer referred to.
+	n, err := PruneCacheStore(ctx, store)
+	h.Must(err)
+	if n != 1 {
+		t.Errorf("expected 1 object to be pruned, got %d", n)
+	}
+	h.TempDir("fresh")
+	_, err = PullCache(ctx, h.Path("fresh"), store)
+	h.Must(err)
+}
+
+func TestPullCacheHostileManifest(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	ctx := context.Background()
+
+	h.TempDir("store")
+	store := DirCacheStore(h.Path("store"))
+	h.TempFile("victim/keep", "precious")
+	h.TempDir("cache/sources")
+
+	for _, p := range []string{"../victim", "../victim/keep", "sources/../../victim", "/tmp/x", ".", "", "sources//a", cacheLockFilename, "locks/a"} {
+		m := fmt.Sprintf(`{"version": %d, "files": {%q: {"mode": %d}}}`, cacheManifestVersion, p, os.ModeDir|0755)
+		h.Must(store.Put(ctx, cacheManifestKey, strings.NewReader(m)))
+		if _, err := PullCache(ctx, h.Path("cache"), store); err == nil {
+			t.Errorf("expected a manifest with path %q to be rejected", p)
+		}
+		if _, err := PruneCacheStore(ctx, store); err == nil {
+			t.Errorf("expected pruning with a manifest with path %q to be rejected", p)
+		}
+	}
+	h.MustExist(h.Path("victim/keep"))
+	h.MustExist(h.Path("cache/sources"))
+}
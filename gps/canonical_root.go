@@ -0,0 +1,195 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"strings"
+)
+
+// caseInsensitiveHosts are the hosts whose repository paths are
+// case-insensitive, so that roots beneath them that differ only by case, such
+// as github.com/Sirupsen/logrus and github.com/sirupsen/logrus, name the same
+// repository. The roots on these hosts are always the host followed by two
+// path elements.
+var caseInsensitiveHosts = map[string]bool{
+	"github.com":    true,
+	"bitbucket.org": true,
+}
+
+// CanonicalProjectRoot returns the canonical form of the project root, which
+// it shares with the roots that name the same repository by a different case:
+// roots on hosts whose repository paths are case-insensitive, such as
+// github.com, are folded to lower case, and others are returned as they are.
+//
+// When solving, the root project's constraints, overrides and locked versions
+// for a root that differs only by case from one the root project imports, and
+// the constraints of dependencies on such roots, apply to the root as it is
+// imported. As the Go toolchain rejects imports of packages whose paths differ
+// only by case, projects that import different case variants of a root
+// conflict, and are reported as such.
+func CanonicalProjectRoot(pr ProjectRoot) ProjectRoot {
+	host := string(pr)
+	if i := strings.IndexByte(host, '/'); i != -1 {
+		host = host[:i]
+	}
+	if !caseInsensitiveHosts[strings.ToLower(host)] {
+		return pr
+	}
+	return ProjectRoot(strings.ToLower(string(pr)))
+}
+
+// caseInsensitiveRoot returns the root of the import path, if it is on a host
+// whose repository paths are case-insensitive.
+func caseInsensitiveRoot(ip string) (ProjectRoot, bool) {
+	elems := strings.SplitN(ip, "/", 4)
+	if len(elems) < 3 || !caseInsensitiveHosts[strings.ToLower(elems[0])] {
+		return "", false
+	}
+	return ProjectRoot(strings.Join(elems[:3], "/")), true
+}
+
+// mergeCaseVariants moves the root's constraints, overrides and locked projects
+// on roots that differ only by case from the roots the root project imports, on
+// hosts whose repository paths are case-insensitive, onto the roots as they
+// are imported. A project whose import path changed case, as that of
+// github.com/sirupsen/logrus did, thereby keeps its constraints and locked
+// version.
+func (rd *rootdata) mergeCaseVariants() {
+	imported := make(map[ProjectRoot]ProjectRoot)
+	for _, ip := range rd.externalImportList(nil) {
+		if pr, ok := caseInsensitiveRoot(ip); ok {
+			imported[CanonicalProjectRoot(pr)] = pr
+		}
+	}
+	if len(imported) == 0 {
+		return
+	}
+
+	// as returns the root as imported that pr is a different case variant
+	// of, if there is one and nothing is recorded for it already.
+	as := func(pr ProjectRoot, recorded func(ProjectRoot) bool) (ProjectRoot, bool) {
+		to, has := imported[CanonicalProjectRoot(pr)]
+		if !has || to == pr || recorded(to) {
+			return "", false
+		}
+		return to, true
+	}
+	rekey := func(pc ProjectConstraints) ProjectConstraints {
+		out := make(ProjectConstraints, len(pc))
+		for pr, pp := range pc {
+			if to, ok := as(pr, func(to ProjectRoot) bool { _, has := pc[to]; return has }); ok {
+				pr = to
+			}
+			out[pr] = pp
+		}
+		return out
+	}
+	rd.rm.Deps = rekey(rd.rm.Deps)
+	rd.ovr = rekey(rd.ovr)
+
+	rlm := make(map[ProjectRoot]LockedProject, len(rd.rlm))
+	for pr, lp := range rd.rlm {
+		if to, ok := as(pr, func(to ProjectRoot) bool { _, has := rd.rlm[to]; return has }); ok {
+			id := lp.Ident()
+			id.ProjectRoot = to
+			pr, lp = to, NewLockedProject(id, lp.Version(), lp.Packages())
+		}
+		rlm[pr] = lp
+	}
+	rd.rlm = rlm
+
+	for _, set := range []map[ProjectRoot]struct{}{rd.chng, rd.keep} {
+		for pr := range set {
+			if to, ok := as(pr, func(to ProjectRoot) bool { _, has := set[to]; return has }); ok {
+				delete(set, pr)
+				set[to] = struct{}{}
+			}
+		}
+	}
+}
+
+// caseVariantConstraint returns the constraint among wcs on a root that
+// differs only by case from pr, on a host whose repository paths are
+// case-insensitive, as a constraint on pr.
+func caseVariantConstraint(wcs []workingConstraint, pr ProjectRoot) (workingConstraint, bool) {
+	if _, ok := caseInsensitiveRoot(string(pr)); !ok {
+		return workingConstraint{}, false
+	}
+	cpr := CanonicalProjectRoot(pr)
+	for _, wc := range wcs {
+		if wc.Ident.ProjectRoot != pr && CanonicalProjectRoot(wc.Ident.ProjectRoot) == cpr {
+			wc.Ident.ProjectRoot = pr
+			return wc, true
+		}
+	}
+	return workingConstraint{}, false
+}
+
+// repository returns the location of the repository from which the project is
+// retrieved by default - the host and path of its first source URL, folded as
+// by CanonicalProjectRoot - if the SourceManager can deduce it.
+func (b *bridge) repository(id ProjectIdentifier) (string, bool) {
+	if repo, has := b.repos[id.ProjectRoot]; has {
+		return repo, repo != ""
+	}
+
+	b.s.mtr.pushSource("b-source-urls", id)
+	urls, err := b.sm.SourceURLsForPath(string(id.ProjectRoot))
+	b.s.mtr.pop()
+	var repo string
+	if err == nil && len(urls) > 0 {
+		repo = strings.TrimSuffix(strings.TrimSuffix(urls[0].Host+urls[0].Path, "/"), ".git")
+		repo = string(CanonicalProjectRoot(ProjectRoot(repo)))
+	}
+	b.repos[id.ProjectRoot] = repo
+	return repo, repo != ""
+}
+
+// checkRepositoryNotShared ensures that no project already selected at a
+// different revision is retrieved from the same repository as the atom, as
+// happens when a project is imported both by a vanity import path and by the
+// path of its repository. Both copies of the repository's code would be built.
+// Projects with an explicit source are not considered.
+func (s *solver) checkRepositoryNotShared(pa atom) error {
+	r, ok := revisionOf(pa.v)
+	if !ok || pa.id.Source != "" {
+		return nil
+	}
+	repo, ok := s.b.repository(pa.id)
+	if !ok {
+		return nil
+	}
+
+	for _, sel := range s.sel.projects {
+		other := sel.a.a
+		if !sel.first || other.id.ProjectRoot == pa.id.ProjectRoot || other.id.Source != "" || s.rd.isRoot(other.id.ProjectRoot) {
+			continue
+		}
+		if orepo, ok := s.b.repository(other.id); !ok || orepo != repo {
+			continue
+		}
+		if or, ok := revisionOf(other.v); ok && or != r {
+			s.fail(other.id)
+			return &sharedRepositoryFailure{
+				goal:  pa,
+				other: other,
+				repo:  repo,
+			}
+		}
+	}
+	return nil
+}
+
+// revisionOf returns the revision underlying v, if it is a revision or paired
+// with one.
+func revisionOf(v Version) (Revision, bool) {
+	switch tv := v.(type) {
+	case Revision:
+		return tv, true
+	case PairedVersion:
+		return tv.Revision(), true
+	}
+	return "", false
+}
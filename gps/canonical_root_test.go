@@ -0,0 +1,120 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+func TestCanonicalProjectRoot(t *testing.T) {
+	for in, want := range map[ProjectRoot]ProjectRoot{
+		"github.com/Sirupsen/logrus": "github.com/sirupsen/logrus",
+		"GitHub.com/Foo/Bar":         "github.com/foo/bar",
+		"bitbucket.org/Foo/Bar":      "bitbucket.org/foo/bar",
+		"golang.org/x/Net":           "golang.org/x/Net",
+		"example.com/Foo":            "example.com/Foo",
+	} {
+		if got := CanonicalProjectRoot(in); got != want {
+			t.Errorf("expected %s to canonicalize to %s, got %s", in, want, got)
+		}
+	}
+}
+
+// rootImporting returns a root package tree whose only package imports the
+// given paths.
+func rootImporting(imports ...string) pkgtree.PackageTree {
+	return pkgtree.PackageTree{
+		ImportRoot: "root",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"root": {P: pkgtree.Package{ImportPath: "root", Name: "root", Imports: imports}},
+		},
+	}
+}
+
+func TestCaseVariantRootSolve(t *testing.T) {
+	ds := []depspec{
+		mkDepspec("root 0.0.0"),
+		mkDepspec("github.com/sirupsen/logrus 1.0.0"),
+		mkDepspec("github.com/sirupsen/logrus 1.1.0"),
+		mkDepspec("github.com/sirupsen/logrus 2.0.0"),
+	}
+
+	// The root's constraint and lock were recorded under the old casing of
+	// the root it now imports, and still apply to it.
+	params := SolveParameters{
+		RootDir:         "root",
+		RootPackageTree: rootImporting("github.com/sirupsen/logrus"),
+		Manifest: simpleRootManifest{c: ProjectConstraints{
+			"github.com/Sirupsen/logrus": {Constraint: mkSVC("^1.0.0")},
+		}},
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	for _, lock := range []Lock{nil, fixLock{mklp("github.com/Sirupsen/logrus 1.0.0")}} {
+		params.Lock = lock
+		soln, err := fixSolve(params, newdepspecSM(ds, nil), t)
+		if err != nil {
+			t.Fatalf("expected the case variants to be merged, got %v", err)
+		}
+
+		want := "1.1.0"
+		if lock != nil {
+			want = "1.0.0"
+		}
+		lps := soln.Projects()
+		if len(lps) != 1 || lps[0].Ident().ProjectRoot != "github.com/sirupsen/logrus" || lps[0].Version().String() != want {
+			t.Errorf("expected github.com/sirupsen/logrus at %s alone, got %v", want, lps)
+		}
+	}
+}
+
+// repoSM is a depspecSourceManager whose projects are retrieved from the
+// repositories given for them.
+type repoSM struct {
+	*depspecSourceManager
+	repos map[string]string
+}
+
+func (sm repoSM) SourceURLsForPath(ip string) ([]*url.URL, error) {
+	u, err := url.Parse("https://" + sm.repos[ip] + ".git")
+	if err != nil {
+		return nil, err
+	}
+	return []*url.URL{u}, nil
+}
+
+func TestSharedRepositoryFailure(t *testing.T) {
+	repos := map[string]string{
+		"vanity.org/foo":   "github.com/o/foo",
+		"github.com/o/foo": "github.com/O/foo",
+	}
+	solve := func(ds ...depspec) error {
+		params := SolveParameters{
+			RootDir:         "root",
+			RootPackageTree: rootImporting("vanity.org/foo", "github.com/o/foo"),
+			Manifest:        simpleRootManifest{},
+			ProjectAnalyzer: naiveAnalyzer{},
+		}
+		_, err := fixSolve(params, repoSM{newdepspecSM(append([]depspec{mkDepspec("root 0.0.0")}, ds...), nil), repos}, t)
+		return err
+	}
+
+	// Both roots at the same revision are the same code.
+	if err := solve(mkDepspec("vanity.org/foo 1.0.0 rev1"), mkDepspec("github.com/o/foo 1.0.0 rev1")); err != nil {
+		t.Errorf("expected roots sharing a repository at one revision to solve, got %v", err)
+	}
+
+	err := solve(mkDepspec("vanity.org/foo 1.0.0 rev1"), mkDepspec("github.com/o/foo 2.0.0 rev2"))
+	sf, ok := err.(*SolveFailure)
+	if !ok {
+		t.Fatalf("expected roots sharing a repository at different revisions to fail with a *SolveFailure, got %v", err)
+	}
+	if !strings.Contains(sf.String(), "same repository, github.com/o/foo") {
+		t.Errorf("expected the failure to name the shared repository, got:\n%s", sf)
+	}
+}
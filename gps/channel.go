@@ -0,0 +1,352 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/gps/internal/pb"
+	"github.com/pkg/errors"
+)
+
+// ReleaseChannel is a named stream of a project's releases, such as its stable
+// or its beta releases, defined by which of the project's tags and branches
+// belong to it. A constraint to a channel, made by NewChannelConstraint,
+// follows the newest version in the channel, whatever it is called.
+type ReleaseChannel struct {
+	Name string
+	// Releases and Prereleases put every tag that is a semantic version in
+	// the channel: those without a prerelease suffix, and those with one,
+	// respectively.
+	Releases    bool
+	Prereleases bool
+	// Tags holds patterns, in the syntax of path.Match, of the names of
+	// further tags in the channel, such as "v*-beta.*".
+	Tags []string
+	// Branch is the name of a branch in the channel, if any, and
+	// DefaultBranch puts the source's default branch in the channel,
+	// whatever it is called.
+	Branch        string
+	DefaultBranch bool
+}
+
+// The channels that are defined for every project.
+var defaultChannels = []ReleaseChannel{
+	{Name: "stable", Releases: true},
+	{Name: "beta", Releases: true, Prereleases: true},
+	{Name: "nightly", DefaultBranch: true},
+}
+
+// DefaultReleaseChannel returns the channel of the provided name that is
+// defined for every project, and whether there is one: "stable", made up of
+// the semver releases, "beta", which adds the semver prereleases to them, and
+// "nightly", which is the default branch.
+func DefaultReleaseChannel(name string) (ReleaseChannel, bool) {
+	for _, ch := range defaultChannels {
+		if ch.Name == name {
+			ch.Tags = append([]string(nil), ch.Tags...)
+			return ch, true
+		}
+	}
+	return ReleaseChannel{}, false
+}
+
+// Validate reports whether the channel is well-formed: it has a name, its tag
+// patterns are valid, and it contains some kind of version.
+func (ch ReleaseChannel) Validate() error {
+	if ch.Name == "" {
+		return errors.New("release channel has no name")
+	}
+	for _, p := range ch.Tags {
+		if _, err := path.Match(p, ""); err != nil {
+			return errors.Errorf("invalid tag pattern %q in release channel %s", p, ch.Name)
+		}
+	}
+	if !ch.Releases && !ch.Prereleases && len(ch.Tags) == 0 && ch.Branch == "" && !ch.DefaultBranch {
+		return errors.Errorf("release channel %s contains no versions", ch.Name)
+	}
+	return nil
+}
+
+// Contains reports whether the version is in the channel. A bare revision is
+// in no channel, as which tags and branches it is on is not known.
+func (ch ReleaseChannel) Contains(v Version) bool {
+	if pv, ok := v.(PairedVersion); ok {
+		v = pv.Unpair()
+	}
+
+	switch tv := v.(type) {
+	case branchVersion:
+		return (ch.DefaultBranch && tv.isDefault) || (ch.Branch != "" && tv.name == ch.Branch)
+	case semVersion:
+		if tv.sv.Prerelease() == "" && ch.Releases || tv.sv.Prerelease() != "" && ch.Prereleases {
+			return true
+		}
+		return ch.matchesTag(tv.String())
+	case plainVersion:
+		return ch.matchesTag(string(tv))
+	}
+	return false
+}
+
+func (ch ReleaseChannel) matchesTag(name string) bool {
+	for _, p := range ch.Tags {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (ch ReleaseChannel) identical(ch2 ReleaseChannel) bool {
+	if ch.Name != ch2.Name || ch.Releases != ch2.Releases || ch.Prereleases != ch2.Prereleases ||
+		ch.Branch != ch2.Branch || ch.DefaultBranch != ch2.DefaultBranch || len(ch.Tags) != len(ch2.Tags) {
+		return false
+	}
+	for i, p := range ch.Tags {
+		if p != ch2.Tags[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ChannelVersions lists the versions of the project that are in the channel,
+// newest first, in the order in which the solver tries them for a project
+// that the root project constrains to the channel.
+func ChannelVersions(sm SourceManager, id ProjectIdentifier, ch ReleaseChannel) ([]PairedVersion, error) {
+	pvl, err := sm.ListVersions(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var in []Version
+	for _, pv := range pvl {
+		if ch.Contains(pv) {
+			in = append(in, pv)
+		}
+	}
+	SortForUpgrade(in)
+	sortForChannel(in, ch, false)
+
+	out := make([]PairedVersion, len(in))
+	for i, v := range in {
+		out[i] = v.(PairedVersion)
+	}
+	return out, nil
+}
+
+// sortForChannel reorders vl, already sorted by SortForUpgrade or
+// SortForDowngrade as down indicates, to put the versions in the channel
+// first. Unlike either sort, the semantic versions in the channel are ordered
+// by version alone, prereleases among releases, as following the newest
+// version in a channel is the point of subscribing to one that has
+// prereleases.
+func sortForChannel(vl []Version, ch ReleaseChannel, down bool) {
+	sort.SliceStable(vl, func(i, j int) bool {
+		return ch.Contains(vl[i]) && !ch.Contains(vl[j])
+	})
+
+	var idx []int
+	var svl []Version
+	for i, v := range vl {
+		if !ch.Contains(v) {
+			break
+		}
+		if _, ok := semverOf(v); ok {
+			idx = append(idx, i)
+			svl = append(svl, v)
+		}
+	}
+	sort.SliceStable(svl, func(i, j int) bool {
+		l, _ := semverOf(svl[i])
+		r, _ := semverOf(svl[j])
+		if down {
+			return l.LessThan(r)
+		}
+		return r.LessThan(l)
+	})
+	for k, i := range idx {
+		vl[i] = svl[k]
+	}
+}
+
+// NewChannelConstraint returns a Constraint that admits the versions in the
+// channel.
+//
+// Whether the channel's prereleases are admitted is up to the channel alone:
+// where the constraint is intersected with semver ranges, they are narrowed
+// to the versions in the range, as the prerelease policy in effect would
+// otherwise leave out the very prereleases the channel was chosen for.
+func NewChannelConstraint(ch ReleaseChannel) Constraint {
+	return channelConstraint{chans: []ReleaseChannel{ch}, within: any}
+}
+
+// ChannelOf returns the channel to which c constrains, if c was made by
+// NewChannelConstraint and has not been narrowed since.
+func ChannelOf(c Constraint) (ReleaseChannel, bool) {
+	cc, ok := c.(channelConstraint)
+	if !ok || len(cc.chans) != 1 || !IsAny(cc.within) {
+		return ReleaseChannel{}, false
+	}
+	return cc.chans[0], true
+}
+
+// channelConstraint admits the versions that are in all of its channels, and
+// admitted by within.
+type channelConstraint struct {
+	chans  []ReleaseChannel
+	within Constraint
+}
+
+func (c channelConstraint) names() string {
+	s := make([]string, len(c.chans))
+	for i, ch := range c.chans {
+		s[i] = ch.Name
+	}
+	return strings.Join(s, " and ")
+}
+
+func (c channelConstraint) String() string {
+	if IsAny(c.within) {
+		return c.names() + " channel"
+	}
+	return c.names() + " channel, " + c.within.String()
+}
+
+func (c channelConstraint) ImpliedCaretString() string {
+	if IsAny(c.within) {
+		return c.names() + " channel"
+	}
+	return c.names() + " channel, " + c.within.ImpliedCaretString()
+}
+
+func (c channelConstraint) typedString() string {
+	s := make([]string, len(c.chans))
+	for i, ch := range c.chans {
+		s[i] = fmt.Sprintf("%+v", ch)
+	}
+	return "chan-" + strings.Join(s, " and ") + " within " + c.within.typedString()
+}
+
+func (c channelConstraint) Matches(v Version) bool {
+	for _, ch := range c.chans {
+		if !ch.Contains(v) {
+			return false
+		}
+	}
+	return c.within.Matches(v)
+}
+
+func (c channelConstraint) MatchesAny(c2 Constraint) bool {
+	return c.Intersect(c2) != none
+}
+
+// Intersect narrows the constraint to what c2 also admits. Whether two
+// channels have any versions in common, or a channel any versions in a semver
+// range, depends on the versions a source has, so only intersections with
+// discrete versions are ever known to come to nothing.
+func (c channelConstraint) Intersect(c2 Constraint) Constraint {
+	switch tc := c2.(type) {
+	case anyConstraint:
+		return c
+	case noneConstraint:
+		return none
+	case unionConstraint, exclusionConstraint:
+		return tc.Intersect(c)
+	case channelConstraint:
+		chans := append([]ReleaseChannel(nil), c.chans...)
+	outer:
+		for _, ch := range tc.chans {
+			for _, have := range chans {
+				if have.identical(ch) {
+					continue outer
+				}
+			}
+			chans = append(chans, ch)
+		}
+		return narrowChannels(chans, c.within.Intersect(tc.within))
+	case Version:
+		if c.Matches(tc) {
+			return tc
+		}
+		return none
+	}
+	return narrowChannels(c.chans, c.within.Intersect(c2))
+}
+
+// narrowChannels returns the constraint admitting what is in all of chans and
+// also admitted by within.
+func narrowChannels(chans []ReleaseChannel, within Constraint) Constraint {
+	switch tw := within.(type) {
+	case noneConstraint:
+		return none
+	case Version:
+		return channelConstraint{chans: chans, within: any}.Intersect(tw)
+	}
+	return channelConstraint{chans: chans, within: WithPrereleasePolicy(within, AllowPrereleases)}
+}
+
+func (c channelConstraint) identical(c2 Constraint) bool {
+	cc2, ok := c2.(channelConstraint)
+	if !ok || len(c.chans) != len(cc2.chans) || !c.within.identical(cc2.within) {
+		return false
+	}
+	for i, ch := range c.chans {
+		if !ch.identical(cc2.chans[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// copyTo serializes the constraint with within as its first member, followed
+// by a member for each channel, whose value is the channel's JSON encoding.
+func (c channelConstraint) copyTo(msg *pb.Constraint) {
+	msg.Type = pb.Constraint_Channel
+	msg.Value = c.String()
+	msg.Members = make([]*pb.Constraint, 0, len(c.chans)+1)
+
+	wm := &pb.Constraint{}
+	if IsAny(c.within) {
+		wm.Type = pb.Constraint_Any
+	} else {
+		c.within.copyTo(wm)
+	}
+	msg.Members = append(msg.Members, wm)
+
+	for _, ch := range c.chans {
+		data, _ := json.Marshal(ch)
+		msg.Members = append(msg.Members, &pb.Constraint{Type: pb.Constraint_Channel, Value: string(data)})
+	}
+}
+
+// channelConstraintFromCache reverses channelConstraint.copyTo.
+func channelConstraintFromCache(m *pb.Constraint) (Constraint, error) {
+	if len(m.Members) < 2 {
+		return nil, fmt.Errorf("channel Constraint has no channels: %#v", m)
+	}
+	within, err := constraintFromCache(m.Members[0])
+	if err != nil {
+		return nil, err
+	}
+
+	chans := make([]ReleaseChannel, len(m.Members)-1)
+	for i, cm := range m.Members[1:] {
+		if err := json.Unmarshal([]byte(cm.Value), &chans[i]); err != nil {
+			return nil, errors.Wrapf(err, "invalid channel in Constraint: %#v", m)
+		}
+	}
+	if IsAny(within) {
+		return channelConstraint{chans: chans, within: any}, nil
+	}
+	// The prerelease policy of within is not serialized, so it is restored by
+	// narrowing.
+	return narrowChannels(chans, within), nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"testing"
+
+	"github.com/golang/dep/gps/internal/pb"
+)
+
+func TestReleaseChannelContains(t *testing.T) {
+	stable, _ := DefaultReleaseChannel("stable")
+	beta, _ := DefaultReleaseChannel("beta")
+	nightly, _ := DefaultReleaseChannel("nightly")
+	rc := ReleaseChannel{Name: "rc", Tags: []string{"v*-rc.*", "candidate-*"}, Branch: "release"}
+	rev := Revision("69e6f2a3a2ef4a5e8a0b9fce8d5f5a3e0b2c1d4e")
+
+	for _, fix := range []struct {
+		v                           Version
+		stable, beta, nightly, inRC bool
+	}{
+		{NewVersion("v1.0.0"), true, true, false, false},
+		{NewVersion("v1.0.0").Pair(rev), true, true, false, false},
+		{NewVersion("v1.1.0-beta.1"), false, true, false, false},
+		{NewVersion("v1.1.0-rc.1"), false, true, false, true},
+		{NewVersion("candidate-3"), false, false, false, true},
+		{NewBranch("release"), false, false, false, true},
+		{newDefaultBranch("master"), false, false, true, false},
+		{NewBranch("master"), false, false, false, false},
+		{rev, false, false, false, false},
+	} {
+		for _, c := range []struct {
+			ch   ReleaseChannel
+			want bool
+		}{
+			{stable, fix.stable},
+			{beta, fix.beta},
+			{nightly, fix.nightly},
+			{rc, fix.inRC},
+		} {
+			if got := c.ch.Contains(fix.v); got != c.want {
+				t.Errorf("expected %s to be in the %s channel to be %v", fix.v, c.ch.Name, c.want)
+			}
+		}
+	}
+
+	if _, has := DefaultReleaseChannel("canary"); has {
+		t.Error("expected no default canary channel")
+	}
+	if err := (ReleaseChannel{Name: "bad", Tags: []string{"v[1"}}).Validate(); err == nil {
+		t.Error("expected an invalid tag pattern to be rejected")
+	}
+	if err := (ReleaseChannel{Name: "empty"}).Validate(); err == nil {
+		t.Error("expected a channel with no versions to be rejected")
+	}
+	if err := rc.Validate(); err != nil {
+		t.Errorf("unexpected error validating channel: %v", err)
+	}
+}
+
+func TestChannelConstraintOps(t *testing.T) {
+	beta, _ := DefaultReleaseChannel("beta")
+	c := NewChannelConstraint(beta)
+	if c.String() != "beta channel" {
+		t.Errorf("unexpected string form of channel constraint: %q", c)
+	}
+	if ch, ok := ChannelOf(c); !ok || ch.Name != "beta" {
+		t.Errorf("expected the constraint to be to the beta channel, got %v", ch)
+	}
+
+	v1 := NewVersion("1.0.0")
+	pre := NewVersion("1.1.0-beta.1")
+	c1 := testSemverConstraint(t, "^1.0.0")
+	intersects := []struct {
+		c    Constraint
+		want Constraint
+	}{
+		{any, c},
+		{none, none},
+		{v1, v1},
+		{pre, pre},
+		{NewBranch("master"), none},
+		{testSemverConstraint(t, "^2.0.0"), narrowChannels([]ReleaseChannel{beta}, testSemverConstraint(t, "^2.0.0"))},
+		{Union(NewBranch("master"), v1), v1},
+	}
+	for _, i := range intersects {
+		if got := c.Intersect(i.c); !got.identical(i.want) {
+			t.Errorf("expected %q intersected with %q to be %q, got %q", c, i.c, i.want, got)
+		}
+		if got := i.c.Intersect(c); !got.identical(i.want) {
+			t.Errorf("expected %q intersected with %q to be %q, got %q", i.c, c, i.want, got)
+		}
+	}
+
+	// Narrowed to a range, the constraint still admits the channel's
+	// prereleases, though the range alone would not.
+	nc := c.Intersect(c1)
+	if c1.Matches(pre) || !nc.Matches(pre) || !nc.Matches(v1) || nc.Matches(NewVersion("2.0.0")) {
+		t.Errorf("expected %q to admit the prereleases in the range", nc)
+	}
+	if _, ok := ChannelOf(nc); ok {
+		t.Error("expected a narrowed channel constraint not to be reported as a plain channel")
+	}
+
+	stable, _ := DefaultReleaseChannel("stable")
+	both := nc.Intersect(NewChannelConstraint(stable))
+	if both.Matches(pre) || !both.Matches(v1) {
+		t.Errorf("expected %q to admit only the versions in both channels", both)
+	}
+	if !IsSubsetOf(nc, WithPrereleasePolicy(c1, AllowPrereleases)) || IsSubsetOf(c, c1) {
+		t.Error("expected a channel constraint to be a subset of the range it is narrowed to, and no other")
+	}
+	if k := KindOf(c); k != ConstraintChannel {
+		t.Errorf("expected a channel constraint to be of kind channel, got %s", k)
+	}
+
+	for _, orig := range []Constraint{c, nc, both} {
+		msg := &pb.Constraint{}
+		orig.copyTo(msg)
+		back, err := constraintFromCache(msg)
+		if err != nil {
+			t.Fatalf("unexpected error restoring %q from cache: %v", orig, err)
+		}
+		if !back.identical(orig) {
+			t.Errorf("expected %q to survive a round trip through the cache, got %q", orig, back)
+		}
+	}
+}
+
+func TestChannelSolve(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0-beta.1"),
+			mkDepspec("a bdevelop"),
+			mkDepspec("b 1.0.0"),
+			mkDepspec("b bdevelop"),
+		},
+		r: mksolution("a 1.1.0-beta.1", "b bdevelop"),
+	}
+	beta, _ := DefaultReleaseChannel("beta")
+	fix.ds[0].deps[0].Constraint = NewChannelConstraint(beta)
+	fix.ds[0].deps[1].Constraint = NewChannelConstraint(ReleaseChannel{Name: "edge", Branch: "develop"})
+
+	sm := newdepspecSM(fix.ds, nil)
+	soln, err := fixSolve(basicFixtureParams(fix), sm, t)
+	fixtureSolveSimpleChecks(fix, soln, err, t)
+
+	pvl, err := ChannelVersions(sm, mkPI("a"), beta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvl) != 2 || pvl[0].Unpair().String() != "1.1.0-beta.1" {
+		t.Errorf("expected the beta channel of a to be headed by its prerelease, got %v", pvl)
+	}
+}
@@ -23,8 +23,10 @@ type cmd struct {
 	Cmd *exec.Cmd
 }
 
-func commandContext(ctx context.Context, name string, arg ...string) cmd {
+func commandContext(ctx context.Context, venv vcsEnv, name string, arg ...string) cmd {
+	arg, env := hermeticCommand(venv, name, arg)
 	c := exec.Command(name, arg...)
+	c.Env = env
 
 	// Force subprocesses into their own process group, rather than being in the
 	// same process group as the dep process. Because Ctrl-C sent from a
@@ -13,6 +13,9 @@ type cmd struct {
 	*exec.Cmd
 }
 
-func commandContext(ctx context.Context, name string, arg ...string) cmd {
-	return cmd{Cmd: exec.CommandContext(ctx, name, arg...)}
+func commandContext(ctx context.Context, venv vcsEnv, name string, arg ...string) cmd {
+	arg, env := hermeticCommand(venv, name, arg)
+	c := exec.CommandContext(ctx, name, arg...)
+	c.Env = env
+	return cmd{Cmd: c}
 }
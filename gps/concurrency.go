@@ -0,0 +1,234 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// initialHostLimit is the number of concurrent network operations
+	// initially permitted against each host.
+	initialHostLimit = 4
+	// slowFactor is how many times slower than the fastest observed operation
+	// of the same type an operation must be before it is taken as a sign that
+	// the host is overloaded.
+	slowFactor = 3
+)
+
+// HostConcurrency describes the adaptive concurrency limit for network
+// operations against a single host, and the observations on which it is based.
+type HostConcurrency struct {
+	// Limit is the current maximum number of concurrent operations.
+	Limit int
+	// Peak is the highest number of operations that have been in flight at
+	// once.
+	Peak int
+	// Successes and Failures are the number of operations that have completed
+	// without and with an error, respectively.
+	Successes, Failures int
+	// Decreases is the number of times the limit has been cut back.
+	Decreases int
+	// MeanLatency is the mean duration of all completed operations.
+	MeanLatency time.Duration
+}
+
+// hostLimiter applies AIMD-style concurrency limits to network operations on a
+// per-host basis. Each host's limit grows by one after a full limit's worth of
+// consecutive prompt, successful operations, and is halved whenever an
+// operation fails or is unusually slow.
+type hostLimiter struct {
+	max   int
+	mu    sync.Mutex
+	hosts map[string]*aimdLimiter
+}
+
+func newHostLimiter(max int) *hostLimiter {
+	return &hostLimiter{
+		max:   max,
+		hosts: make(map[string]*aimdLimiter),
+	}
+}
+
+// destHost returns the host against whose limit an operation on dest counts.
+// Destinations that are not URLs with a host, such as scp-style git remotes,
+// are limited on their own.
+func destHost(dest string) string {
+	if u, err := url.Parse(dest); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return dest
+}
+
+// limitNetwork wraps f so that each invocation is subject to the concurrency
+// limit for dest's host in hl, if it is not nil, and informs that limit with
+// its latency and outcome.
+func limitNetwork(hl *hostLimiter, dest string, typ callType, f func(context.Context) error) func(context.Context) error {
+	if hl == nil {
+		return f
+	}
+	return func(ctx context.Context) error {
+		l := hl.forHost(destHost(dest))
+		if err := l.acquire(ctx); err != nil {
+			return err
+		}
+		start := time.Now()
+		err := f(ctx)
+		l.release(typ, time.Since(start), err != nil)
+		return err
+	}
+}
+
+// networkOp wraps f, an operation of the given type against dest, with the
+// timeouts and retries, network auditing and adaptive concurrency limiting of
+// the settings, and prevents it from running at all when they are offline.
+// Each attempt is audited and limited on its own.
+func networkOp(ss sourceSettings, dest string, typ callType, f func(context.Context) error) func(context.Context) error {
+	f = limitNetwork(ss.limiter, dest, typ, f)
+	f = auditNetwork(ss.audit, dest, typ, f)
+	f = retryNetwork(ss.network, dest, typ, f)
+	return offlineGuard(ss.offline, dest, typ, f)
+}
+
+// networkGuardingSource is implemented by sources that wrap each of their own
+// requests with networkOp, around which a sourceGateway must not wrap its
+// operations again.
+type networkGuardingSource interface {
+	guardsOwnNetworkOps() bool
+}
+
+func (hl *hostLimiter) forHost(host string) *aimdLimiter {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	l, has := hl.hosts[host]
+	if !has {
+		limit := initialHostLimit
+		if limit > hl.max {
+			limit = hl.max
+		}
+		l = &aimdLimiter{
+			max:     hl.max,
+			limit:   limit,
+			fastest: make(map[callType]time.Duration),
+			wake:    make(chan struct{}),
+		}
+		hl.hosts[host] = l
+	}
+	return l
+}
+
+// stats returns a snapshot of the limits for all hosts seen so far.
+func (hl *hostLimiter) stats() map[string]HostConcurrency {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	stats := make(map[string]HostConcurrency, len(hl.hosts))
+	for host, l := range hl.hosts {
+		stats[host] = l.stats()
+	}
+	return stats
+}
+
+// aimdLimiter is the concurrency limit for a single host.
+type aimdLimiter struct {
+	max int
+
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	// The number of consecutive good operations since the limit last changed.
+	streak int
+	// The fastest observed duration of each type of operation, against which
+	// the responsiveness of later operations is judged.
+	fastest map[callType]time.Duration
+	// Closed and replaced whenever capacity may have become available.
+	wake chan struct{}
+
+	peak, successes, failures, decreases int
+	total                                time.Duration
+}
+
+// acquire blocks until an operation may proceed under the current limit, or
+// the context is canceled.
+func (l *aimdLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	for l.inflight >= l.limit {
+		wake := l.wake
+		l.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		l.mu.Lock()
+	}
+
+	l.inflight++
+	if l.inflight > l.peak {
+		l.peak = l.inflight
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+// release records the outcome of an operation that was permitted by acquire,
+// and adjusts the limit accordingly.
+func (l *aimdLimiter) release(typ callType, d time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	l.total += d
+	if failed {
+		l.failures++
+	} else {
+		l.successes++
+	}
+
+	fastest, seen := l.fastest[typ]
+	slow := seen && d > slowFactor*fastest
+	if !failed && (!seen || d < fastest) {
+		l.fastest[typ] = d
+	}
+
+	switch {
+	case failed || slow:
+		if l.limit > 1 {
+			l.limit /= 2
+			l.decreases++
+		}
+		l.streak = 0
+	case l.limit < l.max:
+		l.streak++
+		if l.streak >= l.limit {
+			l.limit++
+			l.streak = 0
+		}
+	}
+
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+func (l *aimdLimiter) stats() HostConcurrency {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hc := HostConcurrency{
+		Limit:     l.limit,
+		Peak:      l.peak,
+		Successes: l.successes,
+		Failures:  l.failures,
+		Decreases: l.decreases,
+	}
+	if n := l.successes + l.failures; n > 0 {
+		hc.MeanLatency = l.total / time.Duration(n)
+	}
+	return hc
+}
@@ -0,0 +1,173 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Requirement is a constraint that a project imposes on one of its
+// dependencies.
+type Requirement struct {
+	// By is the project that imposes the requirement, and Version the version
+	// of it that was selected. Version is nil for the root project.
+	By      ProjectIdentifier
+	Version Version
+	// On is the dependency that the requirement is imposed on.
+	On ProjectRoot
+	// Constraint is the constraint that By imposes on On.
+	Constraint Constraint
+}
+
+func (r Requirement) String() string {
+	return fmt.Sprintf("%s: %s from %s", r.On, r.Constraint, a2vs(atom{id: r.By, v: r.Version}))
+}
+
+// Minimize narrows the requirements behind the failure down to a minimal set
+// whose conflict still causes it, and records them in Minimal, so that String
+// only reports those. The candidates are the requirements in Constraints; the
+// solve is repeated with params and sm, once for each candidate, with that
+// candidate and those already found to be unnecessary relaxed to Any().
+// Relaxing a requirement relaxes it at every version of the project imposing
+// it.
+//
+// Requirements outside Constraints are left as they are, so the conflict is
+// only minimal among the candidates. If the failure persists with every
+// candidate relaxed, Minimal is left empty.
+func (e *SolveFailure) Minimize(ctx context.Context, params SolveParameters, sm SourceManager) error {
+	// Tracing every repeated solve would bury the trace of the original, and
+	// reporting them would skew the telemetry.
+	params.TraceLogger = nil
+	params.Telemetry = nil
+
+	fails := func(relaxed []Requirement) (bool, error) {
+		s, err := Prepare(params, sm)
+		if err != nil {
+			return false, err
+		}
+		slv, ok := s.(*solver)
+		if !ok {
+			return false, errors.Errorf("conflicts cannot be minimized with the %s solver", s.Name())
+		}
+		slv.relaxed = make(map[ProjectRoot]map[ProjectRoot]bool)
+		for _, r := range relaxed {
+			if slv.relaxed[r.By.ProjectRoot] == nil {
+				slv.relaxed[r.By.ProjectRoot] = make(map[ProjectRoot]bool)
+			}
+			slv.relaxed[r.By.ProjectRoot][r.On] = true
+		}
+
+		_, err = slv.Solve(ctx)
+		if _, ok := err.(*SolveFailure); ok {
+			return true, nil
+		}
+		return false, err
+	}
+
+	var relaxed, min []Requirement
+	for _, r := range e.requirements() {
+		failed, err := fails(append(relaxed[:len(relaxed):len(relaxed)], r))
+		if err != nil {
+			return err
+		}
+		if failed {
+			relaxed = append(relaxed, r)
+		} else {
+			min = append(min, r)
+		}
+	}
+	e.Minimal = min
+	return nil
+}
+
+// requirements returns the distinct requirements in the failure's Constraints,
+// along with those of the rejected versions of Project that conflicted with
+// them, sorted by the dependency they are imposed on and then the project
+// imposing them.
+func (e *SolveFailure) requirements() []Requirement {
+	type key struct{ by, on ProjectRoot }
+	seen := make(map[key]bool)
+	var reqs []Requirement
+	add := func(r Requirement) {
+		k := key{by: r.By.ProjectRoot, on: r.On}
+		if !seen[k] {
+			seen[k] = true
+			reqs = append(reqs, r)
+		}
+	}
+
+	var walk func(on ProjectRoot, ics []ImposedConstraint)
+	walk = func(on ProjectRoot, ics []ImposedConstraint) {
+		for _, ic := range ics {
+			add(Requirement{
+				By:         ic.By,
+				Version:    ic.Version,
+				On:         on,
+				Constraint: ic.Constraint,
+			})
+			walk(ic.By.ProjectRoot, ic.Dependers)
+		}
+	}
+	for on, ics := range e.Constraints {
+		walk(on, ics)
+	}
+	for _, r := range rejectedRequirements(e.err) {
+		add(r)
+	}
+
+	sort.Slice(reqs, func(i, j int) bool {
+		if reqs[i].On != reqs[j].On {
+			return reqs[i].On < reqs[j].On
+		}
+		return reqs[i].By.Less(reqs[j].By)
+	})
+	return reqs
+}
+
+// rejectedRequirements returns the requirements for which err reports that
+// versions of a project were rejected, as they conflicted with the projects
+// already selected.
+func rejectedRequirements(err error) []Requirement {
+	var goal dependency
+	switch e := err.(type) {
+	case *noVersionError:
+		var reqs []Requirement
+		for _, f := range e.fails {
+			reqs = append(reqs, rejectedRequirements(f.f)...)
+		}
+		return reqs
+	case *disjointConstraintFailure:
+		goal = e.goal
+	case *constraintNotAllowedFailure:
+		goal = e.goal
+	default:
+		return nil
+	}
+	return []Requirement{{
+		By:         goal.depender.id,
+		Version:    goal.depender.v,
+		On:         goal.dep.Ident.ProjectRoot,
+		Constraint: goal.dep.Constraint,
+	}}
+}
+
+// relax replaces the constraints in wcs that the project imposes, and that have
+// been relaxed while minimizing a conflict, with Any().
+func (s *solver) relax(by ProjectRoot, wcs []workingConstraint) []workingConstraint {
+	relaxed := s.relaxed[by]
+	if len(relaxed) == 0 {
+		return wcs
+	}
+	for i := range wcs {
+		if relaxed[wcs[i].Ident.ProjectRoot] {
+			wcs[i].Constraint = Any()
+		}
+	}
+	return wcs
+}
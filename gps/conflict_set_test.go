@@ -0,0 +1,63 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSolveFailureMinimize(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a 1.0.0", "b 1.0.0", "d *"),
+			mkDepspec("a 1.0.0", "c ^1.0.0"),
+			mkDepspec("a 2.0.0", "c ^2.0.0"),
+			mkDepspec("b 1.0.0", "c ^2.0.0"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("c 2.0.0"),
+			mkDepspec("d 1.0.0", "c *"),
+		},
+	}
+	params := basicFixtureParams(fix)
+	sm := newdepspecSM(fix.ds, nil)
+
+	_, err := fixSolve(params, sm, t)
+	sf, ok := err.(*SolveFailure)
+	if !ok {
+		t.Fatalf("expected a *SolveFailure, got %T: %v", err, err)
+	}
+	// Repeat the solves as fixSolve does.
+	params.stdLibFn = func(string) bool { return false }
+	params.mkBridgeFn = overrideMkBridge
+	if err = sf.Minimize(context.Background(), params, sm); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a@2.0.0 would agree with b about c, so the root's requirement of
+	// a@1.0.0 is part of the conflict; its requirement of b is not, as there
+	// is no other version of b to fall back on. Neither is d's requirement of
+	// c, which admits any version.
+	want := []string{
+		"a: 1.0.0 from (root)",
+		"c: ^1.0.0 from a@1.0.0",
+		"c: ^2.0.0 from b@1.0.0",
+	}
+	if len(sf.Minimal) != len(want) {
+		t.Fatalf("expected minimal requirements %q, got %v", want, sf.Minimal)
+	}
+	for i, r := range sf.Minimal {
+		if r.String() != want[i] {
+			t.Errorf("expected minimal requirements %q, got %v", want, sf.Minimal)
+			break
+		}
+	}
+
+	got := sf.String()
+	if !strings.HasSuffix(got, "\n\nConflicting requirements:\n  "+strings.Join(want, "\n  ")) || strings.Contains(got, "Constraints on") {
+		t.Errorf("expected only the minimal requirements to be rendered, got:\n%s", got)
+	}
+}
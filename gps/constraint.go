@@ -5,6 +5,7 @@
 package gps
 
 import (
+	"encoding"
 	"fmt"
 	"sort"
 
@@ -26,6 +27,10 @@ var (
 type Constraint interface {
 	fmt.Stringer
 
+	// MarshalText returns the canonical text form of the Constraint, from
+	// which UnmarshalConstraint makes an identical one.
+	encoding.TextMarshaler
+
 	// ImpliedCaretString converts the Constraint to a string in the same manner
 	// as String(), but treats the empty operator as equivalent to ^, rather
 	// than =.
@@ -80,12 +85,45 @@ func constraintFromCache(m *pb.Constraint) (Constraint, error) {
 		return plainVersion(m.Value), nil
 	case pb.Constraint_Semver:
 		return NewSemverConstraint(m.Value)
+	case pb.Constraint_Any:
+		return any, nil
+	case pb.Constraint_Union:
+		cs, err := constraintsFromCache(m.Members)
+		if err != nil {
+			return nil, err
+		}
+		return Union(cs...), nil
+	case pb.Constraint_Exclusion:
+		cs, err := constraintsFromCache(m.Members)
+		if err != nil {
+			return nil, err
+		}
+		if len(cs) == 0 {
+			return nil, fmt.Errorf("exclusion Constraint has no base: %#v", m)
+		}
+		return Exclude(cs[0], cs[1:]...), nil
+	case pb.Constraint_Channel:
+		return channelConstraintFromCache(m)
 
 	default:
 		return nil, fmt.Errorf("unrecognized Constraint type: %#v", m)
 	}
 }
 
+// constraintsFromCache returns the Constraints identical to those which
+// produced ms.
+func constraintsFromCache(ms []*pb.Constraint) ([]Constraint, error) {
+	cs := make([]Constraint, len(ms))
+	for i, m := range ms {
+		c, err := constraintFromCache(m)
+		if err != nil {
+			return nil, err
+		}
+		cs[i] = c
+	}
+	return cs, nil
+}
+
 // unpairedVersionFromCache returns an UnpairedVersion identical to the one which produced m.
 func unpairedVersionFromCache(m *pb.Constraint) (UnpairedVersion, error) {
 	switch m.Type {
@@ -110,12 +148,22 @@ func unpairedVersionFromCache(m *pb.Constraint) (UnpairedVersion, error) {
 // NewSemverConstraint attempts to construct a semver Constraint object from the
 // input string.
 //
+// The input may also be a constraint expression, combining semver constraints
+// with "&&", "||" and parentheses, such as "(^1.2.0 || ^2.0.0) && !=2.3.1".
+//
 // If the input string cannot be made into a valid semver Constraint, an error
 // is returned.
 func NewSemverConstraint(body string) (Constraint, error) {
+	if IsConstraintExpr(body) {
+		c, err := newConstraintExpr(body, false)
+		if err != nil {
+			return nil, &ConstraintError{Body: body, Err: err}
+		}
+		return c, nil
+	}
 	c, err := semver.NewConstraint(body)
 	if err != nil {
-		return nil, err
+		return nil, &ConstraintError{Body: body, Err: err}
 	}
 	// If we got a simple semver.Version, simplify by returning our
 	// corresponding type
@@ -130,12 +178,22 @@ func NewSemverConstraint(body string) (Constraint, error) {
 // differently, ^ is the default operator for NewSemverConstraintIC, while =
 // is the default operator for NewSemverConstraint.
 //
+// Constraint expressions are accepted as for NewSemverConstraint, with ^
+// likewise the default operator of each of their terms.
+//
 // If the input string cannot be made into a valid semver Constraint, an error
 // is returned.
 func NewSemverConstraintIC(body string) (Constraint, error) {
+	if IsConstraintExpr(body) {
+		c, err := newConstraintExpr(body, true)
+		if err != nil {
+			return nil, &ConstraintError{Body: body, Err: err}
+		}
+		return c, nil
+	}
 	c, err := semver.NewConstraintIC(body)
 	if err != nil {
-		return nil, err
+		return nil, &ConstraintError{Body: body, Err: err}
 	}
 	// If we got a simple semver.Version, simplify by returning our
 	// corresponding type
@@ -147,6 +205,18 @@ func NewSemverConstraintIC(body string) (Constraint, error) {
 
 type semverConstraint struct {
 	c semver.Constraint
+	// pre determines which prereleases the constraint admits, beyond those
+	// that c itself does.
+	pre PrereleasePolicy
+}
+
+// admits reports whether the constraint admits sv, under its prerelease
+// policy.
+func (c semverConstraint) admits(sv semver.Version) bool {
+	if c.c.Matches(sv) == nil {
+		return true
+	}
+	return sv.Prerelease() != "" && c.pre.admitsPrereleases(c.c) && admitsPrerelease(c.c, sv)
 }
 
 func (c semverConstraint) String() string {
@@ -164,16 +234,19 @@ func (c semverConstraint) ImpliedCaretString() string {
 }
 
 func (c semverConstraint) typedString() string {
+	if c.pre != ExcludePrereleases {
+		return fmt.Sprintf("svc-%s-pre-%s", c.c.String(), c.pre)
+	}
 	return fmt.Sprintf("svc-%s", c.c.String())
 }
 
 func (c semverConstraint) Matches(v Version) bool {
 	switch tv := v.(type) {
 	case semVersion:
-		return c.c.Matches(tv.sv) == nil
+		return c.admits(tv.sv)
 	case versionPair:
 		if tv2, ok := tv.v.(semVersion); ok {
-			return c.c.Matches(tv2.sv) == nil
+			return c.admits(tv2.sv)
 		}
 	}
 
@@ -188,23 +261,31 @@ func (c semverConstraint) Intersect(c2 Constraint) Constraint {
 	switch tc := c2.(type) {
 	case anyConstraint:
 		return c
+	case unionConstraint, exclusionConstraint, channelConstraint:
+		return tc.Intersect(c)
 	case semverConstraint:
 		rc := c.c.Intersect(tc.c)
 		if !semver.IsNone(rc) {
-			return semverConstraint{c: rc}
+			// Only what both admit is admitted, so the stricter policy of
+			// the two applies.
+			pre := c.pre
+			if tc.pre < pre {
+				pre = tc.pre
+			}
+			return semverConstraint{c: rc, pre: pre}
 		}
 	case semVersion:
-		rc := c.c.Intersect(tc.sv)
-		if !semver.IsNone(rc) {
-			// If single version intersected with constraint, we know the result
-			// must be the single version, so just return it back out
+		// If single version intersected with constraint, we know the result
+		// must be the single version, so just return it back out. Matches is
+		// used rather than Intersect, as the semver package's union
+		// constraints return any single version they're intersected with.
+		if c.admits(tc.sv) {
 			return c2
 		}
 	case versionPair:
 		if tc2, ok := tc.v.(semVersion); ok {
-			rc := c.c.Intersect(tc2.sv)
-			if !semver.IsNone(rc) {
-				// same reasoning as previous case
+			// same reasoning as previous case
+			if c.admits(tc2.sv) {
 				return c2
 			}
 		}
@@ -218,7 +299,7 @@ func (c semverConstraint) identical(c2 Constraint) bool {
 	if !ok {
 		return false
 	}
-	return c.c.String() == sc2.c.String()
+	return c.c.String() == sc2.c.String() && c.pre == sc2.pre
 }
 
 func (c semverConstraint) copyTo(msg *pb.Constraint) {
@@ -310,6 +391,68 @@ func (noneConstraint) copyTo(*pb.Constraint) {
 	panic("noneConstraint should never be serialized; it is solver internal-only")
 }
 
+// IntersectionStep is a single step in the narrowing of a constraint by
+// successive intersections.
+type IntersectionStep struct {
+	// Operand is the constraint intersected in this step.
+	Operand Constraint
+	// Result is the intersection of Operand with the operands of all the
+	// preceding steps.
+	Result Constraint
+}
+
+// IntersectionTrace records the provenance of an intersection of constraints:
+// each operand, in order, and how far it had narrowed the intersection.
+type IntersectionTrace []IntersectionStep
+
+// IntersectTraced intersects the provided constraints in order, recording each
+// step along the way. The intersection of no constraints is Any().
+func IntersectTraced(cs ...Constraint) IntersectionTrace {
+	t := make(IntersectionTrace, 0, len(cs))
+	var ret Constraint = any
+	for _, c := range cs {
+		ret = ret.Intersect(c)
+		t = append(t, IntersectionStep{Operand: c, Result: ret})
+	}
+	return t
+}
+
+// Result returns the final intersection of all the steps' operands.
+func (t IntersectionTrace) Result() Constraint {
+	if len(t) == 0 {
+		return any
+	}
+	return t[len(t)-1].Result
+}
+
+// Conflict reports which operands made the intersection empty. j is the
+// index of the step whose operand emptied it, and i the index of the earliest
+// step by which the intersection had already been narrowed so far as to admit
+// no version that the operand of step j allows.
+//
+// If the operands of steps i and j are disjoint themselves, they are two
+// directly incompatible requirements. Otherwise, they only became incompatible
+// through the narrowing of the steps before i.
+//
+// ok is false if the intersection is not empty.
+func (t IntersectionTrace) Conflict() (i, j int, ok bool) {
+	for j = range t {
+		if t[j].Result == none {
+			break
+		}
+	}
+	if len(t) == 0 || t[j].Result != none {
+		return 0, 0, false
+	}
+
+	for i = 0; i < j; i++ {
+		if !t[i].Result.MatchesAny(t[j].Operand) {
+			break
+		}
+	}
+	return i, j, true
+}
+
 // A ProjectConstraint combines a ProjectIdentifier with a Constraint. It
 // indicates that, if packages contained in the ProjectIdentifier enter the
 // depgraph, they must do so at a version that is allowed by the Constraint.
@@ -330,6 +473,9 @@ type workingConstraint struct {
 	Ident                     ProjectIdentifier
 	Constraint                Constraint
 	overrNet, overrConstraint bool
+	// unnarrowed is the constraint as declared, if Constraint has since been
+	// narrowed to the major version implied by the project's import path.
+	unnarrowed Constraint
 }
 
 func pcSliceToMap(l []ProjectConstraint, r ...[]ProjectConstraint) ProjectConstraints {
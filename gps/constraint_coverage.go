@@ -0,0 +1,109 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "github.com/Masterminds/semver"
+
+// IsSubsetOf reports whether every version admitted by c is also admitted by
+// c2. A constraint is always a subset of itself, the none constraint is a
+// subset of everything, and everything is a subset of the any constraint.
+//
+// This is primarily intended for linting, e.g. detecting that a manifest
+// constraint is broader than the range of versions a project actually works
+// with.
+func IsSubsetOf(c, c2 Constraint) bool {
+	if IsAny(c2) {
+		return true
+	}
+	if ec2, ok := c2.(exclusionConstraint); ok {
+		if c.identical(ec2) {
+			return true
+		}
+		if !IsSubsetOf(c, ec2.base) {
+			return false
+		}
+		for _, e := range ec2.excl {
+			if c.MatchesAny(e) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch tc := c.(type) {
+	case noneConstraint:
+		return true
+	case anyConstraint:
+		return false
+	case unionConstraint:
+		for _, m := range tc {
+			if !IsSubsetOf(m, c2) {
+				return false
+			}
+		}
+		return true
+	case exclusionConstraint:
+		// This is conservative, as the excluded versions may be exactly
+		// those of the base that c2 does not admit.
+		return IsSubsetOf(tc.base, c2)
+	case channelConstraint:
+		// Likewise, the versions outside the channels may be exactly
+		// those of within that c2 does not admit.
+		return IsSubsetOf(tc.within, c2)
+	case semverConstraint:
+		if uc2, ok := c2.(unionConstraint); ok {
+			// Union merges all of its semver operands into one member, which
+			// is the only one that could contain a semver range.
+			for _, m := range uc2 {
+				if IsSubsetOf(c, m) {
+					return true
+				}
+			}
+			return false
+		}
+		tc2, ok := c2.(semverConstraint)
+		if !ok {
+			// Ranges that collapse to a single version come back from
+			// NewSemverConstraint as a semVersion, so a semverConstraint can
+			// never be contained by any discrete version.
+			return false
+		}
+		if tc.pre > tc2.pre {
+			// c may admit prereleases that c2 does not.
+			return false
+		}
+		rc := tc.c.Intersect(tc2.c)
+		return !semver.IsNone(rc) && rc.String() == tc.c.String()
+	case Version:
+		// Discrete versions admit only themselves, so they're a subset exactly
+		// when the other constraint admits them.
+		return c2.Matches(tc)
+	}
+
+	return false
+}
+
+// AreDisjoint reports whether the two provided constraints have no admissible
+// version in common.
+func AreDisjoint(c, c2 Constraint) bool {
+	return !c.MatchesAny(c2)
+}
+
+// ConstraintGap returns the versions from the provided list that are admitted
+// by c, but not by c2 - that is, the "gap" between the two constraints, as
+// observed over an actual set of versions. The order of the input list is
+// preserved.
+//
+// When c2 is a subset of c, the gap describes how much broader c is than c2.
+func ConstraintGap(c, c2 Constraint, vl []Version) []Version {
+	var gap []Version
+	for _, v := range vl {
+		if c.Matches(v) && !c2.Matches(v) {
+			gap = append(gap, v)
+		}
+	}
+
+	return gap
+}
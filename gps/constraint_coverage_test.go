@@ -0,0 +1,99 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsSubsetOf(t *testing.T) {
+	rev := Revision("flooboofoobooo")
+	v1 := NewVersion("1.2.5")
+
+	cases := []struct {
+		name   string
+		c, c2  Constraint
+		subset bool
+	}{
+		{"none in any", none, any, true},
+		{"any in any", any, any, true},
+		{"any in semver", any, mkSVC("^1.0.0"), false},
+		{"none in branch", none, NewBranch("master"), true},
+		{"narrow in broad", mkSVC("^1.2.0"), mkSVC(">=1.0.0"), true},
+		{"broad in narrow", mkSVC(">=1.0.0"), mkSVC("^1.2.0"), false},
+		{"self", mkSVC("~1.2.3"), mkSVC("~1.2.3"), true},
+		{"tilde in caret", mkSVC("~1.2.3"), mkSVC("^1.2.0"), true},
+		{"overlapping", mkSVC("^1.2.0"), mkSVC("~1.4.0 || ^2.0.0"), false},
+		{"disjoint semver", mkSVC("^1.0.0"), mkSVC("^2.0.0"), false},
+		{"range in version", mkSVC("^1.0.0"), v1, false},
+		{"version in range", v1, mkSVC("^1.0.0"), true},
+		{"version outside range", v1, mkSVC("^2.0.0"), false},
+		{"pair in range", v1.Pair(rev), mkSVC("^1.0.0"), true},
+		{"branch in same branch", NewBranch("master"), NewBranch("master"), true},
+		{"branch in other branch", NewBranch("master"), NewBranch("devel"), false},
+		{"branch in range", NewBranch("master"), mkSVC("*"), false},
+		{"rev in pair", rev, NewBranch("master").Pair(rev), true},
+		{"rev in other rev", rev, Revision("other"), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := IsSubsetOf(c.c, c.c2); got != c.subset {
+				t.Errorf("expected IsSubsetOf(%s, %s) to be %v, got %v", c.c, c.c2, c.subset, got)
+			}
+		})
+	}
+}
+
+func TestAreDisjoint(t *testing.T) {
+	cases := []struct {
+		name     string
+		c, c2    Constraint
+		disjoint bool
+	}{
+		{"any and semver", any, mkSVC("^1.0.0"), false},
+		{"none and any", none, any, true},
+		{"overlapping semver", mkSVC("^1.2.0"), mkSVC(">=1.4.0"), false},
+		{"disjoint semver", mkSVC("^1.0.0"), mkSVC("^2.0.0"), true},
+		{"version in range", NewVersion("1.0.0"), mkSVC("^1.0.0"), false},
+		{"branch and range", NewBranch("master"), mkSVC("^1.0.0"), true},
+		{"different branches", NewBranch("master"), NewBranch("devel"), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := AreDisjoint(c.c, c.c2); got != c.disjoint {
+				t.Errorf("expected AreDisjoint(%s, %s) to be %v, got %v", c.c, c.c2, c.disjoint, got)
+			}
+		})
+	}
+}
+
+func TestConstraintGap(t *testing.T) {
+	vl := []Version{
+		NewVersion("2.0.0"),
+		NewVersion("1.4.0"),
+		NewVersion("1.2.1"),
+		NewVersion("1.0.0"),
+		NewBranch("master"),
+	}
+
+	gap := ConstraintGap(mkSVC("^1.0.0"), mkSVC("~1.2.0"), vl)
+	want := []Version{NewVersion("1.4.0"), NewVersion("1.0.0")}
+	if !reflect.DeepEqual(gap, want) {
+		t.Errorf("unexpected gap:\n\t(GOT): %s\n\t(WNT): %s", gap, want)
+	}
+
+	if gap := ConstraintGap(mkSVC("~1.2.0"), mkSVC("^1.0.0"), vl); len(gap) != 0 {
+		t.Errorf("expected no gap when first constraint is a subset of the second, got %s", gap)
+	}
+
+	gap = ConstraintGap(any, mkSVC("*"), vl)
+	want = []Version{NewBranch("master")}
+	if !reflect.DeepEqual(gap, want) {
+		t.Errorf("unexpected gap:\n\t(GOT): %s\n\t(WNT): %s", gap, want)
+	}
+}
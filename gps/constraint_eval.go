@@ -0,0 +1,179 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ConstraintKind classifies a Constraint by what it admits.
+type ConstraintKind uint8
+
+const (
+	// ConstraintAny admits every version.
+	ConstraintAny ConstraintKind = iota
+	// ConstraintNone admits no version.
+	ConstraintNone
+	// ConstraintRange admits a range of semantic versions.
+	ConstraintRange
+	// ConstraintVersion admits a single version.
+	ConstraintVersion
+	// ConstraintBranch admits a single branch.
+	ConstraintBranch
+	// ConstraintRevision admits a single revision.
+	ConstraintRevision
+	// ConstraintChannel admits the versions in a release channel.
+	ConstraintChannel
+)
+
+func (k ConstraintKind) String() string {
+	switch k {
+	case ConstraintAny:
+		return "any"
+	case ConstraintNone:
+		return "none"
+	case ConstraintRange:
+		return "semver range"
+	case ConstraintVersion:
+		return "version"
+	case ConstraintBranch:
+		return "branch"
+	case ConstraintRevision:
+		return "revision"
+	case ConstraintChannel:
+		return "channel"
+	}
+	return fmt.Sprintf("ConstraintKind(%d)", uint8(k))
+}
+
+// KindOf returns the kind of the Constraint.
+func KindOf(c Constraint) ConstraintKind {
+	switch tc := c.(type) {
+	case anyConstraint:
+		return ConstraintAny
+	case noneConstraint:
+		return ConstraintNone
+	case channelConstraint:
+		return ConstraintChannel
+	case Version:
+		return kindOfVersion(tc)
+	}
+	return ConstraintRange
+}
+
+// ConstraintEvaluation is the outcome of EvaluateConstraint.
+type ConstraintEvaluation struct {
+	// Constraint is the parsed constraint, and Kind its kind.
+	Constraint Constraint
+	Kind       ConstraintKind
+	// Version is the parsed version.
+	Version Version
+	// Matches reports whether Constraint admits Version.
+	Matches bool
+	// Reason explains, in a sentence fragment suitable for display, why the
+	// constraint does or does not admit the version.
+	Reason string
+}
+
+// EvaluateConstraint parses a constraint and a version, and reports whether
+// the constraint admits the version, and why. It neither solves nor consults a
+// SourceManager, so it suits tools that answer the question for a user, such
+// as editors describing a constraint under the cursor.
+//
+// typ determines how both body and version are interpreted:
+//
+//	"version"  body is as given for version in Gopkg.toml: a semver range, in
+//	           which a bare version implies a caret, or else a plain version.
+//	           version is a semantic or plain version.
+//	"branch"   body and version are branch names.
+//	"revision" body and version are revisions.
+//	"npm", "cargo", "go.mod"
+//	           body is in the given foreign syntax, as accepted by
+//	           ParseForeignConstraint. version is a semantic or plain version.
+//
+// An error is returned only if typ is unknown, or body cannot be parsed.
+func EvaluateConstraint(typ, body, version string) (ConstraintEvaluation, error) {
+	var ev ConstraintEvaluation
+	var err error
+	switch typ {
+	case "version":
+		ev.Constraint, err = NewSemverConstraintIC(body)
+		// As in Gopkg.toml, anything but an expression falls back on being
+		// a plain version.
+		if err != nil && !strings.Contains(body, "&&") && !strings.ContainsAny(body, "()") {
+			ev.Constraint, err = NewVersion(body), nil
+		}
+		ev.Version = NewVersion(version)
+	case "branch":
+		ev.Constraint = NewBranch(body)
+		ev.Version = NewBranch(version)
+	case "revision":
+		ev.Constraint = Revision(body)
+		ev.Version = Revision(version)
+	default:
+		syntax, perr := ParseConstraintSyntax(typ)
+		if perr != nil {
+			return ev, errors.Errorf("unknown constraint type %q", typ)
+		}
+		ev.Constraint, err = ParseForeignConstraint(body, syntax)
+		ev.Version = NewVersion(version)
+	}
+	if err != nil {
+		return ev, errors.Wrapf(err, "invalid %s constraint %q", typ, body)
+	}
+
+	ev.Kind = KindOf(ev.Constraint)
+	ev.Matches = ev.Constraint.Matches(ev.Version)
+	if ev.Matches {
+		ev.Reason = fmt.Sprintf("%s satisfies %s", ev.Version, ev.Constraint)
+	} else {
+		ev.Reason = mismatchReason(ev.Constraint, ev.Version)
+	}
+	return ev, nil
+}
+
+// mismatchReason explains why c does not admit v.
+func mismatchReason(c Constraint, v Version) string {
+	switch tc := c.(type) {
+	case noneConstraint:
+		return "the constraint admits no versions"
+	case semverConstraint:
+		sv, ok := v.(semVersion)
+		if !ok {
+			return fmt.Sprintf("%s is not a semantic version, so no range admits it", v)
+		}
+		if err := tc.c.Matches(sv.sv); err != nil {
+			// Unions explain themselves one line per alternative.
+			return strings.Replace(err.Error(), "\n", "; ", -1)
+		}
+	case semVersion:
+		if _, ok := v.(semVersion); !ok {
+			return fmt.Sprintf("%s is not a semantic version, so cannot be %s", v, c)
+		}
+	}
+
+	ck, vk := KindOf(c), kindOfVersion(v)
+	switch {
+	case ck == ConstraintRange:
+		return fmt.Sprintf("%s is not admitted by %s", v, c)
+	case ck != vk:
+		return fmt.Sprintf("%s is a %s, but the constraint requires the %s %s", v, vk, ck, c)
+	}
+	return fmt.Sprintf("%s is not %s", v, c)
+}
+
+// kindOfVersion returns the kind of Constraint that admits only v.
+func kindOfVersion(v Version) ConstraintKind {
+	switch v.Type() {
+	case IsBranch:
+		return ConstraintBranch
+	case IsRevision:
+		return ConstraintRevision
+	}
+	return ConstraintVersion
+}
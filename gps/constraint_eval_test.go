@@ -0,0 +1,63 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluateConstraint(t *testing.T) {
+	for _, test := range []struct {
+		typ, body, version string
+		kind               ConstraintKind
+		matches            bool
+		reason             string
+	}{
+		{"version", "1.2.0", "v1.4.1", ConstraintRange, true, "v1.4.1 satisfies ^1.2.0"},
+		{"version", "^1.2.0", "v1.1.0", ConstraintRange, false, "1.1.0 is less than the minimum of ^1.2.0"},
+		{"version", "^1.2.0", "v2.0.0", ConstraintRange, false, "2.0.0"},
+		{"version", "^1.2.0", "release-1", ConstraintRange, false, "release-1 is not a semantic version"},
+		{"version", "=1.2.0", "v1.2.0", ConstraintVersion, true, "satisfies"},
+		{"version", "=1.2.0", "foo", ConstraintVersion, false, "foo is not a semantic version"},
+		{"version", "*", "v0.1.0", ConstraintRange, true, "satisfies"},
+		{"version", "*", "anything", ConstraintRange, false, "anything is not a semantic version"},
+		{"version", "release-1", "release-1", ConstraintVersion, true, "satisfies"},
+		{"version", "release-1", "release-2", ConstraintVersion, false, "release-2 is not release-1"},
+		{"version", "^1.0.0 || ^3.0.0", "v2.0.0", ConstraintRange, false, "maximum of ^1.0.0; 2.0.0 is less than the minimum of ^3.0.0"},
+		{"branch", "master", "master", ConstraintBranch, true, "master satisfies master"},
+		{"branch", "master", "dev", ConstraintBranch, false, "dev is not master"},
+		{"revision", "abc123", "abc123", ConstraintRevision, true, "satisfies"},
+		{"revision", "abc123", "def456", ConstraintRevision, false, "def456 is not abc123"},
+		{"npm", "1.2.x || >=2.1 <3", "v2.3.0", ConstraintRange, true, "satisfies"},
+		{"cargo", "=0.0.3", "v0.0.4", ConstraintVersion, false, "v0.0.4 is not 0.0.3"},
+		{"go.mod", "v1.3.0", "v1.2.9", ConstraintRange, false, "less than the minimum of ^1.3.0"},
+	} {
+		ev, err := EvaluateConstraint(test.typ, test.body, test.version)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s constraint %q against %q: %v", test.typ, test.body, test.version, err)
+			continue
+		}
+		if ev.Kind != test.kind {
+			t.Errorf("expected %s constraint %q to be a %s, got %s", test.typ, test.body, test.kind, ev.Kind)
+		}
+		if ev.Matches != test.matches {
+			t.Errorf("expected %s constraint %q matching %q to be %v, got %v", test.typ, test.body, test.version, test.matches, ev.Matches)
+		}
+		if !strings.Contains(ev.Reason, test.reason) {
+			t.Errorf("expected the reason for %s constraint %q against %q to contain %q, got %q", test.typ, test.body, test.version, test.reason, ev.Reason)
+		}
+	}
+
+	for _, test := range []struct{ typ, body string }{
+		{"tag", "v1.0.0"},
+		{"version", "(^1.0.0"},
+		{"cargo", "1.0 || 2.0"},
+	} {
+		if ev, err := EvaluateConstraint(test.typ, test.body, "v1.0.0"); err == nil {
+			t.Errorf("expected %s constraint %q to be rejected, got %s", test.typ, test.body, ev.Constraint)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/gps/internal/pb"
+)
+
+// Exclude returns a Constraint that admits every version admitted by c, except
+// those admitted by any of the excluded constraints. For example, anything but
+// 1.4.2 and the broken-ci branch is:
+//
+//	Exclude(Any(), NewVersion("1.4.2"), NewBranch("broken-ci"))
+//
+// The solver skips excluded versions as though they did not satisfy the
+// constraint. Excluded constraints that admit nothing in c are dropped, and if
+// one of them admits everything in c, the none constraint is returned.
+//
+// Whether an exclusion admits any of another constraint's versions is only
+// determined conservatively: if its excluded constraints only cover the
+// versions in common between them together, rather than one at a time,
+// MatchesAny still reports true.
+func Exclude(c Constraint, excluded ...Constraint) Constraint {
+	if ec, ok := c.(exclusionConstraint); ok {
+		c = ec.base
+		excluded = append(append([]Constraint(nil), ec.excl...), excluded...)
+	}
+	switch tc := c.(type) {
+	case noneConstraint:
+		return none
+	case unionConstraint:
+		// Excluding from each member of a union lets whole members drop out.
+		cs := make([]Constraint, len(tc))
+		for i, m := range tc {
+			cs[i] = Exclude(m, excluded...)
+		}
+		return Union(cs...)
+	}
+
+	var excl []Constraint
+	for _, e := range excluded {
+		if IsAny(e) || IsSubsetOf(c, e) {
+			return none
+		}
+		if c.MatchesAny(e) {
+			excl = append(excl, e)
+		}
+	}
+
+	// Order the excluded constraints canonically, so that exclusions of the
+	// same constraints are identical, and drop any duplicates.
+	sort.Slice(excl, func(i, j int) bool {
+		return excl[i].typedString() < excl[j].typedString()
+	})
+	u := excl[:0]
+	for _, e := range excl {
+		if len(u) > 0 && u[len(u)-1].identical(e) {
+			continue
+		}
+		u = append(u, e)
+	}
+
+	if len(u) == 0 {
+		return c
+	}
+	return exclusionConstraint{base: c, excl: u}
+}
+
+// exclusionConstraint admits the versions admitted by its base, but not those
+// admitted by any of its excluded constraints. It is only constructed by
+// Exclude.
+type exclusionConstraint struct {
+	base Constraint
+	excl []Constraint
+}
+
+func (c exclusionConstraint) String() string {
+	s := make([]string, len(c.excl))
+	for i, e := range c.excl {
+		s[i] = e.String()
+	}
+	return c.base.String() + " except " + strings.Join(s, ", ")
+}
+
+func (c exclusionConstraint) ImpliedCaretString() string {
+	s := make([]string, len(c.excl))
+	for i, e := range c.excl {
+		s[i] = e.ImpliedCaretString()
+	}
+	return c.base.ImpliedCaretString() + " except " + strings.Join(s, ", ")
+}
+
+func (c exclusionConstraint) typedString() string {
+	s := make([]string, len(c.excl))
+	for i, e := range c.excl {
+		s[i] = e.typedString()
+	}
+	return "excl-" + c.base.typedString() + " except " + strings.Join(s, ", ")
+}
+
+func (c exclusionConstraint) Matches(v Version) bool {
+	if !c.base.Matches(v) {
+		return false
+	}
+	for _, e := range c.excl {
+		if e.Matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c exclusionConstraint) MatchesAny(c2 Constraint) bool {
+	return c.Intersect(c2) != none
+}
+
+// Intersect narrows the base by c2, which in turn drops whichever excluded
+// constraints no longer overlap it. Exclusions accumulate, so the
+// intersection of two exclusions excludes what either of them does.
+func (c exclusionConstraint) Intersect(c2 Constraint) Constraint {
+	if ec2, ok := c2.(exclusionConstraint); ok {
+		return Exclude(c.base.Intersect(ec2.base), append(append([]Constraint(nil), c.excl...), ec2.excl...)...)
+	}
+	return Exclude(c.base.Intersect(c2), c.excl...)
+}
+
+func (c exclusionConstraint) identical(c2 Constraint) bool {
+	ec2, ok := c2.(exclusionConstraint)
+	if !ok || len(c.excl) != len(ec2.excl) || !c.base.identical(ec2.base) {
+		return false
+	}
+	for i, e := range c.excl {
+		if !e.identical(ec2.excl[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c exclusionConstraint) copyTo(msg *pb.Constraint) {
+	msg.Type = pb.Constraint_Exclusion
+	msg.Value = c.String()
+	msg.Members = make([]*pb.Constraint, len(c.excl)+1)
+	for i, m := range append([]Constraint{c.base}, c.excl...) {
+		msg.Members[i] = &pb.Constraint{}
+		if IsAny(m) {
+			// The any constraint is never serialized by itself, but may
+			// be the base of an exclusion.
+			msg.Members[i].Type = pb.Constraint_Any
+			continue
+		}
+		m.copyTo(msg.Members[i])
+	}
+}
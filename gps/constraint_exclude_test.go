@@ -0,0 +1,115 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "testing"
+
+func TestExclusionConstraintOps(t *testing.T) {
+	broken := NewBranch("broken-ci")
+	v142 := NewVersion("1.4.2")
+	rev := Revision("fozzie bear")
+
+	c := Exclude(Any(), v142, broken)
+	if _, ok := c.(exclusionConstraint); !ok {
+		t.Fatalf("expected an exclusion, got %T", c)
+	}
+	if c.String() != "* except broken-ci, 1.4.2" {
+		t.Errorf("unexpected string form of exclusion: %q", c)
+	}
+
+	matches := []struct {
+		v    Version
+		want bool
+	}{
+		{NewBranch("master"), true},
+		{broken, false},
+		{broken.(UnpairedVersion).Pair(rev), false},
+		{NewVersion("1.4.1"), true},
+		{v142, false},
+		{v142.(UnpairedVersion).Pair(rev), false},
+		{NewVersion("1.4.3").Pair(rev), true},
+		{rev, true},
+	}
+	for _, m := range matches {
+		if got := c.Matches(m.v); got != m.want {
+			t.Errorf("expected %q to match %s to be %v", c, m.v, m.want)
+		}
+		if got := c.MatchesAny(m.v); got != m.want {
+			t.Errorf("expected %q to match any of %s to be %v", c, m.v, m.want)
+		}
+		if got := m.v.MatchesAny(c); got != m.want {
+			t.Errorf("expected %s to match any of %q to be %v", m.v, c, m.want)
+		}
+	}
+
+	c14 := testSemverConstraint(t, "~1.4.0")
+	intersects := []struct {
+		c    Constraint
+		want Constraint
+	}{
+		{any, c},
+		{none, none},
+		{NewBranch("master"), NewBranch("master")},
+		{broken, none},
+		{v142, none},
+		{c14, Exclude(c14, v142)},
+		{testSemverConstraint(t, "^2.0.0"), testSemverConstraint(t, "^2.0.0")},
+		{Exclude(Any(), rev), Exclude(Any(), broken, rev, v142)},
+		{Union(broken, v142, NewBranch("master")), NewBranch("master")},
+	}
+	for _, i := range intersects {
+		if got := c.Intersect(i.c); !got.identical(i.want) {
+			t.Errorf("expected %q intersected with %q to be %q, got %q", c, i.c, i.want, got)
+		}
+		if got := i.c.Intersect(c); !got.identical(i.want) {
+			t.Errorf("expected %q intersected with %q to be %q, got %q", i.c, c, i.want, got)
+		}
+	}
+
+	reductions := []struct {
+		name string
+		c    Constraint
+		want Constraint
+	}{
+		{"nothing excluded", Exclude(c14), c14},
+		{"disjoint", Exclude(c14, broken, NewVersion("2.0.0")), c14},
+		{"everything excluded", Exclude(c14, testSemverConstraint(t, "^1.0.0")), none},
+		{"excluding any", Exclude(broken, any), none},
+		{"of none", Exclude(none, v142), none},
+		{"duplicates", Exclude(Any(), v142, broken, v142), c},
+		{"nested", Exclude(Exclude(Any(), broken), v142), c},
+	}
+	for _, r := range reductions {
+		if !r.c.identical(r.want) {
+			t.Errorf("%s: expected exclusion to reduce to %q, got %q", r.name, r.want, r.c)
+		}
+	}
+
+	if !IsSubsetOf(c14, Exclude(Any(), broken)) || IsSubsetOf(c14, c) {
+		t.Errorf("expected a range to be a subset of an exclusion only if none of it is excluded")
+	}
+	if !IsSubsetOf(c, c) || !IsSubsetOf(Exclude(c14, v142), c) {
+		t.Errorf("expected exclusions to be subsets of exclusions of their bases that exclude less")
+	}
+}
+
+func TestExclusionSolve(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("a 1.2.0"),
+		},
+		l: mklock("a 1.1.0"),
+		r: mksolution("a 1.0.0"),
+	}
+	// The latest version and the locked one are both blacklisted, so the
+	// solver must skip past them.
+	fix.ds[0].deps[0].Constraint = Exclude(Any(), NewVersion("1.1.0"), testSemverConstraint(t, ">=1.2.0"))
+
+	soln, err := fixSolve(basicFixtureParams(fix), newdepspecSM(fix.ds, nil), t)
+	fixtureSolveSimpleChecks(fix, soln, err, t)
+}
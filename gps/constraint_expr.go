@@ -0,0 +1,173 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// Operators of the constraint expression language, in addition to those
+// understood by the semver package within each term.
+const (
+	exprAnd    = "&&"
+	exprOr     = "||"
+	exprLParen = "("
+	exprRParen = ")"
+)
+
+// IsConstraintExpr reports whether body uses any of the operators that only
+// the constraint expression language understands. Bodies that do not are
+// parsed by the semver package alone, exactly as before expressions existed,
+// and so may be taken as plain versions if they are not semver constraints.
+func IsConstraintExpr(body string) bool {
+	return strings.Contains(body, exprAnd) || strings.ContainsAny(body, exprLParen+exprRParen)
+}
+
+// newConstraintExpr compiles a boolean expression over semver constraints into
+// a single Constraint.
+//
+// Terms are anything the semver package can parse, such as "^1.2.0",
+// ">=1.0.0, <1.4.0" or "!=2.3.1". They are combined with "&&" (intersection)
+// and "||" (union), and grouped with parentheses. "&&" binds more tightly than
+// "||", so "^1.0.0 || ^2.0.0 && !=2.3.1" excludes 2.3.1 only from ^2.0.0. If ic
+// is true, terms without an operator imply ^ rather than =.
+func newConstraintExpr(body string, ic bool) (Constraint, error) {
+	p := &exprParser{body: body, toks: tokenizeConstraintExpr(body), ic: ic}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, p.errorf("unexpected %q", p.toks[p.pos])
+	}
+	if semver.IsNone(c) {
+		return nil, fmt.Errorf("constraint expression %q matches no versions", body)
+	}
+
+	if sv, ok := c.(semver.Version); ok {
+		return semVersion{sv: sv}, nil
+	}
+	return semverConstraint{c: c}, nil
+}
+
+// tokenizeConstraintExpr splits an expression into operators and the trimmed
+// terms between them.
+func tokenizeConstraintExpr(body string) []string {
+	var toks []string
+	term := func(s string) {
+		if s = strings.TrimSpace(s); s != "" {
+			toks = append(toks, s)
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(body); {
+		var op string
+		switch {
+		case strings.HasPrefix(body[i:], exprAnd):
+			op = exprAnd
+		case strings.HasPrefix(body[i:], exprOr):
+			op = exprOr
+		case body[i] == '(':
+			op = exprLParen
+		case body[i] == ')':
+			op = exprRParen
+		default:
+			i++
+			continue
+		}
+
+		term(body[start:i])
+		toks = append(toks, op)
+		i += len(op)
+		start = i
+	}
+	term(body[start:])
+	return toks
+}
+
+// exprParser is a recursive descent parser over the tokens of a constraint
+// expression.
+type exprParser struct {
+	body string
+	toks []string
+	pos  int
+	ic   bool
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid constraint expression %q: %s", p.body, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) accept(op string) bool {
+	if p.pos < len(p.toks) && p.toks[p.pos] == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (semver.Constraint, error) {
+	c, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	cs := []semver.Constraint{c}
+	for p.accept(exprOr) {
+		if c, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return semver.Union(cs...), nil
+}
+
+func (p *exprParser) parseAnd() (semver.Constraint, error) {
+	c, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	cs := []semver.Constraint{c}
+	for p.accept(exprAnd) {
+		if c, err = p.parseTerm(); err != nil {
+			return nil, err
+		}
+		cs = append(cs, c)
+	}
+	return semver.Intersection(cs...), nil
+}
+
+func (p *exprParser) parseTerm() (semver.Constraint, error) {
+	if p.accept(exprLParen) {
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(exprRParen) {
+			return nil, p.errorf("missing %q", exprRParen)
+		}
+		return c, nil
+	}
+
+	if p.pos >= len(p.toks) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	tok := p.toks[p.pos]
+	switch tok {
+	case exprAnd, exprOr, exprRParen:
+		return nil, p.errorf("unexpected %q", tok)
+	}
+	p.pos++
+
+	if p.ic {
+		return semver.NewConstraintIC(tok)
+	}
+	return semver.NewConstraint(tok)
+}
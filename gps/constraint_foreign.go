@@ -0,0 +1,516 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+)
+
+// ConstraintSyntax identifies the version range syntax of another ecosystem's
+// manifests, into and out of which constraints can be translated with
+// ParseForeignConstraint and FormatForeignConstraint.
+type ConstraintSyntax uint8
+
+const (
+	// NpmSyntax is the range syntax of package.json files: comparators
+	// separated by whitespace are intersected, and alternatives are separated
+	// by "||". A version without an operator admits only itself, and carets
+	// on 0.0.x versions admit only the one patch version.
+	NpmSyntax ConstraintSyntax = iota
+
+	// CargoSyntax is the requirement syntax of Cargo.toml files: comparators
+	// are separated by commas, and a version without an operator is a caret
+	// requirement. There is no way to express alternatives or exclusions.
+	CargoSyntax
+
+	// GoModSyntax is the syntax of the versions in the require directives of
+	// go.mod files, such as v1.2.3. Under minimal version selection, such a
+	// version is the minimum acceptable version of its major version, so only
+	// the lower bound of a constraint can be expressed: formatting ^1.2.0 and
+	// ~1.2.0 both yield v1.2.0. The +incompatible suffix that versions of 2 or
+	// more need when the module path lacks a major version is left to the
+	// caller.
+	GoModSyntax
+)
+
+func (s ConstraintSyntax) String() string {
+	switch s {
+	case NpmSyntax:
+		return "npm"
+	case CargoSyntax:
+		return "cargo"
+	case GoModSyntax:
+		return "go.mod"
+	}
+	return fmt.Sprintf("ConstraintSyntax(%d)", uint8(s))
+}
+
+// ParseConstraintSyntax parses the string form of a ConstraintSyntax, as
+// produced by its String method.
+func ParseConstraintSyntax(s string) (ConstraintSyntax, error) {
+	switch s {
+	case "npm":
+		return NpmSyntax, nil
+	case "cargo":
+		return CargoSyntax, nil
+	case "go.mod":
+		return GoModSyntax, nil
+	}
+	return 0, errors.Errorf("unknown constraint syntax %q", s)
+}
+
+// ParseForeignConstraint translates a version range written in the provided
+// syntax into the equivalent Constraint, such as npm's "1.2.x || >=2.1 <3" to
+// ">=1.2.0, <1.3.0 || >=2.1.0, <3.0.0", or Cargo's "0.0.3" to "=0.0.3".
+func ParseForeignConstraint(body string, syntax ConstraintSyntax) (Constraint, error) {
+	var alts [][]foreignComparator
+	var err error
+	switch syntax {
+	case NpmSyntax:
+		alts, err = parseNpmRange(body)
+	case CargoSyntax:
+		var conj []foreignComparator
+		conj, err = parseCargoRequirement(body)
+		alts = [][]foreignComparator{conj}
+	case GoModSyntax:
+		var conj []foreignComparator
+		conj, err = parseGoModVersion(body)
+		alts = [][]foreignComparator{conj}
+	default:
+		err = errors.Errorf("unknown constraint syntax %s", syntax)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s constraint %q", syntax, body)
+	}
+
+	pieces := make([]string, 0, len(alts))
+	for _, conj := range alts {
+		if len(conj) == 0 {
+			// An alternative without comparators admits everything.
+			return Any(), nil
+		}
+		s := make([]string, len(conj))
+		for i, cmp := range conj {
+			s[i] = cmp.op + cmp.v
+		}
+		pieces = append(pieces, strings.Join(s, ", "))
+	}
+
+	c, err := NewSemverConstraint(strings.Join(pieces, " || "))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s constraint %q", syntax, body)
+	}
+	if sc, ok := c.(semverConstraint); ok && semver.IsNone(sc.c) {
+		return nil, errors.Errorf("%s constraint %q admits no versions", syntax, body)
+	}
+	return c, nil
+}
+
+// FormatForeignConstraint translates the constraint into the provided syntax,
+// so that it admits the same versions. Constraints that the syntax cannot
+// express, such as branches and revisions, or unions in CargoSyntax, are an
+// error. In GoModSyntax, constraints are translated to their minimum.
+func FormatForeignConstraint(c Constraint, syntax ConstraintSyntax) (string, error) {
+	if syntax > GoModSyntax {
+		return "", errors.Errorf("unknown constraint syntax %s", syntax)
+	}
+	if pv, ok := c.(versionPair); ok {
+		c = pv.v
+	}
+
+	var alts [][]foreignComparator
+	switch tc := c.(type) {
+	case anyConstraint:
+		if syntax == GoModSyntax {
+			return "", errors.Errorf("go.mod cannot express the absence of a minimum version")
+		}
+		return "*", nil
+	case semVersion:
+		alts = [][]foreignComparator{{{op: "=", v: tc.sv.String()}}}
+	case semverConstraint:
+		var err error
+		if alts, err = canonicalComparators(tc.c.String()); err != nil {
+			return "", err
+		}
+	default:
+		return "", errors.Errorf("%s cannot express the non-semver constraint %s", syntax, c)
+	}
+
+	switch syntax {
+	case NpmSyntax:
+		return formatNpmRange(alts), nil
+	case CargoSyntax:
+		return formatCargoRequirement(c, alts)
+	}
+	return formatGoModVersion(c, alts)
+}
+
+// foreignComparator is a single comparison against a version, whose operator
+// is one of those of the semver package: =, !=, >, >=, < and <=, or the ^ and
+// ~ shorthands when formatting.
+type foreignComparator struct {
+	op, v string
+}
+
+// partialVersionRe matches the versions of npm and Cargo ranges, which may
+// omit or wildcard their trailing numeric parts.
+var partialVersionRe = regexp.MustCompile(`^v?(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// partialVersion is a possibly incomplete version, of which only the first n
+// numeric parts were given. Build metadata is dropped, as it never affects
+// which versions match.
+type partialVersion struct {
+	parts [3]uint64
+	n     int
+	pre   string
+}
+
+func parsePartialVersion(s string) (partialVersion, error) {
+	m := partialVersionRe.FindStringSubmatch(s)
+	if m == nil {
+		return partialVersion{}, errors.Errorf("invalid version %q", s)
+	}
+
+	var pv partialVersion
+	for i, part := range m[1:4] {
+		if part == "" || part == "x" || part == "X" || part == "*" {
+			break
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return partialVersion{}, errors.Errorf("invalid version %q", s)
+		}
+		pv.parts[i] = n
+		pv.n = i + 1
+	}
+	if pv.n == 3 {
+		pv.pre = m[4]
+	}
+	return pv, nil
+}
+
+// floor is the least version the partial version stands for.
+func (pv partialVersion) floor() string {
+	return fmt.Sprintf("%d.%d.%d%s", pv.parts[0], pv.parts[1], pv.parts[2], pv.pre)
+}
+
+// bump returns the least version above those the partial version stands for,
+// its ith numeric part incremented and those after it zeroed.
+func (pv partialVersion) bump(i int) string {
+	parts := pv.parts
+	parts[i]++
+	for j := i + 1; j < 3; j++ {
+		parts[j] = 0
+	}
+	return fmt.Sprintf("%d.%d.%d", parts[0], parts[1], parts[2])
+}
+
+// comparators desugars a comparison against a partial version, under npm's
+// and Cargo's shared semantics, into comparisons against full versions. An
+// empty result admits everything.
+func (pv partialVersion) comparators(op string) ([]foreignComparator, error) {
+	if pv.n == 0 {
+		switch op {
+		case "", "=", "^", "~", ">=", "<=":
+			return nil, nil
+		}
+		return nil, errors.Errorf("%s* admits no versions", op)
+	}
+
+	last := pv.n - 1
+	switch op {
+	case "", "=":
+		if pv.n == 3 {
+			return []foreignComparator{{op: "=", v: pv.floor()}}, nil
+		}
+		return []foreignComparator{{op: ">=", v: pv.floor()}, {op: "<", v: pv.bump(last)}}, nil
+	case "^":
+		// The first nonzero part given may not change. If all the parts
+		// given are zero, the last of them may not, so ^0.0 admits 0.0.x.
+		i := 0
+		for i < last && pv.parts[i] == 0 {
+			i++
+		}
+		return []foreignComparator{{op: ">=", v: pv.floor()}, {op: "<", v: pv.bump(i)}}, nil
+	case "~":
+		i := 1
+		if pv.n == 1 {
+			i = 0
+		}
+		return []foreignComparator{{op: ">=", v: pv.floor()}, {op: "<", v: pv.bump(i)}}, nil
+	case ">":
+		if pv.n == 3 {
+			return []foreignComparator{{op: ">", v: pv.floor()}}, nil
+		}
+		return []foreignComparator{{op: ">=", v: pv.bump(last)}}, nil
+	case ">=":
+		return []foreignComparator{{op: ">=", v: pv.floor()}}, nil
+	case "<":
+		return []foreignComparator{{op: "<", v: pv.floor()}}, nil
+	case "<=":
+		if pv.n == 3 {
+			return []foreignComparator{{op: "<=", v: pv.floor()}}, nil
+		}
+		return []foreignComparator{{op: "<", v: pv.bump(last)}}, nil
+	}
+	return nil, errors.Errorf("unknown operator %q", op)
+}
+
+// comparatorRe splits a comparator into its operator and version.
+var comparatorRe = regexp.MustCompile(`^(<=|>=|<|>|=|\^|~)?\s*(\S+)$`)
+
+func parseComparator(s string) (string, partialVersion, error) {
+	m := comparatorRe.FindStringSubmatch(s)
+	if m == nil {
+		return "", partialVersion{}, errors.Errorf("invalid comparator %q", s)
+	}
+	pv, err := parsePartialVersion(m[2])
+	return m[1], pv, err
+}
+
+// npmOpSpaceRe matches the whitespace npm allows between an operator and its
+// version.
+var npmOpSpaceRe = regexp.MustCompile(`(<=|>=|<|>|=|\^|~)\s+`)
+
+func parseNpmRange(body string) ([][]foreignComparator, error) {
+	var alts [][]foreignComparator
+	for _, alt := range strings.Split(body, "||") {
+		alt = strings.TrimSpace(alt)
+		var conj []foreignComparator
+
+		if i := strings.Index(alt, " - "); i >= 0 {
+			// A hyphen range, inclusive at both ends.
+			lo, err := parsePartialVersion(strings.TrimSpace(alt[:i]))
+			if err != nil {
+				return nil, err
+			}
+			hi, err := parsePartialVersion(strings.TrimSpace(alt[i+3:]))
+			if err != nil {
+				return nil, err
+			}
+			for _, part := range []struct {
+				op string
+				pv partialVersion
+			}{{">=", lo}, {"<=", hi}} {
+				cmps, err := part.pv.comparators(part.op)
+				if err != nil {
+					return nil, err
+				}
+				conj = append(conj, cmps...)
+			}
+		} else {
+			for _, field := range strings.Fields(npmOpSpaceRe.ReplaceAllString(alt, "$1")) {
+				op, pv, err := parseComparator(field)
+				if err != nil {
+					return nil, err
+				}
+				cmps, err := pv.comparators(op)
+				if err != nil {
+					return nil, err
+				}
+				conj = append(conj, cmps...)
+			}
+		}
+		alts = append(alts, conj)
+	}
+	return alts, nil
+}
+
+func parseCargoRequirement(body string) ([]foreignComparator, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, errors.New("empty requirement")
+	}
+
+	var conj []foreignComparator
+	for _, field := range strings.Split(body, ",") {
+		op, pv, err := parseComparator(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		if op == "" && pv.n > 0 {
+			// Cargo's default operator is the caret.
+			op = "^"
+		}
+		cmps, err := pv.comparators(op)
+		if err != nil {
+			return nil, err
+		}
+		conj = append(conj, cmps...)
+	}
+	return conj, nil
+}
+
+// goModVersionRe matches the semantic versions of go.mod files, which always
+// have all three numeric parts.
+var goModVersionRe = regexp.MustCompile(`^v(\d+)\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+incompatible)?$`)
+
+// pseudoVersionRe matches the prerelease part of go.mod pseudo-versions, such
+// as v0.0.0-20180917221912-90fa682c2a6e, which name revisions rather than
+// releases.
+var pseudoVersionRe = regexp.MustCompile(`-(?:\d+\.)?\d{14}-[0-9a-f]{12}$`)
+
+func parseGoModVersion(body string) ([]foreignComparator, error) {
+	m := goModVersionRe.FindStringSubmatch(body)
+	if m == nil {
+		return nil, errors.New("must be a semantic version, such as v1.2.3")
+	}
+	if pseudoVersionRe.MatchString(strings.TrimSuffix(body, "+incompatible")) {
+		return nil, errors.New("pseudo-versions name revisions, which are not constraints")
+	}
+
+	major, err := strconv.ParseUint(m[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	v := strings.TrimSuffix(strings.TrimPrefix(body, "v"), "+incompatible")
+	return []foreignComparator{{op: ">=", v: v}, {op: "<", v: fmt.Sprintf("%d.0.0", major+1)}}, nil
+}
+
+// canonicalComparators splits the canonical string form of a semver constraint
+// into its alternatives and their comparators. Besides the explicit
+// operators, it may use the semver package's ^ and ~ shorthands.
+func canonicalComparators(s string) ([][]foreignComparator, error) {
+	var alts [][]foreignComparator
+	for _, alt := range strings.Split(s, " || ") {
+		var conj []foreignComparator
+		for _, piece := range strings.Split(alt, ", ") {
+			i := strings.IndexAny(piece, "0123456789")
+			if i < 0 {
+				return nil, errors.Errorf("unexpected comparator %q in %q", piece, s)
+			}
+			op := piece[:i]
+			if op == "" {
+				op = "="
+			}
+			conj = append(conj, foreignComparator{op: op, v: piece[i:]})
+		}
+		alts = append(alts, conj)
+	}
+	return alts, nil
+}
+
+// expandShorthand returns the comparator as comparisons against its bounds if
+// it is a ^ or ~ shorthand of the semver package, whose ^ on 0.0.x versions
+// admits every patch version of the minor version.
+func expandShorthand(cmp foreignComparator) []foreignComparator {
+	if cmp.op != "^" && cmp.op != "~" {
+		return []foreignComparator{cmp}
+	}
+	sv, err := semver.NewVersion(cmp.v)
+	if err != nil {
+		return []foreignComparator{cmp}
+	}
+
+	var max string
+	switch {
+	case cmp.op == "~" || sv.Major() == 0:
+		max = fmt.Sprintf("%d.%d.0", sv.Major(), sv.Minor()+1)
+	default:
+		max = fmt.Sprintf("%d.0.0", sv.Major()+1)
+	}
+	return []foreignComparator{{op: ">=", v: cmp.v}, {op: "<", v: max}}
+}
+
+// shorthandAgrees reports whether the semver package's ^ or ~ shorthand
+// comparator means the same under npm's and Cargo's semantics. They disagree
+// only on the ^ of 0.0.x versions.
+func shorthandAgrees(cmp foreignComparator) bool {
+	sv, err := semver.NewVersion(cmp.v)
+	return err == nil && (cmp.op == "~" || sv.Major() != 0 || sv.Minor() != 0)
+}
+
+// foreignConjunction formats the comparators of a conjunction, expanding the
+// shorthands on which the foreign syntax disagrees.
+func foreignConjunction(conj []foreignComparator, sep string) string {
+	var s []string
+	for _, cmp := range conj {
+		if (cmp.op == "^" || cmp.op == "~") && shorthandAgrees(cmp) {
+			s = append(s, cmp.op+cmp.v)
+			continue
+		}
+		for _, e := range expandShorthand(cmp) {
+			s = append(s, e.op+e.v)
+		}
+	}
+	return strings.Join(s, sep)
+}
+
+func formatNpmRange(alts [][]foreignComparator) string {
+	// npm has no != operator, so the excluded versions split an alternative
+	// into the parts below, between and above them.
+	var expanded [][]foreignComparator
+	for _, conj := range alts {
+		var bounds []foreignComparator
+		var excl []semver.Version
+		for _, cmp := range conj {
+			if cmp.op != "!=" {
+				bounds = append(bounds, cmp)
+			} else if sv, err := semver.NewVersion(cmp.v); err == nil {
+				excl = append(excl, sv)
+			}
+		}
+		if len(excl) == 0 {
+			expanded = append(expanded, conj)
+			continue
+		}
+
+		sort.Slice(excl, func(i, j int) bool { return excl[i].LessThan(excl[j]) })
+		for i := 0; i <= len(excl); i++ {
+			part := append([]foreignComparator(nil), bounds...)
+			if i > 0 {
+				part = append(part, foreignComparator{op: ">", v: excl[i-1].String()})
+			}
+			if i < len(excl) {
+				part = append(part, foreignComparator{op: "<", v: excl[i].String()})
+			}
+			expanded = append(expanded, part)
+		}
+	}
+
+	s := make([]string, len(expanded))
+	for i, conj := range expanded {
+		if len(conj) == 1 && conj[0].op == "=" {
+			// A bare version is exact in npm.
+			s[i] = conj[0].v
+			continue
+		}
+		s[i] = foreignConjunction(conj, " ")
+	}
+	return strings.Join(s, " || ")
+}
+
+func formatCargoRequirement(c Constraint, alts [][]foreignComparator) (string, error) {
+	if len(alts) != 1 {
+		return "", errors.Errorf("cargo cannot express the union %s", c)
+	}
+	for _, cmp := range alts[0] {
+		if cmp.op == "!=" {
+			return "", errors.Errorf("cargo cannot express the exclusion in %s", c)
+		}
+	}
+	return foreignConjunction(alts[0], ", "), nil
+}
+
+func formatGoModVersion(c Constraint, alts [][]foreignComparator) (string, error) {
+	if len(alts) != 1 {
+		return "", errors.Errorf("go.mod cannot express the union %s", c)
+	}
+	for _, cmp := range alts[0] {
+		switch cmp.op {
+		case "=", "^", "~", ">=":
+			return "v" + cmp.v, nil
+		case ">":
+			return "", errors.Errorf("go.mod cannot express the exclusive minimum of %s", c)
+		}
+	}
+	return "", errors.Errorf("go.mod cannot express %s, which has no minimum version", c)
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "testing"
+
+func TestParseForeignConstraint(t *testing.T) {
+	for _, test := range []struct {
+		syntax ConstraintSyntax
+		body   string
+		want   string
+	}{
+		{NpmSyntax, "", "*"},
+		{NpmSyntax, "*", "*"},
+		{NpmSyntax, "1.2.3", "1.2.3"},
+		{NpmSyntax, "=v1.2.3", "1.2.3"},
+		{NpmSyntax, "^1.2.3", "^1.2.3"},
+		{NpmSyntax, "^0.2.3", "^0.2.3"},
+		{NpmSyntax, "^0.0.3", ">=0.0.3, <0.0.4"},
+		{NpmSyntax, "^0.0", "^0.0.0"},
+		{NpmSyntax, "^1.x", "^1.0.0"},
+		{NpmSyntax, "~1.2.3", "~1.2.3"},
+		{NpmSyntax, "~1", "^1.0.0"},
+		{NpmSyntax, "1.2.x", "~1.2.0"},
+		{NpmSyntax, "1", "^1.0.0"},
+		{NpmSyntax, ">1.2", ">=1.3.0"},
+		{NpmSyntax, "<=1.2", "<1.3.0"},
+		{NpmSyntax, ">= 1.2.3 < 2", "^1.2.3"},
+		{NpmSyntax, "1.2 - 2.3.4", ">=1.2.0, <=2.3.4"},
+		{NpmSyntax, "1.2.3 - 2", ">=1.2.3, <3.0.0"},
+		{NpmSyntax, "^1.2.3-beta.2", "^1.2.3-beta.2"},
+		{NpmSyntax, "1.2.x || >=2.1 <3", "~1.2.0 || ^2.1.0"},
+		{NpmSyntax, "^1.0.0 || *", "*"},
+		{CargoSyntax, "1.2.3", "^1.2.3"},
+		{CargoSyntax, "0.0.3", ">=0.0.3, <0.0.4"},
+		{CargoSyntax, "=0.0.3", "0.0.3"},
+		{CargoSyntax, "~1.2", "~1.2.0"},
+		{CargoSyntax, "1.*", "^1.0.0"},
+		{CargoSyntax, "*", "*"},
+		{CargoSyntax, ">= 1.2, < 1.5", ">=1.2.0, <1.5.0"},
+		{GoModSyntax, "v1.2.3", "^1.2.3"},
+		{GoModSyntax, "v0.2.3", ">=0.2.3, <1.0.0"},
+		{GoModSyntax, "v2.1.0+incompatible", "^2.1.0"},
+		{GoModSyntax, "v1.3.0-rc.1", "^1.3.0-rc.1"},
+	} {
+		c, err := ParseForeignConstraint(test.body, test.syntax)
+		if err != nil {
+			t.Errorf("unexpected error parsing %s constraint %q: %v", test.syntax, test.body, err)
+			continue
+		}
+		if c.String() != test.want {
+			t.Errorf("expected %s constraint %q to be %q, got %q", test.syntax, test.body, test.want, c)
+		}
+	}
+
+	for _, test := range []struct {
+		syntax ConstraintSyntax
+		body   string
+	}{
+		{NpmSyntax, "^1.2.3 || bogus"},
+		{NpmSyntax, ">*"},
+		{NpmSyntax, ">2.0.0 <1.0.0"},
+		{CargoSyntax, ""},
+		{CargoSyntax, "1.0 || 2.0"},
+		{GoModSyntax, "1.2.3"},
+		{GoModSyntax, "v1.2"},
+		{GoModSyntax, "v0.0.0-20180917221912-90fa682c2a6e"},
+		{GoModSyntax, "v1.2.4-0.20180917221912-90fa682c2a6e"},
+		{ConstraintSyntax(9), "1.0.0"},
+	} {
+		if c, err := ParseForeignConstraint(test.body, test.syntax); err == nil {
+			t.Errorf("expected %s constraint %q to be rejected, got %s", test.syntax, test.body, c)
+		}
+	}
+}
+
+func TestFormatForeignConstraint(t *testing.T) {
+	for _, test := range []struct {
+		c                 Constraint
+		npm, cargo, gomod string
+	}{
+		{Any(), "*", "*", ""},
+		{NewVersion("1.2.3"), "1.2.3", "=1.2.3", "v1.2.3"},
+		{NewVersion("1.2.3").Pair("abc123"), "1.2.3", "=1.2.3", "v1.2.3"},
+		{testSemverConstraint(t, "^1.2.0"), "^1.2.0", "^1.2.0", "v1.2.0"},
+		{testSemverConstraint(t, "^0.2.0"), "^0.2.0", "^0.2.0", "v0.2.0"},
+		{testSemverConstraint(t, "^0.0.3"), ">=0.0.3 <0.1.0", ">=0.0.3, <0.1.0", "v0.0.3"},
+		{testSemverConstraint(t, "~1.2.0"), "~1.2.0", "~1.2.0", "v1.2.0"},
+		{testSemverConstraint(t, ">=1.0.0, <1.5.0"), ">=1.0.0 <1.5.0", ">=1.0.0, <1.5.0", "v1.0.0"},
+		{testSemverConstraint(t, ">1.0.0"), ">1.0.0", ">1.0.0", ""},
+		{testSemverConstraint(t, "<2.0.0"), "<2.0.0", "<2.0.0", ""},
+		{testSemverConstraint(t, "^1.0.0, !=1.3.0, !=1.2.0"), "^1.0.0 <1.2.0 || ^1.0.0 >1.2.0 <1.3.0 || ^1.0.0 >1.3.0", "", "v1.0.0"},
+		{testSemverConstraint(t, "^1.0.0 || ^3.0.0"), "^1.0.0 || ^3.0.0", "", ""},
+		{NewBranch("master"), "", "", ""},
+		{Revision("abc123"), "", "", ""},
+	} {
+		for syntax, want := range map[ConstraintSyntax]string{
+			NpmSyntax:   test.npm,
+			CargoSyntax: test.cargo,
+			GoModSyntax: test.gomod,
+		} {
+			got, err := FormatForeignConstraint(test.c, syntax)
+			switch {
+			case want == "" && err == nil:
+				t.Errorf("expected %s not to be expressible in %s, got %q", test.c, syntax, got)
+			case want != "" && err != nil:
+				t.Errorf("unexpected error formatting %s in %s: %v", test.c, syntax, err)
+			case got != want:
+				t.Errorf("expected %s to be %q in %s, got %q", test.c, want, syntax, got)
+			}
+		}
+	}
+}
+
+func TestForeignConstraintRoundTrip(t *testing.T) {
+	var versions []Version
+	for _, v := range []string{"0.0.3", "0.0.5", "0.1.0", "0.2.1", "0.3.0", "1.0.0", "1.1.0", "1.2.0", "1.2.3", "1.2.5", "1.3.0", "1.4.9", "1.5.0", "2.0.0", "3.1.0", "4.0.0"} {
+		versions = append(versions, NewVersion(v))
+	}
+
+	for _, body := range []string{
+		"^1.2.0", "^0.2.0", "^0.0.3", "~1.2.0", ">=1.0.0, <1.5.0", "1.2.3",
+		"^1.0.0, !=1.2.0, !=1.3.0", "^1.0.0 || ^3.0.0", ">1.0.0, <=2.0.0",
+	} {
+		c := testSemverConstraint(t, body)
+		for _, syntax := range []ConstraintSyntax{NpmSyntax, CargoSyntax} {
+			s, err := FormatForeignConstraint(c, syntax)
+			if err != nil {
+				continue
+			}
+			back, err := ParseForeignConstraint(s, syntax)
+			if err != nil {
+				t.Errorf("unexpected error parsing %s back from %s %q: %v", body, syntax, s, err)
+				continue
+			}
+			// Exclusions come back as unions, so only the versions admitted
+			// can be compared.
+			for _, v := range versions {
+				if back.Matches(v) != c.Matches(v) {
+					t.Errorf("expected %s to survive a round trip through %s %q, but %s admits %s differently", body, syntax, s, back, v)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+// SuggestConstraint returns the constraint that a manifest would idiomatically
+// declare on a project, given the version of it that is currently in use, if
+// any, and the versions it has released, if known - as when a manifest is
+// generated from the projects found in GOPATH or a vendor directory.
+//
+// A semantic version suggests a caret range from it, such as ^1.2.3, which
+// admits later versions with the same major version; a branch or other tag
+// suggests itself. A revision suggests a caret range from the newest semantic
+// version among the released versions that is paired with it, or else the
+// branch paired with it, or else the revision itself. With no version in use,
+// the newest semantic version that is released and not a prerelease suggests a
+// caret range, and if there is none, any version is suggested.
+//
+// The released versions are typically those returned by
+// SourceManager.ListVersions, which pairs them with their revisions.
+func SuggestConstraint(current Version, released []Version) Constraint {
+	if pv, ok := current.(PairedVersion); ok {
+		current = pv.Unpair()
+	}
+
+	switch tv := current.(type) {
+	case semVersion:
+		return caretFrom(tv)
+	case UnpairedVersion:
+		return tv
+	case Revision:
+		var branch Version
+		for _, v := range sortedForUpgrade(released) {
+			pv, ok := v.(PairedVersion)
+			if !ok || pv.Revision() != tv {
+				continue
+			}
+			switch uv := pv.Unpair().(type) {
+			case semVersion:
+				return caretFrom(uv)
+			case branchVersion:
+				if branch == nil {
+					branch = uv
+				}
+			}
+		}
+		if branch != nil {
+			return branch
+		}
+		return tv
+	}
+
+	for _, v := range sortedForUpgrade(released) {
+		if pv, ok := v.(PairedVersion); ok {
+			v = pv.Unpair()
+		}
+		if sv, ok := v.(semVersion); ok && sv.sv.Prerelease() == "" {
+			return caretFrom(sv)
+		}
+	}
+	return Any()
+}
+
+// caretFrom returns the caret range from the semantic version.
+func caretFrom(v semVersion) Constraint {
+	c, err := NewSemverConstraintIC(v.String())
+	if err != nil {
+		// Every semantic version is a valid caret range.
+		panic(err)
+	}
+	return c
+}
+
+// sortedForUpgrade returns a copy of vl, sorted as by SortForUpgrade.
+func sortedForUpgrade(vl []Version) []Version {
+	sorted := append([]Version(nil), vl...)
+	SortForUpgrade(sorted)
+	return sorted
+}
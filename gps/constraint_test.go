@@ -697,6 +697,84 @@ func TestSemverConstraint_ImpliedCaret(t *testing.T) {
 	}
 }
 
+func TestSemverConstraintExpressions(t *testing.T) {
+	cases := []struct {
+		body       string
+		ic         bool
+		match, not []string
+	}{
+		{
+			body:  "(^1.2.0 || ^2.0.0) && !=2.3.1 ",
+			match: []string{"1.2.0", "1.9.9", "2.0.0", "2.3.0", "2.3.2"},
+			not:   []string{"1.1.0", "2.3.1", "3.0.0"},
+		},
+		{
+			// && binds more tightly than ||.
+			body:  "^1.0.0 || ^2.0.0 && !=2.3.1 && !=1.5.0",
+			match: []string{"1.5.0", "2.3.0"},
+			not:   []string{"2.3.1", "3.0.0"},
+		},
+		{
+			// Terms may themselves use the semver package's syntax.
+			body:  "(>=1.0.0, <1.4.0) && (1.2.0 - 1.3.0)",
+			match: []string{"1.2.0", "1.3.0"},
+			not:   []string{"1.1.0", "1.3.1"},
+		},
+		{
+			body:  "(1.2.0 || 2.0.0) && !=2.3.1",
+			ic:    true,
+			match: []string{"1.2.0", "2.4.0"},
+			not:   []string{"2.3.1", "3.0.0"},
+		},
+	}
+
+	for _, c := range cases {
+		ctor := NewSemverConstraint
+		if c.ic {
+			ctor = NewSemverConstraintIC
+		}
+		con, err := ctor(c.body)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.body, err)
+			continue
+		}
+		for _, v := range c.match {
+			if !con.Matches(NewVersion(v)) {
+				t.Errorf("%q: expected %s to match", c.body, v)
+			}
+		}
+		for _, v := range c.not {
+			if con.Matches(NewVersion(v)) {
+				t.Errorf("%q: expected %s not to match", c.body, v)
+			}
+		}
+
+		// The compiled constraint is plain semver syntax, so it survives
+		// serialization.
+		rt, err := NewSemverConstraint(con.String())
+		if err != nil {
+			t.Errorf("%q: could not parse compiled form %q: %s", c.body, con, err)
+		} else if !con.identical(rt) {
+			t.Errorf("%q: compiled form %q did not round trip, got %q", c.body, con, rt)
+		}
+	}
+
+	for _, body := range []string{
+		"(^1.0.0",
+		"^1.0.0)",
+		"^1.0.0 &&",
+		"&& ^1.0.0",
+		"() || ^1.0.0",
+		"(^1.0.0) (^2.0.0)",
+		"(^1.0.0 && foo)",
+		"^1.0.0 && ^2.0.0",
+	} {
+		if _, err := NewSemverConstraint(body); err == nil {
+			t.Errorf("%q: expected an error", body)
+		}
+	}
+}
+
 func TestTypedConstraintString(t *testing.T) {
 	// Also tests typedVersionString(), as this nests down into that
 	rev := Revision("flooboofoobooo")
@@ -796,6 +874,9 @@ func TestConstraintEncoding(t *testing.T) {
 		{"ver", NewVersion("test")},
 		{"semver", testSemverConstraint(t, "^1.0.0")},
 		{"rev", Revision("test")},
+		{"union", Union(NewBranch("test"), testSemverConstraint(t, "^1.0.0"), Revision("test"))},
+		{"exclusion", Exclude(Any(), Revision("test"), NewBranch("test"))},
+		{"semver exclusion", Exclude(testSemverConstraint(t, "^1.0.0"), testSemverConstraint(t, "~1.4.0"))},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			var msg pb.Constraint
@@ -826,3 +907,77 @@ func TestConstraintEncoding(t *testing.T) {
 		})
 	}
 }
+
+func TestIntersectTraced(t *testing.T) {
+	if _, _, ok := IntersectTraced().Conflict(); ok {
+		t.Error("expected no conflict in an empty intersection")
+	}
+	if !IsAny(IntersectTraced().Result()) {
+		t.Error("expected the intersection of no constraints to be any")
+	}
+
+	trace := IntersectTraced(mkSVC(">=1.0.0"), mkSVC("<3.0.0"))
+	if _, _, ok := trace.Conflict(); ok {
+		t.Errorf("expected no conflict, as the intersection is %s", trace.Result())
+	}
+	if !trace.Result().identical(mkSVC(">=1.0.0, <3.0.0")) {
+		t.Errorf("unexpected intersection %s", trace.Result())
+	}
+
+	cases := []struct {
+		cs   []Constraint
+		i, j int
+	}{
+		// Directly incompatible requirements, after one that narrowed nothing.
+		{cs: []Constraint{mkSVC(">=1.0.0"), mkSVC("<2.0.0"), mkSVC(">=2.0.0"), mkSVC("<1.0.0")}, i: 1, j: 2},
+		// Requirements that are only incompatible once narrowed by another.
+		{cs: []Constraint{mkSVC("<3.0.0"), mkSVC("<2.0.0 || >=3.0.0"), mkSVC(">=2.0.0")}, i: 1, j: 2},
+		{cs: []Constraint{NewBranch("master"), NewVersion("1.0.0")}, i: 0, j: 1},
+	}
+	for _, c := range cases {
+		trace := IntersectTraced(c.cs...)
+		i, j, ok := trace.Conflict()
+		if !ok || i != c.i || j != c.j {
+			t.Errorf("%v: expected steps %d and %d to conflict, got %d and %d (%v)", c.cs, c.i, c.j, i, j, ok)
+		}
+		if trace.Result() != none {
+			t.Errorf("%v: expected an empty intersection, got %s", c.cs, trace.Result())
+		}
+	}
+}
+
+func TestSuggestConstraint(t *testing.T) {
+	released := []Version{
+		NewVersion("v1.1.0").Pair("r110"),
+		NewVersion("v1.2.0").Pair("r120"),
+		NewVersion("v1.3.0-rc.1").Pair("r130rc"),
+		NewVersion("v1.2.0-beta").Pair("r120"),
+		NewBranch("master").Pair("r120"),
+		NewBranch("develop").Pair("rdev"),
+	}
+
+	cases := []struct {
+		name     string
+		current  Version
+		released []Version
+		want     Constraint
+	}{
+		{"semver", NewVersion("v1.2.3"), nil, mkSVC("^1.2.3")},
+		{"paired semver", NewVersion("0.4.1").Pair("r"), nil, mkSVC("^0.4.1")},
+		{"branch", NewBranch("master").Pair("r"), nil, NewBranch("master")},
+		{"plain version", NewVersion("v1.x-legacy"), nil, NewVersion("v1.x-legacy")},
+		{"revision of a release", Revision("r120"), released, mkSVC("^1.2.0")},
+		{"revision of a branch", Revision("rdev"), released, NewBranch("develop")},
+		{"unreleased revision", Revision("rnone"), released, Revision("rnone")},
+		{"newest release", nil, released, mkSVC("^1.2.0")},
+		{"nothing released", nil, []Version{NewBranch("master")}, Any()},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := SuggestConstraint(c.current, c.released); !got.identical(c.want) {
+				t.Errorf("expected %s to be suggested, got %s", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+)
+
+// The kinds of the text forms of Constraints, which precede the body of all
+// but the any and none constraints, separated from it by a colon.
+const (
+	textAny           = "any"
+	textNone          = "none"
+	textRevision      = "revision"
+	textBranch        = "branch"
+	textDefaultBranch = "default-branch"
+	textVersion       = "version"
+	textSemver        = "semver"
+	textUnion         = "union"
+	textExclude       = "exclude"
+	textChannel       = "channel"
+
+	// textPrereleases introduces the prerelease policy of a semver
+	// constraint, appended to its kind after a semicolon.
+	textPrereleases = ";prereleases="
+)
+
+// textChannelBody is the JSON body of the text form of a channel constraint.
+type textChannelBody struct {
+	Channels []ReleaseChannel `json:"channels"`
+	Within   string           `json:"within"`
+}
+
+// constraintText returns the text form of c.
+func constraintText(c Constraint) (string, error) {
+	switch tc := c.(type) {
+	case anyConstraint:
+		return textAny, nil
+	case noneConstraint:
+		return textNone, nil
+	case Revision:
+		return textRevision + ":" + string(tc), nil
+	case branchVersion:
+		if tc.isDefault {
+			return textDefaultBranch + ":" + tc.name, nil
+		}
+		return textBranch + ":" + tc.name, nil
+	case plainVersion:
+		return textVersion + ":" + string(tc), nil
+	case semVersion:
+		return textSemver + ":" + tc.String(), nil
+	case versionPair:
+		up, err := constraintText(tc.v)
+		if err != nil {
+			return "", err
+		}
+		return textRevision + ":" + string(tc.r) + " " + up, nil
+	case semverConstraint:
+		if tc.pre != ExcludePrereleases {
+			return textSemver + textPrereleases + tc.pre.String() + ":" + tc.c.String(), nil
+		}
+		return textSemver + ":" + tc.c.String(), nil
+	case unionConstraint:
+		return compositeText(textUnion, tc...)
+	case exclusionConstraint:
+		return compositeText(textExclude, append([]Constraint{tc.base}, tc.excl...)...)
+	case channelConstraint:
+		within, err := constraintText(tc.within)
+		if err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(textChannelBody{Channels: tc.chans, Within: within})
+		if err != nil {
+			return "", err
+		}
+		return textChannel + ":" + string(b), nil
+	}
+	return "", errors.Errorf("no text form for constraints of type %T", c)
+}
+
+// compositeText returns the text form of the kind with the members cs.
+func compositeText(kind string, cs ...Constraint) (string, error) {
+	members := make([]string, len(cs))
+	for i, c := range cs {
+		text, err := constraintText(c)
+		if err != nil {
+			return "", err
+		}
+		members[i] = text
+	}
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	return kind + ":" + string(b), nil
+}
+
+// UnmarshalConstraint returns the Constraint whose text form, as returned by
+// its MarshalText method, is text.
+//
+// A Constraint's String form is meant for people, and cannot always be fed back
+// into NewSemverConstraint or InferConstraint to get the same Constraint: a
+// branch and a tag may share a name, unions and exclusions of versions that are
+// not semver have no syntax there, and neither do prerelease policies. Its text
+// form can. It is the Constraint's kind, such as "branch" or "semver", followed
+// by a colon and its body:
+//
+//	any
+//	none
+//	revision:2d3d6a8b1e4f277cdf4c4a3e4e5b1f3c9d4a5b6c
+//	branch:master
+//	default-branch:master
+//	version:v1.x-legacy
+//	semver:v1.2.3
+//	semver:^1.2.0, !=1.3.0
+//	semver;prereleases=allow:^1.2.0
+//	union:["branch:master","semver:^1.0.0"]
+//	exclude:["any","version:1.4.2","branch:broken-ci"]
+//	channel:{"channels":[{"Name":"stable","Releases":true}],"within":"any"}
+//
+// The bodies of unions, exclusions and channel constraints are JSON, with their
+// members in their own text forms; an exclusion's base comes first. A paired
+// version is the text form of its revision, a space, and that of its unpaired
+// version, as revisions never contain spaces:
+//
+//	revision:2d3d6a8b1e4f277cdf4c4a3e4e5b1f3c9d4a5b6c semver:v1.2.3
+//
+// The text form is canonical. Semver bodies are normalized by the semver
+// package, so that ">=1.2.0, <2.0.0" and "^1.2" are both "semver:^1.2.0", and
+// the members of unions and exclusions are in the order the constraints keep
+// them in. Identical Constraints therefore have identical text forms, and a
+// Constraint read back from its text form is identical to the original.
+func UnmarshalConstraint(text []byte) (Constraint, error) {
+	c, err := parseConstraintText(string(text))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid constraint text %q", text)
+	}
+	return c, nil
+}
+
+// UnmarshalVersion returns the Version whose text form, as returned by its
+// MarshalText method, is text. Text forms of Constraints that are not Versions
+// are rejected.
+func UnmarshalVersion(text []byte) (Version, error) {
+	c, err := UnmarshalConstraint(text)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := c.(Version)
+	if !ok {
+		return nil, errors.Errorf("constraint text %q is not of a version", text)
+	}
+	return v, nil
+}
+
+func parseConstraintText(text string) (Constraint, error) {
+	switch text {
+	case textAny:
+		return any, nil
+	case textNone:
+		return none, nil
+	}
+
+	i := strings.IndexByte(text, ':')
+	if i == -1 {
+		return nil, errors.New("no kind")
+	}
+	kind, body := text[:i], text[i+1:]
+
+	pre := ExcludePrereleases
+	if j := strings.Index(kind, textPrereleases); j != -1 {
+		p, err := ParsePrereleasePolicy(kind[j+len(textPrereleases):])
+		if err != nil {
+			return nil, err
+		}
+		kind, pre = kind[:j], p
+		if kind != textSemver {
+			return nil, errors.Errorf("%s constraints have no prerelease policy", kind)
+		}
+	}
+
+	switch kind {
+	case textRevision:
+		// A space separates the revision from the version paired with it.
+		j := strings.IndexByte(body, ' ')
+		if j == -1 {
+			return Revision(body), nil
+		}
+		up, err := parseConstraintText(body[j+1:])
+		if err != nil {
+			return nil, err
+		}
+		uv, ok := up.(UnpairedVersion)
+		if !ok {
+			return nil, errors.Errorf("cannot pair a revision with %s", body[j+1:])
+		}
+		return uv.Pair(Revision(body[:j])), nil
+	case textBranch:
+		return NewBranch(body), nil
+	case textDefaultBranch:
+		return newDefaultBranch(body), nil
+	case textVersion:
+		return plainVersion(body), nil
+	case textSemver:
+		if sv, err := semver.NewVersion(body); err == nil && pre == ExcludePrereleases {
+			return semVersion{sv: sv}, nil
+		}
+		c, err := NewSemverConstraint(body)
+		if err != nil {
+			return nil, err
+		}
+		return WithPrereleasePolicy(c, pre), nil
+	case textUnion:
+		cs, err := parseCompositeText(body)
+		if err != nil {
+			return nil, err
+		}
+		return Union(cs...), nil
+	case textExclude:
+		cs, err := parseCompositeText(body)
+		if err != nil {
+			return nil, err
+		}
+		if len(cs) == 0 {
+			return nil, errors.New("exclusion has no base")
+		}
+		return Exclude(cs[0], cs[1:]...), nil
+	case textChannel:
+		var cb textChannelBody
+		if err := json.Unmarshal([]byte(body), &cb); err != nil {
+			return nil, err
+		}
+		if len(cb.Channels) == 0 {
+			return nil, errors.New("channel constraint has no channels")
+		}
+		for _, ch := range cb.Channels {
+			if err := ch.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		within, err := parseConstraintText(cb.Within)
+		if err != nil {
+			return nil, err
+		}
+		return narrowChannels(cb.Channels, within), nil
+	}
+	return nil, errors.Errorf("unknown kind %q", kind)
+}
+
+// parseCompositeText returns the members of the body of the text form of a
+// union or exclusion.
+func parseCompositeText(body string) ([]Constraint, error) {
+	var members []string
+	if err := json.Unmarshal([]byte(body), &members); err != nil {
+		return nil, err
+	}
+	cs := make([]Constraint, len(members))
+	for i, m := range members {
+		c, err := parseConstraintText(m)
+		if err != nil {
+			return nil, err
+		}
+		cs[i] = c
+	}
+	return cs, nil
+}
+
+// MarshalText returns the text form of the revision. See UnmarshalConstraint.
+func (r Revision) MarshalText() ([]byte, error) { return marshalText(r) }
+
+// MarshalText returns the text form of the branch. See UnmarshalConstraint.
+func (v branchVersion) MarshalText() ([]byte, error) { return marshalText(v) }
+
+// MarshalText returns the text form of the version. See UnmarshalConstraint.
+func (v plainVersion) MarshalText() ([]byte, error) { return marshalText(v) }
+
+// MarshalText returns the text form of the version. See UnmarshalConstraint.
+func (v semVersion) MarshalText() ([]byte, error) { return marshalText(v) }
+
+// MarshalText returns the text form of the paired version. See
+// UnmarshalConstraint.
+func (v versionPair) MarshalText() ([]byte, error) { return marshalText(v) }
+
+// MarshalText returns the text form of the constraint. See
+// UnmarshalConstraint.
+func (c semverConstraint) MarshalText() ([]byte, error) { return marshalText(c) }
+
+// MarshalText returns the text form of the constraint. See
+// UnmarshalConstraint.
+func (c anyConstraint) MarshalText() ([]byte, error) { return marshalText(c) }
+
+// MarshalText returns the text form of the constraint. See
+// UnmarshalConstraint.
+func (c noneConstraint) MarshalText() ([]byte, error) { return marshalText(c) }
+
+// MarshalText returns the text form of the constraint. See
+// UnmarshalConstraint.
+func (c unionConstraint) MarshalText() ([]byte, error) { return marshalText(c) }
+
+// MarshalText returns the text form of the constraint. See
+// UnmarshalConstraint.
+func (c exclusionConstraint) MarshalText() ([]byte, error) { return marshalText(c) }
+
+// MarshalText returns the text form of the constraint. See
+// UnmarshalConstraint.
+func (c channelConstraint) MarshalText() ([]byte, error) { return marshalText(c) }
+
+func marshalText(c Constraint) ([]byte, error) {
+	text, err := constraintText(c)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(text), nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConstraintTextRoundTrip(t *testing.T) {
+	stable, _ := DefaultReleaseChannel("stable")
+	cases := map[string]Constraint{
+		"any":                             Any(),
+		"none":                            none,
+		"revision:abc123":                 Revision("abc123"),
+		"branch:master":                   NewBranch("master"),
+		"default-branch:master":           newDefaultBranch("master"),
+		"version:master":                  NewVersion("master"),
+		"semver:v1.2.3":                   NewVersion("v1.2.3"),
+		"revision:abc123 branch:a b@c":    NewBranch("a b@c").Pair("abc123"),
+		"revision:abc123 semver:1.0.0":    NewVersion("1.0.0").Pair("abc123"),
+		"semver:^1.2.0":                   mkSVC(">=1.2.0, <2.0.0"),
+		"semver:^1.2.0, !=1.3.0":          mkSVC("^1.2 && !=1.3.0"),
+		"semver:^1.0.0 || ^3.0.0":         mkSVC("^3.0.0 || ^1.0.0"),
+		"semver;prereleases=allow:^1.0.0": WithPrereleasePolicy(mkSVC("^1.0.0"), AllowPrereleases),
+		`union:["branch:master","version:v1.x-legacy","semver:^1.0.0"]`: Union(mkSVC("^1.0.0"), NewVersion("v1.x-legacy"), NewBranch("master")),
+		`exclude:["any","branch:broken-ci","version:broken"]`:           Exclude(Any(), NewBranch("broken-ci"), NewVersion("broken")),
+		`channel:{"channels":[{"Name":"stable","Releases":true,"Prereleases":false,"Tags":null,"Branch":"","DefaultBranch":false}],"within":"semver;prereleases=allow:^1.0.0"}`: narrowChannels([]ReleaseChannel{stable}, mkSVC("^1.0.0")),
+	}
+	for want, c := range cases {
+		b, err := c.MarshalText()
+		if err != nil {
+			t.Errorf("unexpected error marshaling %s: %s", c, err)
+			continue
+		}
+		if string(b) != want {
+			t.Errorf("unexpected text form of %s:\n\t(GOT): %s\n\t(WNT): %s", c, b, want)
+		}
+
+		got, err := UnmarshalConstraint(b)
+		if err != nil {
+			t.Errorf("unexpected error unmarshaling %s: %s", b, err)
+			continue
+		}
+		if !got.identical(c) {
+			t.Errorf("%s did not round-trip: got %s (%T)", b, got, got)
+		}
+		if _, isv := c.(Version); isv {
+			if _, err := UnmarshalVersion(b); err != nil {
+				t.Errorf("unexpected error unmarshaling %s as a version: %s", b, err)
+			}
+		} else if _, err := UnmarshalVersion(b); err == nil {
+			t.Errorf("expected an error unmarshaling %s as a version", b)
+		}
+	}
+
+	// Constraints marshal as their text forms within JSON, too.
+	b, err := json.Marshal([]Constraint{NewBranch("master"), NewVersion("master")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `["branch:master","version:master"]`; string(b) != want {
+		t.Errorf("unexpected JSON encoding:\n\t(GOT): %s\n\t(WNT): %s", b, want)
+	}
+}
+
+func TestUnmarshalConstraintErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"master",
+		"nonsense:master",
+		"branch;prereleases=allow:master",
+		"semver;prereleases=sometimes:^1.0.0",
+		"semver:not a constraint",
+		"revision:abc123 semver:^1.0.0",
+		"union:[branch:master]",
+		"exclude:[]",
+		`channel:{"channels":[],"within":"any"}`,
+	} {
+		if c, err := UnmarshalConstraint([]byte(text)); err == nil {
+			t.Errorf("expected an error unmarshaling %q, got %s", text, c)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/golang/dep/gps/internal/pb"
+)
+
+// Union returns a Constraint that admits every version admitted by any of the
+// provided constraints, such as either the master branch or ^1.0.0.
+//
+// Semver constraints among the operands are merged into a single semver
+// constraint, and operands that admit nothing are dropped. If all the operands
+// reduce to a single constraint, that constraint is returned; a union of no
+// constraints is the none constraint.
+func Union(cs ...Constraint) Constraint {
+	var flat []Constraint
+	for _, c := range cs {
+		if uc, ok := c.(unionConstraint); ok {
+			flat = append(flat, uc...)
+		} else {
+			flat = append(flat, c)
+		}
+	}
+
+	var members []Constraint
+	var svs []semver.Constraint
+	// The merged semver constraint admits what any of them does, so the most
+	// permissive of their prerelease policies applies.
+	var pre PrereleasePolicy
+	for _, c := range flat {
+		switch tc := c.(type) {
+		case anyConstraint:
+			return any
+		case noneConstraint:
+		case semverConstraint:
+			svs = append(svs, tc.c)
+			if tc.pre > pre {
+				pre = tc.pre
+			}
+		case semVersion:
+			svs = append(svs, tc.sv)
+		default:
+			members = append(members, c)
+		}
+	}
+
+	if len(svs) > 0 {
+		sc := semver.Union(svs...)
+		switch {
+		case semver.IsAny(sc):
+			return any
+		case semver.IsNone(sc):
+		default:
+			if sv, ok := sc.(semver.Version); ok {
+				members = append(members, semVersion{sv: sv})
+			} else {
+				members = append(members, semverConstraint{c: sc, pre: pre})
+			}
+		}
+	}
+
+	// Order the members canonically, so that unions of the same constraints
+	// are identical, and drop any duplicates.
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].typedString() < members[j].typedString()
+	})
+	u := members[:0]
+	for _, m := range members {
+		if len(u) > 0 && u[len(u)-1].identical(m) {
+			continue
+		}
+		u = append(u, m)
+	}
+
+	switch len(u) {
+	case 0:
+		return none
+	case 1:
+		return u[0]
+	}
+	return unionConstraint(u)
+}
+
+// unionConstraint is the disjunction of two or more constraints, no two of
+// which are semver constraints. It is only constructed by Union.
+type unionConstraint []Constraint
+
+func (c unionConstraint) String() string {
+	s := make([]string, len(c))
+	for i, m := range c {
+		s[i] = m.String()
+	}
+	return strings.Join(s, " || ")
+}
+
+func (c unionConstraint) ImpliedCaretString() string {
+	s := make([]string, len(c))
+	for i, m := range c {
+		s[i] = m.ImpliedCaretString()
+	}
+	return strings.Join(s, " || ")
+}
+
+func (c unionConstraint) typedString() string {
+	s := make([]string, len(c))
+	for i, m := range c {
+		s[i] = m.typedString()
+	}
+	return "union-" + strings.Join(s, " || ")
+}
+
+func (c unionConstraint) Matches(v Version) bool {
+	for _, m := range c {
+		if m.Matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c unionConstraint) MatchesAny(c2 Constraint) bool {
+	for _, m := range c {
+		if m.MatchesAny(c2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersect distributes the intersection over the members of the union, so
+// the result admits whatever any member has in common with c2.
+func (c unionConstraint) Intersect(c2 Constraint) Constraint {
+	rc := make([]Constraint, len(c))
+	for i, m := range c {
+		rc[i] = m.Intersect(c2)
+	}
+	return Union(rc...)
+}
+
+func (c unionConstraint) identical(c2 Constraint) bool {
+	uc2, ok := c2.(unionConstraint)
+	if !ok || len(c) != len(uc2) {
+		return false
+	}
+	for i, m := range c {
+		if !m.identical(uc2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c unionConstraint) copyTo(msg *pb.Constraint) {
+	msg.Type = pb.Constraint_Union
+	msg.Value = c.String()
+	msg.Members = make([]*pb.Constraint, len(c))
+	for i, m := range c {
+		msg.Members[i] = &pb.Constraint{}
+		m.copyTo(msg.Members[i])
+	}
+}
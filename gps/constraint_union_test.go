@@ -0,0 +1,100 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "testing"
+
+func TestUnionConstraintOps(t *testing.T) {
+	master := NewBranch("master")
+	rev := Revision("fozzie bear")
+	c1x := testSemverConstraint(t, "1.x")
+	c3x := testSemverConstraint(t, "3.x")
+
+	u := Union(master, c1x, c3x)
+	if _, ok := u.(unionConstraint); !ok {
+		t.Fatalf("expected a union of a branch and semver ranges, got %T", u)
+	}
+	if len(u.(unionConstraint)) != 2 {
+		t.Errorf("expected the semver ranges to be merged into one member, got %q", u)
+	}
+	if u.String() != "master || ^1.0.0 || ^3.0.0" {
+		t.Errorf("unexpected string form of union: %q", u)
+	}
+
+	matches := []struct {
+		v    Version
+		want bool
+	}{
+		{master, true},
+		{NewBranch("develop"), false},
+		{NewVersion("1.2.0"), true},
+		{NewVersion("2.0.0"), false},
+		{NewVersion("3.1.4"), true},
+		{NewVersion("1.2.0").Pair(rev), true},
+		{master.(UnpairedVersion).Pair(rev), true},
+		{rev, false},
+	}
+	for _, m := range matches {
+		if got := u.Matches(m.v); got != m.want {
+			t.Errorf("expected %q to match %s to be %v", u, m.v, m.want)
+		}
+		if got := u.MatchesAny(m.v); got != m.want {
+			t.Errorf("expected %q to match any of %s to be %v", u, m.v, m.want)
+		}
+		if got := m.v.MatchesAny(u); got != m.want {
+			t.Errorf("expected %s to match any of %q to be %v", m.v, u, m.want)
+		}
+	}
+
+	// Intersection distributes over the members, in either direction.
+	intersects := []struct {
+		c    Constraint
+		want Constraint
+	}{
+		{any, u},
+		{none, none},
+		{master, master},
+		{NewVersion("3.1.4"), NewVersion("3.1.4")},
+		{NewVersion("2.0.0"), none},
+		{testSemverConstraint(t, ">=1.5.0, <3.2.0"), testSemverConstraint(t, ">=1.5.0, <2.0.0 || >=3.0.0, <3.2.0")},
+		{rev, none},
+		{Union(master, rev), master},
+		{Union(NewBranch("develop"), rev), none},
+	}
+	for _, i := range intersects {
+		if got := u.Intersect(i.c); !got.identical(i.want) {
+			t.Errorf("expected %q intersected with %q to be %q, got %q", u, i.c, i.want, got)
+		}
+		if got := i.c.Intersect(u); !got.identical(i.want) {
+			t.Errorf("expected %q intersected with %q to be %q, got %q", i.c, u, i.want, got)
+		}
+	}
+
+	reductions := []struct {
+		name string
+		c    Constraint
+		want Constraint
+	}{
+		{"empty", Union(), none},
+		{"all none", Union(none, none), none},
+		{"with any", Union(master, any), any},
+		{"single", Union(master, none), master},
+		{"duplicates", Union(master, rev, NewBranch("master")), Union(rev, master)},
+		{"nested", Union(Union(master, c1x), c3x), u},
+		{"semver only", Union(c1x, c3x), testSemverConstraint(t, "1.x || 3.x")},
+	}
+	for _, r := range reductions {
+		if !r.c.identical(r.want) {
+			t.Errorf("%s: expected union to reduce to %q, got %q", r.name, r.want, r.c)
+		}
+	}
+
+	if !IsSubsetOf(master, u) || !IsSubsetOf(testSemverConstraint(t, "~3.1.0"), u) {
+		t.Errorf("expected a member and a range within a member to be subsets of %q", u)
+	}
+	if IsSubsetOf(u, master) || !IsSubsetOf(u, Union(u, rev)) {
+		t.Errorf("expected %q to be a subset only of constraints containing all of its members", u)
+	}
+}
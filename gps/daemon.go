@@ -0,0 +1,851 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"encoding/gob"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/dep/gps/internal/pb"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// Operations understood by a SourceManagerDaemon. Save for opPing, each
+// corresponds to the SourceManager method of the same name.
+const (
+	opPing                = "Ping"
+	opSourceExists        = "SourceExists"
+	opSyncSourceFor       = "SyncSourceFor"
+	opListVersions        = "ListVersions"
+	opRevisionPresentIn   = "RevisionPresentIn"
+	opVersionsForRevision = "VersionsForRevision"
+	opListPackages        = "ListPackages"
+	opGetManifestAndLock  = "GetManifestAndLock"
+	opExportProject       = "ExportProject"
+	opExportPrunedProject = "ExportPrunedProject"
+	opDiffRevisions       = "DiffRevisions"
+	opDeduceProjectRoot   = "DeduceProjectRoot"
+	opSourceURLsForPath   = "SourceURLsForPath"
+	opInferConstraint     = "InferConstraint"
+	opDeprecations        = "Deprecations"
+)
+
+var errDaemonClosed = errors.New("source manager daemon is closed")
+
+// SourceManagerDaemon serves a SourceManager to SourceManagerClients in other
+// processes.
+//
+// A single long-running daemon holds the SourceManager, and with it the lock
+// on the cache directory, so that short-lived processes using a client neither
+// contend for that lock nor pay to set up sources and repopulate their
+// metadata on every invocation.
+type SourceManagerDaemon struct {
+	sm      SourceManager
+	an      ProjectAnalyzer
+	refresh time.Duration
+
+	mu       sync.Mutex
+	ls       map[net.Listener]struct{}
+	quit     chan struct{}
+	closed   bool
+	stopped  sync.WaitGroup
+	quitOnce sync.Once
+}
+
+// NewSourceManagerDaemon returns a daemon that serves sm, ready to Serve
+// clients.
+//
+// Manifests and locks are derived with an, and clients must present an
+// analyzer with the same ProjectAnalyzerInfo when calling GetManifestAndLock.
+//
+// If refresh is positive and sm is a *SourceMgr, the daemon also brings every
+// source sm has used up to date at that interval, fetching their repositories
+// and reloading their version lists, so that they are already hot when next
+// requested.
+func NewSourceManagerDaemon(sm SourceManager, an ProjectAnalyzer, refresh time.Duration) *SourceManagerDaemon {
+	d := &SourceManagerDaemon{
+		sm:      sm,
+		an:      an,
+		refresh: refresh,
+		ls:      make(map[net.Listener]struct{}),
+		quit:    make(chan struct{}),
+	}
+
+	if srcMgr, ok := sm.(*SourceMgr); ok && refresh > 0 {
+		d.stopped.Add(1)
+		go d.refreshLoop(srcMgr)
+	}
+	return d
+}
+
+// Serve accepts connections on l, serving a single call on each, until the
+// daemon is closed. It returns nil if it stopped because of Close, and
+// otherwise the error with which accepting failed.
+func (d *SourceManagerDaemon) Serve(l net.Listener) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		l.Close()
+		return errDaemonClosed
+	}
+	d.ls[l] = struct{}{}
+	d.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-d.quit:
+				return nil
+			default:
+			}
+			return err
+		}
+		go d.serveConn(conn)
+	}
+}
+
+// Close stops the daemon from accepting connections, and stops refreshing
+// sources. Calls already in flight are allowed to finish.
+//
+// Close does not release the SourceManager; that remains the responsibility of
+// the caller.
+func (d *SourceManagerDaemon) Close() error {
+	d.mu.Lock()
+	d.closed = true
+	for l := range d.ls {
+		l.Close()
+	}
+	d.mu.Unlock()
+
+	d.quitOnce.Do(func() { close(d.quit) })
+	d.stopped.Wait()
+	return nil
+}
+
+func (d *SourceManagerDaemon) refreshLoop(sm *SourceMgr) {
+	defer d.stopped.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-d.quit
+		cancel()
+	}()
+
+	t := time.NewTicker(d.refresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-d.quit:
+			return
+		case <-t.C:
+			sm.refreshSources(ctx)
+		}
+	}
+}
+
+// refreshSources brings every source the SourceMgr has used up to date.
+// Failures are logged rather than returned, so that one unreachable source
+// does not keep the others from being refreshed.
+func (sm *SourceMgr) refreshSources(ctx context.Context) {
+	for _, sg := range sm.srcCoord.gateways() {
+		if atomic.LoadInt32(&sm.releasing) == 1 || ctx.Err() != nil {
+			return
+		}
+		if err := sg.refresh(ctx); err != nil {
+			sm.srcCoord.logger.Println(errors.Wrapf(err, "failed to refresh %s", sg.src.upstreamURL()))
+		}
+	}
+}
+
+func (d *SourceManagerDaemon) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	var req daemonRequest
+	if err := gob.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	// Clients send nothing more after their request, so a read only returns
+	// once the client has hung up; if it did so before receiving its
+	// response, it has abandoned the call.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		conn.Read(make([]byte, 1))
+		cancel()
+	}()
+
+	resp := d.handle(ctx, req)
+	gob.NewEncoder(conn).Encode(&resp)
+}
+
+// handle performs a single call on behalf of a client.
+func (d *SourceManagerDaemon) handle(ctx context.Context, req daemonRequest) daemonResponse {
+	var resp daemonResponse
+	id := req.ident()
+
+	err := func() error {
+		switch req.Op {
+		case opPing:
+			return nil
+		case opSourceExists:
+			var err error
+			resp.Bool, err = d.sm.SourceExists(id)
+			return err
+		case opSyncSourceFor:
+			return d.sm.SyncSourceFor(id)
+		case opListVersions:
+			pvs, err := d.sm.ListVersions(id)
+			for _, pv := range pvs {
+				resp.Versions = append(resp.Versions, toDaemonVersion(pv))
+			}
+			return err
+		case opRevisionPresentIn:
+			var err error
+			resp.Bool, err = d.sm.RevisionPresentIn(id, Revision(req.From))
+			return err
+		case opVersionsForRevision:
+			uvs, err := d.sm.VersionsForRevision(id, Revision(req.From))
+			for _, uv := range uvs {
+				resp.Versions = append(resp.Versions, toDaemonVersion(uv))
+			}
+			return err
+		case opListPackages:
+			v, err := req.Version.version()
+			if err != nil {
+				return err
+			}
+			ptree, err := d.sm.ListPackages(id, v)
+			resp.Tree = toDaemonPackageTree(ptree)
+			return err
+		case opGetManifestAndLock:
+			if req.Analyzer != d.an.Info() {
+				return errors.Errorf("source manager daemon analyzes projects with %s, not %s", d.an.Info(), req.Analyzer)
+			}
+			v, err := req.Version.version()
+			if err != nil {
+				return err
+			}
+			m, l, err := d.sm.GetManifestAndLock(id, v, d.an)
+			resp.Manifest = toDaemonManifest(m)
+			resp.Lock = toDaemonLock(l)
+			return err
+		case opExportProject:
+			v, err := req.Version.version()
+			if err != nil {
+				return err
+			}
+			return d.sm.ExportProject(ctx, id, v, req.Path)
+		case opExportPrunedProject:
+			lp, err := lockedProjectFromCache(&req.Project)
+			if err != nil {
+				return err
+			}
+			return d.sm.ExportPrunedProject(ctx, lp, req.Prune, req.Path)
+		case opDiffRevisions:
+			var err error
+			resp.Changes, err = d.sm.DiffRevisions(ctx, id, Revision(req.From), Revision(req.To), req.Stats)
+			return err
+		case opDeduceProjectRoot:
+			root, err := d.sm.DeduceProjectRoot(req.Path)
+			resp.Root = string(root)
+			return err
+		case opSourceURLsForPath:
+			urls, err := d.sm.SourceURLsForPath(req.Path)
+			for _, u := range urls {
+				resp.URLs = append(resp.URLs, u.String())
+			}
+			return err
+		case opInferConstraint:
+			c, err := d.sm.InferConstraint(req.Path, id)
+			if c != nil && !IsAny(c) {
+				resp.Constraint = new(pb.Constraint)
+				c.copyTo(resp.Constraint)
+			}
+			return err
+		case opDeprecations:
+			dp, ok := d.sm.(DeprecationProvider)
+			if !ok {
+				return nil
+			}
+			ds, err := dp.Deprecations(id)
+			for _, dep := range ds {
+				resp.Deprecations = append(resp.Deprecations, daemonDeprecation{
+					Version: toDaemonVersion(dep.Version),
+					Reason:  dep.Reason,
+				})
+			}
+			return err
+		}
+		return errors.Errorf("source manager daemon does not understand %q", req.Op)
+	}()
+
+	if err != nil {
+		resp.Err = err.Error()
+		switch cerr := errors.Cause(err).(type) {
+		case *SourceUnreachableError:
+			resp.Unreachable = true
+			resp.Err = cerr.Err.Error()
+		default:
+			resp.Released = cerr == ErrSourceManagerIsReleased
+		}
+	}
+	return resp
+}
+
+// SourceManagerClient is a SourceManager that forwards every call to a
+// SourceManagerDaemon, typically running in another process.
+//
+// Errors are returned as they were reported by the daemon, but only
+// ErrSourceManagerIsReleased and SourceUnreachableError retain their types
+// across the connection.
+type SourceManagerClient struct {
+	network, address string
+	released         int32
+}
+
+var _ SourceManager = &SourceManagerClient{}
+var _ DeprecationProvider = &SourceManagerClient{}
+
+// DialSourceManager returns a client for the SourceManagerDaemon listening at
+// the given network address, as understood by net.Dial. An error is returned if
+// the daemon cannot be reached.
+func DialSourceManager(network, address string) (*SourceManagerClient, error) {
+	c := &SourceManagerClient{network: network, address: address}
+	if _, err := c.do(context.Background(), daemonRequest{Op: opPing}); err != nil {
+		return nil, errors.Wrapf(err, "unable to reach source manager daemon at %s", address)
+	}
+	return c, nil
+}
+
+// do sends req to the daemon over a new connection, and waits for its
+// response. If ctx is canceled first, the connection is abandoned, which
+// cancels the call in the daemon.
+func (c *SourceManagerClient) do(ctx context.Context, req daemonRequest) (*daemonResponse, error) {
+	if atomic.LoadInt32(&c.released) == 1 {
+		return nil, ErrSourceManagerIsReleased
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	resp := new(daemonResponse)
+	err = gob.NewEncoder(conn).Encode(&req)
+	if err == nil {
+		err = gob.NewDecoder(conn).Decode(resp)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.Wrap(err, "lost connection to source manager daemon")
+	}
+
+	switch {
+	case resp.Err == "":
+		return resp, nil
+	case resp.Released:
+		return nil, ErrSourceManagerIsReleased
+	case resp.Unreachable:
+		return nil, &SourceUnreachableError{Ident: req.ident(), Err: errors.New(resp.Err)}
+	}
+	return nil, errors.New(resp.Err)
+}
+
+// SourceExists checks if a repository exists, either upstream or in the
+// daemon's cache, for the provided ProjectIdentifier.
+func (c *SourceManagerClient) SourceExists(id ProjectIdentifier) (bool, error) {
+	resp, err := c.do(context.Background(), identRequest(opSourceExists, id))
+	if err != nil {
+		return false, err
+	}
+	return resp.Bool, nil
+}
+
+// SyncSourceFor will attempt to bring all local information about a source
+// fully up to date.
+func (c *SourceManagerClient) SyncSourceFor(id ProjectIdentifier) error {
+	_, err := c.do(context.Background(), identRequest(opSyncSourceFor, id))
+	return err
+}
+
+// ListVersions retrieves a list of the available versions for a given
+// repository name.
+func (c *SourceManagerClient) ListVersions(id ProjectIdentifier) ([]PairedVersion, error) {
+	resp, err := c.do(context.Background(), identRequest(opListVersions, id))
+	if err != nil {
+		return nil, err
+	}
+
+	pvs := make([]PairedVersion, 0, len(resp.Versions))
+	for _, dv := range resp.Versions {
+		v, err := dv.version()
+		if err != nil {
+			return nil, err
+		}
+		pv, ok := v.(PairedVersion)
+		if !ok {
+			return nil, errors.Errorf("source manager daemon listed unpaired version %s", v)
+		}
+		pvs = append(pvs, pv)
+	}
+	return pvs, nil
+}
+
+// RevisionPresentIn indicates whether the provided Revision is present in the
+// given repository.
+func (c *SourceManagerClient) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
+	req := identRequest(opRevisionPresentIn, id)
+	req.From = string(r)
+	resp, err := c.do(context.Background(), req)
+	if err != nil {
+		return false, err
+	}
+	return resp.Bool, nil
+}
+
+// VersionsForRevision returns the tags and branches in the given repository
+// that currently point at the provided Revision, sorted for upgrade.
+func (c *SourceManagerClient) VersionsForRevision(id ProjectIdentifier, r Revision) ([]UnpairedVersion, error) {
+	req := identRequest(opVersionsForRevision, id)
+	req.From = string(r)
+	resp, err := c.do(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	uvs := make([]UnpairedVersion, 0, len(resp.Versions))
+	for _, dv := range resp.Versions {
+		v, err := dv.version()
+		if err != nil {
+			return nil, err
+		}
+		uv, ok := v.(UnpairedVersion)
+		if !ok {
+			return nil, errors.Errorf("source manager daemon listed %s, which is not an unpaired version", v)
+		}
+		uvs = append(uvs, uv)
+	}
+	return uvs, nil
+}
+
+// ListPackages parses the tree of the Go packages at or below root of the
+// provided ProjectIdentifier, at the provided version.
+func (c *SourceManagerClient) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
+	req := identRequest(opListPackages, id)
+	req.Version = toDaemonVersion(v)
+	resp, err := c.do(context.Background(), req)
+	if err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	return resp.Tree.packageTree(), nil
+}
+
+// GetManifestAndLock returns manifest and lock information for the provided
+// ProjectIdentifier, at the provided Version.
+//
+// The daemon derives them with its own ProjectAnalyzer, which must have the
+// same ProjectAnalyzerInfo as an.
+func (c *SourceManagerClient) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
+	req := identRequest(opGetManifestAndLock, id)
+	req.Version = toDaemonVersion(v)
+	req.Analyzer = an.Info()
+	resp, err := c.do(context.Background(), req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var m Manifest
+	var l Lock
+	if resp.Manifest != nil {
+		if m, err = resp.Manifest.manifest(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if resp.Lock != nil {
+		if l, err = resp.Lock.lock(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return m, l, nil
+}
+
+// ExportProject writes out the tree of the provided ProjectIdentifier's
+// ProjectRoot, at the provided version, to the provided directory.
+//
+// The daemon does the writing, so the directory must be accessible to it.
+func (c *SourceManagerClient) ExportProject(ctx context.Context, id ProjectIdentifier, v Version, to string) error {
+	to, err := filepath.Abs(to)
+	if err != nil {
+		return err
+	}
+
+	req := identRequest(opExportProject, id)
+	req.Version = toDaemonVersion(v)
+	req.Path = to
+	_, err = c.do(ctx, req)
+	return err
+}
+
+// ExportPrunedProject writes out the tree corresponding to the provided
+// LockedProject, the provided version, to the provided directory, applying the
+// provided pruning options.
+//
+// The daemon does the writing, so the directory must be accessible to it.
+func (c *SourceManagerClient) ExportPrunedProject(ctx context.Context, lp LockedProject, prune PruneOptions, to string) error {
+	to, err := filepath.Abs(to)
+	if err != nil {
+		return err
+	}
+
+	req := identRequest(opExportPrunedProject, lp.Ident())
+	copyLockedProjectTo(lp, &req.Project, new(pb.Constraint))
+	req.Prune = prune
+	req.Path = to
+	_, err = c.do(ctx, req)
+	return err
+}
+
+// DiffRevisions reports the files that differ between two revisions of the
+// provided ProjectIdentifier.
+func (c *SourceManagerClient) DiffRevisions(ctx context.Context, id ProjectIdentifier, from, to Revision, stats bool) ([]FileChange, error) {
+	req := identRequest(opDiffRevisions, id)
+	req.From, req.To = string(from), string(to)
+	req.Stats = stats
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Changes, nil
+}
+
+// Deprecations returns the deprecation notices recorded in the repository for
+// the provided ProjectIdentifier, if the daemon's SourceManager provides any.
+func (c *SourceManagerClient) Deprecations(id ProjectIdentifier) ([]Deprecation, error) {
+	resp, err := c.do(context.Background(), identRequest(opDeprecations, id))
+	if err != nil {
+		return nil, err
+	}
+
+	var ds []Deprecation
+	for _, dd := range resp.Deprecations {
+		v, err := dd.Version.version()
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, Deprecation{Version: v, Reason: dd.Reason})
+	}
+	return ds, nil
+}
+
+// DeduceProjectRoot takes an import path and deduces the corresponding
+// project/source root.
+func (c *SourceManagerClient) DeduceProjectRoot(ip string) (ProjectRoot, error) {
+	resp, err := c.do(context.Background(), daemonRequest{Op: opDeduceProjectRoot, Path: ip})
+	if err != nil {
+		return "", err
+	}
+	return ProjectRoot(resp.Root), nil
+}
+
+// SourceURLsForPath takes an import path and deduces the set of source URLs
+// that may refer to a canonical upstream source.
+func (c *SourceManagerClient) SourceURLsForPath(ip string) ([]*url.URL, error) {
+	resp, err := c.do(context.Background(), daemonRequest{Op: opSourceURLsForPath, Path: ip})
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*url.URL, 0, len(resp.URLs))
+	for _, s := range resp.URLs {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
+// InferConstraint tries to puzzle out what kind of version is given in a
+// string. Preference is given first for branches, then semver constraints,
+// then plain tags, and then revisions.
+func (c *SourceManagerClient) InferConstraint(s string, pi ProjectIdentifier) (Constraint, error) {
+	req := identRequest(opInferConstraint, pi)
+	req.Path = s
+	resp, err := c.do(context.Background(), req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Constraint == nil {
+		return Any(), nil
+	}
+	return constraintFromCache(resp.Constraint)
+}
+
+// Release closes the client. It does not release the daemon's SourceManager,
+// which remains available to other clients.
+func (c *SourceManagerClient) Release() {
+	atomic.StoreInt32(&c.released, 1)
+}
+
+// daemonRequest is a call from a SourceManagerClient to a daemon. Fields not
+// used by the operation are left empty.
+type daemonRequest struct {
+	Op           string
+	Root, Source string
+	Version      daemonVersion
+	// From and To are revisions; From alone is used if only one is needed.
+	From, To string
+	Stats    bool
+	// Path is an import path, the input to InferConstraint, or the
+	// destination of an export.
+	Path     string
+	Project  pb.LockedProject
+	Prune    PruneOptions
+	Analyzer ProjectAnalyzerInfo
+}
+
+func identRequest(op string, id ProjectIdentifier) daemonRequest {
+	return daemonRequest{Op: op, Root: string(id.ProjectRoot), Source: id.Source}
+}
+
+func (req daemonRequest) ident() ProjectIdentifier {
+	return ProjectIdentifier{ProjectRoot: ProjectRoot(req.Root), Source: req.Source}
+}
+
+// daemonResponse is a daemon's reply to a daemonRequest.
+type daemonResponse struct {
+	Err string
+	// Unreachable indicates that Err is the cause of a SourceUnreachableError.
+	Unreachable bool
+	// Released indicates that Err is ErrSourceManagerIsReleased.
+	Released bool
+
+	Bool         bool
+	Root         string
+	URLs         []string
+	Versions     []daemonVersion
+	Tree         daemonPackageTree
+	Manifest     *daemonManifest
+	Lock         *daemonLock
+	Changes      []FileChange
+	Constraint   *pb.Constraint
+	Deprecations []daemonDeprecation
+}
+
+// daemonVersion is the serializable form of a Version.
+type daemonVersion struct {
+	// C is the version itself, or the unpaired part of a PairedVersion. It is
+	// nil for a nil Version.
+	C *pb.Constraint
+	// Revision is set if the version is a PairedVersion.
+	Revision string
+}
+
+func toDaemonVersion(v Version) daemonVersion {
+	var dv daemonVersion
+	if v == nil {
+		return dv
+	}
+
+	dv.C = new(pb.Constraint)
+	if pv, ok := v.(PairedVersion); ok {
+		pv.Unpair().copyTo(dv.C)
+		dv.Revision = string(pv.Revision())
+	} else {
+		v.copyTo(dv.C)
+	}
+	return dv
+}
+
+// version returns a Version identical to the one which produced dv.
+func (dv daemonVersion) version() (Version, error) {
+	switch {
+	case dv.C == nil:
+		return nil, nil
+	case dv.C.Type == pb.Constraint_Revision:
+		return Revision(dv.C.Value), nil
+	}
+
+	uv, err := unpairedVersionFromCache(dv.C)
+	if err != nil {
+		return nil, err
+	}
+	if dv.Revision != "" {
+		return uv.Pair(Revision(dv.Revision)), nil
+	}
+	return uv, nil
+}
+
+// daemonPackageTree is the serializable form of a pkgtree.PackageTree.
+type daemonPackageTree struct {
+	ImportRoot string
+	Packages   map[string]daemonPackageOrErr
+}
+
+type daemonPackageOrErr struct {
+	P   pkgtree.Package
+	Err string
+}
+
+func toDaemonPackageTree(ptree pkgtree.PackageTree) daemonPackageTree {
+	dt := daemonPackageTree{
+		ImportRoot: ptree.ImportRoot,
+		Packages:   make(map[string]daemonPackageOrErr, len(ptree.Packages)),
+	}
+	for ip, poe := range ptree.Packages {
+		if poe.Err != nil {
+			dt.Packages[ip] = daemonPackageOrErr{Err: poe.Err.Error()}
+		} else {
+			dt.Packages[ip] = daemonPackageOrErr{P: poe.P}
+		}
+	}
+	return dt
+}
+
+func (dt daemonPackageTree) packageTree() pkgtree.PackageTree {
+	ptree := pkgtree.PackageTree{
+		ImportRoot: dt.ImportRoot,
+		Packages:   make(map[string]pkgtree.PackageOrErr, len(dt.Packages)),
+	}
+	for ip, dpoe := range dt.Packages {
+		if dpoe.Err != "" {
+			ptree.Packages[ip] = pkgtree.PackageOrErr{Err: errors.New(dpoe.Err)}
+		} else {
+			ptree.Packages[ip] = pkgtree.PackageOrErr{P: dpoe.P}
+		}
+	}
+	return ptree
+}
+
+// daemonManifest is the serializable form of a Manifest. Fields other than
+// Constraints are only populated for a RootManifest.
+type daemonManifest struct {
+	Constraints, Overrides []pb.ProjectProperties
+	Ignored, Required      []string
+}
+
+func toDaemonManifest(m Manifest) *daemonManifest {
+	if m == nil {
+		return nil
+	}
+
+	props := func(pc ProjectConstraints) []pb.ProjectProperties {
+		pps := make([]pb.ProjectProperties, 0, len(pc))
+		for ip, pp := range pc {
+			var ms projectPropertiesMsgs
+			ms.copyFrom(ip, pp)
+			pps = append(pps, ms.pp)
+		}
+		return pps
+	}
+
+	dm := &daemonManifest{Constraints: props(m.DependencyConstraints())}
+	if rm, ok := m.(RootManifest); ok {
+		dm.Overrides = props(rm.Overrides())
+		dm.Ignored = rm.IgnoredPackages().ToSlice()
+		for path, req := range rm.RequiredPackages() {
+			if req {
+				dm.Required = append(dm.Required, path)
+			}
+		}
+	}
+	return dm
+}
+
+func (dm *daemonManifest) manifest() (Manifest, error) {
+	constraints := func(pps []pb.ProjectProperties) (ProjectConstraints, error) {
+		pc := make(ProjectConstraints, len(pps))
+		for i := range pps {
+			ip, pp, err := propertiesFromCache(&pps[i])
+			if err != nil {
+				return nil, err
+			}
+			pc[ip] = pp
+		}
+		return pc, nil
+	}
+
+	m := simpleRootManifest{
+		ig:  pkgtree.NewIgnoredRuleset(dm.Ignored),
+		req: make(map[string]bool, len(dm.Required)),
+	}
+	var err error
+	if m.c, err = constraints(dm.Constraints); err != nil {
+		return nil, err
+	}
+	if m.ovr, err = constraints(dm.Overrides); err != nil {
+		return nil, err
+	}
+	for _, path := range dm.Required {
+		m.req[path] = true
+	}
+	return m, nil
+}
+
+// daemonLock is the serializable form of a Lock.
+type daemonLock struct {
+	Projects     []pb.LockedProject
+	InputImports []string
+}
+
+func toDaemonLock(l Lock) *daemonLock {
+	if l == nil {
+		return nil
+	}
+
+	dl := &daemonLock{InputImports: l.InputImports()}
+	for _, lp := range l.Projects() {
+		var msg pb.LockedProject
+		copyLockedProjectTo(lp, &msg, new(pb.Constraint))
+		dl.Projects = append(dl.Projects, msg)
+	}
+	return dl
+}
+
+func (dl *daemonLock) lock() (Lock, error) {
+	l := &safeLock{i: dl.InputImports}
+	for i := range dl.Projects {
+		lp, err := lockedProjectFromCache(&dl.Projects[i])
+		if err != nil {
+			return nil, err
+		}
+		l.p = append(l.p, lp)
+	}
+	return l, nil
+}
+
+// daemonDeprecation is the serializable form of a Deprecation.
+type daemonDeprecation struct {
+	Version daemonVersion
+	Reason  string
+}
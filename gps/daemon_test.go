@@ -0,0 +1,211 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// serveDaemon serves sm with a SourceManagerDaemon on a unix socket, and
+// returns a client connected to it.
+func serveDaemon(t *testing.T, sm SourceManager) (*SourceManagerClient, func()) {
+	dir, err := ioutil.TempDir("", "smdaemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := filepath.Join(dir, "sm.sock")
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	d := NewSourceManagerDaemon(sm, naiveAnalyzer{}, 0)
+	go d.Serve(l)
+	c, err := DialSourceManager("unix", addr)
+	if err != nil {
+		d.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return c, func() {
+		c.Release()
+		d.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDaemonSolve(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+
+	want, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sm := newdepspecSM(fix.ds, nil)
+	c, done := serveDaemon(t, sm)
+	defer done()
+	got, err := fixSolve(params, &daemonFixSM{SourceManagerClient: c, fix: sm}, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	describe := func(soln Solution) map[ProjectIdentifier]string {
+		m := make(map[ProjectIdentifier]string)
+		for _, lp := range soln.Projects() {
+			m[lp.Ident()] = fmt.Sprintf("%s %v", lp.Version(), lp.Packages())
+		}
+		return m
+	}
+	if !reflect.DeepEqual(describe(got), describe(want)) {
+		t.Errorf("solving through the daemon gave a different solution:\n\t(GOT): %v\n\t(WNT): %v", describe(got), describe(want))
+	}
+}
+
+func TestDaemonVersionRoundTrip(t *testing.T) {
+	for _, v := range []Version{
+		nil,
+		Revision("abc123"),
+		NewBranch("master"),
+		NewBranch("master").Pair("abc123"),
+		newDefaultBranch("master").Pair("abc123"),
+		NewVersion("v1.0.0").Pair("abc123"),
+		NewVersion("foo"),
+	} {
+		got, err := toDaemonVersion(v).version()
+		if err != nil {
+			t.Errorf("%v: %s", v, err)
+			continue
+		}
+		if v == nil {
+			if got != nil {
+				t.Errorf("nil version became %v", got)
+			}
+			continue
+		}
+		if !v.identical(got) {
+			t.Errorf("%#v did not survive the round trip, became %#v", v, got)
+		}
+	}
+}
+
+func TestDaemonErrors(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.0.0"),
+		},
+	}
+	sm := &unreachableSM{depspecSourceManager: newdepspecSM(fix.ds, nil), pr: "a"}
+	c, done := serveDaemon(t, sm)
+	defer done()
+
+	id := mkPI("a")
+	_, err := c.ListVersions(id)
+	ue, ok := err.(*SourceUnreachableError)
+	if !ok {
+		t.Fatalf("expected a *SourceUnreachableError, got %T: %v", err, err)
+	}
+	if ue.Ident != id || ue.Err.Error() != "authentication failed" {
+		t.Errorf("unexpected unreachable error: %s", ue)
+	}
+
+	if _, err := c.ListVersions(mkPI("nonexistent")); err == nil {
+		t.Error("expected an error listing versions of a nonexistent project")
+	}
+
+	_, _, err = c.GetManifestAndLock(mkPI("root"), NewVersion("0.0.0"), otherAnalyzer{})
+	if err == nil {
+		t.Error("expected an error getting a manifest with a mismatched analyzer")
+	}
+
+	c.Release()
+	if _, err := c.SourceExists(id); err != ErrSourceManagerIsReleased {
+		t.Errorf("expected ErrSourceManagerIsReleased after release, got %v", err)
+	}
+}
+
+func TestDialSourceManagerUnreachable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smdaemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := DialSourceManager("unix", filepath.Join(dir, "sm.sock")); err == nil {
+		t.Error("expected an error dialing a daemon that is not running")
+	}
+}
+
+func TestDaemonCancel(t *testing.T) {
+	c, done := serveDaemon(t, newdepspecSM(nil, nil))
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.ExportProject(ctx, mkPI("a"), NewVersion("1.0.0"), "a")
+	if err != context.Canceled {
+		t.Errorf("expected a canceled call to return context.Canceled, got %v", err)
+	}
+}
+
+// daemonFixSM sends all SourceManager calls through the daemon, but answers
+// questions about the fixture itself directly.
+type daemonFixSM struct {
+	*SourceManagerClient
+	fix *depspecSourceManager
+}
+
+func (sm *daemonFixSM) rootSpec() depspec       { return sm.fix.rootSpec() }
+func (sm *daemonFixSM) allSpecs() []depspec     { return sm.fix.allSpecs() }
+func (sm *daemonFixSM) ignore() map[string]bool { return sm.fix.ignore() }
+
+type otherAnalyzer struct {
+	naiveAnalyzer
+}
+
+func (otherAnalyzer) Info() ProjectAnalyzerInfo {
+	return ProjectAnalyzerInfo{Name: "other", Version: 1}
+}
+
+func TestDaemonVersionsForRevision(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0"),
+			mkDepspec("a 1.0.0 abc123"),
+			mkDepspec("a 1.1.0 def456"),
+			mkDepspec("a bmaster def456"),
+		},
+	}
+	sm := newdepspecSM(fix.ds, nil)
+	c, done := serveDaemon(t, sm)
+	defer done()
+
+	want, err := sm.VersionsForRevision(mkPI("a"), "def456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.VersionsForRevision(mkPI("a"), "def456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected versions for def456:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
@@ -15,8 +15,10 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/armon/go-radix"
+	"github.com/golang/dep/gps/paths"
 	"github.com/pkg/errors"
 )
 
@@ -314,6 +316,39 @@ func (m gopkginDeducer) deduceSource(p string, u *url.URL) (maybeSources, error)
 	return mb, nil
 }
 
+// ImpliedConstraint returns the constraint that a project's root import path
+// implies on its versions, if it implies one. A gopkg.in path implies the major
+// version it names, as in gopkg.in/yaml.v2, and so does a path ending in a
+// major version suffix of 2 or more, as in example.com/foo/v2.
+func ImpliedConstraint(pr ProjectRoot) (Constraint, bool) {
+	major, ok := impliedMajor(string(pr))
+	if !ok {
+		return nil, false
+	}
+	c, err := NewSemverConstraint(fmt.Sprintf(">=%d.0.0, <%d.0.0", major, major+1))
+	if err != nil {
+		panic(fmt.Sprintf("canary - invalid implied major constraint: %s", err))
+	}
+	return c, true
+}
+
+// majorSuffixRe matches a major version suffix on an import path.
+var majorSuffixRe = regexp.MustCompile(`/v([1-9][0-9]*)$`)
+
+// impliedMajor returns the major version named by the root import path.
+func impliedMajor(root string) (uint64, bool) {
+	if v := gpinNewRegex.FindStringSubmatch(root); v != nil && v[1] == root && !strings.Contains(v[4], ".") {
+		major, err := strconv.ParseUint(strings.TrimSuffix(v[4], gopkgUnstableSuffix)[1:], 10, 64)
+		return major, err == nil
+	}
+
+	if m := majorSuffixRe.FindStringSubmatch(root); m != nil {
+		major, err := strconv.ParseUint(m[1], 10, 64)
+		return major, err == nil && major >= 2
+	}
+	return 0, false
+}
+
 type launchpadDeducer struct {
 	regexp *regexp.Regexp
 }
@@ -487,7 +522,7 @@ func (m vcsExtensionDeducer) deduceSource(path string, u *url.URL) (maybeSources
 	}
 
 	switch v[4] {
-	case "git", "hg", "bzr":
+	case "git", "hg", "bzr", "svn":
 		x := strings.SplitN(v[1], "/", 2)
 		// TODO(sdboyer) is this actually correct for bzr?
 		u.Host = x[0]
@@ -505,6 +540,8 @@ func (m vcsExtensionDeducer) deduceSource(path string, u *url.URL) (maybeSources
 				return maybeSources{maybeBzrSource{url: u}}, nil
 			case "hg":
 				return maybeSources{maybeHgSource{url: u}}, nil
+			case "svn":
+				return maybeSources{maybeSvnSource{url: u}}, nil
 			}
 		}
 
@@ -528,6 +565,11 @@ func (m vcsExtensionDeducer) deduceSource(path string, u *url.URL) (maybeSources
 			f = func(k int, u *url.URL) {
 				mb[k] = maybeHgSource{url: u}
 			}
+		case "svn":
+			schemes = svnSchemes
+			f = func(k int, u *url.URL) {
+				mb[k] = maybeSvnSource{url: u}
+			}
 		}
 
 		mb = make(maybeSources, len(schemes))
@@ -554,11 +596,39 @@ type deducer interface {
 	deduceRootPath(ctx context.Context, path string) (pathDeduction, error)
 }
 
+// metadataCache persists go-get metadata beyond the life of a SourceManager,
+// so that vanity import paths need not be deduced anew on every run.
+type metadataCache interface {
+	// getMetadata returns the metadata cached for the longest prefix of the
+	// import path for which any is, and the URL it was fetched from.
+	getMetadata(path string) (im metaImport, metaURL string, ok bool)
+	// setMetadata caches metadata fetched from metaURL.
+	setMetadata(im metaImport, metaURL string)
+}
+
 type deductionCoordinator struct {
 	suprvsr  *supervisor
 	mut      sync.RWMutex
 	rootxt   *radix.Tree
 	deducext *deducerTrie
+	// private is a comma-separated list of GOPRIVATE-style glob patterns
+	// identifying import paths that must not be exposed over unencrypted
+	// channels.
+	private string
+	// protocols are the preferred protocols for fetching the sources of
+	// import paths, in order of precedence.
+	protocols []sourceProtocol
+	// mirrors are the locations from which the sources of import paths are
+	// fetched in place of those they deduce to.
+	mirrors []sourceMirror
+	// registries are the locations of the registries from which the sources
+	// of import paths are fetched, before those they deduce to.
+	registries []sourceMirror
+	// cache holds the go-get metadata fetched by earlier SourceManagers, if
+	// there is a persistent cache.
+	cache metadataCache
+	// settings govern how go-get metadata is fetched.
+	settings sourceSettings
 }
 
 func newDeductionCoordinator(superv *supervisor) *deductionCoordinator {
@@ -590,8 +660,9 @@ func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string)
 	dc.mut.RUnlock()
 	if has && isPathPrefixOrEqual(prefix, path) {
 		switch d := data.(type) {
-		case maybeSources:
-			return pathDeduction{root: prefix, mb: d}, nil
+		case pathDeduction:
+			d.reason.Cached = true
+			return d, nil
 		case *httpMetadataDeducer:
 			// Multiple calls have come in for a similar path shape during
 			// the window in which the HTTP request to retrieve go get
@@ -606,13 +677,29 @@ func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string)
 
 	// No match. Try known path deduction first.
 	pd, err := dc.deduceKnownPaths(path)
+	mirrored := false
+	if err == nil {
+		pd.mb, mirrored = mirrorSources(dc.mirrors, path, pd.root, pd.mb)
+	}
+	if err == nil && dc.isPrivate(path) {
+		pd.mb, err = secureSources(path, pd.mb)
+		if err != nil {
+			return pathDeduction{}, err
+		}
+	}
+	if protocol := dc.protocolFor(path); err == nil && protocol != "" && !mirrored {
+		pd.mb = preferProtocol(pd.mb, protocol)
+	}
+	if err == nil {
+		pd.mb = registrySources(dc.registries, path, pd.root, dc.isPrivate(path), pd.mb)
+	}
 	if err == nil {
 		// Deduction worked; store it in the rootxt, send on retchan and
 		// terminate.
 		// FIXME(sdboyer) deal with changing path vs. root. Probably needs
 		// to be predeclared and reused in the hmd returnFunc
 		dc.mut.Lock()
-		dc.rootxt.Insert(pd.root, pd.mb)
+		dc.rootxt.Insert(rootxtKey(path, pd.root), pd)
 		dc.mut.Unlock()
 		return pd, nil
 	}
@@ -624,15 +711,21 @@ func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string)
 	// The err indicates no known path matched. It's still possible that
 	// retrieving go get metadata might do the trick.
 	hmd := &httpMetadataDeducer{
-		basePath: path,
-		suprvsr:  dc.suprvsr,
+		basePath:   path,
+		private:    dc.isPrivate(path),
+		protocol:   dc.protocolFor(path),
+		mirrors:    dc.mirrors,
+		registries: dc.registries,
+		cache:      dc.cache,
+		settings:   dc.settings,
+		suprvsr:    dc.suprvsr,
 		// The vanity deducer will call this func with a completed
 		// pathDeduction if it succeeds in finding one. We process it
 		// back through the action channel to ensure serialized
 		// access to the rootxt map.
 		returnFunc: func(pd pathDeduction) {
 			dc.mut.Lock()
-			dc.rootxt.Insert(pd.root, pd.mb)
+			dc.rootxt.Insert(rootxtKey(path, pd.root), pd)
 			dc.mut.Unlock()
 		},
 	}
@@ -647,12 +740,274 @@ func (dc *deductionCoordinator) deduceRootPath(ctx context.Context, path string)
 	return hmd.deduce(ctx, path)
 }
 
+// rootxtKey returns the key under which the deduction of path, whose root is
+// root, is stored in the rootxt. A path with an explicit scheme deduces only
+// to sources with that scheme, and without any mirror or preferred protocol
+// applied, so its deduction is stored under the path itself, rather than
+// under the root, where plain import paths within the root would find it.
+func rootxtKey(path, root string) string {
+	if u, _, err := normalizeURI(path); err == nil && u.Scheme != "" {
+		return path
+	}
+	return root
+}
+
+// isPrivate reports whether the provided import path matches any of the
+// coordinator's private patterns.
+func (dc *deductionCoordinator) isPrivate(path string) bool {
+	if dc.private == "" {
+		return false
+	}
+
+	_, npath, err := normalizeURI(path)
+	if err != nil {
+		// Err on the side of caution.
+		return true
+	}
+	return paths.MatchPrefixPatterns(dc.private, npath)
+}
+
+// insecureSchemes are the URL schemes that communicate with a host over an
+// unencrypted channel.
+var insecureSchemes = map[string]bool{
+	"http": true,
+	"git":  true,
+	"bzr":  true,
+	"svn":  true,
+}
+
+// secureSources filters out all maybeSources that would communicate over an
+// unencrypted channel. It is an error if no sources remain.
+func secureSources(path string, mb maybeSources) (maybeSources, error) {
+	var secure maybeSources
+	for _, m := range mb {
+		if !insecureSchemes[m.URL().Scheme] {
+			secure = append(secure, m)
+		}
+	}
+
+	if len(secure) == 0 {
+		return nil, errors.Errorf("%q is private, but has no sources reachable over a secure channel", path)
+	}
+	return secure, nil
+}
+
+// protocolSchemes maps each protocol that may be preferred for fetching sources
+// to the URL schemes that use it.
+var protocolSchemes = map[string][]string{
+	"https": {"https"},
+	"ssh":   {"ssh", "git+ssh", "bzr+ssh", "svn+ssh"},
+}
+
+// sourceProtocol is a preference for fetching the sources of import paths
+// matching a GOPRIVATE-style glob pattern over a particular protocol.
+type sourceProtocol struct {
+	pattern, protocol string
+}
+
+// parseSourceProtocols parses a comma-separated list of pattern=protocol
+// preferences, such as "github.com/org=ssh,*.corp.example.com=https".
+func parseSourceProtocols(list string) ([]sourceProtocol, error) {
+	var sps []sourceProtocol
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, errors.Errorf("invalid source protocol preference %q: must be of the form pattern=protocol", entry)
+		}
+		sp := sourceProtocol{pattern: entry[:i], protocol: entry[i+1:]}
+		if _, ok := protocolSchemes[sp.protocol]; !ok {
+			return nil, errors.Errorf("invalid source protocol preference %q: protocol must be https or ssh", entry)
+		}
+		sps = append(sps, sp)
+	}
+	return sps, nil
+}
+
+// protocolFor returns the protocol preferred for fetching the source of the
+// provided import path, or the empty string if there is no preference. Paths
+// that name a scheme explicitly have no preference; the scheme is honored.
+func (dc *deductionCoordinator) protocolFor(path string) string {
+	if len(dc.protocols) == 0 {
+		return ""
+	}
+
+	u, npath, err := normalizeURI(path)
+	if err != nil || u.Scheme != "" {
+		return ""
+	}
+	for _, sp := range dc.protocols {
+		if paths.MatchPrefixPatterns(sp.pattern, npath) {
+			return sp.protocol
+		}
+	}
+	return ""
+}
+
+// preferProtocol returns the maybeSources in mb that use the provided protocol.
+// If there are none, the first is rewritten to use it instead, as the protocol
+// by which a source deduced is no indication of which protocols its host
+// supports.
+func preferProtocol(mb maybeSources, protocol string) maybeSources {
+	var preferred maybeSources
+	for _, m := range mb {
+		for _, scheme := range protocolSchemes[protocol] {
+			if m.URL().Scheme == scheme {
+				preferred = append(preferred, m)
+				break
+			}
+		}
+	}
+
+	if len(preferred) > 0 || len(mb) == 0 {
+		return preferred
+	}
+	return maybeSources{withProtocol(mb[0], protocol)}
+}
+
+// withProtocol returns a copy of m whose upstream URL uses the provided
+// protocol.
+func withProtocol(m maybeSource, protocol string) maybeSource {
+	rewrite := func(orig *url.URL, sshScheme, sshUser string) *url.URL {
+		u := *orig
+		switch protocol {
+		case "https":
+			u.Scheme, u.User = "https", nil
+		case "ssh":
+			u.Scheme = sshScheme
+			if u.User == nil && sshUser != "" {
+				u.User = url.User(sshUser)
+			}
+		}
+		return &u
+	}
+
+	switch tm := m.(type) {
+	case maybeGitSource:
+		tm.url = rewrite(tm.url, "ssh", "git")
+		return tm
+	case maybeGopkginSource:
+		tm.url = rewrite(tm.url, "ssh", "git")
+		return tm
+	case maybeBzrSource:
+		tm.url = rewrite(tm.url, "bzr+ssh", "")
+		return tm
+	case maybeHgSource:
+		tm.url = rewrite(tm.url, "ssh", "")
+		return tm
+	case maybeSvnSource:
+		tm.url = rewrite(tm.url, "svn+ssh", "")
+		return tm
+	}
+	return m
+}
+
+// sourceMirror is a location from which the sources of the import paths
+// beneath a prefix are fetched, in place of those they deduce to.
+type sourceMirror struct {
+	prefix string
+	base   *url.URL
+}
+
+// parseSourceMirrors parses a comma-separated list of prefix=url mirrors, such
+// as "github.com=https://git.corp.example.com/github".
+func parseSourceMirrors(list string) ([]sourceMirror, error) {
+	return parsePrefixURLs("source mirror", list)
+}
+
+// parseSourceRegistries parses a comma-separated list of prefix=url
+// registries, such as "github.com=https://artifacts.corp.example.com/dep".
+func parseSourceRegistries(list string) ([]sourceMirror, error) {
+	return parsePrefixURLs("source registry", list)
+}
+
+// parsePrefixURLs parses a comma-separated list of prefix=url entries of the
+// named kind.
+func parsePrefixURLs(kind, list string) ([]sourceMirror, error) {
+	var sms []sourceMirror
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.Index(entry, "=")
+		if i <= 0 {
+			return nil, errors.Errorf("invalid %s %q: must be of the form prefix=url", kind, entry)
+		}
+		base, err := url.Parse(strings.TrimRight(entry[i+1:], "/"))
+		if err != nil || base.Scheme == "" || base.Host == "" {
+			return nil, errors.Errorf("invalid %s %q: %q is not an absolute URL", kind, entry, entry[i+1:])
+		}
+		sms = append(sms, sourceMirror{prefix: strings.TrimRight(entry[:i], "/"), base: base})
+	}
+	return sms, nil
+}
+
+// mirrorSources returns the sources for the project with the provided root,
+// deduced from path, from the mirror with the longest prefix of root, if there
+// is one, and whether there was. The mirror's URL for the project is its own,
+// followed by the remainder of root after the prefix, and it is tried as a
+// repository of the kind that the first of the deduced sources is. Otherwise,
+// or if path names a scheme explicitly, mb is returned as it is.
+func mirrorSources(mirrors []sourceMirror, path, root string, mb maybeSources) (maybeSources, bool) {
+	if len(mirrors) == 0 {
+		return mb, false
+	}
+	if u, _, err := normalizeURI(path); err != nil || u.Scheme != "" {
+		return mb, false
+	}
+
+	sm := longestMirror(mirrors, root)
+	if sm == nil || len(mb) == 0 {
+		return mb, false
+	}
+
+	u := *sm.base
+	u.Path += root[len(sm.prefix):]
+	switch tm := mb[0].(type) {
+	case maybeGitSource:
+		tm.url = &u
+		return maybeSources{tm}, true
+	case maybeGopkginSource:
+		tm.url = &u
+		return maybeSources{tm}, true
+	case maybeBzrSource:
+		tm.url = &u
+		return maybeSources{tm}, true
+	case maybeHgSource:
+		tm.url = &u
+		return maybeSources{tm}, true
+	case maybeSvnSource:
+		tm.url = &u
+		return maybeSources{tm}, true
+	}
+	return mb, false
+}
+
+// longestMirror returns the one of the mirrors with the longest prefix of
+// root, or nil if none has a prefix of it.
+func longestMirror(mirrors []sourceMirror, root string) *sourceMirror {
+	var sm *sourceMirror
+	for k, m := range mirrors {
+		if (root == m.prefix || strings.HasPrefix(root, m.prefix+"/")) && (sm == nil || len(m.prefix) > len(sm.prefix)) {
+			sm = &mirrors[k]
+		}
+	}
+	return sm
+}
+
 // pathDeduction represents the results of a successful import path deduction -
 // a root path, plus a maybeSource that can be used to attempt to connect to
 // the source.
 type pathDeduction struct {
-	root string
-	mb   maybeSources
+	root   string
+	mb     maybeSources
+	reason DeductionReason
 }
 
 var errNoKnownPathMatch = errors.New("no known path match")
@@ -664,7 +1019,7 @@ func (dc *deductionCoordinator) deduceKnownPaths(path string) (pathDeduction, er
 	}
 
 	// First, try the root path-based matches
-	if _, mtch, has := dc.deducext.LongestPrefix(path); has {
+	if prefix, mtch, has := dc.deducext.LongestPrefix(path); has {
 		root, err := mtch.deduceRoot(path)
 		if err != nil {
 			return pathDeduction{}, err
@@ -677,6 +1032,10 @@ func (dc *deductionCoordinator) deduceKnownPaths(path string) (pathDeduction, er
 		return pathDeduction{
 			root: root,
 			mb:   mb,
+			reason: DeductionReason{
+				Method: DeducedFromKnownHost,
+				Rule:   prefix,
+			},
 		}, nil
 	}
 
@@ -691,6 +1050,10 @@ func (dc *deductionCoordinator) deduceKnownPaths(path string) (pathDeduction, er
 		return pathDeduction{
 			root: root,
 			mb:   mb,
+			reason: DeductionReason{
+				Method: DeducedFromVCSExtension,
+				Rule:   root[strings.LastIndex(root, "."):],
+			},
 		}, nil
 	}
 
@@ -702,6 +1065,12 @@ type httpMetadataDeducer struct {
 	deduced    pathDeduction
 	deduceErr  error
 	basePath   string
+	private    bool
+	protocol   string
+	mirrors    []sourceMirror
+	registries []sourceMirror
+	cache      metadataCache
+	settings   sourceSettings
 	returnFunc func(pathDeduction)
 	suprvsr    *supervisor
 }
@@ -718,21 +1087,46 @@ func (hmd *httpMetadataDeducer) deduce(ctx context.Context, path string) (pathDe
 
 		pd := pathDeduction{}
 
-		// Make the HTTP call to attempt to retrieve go-get metadata
-		var root, vcs, reporoot string
-		err = hmd.suprvsr.do(ctx, path, ctHTTPMetadata, func(ctx context.Context) error {
-			root, vcs, reporoot, err = getMetadata(ctx, path, u.Scheme)
-			if err != nil {
-				err = errors.Wrapf(err, "unable to read metadata")
+		// Private paths must never fall back to plain http for metadata.
+		scheme := u.Scheme
+		if hmd.private && scheme == "" {
+			scheme = "https"
+		}
+
+		// Use the metadata from the persistent cache, if any was fetched as
+		// this request would fetch it, or else make the HTTP call to attempt
+		// to retrieve go-get metadata.
+		var im metaImport
+		var metaURL string
+		var cached bool
+		if hmd.cache != nil && u.Scheme == "" {
+			im, metaURL, cached = hmd.cache.getMetadata(path)
+			if cached && hmd.private && !strings.HasPrefix(metaURL, "https://") {
+				cached = false
 			}
-			return err
-		})
+		}
+		if !cached {
+			err = hmd.suprvsr.do(ctx, path, ctHTTPMetadata, func(ctx context.Context) error {
+				im, metaURL, err = getMetadata(ctx, hmd.settings, path, scheme)
+				if err != nil {
+					err = errors.Wrapf(err, "unable to read metadata")
+				}
+				return err
+			})
+		}
 		if err != nil {
 			err = errors.Wrapf(err, "unable to deduce repository and source type for %q", opath)
 			hmd.deduceErr = err
 			return
 		}
+		root, vcs, reporoot := im.Prefix, im.VCS, im.RepoRoot
 		pd.root = root
+		pd.reason = DeductionReason{
+			Method:      DeducedFromMetadata,
+			MetadataURL: metaURL,
+			MetaTag:     im.Tag,
+			Cached:      cached,
+		}
 
 		// If we got something back at all, then it supersedes the actual input for
 		// the real URL to hit
@@ -764,11 +1158,30 @@ func (hmd *httpMetadataDeducer) deduce(ctx context.Context, path string) (pathDe
 			pd.mb = maybeSources{maybeBzrSource{url: repoURL}}
 		case "hg":
 			pd.mb = maybeSources{maybeHgSource{url: repoURL}}
+		case "svn":
+			pd.mb = maybeSources{maybeSvnSource{url: repoURL}}
 		default:
 			hmd.deduceErr = errors.Errorf("unsupported vcs type %s in go-get metadata from %s", vcs, path)
 			return
 		}
 
+		var mirrored bool
+		pd.mb, mirrored = mirrorSources(hmd.mirrors, opath, pd.root, pd.mb)
+		if hmd.private {
+			if pd.mb, err = secureSources(opath, pd.mb); err != nil {
+				hmd.deduceErr = err
+				return
+			}
+		}
+		if hmd.protocol != "" && !mirrored {
+			pd.mb = preferProtocol(pd.mb, hmd.protocol)
+		}
+		pd.mb = registrySources(hmd.registries, opath, pd.root, hmd.private, pd.mb)
+
+		if hmd.cache != nil && !cached {
+			hmd.cache.setMetadata(im, metaURL)
+		}
+
 		hmd.deduced = pd
 		// All data is assigned for other goroutines that may be waiting. Now,
 		// send the pathDeduction back to the deductionCoordinator by calling
@@ -823,57 +1236,91 @@ func normalizeURI(p string) (*url.URL, string, error) {
 	return u, newpath, nil
 }
 
-// fetchMetadata fetches the remote metadata for path.
-func fetchMetadata(ctx context.Context, path, scheme string) (rc io.ReadCloser, err error) {
-	if scheme == "http" {
-		rc, err = doFetchMetadata(ctx, "http", path)
-		return
+// fetchMetadata fetches the remote metadata for path, returning the scheme
+// with which it was fetched.
+func fetchMetadata(ctx context.Context, ss sourceSettings, path, scheme string) (rc io.ReadCloser, used string, err error) {
+	if scheme == "http" || scheme == "https" {
+		rc, err = doFetchMetadata(ctx, ss, scheme, path)
+		return rc, scheme, err
 	}
 
-	rc, err = doFetchMetadata(ctx, "https", path)
+	rc, err = doFetchMetadata(ctx, ss, "https", path)
 	if err == nil {
-		return
+		return rc, "https", nil
 	}
 
-	rc, err = doFetchMetadata(ctx, "http", path)
-	return
+	rc, err = doFetchMetadata(ctx, ss, "http", path)
+	return rc, "http", err
 }
 
-func doFetchMetadata(ctx context.Context, scheme, path string) (io.ReadCloser, error) {
+// doFetchMetadata fetches the remote metadata for path with the scheme, subject
+// to the network auditing, concurrency limits and offline mode of the
+// settings.
+func doFetchMetadata(ctx context.Context, ss sourceSettings, scheme, path string) (io.ReadCloser, error) {
 	url := fmt.Sprintf("%s://%s?go-get=1", scheme, path)
 	switch scheme {
 	case "https", "http":
+		if ss.offline {
+			return nil, newOfflineError(url, ctHTTPMetadata)
+		}
 		req, err := http.NewRequest("GET", url, nil)
 		if err != nil {
 			return nil, errors.Wrapf(err, "unable to build HTTP request for URL %q", url)
 		}
 
+		na := ss.audit
+		var e NetworkAuditEntry
+		if na != nil {
+			e = newAuditEntry(url, ctHTTPMetadata)
+		}
+
+		var l *aimdLimiter
+		if hl := ss.limiter; hl != nil {
+			l = hl.forHost(req.URL.Host)
+			if err := l.acquire(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		start := time.Now()
 		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if l != nil {
+			l.release(ctHTTPMetadata, time.Since(start), err != nil)
+		}
 		if err != nil {
+			if na != nil {
+				e.Duration, e.Failed = time.Since(e.Start), true
+				na.record(e)
+			}
 			return nil, errors.Wrapf(err, "failed HTTP request to URL %q", url)
 		}
 
+		if na != nil {
+			return &auditedBody{ReadCloser: resp.Body, na: na, e: e}, nil
+		}
 		return resp.Body, nil
 	default:
 		return nil, errors.Errorf("unknown remote protocol scheme: %q", scheme)
 	}
 }
 
-// getMetadata fetches and decodes remote metadata for path.
+// getMetadata fetches and decodes remote metadata for path, returning the
+// import that matches path and the URL from which it was fetched.
 //
-// scheme is optional. If it's http, only http will be attempted for fetching.
-// Any other scheme (including none) will first try https, then fall back to
-// http.
-func getMetadata(ctx context.Context, path, scheme string) (string, string, string, error) {
-	rc, err := fetchMetadata(ctx, path, scheme)
+// scheme is optional. If it's http or https, only that scheme will be attempted
+// for fetching. Any other scheme (including none) will first try https, then
+// fall back to http.
+func getMetadata(ctx context.Context, ss sourceSettings, path, scheme string) (metaImport, string, error) {
+	rc, used, err := fetchMetadata(ctx, ss, path, scheme)
 	if err != nil {
-		return "", "", "", errors.Wrapf(err, "unable to fetch raw metadata")
+		return metaImport{}, "", errors.Wrapf(err, "unable to fetch raw metadata")
 	}
 	defer rc.Close()
+	url := fmt.Sprintf("%s://%s?go-get=1", used, path)
 
 	imports, err := parseMetaGoImports(rc)
 	if err != nil {
-		return "", "", "", errors.Wrapf(err, "unable to parse go-import metadata")
+		return metaImport{}, "", errors.Wrapf(err, "unable to parse go-import metadata")
 	}
 	match := -1
 	for i, im := range imports {
@@ -881,12 +1328,12 @@ func getMetadata(ctx context.Context, path, scheme string) (string, string, stri
 			continue
 		}
 		if match != -1 {
-			return "", "", "", errors.Errorf("multiple meta tags match import path %q", path)
+			return metaImport{}, "", errors.Errorf("multiple meta tags match import path %q", path)
 		}
 		match = i
 	}
 	if match == -1 {
-		return "", "", "", errors.Errorf("go-import metadata not found")
+		return metaImport{}, "", errors.Errorf("go-import metadata not found")
 	}
-	return imports[match].Prefix, imports[match].VCS, imports[match].RepoRoot, nil
+	return imports[match], url, nil
 }
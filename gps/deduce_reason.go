@@ -0,0 +1,70 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "fmt"
+
+// DeductionMethod indicates how the root of an import path was determined.
+type DeductionMethod uint8
+
+const (
+	// DeducedFromKnownHost indicates the root was determined by the static
+	// rules for a well-known host, such as github.com or gopkg.in.
+	DeducedFromKnownHost DeductionMethod = iota
+	// DeducedFromVCSExtension indicates the root was determined by a VCS
+	// extension, such as .git, within the import path.
+	DeducedFromVCSExtension
+	// DeducedFromMetadata indicates the root was determined by a go-import
+	// meta tag fetched from the import path's host.
+	DeducedFromMetadata
+)
+
+func (m DeductionMethod) String() string {
+	switch m {
+	case DeducedFromVCSExtension:
+		return "vcs extension"
+	case DeducedFromMetadata:
+		return "go-import metadata"
+	}
+	return "known host"
+}
+
+// DeductionReason explains how a SourceMgr determined the root of an import
+// path, as reported by DeduceProjectRootWithReason.
+type DeductionReason struct {
+	Method DeductionMethod
+	// Rule is the rule that matched, for the static methods: the path
+	// prefix of the known host, such as "github.com/", or the VCS extension,
+	// such as ".git".
+	Rule string
+	// MetadataURL is the URL from which go-import metadata was fetched, and
+	// MetaTag the meta tag in it that matched the import path, for
+	// DeducedFromMetadata.
+	MetadataURL string
+	MetaTag     string
+	// Cached indicates that the root was already known from an earlier
+	// deduction of an import path with the same root, and so was determined
+	// without applying any rule or fetching any metadata. The earlier
+	// deduction may have been made by another SourceManager, if its go-get
+	// metadata was kept in the persistent cache. The other fields describe
+	// that earlier deduction.
+	Cached bool
+}
+
+func (r DeductionReason) String() string {
+	var s string
+	switch r.Method {
+	case DeducedFromKnownHost:
+		s = fmt.Sprintf("matched the rules for known host %q", r.Rule)
+	case DeducedFromVCSExtension:
+		s = fmt.Sprintf("ends at the %q vcs extension in the import path", r.Rule)
+	case DeducedFromMetadata:
+		s = fmt.Sprintf("declared by %s in go-import metadata from %s", r.MetaTag, r.MetadataURL)
+	}
+	if r.Cached {
+		s += " (cached from an earlier deduction)"
+	}
+	return s
+}
@@ -9,8 +9,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -431,6 +434,23 @@ var pathDeductionFixtures = map[string][]pathDeductionFixture{
 				maybeHgSource{url: mkurl("http://foo-bar.com/baz.hg")},
 			},
 		},
+		{
+			in:   "foobar.com/baz.svn/sub",
+			root: "foobar.com/baz.svn",
+			mb: maybeSources{
+				maybeSvnSource{url: mkurl("https://foobar.com/baz.svn")},
+				maybeSvnSource{url: mkurl("http://foobar.com/baz.svn")},
+				maybeSvnSource{url: mkurl("svn://foobar.com/baz.svn")},
+				maybeSvnSource{url: mkurl("svn+ssh://foobar.com/baz.svn")},
+			},
+		},
+		{
+			in:   "svn+ssh://foobar.com/baz.svn",
+			root: "foobar.com/baz.svn",
+			mb: maybeSources{
+				maybeSvnSource{url: mkurl("svn+ssh://foobar.com/baz.svn")},
+			},
+		},
 		{
 			in:   "git@foobar.com:baz.git",
 			root: "foobar.com/baz.git",
@@ -464,6 +484,11 @@ var pathDeductionFixtures = map[string][]pathDeductionFixture{
 			root:   "foobar.com/baz.hg",
 			srcerr: errors.New("git is not a valid scheme for accessing hg repositories (path foobar.com/baz.hg)"),
 		},
+		{
+			in:     "bzr://foobar.com/baz.svn",
+			root:   "foobar.com/baz.svn",
+			srcerr: errors.New("bzr is not a valid scheme for accessing svn repositories (path foobar.com/baz.svn)"),
+		},
 		// who knows why anyone would do this, but having a second vcs ext
 		// shouldn't throw us off - only the first one counts
 		{
@@ -679,3 +704,312 @@ func TestVanityDeductionSchemeMismatch(t *testing.T) {
 		t.Error("should have errored on scheme mismatch between input and go-get metadata")
 	}
 }
+
+func TestPrivateDeduction(t *testing.T) {
+	ctx := context.Background()
+	dc := newDeductionCoordinator(newSupervisor(ctx))
+	dc.private = "github.com/private,*.corp.example.com"
+
+	for _, p := range []string{"github.com/private/repo", "git.corp.example.com/team/repo.git/sub", "ssh://git@github.com/private/repo"} {
+		if !dc.isPrivate(p) {
+			t.Errorf("expected %q to be private", p)
+		}
+	}
+	for _, p := range []string{"github.com/public/repo", "corp.example.com/team/repo"} {
+		if dc.isPrivate(p) {
+			t.Errorf("expected %q not to be private", p)
+		}
+	}
+
+	pd, err := dc.deduceRootPath(ctx, "github.com/private/repo/pkg")
+	if err != nil {
+		t.Fatalf("unexpected error deducing private path: %s", err)
+	}
+	if pd.root != "github.com/private/repo" {
+		t.Errorf("unexpected root for private path: %s", pd.root)
+	}
+	for _, mb := range pd.mb {
+		if s := mb.URL().Scheme; s != "https" && s != "ssh" {
+			t.Errorf("private path should only have secure sources, got %s", mb)
+		}
+	}
+
+	pd, err = dc.deduceRootPath(ctx, "github.com/public/repo")
+	if err != nil {
+		t.Fatalf("unexpected error deducing public path: %s", err)
+	}
+	if len(pd.mb) != len(gitSchemes) {
+		t.Errorf("public path should have all %d sources, got %d", len(gitSchemes), len(pd.mb))
+	}
+
+	// An explicitly insecure scheme leaves nothing to try.
+	if _, err = dc.deduceRootPath(ctx, "git://github.com/private/other"); err == nil {
+		t.Error("expected an error deducing private path with only insecure sources")
+	}
+}
+
+func TestDeductionReason(t *testing.T) {
+	ctx := context.Background()
+	dc := newDeductionCoordinator(newSupervisor(ctx))
+
+	pd, err := dc.deduceRootPath(ctx, "github.com/foo/bar/baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DeductionReason{Method: DeducedFromKnownHost, Rule: "github.com/"}
+	if pd.reason != want {
+		t.Errorf("unexpected reason for a known host:\n\t(GOT): %+v\n\t(WNT): %+v", pd.reason, want)
+	}
+	pd, err = dc.deduceRootPath(ctx, "github.com/foo/bar/qux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Cached = true
+	if pd.reason != want {
+		t.Errorf("unexpected reason for a cached deduction:\n\t(GOT): %+v\n\t(WNT): %+v", pd.reason, want)
+	}
+
+	pd, err = dc.deduceRootPath(ctx, "example.com/foo/bar.git/baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = DeductionReason{Method: DeducedFromVCSExtension, Rule: ".git"}
+	if pd.root != "example.com/foo/bar.git" || pd.reason != want {
+		t.Errorf("unexpected deduction for a vcs extension: %s, %+v", pd.root, pd.reason)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><head>
+<meta name="go-import" content="%[1]s/vanity git https://%[1]s/repo.git">
+</head></html>`, r.Host)
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	pd, err = dc.deduceRootPath(ctx, "http://"+host+"/vanity/pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = DeductionReason{
+		Method:      DeducedFromMetadata,
+		MetadataURL: "http://" + host + "/vanity/pkg?go-get=1",
+		MetaTag:     fmt.Sprintf(`<meta name="go-import" content="%[1]s/vanity git https://%[1]s/repo.git">`, host),
+	}
+	if pd.root != host+"/vanity" || pd.reason != want {
+		t.Errorf("unexpected deduction from metadata: %s, %+v", pd.root, pd.reason)
+	}
+	if s := pd.reason.String(); !strings.Contains(s, want.MetaTag) || !strings.Contains(s, want.MetadataURL) {
+		t.Errorf("expected the explanation to include the meta tag and its URL, got %q", s)
+	}
+}
+
+func TestSourceProtocolDeduction(t *testing.T) {
+	ctx := context.Background()
+	dc := newDeductionCoordinator(newSupervisor(ctx))
+	var err error
+	dc.protocols, err = parseSourceProtocols("github.com/sshorg=ssh, github.com=https,gopkg.in=ssh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls := func(path string) []string {
+		pd, err := dc.deduceRootPath(ctx, path)
+		if err != nil {
+			t.Fatalf("unexpected error deducing %s: %s", path, err)
+		}
+		var us []string
+		for _, mb := range pd.mb {
+			us = append(us, mb.URL().String())
+		}
+		return us
+	}
+
+	cases := map[string][]string{
+		"github.com/sshorg/repo/pkg": {"ssh://git@github.com/sshorg/repo"},
+		"github.com/other/repo":      {"https://github.com/other/repo"},
+		// Explicit schemes are honored.
+		"git://github.com/sshorg/explicit": {"git://github.com/sshorg/explicit"},
+	}
+	for path, want := range cases {
+		if got := urls(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected sources for %s:\n\t(GOT): %v\n\t(WNT): %v", path, got, want)
+		}
+	}
+
+	// gopkg.in never deduces to ssh, so its source is rewritten.
+	pd, err := dc.deduceRootPath(ctx, "gopkg.in/yaml.v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pd.mb) != 1 {
+		t.Fatalf("expected a single source for gopkg.in/yaml.v2, got %v", pd.mb)
+	}
+	if got := pd.mb[0].(maybeGopkginSource).url.String(); got != "ssh://git@github.com/go-yaml/yaml" {
+		t.Errorf("unexpected upstream for gopkg.in/yaml.v2: %s", got)
+	}
+
+	if got := urls("bitbucket.org/other/repo"); len(got) < 2 {
+		t.Errorf("expected paths without a preference to have all their sources, got %v", got)
+	}
+}
+
+func TestSourceMirrorDeduction(t *testing.T) {
+	ctx := context.Background()
+	dc := newDeductionCoordinator(newSupervisor(ctx))
+	var err error
+	dc.mirrors, err = parseSourceMirrors("github.com=https://git.corp.example.com/github/, github.com/forked=ssh://git@forks.example.com, gopkg.in=https://git.corp.example.com/gopkgin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc.protocols, err = parseSourceProtocols("github.com=ssh,bitbucket.org=https")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		root string
+		urls []string
+	}{
+		"github.com/sdboyer/gps/pkg": {"github.com/sdboyer/gps", []string{"https://git.corp.example.com/github/sdboyer/gps"}},
+		"github.com/forked/repo":     {"github.com/forked/repo", []string{"ssh://git@forks.example.com/repo"}},
+		// Explicit schemes are honored.
+		"git://github.com/sdboyer/gps": {"github.com/sdboyer/gps", []string{"git://github.com/sdboyer/gps"}},
+		// Mirrors take precedence over preferred protocols, which still apply
+		// elsewhere.
+		"bitbucket.org/sdboyer/reporoot": {"bitbucket.org/sdboyer/reporoot", []string{"https://bitbucket.org/sdboyer/reporoot", "https://bitbucket.org/sdboyer/reporoot"}},
+	}
+	for path, want := range cases {
+		pd, err := dc.deduceRootPath(ctx, path)
+		if err != nil {
+			t.Fatalf("unexpected error deducing %s: %s", path, err)
+		}
+		var us []string
+		for _, mb := range pd.mb {
+			us = append(us, mb.URL().String())
+		}
+		if pd.root != want.root || !reflect.DeepEqual(us, want.urls) {
+			t.Errorf("unexpected deduction for %s:\n\t(GOT): %s %v\n\t(WNT): %s %v", path, pd.root, us, want.root, want.urls)
+		}
+	}
+
+	pd, err := dc.deduceRootPath(ctx, "gopkg.in/yaml.v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := pd.mb[0].(maybeGopkginSource); !ok || len(pd.mb) != 1 || m.url.String() != "https://git.corp.example.com/gopkgin/yaml.v2" || m.major != 2 {
+		t.Errorf("unexpected sources for gopkg.in/yaml.v2: %v", pd.mb)
+	}
+
+	// Neither the deduction of a path with an explicit scheme, nor that of a
+	// plain one, is reused for the other, whichever is deduced first.
+	want := map[string]string{
+		"git://github.com/sdboyer/gps": "git://github.com/sdboyer/gps",
+		"github.com/sdboyer/gps/pkg":   "https://git.corp.example.com/github/sdboyer/gps",
+	}
+	for _, order := range [][]string{
+		{"git://github.com/sdboyer/gps", "github.com/sdboyer/gps/pkg"},
+		{"github.com/sdboyer/gps/pkg", "git://github.com/sdboyer/gps"},
+	} {
+		odc := newDeductionCoordinator(newSupervisor(ctx))
+		odc.mirrors = dc.mirrors
+		for _, path := range order {
+			pd, err := odc.deduceRootPath(ctx, path)
+			if err != nil {
+				t.Fatalf("unexpected error deducing %s: %s", path, err)
+			}
+			if got := pd.mb[0].URL().String(); len(pd.mb) != 1 || got != want[path] {
+				t.Errorf("unexpected sources for %s, deduced in the order %v: %v", path, order, pd.mb)
+			}
+		}
+	}
+
+	for _, list := range []string{"github.com", "=https://example.com", "github.com=example.com/mirror"} {
+		if _, err := parseSourceMirrors(list); err == nil {
+			t.Errorf("expected an error parsing %q", list)
+		}
+	}
+}
+
+func TestParseSourceProtocolsErrors(t *testing.T) {
+	for _, list := range []string{"github.com", "=ssh", "github.com=git"} {
+		if _, err := parseSourceProtocols(list); err == nil {
+			t.Errorf("expected an error parsing %q", list)
+		}
+	}
+}
+
+func TestImpliedConstraint(t *testing.T) {
+	for _, fix := range []struct {
+		pr   ProjectRoot
+		want string
+	}{
+		{"gopkg.in/yaml.v2", ">=2.0.0, <3.0.0"},
+		{"gopkg.in/go-playground/validator.v9", ">=9.0.0, <10.0.0"},
+		{"gopkg.in/check.v0", ">=0.0.0, <1.0.0"},
+		{"gopkg.in/mgo.v2-unstable", ">=2.0.0, <3.0.0"},
+		{"example.com/foo/v3", ">=3.0.0, <4.0.0"},
+		{"example.com/foo/v1", ""},
+		{"example.com/foo.v2", ""},
+		{"gopkg.in/yaml.v2/sub", ""},
+		{"github.com/foo/bar", ""},
+	} {
+		c, ok := ImpliedConstraint(fix.pr)
+		if fix.want == "" {
+			if ok {
+				t.Errorf("expected no constraint implied by %s, got %s", fix.pr, c)
+			}
+			continue
+		}
+		want, err := NewSemverConstraint(fix.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || !c.identical(want) {
+			t.Errorf("expected %s to imply %s, got %v", fix.pr, want, c)
+		}
+	}
+}
+
+// mapMetadataCache is a metadataCache held in memory, keyed by prefix.
+type mapMetadataCache map[string][2]string
+
+func (c mapMetadataCache) getMetadata(path string) (metaImport, string, bool) {
+	for prefix, v := range c {
+		if isPathPrefixOrEqual(prefix, path) {
+			return metaImport{Prefix: prefix, VCS: "git", RepoRoot: v[0]}, v[1], true
+		}
+	}
+	return metaImport{}, "", false
+}
+
+func (c mapMetadataCache) setMetadata(im metaImport, metaURL string) {
+	c[im.Prefix] = [2]string{im.RepoRoot, metaURL}
+}
+
+func TestCachedMetadataDeduction(t *testing.T) {
+	// Offline, so that only cached metadata can be used.
+	ctx := context.Background()
+	dc := newDeductionCoordinator(newSupervisor(ctx))
+	dc.settings.offline = true
+	dc.private = "private.example.com"
+	dc.cache = mapMetadataCache{
+		"vanity.example.com/foo":  {"https://github.com/example/foo", "https://vanity.example.com/foo?go-get=1"},
+		"private.example.com/bar": {"https://github.com/example/bar", "http://private.example.com/bar?go-get=1"},
+	}
+
+	pd, err := dc.deduceRootPath(ctx, "vanity.example.com/foo/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pd.root != "vanity.example.com/foo" || !pd.reason.Cached || pd.reason.MetadataURL != "https://vanity.example.com/foo?go-get=1" {
+		t.Errorf("unexpected deduction from cached metadata: %s %s", pd.root, pd.reason)
+	}
+	if len(pd.mb) != 1 || pd.mb[0].(maybeGitSource).url.String() != "https://github.com/example/foo" {
+		t.Errorf("unexpected sources deduced from cached metadata: %v", pd.mb)
+	}
+
+	// Metadata fetched over plain http is not trusted for a private path.
+	if _, err = dc.deduceRootPath(ctx, "private.example.com/bar"); err == nil {
+		t.Error("expected metadata cached from plain http not to be used for a private path")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"strings"
+)
+
+// deprecatedPrefix marks the paragraph of a tag message that explains why the
+// tagged version is deprecated, following the convention for Go doc comments.
+const deprecatedPrefix = "Deprecated:"
+
+// Deprecation is a notice that a version of a project should no longer be
+// used.
+type Deprecation struct {
+	// Version is the deprecated version. A notice applies to every candidate
+	// version that it matches, so a notice for NewVersion("v1.0.0") applies to
+	// that version paired with any revision.
+	Version Version
+	// Reason explains why the version is deprecated, and ideally what should
+	// be used instead.
+	Reason string
+}
+
+// DeprecationProvider supplies deprecation notices for versions of projects.
+//
+// The solver consults the SourceManager for notices if it implements this
+// interface, as SourceMgr does, as well as any additional provider (for
+// example, one backed by an advisory database) given in the SolveParameters.
+type DeprecationProvider interface {
+	Deprecations(ProjectIdentifier) ([]Deprecation, error)
+}
+
+// ContextDeprecationProvider is a DeprecationProvider that can look up notices
+// under a context. The solver prefers it, so that lookups are abandoned along
+// with the solve that made them.
+type ContextDeprecationProvider interface {
+	DeprecationProvider
+	DeprecationsContext(context.Context, ProjectIdentifier) ([]Deprecation, error)
+}
+
+// sourceDeprecations is implemented by sources that can read deprecation
+// notices recorded in their repository.
+type sourceDeprecations interface {
+	source
+	deprecations(context.Context) ([]Deprecation, error)
+}
+
+// findDeprecation returns the first notice in the list that applies to the
+// provided version.
+func findDeprecation(ds []Deprecation, v Version) (Deprecation, bool) {
+	for _, d := range ds {
+		if d.Version == v || d.Version.Matches(v) {
+			return d, true
+		}
+	}
+	return Deprecation{}, false
+}
+
+// preferNonDeprecated moves any deprecated versions in the list to its end,
+// retaining the existing relative order of both deprecated and non-deprecated
+// versions.
+func preferNonDeprecated(vl []Version, ds []Deprecation) {
+	if len(ds) == 0 {
+		return
+	}
+
+	var keep, dep []Version
+	for _, v := range vl {
+		if _, has := findDeprecation(ds, v); has {
+			dep = append(dep, v)
+		} else {
+			keep = append(keep, v)
+		}
+	}
+	copy(vl[copy(vl, keep):], dep)
+}
+
+// parseDeprecationMessage extracts the reason from a message containing a
+// paragraph that begins with "Deprecated:". The reason is the remainder of
+// that paragraph, with its lines joined.
+func parseDeprecationMessage(msg string) (string, bool) {
+	var para []string
+	found := false
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case found && line == "":
+			return strings.Join(para, " "), true
+		case found:
+			para = append(para, line)
+		case strings.HasPrefix(line, deprecatedPrefix):
+			found = true
+			if r := strings.TrimSpace(strings.TrimPrefix(line, deprecatedPrefix)); r != "" {
+				para = append(para, r)
+			}
+		}
+	}
+	return strings.Join(para, " "), found
+}
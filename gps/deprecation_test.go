@@ -0,0 +1,72 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDeprecationMessage(t *testing.T) {
+	cases := []struct {
+		msg    string
+		reason string
+		found  bool
+	}{
+		{"Release v1.0.0\n", "", false},
+		{"Deprecated: use v1.0.1.\n", "use v1.0.1.", true},
+		{"Release v1.0.0\n\nDeprecated: this release\ncorrupts data.\n\nSigned-off-by: someone\n", "this release corrupts data.", true},
+		{"Deprecated:\n", "", true},
+	}
+
+	for _, c := range cases {
+		reason, found := parseDeprecationMessage(c.msg)
+		if reason != c.reason || found != c.found {
+			t.Errorf("parseDeprecationMessage(%q) = %q, %v; want %q, %v", c.msg, reason, found, c.reason, c.found)
+		}
+	}
+}
+
+func TestPreferNonDeprecated(t *testing.T) {
+	vl := []Version{
+		NewVersion("v2.0.0").Pair("200rev"),
+		NewVersion("v1.1.0").Pair("110rev"),
+		NewVersion("v1.0.0").Pair("100rev"),
+		NewBranch("master").Pair("masterrev"),
+	}
+	preferNonDeprecated(vl, []Deprecation{
+		{Version: NewVersion("v2.0.0")},
+		{Version: Revision("110rev")},
+	})
+
+	want := []Version{
+		NewVersion("v1.0.0").Pair("100rev"),
+		NewBranch("master").Pair("masterrev"),
+		NewVersion("v2.0.0").Pair("200rev"),
+		NewVersion("v1.1.0").Pair("110rev"),
+	}
+	if !reflect.DeepEqual(vl, want) {
+		t.Errorf("unexpected version order:\n\t(GOT): %v\n\t(WNT): %v", vl, want)
+	}
+}
+
+func TestParseGitTagDeprecations(t *testing.T) {
+	out := "tag\x00refs/tags/v1.0.0\x00Release\n\nDeprecated: use v1.0.1\n\x00\n" +
+		"commit\x00refs/tags/v1.0.1\x00Deprecated: a commit message, not a tag message\n\x00\n" +
+		"tag\x00refs/tags/v1.1.0\x00Release v1.1.0\n\x00\n"
+
+	ds, err := parseGitTagDeprecations([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Deprecation{{Version: NewVersion("v1.0.0"), Reason: "use v1.0.1"}}
+	if !reflect.DeepEqual(ds, want) {
+		t.Errorf("unexpected deprecations:\n\t(GOT): %v\n\t(WNT): %v", ds, want)
+	}
+
+	if ds, err = parseGitTagDeprecations(nil); err != nil || len(ds) != 0 {
+		t.Errorf("expected no deprecations and no error from empty output, got %v, %v", ds, err)
+	}
+}
@@ -31,6 +31,8 @@ func charsetReader(charset string, input io.Reader) (io.Reader, error) {
 
 type metaImport struct {
 	Prefix, VCS, RepoRoot string
+	// Tag is the meta tag from which the import was parsed, as HTML.
+	Tag string
 }
 
 // parseMetaGoImports returns meta imports from the HTML in r.
@@ -61,11 +63,13 @@ func parseMetaGoImports(r io.Reader) (imports []metaImport, err error) {
 		if attrValue(e.Attr, "name") != "go-import" {
 			continue
 		}
-		if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 3 {
+		content := attrValue(e.Attr, "content")
+		if f := strings.Fields(content); len(f) == 3 {
 			imports = append(imports, metaImport{
 				Prefix:   f[0],
 				VCS:      f[1],
 				RepoRoot: f[2],
+				Tag:      fmt.Sprintf("<meta name=%q content=%q>", "go-import", content),
 			})
 		}
 	}
@@ -0,0 +1,136 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// uncachedSourceSize is the number of bytes that fetching a source of which
+// nothing is cached is expected to transfer. It is on the order of the history
+// of a typical, moderately active Go repository; the true figure varies by two
+// orders of magnitude either way, which is still enough to tell a solve that
+// fetches a handful of sources from one that fetches hundreds.
+const uncachedSourceSize int64 = 8 << 20
+
+// SolveEstimate predicts how much work a solve will do. See EstimateSolve.
+type SolveEstimate struct {
+	// Projects is the number of projects, other than the root, that the solve
+	// is expected to examine, including uncached ones.
+	Projects int
+	// Versions is the number of versions of those projects that their
+	// constraints admit, and which the solve may therefore have to try.
+	Versions int
+	// Uncached lists, in sorted order, the projects whose versions or metadata
+	// are not cached. They must be fetched before the solve can examine them,
+	// and the projects reached only through them are not counted, so when
+	// there are any, Projects and Versions are lower bounds.
+	Uncached []ProjectRoot
+	// FetchBytes is the number of bytes the solve is expected to fetch from
+	// upstream sources in order to examine the uncached projects.
+	FetchBytes int64
+}
+
+// EstimateSolve predicts, from cached metadata alone, the number of projects
+// and versions a solve with the given parameters will examine, and how much it
+// will fetch, so that tools can warn before starting a solve that will spend
+// minutes fetching sources.
+//
+// The estimate walks the depgraph from the root, following each project at the
+// version the solve would try first: its locked version if that is still
+// admitted, or else its newest admitted version. It never backtracks, so it
+// errs low for solves that do.
+//
+// sm should be created with SourceManagerConfig.Offline set, so that nothing
+// is fetched; the projects for which sm returns an *OfflineError are those
+// reported as uncached. Projects whose metadata cannot be read for any other
+// reason are counted, but not followed.
+func EstimateSolve(params SolveParameters, sm SourceManager) (SolveEstimate, error) {
+	s, err := Prepare(params, sm)
+	if err != nil {
+		return SolveEstimate{}, err
+	}
+	return s.(*solver).estimate()
+}
+
+func (s *solver) estimate() (SolveEstimate, error) {
+	var est SolveEstimate
+	s.mtr = newMetrics()
+
+	queue, err := s.intersectConstraintsWithImports(s.rd.combineConstraints(), s.rd.externalImportList(s.stdLibFn))
+	if err != nil {
+		return est, err
+	}
+	queue = sortedDeps(queue)
+
+	seen := make(map[ProjectRoot]bool)
+	uncached := func(pr ProjectRoot, err error) {
+		if _, ok := errors.Cause(err).(*OfflineError); ok {
+			est.Uncached = append(est.Uncached, pr)
+			est.FetchBytes += uncachedSourceSize
+		}
+	}
+
+	for len(queue) > 0 {
+		dep := queue[0]
+		queue = queue[1:]
+
+		pr := dep.Ident.ProjectRoot
+		if seen[pr] || s.rd.isRoot(pr) {
+			continue
+		}
+		seen[pr] = true
+		est.Projects++
+
+		vl, err := s.b.listVersions(dep.Ident)
+		if err != nil {
+			uncached(pr, err)
+			continue
+		}
+
+		pin, pinned := s.pins[pr]
+		admits := func(v Version) bool {
+			return dep.Constraint.Matches(v) && (!pinned || pin.Constraint.Matches(v))
+		}
+
+		var first Version
+		for _, v := range vl {
+			if admits(v) {
+				est.Versions++
+				if first == nil {
+					first = v
+				}
+			}
+		}
+		if lp, has := s.rd.rlm[pr]; has && admits(lp.Version()) {
+			first = lp.Version()
+		}
+		if first == nil {
+			continue
+		}
+
+		_, deps, err := s.getImportsAndConstraintsOf(atomWithPackages{
+			a:  atom{id: dep.Ident, v: first},
+			pl: dep.pl,
+		})
+		if err != nil {
+			uncached(pr, err)
+			continue
+		}
+		queue = append(queue, sortedDeps(deps)...)
+	}
+
+	sort.Slice(est.Uncached, func(i, j int) bool { return est.Uncached[i] < est.Uncached[j] })
+	return est, nil
+}
+
+// sortedDeps sorts deps by project root, so that when a project is reached by
+// several paths, the estimate always follows the same one.
+func sortedDeps(deps []completeDep) []completeDep {
+	sort.Slice(deps, func(i, j int) bool { return deps[i].Ident.ProjectRoot < deps[j].Ident.ProjectRoot })
+	return deps
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// offlineSM behaves as an offline SourceManager with nothing cached for some
+// projects, and only their versions cached for others.
+type offlineSM struct {
+	*depspecSourceManager
+	noVersions, noPackages map[ProjectRoot]bool
+}
+
+func (sm *offlineSM) ListVersions(id ProjectIdentifier) ([]PairedVersion, error) {
+	if sm.noVersions[id.ProjectRoot] {
+		return nil, &OfflineError{Project: id.ProjectRoot, Operation: "listing versions"}
+	}
+	return sm.depspecSourceManager.ListVersions(id)
+}
+
+func (sm *offlineSM) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
+	if sm.noVersions[id.ProjectRoot] || sm.noPackages[id.ProjectRoot] {
+		return pkgtree.PackageTree{}, &OfflineError{Project: id.ProjectRoot, Operation: "listing packages"}
+	}
+	return sm.depspecSourceManager.ListPackages(id, v)
+}
+
+func TestEstimateSolve(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a ^1.0.0", "b *"),
+			mkDepspec("a 1.0.0", "c ^1.0.0"),
+			mkDepspec("a 1.1.0", "c ^1.0.0", "d *"),
+			mkDepspec("a 2.0.0"),
+			mkDepspec("b 1.0.0", "e *"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("c 1.1.0"),
+			mkDepspec("c 2.0.0"),
+			mkDepspec("d 1.0.0"),
+			mkDepspec("e 1.0.0", "f *"),
+			mkDepspec("f 1.0.0"),
+		},
+	}
+
+	for _, test := range []struct {
+		name                   string
+		lock                   fixLock
+		noVersions, noPackages []ProjectRoot
+		want                   SolveEstimate
+	}{
+		{
+			name: "all cached",
+			want: SolveEstimate{Projects: 6, Versions: 8},
+		},
+		{
+			// Following the locked a, rather than the newest, never reaches d.
+			name: "locked",
+			lock: mklock("a 1.0.0"),
+			want: SolveEstimate{Projects: 5, Versions: 7},
+		},
+		{
+			name:       "uncached versions",
+			noVersions: []ProjectRoot{"e"},
+			want: SolveEstimate{
+				Projects:   5,
+				Versions:   6,
+				Uncached:   []ProjectRoot{"e"},
+				FetchBytes: uncachedSourceSize,
+			},
+		},
+		{
+			name:       "uncached metadata",
+			noVersions: []ProjectRoot{"d"},
+			noPackages: []ProjectRoot{"b"},
+			want: SolveEstimate{
+				Projects:   4,
+				Versions:   5,
+				Uncached:   []ProjectRoot{"b", "d"},
+				FetchBytes: 2 * uncachedSourceSize,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			params := SolveParameters{
+				RootDir:         string(fix.ds[0].n),
+				RootPackageTree: fix.rootTree(),
+				Manifest:        fix.rootmanifest(),
+				Lock:            dummyLock{},
+				ProjectAnalyzer: naiveAnalyzer{},
+				stdLibFn:        func(string) bool { return false },
+				mkBridgeFn:      overrideMkBridge,
+			}
+			if test.lock != nil {
+				params.Lock = test.lock
+			}
+
+			sm := &offlineSM{
+				depspecSourceManager: newdepspecSM(fix.ds, nil),
+				noVersions:           make(map[ProjectRoot]bool),
+				noPackages:           make(map[ProjectRoot]bool),
+			}
+			for _, pr := range test.noVersions {
+				sm.noVersions[pr] = true
+			}
+			for _, pr := range test.noPackages {
+				sm.noPackages[pr] = true
+			}
+
+			est, err := EstimateSolve(params, sm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(est, test.want) {
+				t.Errorf("unexpected estimate:\n\t(GOT): %+v\n\t(WNT): %+v", est, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+// SourceSubstitution records that a project was retrieved from one of the
+// fallback sources in SolveParameters.SourceFallbacks, because its declared
+// source could not be reached.
+type SourceSubstitution struct {
+	// Declared is the source that could not be reached. It is empty if the
+	// project's source is deduced from its root.
+	Declared string
+	// Substitute is the fallback source from which the project was
+	// retrieved instead.
+	Substitute string
+	// Revision is the locked revision that the substitute was required to
+	// contain. As revisions are digests of a repository's content, the
+	// substitute holds exactly the same code at that revision as the
+	// declared source.
+	Revision Revision
+}
+
+// lockedRevision returns the revision underlying the version of the locked
+// project, or the empty string if it has none.
+func lockedRevision(lp LockedProject) Revision {
+	switch v := lp.Version().(type) {
+	case Revision:
+		return v
+	case PairedVersion:
+		return v.Revision()
+	}
+	return ""
+}
+
+// sourceFor returns the identifier through which the project is to be
+// retrieved from the SourceManager. That is id itself, unless the project has
+// fallback sources and its declared source cannot be reached, in which case it
+// is the first fallback that contains the project's locked revision. Without a
+// locked revision, there is no way to tell that a fallback provides the same
+// code, so none is used.
+//
+// The decision is made once per identifier, the first time it is asked for.
+func (b *bridge) sourceFor(id ProjectIdentifier) ProjectIdentifier {
+	forks := b.s.fallbacks[id.ProjectRoot]
+	if len(forks) == 0 {
+		return id
+	}
+
+	b.substmut.Lock()
+	defer b.substmut.Unlock()
+	if sub, has := b.subst[id]; has {
+		return sub
+	}
+
+	sub := id
+	lp, locked := b.s.rd.rlm[id.ProjectRoot]
+	if exists, _ := b.ops().SourceExists(id); !exists && locked && lockedRevision(lp) != "" {
+		rev := lockedRevision(lp)
+		for _, fork := range forks {
+			fid := ProjectIdentifier{ProjectRoot: id.ProjectRoot, Source: fork}
+			b.s.mtr.watch(fid)
+			if present, err := b.ops().RevisionPresentIn(fid, rev); err == nil && present {
+				sub = fid
+				b.substs[id.ProjectRoot] = SourceSubstitution{
+					Declared:   id.Source,
+					Substitute: fork,
+					Revision:   rev,
+				}
+				break
+			}
+		}
+	}
+
+	b.subst[id] = sub
+	return sub
+}
+
+// substitutions returns the fallback sources that have been substituted for
+// unreachable ones so far in the solve.
+func (b *bridge) substitutions() map[ProjectRoot]SourceSubstitution {
+	b.substmut.Lock()
+	defer b.substmut.Unlock()
+
+	m := make(map[ProjectRoot]SourceSubstitution, len(b.substs))
+	for pr, sub := range b.substs {
+		m[pr] = sub
+	}
+	return m
+}
+
+// substituteSources rewrites, in place, the identifiers of the locked projects
+// for which a fallback source was substituted, so that they are retrieved from
+// it in future, and returns the substitutions.
+func (s *solver) substituteSources(lps []LockedProject) map[ProjectRoot]SourceSubstitution {
+	substs := s.b.substitutions()
+	if len(substs) == 0 {
+		return nil
+	}
+
+	m := make(map[ProjectRoot]SourceSubstitution)
+	for k, lp := range lps {
+		id := lp.Ident()
+		sub, has := substs[id.ProjectRoot]
+		if !has || id.Source != sub.Declared {
+			continue
+		}
+		m[id.ProjectRoot] = sub
+		id.Source = sub.Substitute
+		lps[k] = NewLockedProject(id, lp.Version(), lp.Packages())
+	}
+	return m
+}
+
+// onlyRevision restricts the versions listed from a substitute source to those
+// at the revision it was vetted for; the others may differ from what the
+// declared source would have provided.
+func onlyRevision(pvl []PairedVersion, rev Revision) []PairedVersion {
+	var kept []PairedVersion
+	for _, pv := range pvl {
+		if pv.Revision() == rev {
+			kept = append(kept, pv)
+		}
+	}
+	return kept
+}
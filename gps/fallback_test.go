@@ -0,0 +1,152 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// fallbackSM simulates projects whose declared sources cannot be reached, and
+// forks of them that can. A fork serves the fixture's specs for the project it
+// forks, at the versions for which it lists revisions.
+type fallbackSM struct {
+	*depspecSourceManager
+	unreachable map[ProjectRoot]bool
+	forks       map[string]map[string]Revision
+}
+
+// upstream returns the identifier under which the fixture knows the project
+// served by id, and whether that source can be reached.
+func (sm *fallbackSM) upstream(id ProjectIdentifier) (ProjectIdentifier, bool) {
+	if _, has := sm.forks[id.Source]; has {
+		return ProjectIdentifier{ProjectRoot: id.ProjectRoot}, true
+	}
+	return id, !sm.unreachable[id.ProjectRoot]
+}
+
+func (sm *fallbackSM) SourceExists(id ProjectIdentifier) (bool, error) {
+	if uid, ok := sm.upstream(id); ok {
+		return sm.depspecSourceManager.SourceExists(uid)
+	}
+	return false, fmt.Errorf("could not reach %s", id)
+}
+
+func (sm *fallbackSM) ListVersions(id ProjectIdentifier) ([]PairedVersion, error) {
+	uid, ok := sm.upstream(id)
+	if !ok {
+		return nil, &SourceUnreachableError{Ident: id, Err: fmt.Errorf("could not reach %s", id)}
+	}
+	pvl, err := sm.depspecSourceManager.ListVersions(uid)
+	revs, has := sm.forks[id.Source]
+	if !has || err != nil {
+		return pvl, err
+	}
+
+	var fpvl []PairedVersion
+	for _, pv := range pvl {
+		if rev, has := revs[pv.Unpair().String()]; has {
+			fpvl = append(fpvl, pv.Unpair().Pair(rev))
+		}
+	}
+	return fpvl, nil
+}
+
+func (sm *fallbackSM) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
+	revs, has := sm.forks[id.Source]
+	if !has {
+		return false, fmt.Errorf("could not reach %s", id)
+	}
+	for _, rev := range revs {
+		if rev == r {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (sm *fallbackSM) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
+	uid, ok := sm.upstream(id)
+	if !ok {
+		return nil, nil, fmt.Errorf("could not reach %s", id)
+	}
+	return sm.depspecSourceManager.GetManifestAndLock(uid, v, an)
+}
+
+func (sm *fallbackSM) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
+	uid, ok := sm.upstream(id)
+	if !ok {
+		return pkgtree.PackageTree{}, fmt.Errorf("could not reach %s", id)
+	}
+	return sm.depspecSourceManager.ListPackages(uid, v)
+}
+
+func TestSourceFallbacks(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 2.0.0"),
+		},
+		l: mklock("a 1.0.0 abc123"),
+	}
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		Lock:            fix.l,
+		ProjectAnalyzer: naiveAnalyzer{},
+		ChangeAll:       true,
+	}
+	newSM := func() *fallbackSM {
+		return &fallbackSM{
+			depspecSourceManager: newdepspecSM(fix.ds, nil),
+			unreachable:          map[ProjectRoot]bool{"a": true},
+			forks: map[string]map[string]Revision{
+				"example.com/stale/a": {"1.0.0": "def456", "2.0.0": "fff000"},
+				"example.com/fork/a":  {"1.0.0": "abc123", "2.0.0": "fff999"},
+			},
+		}
+	}
+
+	if _, err := fixSolve(params, newSM(), t); err == nil {
+		t.Fatal("expected the solve to fail without fallbacks, as a cannot be reached")
+	}
+
+	params.SourceFallbacks = map[ProjectRoot][]string{
+		"a": {"example.com/stale/a", "example.com/fork/a"},
+	}
+	soln, err := fixSolve(params, newSM(), t)
+	if err != nil {
+		t.Fatalf("expected the solve to fall back to the fork, got %s", err)
+	}
+
+	lps := soln.Projects()
+	if len(lps) != 1 {
+		t.Fatalf("expected one project in the solution, got %d", len(lps))
+	}
+	want := ProjectIdentifier{ProjectRoot: "a", Source: "example.com/fork/a"}
+	// Though a change was requested, the fork's other versions are not
+	// considered, as nothing vouches for them.
+	if lps[0].Ident() != want || lps[0].Version().String() != "1.0.0" {
+		t.Errorf("expected a@1.0.0 from the fork, got %s@%s", lps[0].Ident(), lps[0].Version())
+	}
+
+	sub, has := soln.Substitutions()["a"]
+	if !has {
+		t.Fatal("expected the substitution to be reported")
+	}
+	if sub != (SourceSubstitution{Substitute: "example.com/fork/a", Revision: "abc123"}) {
+		t.Errorf("unexpected substitution %+v", sub)
+	}
+
+	// Without the locked revision in any fork, nothing is substituted.
+	params.SourceFallbacks = map[ProjectRoot][]string{"a": {"example.com/stale/a"}}
+	if _, err := fixSolve(params, newSM(), t); err == nil {
+		t.Error("expected no fallback to be used without the locked revision")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep/internal/fs"
+	"github.com/pkg/errors"
+)
+
+// GitPlumbing is the low-level interface through which git sources list,
+// fetch and export the contents of git repositories. By default, the
+// SourceManager runs the git command line; an alternate implementation, such
+// as one built on a pure Go git library or a server-side object store, may be
+// provided in SourceManagerConfig.
+//
+// Each git source is kept as a local repository in the SourceManager's
+// Cachedir. Implementations must leave that repository in a form that git
+// itself can read, as the revision of a project that is analyzed is still
+// checked out with git.
+type GitPlumbing interface {
+	// ListRefs lists the refs advertised by the upstream repository at
+	// remote, in the format of git ls-remote's output, with any HEAD ref
+	// first. dir is the local repository, which may not exist yet.
+	ListRefs(ctx context.Context, remote, dir string) ([]byte, error)
+
+	// FetchRevision brings the local repository at dir up to date with the
+	// upstream repository at remote, cloning it if dir does not exist yet. If
+	// rev is empty, all of the upstream's branches and tags are fetched;
+	// otherwise, only rev need be.
+	FetchRevision(ctx context.Context, remote, dir string, rev Revision) error
+
+	// ExportTree writes the tree of the revision rev in the local repository
+	// at dir out to the existing directory to, without any VCS metadata.
+	ExportTree(ctx context.Context, dir string, rev Revision, to string) error
+}
+
+// execGitPlumbing is the default GitPlumbing, which runs the git command
+// line in env.
+type execGitPlumbing struct {
+	env vcsEnv
+}
+
+func (p execGitPlumbing) ListRefs(ctx context.Context, remote, dir string) ([]byte, error) {
+	cmd := commandContext(ctx, p.env, "git", "ls-remote", remote)
+	// We want to invoke from a place where it's not possible for there to be a
+	// .git file instead of a .git directory, as git ls-remote will choke on the
+	// former and erroneously quit. However, we can't be sure that the repo
+	// exists on disk yet at this point; if it doesn't, then instead use the
+	// parent of the local path, as that's still likely a good bet.
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		cmd.SetDir(dir)
+	} else {
+		cmd.SetDir(filepath.Dir(dir))
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, gitAccessError(remote, string(out), errors.Wrap(err, string(out)))
+	}
+	return out, nil
+}
+
+// FetchRevision always fetches all branches and tags, which includes rev
+// wherever it is reachable from one of them. An existing local repository is
+// fetched from the origin remote that it was cloned from.
+//
+// As with ListRefs, failures due to refused access or a missing repository are
+// reported as an *AuthenticationError or ErrRepositoryNotFound.
+func (p execGitPlumbing) FetchRevision(ctx context.Context, remote, dir string, rev Revision) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		cmd := commandContext(
+			ctx,
+			p.env,
+			"git",
+			"clone",
+			"--recursive",
+			"-v",
+			"--progress",
+			remote,
+			dir,
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return gitAccessError(remote, string(out), newVcsRemoteErrorOr(err, cmd.Args(), string(out),
+				"unable to get repository"))
+		}
+		return nil
+	}
+
+	cmd := commandContext(
+		ctx,
+		p.env,
+		"git",
+		"fetch",
+		"--tags",
+		"--prune",
+		"origin",
+	)
+	cmd.SetDir(dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return gitAccessError(remote, string(out), newVcsRemoteErrorOr(err, cmd.Args(), string(out),
+			"unable to update repository"))
+	}
+	return nil
+}
+
+func (p execGitPlumbing) ExportTree(ctx context.Context, dir string, rev Revision, to string) error {
+	// Back up original index
+	idx, bak := filepath.Join(dir, ".git", "index"), filepath.Join(dir, ".git", "origindex")
+	err := fs.RenameWithFallback(idx, bak)
+	if err != nil {
+		return err
+	}
+
+	// could have an err here...but it's hard to imagine how?
+	defer fs.RenameWithFallback(bak, idx)
+
+	{
+		cmd := commandContext(ctx, p.env, "git", "read-tree", rev.String())
+		cmd.SetDir(dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return errors.Wrap(err, string(out))
+		}
+	}
+
+	// Ensure we have exactly one trailing slash
+	to = strings.TrimSuffix(to, string(os.PathSeparator)) + string(os.PathSeparator)
+	// Checkout from our temporary index to the desired target location on
+	// disk; now it's git's job to make it fast.
+	//
+	// Sadly, this approach *does* also write out vendor dirs. There doesn't
+	// appear to be a way to make checkout-index respect sparse checkout
+	// rules (-a supersedes it). The alternative is using plain checkout,
+	// though we have a bunch of housekeeping to do to set up, then tear
+	// down, the sparse checkout controls, as well as restore the original
+	// index and HEAD.
+	{
+		cmd := commandContext(ctx, p.env, "git", "checkout-index", "-a", "--prefix="+to)
+		cmd.SetDir(dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return errors.Wrap(err, string(out))
+		}
+	}
+
+	return nil
+}
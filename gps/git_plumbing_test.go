@@ -0,0 +1,105 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recordingGitPlumbing is a GitPlumbing that serves canned refs and records
+// what it is asked to do.
+type recordingGitPlumbing struct {
+	refs    string
+	fetched []Revision
+	export  Revision
+}
+
+func (p *recordingGitPlumbing) ListRefs(ctx context.Context, remote, dir string) ([]byte, error) {
+	return []byte(p.refs), nil
+}
+
+func (p *recordingGitPlumbing) FetchRevision(ctx context.Context, remote, dir string, rev Revision) error {
+	p.fetched = append(p.fetched, rev)
+	return os.MkdirAll(filepath.Join(dir, ".git"), 0777)
+}
+
+func (p *recordingGitPlumbing) ExportTree(ctx context.Context, dir string, rev Revision, to string) error {
+	p.export = rev
+	return ioutil.WriteFile(filepath.Join(to, "exported"), []byte(rev), 0666)
+}
+
+func TestGitPlumbing(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "go-vcs-plumbing-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	const rev = "30605f6ac35fcb075ad0bfa9296f90a7d891523e"
+	p := &recordingGitPlumbing{
+		refs: rev + "\tHEAD\n" +
+			rev + "\trefs/heads/master\n" +
+			rev + "\trefs/tags/v1.0.0\n",
+	}
+	ctx := context.Background()
+
+	u, err := url.Parse("https://example.com/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	isrc, err := maybeGitSource{url: u}.try(ctx, cacheDir{root: tempDir}, sourceSettings{plumbing: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := isrc.(*gitSource)
+
+	if err = src.initLocal(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = src.updateLocal(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.fetched) != 2 || p.fetched[0] != "" || p.fetched[1] != "" {
+		t.Errorf("expected two fetches of everything, got %q", p.fetched)
+	}
+
+	vlist, err := src.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortPairedForUpgrade(vlist)
+	want := []PairedVersion{
+		NewVersion("v1.0.0").Pair(rev),
+		newDefaultBranch("master").Pair(rev),
+	}
+	if len(vlist) != len(want) {
+		t.Fatalf("expected versions %s, got %s", want, vlist)
+	}
+	for i := range want {
+		if !vlist[i].identical(want[i]) {
+			t.Errorf("expected version %s at %d, got %s", want[i], i, vlist[i])
+		}
+	}
+
+	to := filepath.Join(tempDir, "export")
+	if err = src.exportRevisionTo(ctx, rev, to); err != nil {
+		t.Fatal(err)
+	}
+	if p.export != rev {
+		t.Errorf("expected %s to be exported, got %q", rev, p.export)
+	}
+	if _, err = os.Stat(filepath.Join(to, "exported")); err != nil {
+		t.Errorf("expected the tree to be exported to %s: %s", to, err)
+	}
+
+	if _, ok := (sourceSettings{}).gitPlumbing().(execGitPlumbing); !ok {
+		t.Error("expected git's command line to be the default plumbing")
+	}
+}
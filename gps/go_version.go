@@ -0,0 +1,44 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// goVersion is a version of the Go toolchain. Omitted minor and patch numbers
+// are zero.
+type goVersion [3]int
+
+// parseGoVersion parses a major.minor[.patch] Go toolchain version, such as
+// "1.10" or "1.9.7".
+func parseGoVersion(s string) (goVersion, error) {
+	var v goVersion
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return v, errors.Errorf("%q is not a major.minor[.patch] Go version", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || strings.HasPrefix(p, "+") {
+			return v, errors.Errorf("%q is not a major.minor[.patch] Go version", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// less reports whether v is older than v2.
+func (v goVersion) less(v2 goVersion) bool {
+	for i := range v {
+		if v[i] != v2[i] {
+			return v[i] < v2[i]
+		}
+	}
+	return false
+}
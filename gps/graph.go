@@ -0,0 +1,194 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// DependencyGraph is the graph of the dependencies between the projects in a
+// solution, or between those selected when a solve failed, annotated with the
+// versions chosen and the constraints that led to them. It marshals to JSON
+// as is, and WriteDOT renders it for Graphviz.
+type DependencyGraph struct {
+	// Nodes holds the projects in the graph, sorted by project root.
+	Nodes []GraphNode `json:"nodes"`
+	// Edges holds the dependencies between them, sorted by depender, then
+	// dependency.
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a project in a DependencyGraph.
+type GraphNode struct {
+	Project ProjectRoot `json:"project"`
+	// Version and Revision identify the version chosen for the project. Both
+	// are empty for the root project, and for a project for which no version
+	// could be chosen.
+	Version  string `json:"version,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	// Root is set for the root project.
+	Root bool `json:"root,omitempty"`
+}
+
+// GraphEdge is a dependency in a DependencyGraph.
+type GraphEdge struct {
+	// From is the depender, and To the project on which it depends.
+	From ProjectRoot `json:"from"`
+	To   ProjectRoot `json:"to"`
+	// Constraint is the constraint that From imposed on To, and Kind its kind.
+	Constraint string `json:"constraint"`
+	Kind       string `json:"kind"`
+	// Overridden is set if Constraint is an override from the root manifest,
+	// which took the place of whatever constraint From declared. It is only
+	// known for the graphs of failed solves.
+	Overridden bool `json:"overridden,omitempty"`
+}
+
+// NewDependencyGraph returns the dependency graph of a solution. Every
+// depender that is not among the selected projects is the root project.
+func NewDependencyGraph(soln Solution) DependencyGraph {
+	gb := newGraphBuilder()
+	for _, lp := range soln.Projects() {
+		gb.node(lp.Ident().ProjectRoot, lp.Version(), false)
+	}
+	for pr, ac := range soln.AggregateConstraints() {
+		for _, dc := range ac.Dependers {
+			if _, has := gb.nodes[dc.Depender]; !has {
+				gb.node(dc.Depender, nil, true)
+			}
+			gb.edge(dc.Depender, pr, dc.Constraint, false)
+		}
+	}
+	return gb.graph()
+}
+
+// Graph returns the dependency graph among the projects that had been
+// selected when the solve failed, as far as it is recorded in Constraints.
+// The project that could not be selected has no version.
+func (f *SolveFailure) Graph() DependencyGraph {
+	gb := newGraphBuilder()
+	gb.node(f.Project.ProjectRoot, nil, false)
+
+	var walk func(pr ProjectRoot, ics []ImposedConstraint)
+	walk = func(pr ProjectRoot, ics []ImposedConstraint) {
+		for _, ic := range ics {
+			by := ic.By.ProjectRoot
+			gb.node(by, ic.Version, ic.Version == nil)
+			gb.edge(by, pr, ic.Constraint, ic.Overridden)
+			walk(by, ic.Dependers)
+		}
+	}
+	for pr, ics := range f.Constraints {
+		gb.node(pr, nil, false)
+		walk(pr, ics)
+	}
+	return gb.graph()
+}
+
+// WriteDOT writes the graph to w in the DOT language. Each project is labeled
+// with the version chosen for it, and each dependency with its constraint.
+func (g DependencyGraph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph {\n\tnode [shape=box];")
+	for _, n := range g.Nodes {
+		label := string(n.Project)
+		if n.Version != "" {
+			label += "\n" + n.Version
+		}
+		if n.Revision != "" && n.Revision != n.Version {
+			label += "\n" + n.Revision
+		}
+		attrs := ""
+		if n.Root {
+			attrs = ", style=bold"
+		}
+		fmt.Fprintf(bw, "\t%s [label=%s%s];\n", strconv.Quote(string(n.Project)), strconv.Quote(label), attrs)
+	}
+	for _, e := range g.Edges {
+		attrs := ""
+		if e.Overridden {
+			attrs = ", style=dashed"
+		}
+		fmt.Fprintf(bw, "\t%s -> %s [label=%s%s];\n", strconv.Quote(string(e.From)), strconv.Quote(string(e.To)), strconv.Quote(e.Constraint), attrs)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// graphBuilder accumulates the nodes and edges of a DependencyGraph, merging
+// duplicates.
+type graphBuilder struct {
+	nodes map[ProjectRoot]GraphNode
+	edges map[GraphEdge]bool
+}
+
+func newGraphBuilder() *graphBuilder {
+	return &graphBuilder{
+		nodes: make(map[ProjectRoot]GraphNode),
+		edges: make(map[GraphEdge]bool),
+	}
+}
+
+// node adds the project at version v, which may be nil, unless the project
+// has already been added with a version.
+func (gb *graphBuilder) node(pr ProjectRoot, v Version, root bool) {
+	n := gb.nodes[pr]
+	n.Project = pr
+	n.Root = n.Root || root
+	gb.nodes[pr] = n
+	if n.Version != "" || n.Revision != "" {
+		return
+	}
+
+	switch tv := v.(type) {
+	case nil:
+		return
+	case Revision:
+		n.Revision = string(tv)
+	case PairedVersion:
+		n.Version = tv.Unpair().String()
+		n.Revision = string(tv.Revision())
+	default:
+		n.Version = tv.String()
+	}
+	gb.nodes[pr] = n
+}
+
+func (gb *graphBuilder) edge(from, to ProjectRoot, c Constraint, overridden bool) {
+	gb.edges[GraphEdge{
+		From:       from,
+		To:         to,
+		Constraint: c.String(),
+		Kind:       KindOf(c).String(),
+		Overridden: overridden,
+	}] = true
+}
+
+func (gb *graphBuilder) graph() DependencyGraph {
+	var g DependencyGraph
+	for _, n := range gb.nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	for e := range gb.edges {
+		g.Edges = append(g.Edges, e)
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Project < g.Nodes[j].Project })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		switch {
+		case a.From != b.From:
+			return a.From < b.From
+		case a.To != b.To:
+			return a.To < b.To
+		}
+		return a.Constraint < b.Constraint
+	})
+	return g
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a ^1.0.0", "b *"),
+			mkDepspec("a 1.1.0", "c ^1.0.0"),
+			mkDepspec("b 1.0.0", "c 1.0.0"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("c 1.1.0"),
+		},
+	}
+	params := basicFixtureParams(fix)
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewDependencyGraph(soln)
+
+	var buf bytes.Buffer
+	if err = g.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph {
+	node [shape=box];
+	"a" [label="a\n1.1.0"];
+	"b" [label="b\n1.0.0"];
+	"c" [label="c\n1.0.0"];
+	"root" [label="root", style=bold];
+	"a" -> "c" [label="^1.0.0"];
+	"b" -> "c" [label="1.0.0"];
+	"root" -> "a" [label="^1.0.0"];
+	"root" -> "b" [label="*"];
+}
+`
+	if buf.String() != want {
+		t.Errorf("unexpected DOT output:\n\t(GOT):\n%s\n\t(WNT):\n%s", buf.String(), want)
+	}
+
+	data, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back DependencyGraph
+	if err = json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, g) {
+		t.Errorf("expected the graph to survive a round trip through JSON:\n\t(GOT): %+v\n\t(WNT): %+v", back, g)
+	}
+	if e := g.Edges[1]; e.From != "b" || e.To != "c" || e.Kind != "version" {
+		t.Errorf("expected b to pin c to a version, got %+v", e)
+	}
+}
+
+func TestSolveFailureGraph(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a 1.0.0", "b 1.0.0"),
+			mkDepspec("a 1.0.0", "c ^1.0.0"),
+			mkDepspec("b 1.0.0", "c ^2.0.0"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("c 2.0.0"),
+		},
+	}
+	params := basicFixtureParams(fix)
+	_, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	sf, ok := err.(*SolveFailure)
+	if !ok {
+		t.Fatalf("expected a *SolveFailure, got %T: %v", err, err)
+	}
+
+	want := DependencyGraph{
+		Nodes: []GraphNode{
+			{Project: "a", Version: "1.0.0"},
+			{Project: "b"},
+			{Project: "c"},
+			{Project: "root", Root: true},
+		},
+		Edges: []GraphEdge{
+			{From: "a", To: "c", Constraint: "^1.0.0", Kind: "semver range"},
+			{From: "root", To: "a", Constraint: "1.0.0", Kind: "version"},
+			{From: "root", To: "b", Constraint: "1.0.0", Kind: "version"},
+		},
+	}
+	if g := sf.Graph(); !reflect.DeepEqual(g, want) {
+		t.Errorf("unexpected graph:\n\t(GOT): %+v\n\t(WNT): %+v", g, want)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sort"
+	"strconv"
+
+	"github.com/golang/dep/gps/paths"
+)
+
+// HashInputs computes the digest that a Solver prepared from the params would
+// report from its HashInputs method, without preparing one. It fails if the
+// params are not valid for solving.
+func HashInputs(params SolveParameters) ([]byte, error) {
+	rd, err := params.toRootdata()
+	if err != nil {
+		return nil, err
+	}
+	if params.stdLibFn == nil {
+		params.stdLibFn = paths.IsStandardImportPath
+	}
+	return hashRootdata(rd, params.GoVersion, params.stdLibFn), nil
+}
+
+// HashInputs computes a digest of the inputs to the solve that are under the
+// control of the root project, as described on the Solver interface.
+func (s *solver) HashInputs() []byte {
+	return hashRootdata(s.rd, s.gover, s.stdLibFn)
+}
+
+// hashRootdata computes the inputs digest for the root data and Go version.
+// The inputs are written in a fixed order - each set of them sorted, and each
+// section ended with a separator - so that the digest depends only on what
+// they are.
+func hashRootdata(rd rootdata, gover string, stdLibFn func(string) bool) []byte {
+	buf := new(bytes.Buffer)
+	section := func(lines []string) {
+		for _, l := range lines {
+			buf.WriteString(l)
+			buf.WriteByte('\n')
+		}
+		buf.WriteByte(0)
+	}
+
+	section(rd.externalImportList(stdLibFn))
+
+	ext := append([]string(nil), rd.ext...)
+	sort.Strings(ext)
+	section(ext)
+
+	req := make([]string, 0, len(rd.req))
+	for pkg := range rd.req {
+		req = append(req, pkg)
+	}
+	sort.Strings(req)
+	section(req)
+
+	section(rd.ir.ToSlice())
+	section(hashConstraints(rd.rm.DependencyConstraints()))
+	section(hashConstraints(rd.ovr))
+	section([]string{gover})
+
+	ai := rd.an.Info()
+	section([]string{
+		ai.Name, strconv.Itoa(ai.Version),
+		solverName, strconv.Itoa(solverVersion),
+	})
+
+	h := sha256.Sum256(buf.Bytes())
+	return h[:]
+}
+
+// hashConstraints returns the lines by which the constraints are written into
+// an inputs digest, sorted by project root.
+func hashConstraints(pc ProjectConstraints) []string {
+	lines := make([]string, 0, len(pc))
+	for pr, pp := range pc {
+		c := "*"
+		if pp.Constraint != nil {
+			c = pp.Constraint.typedString()
+		}
+		lines = append(lines, string(pr)+"\t"+pp.Source+"\t"+c)
+	}
+	sort.Strings(lines)
+	return lines
+}
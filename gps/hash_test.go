@@ -0,0 +1,79 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHashInputs(t *testing.T) {
+	ds := []depspec{
+		mkDepspec("root 0.0.0"),
+		mkDepspec("foo 1.0.0"),
+		mkDepspec("bar 1.0.0"),
+	}
+	params := func(c, ovr ProjectConstraints, req map[string]bool) SolveParameters {
+		return SolveParameters{
+			RootDir:         "root",
+			RootPackageTree: rootImporting("foo", "bar"),
+			Manifest:        simpleRootManifest{c: c, ovr: ovr, req: req},
+			ProjectAnalyzer: naiveAnalyzer{},
+			stdLibFn:        func(string) bool { return false },
+			mkBridgeFn:      overrideMkBridge,
+		}
+	}
+	hash := func(p SolveParameters) []byte {
+		s, err := Prepare(p, newdepspecSM(ds, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.HashInputs()
+	}
+
+	cons := func(prs ...ProjectRoot) ProjectConstraints {
+		pc := make(ProjectConstraints)
+		for _, pr := range prs {
+			pc[pr] = ProjectProperties{Constraint: mkSVC("^1.0.0")}
+		}
+		return pc
+	}
+	base := hash(params(cons("foo", "bar"), nil, nil))
+	if !bytes.Equal(base, hash(params(cons("bar", "foo"), nil, nil))) {
+		t.Error("expected the digest not to depend on the order of the constraints")
+	}
+
+	phash, err := HashInputs(params(cons("foo", "bar"), nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(base, phash) {
+		t.Error("expected the digest of the params to match the one reported by the solver")
+	}
+
+	gp := params(cons("foo", "bar"), nil, nil)
+	gp.GoVersion = "1.9"
+	if bytes.Equal(base, hash(gp)) {
+		t.Error("expected a changed Go version to change the digest")
+	}
+
+	for name, p := range map[string]SolveParameters{
+		"constraint": params(cons("foo"), nil, nil),
+		"override":   params(cons("foo", "bar"), cons("foo"), nil),
+		"required":   params(cons("foo", "bar"), nil, map[string]bool{"baz": true}),
+	} {
+		if bytes.Equal(base, hash(p)) {
+			t.Errorf("expected a changed %s to change the digest", name)
+		}
+	}
+
+	soln, err := fixSolve(params(cons("foo", "bar"), nil, nil), newdepspecSM(ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(soln.InputsHash(), base) {
+		t.Errorf("expected the solution to report the digest of its inputs")
+	}
+}
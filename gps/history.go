@@ -0,0 +1,149 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"container/heap"
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HistoricalVersionLister is implemented by SourceManagers that can list the
+// versions of a project as they existed at some point in the past. It is
+// required in order to solve with SolveParameters.AsOf.
+type HistoricalVersionLister interface {
+	// ListVersionsAsOf returns the versions of the project that existed at
+	// the given time. Branches are paired with the revision at which they
+	// stood at that time, rather than their current revision.
+	//
+	// Versions are derived from those that exist now, so tags and branches
+	// that have since been deleted are not reported.
+	ListVersionsAsOf(ProjectIdentifier, time.Time) ([]PairedVersion, error)
+}
+
+// ContextHistoricalVersionLister is a HistoricalVersionLister that can list
+// versions under a context. The solver prefers it, so that listings are
+// abandoned along with the solve that made them.
+type ContextHistoricalVersionLister interface {
+	HistoricalVersionLister
+	ListVersionsAsOfContext(context.Context, ProjectIdentifier, time.Time) ([]PairedVersion, error)
+}
+
+// listVersionsAsOf lists the versions of the project that existed at the
+// solver's AsOf time, under the context of the current solve run if the
+// SourceManager supports it.
+func (b *bridge) listVersionsAsOf(id ProjectIdentifier) ([]PairedVersion, error) {
+	if hl, ok := b.sm.(ContextHistoricalVersionLister); ok {
+		return hl.ListVersionsAsOfContext(b.solveContext(), id, b.s.asOf)
+	}
+	// Prepare has already ensured that this assertion holds.
+	return b.sm.(HistoricalVersionLister).ListVersionsAsOf(id, b.s.asOf)
+}
+
+// sourceHistory is implemented by sources that can determine, using their
+// local repository, which of their current versions existed at a given time.
+type sourceHistory interface {
+	source
+	versionsAsOf(ctx context.Context, pvl []PairedVersion, t time.Time) ([]PairedVersion, error)
+}
+
+// gitCommit is a commit in a graph read by parseGitCommitGraph.
+type gitCommit struct {
+	time    time.Time
+	parents []string
+}
+
+// parseGitCommitGraph parses the output of `git log --format='%H %ct %P'` into
+// a map of commit hashes to their commits.
+func parseGitCommitGraph(out []byte) (map[string]gitCommit, error) {
+	graph := make(map[string]gitCommit)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, errors.Errorf("unexpected git log output: %q", line)
+		}
+		secs, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unexpected git log output: %q", line)
+		}
+		graph[fields[0]] = gitCommit{time: time.Unix(secs, 0), parents: fields[2:]}
+	}
+	return graph, nil
+}
+
+// newestCommitBefore returns the commit among head and its ancestors in the
+// graph that `git rev-list -n 1 --before=<t> <head>` would: the first one not
+// committed after t, walking back from head most recently committed first. It
+// returns the empty string if there is none.
+func newestCommitBefore(graph map[string]gitCommit, head string, t time.Time) string {
+	q := &commitQueue{graph: graph}
+	seen := map[string]bool{head: true}
+	heap.Push(q, head)
+	for q.Len() > 0 {
+		h := heap.Pop(q).(string)
+		c, has := graph[h]
+		if !has {
+			continue
+		}
+		if !c.time.After(t) {
+			return h
+		}
+		for _, p := range c.parents {
+			if !seen[p] {
+				seen[p] = true
+				heap.Push(q, p)
+			}
+		}
+	}
+	return ""
+}
+
+// commitQueue is a heap of commit hashes, most recently committed first.
+type commitQueue struct {
+	graph  map[string]gitCommit
+	hashes []string
+}
+
+func (q *commitQueue) Len() int { return len(q.hashes) }
+func (q *commitQueue) Less(i, j int) bool {
+	return q.graph[q.hashes[i]].time.After(q.graph[q.hashes[j]].time)
+}
+func (q *commitQueue) Swap(i, j int)      { q.hashes[i], q.hashes[j] = q.hashes[j], q.hashes[i] }
+func (q *commitQueue) Push(x interface{}) { q.hashes = append(q.hashes, x.(string)) }
+func (q *commitQueue) Pop() interface{} {
+	h := q.hashes[len(q.hashes)-1]
+	q.hashes = q.hashes[:len(q.hashes)-1]
+	return h
+}
+
+// parseGitRefTimes parses the output of
+// `git for-each-ref --format='%(refname) %(creatordate:raw)'` into a map of
+// ref names to their creation times.
+func parseGitRefTimes(out []byte) (map[string]time.Time, error) {
+	times := make(map[string]time.Time)
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+		// The raw date is seconds since the epoch, followed by a zone offset.
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, errors.Errorf("unexpected git for-each-ref output: %q", line)
+		}
+		secs, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unexpected git for-each-ref output: %q", line)
+		}
+		times[fields[0]] = time.Unix(secs, 0)
+	}
+	return times, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseGitRefTimes(t *testing.T) {
+	times, err := parseGitRefTimes([]byte("refs/tags/v1.0.0 1500000000 +0200\nrefs/tags/v1.1.0 1600000000 -0700\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]time.Time{
+		"refs/tags/v1.0.0": time.Unix(1500000000, 0),
+		"refs/tags/v1.1.0": time.Unix(1600000000, 0),
+	}
+	if !reflect.DeepEqual(times, want) {
+		t.Errorf("unexpected ref times:\n\t(GOT): %v\n\t(WNT): %v", times, want)
+	}
+
+	if _, err = parseGitRefTimes([]byte("refs/tags/v1.0.0 yesterday +0000\n")); err == nil {
+		t.Error("expected an error from a malformed date")
+	}
+}
+
+func TestGitSourceVersionsAsOf(t *testing.T) {
+	requiresBins(t, "git")
+
+	tmp, err := ioutil.TempDir("", "gps-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	repo := newLocalGitRepo(t, filepath.Join(tmp, "upstream"))
+	commitAt := func(when time.Time, msg string) Revision {
+		date := strconv.FormatInt(when.Unix(), 10) + " +0000"
+		repo.env = []string{"GIT_AUTHOR_DATE=" + date, "GIT_COMMITTER_DATE=" + date}
+		repo.write("a.go", "package a // "+msg+"\n")
+		repo.git("add", "-A")
+		repo.git("commit", "-q", "-m", msg)
+		return Revision(repo.git("rev-parse", "HEAD"))
+	}
+
+	jan := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := commitAt(jan, "first")
+	repo.git("tag", "-a", "v1.0.0", "-m", "v1.0.0")
+	second := commitAt(jan.AddDate(0, 6, 0), "second")
+	repo.git("tag", "-a", "v1.1.0", "-m", "v1.1.0")
+
+	ctx := context.Background()
+	src := repo.source(ctx, filepath.Join(tmp, "cache"))
+
+	pvl, err := src.listVersions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := src.versionsAsOf(ctx, pvl, jan.AddDate(0, 3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortPairedForUpgrade(got)
+	want := []PairedVersion{
+		NewVersion("v1.0.0").Pair(first),
+		newDefaultBranch("master").Pair(first),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected versions three months in:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	if got, err = src.versionsAsOf(ctx, pvl, jan.AddDate(-1, 0, 0)); err != nil || len(got) != 0 {
+		t.Errorf("expected no versions before the first commit, got %v, %v", got, err)
+	}
+
+	got, err = src.versionsAsOf(ctx, pvl, jan.AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(pvl) {
+		t.Errorf("expected all %d versions to exist a year in, got %v", len(pvl), got)
+	}
+	for _, pv := range got {
+		if pv.Unpair().Type() == IsBranch && pv.Revision() != second {
+			t.Errorf("expected %s to be at the latest revision a year in, got %s", pv, pv.Revision())
+		}
+	}
+}
+
+func TestNewestCommitBefore(t *testing.T) {
+	// mc merges mb, a branch from ma, back into it.
+	graph, err := parseGitCommitGraph([]byte("mc 1000 ma mb\nmb 500 ma\nma 100\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for when, want := range map[int64]string{50: "", 100: "ma", 499: "ma", 600: "mb", 1000: "mc"} {
+		if got := newestCommitBefore(graph, "mc", time.Unix(when, 0)); got != want {
+			t.Errorf("expected %q to be the newest commit at %d, got %q", want, when, got)
+		}
+	}
+
+	if _, err = parseGitCommitGraph([]byte("ma yesterday\n")); err == nil {
+		t.Error("expected an error from a malformed date")
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+// ProjectEntry describes a project at the moment it first enters a solve, as
+// passed to a ProjectHook.
+type ProjectEntry struct {
+	Ident ProjectIdentifier
+	// Constraint is the aggregate constraint on the project - the
+	// intersection of the constraints from all currently selected dependers.
+	Constraint Constraint
+	// Candidates is the list of all versions of the project known to exist,
+	// in the order in which the solver prefers them. Versions disallowed by
+	// Constraint are included, as the constraint may loosen as the solver
+	// backtracks.
+	Candidates []Version
+}
+
+// CandidateVerdict is a ProjectHook's judgment on a candidate version.
+type CandidateVerdict struct {
+	// Veto excludes the version from selection, exactly as though it were
+	// disallowed by a constraint.
+	Veto bool
+	// Note is a free-form annotation recorded in the trace when the version is
+	// considered. For vetoed versions, it is also included in the failure.
+	Note string
+}
+
+// ProjectHook is invoked by the solver the first time each project enters
+// the solve, allowing policy engines to veto or annotate candidate versions
+// without requiring changes to the solver itself.
+//
+// The returned map need only contain the versions the hook has an opinion
+// about. A verdict applies to every candidate that its key matches, so a
+// verdict keyed by NewVersion("v1.0.0") applies to that version paired with
+// any revision. If several verdicts match the same candidate, a veto by any of
+// them wins, and their notes are combined.
+//
+// The hook is invoked only once per project per solve, and should be
+// deterministic; it is not safe to rely on the order in which it is invoked
+// for different projects.
+type ProjectHook func(ProjectEntry) map[Version]CandidateVerdict
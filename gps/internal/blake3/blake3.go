@@ -0,0 +1,267 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package blake3 implements the BLAKE3 hash function, in its default, unkeyed
+// mode, with 32 byte output.
+//
+// It is a straightforward, portable rendering of the reference implementation
+// in the BLAKE3 specification, without the SIMD parallelism of the optimized
+// implementations, and is meant only for hashing trees of source files.
+package blake3
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// Size is the size of a BLAKE3 digest in bytes.
+const Size = 32
+
+// BlockSize is the block size of BLAKE3 in bytes.
+const BlockSize = 64
+
+const (
+	chunkLen = 1024
+
+	flagChunkStart = 1 << 0
+	flagChunkEnd   = 1 << 1
+	flagParent     = 1 << 2
+	flagRoot       = 1 << 3
+)
+
+var iv = [8]uint32{
+	0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A,
+	0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19,
+}
+
+var msgPermutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+// g is the quarter-round mixing function.
+func g(s *[16]uint32, a, b, c, d int, mx, my uint32) {
+	s[a] = s[a] + s[b] + mx
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] = s[c] + s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] = s[a] + s[b] + my
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] = s[c] + s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+func round(s *[16]uint32, m *[16]uint32) {
+	// Mix the columns.
+	g(s, 0, 4, 8, 12, m[0], m[1])
+	g(s, 1, 5, 9, 13, m[2], m[3])
+	g(s, 2, 6, 10, 14, m[4], m[5])
+	g(s, 3, 7, 11, 15, m[6], m[7])
+	// Mix the diagonals.
+	g(s, 0, 5, 10, 15, m[8], m[9])
+	g(s, 1, 6, 11, 12, m[10], m[11])
+	g(s, 2, 7, 8, 13, m[12], m[13])
+	g(s, 3, 4, 9, 14, m[14], m[15])
+}
+
+func permute(m *[16]uint32) {
+	var p [16]uint32
+	for i := range p {
+		p[i] = m[msgPermutation[i]]
+	}
+	*m = p
+}
+
+func compress(cv *[8]uint32, block *[16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		iv[0], iv[1], iv[2], iv[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	m := *block
+	for i := 0; i < 7; i++ {
+		round(&s, &m)
+		if i < 6 {
+			permute(&m)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+	return s
+}
+
+func first8(s [16]uint32) [8]uint32 {
+	var cv [8]uint32
+	copy(cv[:], s[:8])
+	return cv
+}
+
+func wordsFromBlock(b *[BlockSize]byte) [16]uint32 {
+	var w [16]uint32
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	return w
+}
+
+// output is the state from which either a chaining value or, for the root
+// node, the final digest is computed.
+type output struct {
+	cv       [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o *output) chainingValue() [8]uint32 {
+	return first8(compress(&o.cv, &o.block, o.counter, o.blockLen, o.flags))
+}
+
+func (o *output) rootBytes() [Size]byte {
+	var out [Size]byte
+	words := compress(&o.cv, &o.block, 0, o.blockLen, o.flags|flagRoot)
+	for i := 0; i < Size/4; i++ {
+		binary.LittleEndian.PutUint32(out[4*i:], words[i])
+	}
+	return out
+}
+
+type chunkState struct {
+	cv               [8]uint32
+	counter          uint64
+	block            [BlockSize]byte
+	blockLen         int
+	blocksCompressed int
+}
+
+func newChunkState(counter uint64) chunkState {
+	return chunkState{cv: iv, counter: counter}
+}
+
+func (cs *chunkState) len() int {
+	return BlockSize*cs.blocksCompressed + cs.blockLen
+}
+
+func (cs *chunkState) startFlag() uint32 {
+	if cs.blocksCompressed == 0 {
+		return flagChunkStart
+	}
+	return 0
+}
+
+func (cs *chunkState) update(p []byte) {
+	for len(p) > 0 {
+		// A full block is only compressed once more input arrives, as the
+		// last block of the chunk must be compressed with flagChunkEnd.
+		if cs.blockLen == BlockSize {
+			w := wordsFromBlock(&cs.block)
+			cs.cv = first8(compress(&cs.cv, &w, cs.counter, BlockSize, cs.startFlag()))
+			cs.blocksCompressed++
+			cs.block = [BlockSize]byte{}
+			cs.blockLen = 0
+		}
+		n := copy(cs.block[cs.blockLen:], p)
+		cs.blockLen += n
+		p = p[n:]
+	}
+}
+
+func (cs *chunkState) output() output {
+	return output{
+		cv:       cs.cv,
+		block:    wordsFromBlock(&cs.block),
+		counter:  cs.counter,
+		blockLen: uint32(cs.blockLen),
+		flags:    cs.startFlag() | flagChunkEnd,
+	}
+}
+
+func parentOutput(left, right [8]uint32) output {
+	o := output{
+		cv:       iv,
+		blockLen: BlockSize,
+		flags:    flagParent,
+	}
+	copy(o.block[:8], left[:])
+	copy(o.block[8:], right[:])
+	return o
+}
+
+type digest struct {
+	chunk chunkState
+	// The chaining values of the completed subtrees, whose sizes are the
+	// powers of two in the binary representation of the number of completed
+	// chunks.
+	stack [][8]uint32
+}
+
+// New returns a new hash.Hash computing the BLAKE3 digest.
+func New() hash.Hash {
+	d := &digest{}
+	d.Reset()
+	return d
+}
+
+// Sum256 returns the BLAKE3 digest of the data.
+func Sum256(data []byte) [Size]byte {
+	d := &digest{}
+	d.Reset()
+	d.Write(data)
+	return d.sum()
+}
+
+func (d *digest) Reset() {
+	d.chunk = newChunkState(0)
+	d.stack = d.stack[:0]
+}
+
+func (d *digest) Size() int      { return Size }
+func (d *digest) BlockSize() int { return BlockSize }
+
+// addChunkCV merges the chaining value of a completed chunk into the stack of
+// subtrees, where total is the number of chunks completed so far.
+func (d *digest) addChunkCV(cv [8]uint32, total uint64) {
+	for total&1 == 0 {
+		o := parentOutput(d.stack[len(d.stack)-1], cv)
+		cv = o.chainingValue()
+		d.stack = d.stack[:len(d.stack)-1]
+		total >>= 1
+	}
+	d.stack = append(d.stack, cv)
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// As with blocks, a full chunk is only finished once more input
+		// arrives, as the last chunk may be the root.
+		if d.chunk.len() == chunkLen {
+			o := d.chunk.output()
+			total := d.chunk.counter + 1
+			d.addChunkCV(o.chainingValue(), total)
+			d.chunk = newChunkState(total)
+		}
+		want := chunkLen - d.chunk.len()
+		if want > len(p) {
+			want = len(p)
+		}
+		d.chunk.update(p[:want])
+		p = p[want:]
+	}
+	return n, nil
+}
+
+func (d *digest) sum() [Size]byte {
+	o := d.chunk.output()
+	for i := len(d.stack) - 1; i >= 0; i-- {
+		o = parentOutput(d.stack[i], o.chainingValue())
+	}
+	return o.rootBytes()
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	s := d.sum()
+	return append(b, s[:]...)
+}
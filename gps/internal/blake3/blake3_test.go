@@ -0,0 +1,76 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blake3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// testInput returns the input used by the official BLAKE3 test vectors: a
+// repeating sequence of the bytes 0 through 250.
+func testInput(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i % 251)
+	}
+	return b
+}
+
+func TestSum256(t *testing.T) {
+	for _, tc := range []struct {
+		in   []byte
+		want string
+	}{
+		{testInput(0), "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+		{testInput(1), "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+		// Exactly one chunk, and a second chunk of a single byte.
+		{testInput(1024), "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+		{testInput(1025), "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+		{[]byte("abc"), "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+	} {
+		got := Sum256(tc.in)
+		if hex.EncodeToString(got[:]) != tc.want {
+			t.Errorf("BLAKE3 of %d bytes:\n\t(GOT): %x\n\t(WNT): %s", len(tc.in), got, tc.want)
+		}
+	}
+}
+
+func TestWriteInPieces(t *testing.T) {
+	// Enough chunks to merge subtrees several levels deep, with a ragged end.
+	in := testInput(17*1024 + 100)
+	want := Sum256(in)
+
+	for _, size := range []int{1, 63, 64, 65, 1000, 1024, 4096} {
+		h := New()
+		for p := in; len(p) > 0; {
+			n := size
+			if n > len(p) {
+				n = len(p)
+			}
+			h.Write(p[:n])
+			p = p[n:]
+		}
+		if got := h.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Errorf("writing in pieces of %d bytes gave %x, want %x", size, got, want)
+		}
+	}
+
+	// Sum must not disturb the hash's state.
+	h := New()
+	h.Write(in[:5000])
+	h.Sum(nil)
+	h.Write(in[5000:])
+	if got := h.Sum(nil); !bytes.Equal(got, want[:]) {
+		t.Errorf("summing partway through changed the digest to %x, want %x", got, want)
+	}
+
+	h.Reset()
+	h.Write([]byte("abc"))
+	if got := hex.EncodeToString(h.Sum(nil)); got != "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85" {
+		t.Errorf("unexpected digest after Reset: %s", got)
+	}
+}
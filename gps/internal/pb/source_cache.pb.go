@@ -37,6 +37,10 @@ const (
 	Constraint_DefaultBranch Constraint_Type = 2
 	Constraint_Version       Constraint_Type = 3
 	Constraint_Semver        Constraint_Type = 4
+	Constraint_Union         Constraint_Type = 5
+	Constraint_Exclusion     Constraint_Type = 6
+	Constraint_Any           Constraint_Type = 7
+	Constraint_Channel       Constraint_Type = 8
 )
 
 var Constraint_Type_name = map[int32]string{
@@ -45,6 +49,10 @@ var Constraint_Type_name = map[int32]string{
 	2: "DefaultBranch",
 	3: "Version",
 	4: "Semver",
+	5: "Union",
+	6: "Exclusion",
+	7: "Any",
+	8: "Channel",
 }
 var Constraint_Type_value = map[string]int32{
 	"Revision":      0,
@@ -52,6 +60,10 @@ var Constraint_Type_value = map[string]int32{
 	"DefaultBranch": 2,
 	"Version":       3,
 	"Semver":        4,
+	"Union":         5,
+	"Exclusion":     6,
+	"Any":           7,
+	"Channel":       8,
 }
 
 func (x Constraint_Type) String() string {
@@ -63,6 +75,10 @@ func (Constraint_Type) EnumDescriptor() ([]byte, []int) { return fileDescriptor0
 type Constraint struct {
 	Type  Constraint_Type `protobuf:"varint,1,opt,name=type,enum=pb.Constraint_Type" json:"type,omitempty"`
 	Value string          `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	// members holds the members of a Union constraint, the base and then
+	// the excluded constraints of an Exclusion constraint, or the constraint
+	// narrowing a Channel constraint and then its channels.
+	Members []*Constraint `protobuf:"bytes,3,rep,name=members" json:"members,omitempty"`
 }
 
 func (m *Constraint) Reset()                    { *m = Constraint{} }
@@ -84,6 +100,13 @@ func (m *Constraint) GetValue() string {
 	return ""
 }
 
+func (m *Constraint) GetMembers() []*Constraint {
+	if m != nil {
+		return m.Members
+	}
+	return nil
+}
+
 // ProjectProperties is a serializable representation of gps.ProjectRoot and gps.ProjectProperties.
 type ProjectProperties struct {
 	Root       string      `protobuf:"bytes,1,opt,name=root" json:"root,omitempty"`
@@ -176,24 +199,27 @@ func init() {
 func init() { proto.RegisterFile("source_cache.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 294 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x91, 0x4f, 0x4f, 0xc2, 0x40,
-	0x14, 0xc4, 0x5d, 0x28, 0x08, 0x0f, 0x41, 0x78, 0x1a, 0xd3, 0x78, 0x6a, 0x7a, 0x91, 0x53, 0x0f,
-	0x78, 0xf1, 0xac, 0x1e, 0x39, 0x90, 0x6a, 0xbc, 0x9a, 0xed, 0xf2, 0x94, 0x0a, 0x76, 0x37, 0xaf,
-	0xdb, 0x26, 0x7c, 0x14, 0x3f, 0x84, 0xdf, 0xd1, 0x74, 0x59, 0xf1, 0x4f, 0xe2, 0xc1, 0x5b, 0xa7,
-	0xf3, 0xcb, 0xce, 0xcc, 0x2e, 0x60, 0xa9, 0x2b, 0x56, 0xf4, 0xa8, 0xa4, 0x5a, 0x51, 0x62, 0x58,
-	0x5b, 0x8d, 0x2d, 0x93, 0xc5, 0x6f, 0x02, 0xe0, 0x46, 0x17, 0xa5, 0x65, 0x99, 0x17, 0x16, 0x2f,
-	0x20, 0xb0, 0x5b, 0x43, 0xa1, 0x88, 0xc4, 0x74, 0x34, 0x3b, 0x49, 0x4c, 0x96, 0x7c, 0xb9, 0xc9,
-	0xfd, 0xd6, 0x50, 0xea, 0x00, 0x3c, 0x85, 0x4e, 0x2d, 0x37, 0x15, 0x85, 0xad, 0x48, 0x4c, 0xfb,
-	0xe9, 0x4e, 0xc4, 0x73, 0x08, 0x1a, 0x06, 0x8f, 0xa0, 0x97, 0x52, 0x9d, 0x97, 0xb9, 0x2e, 0xc6,
-	0x07, 0x08, 0xd0, 0xbd, 0x66, 0x59, 0xa8, 0xd5, 0x58, 0xe0, 0x04, 0x86, 0xb7, 0xf4, 0x24, 0xab,
-	0x8d, 0xf5, 0xbf, 0x5a, 0x38, 0x80, 0xc3, 0x07, 0x62, 0xc7, 0xb6, 0x1b, 0xf6, 0x8e, 0x5e, 0x6b,
-	0xe2, 0x71, 0x10, 0x6b, 0x98, 0x2c, 0x58, 0xbf, 0x90, 0xb2, 0x0b, 0xd6, 0x86, 0xd8, 0xe6, 0x54,
-	0x22, 0x42, 0xc0, 0x5a, 0x5b, 0xd7, 0xb0, 0x9f, 0xba, 0x6f, 0x3c, 0x83, 0xee, 0x6e, 0x9e, 0x6f,
-	0xe3, 0x15, 0x26, 0x00, 0x6a, 0xdf, 0x3e, 0x6c, 0x47, 0x62, 0x3a, 0x98, 0x8d, 0x7e, 0x6e, 0x4a,
-	0xbf, 0x11, 0xf1, 0xbb, 0x80, 0xe1, 0x5c, 0xab, 0x35, 0x2d, 0x7d, 0xee, 0xbf, 0xd2, 0xae, 0xe0,
-	0xb8, 0x2a, 0x8c, 0xcc, 0x99, 0x96, 0x7e, 0xcf, 0x1f, 0x91, 0xbf, 0x31, 0x3c, 0x87, 0x1e, 0xfb,
-	0xeb, 0x0a, 0x03, 0x77, 0xe6, 0x5e, 0x37, 0x9e, 0x91, 0x6a, 0x2d, 0x9f, 0xa9, 0x0c, 0x3b, 0x51,
-	0xbb, 0xf1, 0x3e, 0x75, 0xd6, 0x75, 0xef, 0x78, 0xf9, 0x11, 0x00, 0x00, 0xff, 0xff, 0xbd, 0x52,
-	0x77, 0xb3, 0xdd, 0x01, 0x00, 0x00,
+	// 339 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x95, 0x52, 0xbb, 0x4e, 0xc3, 0x40,
+	0x10, 0xc4, 0xb1, 0x1d, 0xc7, 0x1b, 0x12, 0x9c, 0x05, 0x21, 0x8b, 0x2a, 0x72, 0x43, 0x2a, 0x17,
+	0xa1, 0xa1, 0x85, 0x40, 0x47, 0x81, 0xcc, 0xa3, 0x45, 0xe7, 0xcb, 0x42, 0x4c, 0x9c, 0x3b, 0xeb,
+	0x7c, 0x8e, 0x88, 0xc4, 0x2f, 0xf1, 0x75, 0xfc, 0x00, 0xb6, 0xe3, 0x84, 0x87, 0xa0, 0xa0, 0xba,
+	0x9b, 0x9d, 0xd9, 0x59, 0xcd, 0xde, 0x01, 0xe6, 0xb2, 0x50, 0x9c, 0x1e, 0x38, 0xe3, 0x33, 0x0a,
+	0x33, 0x25, 0xb5, 0xc4, 0x56, 0x16, 0x07, 0xef, 0x06, 0xc0, 0x44, 0x8a, 0x5c, 0x2b, 0x96, 0x08,
+	0x8d, 0xc7, 0x60, 0xe9, 0x55, 0x46, 0xbe, 0x31, 0x34, 0x46, 0xfd, 0xf1, 0x7e, 0x98, 0xc5, 0xe1,
+	0x27, 0x1b, 0xde, 0x96, 0x54, 0x54, 0x0b, 0xf0, 0x00, 0xec, 0x25, 0x4b, 0x0b, 0xf2, 0x5b, 0xa5,
+	0xd2, 0x8d, 0xd6, 0x00, 0x47, 0xe0, 0x2c, 0x68, 0x11, 0x93, 0xca, 0x7d, 0x73, 0x68, 0x8e, 0xba,
+	0xe3, 0xfe, 0x77, 0x87, 0x68, 0x43, 0x07, 0xaf, 0x60, 0x55, 0x6e, 0xb8, 0x0b, 0x9d, 0x88, 0x96,
+	0x49, 0x9e, 0x48, 0xe1, 0xed, 0x20, 0x40, 0xfb, 0x5c, 0x31, 0xc1, 0x67, 0x9e, 0x81, 0x03, 0xe8,
+	0x5d, 0xd0, 0x23, 0x2b, 0x52, 0xdd, 0x94, 0x5a, 0xd8, 0x05, 0xe7, 0xbe, 0x6c, 0xae, 0xb4, 0x66,
+	0xa5, 0xbd, 0xa1, 0xc5, 0x92, 0x94, 0x67, 0xa1, 0x0b, 0xf6, 0x9d, 0xa8, 0xca, 0x36, 0xf6, 0xc0,
+	0xbd, 0x7c, 0xe1, 0x69, 0x51, 0xab, 0xda, 0xe8, 0x80, 0x79, 0x26, 0x56, 0x9e, 0x53, 0xf5, 0x4e,
+	0x66, 0x4c, 0x08, 0x4a, 0xbd, 0x4e, 0x20, 0x61, 0x70, 0xad, 0xe4, 0x33, 0x71, 0x5d, 0x1e, 0x19,
+	0x29, 0x9d, 0x50, 0x8e, 0x08, 0x96, 0x92, 0x52, 0xd7, 0xd9, 0xdd, 0xa8, 0xbe, 0xe3, 0x21, 0xb4,
+	0xd7, 0x8b, 0x6b, 0x72, 0x36, 0x08, 0x43, 0x00, 0xbe, 0x4d, 0x55, 0x66, 0x35, 0x7e, 0xc9, 0xfa,
+	0x45, 0x11, 0xbc, 0x19, 0xd0, 0xbb, 0x92, 0x7c, 0x4e, 0xd3, 0x66, 0xee, 0xbf, 0xa6, 0x9d, 0xc2,
+	0x5e, 0x21, 0x32, 0x96, 0x28, 0x9a, 0x36, 0xf9, 0xff, 0x18, 0xf9, 0x53, 0x86, 0x47, 0xd0, 0x51,
+	0xcd, 0x7a, 0x7d, 0xab, 0xf6, 0xdc, 0xe2, 0x8a, 0xcb, 0x18, 0x9f, 0xb3, 0x27, 0xca, 0x7d, 0xbb,
+	0x7c, 0xad, 0x92, 0xdb, 0xe0, 0xb8, 0x5d, 0xff, 0x90, 0x93, 0x0f, 0x00, 0xbe, 0xa6, 0x4b, 0x37,
+	0x02, 0x00, 0x00,
 }
@@ -0,0 +1,124 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "sync"
+
+// SolveListener receives events describing the progress of a solve, so that
+// tools can report it - with a progress bar, say, or a verbose log - without
+// parsing the output of the TraceLogger.
+//
+// Events are delivered one at a time, in the order in which they occur, but
+// not necessarily on the goroutine running the solve. HandleSolveEvent should
+// return promptly, as the solve waits for it.
+type SolveListener interface {
+	HandleSolveEvent(SolveEvent)
+}
+
+// SolveEvent is an event passed to a SolveListener. It is one of the event
+// types in this package: ProjectSelected, VersionAttempted, VersionRejected,
+// ProjectBacktracked, SourceSyncStarted or SourceSyncFinished.
+type SolveEvent interface {
+	isSolveEvent()
+}
+
+// ProjectSelected reports that the solver selected a version of a project, or
+// added packages to a project it had already selected.
+type ProjectSelected struct {
+	Ident   ProjectIdentifier
+	Version Version
+	// Packages lists the packages from the project required by the selection.
+	Packages []string
+	// PackagesOnly is set if the project was already selected, and the
+	// selection only added Packages to it.
+	PackagesOnly bool
+}
+
+// VersionAttempted reports that the solver is checking whether a version of a
+// project can be selected. It is followed by a ProjectSelected event if it
+// can, and a VersionRejected event if not.
+type VersionAttempted struct {
+	Ident   ProjectIdentifier
+	Version Version
+}
+
+// VersionRejected reports that a version of a project could not be selected.
+type VersionRejected struct {
+	Ident   ProjectIdentifier
+	Version Version
+	// Reason explains the rejection. It is typically a failure describing the
+	// constraint, or other requirement, that the version did not satisfy.
+	Reason error
+}
+
+// ProjectBacktracked reports that the solver undid the selection of a project,
+// or of some packages from it, in order to try an alternative.
+type ProjectBacktracked struct {
+	Ident   ProjectIdentifier
+	Version Version
+	// Packages lists the packages whose selection was undone.
+	Packages []string
+	// PackagesOnly is set if the project itself remains selected, and only
+	// Packages were removed from it.
+	PackagesOnly bool
+}
+
+// SourceSyncStarted reports that the solver asked the SourceManager for the
+// versions of a project's source, which may require fetching from upstream.
+// The syncs that the solver starts in the background, ahead of its need for a
+// project, are not reported.
+type SourceSyncStarted struct {
+	Ident ProjectIdentifier
+}
+
+// SourceSyncFinished reports that the SourceManager has done what was asked of
+// it in the matching SourceSyncStarted event.
+type SourceSyncFinished struct {
+	Ident ProjectIdentifier
+	// Err is the error encountered, if any.
+	Err error
+}
+
+func (ProjectSelected) isSolveEvent()    {}
+func (VersionAttempted) isSolveEvent()   {}
+func (VersionRejected) isSolveEvent()    {}
+func (ProjectBacktracked) isSolveEvent() {}
+func (SourceSyncStarted) isSolveEvent()  {}
+func (SourceSyncFinished) isSolveEvent() {}
+
+// eventSink delivers events to a SolveListener one at a time. A nil *eventSink
+// discards events.
+type eventSink struct {
+	mu sync.Mutex
+	l  SolveListener
+}
+
+func newEventSink(l SolveListener) *eventSink {
+	if l == nil {
+		return nil
+	}
+	return &eventSink{l: l}
+}
+
+// notifyBacktrack reports the unselection of awp, which undid only the
+// selection of its packages if pkgonly is set.
+func (s *solver) notifyBacktrack(awp atomWithPackages, pkgonly bool) {
+	s.events.notify(ProjectBacktracked{
+		Ident:        awp.a.id,
+		Version:      awp.a.v,
+		Packages:     awp.pl,
+		PackagesOnly: pkgonly,
+	})
+}
+
+func (es *eventSink) notify(ev SolveEvent) {
+	if es == nil {
+		return
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.l.HandleSolveEvent(ev)
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "testing"
+
+type recordingListener []SolveEvent
+
+func (rl *recordingListener) HandleSolveEvent(ev SolveEvent) {
+	*rl = append(*rl, ev)
+}
+
+func TestSolveListener(t *testing.T) {
+	// Whichever of a and b is selected first, the incompatible demands they
+	// make of c force a rejection.
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b *"),
+			mkDepspec("a 2.0.0", "c 2.0.0"),
+			mkDepspec("a 1.0.0", "c 1.0.0"),
+			mkDepspec("b 1.0.0", "c 1.0.0"),
+			mkDepspec("c 2.0.0"),
+			mkDepspec("c 1.0.0"),
+		},
+		r: mksolution(
+			"a 1.0.0",
+			"b 1.0.0",
+			"c 1.0.0",
+		),
+	}
+
+	var rl recordingListener
+	params := basicFixtureParams(fix)
+	params.Listener = &rl
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	fixtureSolveSimpleChecks(fix, soln, err, t)
+
+	selected := make(map[ProjectRoot]Version)
+	var attempted *VersionAttempted
+	var rejections, syncing int
+	for _, ev := range rl {
+		switch ev := ev.(type) {
+		case VersionAttempted:
+			if attempted != nil {
+				t.Errorf("attempt of %s@%s was neither selected nor rejected", attempted.Ident, attempted.Version)
+			}
+			attempted = &ev
+		case VersionRejected:
+			if attempted == nil || attempted.Ident != ev.Ident || attempted.Version != ev.Version {
+				t.Errorf("rejection of %s@%s was not preceded by its attempt", ev.Ident, ev.Version)
+			}
+			if ev.Reason == nil {
+				t.Errorf("rejection of %s@%s has no reason", ev.Ident, ev.Version)
+			}
+			attempted = nil
+			rejections++
+		case ProjectSelected:
+			if attempted != nil && (attempted.Ident != ev.Ident || attempted.Version != ev.Version) {
+				t.Errorf("selection of %s@%s does not match the attempt of %s@%s", ev.Ident, ev.Version, attempted.Ident, attempted.Version)
+			}
+			attempted = nil
+			if !ev.PackagesOnly {
+				selected[ev.Ident.ProjectRoot] = ev.Version
+			}
+		case ProjectBacktracked:
+			if !ev.PackagesOnly {
+				delete(selected, ev.Ident.ProjectRoot)
+			}
+		case SourceSyncStarted:
+			syncing++
+		case SourceSyncFinished:
+			if ev.Err != nil {
+				t.Errorf("unexpected error syncing %s: %v", ev.Ident, ev.Err)
+			}
+			syncing--
+		}
+	}
+
+	if rejections == 0 {
+		t.Error("expected at least one version to be rejected")
+	}
+	if syncing != 0 {
+		t.Errorf("expected every source sync that started to finish, %d did not", syncing)
+	}
+	if len(selected) != len(fix.r) {
+		t.Errorf("expected %d projects to remain selected, got %d: %v", len(fix.r), len(selected), selected)
+	}
+	for id, lp := range fix.r {
+		if got := selected[id.ProjectRoot]; got != lp.Version() {
+			t.Errorf("expected %s to be selected at %s, got %v", id, lp.Version(), got)
+		}
+	}
+}
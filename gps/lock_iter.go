@@ -0,0 +1,122 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// ProjectIterator steps through the projects of a Lock one at a time, so that
+// they can be processed without first gathering them all into a slice.
+//
+// Next must be called before each project, including the first; it returns
+// false once the projects are exhausted or an error occurs, at which point Err
+// reports the error, if any.
+type ProjectIterator interface {
+	Next() bool
+	Project() LockedProject
+	Err() error
+}
+
+// IterableLock is implemented by Locks that can supply their projects through
+// a ProjectIterator - for example, by reading them incrementally from disk -
+// more cheaply than through Projects. Solutions returned by the solver
+// implement it.
+type IterableLock interface {
+	Lock
+	IterProjects() ProjectIterator
+}
+
+// IterProjects returns a ProjectIterator over the projects in the Lock. If the
+// Lock is an IterableLock, its own iterator is used; otherwise, the iterator
+// walks the Lock's Projects.
+func IterProjects(l Lock) ProjectIterator {
+	if il, ok := l.(IterableLock); ok {
+		return il.IterProjects()
+	}
+	return &sliceProjectIterator{lps: l.Projects(), i: -1}
+}
+
+type sliceProjectIterator struct {
+	lps []LockedProject
+	i   int
+}
+
+func (it *sliceProjectIterator) Next() bool {
+	if it.i < len(it.lps) {
+		it.i++
+	}
+	return it.i < len(it.lps)
+}
+
+func (it *sliceProjectIterator) Project() LockedProject {
+	if it.i < 0 || it.i >= len(it.lps) {
+		return nil
+	}
+	return it.lps[it.i]
+}
+
+func (it *sliceProjectIterator) Err() error {
+	return nil
+}
+
+// jsonLockedProject is the JSON representation of a LockedProject written by
+// EncodeProjectsJSON.
+type jsonLockedProject struct {
+	Name     ProjectRoot `json:"name"`
+	Source   string      `json:"source,omitempty"`
+	Version  string      `json:"version,omitempty"`
+	Branch   string      `json:"branch,omitempty"`
+	Revision string      `json:"revision,omitempty"`
+	Packages []string    `json:"packages"`
+}
+
+// EncodeProjectsJSON writes the projects in the Lock to w as a JSON array of
+// objects with name, source, version, branch, revision and packages fields,
+// one project per line. Projects are encoded and written as they are
+// iterated, in the order IterProjects yields them, so that the whole
+// encoding is never held in memory.
+func EncodeProjectsJSON(w io.Writer, l Lock) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	it := IterProjects(l)
+	for first := true; it.Next(); first = false {
+		lp := it.Project()
+		id := lp.Ident()
+		jp := jsonLockedProject{
+			Name:     id.ProjectRoot,
+			Source:   id.Source,
+			Packages: lp.Packages(),
+		}
+		if jp.Packages == nil {
+			jp.Packages = []string{}
+		}
+		jp.Revision, jp.Branch, jp.Version = VersionComponentStrings(lp.Version())
+
+		b, err := json.Marshal(jp)
+		if err != nil {
+			return err
+		}
+		sep := ",\n"
+		if first {
+			sep = "\n"
+		}
+		if _, err = io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
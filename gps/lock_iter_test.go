@@ -0,0 +1,99 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIterProjects(t *testing.T) {
+	l := SimpleLock{
+		NewLockedProject(mkPI("a"), NewVersion("1.0.0").Pair("abc"), []string{"."}),
+		NewLockedProject(mkPI("b"), NewBranch("master").Pair("def"), []string{"b", "b/c"}),
+	}
+
+	var got []LockedProject
+	it := IterProjects(l)
+	for it.Next() {
+		got = append(got, it.Project())
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if !reflect.DeepEqual(got, l.Projects()) {
+		t.Errorf("unexpected projects:\n\t(GOT): %v\n\t(WNT): %v", got, l.Projects())
+	}
+	if it.Next() || it.Project() != nil {
+		t.Error("expected an exhausted iterator to stay exhausted")
+	}
+
+	soln := solution{p: l}
+	if _, ok := Solution(soln).(IterableLock); !ok {
+		t.Error("expected solutions to be IterableLocks")
+	}
+}
+
+// failingIterLock is an IterableLock whose iterator fails after its first
+// project.
+type failingIterLock struct {
+	SimpleLock
+}
+
+func (l failingIterLock) IterProjects() ProjectIterator {
+	return &failingIterator{lp: l.SimpleLock[0]}
+}
+
+type failingIterator struct {
+	lp    LockedProject
+	calls int
+}
+
+func (it *failingIterator) Next() bool             { it.calls++; return it.calls == 1 }
+func (it *failingIterator) Project() LockedProject { return it.lp }
+func (it *failingIterator) Err() error {
+	if it.calls > 1 {
+		return errors.New("read failed")
+	}
+	return nil
+}
+
+func TestEncodeProjectsJSON(t *testing.T) {
+	l := SimpleLock{
+		NewLockedProject(mkPI("a"), NewVersion("1.0.0").Pair("abc"), []string{"."}),
+		NewLockedProject(ProjectIdentifier{ProjectRoot: "b", Source: "github.com/fork/b"}, NewBranch("master").Pair("def"), nil),
+		NewLockedProject(mkPI("c"), Revision("123"), []string{"c"}),
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeProjectsJSON(&buf, l); err != nil {
+		t.Fatal(err)
+	}
+	want := `[
+{"name":"a","version":"1.0.0","revision":"abc","packages":["."]},
+{"name":"b","source":"github.com/fork/b","branch":"master","revision":"def","packages":[]},
+{"name":"c","revision":"123","packages":["c"]}
+]
+`
+	if buf.String() != want {
+		t.Errorf("unexpected encoding:\n\t(GOT): %s\n\t(WNT): %s", buf.String(), want)
+	}
+	var decoded []jsonLockedProject
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 3 {
+		t.Errorf("expected valid JSON with three projects, got %v, %v", decoded, err)
+	}
+
+	buf.Reset()
+	if err := EncodeProjectsJSON(&buf, SimpleLock{}); err != nil || buf.String() != "[\n]\n" {
+		t.Errorf("unexpected encoding of an empty lock: %q, %v", buf.String(), err)
+	}
+
+	if err := EncodeProjectsJSON(&buf, failingIterLock{l}); err == nil || err.Error() != "read failed" {
+		t.Errorf("expected the iterator's error to be returned, got %v", err)
+	}
+}
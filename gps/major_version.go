@@ -0,0 +1,174 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// MajorVersionPolicy determines whether the solver may select a version of a
+// project with a major version of 2 or more, when the project's import path
+// does not carry a major version - as with a /v2 suffix, or gopkg.in's .v2 -
+// and the constraint on the project also admits earlier major versions.
+//
+// Such a version is likely to break compatibility with the earlier major
+// versions that the constraint's author may have had in mind, much as with
+// the +incompatible versions of Go modules.
+type MajorVersionPolicy uint8
+
+const (
+	// AllowMajorVersionMismatches admits such versions like any other. This
+	// is the default.
+	AllowMajorVersionMismatches MajorVersionPolicy = iota
+
+	// WarnMajorVersionMismatches admits such versions, but reports any that
+	// are selected in Solution.MajorVersionWarnings.
+	WarnMajorVersionMismatches
+
+	// RejectMajorVersionMismatches excludes such versions from consideration,
+	// as though they did not satisfy the constraint. They may still be
+	// selected under a constraint that admits only their major version, such
+	// as ^2.0.0, or under a branch or revision.
+	RejectMajorVersionMismatches
+)
+
+func (p MajorVersionPolicy) String() string {
+	switch p {
+	case AllowMajorVersionMismatches:
+		return "allow"
+	case WarnMajorVersionMismatches:
+		return "warn"
+	case RejectMajorVersionMismatches:
+		return "reject"
+	}
+	return fmt.Sprintf("MajorVersionPolicy(%d)", uint8(p))
+}
+
+// ParseMajorVersionPolicy parses the string form of a MajorVersionPolicy, as
+// produced by its String method.
+func ParseMajorVersionPolicy(s string) (MajorVersionPolicy, error) {
+	switch s {
+	case "allow":
+		return AllowMajorVersionMismatches, nil
+	case "warn":
+		return WarnMajorVersionMismatches, nil
+	case "reject":
+		return RejectMajorVersionMismatches, nil
+	}
+	return 0, errors.Errorf("unknown major version policy %q", s)
+}
+
+// MajorVersionWarning describes the selection of a version whose major version
+// is not reflected in its project's import path, under a constraint that also
+// admits earlier major versions.
+type MajorVersionWarning struct {
+	// Version is the selected version.
+	Version Version
+	// Constraint is the aggregate constraint on the project, under which the
+	// version was selected.
+	Constraint Constraint
+}
+
+func (w MajorVersionWarning) String() string {
+	return fmt.Sprintf("%s was selected under %q, which also admits earlier major versions", w.Version, w.Constraint)
+}
+
+// pathMajorRe matches import paths that carry a major version.
+var pathMajorRe = regexp.MustCompile(`[/.]v[0-9]+$`)
+
+// isMajorVersionMismatch reports whether v has a major version of 2 or more
+// that the project's import path does not carry, while c also admits earlier
+// major versions.
+func isMajorVersionMismatch(pr ProjectRoot, v Version, c Constraint) bool {
+	sv, ok := semverOf(v)
+	if !ok || sv.Major() < 2 || pathMajorRe.MatchString(string(pr)) {
+		return false
+	}
+
+	earlier, err := NewSemverConstraint(fmt.Sprintf("<%d.0.0", sv.Major()))
+	if err != nil {
+		panic(fmt.Sprintf("canary - invalid earlier major constraint: %s", err))
+	}
+	return c.MatchesAny(earlier)
+}
+
+// checkMajorVersion ensures that, if the MajorVersionPolicy rejects them, the
+// atom's version is not a major version mismatch under the current constraint
+// on its project.
+//
+// Only the atom itself need be checked: the constraints of projects selected
+// later only narrow the constraint, which can never make a selected version
+// into a mismatch.
+func (s *solver) checkMajorVersion(pa atom) error {
+	if s.majpol != RejectMajorVersionMismatches {
+		return nil
+	}
+
+	c := s.sel.getConstraint(pa.id)
+	if !isMajorVersionMismatch(pa.id.ProjectRoot, pa.v, c) {
+		return nil
+	}
+	return &majorVersionFailure{
+		goal: pa,
+		c:    c,
+	}
+}
+
+// narrowToImpliedMajor intersects the constraint on a project with the
+// constraint implied by its root import path, if it has one; see
+// ImpliedConstraint. Only semver ranges and versions are narrowed: a branch or
+// revision names its versions exactly, and the open constraint is left for
+// the source to narrow, as gopkg.in's branches may be all it has.
+func narrowToImpliedMajor(wc workingConstraint) workingConstraint {
+	ic, ok := ImpliedConstraint(wc.Ident.ProjectRoot)
+	if !ok {
+		return wc
+	}
+
+	switch tc := wc.Constraint.(type) {
+	case semverConstraint:
+	case Version:
+		if _, ok := semverOf(tc); !ok {
+			return wc
+		}
+	default:
+		return wc
+	}
+
+	if nc := wc.Constraint.Intersect(ic); !nc.identical(wc.Constraint) {
+		wc.unnarrowed = wc.Constraint
+		wc.Constraint = nc
+	}
+	return wc
+}
+
+// majorVersionWarnings returns the warnings for the selected projects whose
+// versions are major version mismatches, if the MajorVersionPolicy calls for
+// them.
+func (s *solver) majorVersionWarnings(lps []LockedProject, acs map[ProjectRoot]AggregateConstraint) map[ProjectRoot]MajorVersionWarning {
+	if s.majpol != WarnMajorVersionMismatches {
+		return nil
+	}
+
+	var warnings map[ProjectRoot]MajorVersionWarning
+	for _, lp := range lps {
+		pr := lp.Ident().ProjectRoot
+		c := acs[pr].Constraint
+		if c == nil || !isMajorVersionMismatch(pr, lp.Version(), c) {
+			continue
+		}
+		if warnings == nil {
+			warnings = make(map[ProjectRoot]MajorVersionWarning)
+		}
+		warnings[pr] = MajorVersionWarning{
+			Version:    lp.Version(),
+			Constraint: c,
+		}
+	}
+	return warnings
+}
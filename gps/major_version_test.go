@@ -0,0 +1,121 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "testing"
+
+func TestIsMajorVersionMismatch(t *testing.T) {
+	for _, test := range []struct {
+		pr   ProjectRoot
+		v    Version
+		c    string
+		want bool
+	}{
+		{"github.com/foo/bar", NewVersion("2.1.0"), ">=1.0.0", true},
+		{"github.com/foo/bar", NewVersion("2.1.0").Pair("abc123"), ">=1.0.0", true},
+		{"github.com/foo/bar", NewVersion("2.1.0"), "^2.0.0", false},
+		{"github.com/foo/bar", NewVersion("3.0.0"), ">=2.0.0", true},
+		{"github.com/foo/bar", NewVersion("1.4.0"), ">=1.0.0", false},
+		{"github.com/foo/bar/v2", NewVersion("2.1.0"), ">=1.0.0", false},
+		{"gopkg.in/bar.v2", NewVersion("2.1.0"), ">=1.0.0", false},
+		{"github.com/foo/bar", NewBranch("master"), ">=1.0.0", false},
+	} {
+		c := testSemverConstraint(t, test.c)
+		if got := isMajorVersionMismatch(test.pr, test.v, c); got != test.want {
+			t.Errorf("expected %s at %s under %s to be a mismatch to be %v", test.pr, test.v, c, test.want)
+		}
+	}
+	if !isMajorVersionMismatch("github.com/foo/bar", NewVersion("2.1.0"), any) {
+		t.Error("expected the any constraint to admit a mismatch")
+	}
+
+	for _, p := range []MajorVersionPolicy{AllowMajorVersionMismatches, WarnMajorVersionMismatches, RejectMajorVersionMismatches} {
+		if got, err := ParseMajorVersionPolicy(p.String()); err != nil || got != p {
+			t.Errorf("expected %q to parse back to itself, got %v (%v)", p, got, err)
+		}
+	}
+	if _, err := ParseMajorVersionPolicy("sometimes"); err == nil {
+		t.Error("expected an error parsing an unknown policy")
+	}
+}
+
+func TestMajorVersionPolicy(t *testing.T) {
+	ds := []depspec{
+		mkDepspec("root 0.0.0", "a >=1.0.0", "b.v2 >=1.0.0"),
+		mkDepspec("a 1.0.0"),
+		mkDepspec("a 2.0.0"),
+		mkDepspec("b.v2 2.0.0"),
+	}
+
+	for _, test := range []struct {
+		pol      MajorVersionPolicy
+		r        map[ProjectIdentifier]LockedProject
+		warnings int
+	}{
+		{AllowMajorVersionMismatches, mksolution("a 2.0.0", "b.v2 2.0.0"), 0},
+		{WarnMajorVersionMismatches, mksolution("a 2.0.0", "b.v2 2.0.0"), 1},
+		{RejectMajorVersionMismatches, mksolution("a 1.0.0", "b.v2 2.0.0"), 0},
+	} {
+		t.Run(test.pol.String(), func(t *testing.T) {
+			fix := basicFixture{ds: ds, r: test.r}
+			params := basicFixtureParams(fix)
+			params.MajorVersions = test.pol
+
+			soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+			fixtureSolveSimpleChecks(fix, soln, err, t)
+			if err != nil {
+				return
+			}
+
+			warnings := soln.MajorVersionWarnings()
+			if len(warnings) != test.warnings {
+				t.Fatalf("expected %d major version warnings, got %v", test.warnings, warnings)
+			}
+			if w, has := warnings["a"]; test.warnings > 0 && (!has || w.Version.String() != "2.0.0") {
+				t.Errorf("expected a warning for a at 2.0.0, got %v", warnings)
+			}
+		})
+	}
+
+	// Nothing but the mismatch is acceptable, so rejecting it fails the solve.
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a >=1.0.0"),
+			mkDepspec("a 2.0.0"),
+		},
+	}
+	params := basicFixtureParams(fix)
+	params.MajorVersions = RejectMajorVersionMismatches
+	if _, err := fixSolve(params, newdepspecSM(fix.ds, nil), t); err == nil {
+		t.Error("expected the solve to fail when the only acceptable version is rejected")
+	}
+}
+
+func TestImpliedMajorSolve(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "gopkg.in/foo.v1 >=1.0.0", "a 1.0.0"),
+			mkDepspec("gopkg.in/foo.v1 1.0.0"),
+			mkDepspec("gopkg.in/foo.v1 2.0.0"),
+			mkDepspec("a 1.0.0", "example.com/bar/v2 *"),
+			mkDepspec("example.com/bar/v2 2.0.0"),
+			mkDepspec("example.com/bar/v2 3.0.0"),
+		},
+		r: mksolution("gopkg.in/foo.v1 1.0.0", "a 1.0.0", "example.com/bar/v2 2.0.0"),
+	}
+	soln, err := fixSolve(basicFixtureParams(fix), newdepspecSM(fix.ds, nil), t)
+	fixtureSolveSimpleChecks(fix, soln, err, t)
+
+	// A constraint outside of the implied major version can never be met. The
+	// first solve's background syncs may still be reading its depspecs, so
+	// the second gets its own.
+	ds := append([]depspec{mkDepspec("root 0.0.0", "gopkg.in/foo.v1 ^2.0.0")}, fix.ds[1:]...)
+	fix = basicFixture{ds: ds}
+	if _, err = fixSolve(basicFixtureParams(fix), newdepspecSM(fix.ds, nil), t); err == nil {
+		t.Error("expected a constraint to a major version other than that of the import path to fail")
+	} else {
+		t.Log(err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"sort"
 	"sync"
@@ -340,6 +341,9 @@ func TestMgrMethodsFailWithBadPath(t *testing.T) {
 	if _, err = sm.RevisionPresentIn(bad, Revision("")); err == nil {
 		t.Error("RevisionPresentIn() did not error on bad input")
 	}
+	if _, err = sm.VersionsForRevision(bad, Revision("")); err == nil {
+		t.Error("VersionsForRevision() did not error on bad input")
+	}
 	if _, err = sm.ListPackages(bad, nil); err == nil {
 		t.Error("ListPackages() did not error on bad input")
 	}
@@ -837,6 +841,13 @@ func TestErrAfterRelease(t *testing.T) {
 		t.Errorf("RevisionPresentIn errored after Release(), but with unexpected error: %T %s", err, err.Error())
 	}
 
+	_, err = sm.VersionsForRevision(id, "")
+	if err == nil {
+		t.Errorf("VersionsForRevision did not error after calling Release()")
+	} else if err != ErrSourceManagerIsReleased {
+		t.Errorf("VersionsForRevision errored after Release(), but with unexpected error: %T %s", err, err.Error())
+	}
+
 	_, err = sm.ListPackages(id, nil)
 	if err == nil {
 		t.Errorf("ListPackages did not error after calling Release()")
@@ -866,6 +877,32 @@ func TestErrAfterRelease(t *testing.T) {
 	}
 }
 
+func TestVersionsForRevision(t *testing.T) {
+	rev := Revision("c8c2b3c0d1b5fa45e1e5fea7d1fbc5a8d3d07e43")
+	pvl := []PairedVersion{
+		NewVersion("v1.0.0").Pair("e3c8e1e5b5a2836ba0b8bd5a7c0e4f8b1bdc7b20"),
+		NewBranch("master").Pair(rev),
+		NewVersion("v1.1.0").Pair(rev),
+		NewVersion("latest").Pair(rev),
+		NewVersion("v1.1.0-rc.1").Pair(rev),
+	}
+
+	got := versionsForRevision(pvl, rev)
+	want := []UnpairedVersion{
+		NewVersion("v1.1.0"),
+		NewVersion("v1.1.0-rc.1"),
+		NewBranch("master"),
+		NewVersion("latest"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected versions for %s:\n\t(GOT): %v\n\t(WNT): %v", rev, got, want)
+	}
+
+	if got := versionsForRevision(pvl, "nonexistent"); len(got) != 0 {
+		t.Errorf("expected no versions for an unknown revision, got %v", got)
+	}
+}
+
 func TestSignalHandling(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping slow test in short mode")
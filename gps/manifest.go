@@ -4,7 +4,11 @@
 
 package gps
 
-import "github.com/golang/dep/gps/pkgtree"
+import (
+	"fmt"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
 
 // Manifest represents manifest-type data for a project at a particular version.
 // The constraints expressed in a manifest determine the set of versions that
@@ -61,27 +65,86 @@ type RootManifest interface {
 	RequiredPackages() map[string]bool
 }
 
+// ExternalManifest is an optional extension to RootManifest for root projects
+// that import packages that are satisfied outside of dependency management -
+// for example, by code generated at build time, or provided by the platform.
+type ExternalManifest interface {
+	RootManifest
+
+	// ExternalPackages returns a pkgtree.IgnoredRuleset of the import paths,
+	// or import path patterns, that are satisfied externally. The solver does
+	// not attempt to deduce or fetch a source for such packages, nor does it
+	// consider their imports, but the root project's imports of them are
+	// reported by Solution.ExternalImports.
+	//
+	// It is an error to include a package in both the external and required
+	// sets.
+	ExternalPackages() *pkgtree.IgnoredRuleset
+}
+
+// GoVersionManifest is an optional extension to Manifest for projects that can
+// only be built with a minimum version of the Go toolchain.
+type GoVersionManifest interface {
+	Manifest
+
+	// MinimumGoVersion returns the oldest version of the Go toolchain that
+	// can build the project, as a major.minor[.patch] version such as "1.10",
+	// or the empty string if the project makes no such requirement.
+	//
+	// When solving with SolveParameters.GoVersion set, versions of projects
+	// that require a newer toolchain than it are not selected.
+	MinimumGoVersion() string
+}
+
+// IgnoredAndExternalPackages returns a pkgtree.IgnoredRuleset combining the
+// packages ignored by the manifest with those it declares to be satisfied
+// externally, if it is an ExternalManifest. This is the set of packages that
+// the solver disregards when computing the root project's imports.
+func IgnoredAndExternalPackages(m RootManifest) *pkgtree.IgnoredRuleset {
+	ir := m.IgnoredPackages()
+	em, ok := m.(ExternalManifest)
+	if !ok {
+		return ir
+	}
+
+	ext := em.ExternalPackages()
+	if ext.Len() == 0 {
+		return ir
+	}
+	return pkgtree.NewIgnoredRuleset(append(ir.ToSlice(), ext.ToSlice()...))
+}
+
 // SimpleManifest is a helper for tools to enumerate manifest data. It's
 // generally intended for ephemeral manifests, such as those Analyzers create on
 // the fly for projects with no manifest metadata, or metadata through a foreign
 // tool's idioms.
 type SimpleManifest struct {
 	Deps ProjectConstraints
+	// GoVersion is the minimum version of the Go toolchain required by the
+	// project, if any.
+	GoVersion string
 }
 
-var _ Manifest = SimpleManifest{}
+var _ GoVersionManifest = SimpleManifest{}
 
 // DependencyConstraints returns the project's dependencies.
 func (m SimpleManifest) DependencyConstraints() ProjectConstraints {
 	return m.Deps
 }
 
+// MinimumGoVersion returns the minimum version of the Go toolchain required by
+// the project.
+func (m SimpleManifest) MinimumGoVersion() string {
+	return m.GoVersion
+}
+
 // simpleRootManifest exists so that we have a safe value to swap into solver
 // params when a nil Manifest is provided.
 type simpleRootManifest struct {
 	c, ovr ProjectConstraints
 	ig     *pkgtree.IgnoredRuleset
 	req    map[string]bool
+	gov    string
 }
 
 func (m simpleRootManifest) DependencyConstraints() ProjectConstraints {
@@ -96,6 +159,9 @@ func (m simpleRootManifest) IgnoredPackages() *pkgtree.IgnoredRuleset {
 func (m simpleRootManifest) RequiredPackages() map[string]bool {
 	return m.req
 }
+func (m simpleRootManifest) MinimumGoVersion() string {
+	return m.gov
+}
 
 // prepManifest ensures a manifest is prepared and safe for use by the solver.
 // This is mostly about ensuring that no outside routine can modify the manifest
@@ -113,6 +179,9 @@ func prepManifest(m Manifest) SimpleManifest {
 	rm := SimpleManifest{
 		Deps: make(ProjectConstraints, len(deps)),
 	}
+	if gm, ok := m.(GoVersionManifest); ok {
+		rm.GoVersion = gm.MinimumGoVersion()
+	}
 
 	for k, d := range deps {
 		// A zero-value ProjectProperties is equivalent to one with an
@@ -131,3 +200,47 @@ func prepManifest(m Manifest) SimpleManifest {
 
 	return rm
 }
+
+// MalformedManifestError indicates that a ProjectAnalyzer found a manifest for
+// a project, but was unable to make sense of it. ProjectAnalyzers should return
+// this error (perhaps wrapped) from DeriveManifestAndLock so that the solver
+// can apply its ManifestErrorPolicy, rather than treating the failure as an
+// ordinary error.
+type MalformedManifestError struct {
+	Err error
+}
+
+func (e MalformedManifestError) Error() string {
+	return fmt.Sprintf("malformed manifest: %s", e.Err)
+}
+
+// ManifestErrorPolicy determines how the solver responds when the manifest
+// embedded in a candidate version of a dependency is malformed.
+type ManifestErrorPolicy uint8
+
+const (
+	// QuarantineMalformedManifests excludes any version with a malformed
+	// manifest from consideration, as though it did not satisfy constraints.
+	// This is the default.
+	QuarantineMalformedManifests ManifestErrorPolicy = iota
+
+	// IgnoreMalformedManifests treats a version with a malformed manifest as
+	// though it had no manifest at all, and emits a warning in the trace.
+	IgnoreMalformedManifests
+
+	// FailOnMalformedManifests terminates solving as soon as a malformed
+	// manifest is encountered.
+	FailOnMalformedManifests
+)
+
+func (p ManifestErrorPolicy) String() string {
+	switch p {
+	case QuarantineMalformedManifests:
+		return "quarantine"
+	case IgnoreMalformedManifests:
+		return "ignore"
+	case FailOnMalformedManifests:
+		return "fail"
+	}
+	return fmt.Sprintf("ManifestErrorPolicy(%d)", uint8(p))
+}
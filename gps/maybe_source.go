@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"net/url"
 	"os"
-	"path/filepath"
 
 	"github.com/Masterminds/vcs"
 )
@@ -22,8 +21,9 @@ import (
 // * Allows control over when deduction logic triggers network activity
 // * Makes it easy to attempt multiple URLs for a given import path
 type maybeSource interface {
-	// try tries to set up a source.
-	try(ctx context.Context, cachedir string) (source, error)
+	// try tries to set up a source, kept in cd, that works under the
+	// settings.
+	try(ctx context.Context, cd cacheDir, ss sourceSettings) (source, error)
 	URL() *url.URL
 	fmt.Stringer
 }
@@ -38,18 +38,13 @@ func (mbs maybeSources) possibleURLs() []*url.URL {
 	return urlslice
 }
 
-// sourceCachePath returns a url-sanitized source cache dir path.
-func sourceCachePath(cacheDir, sourceURL string) string {
-	return filepath.Join(cacheDir, "sources", sanitizer.Replace(sourceURL))
-}
-
 type maybeGitSource struct {
 	url *url.URL
 }
 
-func (m maybeGitSource) try(ctx context.Context, cachedir string) (source, error) {
+func (m maybeGitSource) try(ctx context.Context, cd cacheDir, ss sourceSettings) (source, error) {
 	ustr := m.url.String()
-	path := sourceCachePath(cachedir, ustr)
+	path := cd.sourcePath(ustr)
 
 	r, err := vcs.NewGitRepo(ustr, path)
 	if err != nil {
@@ -62,7 +57,8 @@ func (m maybeGitSource) try(ctx context.Context, cachedir string) (source, error
 
 	return &gitSource{
 		baseVCSSource: baseVCSSource{
-			repo: &gitRepo{r},
+			repo:     &gitRepo{GitRepo: r, env: ss.vcs, plumbing: ss.gitPlumbing()},
+			settings: ss,
 		},
 	}, nil
 }
@@ -89,12 +85,12 @@ type maybeGopkginSource struct {
 	unstable bool
 }
 
-func (m maybeGopkginSource) try(ctx context.Context, cachedir string) (source, error) {
+func (m maybeGopkginSource) try(ctx context.Context, cd cacheDir, ss sourceSettings) (source, error) {
 	// We don't actually need a fully consistent transform into the on-disk path
 	// - just something that's unique to the particular gopkg.in domain context.
 	// So, it's OK to just dumb-join the scheme with the path.
 	aliasURL := m.url.Scheme + "://" + m.opath
-	path := sourceCachePath(cachedir, aliasURL)
+	path := cd.sourcePath(aliasURL)
 	ustr := m.url.String()
 
 	r, err := vcs.NewGitRepo(ustr, path)
@@ -109,7 +105,8 @@ func (m maybeGopkginSource) try(ctx context.Context, cachedir string) (source, e
 	return &gopkginSource{
 		gitSource: gitSource{
 			baseVCSSource: baseVCSSource{
-				repo: &gitRepo{r},
+				repo:     &gitRepo{GitRepo: r, env: ss.vcs, plumbing: ss.gitPlumbing()},
+				settings: ss,
 			},
 		},
 		major:    m.major,
@@ -133,9 +130,9 @@ type maybeBzrSource struct {
 	url *url.URL
 }
 
-func (m maybeBzrSource) try(ctx context.Context, cachedir string) (source, error) {
+func (m maybeBzrSource) try(ctx context.Context, cd cacheDir, ss sourceSettings) (source, error) {
 	ustr := m.url.String()
-	path := sourceCachePath(cachedir, ustr)
+	path := cd.sourcePath(ustr)
 
 	r, err := vcs.NewBzrRepo(ustr, path)
 	if err != nil {
@@ -148,7 +145,8 @@ func (m maybeBzrSource) try(ctx context.Context, cachedir string) (source, error
 
 	return &bzrSource{
 		baseVCSSource: baseVCSSource{
-			repo: &bzrRepo{r},
+			repo:     &bzrRepo{BzrRepo: r, env: ss.vcs},
+			settings: ss,
 		},
 	}, nil
 }
@@ -165,9 +163,9 @@ type maybeHgSource struct {
 	url *url.URL
 }
 
-func (m maybeHgSource) try(ctx context.Context, cachedir string) (source, error) {
+func (m maybeHgSource) try(ctx context.Context, cd cacheDir, ss sourceSettings) (source, error) {
 	ustr := m.url.String()
-	path := sourceCachePath(cachedir, ustr)
+	path := cd.sourcePath(ustr)
 
 	r, err := vcs.NewHgRepo(ustr, path)
 	if err != nil {
@@ -180,7 +178,8 @@ func (m maybeHgSource) try(ctx context.Context, cachedir string) (source, error)
 
 	return &hgSource{
 		baseVCSSource: baseVCSSource{
-			repo: &hgRepo{r},
+			repo:     &hgRepo{HgRepo: r, env: ss.vcs},
+			settings: ss,
 		},
 	}, nil
 }
@@ -193,6 +192,43 @@ func (m maybeHgSource) String() string {
 	return fmt.Sprintf("%T: %s", m, ufmt(m.url))
 }
 
+type maybeSvnSource struct {
+	url *url.URL
+}
+
+func (m maybeSvnSource) try(ctx context.Context, cd cacheDir, ss sourceSettings) (source, error) {
+	ustr := m.url.String()
+	path := cd.sourcePath(ustr)
+
+	// The working copy is switched between lines of development as versions
+	// are checked out, after which it no longer matches ustr, so it is
+	// replaced here. It holds nothing expensive to recreate, as svn keeps no
+	// history locally.
+	r, err := vcs.NewSvnRepo(ustr, path)
+	if err != nil {
+		os.RemoveAll(path)
+		r, err = vcs.NewSvnRepo(ustr, path)
+		if err != nil {
+			return nil, unwrapVcsErr(err)
+		}
+	}
+
+	return &svnSource{
+		baseVCSSource: baseVCSSource{
+			repo:     &svnRepo{SvnRepo: r, env: ss.vcs},
+			settings: ss,
+		},
+	}, nil
+}
+
+func (m maybeSvnSource) URL() *url.URL {
+	return m.url
+}
+
+func (m maybeSvnSource) String() string {
+	return fmt.Sprintf("%T: %s", m, ufmt(m.url))
+}
+
 // borrow from stdlib
 // more useful string for debugging than fmt's struct printer
 func ufmt(u *url.URL) string {
@@ -37,7 +37,7 @@ func TestMaybeGitSource_try(t *testing.T) {
 		t.Fatal(err)
 	}
 	var ms maybeSource = maybeGitSource{url: url}
-	_, err = ms.try(context.Background(), tempDir)
+	_, err = ms.try(context.Background(), cacheDir{root: tempDir}, sourceSettings{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -89,7 +89,7 @@ func TestMaybeGitSource_try_recovery(t *testing.T) {
 		t.Fatal(err)
 	}
 	var ms maybeSource = maybeGitSource{url: url}
-	_, err = ms.try(context.Background(), tempDir)
+	_, err = ms.try(context.Background(), cacheDir{root: tempDir}, sourceSettings{})
 	if err != nil {
 		t.Fatal(err)
 	}
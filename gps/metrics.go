@@ -13,19 +13,44 @@ import (
 	"time"
 )
 
+// sourceSegmentPrefix begins the names of the segments of the solve in which
+// the solver waits on the SourceManager.
+const sourceSegmentPrefix = "b-"
+
 type metrics struct {
 	stack []string
 	times map[string]time.Duration
 	last  time.Time
+	start time.Time
+
+	// The project that each segment on the stack concerns, if any.
+	pstack []ProjectRoot
+
+	// Counts of the solver's work, overall and by project.
+	attempted, backtracks, checks int
+	projects                      map[ProjectRoot]*ProjectMetrics
+
+	// The lookups in the SourceManager's caches, if it counts them.
+	cache *cacheMeter
+
+	// The prefetch of the root lock, if one was made.
+	prefetch *lockPrefetch
+
+	// The bytes fetched for each project, if the SourceManager counts them.
+	xfer *transferMeter
 }
 
 func newMetrics() *metrics {
+	now := time.Now()
 	return &metrics{
 		stack: []string{"other"},
 		times: map[string]time.Duration{
 			"other": 0,
 		},
-		last: time.Now(),
+		last:     now,
+		start:    now,
+		pstack:   []ProjectRoot{""},
+		projects: make(map[ProjectRoot]*ProjectMetrics),
 	}
 }
 
@@ -34,14 +59,37 @@ func (m *metrics) push(name string) {
 	m.times[cn] = m.times[cn] + time.Since(m.last)
 
 	m.stack = append(m.stack, name)
+	m.pstack = append(m.pstack, "")
 	m.last = time.Now()
 }
 
+// pushSource begins a segment in which the solver waits on the SourceManager
+// for the project. Its name must begin with sourceSegmentPrefix.
+func (m *metrics) pushSource(name string, id ProjectIdentifier) {
+	m.push(name)
+	m.pstack[len(m.pstack)-1] = id.ProjectRoot
+	m.project(id.ProjectRoot).SourceCalls++
+}
+
+// watch begins accounting for the bytes fetched for the project, and the
+// lookups of data about it, if it is not yet being watched. It must be called
+// before the solve first asks the SourceManager for anything about the
+// project.
+func (m *metrics) watch(id ProjectIdentifier) {
+	m.xfer.watch(id)
+	m.cache.watch(id)
+}
+
 func (m *metrics) pop() {
 	on := m.stack[len(m.stack)-1]
-	m.times[on] = m.times[on] + time.Since(m.last)
+	d := time.Since(m.last)
+	m.times[on] = m.times[on] + d
+	if pr := m.pstack[len(m.pstack)-1]; pr != "" {
+		m.project(pr).SourceTime += d
+	}
 
 	m.stack = m.stack[:len(m.stack)-1]
+	m.pstack = m.pstack[:len(m.pstack)-1]
 	m.last = time.Now()
 }
 
@@ -70,6 +118,20 @@ func (m *metrics) dump(l *log.Logger) {
 
 	l.Println("\nSolver wall times by segment:")
 	l.Println((&buf).String())
+
+	l.Printf("Versions attempted: %d, backtracks: %d, constraint checks: %d\n", m.attempted, m.backtracks, m.checks)
+
+	if m.prefetch != nil {
+		total, ready, saved := m.prefetch.stats()
+		l.Printf("Lock prefetch: %d of %d projects ready when first needed, saving an estimated %v\n", ready, total, saved)
+	}
+
+	if m.xfer != nil {
+		buf.Reset()
+		m.xfer.dump(&buf)
+		l.Println("\nBytes fetched by project:")
+		l.Println((&buf).String())
+	}
 }
 
 type ndpair struct {
@@ -0,0 +1,86 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ExportNormalization describes how the metadata of files in an exported tree
+// should be normalized, so that trees exported on different machines - with
+// different umasks, clocks, and VCS checkout behavior - are indistinguishable
+// from one another.
+//
+// The zero value performs no normalization.
+type ExportNormalization struct {
+	// Modes indicates that permission bits should be normalized. Directories,
+	// and files that are executable by anyone, are set to 0755; all other
+	// files are set to 0644.
+	Modes bool
+	// ModTime, if non-zero, is applied as the access and modification time of
+	// every file and directory in the tree.
+	ModTime time.Time
+}
+
+// isZero reports whether the normalization is a no-op.
+func (n ExportNormalization) isZero() bool {
+	return !n.Modes && n.ModTime.IsZero()
+}
+
+// NormalizeTree applies the provided normalization to every file and directory
+// beneath, and including, the root directory. Symlinks are neither followed nor
+// modified.
+func NormalizeTree(root string, n ExportNormalization) error {
+	if n.isZero() {
+		return nil
+	}
+
+	// Walk in full before modifying anything, as restricting the mode of a
+	// directory before visiting it could prevent its children from being read.
+	type entry struct {
+		path string
+		mode os.FileMode
+	}
+	var entries []entry
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			entries = append(entries, entry{path: path, mode: info.Mode()})
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to walk %s", root)
+	}
+
+	// Work in reverse, so that children are handled before their parents.
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if n.Modes {
+			perm := os.FileMode(0644)
+			if e.mode.IsDir() || e.mode&0111 != 0 {
+				perm = 0755
+			}
+			if e.mode.Perm() != perm {
+				if err := os.Chmod(e.path, perm); err != nil {
+					return errors.Wrapf(err, "failed to normalize mode of %s", e.path)
+				}
+			}
+		}
+		if !n.ModTime.IsZero() {
+			if err := os.Chtimes(e.path, n.ModTime, n.ModTime); err != nil {
+				return errors.Wrapf(err, "failed to normalize times of %s", e.path)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestNormalizeTree(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not meaningful on windows")
+	}
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("root/sub")
+	h.TempFile("root/plain.go", "package root")
+	h.TempFile("root/sub/script.sh", "#!/bin/sh")
+	if err := os.Chmod(h.Path("root/plain.go"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(h.Path("root/sub/script.sh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(h.Path("root/sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	mt := time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	root := h.Path("root")
+	if err := NormalizeTree(root, ExportNormalization{Modes: true, ModTime: mt}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]os.FileMode{
+		".":             0755,
+		"plain.go":      0644,
+		"sub":           0755,
+		"sub/script.sh": 0755,
+	}
+	for rel, perm := range want {
+		fi, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != perm {
+			t.Errorf("expected %s to have mode %v, got %v", rel, perm, fi.Mode().Perm())
+		}
+		if !fi.ModTime().Equal(mt) {
+			t.Errorf("expected %s to have mtime %s, got %s", rel, mt, fi.ModTime())
+		}
+	}
+}
+
+func TestNormalizeTreeZero(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile("root/plain.go", "package root")
+	before, err := os.Stat(h.Path("root/plain.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NormalizeTree(h.Path("root"), ExportNormalization{}); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := os.Stat(h.Path("root/plain.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Mode() != before.Mode() || !after.ModTime().Equal(before.ModTime()) {
+		t.Error("expected zero ExportNormalization to leave files untouched")
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// A SourceManager created with Offline set never touches the network. Sources
+// are only read from their local copies in the cache directory, and from
+// cached metadata, which is used however old it is. Git sources list their
+// versions from the branches and tags last fetched into their local copy,
+// rather than from their upstream.
+//
+// Anything that would require the network - deducing a project root from
+// go-get metadata that is not in the cache, listing the versions of other
+// sources, or fetching a source, or revisions missing from its local copy -
+// fails instead with an *OfflineError.
+
+// OfflineError indicates that an operation could not be carried out, because
+// it requires network access and the SourceManager is offline.
+type OfflineError struct {
+	// Project is the project for which the operation was needed, if known.
+	Project ProjectRoot
+	// URL is the network destination of the operation, with any credentials
+	// redacted.
+	URL string
+	// Operation describes the operation, such as fetching go-get metadata or
+	// initializing a local source cache.
+	Operation string
+}
+
+func (e *OfflineError) Error() string {
+	if e.Project == "" {
+		return fmt.Sprintf("%s from %s requires network access, but the source manager is offline", e.Operation, e.URL)
+	}
+	return fmt.Sprintf("%s for %s from %s requires network access, but the source manager is offline", e.Operation, e.Project, e.URL)
+}
+
+// newOfflineError returns an *OfflineError for an operation of the given type
+// against dest.
+func newOfflineError(dest string, typ callType) error {
+	return &OfflineError{
+		URL:       redactURL(dest),
+		Operation: typ.String(),
+	}
+}
+
+// withOfflineProject identifies pr as the project for which an operation was
+// needed, if err was caused by an *OfflineError that does not identify one yet.
+func withOfflineProject(err error, pr ProjectRoot) error {
+	if oe, ok := errors.Cause(err).(*OfflineError); ok && oe.Project == "" {
+		oe2 := *oe
+		oe2.Project = pr
+		return &oe2
+	}
+	return err
+}
+
+// offlineErrors returns the single error recorded for pr, if every attempt to
+// set up a source for it failed for want of the network, and errs otherwise.
+func offlineErrors(errs errorSlice, pr ProjectRoot) error {
+	for _, err := range errs {
+		if _, ok := errors.Cause(err).(*OfflineError); !ok {
+			return errs
+		}
+	}
+	if len(errs) == 0 {
+		return errs
+	}
+	return withOfflineProject(errs[0], pr)
+}
+
+// offlineVersionLister is implemented by sources that, when offline, can list
+// their versions from their local repository instead of their upstream.
+type offlineVersionLister interface {
+	listsVersionsOffline() bool
+}
+
+func listsVersionsOffline(src source) bool {
+	ol, ok := src.(offlineVersionLister)
+	return ok && ol.listsVersionsOffline()
+}
+
+func (*gitSource) listsVersionsOffline() bool {
+	return true
+}
+
+// offlineGuard wraps f, an operation of the given type against dest, so that
+// it fails without being invoked if offline is set.
+func offlineGuard(offline bool, dest string, typ callType, f func(context.Context) error) func(context.Context) error {
+	if !offline {
+		return f
+	}
+	return func(context.Context) error {
+		return newOfflineError(dest, typ)
+	}
+}
+
+// listLocalRefs lists the refs of the source's upstream as last fetched into
+// its local repository, in the format of git ls-remote's output.
+func (s *gitSource) listLocalRefs(ctx context.Context) ([]byte, error) {
+	r := s.repo
+	if !r.CheckLocal() {
+		return nil, newOfflineError(r.Remote(), ctListVersions)
+	}
+
+	cmd := commandContext(ctx, s.settings.vcs, "git", "for-each-ref", "--format=%(objectname)%09%(*objectname)%09%(refname)", "refs/remotes/origin", "refs/tags")
+	cmd.SetDir(r.LocalPath())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrap(err, string(out))
+	}
+
+	var buf bytes.Buffer
+	// As with ls-remote, HEAD goes first; the default branch is the one that
+	// origin's HEAD points to.
+	cmd = commandContext(ctx, s.settings.vcs, "git", "rev-parse", "--verify", "--quiet", "refs/remotes/origin/HEAD")
+	cmd.SetDir(r.LocalPath())
+	if head, err := cmd.CombinedOutput(); err == nil {
+		fmt.Fprintf(&buf, "%s\tHEAD\n", bytes.TrimSpace(head))
+	}
+
+	for _, line := range bytes.Split(bytes.TrimSpace(out), []byte("\n")) {
+		fields := bytes.Split(line, []byte("\t"))
+		if len(fields) != 3 {
+			continue
+		}
+		rev, peeled, name := fields[0], fields[1], string(fields[2])
+		switch {
+		case name == "refs/remotes/origin/HEAD":
+		case bytes.HasPrefix(fields[2], []byte("refs/remotes/origin/")):
+			fmt.Fprintf(&buf, "%s\trefs/heads/%s\n", rev, name[len("refs/remotes/origin/"):])
+		default:
+			fmt.Fprintf(&buf, "%s\t%s\n", rev, name)
+			// Annotated tags are followed by the commit they point to.
+			if len(peeled) > 0 {
+				fmt.Fprintf(&buf, "%s\t%s^{}\n", peeled, name)
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -4,7 +4,10 @@
 
 package paths
 
-import "strings"
+import (
+	"path"
+	"strings"
+)
 
 // IsStandardImportPath reports whether $GOROOT/src/path should be considered
 // part of the standard distribution. For historical reasons we allow people to add
@@ -19,3 +22,51 @@ func IsStandardImportPath(path string) bool {
 
 	return !strings.Contains(path[:i], ".")
 }
+
+// MatchPrefixPatterns reports whether any path prefix of target matches one of
+// the glob patterns in the comma-separated list globs, with the same syntax as
+// path.Match. This follows the semantics of the go command's GOPRIVATE
+// variable: a pattern must match a whole number of leading path elements, so
+// "*.corp.example.com" matches "git.corp.example.com/team/repo", and
+// "example.com/private" matches both itself and "example.com/private/repo".
+//
+// Empty patterns are ignored, as are patterns that are malformed.
+func MatchPrefixPatterns(globs, target string) bool {
+	for globs != "" {
+		// Extract next non-empty glob in comma-separated list.
+		var glob string
+		if i := strings.Index(globs, ","); i >= 0 {
+			glob, globs = globs[:i], globs[i+1:]
+		} else {
+			glob, globs = globs, ""
+		}
+		if glob == "" {
+			continue
+		}
+
+		// A glob with N+1 path elements (N slashes) needs to be matched
+		// against the first N+1 path elements of target, which end just
+		// before the N+1'th slash.
+		n := strings.Count(glob, "/")
+		prefix := target
+		// Walk target, counting slashes, truncating at the N+1'th slash.
+		for i := 0; i < len(target); i++ {
+			if target[i] == '/' {
+				if n == 0 {
+					prefix = target[:i]
+					break
+				}
+				n--
+			}
+		}
+		if n > 0 {
+			// Not enough prefix elements.
+			continue
+		}
+		if matched, _ := path.Match(glob, prefix); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -35,3 +35,30 @@ func TestIsStandardImportPath(t *testing.T) {
 		}
 	}
 }
+
+func TestMatchPrefixPatterns(t *testing.T) {
+	fix := []struct {
+		globs, target string
+		match         bool
+	}{
+		{"", "github.com/foo/bar", false},
+		{",,", "github.com/foo/bar", false},
+		{"github.com/foo", "github.com/foo", true},
+		{"github.com/foo", "github.com/foo/bar", true},
+		{"github.com/foo", "github.com/foobar", false},
+		{"github.com/foo/bar/baz", "github.com/foo/bar", false},
+		{"*.corp.example.com", "git.corp.example.com/team/repo", true},
+		{"*.corp.example.com", "corp.example.com/team/repo", false},
+		{"github.com/*/internal", "github.com/org/internal/pkg", true},
+		{"github.com/*/internal", "github.com/org/public/pkg", false},
+		{"example.com,github.com/foo", "github.com/foo/bar", true},
+		{"example.com,github.com/foo", "github.com/bar", false},
+		{"[", "github.com/foo", false},
+	}
+
+	for _, f := range fix {
+		if m := MatchPrefixPatterns(f.globs, f.target); m != f.match {
+			t.Errorf("expected MatchPrefixPatterns(%q, %q) to be %v, got %v", f.globs, f.target, f.match, m)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// BuildContext is a platform, and a set of build tags, for which packages may
+// be built. See PackageTree.ForContexts.
+type BuildContext struct {
+	GOOS, GOARCH string
+	Tags         []string
+}
+
+// ParseBuildContext parses a BuildContext of the form GOOS/GOARCH, optionally
+// followed by a colon and a comma-separated list of build tags, as in
+// "linux/amd64:netgo,osusergo".
+func ParseBuildContext(s string) (BuildContext, error) {
+	platform, tags := s, ""
+	if i := strings.IndexByte(s, ':'); i != -1 {
+		platform, tags = s[:i], s[i+1:]
+	}
+
+	parts := strings.Split(platform, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return BuildContext{}, fmt.Errorf("build context %q must be of the form GOOS/GOARCH[:tag,...]", s)
+	}
+
+	c := BuildContext{GOOS: parts[0], GOARCH: parts[1]}
+	if tags != "" {
+		for _, t := range strings.Split(tags, ",") {
+			if t == "" {
+				return BuildContext{}, fmt.Errorf("build context %q has an empty build tag", s)
+			}
+			c.Tags = append(c.Tags, t)
+		}
+	}
+	return c, nil
+}
+
+func (c BuildContext) String() string {
+	s := c.GOOS + "/" + c.GOARCH
+	if len(c.Tags) > 0 {
+		s += ":" + strings.Join(c.Tags, ",")
+	}
+	return s
+}
+
+// matches reports whether a Go file of the given name, with the given build
+// constraint lines, would be built in c. Whether cgo is enabled is a property
+// of the toolchain's environment rather than of the platform, so files that
+// would be built with cgo either enabled or disabled match.
+func (c BuildContext) matches(name, constraint string) bool {
+	src := constraint + "\n\npackage p\n"
+	bc := build.Context{
+		GOOS:        c.GOOS,
+		GOARCH:      c.GOARCH,
+		BuildTags:   c.Tags,
+		ReleaseTags: build.Default.ReleaseTags,
+		Compiler:    build.Default.Compiler,
+		OpenFile: func(string) (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(src)), nil
+		},
+	}
+
+	for _, cgo := range []bool{true, false} {
+		bc.CgoEnabled = cgo
+		if ok, err := bc.MatchFile("", name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// nameConstrained reports whether a Go file's name carries a GOOS or GOARCH
+// suffix, as in foo_windows.go or foo_linux_arm64_test.go. No one platform
+// matches every such suffix, so at least one of two unrelated platforms fails
+// to.
+func nameConstrained(name string) bool {
+	for _, c := range []BuildContext{{GOOS: "linux", GOARCH: "amd64"}, {GOOS: "windows", GOARCH: "arm64"}} {
+		if !c.matches(name, "") {
+			return true
+		}
+	}
+	return false
+}
+
+// ConstrainedFile describes a Go file that is not built in every build
+// context, by virtue of a build constraint or a GOOS or GOARCH suffix on its
+// name.
+type ConstrainedFile struct {
+	Name string // The file's name
+	// Constraint holds the file's +build and go:build lines, joined by
+	// newlines.
+	Constraint string
+	Test       bool // Whether the file is a test
+	// Imports lists only those of the file's imports that no file of the
+	// package that is built in every context shares.
+	Imports []string
+}
+
+// ForContexts returns a copy of the tree in which each package's imports are
+// restricted to those of its files that are built in at least one of ctxs.
+// The packages of the restricted tree have no Constrained files, so
+// restricting it again has no effect. If ctxs is empty, the tree is returned
+// as it is, with the imports of all files, across all platforms.
+//
+// Files tagged with "ignore" are never excluded, so that the imports of a
+// tools.go file, or similar, are still pulled in.
+func (t PackageTree) ForContexts(ctxs []BuildContext) PackageTree {
+	if len(ctxs) == 0 || !t.constrained() {
+		return t
+	}
+
+	t2 := t.Copy()
+	for ip, poe := range t2.Packages {
+		if poe.Err != nil || len(poe.P.Constrained) == 0 {
+			continue
+		}
+		poe.P.Imports, poe.P.TestImports = poe.P.importsFor(ctxs)
+		poe.P.Constrained = nil
+		t2.Packages[ip] = poe
+	}
+	return t2
+}
+
+// constrained reports whether any package in the tree has Constrained files.
+func (t PackageTree) constrained() bool {
+	for _, poe := range t.Packages {
+		if poe.Err == nil && len(poe.P.Constrained) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// importsFor returns the package's imports and test imports, less those that
+// only files that are built in none of ctxs have.
+func (p Package) importsFor(ctxs []BuildContext) (imports, testImports []string) {
+	keep := map[bool]map[string]bool{false: {}, true: {}}
+	drop := map[bool]map[string]bool{false: {}, true: {}}
+	for _, cf := range p.Constrained {
+		m := drop
+		for _, c := range ctxs {
+			if c.matches(cf.Name, cf.Constraint) {
+				m = keep
+				break
+			}
+		}
+		for _, imp := range cf.Imports {
+			m[cf.Test][imp] = true
+		}
+	}
+
+	filter := func(l []string, test bool) []string {
+		var out []string
+		for _, imp := range l {
+			if keep[test][imp] || !drop[test][imp] {
+				out = append(out, imp)
+			}
+		}
+		return out
+	}
+	return filter(p.Imports, false), filter(p.TestImports, true)
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseBuildContext(t *testing.T) {
+	for s, want := range map[string]BuildContext{
+		"linux/amd64":            {GOOS: "linux", GOARCH: "amd64"},
+		"windows/386:netgo,cgo":  {GOOS: "windows", GOARCH: "386", Tags: []string{"netgo", "cgo"}},
+		"darwin/arm64:appengine": {GOOS: "darwin", GOARCH: "arm64", Tags: []string{"appengine"}},
+	} {
+		got, err := ParseBuildContext(s)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %#v, got %#v", s, want, got)
+		}
+		if got.String() != s {
+			t.Errorf("%q: did not round trip, got %q", s, got.String())
+		}
+	}
+
+	for _, s := range []string{"", "linux", "linux/", "/amd64", "linux/amd64/x", "linux/amd64:a,,b"} {
+		if _, err := ParseBuildContext(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestForContexts(t *testing.T) {
+	ptree, err := ListPackages(filepath.Join(getTestdataRootDir(t), "src", "platform"), "platform")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all := []string{"bytes", "github.com/golang/dep/gps", "sort", "unicode"}
+	if got := ptree.Packages["platform"].P.Imports; !reflect.DeepEqual(got, all) {
+		t.Fatalf("expected the unrestricted imports to be %v, got %v", all, got)
+	}
+
+	linux := BuildContext{GOOS: "linux", GOARCH: "amd64"}
+	windows := BuildContext{GOOS: "windows", GOARCH: "amd64"}
+	appengine := BuildContext{GOOS: "linux", GOARCH: "amd64", Tags: []string{"appengine"}}
+	for _, c := range []struct {
+		ctxs []BuildContext
+		want []string
+	}{
+		{nil, all},
+		{[]BuildContext{linux}, []string{"sort", "unicode"}},
+		{[]BuildContext{windows}, []string{"github.com/golang/dep/gps", "sort"}},
+		{[]BuildContext{appengine}, []string{"bytes", "sort", "unicode"}},
+		{[]BuildContext{linux, windows}, []string{"github.com/golang/dep/gps", "sort", "unicode"}},
+	} {
+		rt := ptree.ForContexts(c.ctxs)
+		if got := rt.Packages["platform"].P.Imports; !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: expected imports %v, got %v", c.ctxs, c.want, got)
+		}
+		if c.ctxs == nil {
+			continue
+		}
+		if again := rt.ForContexts([]BuildContext{windows}); !reflect.DeepEqual(again, rt) {
+			t.Errorf("%v: restricting a restricted tree should have no effect", c.ctxs)
+		}
+	}
+
+	// The unrestricted tree must be left as it was.
+	if got := ptree.Packages["platform"].P.Imports; !reflect.DeepEqual(got, all) {
+		t.Errorf("restricting the tree modified it: imports are now %v", got)
+	}
+}
@@ -86,7 +86,8 @@ func (ir *IgnoredRuleset) Len() int {
 	return ir.t.Len()
 }
 
-// ToSlice converts the contents of the IgnoredRuleset to a string slice.
+// ToSlice converts the contents of the IgnoredRuleset to a string slice,
+// sorted lexicographically.
 //
 // This operation is symmetrically dual to NewIgnoredRuleset.
 func (ir *IgnoredRuleset) ToSlice() []string {
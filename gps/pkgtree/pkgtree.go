@@ -28,6 +28,11 @@ type Package struct {
 	CommentPath string   // Import path given in the comment on the package statement
 	Imports     []string // Imports from all go and cgo files
 	TestImports []string // Imports from all go test files (in go/build parlance: both TestImports and XTestImports)
+
+	// Constrained lists the files that are not built in every build context
+	// and have imports of their own, by which PackageTree.ForContexts
+	// restricts Imports and TestImports.
+	Constrained []ConstrainedFile
 }
 
 // vcsRoots is a set of directories we should not descend into in ListPackages when
@@ -61,6 +66,15 @@ var vcsRoots = map[string]struct{}{
 // A PackageTree is returned, which contains the ImportRoot and map of import path
 // to PackageOrErr - each path under the root that exists will have either a
 // Package, or an error describing why the directory is not a valid package.
+// Directories that cannot be read, and packages whose files cannot be read or
+// parsed, are recorded with an error in this way, rather than failing the
+// whole listing; only a failure to read fileRoot itself does that.
+//
+// Symbolic links to directories are followed, except those that lead back to
+// a directory the link is beneath. Directories named vendor beneath fileRoot,
+// however they are reached, are skipped, as they hold the code of other
+// projects. Directories named testdata are listed like any other, as their
+// packages may still be imported.
 func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 	ptree := PackageTree{
 		ImportRoot: importRoot,
@@ -73,8 +87,8 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 		return PackageTree{}, err
 	}
 
-	err = filepath.Walk(fileRoot, func(wp string, fi os.FileInfo, err error) error {
-		if err != nil && err != filepath.SkipDir {
+	err = walkTree(fileRoot, func(wp string, fi os.FileInfo, err error) error {
+		if err != nil && (wp == fileRoot || fi == nil || !fi.IsDir()) {
 			if os.IsPermission(err) {
 				return filepath.SkipDir
 			}
@@ -84,46 +98,24 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 			return nil
 		}
 
-		// Skip dirs that are known to hold non-local/dependency code.
-		//
-		// We don't skip _*, or testdata dirs because, while it may be poor
-		// form, importing them is not a compilation error.
-		switch fi.Name() {
-		case "vendor":
-			return filepath.SkipDir
-		}
-
-		// Skip dirs that are known to be VCS roots.
-		//
-		// Note that there are some pathological edge cases this doesn't cover,
-		// such as a user using Git for version control, but having a package
-		// named "svn" in a directory named ".svn".
-		if _, ok := vcsRoots[fi.Name()]; ok {
-			return filepath.SkipDir
-		}
-
-		{
-			// For Go 1.9 and earlier:
+		if wp != fileRoot {
+			// Skip dirs that are known to hold non-local/dependency code.
 			//
-			// The entry error is nil when visiting a directory that itself is
-			// untraversable, as it's still governed by the parent directory's
-			// perms. We have to check readability of the dir here, because
-			// otherwise we'll have an empty package entry when we fail to read any
-			// of the dir's contents.
+			// We don't skip _*, or testdata dirs because, while it may be poor
+			// form, importing them is not a compilation error.
+			switch fi.Name() {
+			case "vendor":
+				return filepath.SkipDir
+			}
+
+			// Skip dirs that are known to be VCS roots.
 			//
-			// If we didn't check here, then the next time this closure is called it
-			// would have an err with the same path as is called this time, as only
-			// then will filepath.Walk have attempted to descend into the directory
-			// and encountered an error.
-			var f *os.File
-			f, err = os.Open(wp)
-			if err != nil {
-				if os.IsPermission(err) {
-					return filepath.SkipDir
-				}
-				return err
+			// Note that there are some pathological edge cases this doesn't cover,
+			// such as a user using Git for version control, but having a package
+			// named "svn" in a directory named ".svn".
+			if _, ok := vcsRoots[fi.Name()]; ok {
+				return filepath.SkipDir
 			}
-			f.Close()
 		}
 
 		// Compute the import path. Run the result through ToSlash(), so that
@@ -131,12 +123,23 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 		// import paths.
 		ip := filepath.ToSlash(filepath.Join(importRoot, strings.TrimPrefix(wp, fileRoot)))
 
+		// The directory couldn't be read.
+		if err != nil {
+			if !os.IsPermission(err) {
+				ptree.Packages[ip] = PackageOrErr{
+					Err: &MalformedPackageError{ImportPath: ip, Dir: wp, Err: err},
+				}
+			}
+			return filepath.SkipDir
+		}
+
 		// Find all the imports, across all os/arch combos
 		p := &build.Package{
 			Dir:        wp,
 			ImportPath: ip,
 		}
-		err = fillPackage(p)
+		var constrained []ConstrainedFile
+		constrained, err = fillPackage(p)
 
 		if err != nil {
 			switch err.(type) {
@@ -146,10 +149,12 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 				ptree.Packages[ip] = PackageOrErr{
 					Err: err,
 				}
-				return nil
 			default:
-				return err
+				ptree.Packages[ip] = PackageOrErr{
+					Err: &MalformedPackageError{ImportPath: ip, Dir: wp, Err: err},
+				}
 			}
+			return nil
 		}
 
 		pkg := Package{
@@ -158,6 +163,7 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 			Name:        p.Name,
 			Imports:     p.Imports,
 			TestImports: dedupeStrings(p.TestImports, p.XTestImports),
+			Constrained: constrained,
 		}
 
 		if pkg.CommentPath != "" && !strings.HasPrefix(pkg.CommentPath, importRoot) {
@@ -209,24 +215,31 @@ func ListPackages(fileRoot, importRoot string) (PackageTree, error) {
 }
 
 // fillPackage full of info. Assumes p.Dir is set at a minimum
-func fillPackage(p *build.Package) error {
+//
+// The files that are not built in every build context, and have imports that
+// the files which are do not share, are returned.
+func fillPackage(p *build.Package) ([]ConstrainedFile, error) {
 	var buildPrefix = "// +build "
+	var goBuildPrefix = "//go:build "
 	var buildFieldSplit = func(r rune) bool {
 		return unicode.IsSpace(r) || r == ','
 	}
 
 	gofiles, err := filepath.Glob(filepath.Join(p.Dir, "*.go"))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(gofiles) == 0 {
-		return &build.NoGoError{Dir: p.Dir}
+		return nil, &build.NoGoError{Dir: p.Dir}
 	}
 
 	var testImports []string
 	var imports []string
 	var importComments []string
+	var constrained []ConstrainedFile
+	// The imports of the files that are built in every context, test or not.
+	everywhere := map[bool]map[string]bool{false: {}, true: {}}
 	for _, file := range gofiles {
 		// Skip underscore-led or dot-led files, in keeping with the rest of the toolchain.
 		bPrefix := filepath.Base(file)[0]
@@ -244,12 +257,13 @@ func fillPackage(p *build.Package) error {
 			if os.IsPermission(err) {
 				continue
 			}
-			return err
+			return nil, err
 		}
 		testFile := strings.HasSuffix(file, "_test.go")
 		fname := filepath.Base(file)
 
 		var ignored bool
+		var constraint []string
 		for _, c := range pf.Comments {
 			ic := findImportComment(pf.Name, c)
 			if ic != "" {
@@ -260,6 +274,11 @@ func fillPackage(p *build.Package) error {
 			}
 
 			var ct string
+			for _, cl := range c.List {
+				if strings.HasPrefix(cl.Text, buildPrefix) || strings.HasPrefix(cl.Text, goBuildPrefix) {
+					constraint = append(constraint, cl.Text)
+				}
+			}
 			for _, cl := range c.List {
 				if strings.HasPrefix(cl.Text, buildPrefix) {
 					ct = cl.Text
@@ -291,21 +310,57 @@ func fillPackage(p *build.Package) error {
 			p.GoFiles = append(p.GoFiles, fname)
 		}
 
+		// Files tagged with ignore are "soft" ignored, so their imports are
+		// always pulled in, as above.
+		var cf *ConstrainedFile
+		if !ignored && (len(constraint) > 0 || nameConstrained(fname)) {
+			cf = &ConstrainedFile{
+				Name:       fname,
+				Constraint: strings.Join(constraint, "\n"),
+				Test:       testFile,
+			}
+		}
+
 		for _, is := range pf.Imports {
 			name, err := strconv.Unquote(is.Path.Value)
 			if err != nil {
-				return err // can't happen?
+				return nil, err // can't happen?
 			}
 			if testFile {
 				testImports = append(testImports, name)
 			} else {
 				imports = append(imports, name)
 			}
+			if cf != nil {
+				cf.Imports = append(cf.Imports, name)
+			} else {
+				everywhere[testFile][name] = true
+			}
+		}
+		if cf != nil {
+			constrained = append(constrained, *cf)
 		}
 	}
+
+	// Only the imports that the files built in every context don't share can
+	// be excluded, so drop the rest, along with files left with none.
+	var kept []ConstrainedFile
+	for _, cf := range constrained {
+		var own []string
+		for _, imp := range uniq(cf.Imports) {
+			if !everywhere[cf.Test][imp] {
+				own = append(own, imp)
+			}
+		}
+		if len(own) > 0 {
+			cf.Imports = own
+			kept = append(kept, cf)
+		}
+	}
+
 	importComments = uniq(importComments)
 	if len(importComments) > 1 {
-		return &ConflictingImportComments{
+		return nil, &ConflictingImportComments{
 			ImportPath:                p.ImportPath,
 			ConflictingImportComments: importComments,
 		}
@@ -317,7 +372,7 @@ func fillPackage(p *build.Package) error {
 	testImports = uniq(testImports)
 	p.Imports = imports
 	p.TestImports = testImports
-	return nil
+	return kept, nil
 }
 
 var (
@@ -416,6 +471,24 @@ func (e *LocalImportsError) Error() string {
 	}
 }
 
+// MalformedPackageError indicates that the files of a package, or the directory
+// holding them, could not be read or parsed, for a reason other than those
+// described by the other errors recorded in a PackageTree.
+type MalformedPackageError struct {
+	ImportPath string
+	Dir        string
+	Err        error
+}
+
+func (e *MalformedPackageError) Error() string {
+	return fmt.Sprintf("import path %s could not be read from %s: %s", e.ImportPath, e.Dir, e.Err)
+}
+
+// Cause returns the underlying error.
+func (e *MalformedPackageError) Cause() error {
+	return e.Err
+}
+
 type wm struct {
 	err error
 	ex  map[string]bool
@@ -466,15 +539,48 @@ func missingPkgErr(pkg string) error {
 // packages, starting at the ImportRoot. The results of parsing the files in the
 // directory identified by each import path - a Package or an error - are stored
 // in the Packages map, keyed by that import path.
+//
+// Aliases holds any additional import roots under which the packages in the
+// tree may be imported by one another - for example, a vanity import path for
+// a project that is checked out beneath its repository path, or vice versa.
+// Imports under an alias are treated as internal to the tree, and are
+// rewritten onto ImportRoot during reachability analysis.
 type PackageTree struct {
 	ImportRoot string
+	Aliases    []string
 	Packages   map[string]PackageOrErr
 }
 
+// IsInternal reports whether the provided import path refers to a package that
+// is a logical child of the tree - that is, it is ImportRoot or one of the
+// tree's Aliases, or is beneath one of them.
+//
+// No check is made as to whether the package actually exists in the tree.
+func (t PackageTree) IsInternal(ip string) bool {
+	_, is := t.internalPath(ip)
+	return is
+}
+
+// internalPath reports whether ip is internal to the tree and, if so, returns
+// the equivalent import path beneath ImportRoot.
+func (t PackageTree) internalPath(ip string) (string, bool) {
+	if eqOrSlashedPrefix(ip, t.ImportRoot) {
+		return ip, true
+	}
+
+	for _, alias := range t.Aliases {
+		if alias != "" && eqOrSlashedPrefix(ip, alias) {
+			return t.ImportRoot + ip[len(alias):], true
+		}
+	}
+
+	return "", false
+}
+
 // ToReachMap looks through a PackageTree and computes the list of external
 // import statements (that is, import statements pointing to packages that are
-// not logical children of PackageTree.ImportRoot) that are transitively
-// imported by the internal packages in the tree.
+// not logical children of PackageTree.ImportRoot or its Aliases) that are
+// transitively imported by the internal packages in the tree.
 //
 // main indicates whether (true) or not (false) to include main packages in the
 // analysis. When utilized by gps' solver, main packages are generally excluded
@@ -588,10 +694,10 @@ func (t PackageTree) ToReachMap(main, tests, backprop bool, ignore *IgnoredRules
 				continue
 			}
 
-			if !eqOrSlashedPrefix(imp, t.ImportRoot) {
-				w.ex[imp] = true
+			if in, is := t.internalPath(imp); is {
+				w.in[in] = true
 			} else {
-				w.in[imp] = true
+				w.ex[imp] = true
 			}
 		}
 
@@ -606,10 +712,16 @@ func (t PackageTree) ToReachMap(main, tests, backprop bool, ignore *IgnoredRules
 // This is really only useful as a defensive measure to prevent external state
 // mutations.
 func (t PackageTree) Copy() PackageTree {
-	return PackageTree{
+	t2 := PackageTree{
 		ImportRoot: t.ImportRoot,
 		Packages:   CopyPackages(t.Packages, nil),
 	}
+	if len(t.Aliases) > 0 {
+		t2.Aliases = make([]string, len(t.Aliases))
+		copy(t2.Aliases, t.Aliases)
+	}
+
+	return t2
 }
 
 // CopyPackages returns a deep copy of p, optionally modifying the entries with fn.
@@ -639,6 +751,13 @@ func CopyPackages(p map[string]PackageOrErr, fn func(string, PackageOrErr) (stri
 				poe2.P.TestImports, pool = pool[:til], pool[til:]
 				copy(poe2.P.TestImports, poe.P.TestImports)
 			}
+			if len(poe.P.Constrained) > 0 {
+				poe2.P.Constrained = make([]ConstrainedFile, len(poe.P.Constrained))
+				for i, cf := range poe.P.Constrained {
+					cf.Imports = append([]string(nil), cf.Imports...)
+					poe2.P.Constrained[i] = cf
+				}
+			}
 		}
 		if fn != nil {
 			path, poe2 = fn(path, poe2)
@@ -1485,7 +1485,7 @@ func TestListPackages(t *testing.T) {
 								for path, perr := range fix.out.Packages {
 									seen[path] = true
 									if operr, exists := out.Packages[path]; !exists {
-										t.Errorf("Expected PackageOrErr for path %s was missing from output:\n\t%s", path, perr)
+										t.Errorf("Expected PackageOrErr for path %s was missing from output:\n\t%#v", path, perr)
 									} else {
 										if !reflect.DeepEqual(perr, operr) {
 											t.Errorf("PkgOrErr for path %s was not as expected:\n\t(GOT): %#v\n\t(WNT): %#v", path, operr, perr)
@@ -1498,7 +1498,7 @@ func TestListPackages(t *testing.T) {
 										continue
 									}
 
-									t.Errorf("Got PackageOrErr for path %s, but none was expected:\n\t%s", path, operr)
+									t.Errorf("Got PackageOrErr for path %s, but none was expected:\n\t%#v", path, operr)
 								}
 							}
 						}
@@ -1595,7 +1595,7 @@ func TestTrimHiddenPackages(t *testing.T) {
 					for path, perr := range want.Packages {
 						seen[path] = true
 						if operr, exists := got.Packages[path]; !exists {
-							t.Errorf("Expected PackageOrErr for path %s was missing from output:\n\t%s", path, perr)
+							t.Errorf("Expected PackageOrErr for path %s was missing from output:\n\t%#v", path, perr)
 						} else {
 							if !reflect.DeepEqual(perr, operr) {
 								t.Errorf("PkgOrErr for path %s was not as expected:\n\t(GOT): %#v\n\t(WNT): %#v", path, operr, perr)
@@ -1608,7 +1608,7 @@ func TestTrimHiddenPackages(t *testing.T) {
 							continue
 						}
 
-						t.Errorf("Got PackageOrErr for path %s, but none was expected:\n\t%s", path, operr)
+						t.Errorf("Got PackageOrErr for path %s, but none was expected:\n\t%#v", path, operr)
 					}
 				}
 			}
@@ -1652,6 +1652,7 @@ func TestListPackagesNoPerms(t *testing.T) {
 
 	want := PackageTree{
 		ImportRoot: "ren",
+		Aliases:    []string{"example.com/ren"},
 		Packages: map[string]PackageOrErr{
 			"ren": {
 				Err: &build.NoGoError{
@@ -1701,6 +1702,76 @@ func TestListPackagesNoPerms(t *testing.T) {
 	}
 }
 
+func TestListPackagesSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		// Creating symlinks on windows requires privileges that tests don't
+		// typically have.
+		t.Skip()
+	}
+	tmp, err := ioutil.TempDir("", "listpkgssym")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	root := filepath.Join(tmp, "sym")
+	files := map[string]string{
+		"a/a.go":        "package a\n\nimport \"sort\"\n",
+		"vendor/v/v.go": "package v\n",
+	}
+	for name, content := range files {
+		fp := filepath.Join(root, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(fp), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(fp, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.MkdirAll(filepath.Join(root, "broken"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		// A followed link, a loop, a vendor directory by another name, and a
+		// file that can't be read.
+		"alias":          "a",
+		"a/loop":         "..",
+		"v":              "vendor/v",
+		"a/vendor":       "../vendor",
+		"broken/gone.go": "nonexistent.go",
+	} {
+		if err = os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := ListPackages(root, "sym")
+	if err != nil {
+		t.Fatalf("Unexpected err from ListPackages: %s", err)
+	}
+
+	want := map[string]string{"sym/a": "a", "sym/alias": "a", "sym/v": "v"}
+	for ip, name := range want {
+		if poe, has := got.Packages[ip]; !has || poe.Err != nil || poe.P.Name != name {
+			t.Errorf("expected package %s named %s, got %#v", ip, name, poe)
+		}
+	}
+	if imps := got.Packages["sym/alias"].P.Imports; !reflect.DeepEqual(imps, []string{"sort"}) {
+		t.Errorf("expected the linked package to import sort, got %v", imps)
+	}
+	if _, is := got.Packages["sym/broken"].Err.(*MalformedPackageError); !is {
+		t.Errorf("expected a *MalformedPackageError for the package with an unreadable file, got %#v", got.Packages["sym/broken"])
+	}
+	for ip := range got.Packages {
+		if strings.Contains(ip, "vendor") || strings.Contains(ip, "loop") {
+			t.Errorf("expected %s not to be listed", ip)
+		}
+	}
+	if len(got.Packages) != 5 {
+		t.Errorf("expected 5 entries, for the root, a, alias, v and broken, got %v", got.Packages)
+	}
+}
+
 func TestToReachMap(t *testing.T) {
 	// There's enough in the 'varied' test case to test most of what matters
 	vptree, err := ListPackages(filepath.Join(getTestdataRootDir(t), "src", "github.com", "example", "varied"), "github.com/example/varied")
@@ -2229,6 +2300,82 @@ func TestToReachMapFilterDot(t *testing.T) {
 	}
 }
 
+func TestPackageTreeIsInternal(t *testing.T) {
+	ptree := PackageTree{
+		ImportRoot: "github.com/example/foo",
+		Aliases:    []string{"example.com/foo", ""},
+	}
+
+	cases := map[string]bool{
+		"github.com/example/foo":          true,
+		"github.com/example/foo/bar":      true,
+		"github.com/example/foobar":       false,
+		"github.com/example":              false,
+		"example.com/foo":                 true,
+		"example.com/foo/bar/baz":         true,
+		"example.com/foobar":              false,
+		"github.com/other/foo":            false,
+		"github.com/example/foo/vendor/x": true,
+		"":                                false,
+		"sort":                            false,
+	}
+
+	for ip, want := range cases {
+		if got := ptree.IsInternal(ip); got != want {
+			t.Errorf("expected IsInternal(%q) to be %v, got %v", ip, want, got)
+		}
+	}
+}
+
+func TestToReachMapAliases(t *testing.T) {
+	ptree := PackageTree{
+		ImportRoot: "github.com/example/foo",
+		Aliases:    []string{"example.com/foo"},
+		Packages: map[string]PackageOrErr{
+			"github.com/example/foo": {
+				P: Package{
+					ImportPath: "github.com/example/foo",
+					Name:       "foo",
+					Imports:    []string{"example.com/foo/bar", "sort"},
+				},
+			},
+			"github.com/example/foo/bar": {
+				P: Package{
+					ImportPath: "github.com/example/foo/bar",
+					Name:       "bar",
+					Imports:    []string{"github.com/other/baz"},
+				},
+			},
+		},
+	}
+
+	want := ReachMap{
+		"github.com/example/foo": {
+			External: []string{"github.com/other/baz", "sort"},
+			Internal: []string{"github.com/example/foo/bar"},
+		},
+		"github.com/example/foo/bar": {
+			External: []string{"github.com/other/baz"},
+		},
+	}
+
+	rm, em := ptree.ToReachMap(true, true, false, nil)
+	if len(em) != 0 {
+		t.Errorf("should not have any error packages from ToReachMap, got %s", em)
+	}
+	if !reflect.DeepEqual(want, rm) {
+		t.Errorf("imports via an alias should be treated as internal:\n\t(GOT): %v\n\t(WNT): %v", rm, want)
+	}
+
+	// Without the alias, the root project is reached as an external dependency
+	// of itself.
+	ptree.Aliases = nil
+	rm, _ = ptree.ToReachMap(true, true, false, nil)
+	if ext := rm["github.com/example/foo"].External; !reflect.DeepEqual(ext, []string{"example.com/foo/bar", "sort"}) {
+		t.Errorf("unexpected external imports without alias: %v", ext)
+	}
+}
+
 func getTestdataRootDir(t *testing.T) string {
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -2242,6 +2389,7 @@ func getTestdataRootDir(t *testing.T) string {
 func TestCanaryPackageTreeCopy(t *testing.T) {
 	ptreeFields := []string{
 		"ImportRoot",
+		"Aliases",
 		"Packages",
 	}
 	packageFields := []string{
@@ -2250,6 +2398,7 @@ func TestCanaryPackageTreeCopy(t *testing.T) {
 		"CommentPath",
 		"Imports",
 		"TestImports",
+		"Constrained",
 	}
 
 	fieldNames := func(typ reflect.Type) []string {
@@ -0,0 +1,100 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pkgtree
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// walkTree walks the directory tree rooted at root, calling walkFn for each file
+// or directory in the tree, including root, as filepath.Walk does - but follows
+// symbolic links to directories, so that walkFn is passed the info of a link's
+// target, under the link's path.
+//
+// A link to a directory that is, or contains, the one the link is in would lead
+// the walk around in a loop; such links are not followed.
+func walkTree(root string, walkFn filepath.WalkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		err = walkFn(root, nil, err)
+	} else {
+		err = walk(root, info, walkFn, nil)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walk recursively descends path, which has the given info and is beneath the
+// ancestors, calling walkFn.
+func walk(path string, info os.FileInfo, walkFn filepath.WalkFunc, ancestors []os.FileInfo) error {
+	if !info.IsDir() {
+		return walkFn(path, info, nil)
+	}
+
+	names, err := readDirNames(path)
+	err1 := walkFn(path, info, err)
+	// If err != nil, walk can't walk into this directory. err1 != nil means
+	// walkFn wants walk to skip this directory or stop walking entirely.
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	ancestors = append(ancestors, info)
+	for _, name := range names {
+		filename := filepath.Join(path, name)
+		fileInfo, err := os.Lstat(filename)
+		if err == nil && fileInfo.Mode()&os.ModeSymlink != 0 {
+			if target, serr := os.Stat(filename); serr == nil && target.IsDir() {
+				if within(target, ancestors) {
+					continue
+				}
+				fileInfo = target
+			}
+		}
+
+		if err != nil {
+			if err := walkFn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := walk(filename, fileInfo, walkFn, ancestors); err != nil {
+			if !fileInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// within reports whether the directory is the same as any of the ancestors.
+func within(dir os.FileInfo, ancestors []os.FileInfo) bool {
+	for _, a := range ancestors {
+		if os.SameFile(dir, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDirNames reads the directory named by dirname and returns a sorted list
+// of directory entries.
+func readDirNames(dirname string) ([]string, error) {
+	f, err := os.Open(dirname)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
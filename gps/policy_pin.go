@@ -0,0 +1,84 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "fmt"
+
+// PolicyPin caps a project to a set of approved versions. Unlike the
+// constraints in manifests, policy pins are supplied when solving, typically
+// by a central service that vets versions for security, and apply to the
+// project wherever it appears in the depgraph, whatever the root's overrides.
+//
+// They sit between the two tiers that otherwise decide versions: a pin only
+// narrows what manifest constraints admit, and a locked version the pin does
+// not admit is abandoned, as though its constraints no longer admitted it.
+type PolicyPin struct {
+	// Constraint admits the approved versions of the project.
+	Constraint Constraint
+	// Reason, if set, explains the pin, such as by naming the advisory that
+	// prompted it.
+	Reason string
+}
+
+func (p PolicyPin) String() string {
+	if p.Reason == "" {
+		return p.Constraint.String()
+	}
+	return fmt.Sprintf("%s (%s)", p.Constraint, p.Reason)
+}
+
+// BoundPolicyPin describes a policy pin that bound during a solve - that is,
+// one that excluded versions of its project that would otherwise have been
+// selectable.
+type BoundPolicyPin struct {
+	PolicyPin
+	// Excluded lists the versions that the pin excluded, in the order in
+	// which the solver tried them.
+	Excluded []Version
+}
+
+// checkPolicyPin ensures that the atom's version is admitted by the policy pin
+// on its project, if there is one.
+func (s *solver) checkPolicyPin(pa atom) error {
+	pin, has := s.pins[pa.id.ProjectRoot]
+	if !has || pin.Constraint.Matches(pa.v) {
+		return nil
+	}
+
+	pr := pa.id.ProjectRoot
+	var seen bool
+	for _, v := range s.pinned[pr] {
+		seen = seen || v == pa.v
+	}
+	if !seen {
+		s.pinned[pr] = append(s.pinned[pr], pa.v)
+	}
+
+	return &policyPinFailure{
+		goal: pa,
+		pin:  pin,
+	}
+}
+
+// boundPolicyPins returns the policy pins on the selected projects that
+// excluded any of their versions.
+func (s *solver) boundPolicyPins(lps []LockedProject) map[ProjectRoot]BoundPolicyPin {
+	var bound map[ProjectRoot]BoundPolicyPin
+	for _, lp := range lps {
+		pr := lp.Ident().ProjectRoot
+		excl := s.pinned[pr]
+		if len(excl) == 0 {
+			continue
+		}
+		if bound == nil {
+			bound = make(map[ProjectRoot]BoundPolicyPin)
+		}
+		bound[pr] = BoundPolicyPin{
+			PolicyPin: s.pins[pr],
+			Excluded:  append([]Version(nil), excl...),
+		}
+	}
+	return bound
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyPinSolve(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a ^1.0.0", "b ^1.0.0"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("a 1.2.0"),
+			mkDepspec("b 1.0.0", "c ^1.0.0"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("c 1.1.0"),
+			mkDepspec("c 1.2.0"),
+		},
+		l: mklock("a 1.2.0", "b 1.0.0"),
+		r: mksolution("a 1.1.0", "b 1.0.0", "c 1.1.0"),
+	}
+	params := basicFixtureParams(fix)
+	params.PolicyPins = map[ProjectRoot]PolicyPin{
+		"a": {Constraint: testSemverConstraint(t, "<1.2.0"), Reason: "ADV-1"},
+		"b": {Constraint: testSemverConstraint(t, "^1.0.0")},
+		"c": {Constraint: testSemverConstraint(t, "~1.1.0")},
+	}
+
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	fixtureSolveSimpleChecks(fix, soln, err, t)
+	if err != nil {
+		return
+	}
+
+	reasons := soln.SelectionReasons()
+	for pr, want := range map[ProjectRoot]SelectionReason{
+		"a": SelectedByPolicyPin,
+		"b": SelectedFromLock,
+		"c": SelectedByPolicyPin,
+	} {
+		if reasons[pr] != want {
+			t.Errorf("expected %s to be selected by %s, got %s", pr, want, reasons[pr])
+		}
+	}
+
+	bound := soln.PolicyPins()
+	if len(bound) != 2 {
+		t.Fatalf("expected the pins on a and c to bind, got %v", bound)
+	}
+	for pr, want := range map[ProjectRoot]string{"a": "1.2.0", "c": "1.2.0"} {
+		bp := bound[pr]
+		if len(bp.Excluded) != 1 || bp.Excluded[0].String() != want {
+			t.Errorf("expected the pin on %s to exclude just %s, got %v", pr, want, bp.Excluded)
+		}
+	}
+	if bound["a"].Reason != "ADV-1" {
+		t.Errorf("expected the pin on a to keep its reason, got %q", bound["a"].Reason)
+	}
+
+	if r, err := ParseSelectionReason(SelectedByPolicyPin.String()); err != nil || r != SelectedByPolicyPin {
+		t.Errorf("expected %q to parse back to itself, got %v (%v)", SelectedByPolicyPin, r, err)
+	}
+}
+
+func TestPolicyPinPrecedesOverrides(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a ^1.0.0"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+		},
+		ovr: ProjectConstraints{
+			"a": {Constraint: NewVersion("1.1.0")},
+		},
+	}
+	params := basicFixtureParams(fix)
+	params.PolicyPins = map[ProjectRoot]PolicyPin{
+		"a": {Constraint: NewVersion("1.0.0")},
+	}
+
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err == nil {
+		t.Fatalf("expected the pin to exclude the overridden version, got %v", soln.Projects())
+	}
+	if !strings.Contains(err.Error(), "policy pin") {
+		t.Errorf("expected the failure to name the policy pin, got %v", err)
+	}
+
+	params.PolicyPins["a"] = PolicyPin{}
+	if _, err := Prepare(params, newdepspecSM(fix.ds, nil)); err == nil {
+		t.Error("expected a pin without a constraint to be rejected")
+	}
+}
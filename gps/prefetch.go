@@ -0,0 +1,136 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// prefetchConcurrency is the maximum number of locked projects that are
+// prefetched at once.
+const prefetchConcurrency = 8
+
+// lockPrefetch tracks the prefetching of the projects in the root lock, so
+// that the time it saved the solver can be reported with its metrics.
+type lockPrefetch struct {
+	mu      sync.Mutex
+	fetches map[ProjectRoot]*prefetchTiming
+
+	// The number of projects whose prefetch had completed by the time the
+	// solver first needed them, and the wall time those and any still in
+	// flight had already spent fetching on the solver's behalf.
+	ready int
+	saved time.Duration
+}
+
+type prefetchTiming struct {
+	start, end time.Time
+	claimed    bool
+}
+
+// prefetchLock begins fetching, in parallel, every project in the root lock,
+// along with the package tree at its locked version unless the project is to
+// be changed, and returns immediately. Prefetching stops as soon as ctx is
+// canceled; fetches already in flight run to completion in the background.
+func (b *bridge) prefetchLock(ctx context.Context) *lockPrefetch {
+	lps := b.s.rd.rl.Projects()
+	pf := &lockPrefetch{
+		fetches: make(map[ProjectRoot]*prefetchTiming, len(lps)),
+	}
+	if len(lps) == 0 {
+		return pf
+	}
+
+	work := make(chan LockedProject)
+	for _, lp := range lps {
+		pf.fetches[lp.Ident().ProjectRoot] = &prefetchTiming{}
+	}
+
+	n := prefetchConcurrency
+	if len(lps) < n {
+		n = len(lps)
+	}
+	ops := b.opsUnder(ctx)
+	for i := 0; i < n; i++ {
+		go func() {
+			for lp := range work {
+				if ctx.Err() != nil {
+					continue
+				}
+				pi := lp.Ident()
+				pf.begin(pi.ProjectRoot)
+				// Metrics are not tracked for these calls, as they are made
+				// off the solver's goroutine.
+				ops.SyncSourceFor(pi)
+				if !b.s.rd.needVersionsFor(pi.ProjectRoot) {
+					ops.ListPackages(pi, lp.Version())
+				}
+				pf.end(pi.ProjectRoot)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(work)
+		for _, lp := range lps {
+			select {
+			case work <- lp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return pf
+}
+
+func (pf *lockPrefetch) begin(pr ProjectRoot) {
+	pf.mu.Lock()
+	pf.fetches[pr].start = time.Now()
+	pf.mu.Unlock()
+}
+
+func (pf *lockPrefetch) end(pr ProjectRoot) {
+	pf.mu.Lock()
+	pf.fetches[pr].end = time.Now()
+	pf.mu.Unlock()
+}
+
+// claim records that the solver needs the project, crediting the prefetch
+// with whatever fetching it has done for the project so far. Only a
+// project's first claim counts.
+func (pf *lockPrefetch) claim(pr ProjectRoot) {
+	if pf == nil {
+		return
+	}
+
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	pt, has := pf.fetches[pr]
+	if !has || pt.claimed {
+		return
+	}
+	pt.claimed = true
+
+	switch {
+	case pt.start.IsZero():
+		// Not yet begun; the solver will have to do all the work itself.
+	case pt.end.IsZero():
+		pf.saved += time.Since(pt.start)
+	default:
+		pf.ready++
+		pf.saved += pt.end.Sub(pt.start)
+	}
+}
+
+// stats reports the number of locked projects, the number that were ready
+// when first needed, and the estimated wall time the prefetch saved.
+func (pf *lockPrefetch) stats() (total, ready int, saved time.Duration) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	return len(pf.fetches), pf.ready, pf.saved
+}
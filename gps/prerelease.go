@@ -0,0 +1,142 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+)
+
+// PrereleasePolicy determines which prerelease versions, such as 1.1.0-rc.1,
+// semver constraints admit.
+type PrereleasePolicy uint8
+
+const (
+	// ExcludePrereleases admits prereleases only as the semver package does:
+	// under ranges whose lower bound is a prerelease of the same major, minor
+	// and patch version. ^1.1.0-rc.1 admits 1.1.0-rc.2, but ^1.0.0 does not
+	// admit 1.1.0-rc.1. This is the default.
+	ExcludePrereleases PrereleasePolicy = iota
+
+	// AllowRequestedPrereleases admits prereleases as AllowPrereleases does,
+	// but only under constraints that themselves name a prerelease, such as
+	// ^1.0.0-0 or ">=1.1.0-rc.1, <2.0.0". Other constraints admit them as
+	// under ExcludePrereleases, so that only the projects whose constraints
+	// explicitly ask for prereleases get them.
+	AllowRequestedPrereleases
+
+	// AllowPrereleases admits a prerelease under any semver constraint that
+	// admits the release it precedes, and within whose bounds it lies. ^1.0.0
+	// admits 1.1.0-rc.1, but neither 2.0.0-rc.1 nor 1.0.0-rc.1.
+	AllowPrereleases
+)
+
+func (p PrereleasePolicy) String() string {
+	switch p {
+	case ExcludePrereleases:
+		return "exclude"
+	case AllowRequestedPrereleases:
+		return "requested"
+	case AllowPrereleases:
+		return "allow"
+	}
+	return fmt.Sprintf("PrereleasePolicy(%d)", uint8(p))
+}
+
+// ParsePrereleasePolicy parses the string form of a PrereleasePolicy, as
+// produced by its String method.
+func ParsePrereleasePolicy(s string) (PrereleasePolicy, error) {
+	switch s {
+	case "exclude":
+		return ExcludePrereleases, nil
+	case "requested":
+		return AllowRequestedPrereleases, nil
+	case "allow":
+		return AllowPrereleases, nil
+	}
+	return 0, errors.Errorf("unknown prerelease policy %q", s)
+}
+
+// WithPrereleasePolicy returns c with the semver constraints within it, if
+// any, admitting prereleases according to p. Other constraints are returned
+// as they are.
+//
+// The policy set on SolveParameters is applied to every constraint the solver
+// considers, but a constraint may also be given its own.
+func WithPrereleasePolicy(c Constraint, p PrereleasePolicy) Constraint {
+	switch tc := c.(type) {
+	case semverConstraint:
+		tc.pre = p
+		return tc
+	case unionConstraint:
+		uc := make(unionConstraint, len(tc))
+		for i, m := range tc {
+			uc[i] = WithPrereleasePolicy(m, p)
+		}
+		return uc
+	case exclusionConstraint:
+		ec := exclusionConstraint{
+			base: WithPrereleasePolicy(tc.base, p),
+			excl: make([]Constraint, len(tc.excl)),
+		}
+		for i, e := range tc.excl {
+			ec.excl[i] = WithPrereleasePolicy(e, p)
+		}
+		return ec
+	}
+	return c
+}
+
+// admitsPrereleases reports whether the policy admits prereleases, beyond those
+// the semver package does, under the semver constraint c.
+func (p PrereleasePolicy) admitsPrereleases(c semver.Constraint) bool {
+	switch p {
+	case AllowPrereleases:
+		return true
+	case AllowRequestedPrereleases:
+		// Neither the operators nor the numeric parts of a constraint's
+		// canonical form contain a hyphen, so a hyphen can only be part of
+		// a prerelease - hyphenated ranges are canonicalized into >= and <=.
+		return strings.Contains(c.String(), "-")
+	}
+	return false
+}
+
+// admitsPrerelease reports whether the prerelease sv precedes a release that c
+// admits, and lies within the bounds of c, disregarding the semver package's
+// rule that ranges omit prereleases.
+func admitsPrerelease(c semver.Constraint, sv semver.Version) bool {
+	release, err := semver.NewVersion(fmt.Sprintf("%d.%d.%d", sv.Major(), sv.Minor(), sv.Patch()))
+	if err != nil || c.Matches(release) != nil {
+		return false
+	}
+
+	// Intersecting ranges only compares their bounds, so narrowing c to the
+	// bounds [sv, sv] leaves something if and only if sv lies within it.
+	ge, err := semver.NewConstraint(">=" + sv.String())
+	if err != nil {
+		return false
+	}
+	le, err := semver.NewConstraint("<=" + sv.String())
+	if err != nil {
+		return false
+	}
+	return !semver.IsNone(c.Intersect(ge).Intersect(le))
+}
+
+// overrideAll returns the working constraints for the provided ones, as
+// overridden by the root project, with the solve's prerelease policy applied.
+func (rd rootdata) overrideAll(pc ProjectConstraints) []workingConstraint {
+	wcs := rd.ovr.overrideAll(pc)
+	if rd.pre != ExcludePrereleases {
+		for i := range wcs {
+			wcs[i].Constraint = WithPrereleasePolicy(wcs[i].Constraint, rd.pre)
+		}
+	}
+	return wcs
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "testing"
+
+func TestPrereleasePolicyMatches(t *testing.T) {
+	for _, test := range []struct {
+		c                         string
+		v                         string
+		exclude, requested, allow bool
+	}{
+		{"^1.0.0", "1.0.0", true, true, true},
+		{"^1.0.0", "1.1.0-rc.1", false, false, true},
+		{"^1.0.0", "2.0.0-rc.1", false, false, false},
+		{"^1.0.0", "1.0.0-rc.1", false, false, false},
+		{"^1.1.0-rc.1", "1.1.0-rc.2", true, true, true},
+		{"^1.1.0-rc.1", "1.2.0-rc.1", false, true, true},
+		{"^1.0.0-0", "1.1.0-rc.1", false, true, true},
+		{">=1.1.0-rc.1, <2.0.0", "1.1.0-rc.1", true, true, true},
+		{">=1.1.0-rc.1, <2.0.0", "1.3.0-beta", false, true, true},
+		{">=1.1.0-rc.1, <2.0.0", "1.1.0-alpha", false, false, false},
+		{"^1.0.0 || ^3.0.0", "3.1.0-rc.1", false, false, true},
+		{"^1.0.0, !=1.1.0", "1.1.0-rc.1", false, false, false},
+	} {
+		c := testSemverConstraint(t, test.c)
+		v := NewVersion(test.v)
+		for p, want := range map[PrereleasePolicy]bool{
+			ExcludePrereleases:        test.exclude,
+			AllowRequestedPrereleases: test.requested,
+			AllowPrereleases:          test.allow,
+		} {
+			pc := WithPrereleasePolicy(c, p)
+			if got := pc.Matches(v); got != want {
+				t.Errorf("expected %s to admit %s under %s to be %v", test.c, test.v, p, want)
+			}
+			if got := pc.Matches(v.Pair("abc123")); got != want {
+				t.Errorf("expected %s to admit %s paired under %s to be %v", test.c, test.v, p, want)
+			}
+			if got := pc.Intersect(v) != none; got != want {
+				t.Errorf("expected %s to intersect %s under %s to be %v", test.c, test.v, p, want)
+			}
+		}
+	}
+
+	for _, p := range []PrereleasePolicy{ExcludePrereleases, AllowRequestedPrereleases, AllowPrereleases} {
+		if got, err := ParsePrereleasePolicy(p.String()); err != nil || got != p {
+			t.Errorf("expected %q to parse back to itself, got %v (%v)", p, got, err)
+		}
+	}
+	if _, err := ParsePrereleasePolicy("sometimes"); err == nil {
+		t.Error("expected an error parsing an unknown policy")
+	}
+}
+
+func TestPrereleasePolicyConstraints(t *testing.T) {
+	rc := NewVersion("1.1.0-rc.1")
+	allow := WithPrereleasePolicy(testSemverConstraint(t, "^1.0.0"), AllowPrereleases)
+	exclude := testSemverConstraint(t, ">=1.0.0, <1.5.0")
+
+	if allow.identical(testSemverConstraint(t, "^1.0.0")) || allow.typedString() == testSemverConstraint(t, "^1.0.0").typedString() {
+		t.Error("expected constraints with different policies to be distinct")
+	}
+	if i := allow.Intersect(exclude); i.Matches(rc) {
+		t.Errorf("expected the intersection %s to follow the stricter policy", i)
+	}
+	if i := allow.Intersect(WithPrereleasePolicy(exclude, AllowPrereleases)); !i.Matches(rc) {
+		t.Errorf("expected the intersection %s to keep the common policy", i)
+	}
+	if u := Union(allow, NewBranch("master")); !u.Matches(rc) {
+		t.Errorf("expected the union %s to keep the policy", u)
+	}
+	if e := WithPrereleasePolicy(Exclude(testSemverConstraint(t, "^1.0.0"), NewVersion("1.2.0")), AllowPrereleases); !e.Matches(rc) || e.Matches(NewVersion("1.2.0")) {
+		t.Errorf("expected the exclusion %s to keep its exclusions and take the policy", e)
+	}
+	if IsSubsetOf(allow, exclude) {
+		t.Error("expected a constraint admitting prereleases not to be a subset of one that does not")
+	}
+	if b := NewBranch("master"); WithPrereleasePolicy(b, AllowPrereleases) != b {
+		t.Error("expected a branch to be returned as it is")
+	}
+}
+
+func TestPrereleasePolicySolve(t *testing.T) {
+	ds := []depspec{
+		mkDepspec("root 0.0.0", "a ^1.0.0", "b ^1.0.0-0"),
+		mkDepspec("a 0.9.0"),
+		mkDepspec("a 1.0.0"),
+		mkDepspec("a 1.1.0-rc.1"),
+		mkDepspec("b 0.9.0"),
+		mkDepspec("b 1.1.0-rc.1"),
+	}
+
+	for _, test := range []struct {
+		pol  PrereleasePolicy
+		r    map[ProjectIdentifier]LockedProject
+		fail bool
+	}{
+		{pol: ExcludePrereleases, fail: true},
+		// Releases are preferred to prereleases, even where both are
+		// admissible.
+		{pol: AllowRequestedPrereleases, r: mksolution("a 1.0.0", "b 1.1.0-rc.1")},
+		{pol: AllowPrereleases, r: mksolution("a 1.0.0", "b 1.1.0-rc.1")},
+	} {
+		t.Run(test.pol.String(), func(t *testing.T) {
+			fix := basicFixture{ds: ds, r: test.r}
+			params := basicFixtureParams(fix)
+			params.Prereleases = test.pol
+
+			soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+			if test.fail {
+				if err == nil {
+					t.Fatalf("expected the solve to fail, got %v", soln.Projects())
+				}
+				return
+			}
+			fixtureSolveSimpleChecks(fix, soln, err, t)
+		})
+	}
+}
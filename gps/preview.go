@@ -0,0 +1,141 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SolvePreview is the best partial assignment that a SteppingSolver has found
+// so far, along with how much of the search it covers, and how likely it is to
+// hold up as the search carries on.
+type SolvePreview struct {
+	// Projects holds the projects selected so far, sorted by identifier.
+	Projects []LockedProject
+
+	// Unresolved holds the projects known to be needed that have yet to be
+	// selected. More may become known as the search carries on.
+	Unresolved []ProjectIdentifier
+
+	// Coverage is the fraction of the projects known to be needed that have
+	// been selected.
+	Coverage float64
+
+	// Confidence is the fraction of the selected projects that were selected
+	// at the first version tried for them. Where the search has had to try
+	// other versions to work around conflicts, it is more likely to come to
+	// revise its selections again.
+	Confidence float64
+
+	// Attempts is the number of times the search had backtracked and moved
+	// forward again.
+	Attempts int
+
+	// Complete indicates that the search has finished with a solution, of
+	// which Projects are the projects; Coverage and Confidence are then 1.
+	Complete bool
+}
+
+func (s *solver) Preview() SolvePreview {
+	p := SolvePreview{Attempts: s.attempts}
+	if len(s.sel.projects) == 0 {
+		// Nothing, not even the root, has been selected yet.
+		return p
+	}
+
+	for pa, pl := range s.selectedAtoms() {
+		p.Projects = append(p.Projects, pa2lp(pa, pl))
+	}
+	p.Projects = sortLockedProjects(p.Projects)
+
+	seen := make(map[ProjectRoot]bool)
+	for _, bmi := range s.unsel.sl {
+		if _, is := s.sel.selected(bmi.id); is || seen[bmi.id.ProjectRoot] {
+			continue
+		}
+		seen[bmi.id.ProjectRoot] = true
+		p.Unresolved = append(p.Unresolved, bmi.id)
+	}
+
+	if n := len(p.Projects) + len(p.Unresolved); n > 0 {
+		p.Coverage = float64(len(p.Projects)) / float64(n)
+	}
+	var firsts int
+	for _, q := range s.vqs {
+		if len(q.fails) == 0 {
+			firsts++
+		}
+	}
+	if len(s.vqs) > 0 {
+		p.Confidence = float64(firsts) / float64(len(s.vqs))
+	}
+	return p
+}
+
+// QuickSolveResult is the outcome of a search continued in the background by
+// QuickSolve.
+type QuickSolveResult struct {
+	Solution Solution
+	Err      error
+}
+
+// QuickSolve steps the solver until it either finishes or the budget elapses,
+// and returns a preview of the best partial assignment found by then, so that
+// interactive tools can show something promptly. The search carries on in
+// the background regardless; its outcome is sent on the returned channel,
+// which is then closed.
+//
+// The solver must not otherwise be used once passed to QuickSolve. Canceling
+// the context ends the search with an error.
+func QuickSolve(ctx context.Context, s SteppingSolver, budget time.Duration) (SolvePreview, <-chan QuickSolveResult) {
+	var mu sync.Mutex
+	latest := s.Preview()
+	finished := make(chan struct{})
+	res := make(chan QuickSolveResult, 1)
+
+	go func() {
+		defer close(res)
+		for {
+			r, err := s.Step(ctx)
+			if err != nil {
+				close(finished)
+				res <- QuickSolveResult{Err: err}
+				return
+			}
+			if r.Kind == StepDone {
+				mu.Lock()
+				latest = SolvePreview{
+					Projects:   sortLockedProjects(r.Solution.Projects()),
+					Coverage:   1,
+					Confidence: 1,
+					Attempts:   r.Solution.Attempts(),
+					Complete:   true,
+				}
+				mu.Unlock()
+				close(finished)
+				res <- QuickSolveResult{Solution: r.Solution}
+				return
+			}
+
+			p := s.Preview()
+			mu.Lock()
+			latest = p
+			mu.Unlock()
+		}
+	}()
+
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-finished:
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return latest, res
+}
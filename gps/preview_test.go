@@ -0,0 +1,93 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSolvePreview(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b *"),
+			mkDepspec("a 1.0.0", "c 1.0.0"),
+			mkDepspec("a 2.0.0", "c 2.0.0"),
+			mkDepspec("b 1.0.0", "c 1.0.0"),
+			mkDepspec("b 1.1.0", "c 1.0.0"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("c 2.0.0"),
+		},
+		r: mksolution("a 1.0.0", "b 1.1.0", "c 1.0.0"),
+	}
+	params := basicFixtureParams(fix)
+
+	s := fixStepper(params, newdepspecSM(fix.ds, nil), t)
+	if p := s.Preview(); len(p.Projects) != 0 || p.Coverage != 0 || p.Complete {
+		t.Errorf("expected an empty preview before any steps, got %+v", p)
+	}
+
+	r, err := s.Step(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := s.Preview()
+	if len(p.Projects) != 1 || p.Projects[0].Ident() != r.Project {
+		t.Fatalf("expected only %s to have been selected, got %v", r.Project, p.Projects)
+	}
+	if len(p.Unresolved) != 2 {
+		t.Errorf("expected two unresolved projects, got %v", p.Unresolved)
+	}
+	if p.Coverage != 1.0/3 || p.Confidence != 1 {
+		t.Errorf("expected coverage of 1/3 with full confidence, got %v and %v", p.Coverage, p.Confidence)
+	}
+
+	// a@2.0.0 conflicts with every version of b, so once the search has
+	// backtracked to a@1.0.0, a was not selected at the first version tried.
+	for r.Kind != StepBacktracked {
+		if r, err = s.Step(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p = s.Preview(); p.Attempts == 0 || p.Confidence >= 1 {
+		t.Errorf("expected reduced confidence after backtracking, got %+v", p)
+	}
+}
+
+func TestQuickSolve(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b *"),
+			mkDepspec("a 1.0.0", "c 1.0.0"),
+			mkDepspec("b 1.0.0"),
+			mkDepspec("c 1.0.0"),
+		},
+		r: mksolution("a 1.0.0", "b 1.0.0", "c 1.0.0"),
+	}
+	params := basicFixtureParams(fix)
+
+	// With ample time, the preview is of the whole solution.
+	s := fixStepper(params, newdepspecSM(fix.ds, nil), t)
+	p, res := QuickSolve(context.Background(), s, time.Minute)
+	if !p.Complete || len(p.Projects) != 3 || p.Coverage != 1 || p.Confidence != 1 {
+		t.Errorf("expected a complete preview, got %+v", p)
+	}
+	result := <-res
+	fixtureSolveSimpleChecks(fix, result.Solution, result.Err, t)
+	if _, open := <-res; open {
+		t.Error("expected the result channel to be closed after the result")
+	}
+
+	// Without any, the preview may be partial, but the search still finishes
+	// in the background.
+	s = fixStepper(params, newdepspecSM(fix.ds, nil), t)
+	p, res = QuickSolve(context.Background(), s, 0)
+	if !p.Complete && len(p.Projects) > 3 {
+		t.Errorf("expected a partial preview to be of some of the solution, got %+v", p)
+	}
+	result = <-res
+	fixtureSolveSimpleChecks(fix, result.Solution, result.Err, t)
+}
@@ -0,0 +1,514 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/golang/dep/internal/fs"
+	"github.com/pkg/errors"
+)
+
+// A registry is an HTTP server from which the versions and trees of projects
+// can be retrieved in place of from their repositories, such as an internal
+// artifact server that build machines can reach when the projects' upstreams
+// cannot. SourceManagerConfig.SourceRegistries names the registries for the
+// projects beneath each of a set of prefixes; a project's location in its
+// registry is the registry's URL followed by the project's root, in full.
+//
+// A registry serves two resources for each project it holds:
+//
+//	GET <location>/@versions
+//
+// returns the project's versions as a JSON object, such as
+//
+//	{"versions": [
+//		{"name": "master", "revision": "a1b2...", "branch": true, "default": true},
+//		{"name": "v1.0.0", "revision": "c3d4..."}
+//	]}
+//
+// in which each version is a tag unless it is marked as a branch, and
+//
+//	GET <location>/@archive/<revision>.tar.gz
+//
+// returns a gzipped tarball of the project's tree at one of the revisions, with
+// the paths of its files relative to the project's root.
+//
+// A registry responds to requests for a project it does not hold with a 404 or
+// 410 status, in which case the project is retrieved from its repository
+// instead, as it would be without a registry.
+
+// registryVersion is a version of a project, as listed by a registry.
+type registryVersion struct {
+	Name     string   `json:"name"`
+	Revision Revision `json:"revision"`
+	Branch   bool     `json:"branch,omitempty"`
+	Default  bool     `json:"default,omitempty"`
+}
+
+type registryVersionList struct {
+	Versions []registryVersion `json:"versions"`
+}
+
+const (
+	registryVersionsFile = "versions.json"
+	registryTreesDir     = "trees"
+)
+
+// registrySources returns mb, preceded by a source for the project with the
+// provided root, deduced from path, in the registry with the longest prefix of
+// root, if there is one. Paths that name a scheme explicitly are not retrieved
+// from registries, and nor are private ones from registries that are not
+// reached over https.
+func registrySources(registries []sourceMirror, path, root string, private bool, mb maybeSources) maybeSources {
+	if len(registries) == 0 {
+		return mb
+	}
+	if u, _, err := normalizeURI(path); err != nil || u.Scheme != "" {
+		return mb
+	}
+
+	reg := longestMirror(registries, root)
+	if reg == nil || (private && reg.base.Scheme != "https") {
+		return mb
+	}
+
+	u := *reg.base
+	u.Path += "/" + root
+	return append(maybeSources{maybeRegistrySource{url: &u}}, mb...)
+}
+
+type maybeRegistrySource struct {
+	url *url.URL
+}
+
+func (m maybeRegistrySource) try(ctx context.Context, cd cacheDir, ss sourceSettings) (source, error) {
+	return &registrySource{
+		url:      m.url,
+		path:     cd.sourcePath(m.url.String()),
+		settings: ss,
+	}, nil
+}
+
+func (m maybeRegistrySource) URL() *url.URL {
+	return m.url
+}
+
+func (m maybeRegistrySource) String() string {
+	return fmt.Sprintf("%T: %s", m, ufmt(m.url))
+}
+
+// registrySource is a project held by a registry. Its local copy holds the
+// project's version list, as last retrieved, and the trees of the revisions
+// that have been needed so far, each of which is only ever retrieved once.
+type registrySource struct {
+	url      *url.URL
+	path     string
+	settings sourceSettings
+}
+
+func (s *registrySource) sourceType() string {
+	return "registry"
+}
+
+func (s *registrySource) localPath() string {
+	return s.path
+}
+
+func (s *registrySource) existsLocally(ctx context.Context) bool {
+	_, err := os.Stat(filepath.Join(s.path, registryVersionsFile))
+	return err == nil
+}
+
+func (s *registrySource) existsUpstream(ctx context.Context) bool {
+	_, err := s.fetchVersions(ctx)
+	return err == nil
+}
+
+func (*registrySource) existsCallsListVersions() bool {
+	return true
+}
+
+func (*registrySource) listVersionsRequiresLocal() bool {
+	return false
+}
+
+func (*registrySource) listsVersionsOffline() bool {
+	return true
+}
+
+func (*registrySource) guardsOwnNetworkOps() bool {
+	return true
+}
+
+func (s *registrySource) upstreamURL() string {
+	return s.url.String()
+}
+
+func (s *registrySource) initLocal(ctx context.Context) error {
+	_, err := s.fetchVersions(ctx)
+	return err
+}
+
+func (s *registrySource) updateLocal(ctx context.Context) error {
+	_, err := s.fetchVersions(ctx)
+	return err
+}
+
+func (s *registrySource) maybeClean(ctx context.Context) error {
+	return nil
+}
+
+func (s *registrySource) listVersions(ctx context.Context) ([]PairedVersion, error) {
+	var rvl registryVersionList
+	var err error
+	if s.settings.offline {
+		if !s.existsLocally(ctx) {
+			return nil, newOfflineError(s.upstreamURL(), ctListVersions)
+		}
+		rvl, err = s.localVersions()
+	} else {
+		rvl, err = s.fetchVersions(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pvl := make([]PairedVersion, 0, len(rvl.Versions))
+	for _, rv := range rvl.Versions {
+		var v UnpairedVersion
+		switch {
+		case rv.Branch && rv.Default:
+			v = newDefaultBranch(rv.Name)
+		case rv.Branch:
+			v = NewBranch(rv.Name)
+		default:
+			v = NewVersion(rv.Name)
+		}
+		pvl = append(pvl, v.Pair(rv.Revision))
+	}
+	return pvl, nil
+}
+
+func (s *registrySource) getManifestAndLock(ctx context.Context, pr ProjectRoot, r Revision, an ProjectAnalyzer) (Manifest, Lock, error) {
+	dir, err := s.tree(ctx, r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, l, err := an.DeriveManifestAndLock(dir, pr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if l != nil && l != Lock(nil) {
+		l = prepLock(l)
+	}
+
+	return prepManifest(m), l, nil
+}
+
+func (s *registrySource) listPackages(ctx context.Context, pr ProjectRoot, r Revision) (pkgtree.PackageTree, error) {
+	dir, err := s.tree(ctx, r)
+	if err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	return pkgtree.ListPackages(dir, string(pr))
+}
+
+// revisionPresentIn reports whether the revision is among those last listed by
+// the registry, or its tree has already been retrieved.
+func (s *registrySource) revisionPresentIn(r Revision) (bool, error) {
+	if _, err := os.Stat(s.treePath(r)); err == nil {
+		return true, nil
+	}
+
+	rvl, err := s.localVersions()
+	if err != nil {
+		return false, nil
+	}
+	for _, rv := range rvl.Versions {
+		if rv.Revision == r {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// disambiguateRevision expands r, if it is the prefix of exactly one of the
+// revisions last listed by the registry. Registries know nothing of revisions
+// that their versions are not at.
+func (s *registrySource) disambiguateRevision(ctx context.Context, r Revision) (Revision, error) {
+	rvl, err := s.localVersions()
+	if err != nil {
+		return "", err
+	}
+
+	var match Revision
+	for _, rv := range rvl.Versions {
+		if rv.Revision == r {
+			return r, nil
+		}
+	}
+	for _, rv := range rvl.Versions {
+		if strings.HasPrefix(string(rv.Revision), string(r)) {
+			if match != "" && match != rv.Revision {
+				return "", errors.Errorf("revision %s is ambiguous in %s", r, redactURL(s.upstreamURL()))
+			}
+			match = rv.Revision
+		}
+	}
+	if match == "" {
+		return "", errors.Errorf("revision %s is not listed by %s", r, redactURL(s.upstreamURL()))
+	}
+	return match, nil
+}
+
+func (s *registrySource) exportRevisionTo(ctx context.Context, r Revision, to string) error {
+	dir, err := s.tree(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	// Only make the parent dir, as CopyDir will balk on trying to write to an
+	// empty but existing dir.
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+	return fs.CopyDir(dir, to)
+}
+
+// localVersions reads the version list last retrieved from the registry.
+func (s *registrySource) localVersions() (registryVersionList, error) {
+	var rvl registryVersionList
+	b, err := ioutil.ReadFile(filepath.Join(s.path, registryVersionsFile))
+	if err != nil {
+		return rvl, err
+	}
+	err = json.Unmarshal(b, &rvl)
+	return rvl, errors.Wrapf(err, "corrupt version list for %s", redactURL(s.upstreamURL()))
+}
+
+// fetchVersions retrieves the project's version list from the registry, and
+// keeps it in the local copy.
+func (s *registrySource) fetchVersions(ctx context.Context) (registryVersionList, error) {
+	var rvl registryVersionList
+	var b []byte
+	u := s.upstreamURL() + "/@versions"
+	err := networkOp(s.settings, u, ctListVersions, func(ctx context.Context) error {
+		body, err := registryGet(ctx, s.settings.vcs.creds, u)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		b, err = ioutil.ReadAll(body)
+		return errors.Wrapf(err, "failed to read %s", redactURL(u))
+	})(ctx)
+	if err != nil {
+		return rvl, err
+	}
+	if err = json.Unmarshal(b, &rvl); err != nil {
+		return rvl, errors.Wrapf(err, "invalid version list from %s", redactURL(u))
+	}
+
+	if err = os.MkdirAll(s.path, 0777); err != nil {
+		return rvl, err
+	}
+	// Write to a temporary file first, so that the list is never seen partly
+	// written.
+	lpath := filepath.Join(s.path, registryVersionsFile)
+	tmp := fmt.Sprintf("%s.%d.tmp", lpath, os.Getpid())
+	if err = ioutil.WriteFile(tmp, b, 0666); err != nil {
+		return rvl, err
+	}
+	if err = os.Rename(tmp, lpath); err != nil {
+		os.Remove(tmp)
+		return rvl, err
+	}
+	return rvl, nil
+}
+
+func (s *registrySource) treePath(r Revision) string {
+	return filepath.Join(s.path, registryTreesDir, string(r))
+}
+
+// tree returns the directory holding the project's tree at the revision,
+// retrieving it from the registry if it has not been already.
+func (s *registrySource) tree(ctx context.Context, r Revision) (string, error) {
+	if r == "" || r == "." || r == ".." || strings.ContainsAny(string(r), `/\`) {
+		return "", errors.Errorf("invalid revision %q for %s", r, redactURL(s.upstreamURL()))
+	}
+
+	dir := s.treePath(r)
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	u := s.upstreamURL() + "/@archive/" + url.PathEscape(string(r)) + ".tar.gz"
+	err := networkOp(s.settings, u, ctSourceFetch, func(ctx context.Context) error {
+		body, err := registryGet(ctx, s.settings.vcs.creds, u)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		if err := os.MkdirAll(filepath.Dir(dir), 0777); err != nil {
+			return err
+		}
+		tmp, err := ioutil.TempDir(filepath.Dir(dir), ".tmp-")
+		if err != nil {
+			return err
+		}
+		if err := extractTarGz(body, tmp); err != nil {
+			os.RemoveAll(tmp)
+			return errors.Wrapf(err, "invalid archive from %s", redactURL(u))
+		}
+		// The tree only appears once it is complete.
+		return errors.Wrap(fs.RenameWithFallback(tmp, dir), "failed to keep archive")
+	})(ctx)
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// registryGet makes a GET request of a registry, returning the body of its
+// response, which must be closed, if it succeeds. A registry that does not hold
+// the requested resource responds with ErrRepositoryNotFound.
+//
+// Requests made over https carry the credentials for the registry's host, if
+// there are any.
+func registryGet(ctx context.Context, creds *vcsCredentials, u string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to build HTTP request for URL %q", redactURL(u))
+	}
+	if auth := creds.authHeader(req.URL.Host); auth != "" && req.URL.Scheme == "https" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed HTTP request to URL %q", redactURL(u))
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound, http.StatusGone:
+		resp.Body.Close()
+		return nil, errors.Wrapf(ErrRepositoryNotFound, "%s", redactURL(u))
+	case http.StatusUnauthorized, http.StatusForbidden:
+		resp.Body.Close()
+		return nil, &AuthenticationError{Remote: redactURL(u), Output: resp.Status}
+	}
+	resp.Body.Close()
+	return nil, errors.Errorf("unexpected status %q from %s", resp.Status, redactURL(u))
+}
+
+// extractTarGz extracts the directories, regular files and symbolic links in
+// the gzipped tarball read from r into dir. It fails on entries that would be
+// placed outside of dir, on links that point outside of it, and on entries
+// within links, which could otherwise follow a chain of links out of dir.
+func extractTarGz(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "." {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return errors.Errorf("%q is outside of the archive's root", hdr.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err = checkNoLinkParents(dir, name); err != nil {
+			return errors.Wrapf(err, "%q cannot be extracted", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0777)
+		case tar.TypeReg:
+			err = extractFile(tr, target, os.FileMode(hdr.Mode)&os.ModePerm)
+		case tar.TypeSymlink:
+			dest := path.Join(path.Dir(name), hdr.Linkname)
+			if path.IsAbs(hdr.Linkname) || dest == ".." || strings.HasPrefix(dest, "../") {
+				return errors.Errorf("%q links outside of the archive's root", hdr.Name)
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0777); err == nil {
+				err = os.Symlink(hdr.Linkname, target)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkNoLinkParents fails if any of the directories leading to the
+// slash-separated name within dir, which have been extracted so far, is a
+// symbolic link.
+func checkNoLinkParents(dir, name string) error {
+	p := dir
+	for _, elem := range strings.Split(path.Dir(name), "/") {
+		if elem == "." {
+			break
+		}
+		p = filepath.Join(p, elem)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			rel, _ := filepath.Rel(dir, p)
+			return errors.Errorf("%s is a symbolic link", filepath.ToSlash(rel))
+		}
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode|0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,228 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// mkTarGz returns a gzipped tarball of the files, keyed by their names.
+func mkTarGz(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRegistrySource(t *testing.T) {
+	const rev = Revision("30a7bf6d4bc213824bc6400e22f9967ea1b46c63")
+	archive := mkTarGz(t, map[string]string{
+		"foo.go":     "package foo\n\nimport \"github.com/regtest/bar\"\n",
+		"sub/sub.go": "package sub\n",
+	})
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/reg/github.com/regtest/foo/@versions":
+			fmt.Fprintf(w, `{"versions": [{"name": "master", "revision": %q, "branch": true, "default": true}, {"name": "v1.0.0", "revision": %q}]}`, rev, rev)
+		case "/reg/github.com/regtest/foo/@archive/" + string(rev) + ".tar.gz":
+			w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cpath, err := ioutil.TempDir("", "smcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cpath)
+
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir:         cpath,
+		SourceRegistries: "github.com/regtest=" + srv.URL + "/reg/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	// The registry is tried before the project's repository.
+	urls, err := sm.SourceURLsForPath("github.com/regtest/foo/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) < 2 || urls[0].String() != srv.URL+"/reg/github.com/regtest/foo" || urls[1].Host != "github.com" {
+		t.Errorf("expected the registry to precede the repository, got %v", urls)
+	}
+
+	id := mkPI("github.com/regtest/foo")
+	vl, err := sm.ListVersions(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortPairedForUpgrade(vl)
+	if len(vl) != 2 || vl[0].String() != "v1.0.0" || vl[1].String() != "master" || vl[0].Revision() != rev {
+		t.Fatalf("unexpected versions from the registry: %v", vl)
+	}
+
+	ptree, err := sm.ListPackages(id, vl[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := ptree.Packages["github.com/regtest/foo"]; p.Err != nil || len(p.P.Imports) != 1 || p.P.Imports[0] != "github.com/regtest/bar" {
+		t.Errorf("unexpected package from the registry's archive: %+v", p)
+	}
+	if _, has := ptree.Packages["github.com/regtest/foo/sub"]; !has {
+		t.Error("expected the registry's archive to contain github.com/regtest/foo/sub")
+	}
+
+	to := filepath.Join(cpath, "export")
+	if err = sm.ExportProject(context.Background(), id, vl[1], to); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(to, "sub", "sub.go")); err != nil {
+		t.Errorf("expected the exported tree to contain sub/sub.go: %s", err)
+	}
+
+	var archives int
+	for _, p := range requests {
+		if filepath.Ext(p) == ".gz" {
+			archives++
+		}
+	}
+	if archives != 1 {
+		t.Errorf("expected the archive to be retrieved once, got %d requests", archives)
+	}
+
+	// Projects the registry lacks are retrieved from their repositories.
+	if _, err = registryGet(context.Background(), nil, srv.URL+"/reg/github.com/regtest/missing/@versions"); errors.Cause(err) != ErrRepositoryNotFound {
+		t.Errorf("expected a missing project to be reported as not found, got %v", err)
+	}
+}
+
+func TestExtractTarGzOutsideRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"../evil.go", "/evil.go", "a/../../evil.go"} {
+		archive := mkTarGz(t, map[string]string{name: "package evil\n"})
+		if err := extractTarGz(bytes.NewReader(archive), dir); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+
+	// Each link stays within the root where it is placed in the archive, but
+	// together they lead out of it.
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, hdr := range []*tar.Header{
+		{Name: "a/b/c", Linkname: "../..", Typeflag: tar.TypeSymlink},
+		{Name: "a/b/c/x/y", Mode: 0755, Typeflag: tar.TypeDir},
+		{Name: "a/b/c/x/y/z", Linkname: "../../../..", Typeflag: tar.TypeSymlink},
+		{Name: "a/b/c/x/y/z/evil", Mode: 0644, Typeflag: tar.TypeReg},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(dir, "chain", "root")
+	if err := os.MkdirAll(root, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := extractTarGz(&buf, root); err == nil {
+		t.Error("expected entries within links to be rejected")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "chain", "evil")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be extracted outside the root, got %v", err)
+	}
+}
+
+func TestRegistrySourceNetworkSettings(t *testing.T) {
+	const token = "Basic eC1hY2Nlc3MtdG9rZW46dG9r"
+	var failed bool
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"versions": [{"name": "v1.0.0", "revision": "30a7bf6d4bc213824bc6400e22f9967ea1b46c63"}]}`)
+	}))
+	defer srv.Close()
+
+	// The test server's certificate is self-signed.
+	defer func(c *http.Client) { http.DefaultClient = c }(http.DefaultClient)
+	http.DefaultClient = srv.Client()
+
+	cpath, err := ioutil.TempDir("", "smcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cpath)
+
+	sm, err := NewSourceManager(SourceManagerConfig{
+		Cachedir:         cpath,
+		SourceRegistries: "github.com/regtest=" + srv.URL + "/reg/",
+		Credentials:      VCSCredentials{Tokens: map[string]string{srv.Listener.Addr().String(): "tok"}},
+		Network:          NetworkPolicy{Attempts: 2, Backoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Release()
+
+	vl, err := sm.ListVersions(mkPI("github.com/regtest/foo"))
+	if err != nil {
+		t.Fatalf("expected the version list to be retrieved with credentials on the second attempt, got %v", err)
+	}
+	if len(vl) != 1 || vl[0].String() != "v1.0.0" {
+		t.Errorf("unexpected versions from the registry: %v", vl)
+	}
+}
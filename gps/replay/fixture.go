@@ -0,0 +1,127 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Fixture is a Recording that is declared programmatically, rather than
+// captured from a solve, so that tools built on gps can test their solving
+// logic hermetically. Its fake projects are served by the SourceManager it
+// makes, which satisfies the whole gps.SourceManager interface, and its root
+// project is described by the SolveParameters that Recording.Params returns.
+//
+// For example, a root project that imports a project with two versions, the
+// newer of which depends on yet another project:
+//
+//	f := replay.NewFixture("example.com/root")
+//	f.SetRoot([]replay.Package{{
+//		ImportPath: "example.com/root",
+//		Imports:    []string{"example.com/a"},
+//	}}, replay.Dependency{Name: "example.com/a", Version: "^1.0.0"})
+//	f.AddVersion("example.com/a", replay.Version{Type: "version", Name: "v1.0.0", Revision: "r1"}, nil,
+//		replay.Package{ImportPath: "example.com/a"})
+//	f.AddVersion("example.com/a", replay.Version{Type: "version", Name: "v1.1.0", Revision: "r2"},
+//		[]replay.Dependency{{Name: "example.com/b"}},
+//		replay.Package{ImportPath: "example.com/a", Imports: []string{"example.com/b"}})
+//	f.AddVersion("example.com/b", replay.Version{Type: "branch", Name: "master", Revision: "r3"}, nil,
+//		replay.Package{ImportPath: "example.com/b"})
+type Fixture struct {
+	Recording
+}
+
+// NewFixture creates an empty Fixture for the root project at importRoot.
+func NewFixture(importRoot string) *Fixture {
+	return &Fixture{
+		Recording: Recording{
+			Root: Root{ImportRoot: importRoot},
+		},
+	}
+}
+
+// SetRoot declares the root project's packages and the constraints of its
+// manifest.
+func (f *Fixture) SetRoot(pkgs []Package, deps ...Dependency) {
+	f.Root.Packages = pkgs
+	f.Root.Constraints = deps
+}
+
+// AddVersion declares a version of the named project, and the project's tree
+// at the version's revision: the constraints of its manifest, and its
+// packages, whose import paths are absolute. If a tree was already declared
+// for the revision, it is kept, and the version merely pairs with it.
+func (f *Fixture) AddVersion(project string, v Version, deps []Dependency, pkgs ...Package) {
+	p := f.project(project)
+	p.Versions = append(p.Versions, v)
+	if p.tree(v.Revision) == nil {
+		p.Trees = append(p.Trees, Tree{
+			Revision:    v.Revision,
+			Packages:    pkgs,
+			Constraints: deps,
+		})
+	}
+}
+
+// AddFiles declares the contents of the files of the named project at a
+// revision whose tree has been declared, by slash-separated path relative to
+// the project root, so that the project can be exported.
+func (f *Fixture) AddFiles(project, rev string, files map[string]string) error {
+	var t *Tree
+	if i := f.projectIndex(project); i != -1 {
+		t = f.Projects[i].tree(rev)
+	}
+	if t == nil {
+		return errors.Errorf("no tree was declared for %s at %s", project, rev)
+	}
+
+	if t.Files == nil {
+		t.Files = make(map[string]string, len(files))
+	}
+	for name, content := range files {
+		t.Files[name] = content
+	}
+	return nil
+}
+
+// SetError declares that listing the versions of the named project fails with
+// the message msg.
+func (f *Fixture) SetError(project, msg string) {
+	f.project(project).Error = msg
+}
+
+// SourceManager returns a SourceManager that serves the fixture's projects.
+func (f *Fixture) SourceManager() (*SourceManager, error) {
+	return NewSourceManager(&f.Recording)
+}
+
+func (f *Fixture) projectIndex(name string) int {
+	for i := range f.Projects {
+		if f.Projects[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// project returns the named project, declaring it if need be.
+func (f *Fixture) project(name string) *Project {
+	i := f.projectIndex(name)
+	if i == -1 {
+		f.Projects = append(f.Projects, Project{Name: name})
+		i = len(f.Projects) - 1
+	}
+	return &f.Projects[i]
+}
+
+// tree returns the project's tree at the revision, if it has one.
+func (p *Project) tree(rev string) *Tree {
+	for i := range p.Trees {
+		if p.Trees[i].Revision == rev {
+			return &p.Trees[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/gps"
+	"github.com/pkg/errors"
+)
+
+const (
+	// recordingExt is the extension of recordings in a corpus.
+	recordingExt = ".json"
+	// goldenExt is the extension of the golden file of each recording.
+	goldenExt = ".golden"
+)
+
+// Solve runs the solver against the Recording, replaying its responses.
+func (r *Recording) Solve(ctx context.Context) (gps.Solution, error) {
+	params, err := r.Params()
+	if err != nil {
+		return nil, err
+	}
+	sm, err := NewSourceManager(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := gps.Prepare(params, sm)
+	if err != nil {
+		return nil, err
+	}
+	return s.Solve(ctx)
+}
+
+// FormatSolution renders the outcome of a solve in a stable, line-oriented
+// form suitable for golden files: each selected project with its version,
+// revision and packages, or the error with which solving failed.
+func FormatSolution(soln gps.Solution, err error) []byte {
+	var buf bytes.Buffer
+	if err != nil {
+		fmt.Fprintf(&buf, "solve failed:\n%s\n", strings.TrimSpace(err.Error()))
+		return buf.Bytes()
+	}
+
+	lps := append([]gps.LockedProject(nil), soln.Projects()...)
+	sort.Slice(lps, func(i, j int) bool {
+		return lps[i].Ident().Less(lps[j].Ident())
+	})
+	for _, lp := range lps {
+		id := lp.Ident()
+		fmt.Fprintf(&buf, "%s", id.ProjectRoot)
+		if id.Source != "" {
+			fmt.Fprintf(&buf, " (from %s)", id.Source)
+		}
+
+		v := lp.Version()
+		if pv, ok := v.(gps.PairedVersion); ok {
+			fmt.Fprintf(&buf, " %s %s\n", pv.Unpair(), pv.Revision())
+		} else {
+			fmt.Fprintf(&buf, " %s\n", v)
+		}
+		for _, pkg := range lp.Packages() {
+			fmt.Fprintf(&buf, "\t%s\n", pkg)
+		}
+	}
+	return buf.Bytes()
+}
+
+// CheckGolden solves the recording at path, and compares the formatted
+// outcome against the golden file alongside it, which has the same name with a
+// .golden extension. If update is true, the golden file is instead rewritten
+// with the outcome.
+func CheckGolden(ctx context.Context, path string, update bool) error {
+	r, err := Load(path)
+	if err != nil {
+		return err
+	}
+	got := FormatSolution(r.Solve(ctx))
+
+	golden := strings.TrimSuffix(path, recordingExt) + goldenExt
+	if update {
+		return ioutil.WriteFile(golden, got, 0666)
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return errors.Errorf("solution differs from %s:\n\t(GOT):\n%s\n\t(WNT):\n%s", golden, indent(got), indent(want))
+	}
+	return nil
+}
+
+func indent(b []byte) string {
+	return "\t\t" + strings.Replace(strings.TrimSuffix(string(b), "\n"), "\n", "\n\t\t", -1)
+}
+
+// RunCorpus runs CheckGolden as a subtest for each recording in the directory.
+func RunCorpus(t *testing.T, dir string, update bool) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+recordingExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no recordings found in %s", dir)
+	}
+
+	for _, path := range paths {
+		path := path
+		name := strings.TrimSuffix(filepath.Base(path), recordingExt)
+		t.Run(name, func(t *testing.T) {
+			if err := CheckGolden(context.Background(), path, update); err != nil {
+				if os.IsNotExist(err) {
+					t.Fatalf("%s; run with update set to create it", err)
+				}
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package replay records the information a solver obtains from a
+// SourceManager, and replays it to later solves without touching the network.
+//
+// A Recording captures a dependency graph as the solver saw it. Recordings
+// taken from real projects form a corpus against which the solver can be run
+// repeatedly, with the resulting Solutions compared against golden files to
+// detect changes in its behavior.
+//
+// A Fixture declares such a graph programmatically instead, so that tools
+// built on gps can exercise it against fake projects, hermetically.
+package replay
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// Version types, as recorded in Version.Type.
+const (
+	typeBranch  = "branch"
+	typeVersion = "version"
+)
+
+// Recording is a snapshot of the inputs to a solve: the root project, and every
+// response about other projects that the solver received from its
+// SourceManager.
+type Recording struct {
+	Root     Root      `json:"root"`
+	Projects []Project `json:"projects,omitempty"`
+}
+
+// Root describes the root project of a solve, and the parameters with which
+// it was solved.
+type Root struct {
+	ImportRoot  string          `json:"import-root"`
+	Packages    []Package       `json:"packages"`
+	Constraints []Dependency    `json:"constraints,omitempty"`
+	Overrides   []Dependency    `json:"overrides,omitempty"`
+	Ignored     []string        `json:"ignored,omitempty"`
+	Required    []string        `json:"required,omitempty"`
+	External    []string        `json:"external,omitempty"`
+	Lock        []LockedProject `json:"lock,omitempty"`
+	ToChange    []string        `json:"to-change,omitempty"`
+	ChangeAll   bool            `json:"change-all,omitempty"`
+	Except      []string        `json:"change-all-except,omitempty"`
+	Downgrade   bool            `json:"downgrade,omitempty"`
+	// BuildContexts are the build contexts solved for, in the form parsed by
+	// pkgtree.ParseBuildContext.
+	BuildContexts []string `json:"build-contexts,omitempty"`
+}
+
+// Package is a single package within a project.
+type Package struct {
+	ImportPath  string   `json:"import-path"`
+	Name        string   `json:"name,omitempty"`
+	Imports     []string `json:"imports,omitempty"`
+	TestImports []string `json:"test-imports,omitempty"`
+	// Constrained lists the package's files that are not built in every build
+	// context; see pkgtree.Package.
+	Constrained []ConstrainedFile `json:"constrained,omitempty"`
+	// Error is set instead of the other fields, save ImportPath, if the
+	// package could not be parsed.
+	Error string `json:"error,omitempty"`
+}
+
+// ConstrainedFile is a file of a package that is not built in every build
+// context, with the imports that only it has.
+type ConstrainedFile struct {
+	Name       string   `json:"name"`
+	Constraint string   `json:"constraint,omitempty"`
+	Test       bool     `json:"test,omitempty"`
+	Imports    []string `json:"imports"`
+}
+
+// Dependency is a constraint on a project, as declared in a manifest. At most
+// one of Version and Branch is set; if neither nor Revision is, any version
+// is acceptable.
+type Dependency struct {
+	Name     string `json:"name"`
+	Source   string `json:"source,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// LockedProject is a project pinned in the root project's lock.
+type LockedProject struct {
+	Name     string   `json:"name"`
+	Source   string   `json:"source,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	Branch   string   `json:"branch,omitempty"`
+	Revision string   `json:"revision"`
+	Packages []string `json:"packages"`
+}
+
+// Project holds the recorded responses for a single project.
+type Project struct {
+	Name   string `json:"name"`
+	Source string `json:"source,omitempty"`
+	// Error is the error with which listing the project's versions failed, if
+	// it did.
+	Error    string    `json:"error,omitempty"`
+	Versions []Version `json:"versions,omitempty"`
+	// Trees are the contents of the project at each of the revisions the
+	// solver inspected.
+	Trees []Tree `json:"trees,omitempty"`
+}
+
+// Version is a version of a project, paired with its revision.
+type Version struct {
+	Type     string `json:"type"`
+	Name     string `json:"name,omitempty"`
+	Revision string `json:"revision"`
+}
+
+// Tree is the contents of a project at a revision.
+type Tree struct {
+	Revision    string       `json:"revision"`
+	Packages    []Package    `json:"packages,omitempty"`
+	Constraints []Dependency `json:"constraints,omitempty"`
+	// Files holds the contents of the project's files, by slash-separated
+	// path relative to the project root, if they are known, as they may be
+	// for a Fixture. They are never recorded.
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// Load reads a Recording from the JSON file at path.
+func Load(path string) (*Recording, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(Recording)
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse recording %s", path)
+	}
+	return r, nil
+}
+
+// Save writes the Recording to path as indented JSON.
+func (r *Recording) Save(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0666)
+}
+
+// Params returns parameters for solving the Recording's root project.
+//
+// The RootDir of the parameters is the current directory, which the solver
+// only requires to exist; the root project is described entirely by the
+// Recording.
+func (r *Recording) Params() (gps.SolveParameters, error) {
+	deps, err := toConstraints(r.Root.Constraints)
+	if err != nil {
+		return gps.SolveParameters{}, err
+	}
+	ovr, err := toConstraints(r.Root.Overrides)
+	if err != nil {
+		return gps.SolveParameters{}, err
+	}
+
+	m := rootManifest{
+		deps: deps,
+		ovr:  ovr,
+		ig:   pkgtree.NewIgnoredRuleset(r.Root.Ignored),
+		ext:  pkgtree.NewIgnoredRuleset(r.Root.External),
+		req:  make(map[string]bool, len(r.Root.Required)),
+	}
+	for _, path := range r.Root.Required {
+		m.req[path] = true
+	}
+
+	params := gps.SolveParameters{
+		RootDir:         ".",
+		RootPackageTree: toPackageTree(r.Root.ImportRoot, r.Root.Packages),
+		Manifest:        m,
+		ChangeAll:       r.Root.ChangeAll,
+		Downgrade:       r.Root.Downgrade,
+		ProjectAnalyzer: analyzer{},
+	}
+
+	if len(r.Root.Lock) > 0 {
+		var l gps.SimpleLock
+		for _, lp := range r.Root.Lock {
+			v, err := toVersion(lp.Version, lp.Branch, lp.Revision)
+			if err != nil {
+				return gps.SolveParameters{}, errors.Wrapf(err, "invalid lock entry for %s", lp.Name)
+			}
+			id := gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(lp.Name), Source: lp.Source}
+			l = append(l, gps.NewLockedProject(id, v, lp.Packages))
+		}
+		params.Lock = l
+	}
+	for _, pr := range r.Root.ToChange {
+		params.ToChange = append(params.ToChange, gps.ProjectRoot(pr))
+	}
+	for _, pr := range r.Root.Except {
+		params.ChangeAllExcept = append(params.ChangeAllExcept, gps.ProjectRoot(pr))
+	}
+	for _, s := range r.Root.BuildContexts {
+		c, err := pkgtree.ParseBuildContext(s)
+		if err != nil {
+			return gps.SolveParameters{}, errors.Wrap(err, "invalid build context")
+		}
+		params.BuildContexts = append(params.BuildContexts, c)
+	}
+
+	return params, nil
+}
+
+// rootManifest is the gps.RootManifest of a recorded root project.
+type rootManifest struct {
+	deps, ovr gps.ProjectConstraints
+	ig, ext   *pkgtree.IgnoredRuleset
+	req       map[string]bool
+}
+
+func (m rootManifest) DependencyConstraints() gps.ProjectConstraints { return m.deps }
+func (m rootManifest) Overrides() gps.ProjectConstraints             { return m.ovr }
+func (m rootManifest) IgnoredPackages() *pkgtree.IgnoredRuleset      { return m.ig }
+func (m rootManifest) ExternalPackages() *pkgtree.IgnoredRuleset     { return m.ext }
+func (m rootManifest) RequiredPackages() map[string]bool             { return m.req }
+
+// analyzer is the gps.ProjectAnalyzer used when replaying. Manifests come from
+// the Recording, so it is never asked to derive one.
+type analyzer struct{}
+
+func (analyzer) DeriveManifestAndLock(path string, pr gps.ProjectRoot) (gps.Manifest, gps.Lock, error) {
+	return nil, nil, errors.Errorf("cannot analyze %s while replaying a recording", path)
+}
+
+func (analyzer) Info() gps.ProjectAnalyzerInfo {
+	return gps.ProjectAnalyzerInfo{Name: "replay", Version: 1}
+}
+
+func fromPackageTree(ptree pkgtree.PackageTree) []Package {
+	pkgs := make([]Package, 0, len(ptree.Packages))
+	for path, poe := range ptree.Packages {
+		if poe.Err != nil {
+			pkgs = append(pkgs, Package{ImportPath: path, Error: poe.Err.Error()})
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			ImportPath:  path,
+			Name:        poe.P.Name,
+			Imports:     poe.P.Imports,
+			TestImports: poe.P.TestImports,
+			Constrained: fromConstrainedFiles(poe.P.Constrained),
+		})
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].ImportPath < pkgs[j].ImportPath
+	})
+	return pkgs
+}
+
+func toPackageTree(root string, pkgs []Package) pkgtree.PackageTree {
+	ptree := pkgtree.PackageTree{
+		ImportRoot: root,
+		Packages:   make(map[string]pkgtree.PackageOrErr, len(pkgs)),
+	}
+	for _, pkg := range pkgs {
+		if pkg.Error != "" {
+			ptree.Packages[pkg.ImportPath] = pkgtree.PackageOrErr{Err: errors.New(pkg.Error)}
+			continue
+		}
+		ptree.Packages[pkg.ImportPath] = pkgtree.PackageOrErr{
+			P: pkgtree.Package{
+				Name:        pkg.Name,
+				ImportPath:  pkg.ImportPath,
+				Imports:     pkg.Imports,
+				TestImports: pkg.TestImports,
+				Constrained: toConstrainedFiles(pkg.Constrained),
+			},
+		}
+	}
+	return ptree
+}
+
+func fromConstrainedFiles(cfs []pkgtree.ConstrainedFile) []ConstrainedFile {
+	var out []ConstrainedFile
+	for _, cf := range cfs {
+		out = append(out, ConstrainedFile(cf))
+	}
+	return out
+}
+
+func toConstrainedFiles(cfs []ConstrainedFile) []pkgtree.ConstrainedFile {
+	var out []pkgtree.ConstrainedFile
+	for _, cf := range cfs {
+		out = append(out, pkgtree.ConstrainedFile(cf))
+	}
+	return out
+}
+
+func fromConstraints(pc gps.ProjectConstraints) []Dependency {
+	deps := make([]Dependency, 0, len(pc))
+	for pr, pp := range pc {
+		d := Dependency{Name: string(pr), Source: pp.Source}
+		switch c := pp.Constraint.(type) {
+		case nil:
+		case gps.Version:
+			switch c.Type() {
+			case gps.IsRevision:
+				d.Revision = c.String()
+			case gps.IsBranch:
+				d.Branch = c.String()
+			default:
+				d.Version = c.String()
+			}
+			if pv, ok := c.(gps.PairedVersion); ok {
+				d.Revision = string(pv.Revision())
+			}
+		default:
+			if c != gps.Any() {
+				d.Version = c.String()
+			}
+		}
+		deps = append(deps, d)
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].Name < deps[j].Name
+	})
+	return deps
+}
+
+func toConstraints(deps []Dependency) (gps.ProjectConstraints, error) {
+	pc := make(gps.ProjectConstraints, len(deps))
+	for _, d := range deps {
+		pp := gps.ProjectProperties{Source: d.Source, Constraint: gps.Any()}
+		switch {
+		case d.Version != "" && d.Revision == "":
+			// Ranges and exact semantic versions are both parsed as semver
+			// constraints; anything else is a plain version.
+			if c, err := gps.NewSemverConstraint(d.Version); err == nil {
+				pp.Constraint = c
+			} else {
+				pp.Constraint = gps.NewVersion(d.Version)
+			}
+		case d.Version != "" || d.Branch != "" || d.Revision != "":
+			v, err := toVersion(d.Version, d.Branch, d.Revision)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid constraint on %s", d.Name)
+			}
+			pp.Constraint = v
+		}
+		pc[gps.ProjectRoot(d.Name)] = pp
+	}
+	return pc, nil
+}
+
+// toVersion builds a version from fields in the style of a Gopkg.lock entry.
+func toVersion(version, branch, rev string) (gps.Version, error) {
+	var uv gps.UnpairedVersion
+	switch {
+	case version != "" && branch != "":
+		return nil, errors.New("both a version and a branch are specified")
+	case version != "":
+		uv = gps.NewVersion(version)
+	case branch != "":
+		uv = gps.NewBranch(branch)
+	}
+
+	switch {
+	case rev == "" && uv == nil:
+		return nil, errors.New("no version, branch or revision is specified")
+	case rev == "":
+		return uv, nil
+	case uv == nil:
+		return gps.Revision(rev), nil
+	}
+	return uv.Pair(gps.Revision(rev)), nil
+}
+
+func fromPairedVersion(pv gps.PairedVersion) Version {
+	v := Version{Name: pv.String(), Revision: string(pv.Revision())}
+	switch pv.Type() {
+	case gps.IsBranch:
+		v.Type = typeBranch
+	default:
+		v.Type = typeVersion
+	}
+	return v
+}
+
+func (v Version) toPairedVersion() (gps.PairedVersion, error) {
+	switch v.Type {
+	case typeBranch:
+		return gps.NewBranch(v.Name).Pair(gps.Revision(v.Revision)), nil
+	case typeVersion:
+		return gps.NewVersion(v.Name).Pair(gps.Revision(v.Revision)), nil
+	}
+	return nil, errors.Errorf("unknown version type %q", v.Type)
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep/gps"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestCorpus(t *testing.T) {
+	RunCorpus(t, filepath.Join("testdata", "corpus"), *update)
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	r, err := Load(filepath.Join("testdata", "corpus", "backtrack.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := r.Params()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := NewSourceManager(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := NewRecorder(sm)
+	s, err := gps.Prepare(params, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := FormatSolution(s.Solve(context.Background()))
+
+	// Replaying what was recorded must produce the same solution, without
+	// needing the original SourceManager.
+	rr := rec.Recording(params)
+	if got := FormatSolution(rr.Solve(context.Background())); !bytes.Equal(got, want) {
+		t.Errorf("replayed recording solved differently:\n\t(GOT):\n%s\n\t(WNT):\n%s", got, want)
+	}
+	// Compare serialized forms, as empty and nil lists are equivalent.
+	got, _ := json.Marshal(rr.Root)
+	wnt, _ := json.Marshal(r.Root)
+	if !bytes.Equal(got, wnt) {
+		t.Errorf("root project not recorded faithfully:\n\t(GOT): %s\n\t(WNT): %s", got, wnt)
+	}
+}
+
+func TestDependencyRoundTrip(t *testing.T) {
+	deps := []Dependency{
+		{Name: "example.com/any"},
+		{Name: "example.com/branch", Branch: "master"},
+		{Name: "example.com/paired", Branch: "master", Revision: "abc123"},
+		{Name: "example.com/plain", Version: "foo"},
+		{Name: "example.com/rev", Revision: "abc123"},
+		{Name: "example.com/semver", Source: "https://example.org/semver", Version: "^1.0.0"},
+	}
+	pc, err := toConstraints(deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := toConstraints(fromConstraints(pc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pr, pp := range pc {
+		if !reflect.DeepEqual(rt[pr], pp) {
+			t.Errorf("%s did not survive the round trip: %v became %v", pr, pp, rt[pr])
+		}
+	}
+}
+
+func TestReplayUnrecorded(t *testing.T) {
+	sm, err := NewSourceManager(&Recording{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := gps.ProjectIdentifier{ProjectRoot: "example.com/a"}
+	if _, err := sm.ListVersions(id); err == nil {
+		t.Error("expected an error listing versions of an unrecorded project")
+	}
+	if _, err := sm.VersionsForRevision(id, "abc123"); err == nil {
+		t.Error("expected an error looking up versions of an unrecorded project")
+	}
+	if _, err := sm.DeduceProjectRoot("example.com/a/b"); err == nil {
+		t.Error("expected an error deducing the root of an unrecorded import path")
+	}
+}
+
+func TestFixture(t *testing.T) {
+	f := NewFixture("example.com/root")
+	f.SetRoot([]Package{{
+		ImportPath: "example.com/root",
+		Name:       "root",
+		Imports:    []string{"example.com/a"},
+	}}, Dependency{Name: "example.com/a", Version: "^1.0.0"})
+	f.AddVersion("example.com/a", Version{Type: typeVersion, Name: "v1.0.0", Revision: "r1"}, nil,
+		Package{ImportPath: "example.com/a", Name: "a"})
+	f.AddVersion("example.com/a", Version{Type: typeVersion, Name: "v1.1.0", Revision: "r2"},
+		[]Dependency{{Name: "example.com/b"}},
+		Package{ImportPath: "example.com/a", Name: "a", Imports: []string{"example.com/b"}})
+	f.AddVersion("example.com/b", Version{Type: typeBranch, Name: "master", Revision: "r3"}, nil,
+		Package{ImportPath: "example.com/b", Name: "b"})
+	if err := f.AddFiles("example.com/a", "r2", map[string]string{"a.go": "package a\n"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.AddFiles("example.com/a", "r9", nil); err == nil {
+		t.Error("expected an error adding files to an undeclared tree")
+	}
+
+	sm, err := f.SourceManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := f.Params()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := gps.Prepare(params, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(FormatSolution(s.Solve(context.Background())))
+	want := "example.com/a v1.1.0 r2\n\t.\nexample.com/b master r3\n\t.\n"
+	if got != want {
+		t.Errorf("unexpected solution from fixture:\n\t(GOT):\n%s\n\t(WNT):\n%s", got, want)
+	}
+
+	dir, err := ioutil.TempDir("", "replay-fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	id := gps.ProjectIdentifier{ProjectRoot: "example.com/a"}
+	if err := sm.ExportProject(context.Background(), id, gps.Revision("r2"), dir); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "a.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "package a\n" {
+		t.Errorf("unexpected exported file contents: %q", b)
+	}
+	if err := sm.ExportProject(context.Background(), id, gps.Revision("r1"), dir); err == nil {
+		t.Error("expected an error exporting a tree without files")
+	}
+}
@@ -0,0 +1,490 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// errUnsupported is returned by SourceManager methods that require the
+// contents of a project's files, which are not recorded.
+var errUnsupported = errors.New("operation not supported when replaying a recording")
+
+// SourceManager is a gps.SourceManager that answers all queries from a
+// Recording. Queries that were not recorded fail, as do any operations that
+// require the files of a project, such as exporting it.
+type SourceManager struct {
+	projects map[gps.ProjectIdentifier]*replayProject
+}
+
+var _ gps.SourceManager = &SourceManager{}
+
+type replayProject struct {
+	err   error
+	pvl   []gps.PairedVersion
+	trees map[gps.Revision]replayTree
+}
+
+type replayTree struct {
+	ptree pkgtree.PackageTree
+	m     gps.SimpleManifest
+	files map[string]string
+}
+
+// NewSourceManager creates a SourceManager that replays the Recording.
+func NewSourceManager(r *Recording) (*SourceManager, error) {
+	sm := &SourceManager{
+		projects: make(map[gps.ProjectIdentifier]*replayProject, len(r.Projects)),
+	}
+
+	for _, p := range r.Projects {
+		rp := &replayProject{trees: make(map[gps.Revision]replayTree, len(p.Trees))}
+		if p.Error != "" {
+			rp.err = errors.New(p.Error)
+		}
+		for _, v := range p.Versions {
+			pv, err := v.toPairedVersion()
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid version of %s", p.Name)
+			}
+			rp.pvl = append(rp.pvl, pv)
+		}
+		for _, t := range p.Trees {
+			deps, err := toConstraints(t.Constraints)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid manifest for %s at %s", p.Name, t.Revision)
+			}
+			rp.trees[gps.Revision(t.Revision)] = replayTree{
+				ptree: toPackageTree(p.Name, t.Packages),
+				m:     gps.SimpleManifest{Deps: deps},
+				files: t.Files,
+			}
+		}
+
+		id := gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(p.Name), Source: p.Source}
+		sm.projects[id] = rp
+	}
+
+	return sm, nil
+}
+
+func (sm *SourceManager) project(id gps.ProjectIdentifier) (*replayProject, error) {
+	rp, has := sm.projects[id]
+	if !has {
+		return nil, errors.Errorf("%s was not recorded", id)
+	}
+	return rp, nil
+}
+
+func (sm *SourceManager) tree(id gps.ProjectIdentifier, v gps.Version) (replayTree, error) {
+	rp, err := sm.project(id)
+	if err != nil {
+		return replayTree{}, err
+	}
+
+	if rev, has := revisionOf(rp.pvl, v); has {
+		if t, has := rp.trees[rev]; has {
+			return t, nil
+		}
+	}
+	return replayTree{}, errors.Errorf("%s at %s was not recorded", id, v)
+}
+
+// revisionOf returns the revision of v, looking it up in the list of versions
+// if it is not already paired.
+func revisionOf(pvl []gps.PairedVersion, v gps.Version) (gps.Revision, bool) {
+	switch tv := v.(type) {
+	case gps.Revision:
+		return tv, true
+	case gps.PairedVersion:
+		return tv.Revision(), true
+	}
+
+	for _, pv := range pvl {
+		if pv.Unpair() == v {
+			return pv.Revision(), true
+		}
+	}
+	return "", false
+}
+
+// SourceExists reports whether the project was recorded.
+func (sm *SourceManager) SourceExists(id gps.ProjectIdentifier) (bool, error) {
+	_, has := sm.projects[id]
+	return has, nil
+}
+
+// SyncSourceFor does nothing for recorded projects, as there is nothing to
+// sync.
+func (sm *SourceManager) SyncSourceFor(id gps.ProjectIdentifier) error {
+	_, err := sm.project(id)
+	return err
+}
+
+// ListVersions returns the recorded versions of the project.
+func (sm *SourceManager) ListVersions(id gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	rp, err := sm.project(id)
+	if err != nil {
+		return nil, err
+	}
+	if rp.err != nil {
+		return nil, rp.err
+	}
+	return append([]gps.PairedVersion(nil), rp.pvl...), nil
+}
+
+// VersionsForRevision returns the recorded versions of the project that are
+// paired with the revision, sorted for upgrade.
+func (sm *SourceManager) VersionsForRevision(id gps.ProjectIdentifier, r gps.Revision) ([]gps.UnpairedVersion, error) {
+	rp, err := sm.project(id)
+	if err != nil {
+		return nil, err
+	}
+	if rp.err != nil {
+		return nil, rp.err
+	}
+
+	var matched []gps.PairedVersion
+	for _, pv := range rp.pvl {
+		if pv.Revision() == r {
+			matched = append(matched, pv)
+		}
+	}
+	gps.SortPairedForUpgrade(matched)
+
+	uvs := make([]gps.UnpairedVersion, len(matched))
+	for i, pv := range matched {
+		uvs[i] = pv.Unpair()
+	}
+	return uvs, nil
+}
+
+// RevisionPresentIn reports whether the revision is that of any recorded
+// version or tree of the project.
+func (sm *SourceManager) RevisionPresentIn(id gps.ProjectIdentifier, r gps.Revision) (bool, error) {
+	rp, err := sm.project(id)
+	if err != nil {
+		return false, err
+	}
+	if _, has := rp.trees[r]; has {
+		return true, nil
+	}
+	for _, pv := range rp.pvl {
+		if pv.Revision() == r {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListPackages returns the recorded packages of the project at the version.
+func (sm *SourceManager) ListPackages(id gps.ProjectIdentifier, v gps.Version) (pkgtree.PackageTree, error) {
+	t, err := sm.tree(id, v)
+	if err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	return t.ptree.Copy(), nil
+}
+
+// GetManifestAndLock returns the recorded manifest of the project at the
+// version. Locks are not recorded, as the solver ignores those of
+// dependencies.
+func (sm *SourceManager) GetManifestAndLock(id gps.ProjectIdentifier, v gps.Version, an gps.ProjectAnalyzer) (gps.Manifest, gps.Lock, error) {
+	t, err := sm.tree(id, v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t.m, nil, nil
+}
+
+// ExportProject writes the files of the project at the version to the
+// directory to. It is only supported for trees whose files are known, as
+// those of a Fixture may be.
+func (sm *SourceManager) ExportProject(ctx context.Context, id gps.ProjectIdentifier, v gps.Version, to string) error {
+	t, err := sm.tree(id, v)
+	if err != nil {
+		return err
+	}
+	if t.files == nil {
+		return errUnsupported
+	}
+
+	for name, content := range t.files {
+		path := filepath.Join(to, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportPrunedProject writes the files of the locked project, as
+// ExportProject does, and prunes them with the options.
+func (sm *SourceManager) ExportPrunedProject(ctx context.Context, lp gps.LockedProject, prune gps.PruneOptions, to string) error {
+	if err := sm.ExportProject(ctx, lp.Ident(), lp.Version(), to); err != nil {
+		return err
+	}
+	return gps.PruneProject(to, lp, prune)
+}
+
+// DiffRevisions is not supported when replaying.
+func (sm *SourceManager) DiffRevisions(ctx context.Context, id gps.ProjectIdentifier, from, to gps.Revision, stats bool) ([]gps.FileChange, error) {
+	return nil, errUnsupported
+}
+
+// DeduceProjectRoot returns the longest recorded project root that contains
+// the import path.
+func (sm *SourceManager) DeduceProjectRoot(ip string) (gps.ProjectRoot, error) {
+	var root gps.ProjectRoot
+	for id := range sm.projects {
+		pr := id.ProjectRoot
+		if (ip == string(pr) || strings.HasPrefix(ip, string(pr)+"/")) && len(pr) > len(root) {
+			root = pr
+		}
+	}
+	if root == "" {
+		return "", errors.Errorf("no recorded project contains %s", ip)
+	}
+	return root, nil
+}
+
+// SourceURLsForPath is not supported when replaying.
+func (sm *SourceManager) SourceURLsForPath(ip string) ([]*url.URL, error) {
+	return nil, errUnsupported
+}
+
+// Release does nothing, as a replaying SourceManager holds no resources.
+func (sm *SourceManager) Release() {}
+
+// InferConstraint returns a semver constraint if s parses as one, the version
+// or revision of the project it names if it was recorded, and otherwise a
+// plain version.
+func (sm *SourceManager) InferConstraint(s string, id gps.ProjectIdentifier) (gps.Constraint, error) {
+	if s == "" {
+		return gps.Any(), nil
+	}
+	if c, err := gps.NewSemverConstraintIC(s); err == nil {
+		return c, nil
+	}
+
+	if rp, has := sm.projects[id]; has {
+		for _, pv := range rp.pvl {
+			if pv.String() == s {
+				return pv.Unpair(), nil
+			}
+		}
+		if present, _ := sm.RevisionPresentIn(id, gps.Revision(s)); present {
+			return gps.Revision(s), nil
+		}
+	}
+	return gps.NewVersion(s), nil
+}
+
+// Recorder is a gps.SourceManager that passes all calls through to another
+// SourceManager, recording the responses that a solver relies upon.
+type Recorder struct {
+	gps.SourceManager
+
+	mu       sync.Mutex
+	projects map[gps.ProjectIdentifier]*recordedProject
+}
+
+type recordedProject struct {
+	p     Project
+	trees map[gps.Revision]*Tree
+}
+
+// NewRecorder creates a Recorder that wraps the provided SourceManager.
+func NewRecorder(sm gps.SourceManager) *Recorder {
+	return &Recorder{
+		SourceManager: sm,
+		projects:      make(map[gps.ProjectIdentifier]*recordedProject),
+	}
+}
+
+// project must be called with r.mu held.
+func (r *Recorder) project(id gps.ProjectIdentifier) *recordedProject {
+	rp, has := r.projects[id]
+	if !has {
+		rp = &recordedProject{
+			p:     Project{Name: string(id.ProjectRoot), Source: id.Source},
+			trees: make(map[gps.Revision]*Tree),
+		}
+		r.projects[id] = rp
+	}
+	return rp
+}
+
+// tree must be called with r.mu held.
+func (r *Recorder) tree(id gps.ProjectIdentifier, v gps.Version) (*Tree, bool) {
+	rp := r.project(id)
+	var pvl []gps.PairedVersion
+	for _, v := range rp.p.Versions {
+		if pv, err := v.toPairedVersion(); err == nil {
+			pvl = append(pvl, pv)
+		}
+	}
+
+	rev, has := revisionOf(pvl, v)
+	if !has {
+		return nil, false
+	}
+	t, has := rp.trees[rev]
+	if !has {
+		t = &Tree{Revision: string(rev)}
+		rp.trees[rev] = t
+	}
+	return t, true
+}
+
+// ListVersions records the versions listed by the wrapped SourceManager.
+func (r *Recorder) ListVersions(id gps.ProjectIdentifier) ([]gps.PairedVersion, error) {
+	pvl, err := r.SourceManager.ListVersions(id)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rp := r.project(id)
+	if err != nil {
+		rp.p.Error = err.Error()
+		return pvl, err
+	}
+	rp.p.Error = ""
+	rp.p.Versions = rp.p.Versions[:0]
+	for _, pv := range pvl {
+		rp.p.Versions = append(rp.p.Versions, fromPairedVersion(pv))
+	}
+	return pvl, nil
+}
+
+// ListPackages records the packages listed by the wrapped SourceManager.
+func (r *Recorder) ListPackages(id gps.ProjectIdentifier, v gps.Version) (pkgtree.PackageTree, error) {
+	ptree, err := r.SourceManager.ListPackages(id, v)
+	if err != nil {
+		return ptree, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, has := r.tree(id, v); has {
+		t.Packages = fromPackageTree(ptree)
+	}
+	return ptree, nil
+}
+
+// GetManifestAndLock records the constraints in the manifest returned by the
+// wrapped SourceManager.
+func (r *Recorder) GetManifestAndLock(id gps.ProjectIdentifier, v gps.Version, an gps.ProjectAnalyzer) (gps.Manifest, gps.Lock, error) {
+	m, l, err := r.SourceManager.GetManifestAndLock(id, v, an)
+	if err != nil || m == nil {
+		return m, l, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, has := r.tree(id, v); has {
+		t.Constraints = fromConstraints(m.DependencyConstraints())
+	}
+	return m, l, nil
+}
+
+// Recording returns everything recorded so far, along with the root project
+// described by the parameters, which should be those of the solve run against
+// the Recorder.
+func (r *Recorder) Recording(params gps.SolveParameters) *Recording {
+	root := Root{
+		ImportRoot: params.RootPackageTree.ImportRoot,
+		Packages:   fromPackageTree(params.RootPackageTree),
+		ChangeAll:  params.ChangeAll,
+		Downgrade:  params.Downgrade,
+	}
+	if m := params.Manifest; m != nil {
+		root.Constraints = fromConstraints(m.DependencyConstraints())
+		root.Overrides = fromConstraints(m.Overrides())
+		root.Ignored = m.IgnoredPackages().ToSlice()
+		for path, req := range m.RequiredPackages() {
+			if req {
+				root.Required = append(root.Required, path)
+			}
+		}
+		sort.Strings(root.Required)
+		if em, ok := m.(gps.ExternalManifest); ok {
+			root.External = em.ExternalPackages().ToSlice()
+		}
+	}
+	if params.Lock != nil {
+		for _, lp := range params.Lock.Projects() {
+			root.Lock = append(root.Lock, fromLockedProject(lp))
+		}
+	}
+	for _, pr := range params.ToChange {
+		root.ToChange = append(root.ToChange, string(pr))
+	}
+	for _, pr := range params.ChangeAllExcept {
+		root.Except = append(root.Except, string(pr))
+	}
+	for _, c := range params.BuildContexts {
+		root.BuildContexts = append(root.BuildContexts, c.String())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec := &Recording{Root: root}
+	for _, rp := range r.projects {
+		p := rp.p
+		p.Versions = append([]Version(nil), p.Versions...)
+		for _, t := range rp.trees {
+			p.Trees = append(p.Trees, *t)
+		}
+		sort.Slice(p.Trees, func(i, j int) bool {
+			return p.Trees[i].Revision < p.Trees[j].Revision
+		})
+		rec.Projects = append(rec.Projects, p)
+	}
+	sort.Slice(rec.Projects, func(i, j int) bool {
+		if rec.Projects[i].Name != rec.Projects[j].Name {
+			return rec.Projects[i].Name < rec.Projects[j].Name
+		}
+		return rec.Projects[i].Source < rec.Projects[j].Source
+	})
+	return rec
+}
+
+func fromLockedProject(lp gps.LockedProject) LockedProject {
+	id := lp.Ident()
+	rlp := LockedProject{
+		Name:     string(id.ProjectRoot),
+		Source:   id.Source,
+		Packages: lp.Packages(),
+	}
+
+	v := lp.Version()
+	if pv, ok := v.(gps.PairedVersion); ok {
+		rlp.Revision = string(pv.Revision())
+		v = pv.Unpair()
+	}
+	switch v.Type() {
+	case gps.IsRevision:
+		rlp.Revision = v.String()
+	case gps.IsBranch:
+		rlp.Branch = v.String()
+	default:
+		rlp.Version = v.String()
+	}
+	return rlp
+}
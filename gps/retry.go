@@ -0,0 +1,158 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NetworkPolicy determines how long the SourceManager lets each attempt at a
+// network operation on the upstream of a source - checking that it exists,
+// listing its versions, cloning or fetching it - run, and whether, and how, it
+// retries those that fail. The zero value sets no timeouts and makes a single
+// attempt, as the SourceManager does by default.
+//
+// Failures that another attempt cannot be expected to fix - the repository not
+// existing, access being denied, the SourceManager being offline, or the
+// operation being canceled - are not retried.
+type NetworkPolicy struct {
+	// Timeout bounds each attempt at a network operation, other than those
+	// that the timeouts below apply to. Zero sets no bound.
+	Timeout time.Duration
+	// CloneTimeout bounds each attempt at cloning a source into the cache,
+	// and FetchTimeout each attempt at fetching into an existing clone. They
+	// default to Timeout.
+	CloneTimeout, FetchTimeout time.Duration
+	// Attempts is the greatest number of times an operation is attempted.
+	// Values less than one mean one.
+	Attempts int
+	// Backoff is how long to wait after the first failed attempt, before the
+	// next. The wait doubles after each further failure, up to MaxBackoff,
+	// if it is positive.
+	Backoff, MaxBackoff time.Duration
+}
+
+// NetworkError reports that a network operation failed, under a NetworkPolicy,
+// on every attempt at it. Its Cause is the failure of the last attempt.
+type NetworkError struct {
+	// URL is the network destination of the operation, with any credentials
+	// redacted.
+	URL string
+	// Operation describes the operation, such as fetching go-get metadata or
+	// initializing a local source cache.
+	Operation string
+	// Attempts holds the failure of each attempt, in order.
+	Attempts []error
+}
+
+func (e *NetworkError) Error() string {
+	if len(e.Attempts) == 1 {
+		return fmt.Sprintf("%s from %s failed: %s", e.Operation, e.URL, e.Attempts[0])
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s from %s failed after %d attempts:", e.Operation, e.URL, len(e.Attempts))
+	for i, err := range e.Attempts {
+		fmt.Fprintf(&buf, "\n\tattempt %d: %s", i+1, err)
+	}
+	return buf.String()
+}
+
+// Cause returns the failure of the last attempt.
+func (e *NetworkError) Cause() error {
+	return e.Attempts[len(e.Attempts)-1]
+}
+
+// timeoutFor returns the bound on each attempt at an operation of the given
+// type, or zero if there is none.
+func (np NetworkPolicy) timeoutFor(typ callType) time.Duration {
+	switch {
+	case typ == ctSourceInit && np.CloneTimeout != 0:
+		return np.CloneTimeout
+	case typ == ctSourceFetch && np.FetchTimeout != 0:
+		return np.FetchTimeout
+	}
+	return np.Timeout
+}
+
+// backoffAfter returns how long to wait after the nth failed attempt.
+func (np NetworkPolicy) backoffAfter(n int) time.Duration {
+	d := np.Backoff
+	for i := 1; i < n && (np.MaxBackoff <= 0 || d < np.MaxBackoff); i++ {
+		d *= 2
+	}
+	if np.MaxBackoff > 0 && d > np.MaxBackoff {
+		d = np.MaxBackoff
+	}
+	return d
+}
+
+// retryNetwork wraps f, an operation of the given type against dest, so that
+// each invocation is bounded and retried as np determines, unless it is the
+// zero NetworkPolicy. The final failure is a *NetworkError.
+func retryNetwork(np NetworkPolicy, dest string, typ callType, f func(context.Context) error) func(context.Context) error {
+	if np == (NetworkPolicy{}) {
+		return f
+	}
+	return func(ctx context.Context) error {
+		ne := &NetworkError{
+			URL:       redactURL(dest),
+			Operation: typ.String(),
+		}
+		timeout := np.timeoutFor(typ)
+		for {
+			err := attemptNetwork(ctx, timeout, f)
+			if err == nil {
+				return nil
+			}
+			if ctx.Err() != nil {
+				// The operation was abandoned, rather than given up on.
+				return err
+			}
+			ne.Attempts = append(ne.Attempts, err)
+			if !retriable(err) || len(ne.Attempts) >= np.Attempts {
+				return ne
+			}
+
+			t := time.NewTimer(np.backoffAfter(len(ne.Attempts)))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+		}
+	}
+}
+
+// attemptNetwork runs f once, bounded by the timeout if it is positive.
+func attemptNetwork(ctx context.Context, timeout time.Duration, f func(context.Context) error) error {
+	if timeout <= 0 {
+		return f(ctx)
+	}
+
+	actx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := f(actx)
+	if err != nil && ctx.Err() == nil && actx.Err() == context.DeadlineExceeded {
+		return errors.Wrapf(err, "timed out after %s", timeout)
+	}
+	return err
+}
+
+// retriable reports whether another attempt at an operation that failed with
+// err might succeed.
+func retriable(err error) bool {
+	switch errors.Cause(err).(type) {
+	case *AuthenticationError, *OfflineError:
+		return false
+	}
+	return errors.Cause(err) != ErrRepositoryNotFound
+}
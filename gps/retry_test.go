@@ -0,0 +1,79 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRetryNetwork(t *testing.T) {
+	np := NetworkPolicy{
+		Timeout:  20 * time.Millisecond,
+		Attempts: 3,
+		Backoff:  time.Millisecond,
+	}
+	ctx := context.Background()
+
+	// failing returns an operation that fails the given number of times with
+	// err, or hangs until its context is done if err is nil, before it
+	// succeeds.
+	var calls int
+	failing := func(n int, err error) func(context.Context) error {
+		calls = 0
+		return func(ctx context.Context) error {
+			calls++
+			if calls > n {
+				return nil
+			}
+			if err == nil {
+				<-ctx.Done()
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+
+	// Transient failures, including hung attempts, are retried.
+	if err := retryNetwork(np, "https://example.com/r", ctSourceFetch, failing(1, nil))(ctx); err != nil || calls != 2 {
+		t.Errorf("expected a hung attempt to be retried, got %v after %d calls", err, calls)
+	}
+
+	flaky := errors.New("connection reset")
+	err := retryNetwork(np, "https://example.com/r", ctSourceFetch, failing(5, flaky))(ctx)
+	ne, ok := err.(*NetworkError)
+	if !ok || len(ne.Attempts) != 3 || calls != 3 {
+		t.Fatalf("expected a *NetworkError after 3 attempts, got %v after %d calls", err, calls)
+	}
+	if errors.Cause(err) != flaky || !strings.Contains(err.Error(), "attempt 3: connection reset") {
+		t.Errorf("expected the error to report each attempt, got %q", err)
+	}
+
+	// Missing repositories are not.
+	err = retryNetwork(np, "https://example.com/r", ctSourceFetch, failing(5, ErrRepositoryNotFound))(ctx)
+	if errors.Cause(err) != ErrRepositoryNotFound || calls != 1 {
+		t.Errorf("expected a missing repository not to be retried, got %v after %d calls", err, calls)
+	}
+
+	// Nor are abandoned operations, whose errors are left alone.
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err = retryNetwork(np, "https://example.com/r", ctSourceFetch, failing(5, nil))(cctx); err != context.Canceled || calls != 1 {
+		t.Errorf("expected a canceled operation not to be retried, got %v after %d calls", err, calls)
+	}
+}
+
+func TestNetworkPolicyBackoff(t *testing.T) {
+	np := NetworkPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if n, got := i+1, np.backoffAfter(i+1); got != want {
+			t.Errorf("expected a backoff of %s after %d failures, got %s", want, n, got)
+		}
+	}
+}
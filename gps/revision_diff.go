@@ -0,0 +1,206 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FileChangeType describes how a file differs between two revisions.
+type FileChangeType uint8
+
+const (
+	// FileAdded indicates a file that exists only in the later revision.
+	FileAdded FileChangeType = iota + 1
+	// FileDeleted indicates a file that exists only in the earlier revision.
+	FileDeleted
+	// FileModified indicates a file whose contents or mode differ.
+	FileModified
+)
+
+func (t FileChangeType) String() string {
+	switch t {
+	case FileAdded:
+		return "added"
+	case FileDeleted:
+		return "deleted"
+	case FileModified:
+		return "modified"
+	}
+	return "unknown"
+}
+
+// FileChange describes a single file that differs between two revisions of a
+// project, as reported by SourceManager.DiffRevisions.
+//
+// Renames are reported as a deletion of the old path and an addition of the
+// new one.
+type FileChange struct {
+	// Path is the slash-separated path to the file, relative to the project
+	// root.
+	Path string
+	Type FileChangeType
+	// Added and Deleted are the number of lines added to and deleted from the
+	// file. They are only populated when stats are requested, and are always
+	// zero for binary files.
+	Added, Deleted int
+	// Binary indicates that the file's contents are binary. It is only
+	// populated when stats are requested.
+	Binary bool
+}
+
+// sourceDiffer is implemented by sources that can compute the changes between
+// two revisions using their local repository.
+type sourceDiffer interface {
+	source
+	diffRevisions(ctx context.Context, from, to Revision, stats bool) ([]FileChange, error)
+}
+
+func sortFileChanges(changes []FileChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+}
+
+// parseGitNameStatus parses the output of `git diff --name-status -z`.
+func parseGitNameStatus(out []byte) ([]FileChange, error) {
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(fields) == 1 && fields[0] == "" {
+		return nil, nil
+	}
+	if len(fields)%2 != 0 {
+		return nil, errors.Errorf("unexpected git diff output: %q", out)
+	}
+
+	changes := make([]FileChange, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		fc := FileChange{Path: fields[i+1]}
+		switch fields[i] {
+		case "A":
+			fc.Type = FileAdded
+		case "D":
+			fc.Type = FileDeleted
+		default:
+			// Everything else - modifications, type changes, unmerged paths -
+			// is reported as a modification.
+			fc.Type = FileModified
+		}
+		changes = append(changes, fc)
+	}
+	return changes, nil
+}
+
+// applyGitNumstat merges the output of `git diff --numstat -z` into the
+// provided changes.
+func applyGitNumstat(changes []FileChange, out []byte) error {
+	idx := make(map[string]int, len(changes))
+	for k, fc := range changes {
+		idx[fc.Path] = k
+	}
+
+	for _, rec := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		if rec == "" {
+			continue
+		}
+		parts := strings.SplitN(rec, "\t", 3)
+		if len(parts) != 3 {
+			return errors.Errorf("unexpected git numstat record: %q", rec)
+		}
+		k, has := idx[parts[2]]
+		if !has {
+			continue
+		}
+		if parts[0] == "-" && parts[1] == "-" {
+			changes[k].Binary = true
+			continue
+		}
+
+		var err error
+		if changes[k].Added, err = strconv.Atoi(parts[0]); err != nil {
+			return errors.Wrapf(err, "unexpected git numstat record: %q", rec)
+		}
+		if changes[k].Deleted, err = strconv.Atoi(parts[1]); err != nil {
+			return errors.Wrapf(err, "unexpected git numstat record: %q", rec)
+		}
+	}
+	return nil
+}
+
+// parseHgStatus parses the output of `hg status --rev from --rev to`.
+func parseHgStatus(out []byte) ([]FileChange, error) {
+	var changes []FileChange
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+		if len(line) < 3 || line[1] != ' ' {
+			return nil, errors.Errorf("unexpected hg status line: %q", line)
+		}
+
+		fc := FileChange{Path: line[2:]}
+		switch line[0] {
+		case 'A':
+			fc.Type = FileAdded
+		case 'R':
+			fc.Type = FileDeleted
+		case 'M':
+			fc.Type = FileModified
+		default:
+			// Only committed changes are of interest between two revisions.
+			continue
+		}
+		changes = append(changes, fc)
+	}
+	return changes, sc.Err()
+}
+
+// applyGitStyleDiffStats counts the added and deleted lines per file in a
+// git-style unified diff, as produced by `hg diff --git`, and merges them into
+// the provided changes.
+func applyGitStyleDiffStats(changes []FileChange, out []byte) error {
+	idx := make(map[string]int, len(changes))
+	for k, fc := range changes {
+		idx[fc.Path] = k
+	}
+
+	cur, inHunk := -1, false
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(make([]byte, 64*1024), 1<<30)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git a/"):
+			// The b/ path is the one that survives in the later revision; for
+			// deletions, both paths are the same.
+			cur, inHunk = -1, false
+			if i := strings.LastIndex(line, " b/"); i != -1 {
+				if k, has := idx[line[i+3:]]; has {
+					cur = k
+				}
+			}
+		case cur == -1:
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+		case !inHunk:
+			if strings.HasPrefix(line, "GIT binary patch") || strings.HasPrefix(line, "Binary file") {
+				changes[cur].Binary = true
+			}
+		case strings.HasPrefix(line, "+"):
+			changes[cur].Added++
+		case strings.HasPrefix(line, "-"):
+			changes[cur].Deleted++
+		}
+	}
+	return sc.Err()
+}
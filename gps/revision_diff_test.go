@@ -0,0 +1,190 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGitDiff(t *testing.T) {
+	changes, err := parseGitNameStatus([]byte("M\x00a.go\x00A\x00new/b.go\x00D\x00old.txt\x00T\x00link\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = applyGitNumstat(changes, []byte("3\t1\ta.go\x0010\t0\tnew/b.go\x00-\t-\told.txt\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []FileChange{
+		{Path: "a.go", Type: FileModified, Added: 3, Deleted: 1},
+		{Path: "new/b.go", Type: FileAdded, Added: 10},
+		{Path: "old.txt", Type: FileDeleted, Binary: true},
+		{Path: "link", Type: FileModified},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("unexpected changes:\n\t(GOT): %v\n\t(WNT): %v", changes, want)
+	}
+
+	if changes, err = parseGitNameStatus(nil); err != nil || len(changes) != 0 {
+		t.Errorf("expected no changes and no error from empty output, got %v, %v", changes, err)
+	}
+	if _, err = parseGitNameStatus([]byte("M\x00")); err == nil {
+		t.Error("expected an error from truncated output")
+	}
+}
+
+func TestParseHgDiff(t *testing.T) {
+	changes, err := parseHgStatus([]byte("M a.go\nA new/b.go\nR old.bin\n? untracked\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,2 +1,3 @@
+ package a
+--- not a header
++var x = 1
++var y = 2
+diff --git a/new/b.go b/new/b.go
+new file mode 100644
+--- /dev/null
++++ b/new/b.go
+@@ -0,0 +1,1 @@
++package b
+diff --git a/old.bin b/old.bin
+deleted file mode 100644
+GIT binary patch
+literal 0
+`
+	if err = applyGitStyleDiffStats(changes, []byte(diff)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []FileChange{
+		{Path: "a.go", Type: FileModified, Added: 2, Deleted: 1},
+		{Path: "new/b.go", Type: FileAdded, Added: 1},
+		{Path: "old.bin", Type: FileDeleted, Binary: true},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("unexpected changes:\n\t(GOT): %v\n\t(WNT): %v", changes, want)
+	}
+}
+
+// localGitRepo is an upstream git repository in a temporary directory, for
+// tests that exercise a gitSource against real history.
+type localGitRepo struct {
+	t   *testing.T
+	dir string
+	// Extra environment for git invocations, such as commit dates.
+	env []string
+}
+
+func newLocalGitRepo(t *testing.T, dir string) *localGitRepo {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	r := &localGitRepo{t: t, dir: dir}
+	r.git("init", "-q")
+	r.git("symbolic-ref", "HEAD", "refs/heads/master")
+	return r
+}
+
+func (r *localGitRepo) git(args ...string) string {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=gps", "-c", "user.email=gps@example.com"}, args...)...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), r.env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (r *localGitRepo) write(name, body string) {
+	path := filepath.Join(r.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(body), 0666); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// source creates a gitSource for the repository, with its local copy beneath
+// cachedir, and initializes it.
+func (r *localGitRepo) source(ctx context.Context, cachedir string) *gitSource {
+	u, err := url.Parse("file://" + filepath.ToSlash(r.dir))
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Join(cachedir, "sources"), 0777); err != nil {
+		r.t.Fatal(err)
+	}
+
+	isrc, err := maybeGitSource{url: u}.try(ctx, cacheDir{root: cachedir}, sourceSettings{})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if err = isrc.initLocal(ctx); err != nil {
+		r.t.Fatal(err)
+	}
+	return isrc.(*gitSource)
+}
+
+func TestGitSourceDiffRevisions(t *testing.T) {
+	requiresBins(t, "git")
+
+	tmp, err := ioutil.TempDir("", "gps-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Set up a small upstream repository with two commits.
+	repo := newLocalGitRepo(t, filepath.Join(tmp, "upstream"))
+	repo.write("a.go", "package a\n")
+	repo.write("gone.txt", "bye\n")
+	repo.git("add", "-A")
+	repo.git("commit", "-q", "-m", "first")
+	from := Revision(repo.git("rev-parse", "HEAD"))
+
+	repo.write("a.go", "package a\n\nvar x = 1\n")
+	repo.write("sub/b.go", "package sub\n")
+	repo.git("rm", "-q", "gone.txt")
+	repo.git("add", "-A")
+	repo.git("commit", "-q", "-m", "second")
+	to := Revision(repo.git("rev-parse", "HEAD"))
+
+	ctx := context.Background()
+	src := repo.source(ctx, filepath.Join(tmp, "cache"))
+
+	got, err := src.diffRevisions(ctx, from, to, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileChange{
+		{Path: "a.go", Type: FileModified, Added: 2},
+		{Path: "gone.txt", Type: FileDeleted, Deleted: 1},
+		{Path: "sub/b.go", Type: FileAdded, Added: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected changes:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	if got, err = src.diffRevisions(ctx, to, to, false); err != nil || len(got) != 0 {
+		t.Errorf("expected no changes between identical revisions, got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// RevisionTimeLister is implemented by SourceManagers that can report when the
+// revisions of a project were committed.
+//
+// Versions other than semantic versions have no order of their own. When the
+// SourceManager given to the solver is a RevisionTimeLister, the branches,
+// tags and revisions of a project that would otherwise be tried in
+// lexicographic order are instead tried from the most recently committed to
+// the least, or the reverse when downgrading, so that projects with no semantic
+// versions still move deterministically towards their newest code.
+type RevisionTimeLister interface {
+	// RevisionTimes returns the commit times of those of the revisions that
+	// are present in the project's repository.
+	RevisionTimes(ProjectIdentifier, []Revision) (map[Revision]time.Time, error)
+}
+
+// ContextRevisionTimeLister is a RevisionTimeLister that can read commit times
+// under a context. The solver prefers it, so that reads are abandoned along
+// with the solve that made them.
+type ContextRevisionTimeLister interface {
+	RevisionTimeLister
+	RevisionTimesContext(context.Context, ProjectIdentifier, []Revision) (map[Revision]time.Time, error)
+}
+
+// sourceRevisionTimes is implemented by sources that can read the commit times
+// of revisions from their local repository.
+type sourceRevisionTimes interface {
+	source
+	revisionTimes(ctx context.Context, revs []Revision) (map[Revision]time.Time, error)
+}
+
+// recencyGroup returns the group of versions, in the order established by
+// SortForUpgrade and SortForDowngrade, within which v may be ordered by the
+// time its revision was committed, or false if v is a semantic version, and so
+// ordered already.
+func recencyGroup(v Version) (string, bool) {
+	if pv, ok := v.(PairedVersion); ok {
+		v = pv.Unpair()
+	}
+	switch tv := v.(type) {
+	case branchVersion:
+		if tv.isDefault {
+			return "default branch", true
+		}
+		return "branch", true
+	case plainVersion:
+		return "tag", true
+	case Revision:
+		return "revision", true
+	}
+	return "", false
+}
+
+// recencyRuns returns the bounds of the runs of two or more consecutive
+// versions in vl that are in the same recency group.
+func recencyRuns(vl []Version) [][2]int {
+	var runs [][2]int
+	for i := 0; i < len(vl); {
+		g, ok := recencyGroup(vl[i])
+		j := i + 1
+		for ok && j < len(vl) {
+			if gj, _ := recencyGroup(vl[j]); gj != g {
+				break
+			}
+			j++
+		}
+		if ok && j-i > 1 {
+			runs = append(runs, [2]int{i, j})
+		}
+		i = j
+	}
+	return runs
+}
+
+// sortForRecency orders each run of versions in vl that are in the same
+// recency group by the times at which their revisions were committed, newest
+// first, or oldest first if down is set. Versions whose commit times are not
+// known follow those whose times are, in the order they were in.
+func sortForRecency(vl []Version, runs [][2]int, times map[Revision]time.Time, down bool) {
+	for _, run := range runs {
+		sub := vl[run[0]:run[1]]
+		sort.SliceStable(sub, func(i, j int) bool {
+			ti, iok := times[revisionOrEmpty(sub[i])]
+			tj, jok := times[revisionOrEmpty(sub[j])]
+			if !iok || !jok {
+				return iok && !jok
+			}
+			if down {
+				return ti.Before(tj)
+			}
+			return ti.After(tj)
+		})
+	}
+}
+
+// revisionOrEmpty returns the revision underlying v, or the empty revision if
+// there is none.
+func revisionOrEmpty(v Version) Revision {
+	r, _ := revisionOf(v)
+	return r
+}
+
+// orderByRecency orders the project's version list for recency, as described
+// on RevisionTimeLister, if the SourceManager is one. Failing to read the commit
+// times leaves the list as it was; the order is only ever a preference.
+func (b *bridge) orderByRecency(id ProjectIdentifier, vl []Version) {
+	if _, ok := b.sm.(RevisionTimeLister); !ok {
+		return
+	}
+	runs := recencyRuns(vl)
+	if len(runs) == 0 {
+		return
+	}
+
+	var revs []Revision
+	for _, run := range runs {
+		for _, v := range vl[run[0]:run[1]] {
+			if r, ok := revisionOf(v); ok {
+				revs = append(revs, r)
+			}
+		}
+	}
+	if len(revs) == 0 {
+		return
+	}
+
+	times, err := b.revisionTimes(id, revs)
+	if err != nil {
+		return
+	}
+	sortForRecency(vl, runs, times, b.down)
+}
+
+// revisionTimes reads the commit times of the revisions from the project's
+// source, under the context of the current solve run if the SourceManager
+// supports it.
+func (b *bridge) revisionTimes(id ProjectIdentifier, revs []Revision) (map[Revision]time.Time, error) {
+	id = b.sourceFor(id)
+	switch rtl := b.sm.(type) {
+	case ContextRevisionTimeLister:
+		return rtl.RevisionTimesContext(b.solveContext(), id, revs)
+	case RevisionTimeLister:
+		return rtl.RevisionTimes(id, revs)
+	}
+	return nil, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"testing"
+	"time"
+)
+
+// revisionTimesSM is a depspecSourceManager that reports fixed commit times for
+// revisions.
+type revisionTimesSM struct {
+	*depspecSourceManager
+	times map[Revision]time.Time
+}
+
+func (sm revisionTimesSM) RevisionTimes(id ProjectIdentifier, revs []Revision) (map[Revision]time.Time, error) {
+	times := make(map[Revision]time.Time)
+	for _, r := range revs {
+		if t, has := sm.times[r]; has {
+			times[r] = t
+		}
+	}
+	return times, nil
+}
+
+func TestRecencyOrdering(t *testing.T) {
+	ds := []depspec{
+		mkDepspec("root 0.0.0"),
+		mkDepspec("foo bdev rev1"),
+		mkDepspec("foo bfeature rev2"),
+		mkDepspec("foo bold rev3"),
+	}
+	times := map[Revision]time.Time{
+		"rev1": time.Unix(200, 0),
+		"rev2": time.Unix(300, 0),
+		"rev3": time.Unix(100, 0),
+	}
+
+	for _, c := range []struct {
+		sm   SourceManager
+		down bool
+		want string
+	}{
+		// Without commit times, branches are tried lexicographically.
+		{newdepspecSM(ds, nil), false, "dev"},
+		{revisionTimesSM{newdepspecSM(ds, nil), times}, false, "feature"},
+		{revisionTimesSM{newdepspecSM(ds, nil), times}, true, "old"},
+	} {
+		params := SolveParameters{
+			RootDir:         "root",
+			RootPackageTree: rootImporting("foo"),
+			Manifest:        simpleRootManifest{},
+			Downgrade:       c.down,
+			ProjectAnalyzer: naiveAnalyzer{},
+		}
+		soln, err := fixSolve(params, c.sm, t)
+		if err != nil {
+			t.Fatalf("unexpected solve failure: %s", err)
+		}
+		if lps := soln.Projects(); len(lps) != 1 || lps[0].Version().String() != c.want {
+			t.Errorf("expected foo to be selected at %s (downgrade: %v), got %v", c.want, c.down, lps)
+		}
+	}
+}
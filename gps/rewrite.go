@@ -0,0 +1,157 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ImportRewrite is a rule for rewriting the import paths in exported Go source
+// files. Import paths equal to From, or beneath it, have From replaced with To.
+//
+// An empty To strips From from the paths beneath it, which is useful when
+// dependencies import each other through an internal mirror's prefix, such as
+// "mirror.corp.example.com/github.com". Paths that equal From are then left as
+// they are.
+type ImportRewrite struct {
+	From, To string
+}
+
+// ParseImportRewrites parses a comma-separated list of from=to rules, such as
+// "github.com/upstream/lib=github.com/myfork/lib,mirror.example.com/=".
+// Trailing slashes are ignored.
+func ParseImportRewrites(list string) ([]ImportRewrite, error) {
+	var rws []ImportRewrite
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.Index(entry, "=")
+		if i < 0 {
+			return nil, errors.Errorf("invalid import rewrite %q: must be of the form from=to", entry)
+		}
+		rw := ImportRewrite{
+			From: strings.TrimRight(entry[:i], "/"),
+			To:   strings.TrimRight(entry[i+1:], "/"),
+		}
+		if rw.From == "" {
+			return nil, errors.Errorf("invalid import rewrite %q: the path to rewrite must not be empty", entry)
+		}
+		rws = append(rws, rw)
+	}
+	return rws, nil
+}
+
+// rewriteImportPath returns the provided import path as rewritten by the rule
+// with the longest matching From, and whether any rule applied.
+func rewriteImportPath(path string, rws []ImportRewrite) (string, bool) {
+	best := -1
+	for i, rw := range rws {
+		if path != rw.From && !strings.HasPrefix(path, rw.From+"/") {
+			continue
+		}
+		if rw.To == "" && path == rw.From {
+			continue
+		}
+		if best < 0 || len(rw.From) > len(rws[best].From) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return path, false
+	}
+
+	rw := rws[best]
+	if rw.To == "" {
+		return path[len(rw.From)+1:], true
+	}
+	return rw.To + path[len(rw.From):], true
+}
+
+// RewriteImports applies the provided rules to the import statements of every
+// Go source file beneath root, skipping the directories that the go tool
+// ignores: testdata, and those beginning with "." or "_".
+//
+// Source files are parsed, and only the import paths themselves are replaced,
+// so the rest of each file is left byte-for-byte as it was. Files that do not
+// parse are left untouched, as are symlinks.
+func RewriteImports(root string, rws []ImportRewrite) error {
+	if len(rws) == 0 {
+		return nil
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != root && (name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !strings.HasSuffix(name, ".go") {
+			return nil
+		}
+		return rewriteFileImports(path, rws)
+	})
+	return errors.Wrapf(err, "failed to rewrite imports in %s", root)
+}
+
+// rewriteFileImports applies the rules to the import statements of the Go
+// source file at path.
+func rewriteFileImports(path string, rws []ImportRewrite) error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, src, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+
+	type edit struct {
+		start, end int
+		lit        string
+	}
+	var edits []edit
+	for _, imp := range f.Imports {
+		ip, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if to, ok := rewriteImportPath(ip, rws); ok {
+			edits = append(edits, edit{
+				start: fset.Position(imp.Path.Pos()).Offset,
+				end:   fset.Position(imp.Path.End()).Offset,
+				lit:   strconv.Quote(to),
+			})
+		}
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+
+	// Splice from the end of the file, so that earlier offsets remain valid.
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		src = append(src[:e.start], append([]byte(e.lit), src[e.end:]...)...)
+	}
+	return ioutil.WriteFile(path, src, 0666)
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestParseImportRewrites(t *testing.T) {
+	rws, err := ParseImportRewrites(" github.com/upstream/lib=github.com/myfork/lib, mirror.example.com/= ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ImportRewrite{
+		{From: "github.com/upstream/lib", To: "github.com/myfork/lib"},
+		{From: "mirror.example.com"},
+	}
+	if len(rws) != len(want) || rws[0] != want[0] || rws[1] != want[1] {
+		t.Errorf("expected rewrites %v, got %v", want, rws)
+	}
+
+	for _, bad := range []string{"github.com/foo", "=github.com/foo"} {
+		if _, err := ParseImportRewrites(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestRewriteImportPath(t *testing.T) {
+	rws := []ImportRewrite{
+		{From: "github.com/upstream/lib", To: "github.com/myfork/lib"},
+		{From: "github.com/upstream/lib/v2", To: "github.com/other/lib"},
+		{From: "mirror.example.com"},
+	}
+	cases := map[string]string{
+		"github.com/upstream/lib":             "github.com/myfork/lib",
+		"github.com/upstream/lib/sub":         "github.com/myfork/lib/sub",
+		"github.com/upstream/lib/v2/sub":      "github.com/other/lib/sub",
+		"github.com/upstream/library":         "github.com/upstream/library",
+		"mirror.example.com/github.com/a/b":   "github.com/a/b",
+		"mirror.example.com":                  "mirror.example.com",
+		"golang.org/x/net/context":            "golang.org/x/net/context",
+		"mirror.example.com.evil.com/foo/bar": "mirror.example.com.evil.com/foo/bar",
+	}
+	for from, want := range cases {
+		got, ok := rewriteImportPath(from, rws)
+		if got != want || ok != (from != want) {
+			t.Errorf("expected %q to be rewritten to %q, got %q (%v)", from, want, got, ok)
+		}
+	}
+}
+
+func TestRewriteImports(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	const src = `// Package root does things.
+package root // import "github.com/upstream/lib"
+
+import (
+	"fmt"
+	lib "github.com/upstream/lib/sub" // the library
+	_ "mirror.example.com/github.com/a/b"
+)
+
+// The string "github.com/upstream/lib" is not an import.
+var _ = fmt.Sprint("github.com/upstream/lib", lib.X)
+`
+	const want = `// Package root does things.
+package root // import "github.com/upstream/lib"
+
+import (
+	"fmt"
+	lib "github.com/myfork/lib/sub" // the library
+	_ "github.com/a/b"
+)
+
+// The string "github.com/upstream/lib" is not an import.
+var _ = fmt.Sprint("github.com/upstream/lib", lib.X)
+`
+	const broken = "package root\n\nimport (\n\t\"github.com/upstream/lib\"\n"
+	h.TempFile("root/root.go", src)
+	h.TempFile("root/testdata/data.go", src)
+	h.TempFile("root/_example/example.go", src)
+	h.TempFile("root/broken.go", broken)
+
+	rws := []ImportRewrite{
+		{From: "github.com/upstream/lib", To: "github.com/myfork/lib"},
+		{From: "mirror.example.com"},
+	}
+	if err := RewriteImports(h.Path("root"), rws); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]string{
+		"root/root.go":             want,
+		"root/testdata/data.go":    src,
+		"root/_example/example.go": src,
+		"root/broken.go":           broken,
+	}
+	for rel, body := range expect {
+		got, err := ioutil.ReadFile(h.Path(rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != body {
+			t.Errorf("unexpected contents of %s:\n%s", rel, got)
+		}
+	}
+}
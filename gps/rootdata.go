@@ -23,10 +23,17 @@ type rootdata struct {
 	// Map of packages to require.
 	req map[string]bool
 
+	// The sorted list of the root's imports that are satisfied externally.
+	// Those packages are also included in the ignored ruleset.
+	ext []string
+
 	// A ProjectConstraints map containing the validated (guaranteed non-empty)
 	// overrides declared by the root manifest.
 	ovr ProjectConstraints
 
+	// The policy under which semver constraints admit prereleases.
+	pre PrereleasePolicy
+
 	// A map of the ProjectRoot (local names) that should be allowed to change
 	chng map[ProjectRoot]struct{}
 
@@ -34,6 +41,9 @@ type rootdata struct {
 	// for lock.
 	chngall bool
 
+	// A map of the ProjectRoot (local names) that are exempt from chngall.
+	keep map[ProjectRoot]struct{}
+
 	// A map of the project names listed in the root's lock.
 	rlm map[ProjectRoot]LockedProject
 
@@ -48,6 +58,14 @@ type rootdata struct {
 
 	// The ProjectAnalyzer to use for all GetManifestAndLock calls.
 	an ProjectAnalyzer
+
+	// The import paths of the commands being solved for, if the root is the
+	// synthetic project of a tools solve.
+	tools map[string]bool
+
+	// The members of the workspace being solved for, if the root is the
+	// project merged from them for a workspace solve.
+	ws []WorkspaceMember
 }
 
 // externalImportList returns a list of the unique imports from the root data.
@@ -99,7 +117,7 @@ func (rd rootdata) getApplicableConstraints(stdLibFn func(string) bool) []workin
 	}
 
 	// Now override them all to produce a consolidated workingConstraint slice
-	combined := rd.ovr.overrideAll(pc)
+	combined := rd.overrideAll(pc)
 
 	type wccount struct {
 		count int
@@ -138,7 +156,22 @@ func (rd rootdata) getApplicableConstraints(stdLibFn func(string) bool) []workin
 }
 
 func (rd rootdata) combineConstraints() []workingConstraint {
-	return rd.ovr.overrideAll(rd.rm.DependencyConstraints())
+	return rd.overrideAll(rd.rm.DependencyConstraints())
+}
+
+// rootConstraints returns the constraints that the root project places on
+// projects, by its manifest or its overrides, as the solver applies them.
+func (rd rootdata) rootConstraints() map[ProjectRoot]Constraint {
+	cm := make(map[ProjectRoot]Constraint)
+	for _, wc := range rd.combineConstraints() {
+		cm[wc.Ident.ProjectRoot] = wc.Constraint
+	}
+	for pr, pp := range rd.ovr {
+		if _, has := cm[pr]; !has && pp.Constraint != nil {
+			cm[pr] = WithPrereleasePolicy(pp.Constraint, rd.pre)
+		}
+	}
+	return cm
 }
 
 // needVersionListFor indicates whether we need a version list for a given
@@ -146,7 +179,7 @@ func (rd rootdata) combineConstraints() []workingConstraint {
 // required). Assuming the argument is not the root project itself, this will be
 // true if any of the following conditions hold:
 //
-//  - ChangeAll is on
+//  - ChangeAll is on, and the project is not exempt from it
 //  - The project is not in the lock
 //  - The project is in the lock, but is also in the list of projects to change
 func (rd rootdata) needVersionsFor(pr ProjectRoot) bool {
@@ -154,7 +187,7 @@ func (rd rootdata) needVersionsFor(pr ProjectRoot) bool {
 		return false
 	}
 
-	if rd.chngall {
+	if rd.changesAll(pr) {
 		return true
 	}
 
@@ -172,8 +205,27 @@ func (rd rootdata) needVersionsFor(pr ProjectRoot) bool {
 
 }
 
+// changesAll reports whether pr is to be changed by virtue of all projects
+// being changed.
+func (rd rootdata) changesAll(pr ProjectRoot) bool {
+	if !rd.chngall {
+		return false
+	}
+	_, kept := rd.keep[pr]
+	return !kept
+}
+
+// channelFor returns the release channel to which the root project constrains
+// pr, by an override or else by its manifest, if it does.
+func (rd rootdata) channelFor(pr ProjectRoot) (ReleaseChannel, bool) {
+	if pp, has := rd.ovr[pr]; has && pp.Constraint != nil {
+		return ChannelOf(pp.Constraint)
+	}
+	return ChannelOf(rd.rm.Deps[pr].Constraint)
+}
+
 func (rd rootdata) isRoot(pr ProjectRoot) bool {
-	return pr == ProjectRoot(rd.rpt.ImportRoot)
+	return pr == ProjectRoot(rd.rpt.ImportRoot) || rd.isWorkspaceMember(pr)
 }
 
 // rootAtom creates an atomWithPackages that represents the root project.
@@ -4,6 +4,11 @@
 
 package gps
 
+import (
+	"sort"
+	"strings"
+)
+
 // check performs constraint checks on the provided atom. The set of checks
 // differ slightly depending on whether the atom is pkgonly, or if it's the
 // entire project being added for the first time.
@@ -19,6 +24,7 @@ func (s *solver) check(a atomWithPackages, pkgonly bool) error {
 	}
 
 	s.mtr.push("satisfy")
+	s.mtr.checks++
 	var err error
 	defer func() {
 		if err != nil {
@@ -33,11 +39,32 @@ func (s *solver) check(a atomWithPackages, pkgonly bool) error {
 		if err = s.checkAtomAllowable(pa); err != nil {
 			return err
 		}
+		if err = s.checkPolicyPin(pa); err != nil {
+			return err
+		}
+		if err = s.checkMajorVersion(pa); err != nil {
+			return err
+		}
+		if err = s.checkProjectHook(pa); err != nil {
+			return err
+		}
+		if err = s.checkGoVersion(pa); err != nil {
+			return err
+		}
+		if err = s.checkNotDowngrade(pa); err != nil {
+			return err
+		}
+		if err = s.checkRepositoryNotShared(pa); err != nil {
+			return err
+		}
 	}
 
 	if err = s.checkRequiredPackagesExist(a); err != nil {
 		return err
 	}
+	if err = s.checkToolsAreCommands(a); err != nil {
+		return err
+	}
 
 	var deps []completeDep
 	_, deps, err = s.getImportsAndConstraintsOf(a)
@@ -76,6 +103,107 @@ func (s *solver) check(a atomWithPackages, pkgonly bool) error {
 	return nil
 }
 
+// checkProjectHook consults the solver's ProjectHook, if any, for a verdict on
+// the atom. The hook is invoked the first time any atom from a project is
+// checked, and its verdicts are retained for the remainder of the solve.
+func (s *solver) checkProjectHook(pa atom) error {
+	if s.hook == nil {
+		return nil
+	}
+
+	vm, has := s.verdicts[pa.id.ProjectRoot]
+	if !has {
+		vl, err := s.b.listVersions(pa.id)
+		if err != nil {
+			return err
+		}
+		vm = s.hook(ProjectEntry{
+			Ident:      pa.id,
+			Constraint: s.sel.getConstraint(pa.id),
+			Candidates: append([]Version(nil), vl...),
+		})
+		s.verdicts[pa.id.ProjectRoot] = vm
+	}
+
+	var veto bool
+	var notes []string
+	for v, cv := range vm {
+		if v == pa.v || v.Matches(pa.v) {
+			veto = veto || cv.Veto
+			if cv.Note != "" {
+				notes = append(notes, cv.Note)
+			}
+		}
+	}
+	sort.Strings(notes)
+	note := strings.Join(notes, "; ")
+
+	if veto {
+		return &vetoedVersionFailure{
+			goal: pa,
+			note: note,
+		}
+	}
+	if note != "" {
+		s.traceInfo("note on %s: %s", a2vs(pa), note)
+	}
+	return nil
+}
+
+// checkNotDowngrade ensures that, if downgrades are forbidden, the atom is not
+// an older version of a locked project that was not named for change.
+func (s *solver) checkNotDowngrade(pa atom) error {
+	if !s.nodown || !s.asOf.IsZero() {
+		return nil
+	}
+	lp, locked := s.rd.rlm[pa.id.ProjectRoot]
+	if !locked {
+		return nil
+	}
+	if _, named := s.rd.chng[pa.id.ProjectRoot]; named {
+		return nil
+	}
+
+	lsv, lok := semverOf(lp.Version())
+	csv, cok := semverOf(pa.v)
+	if !lok || !cok || !csv.LessThan(lsv) {
+		return nil
+	}
+	return &downgradeFailure{
+		goal:   pa,
+		locked: lp.Version(),
+	}
+}
+
+// checkGoVersion ensures that the atom's project can be built with the target
+// Go toolchain, if there is one.
+func (s *solver) checkGoVersion(pa atom) error {
+	if s.gover == "" {
+		return nil
+	}
+
+	// Problems retrieving the manifest are dealt with once the atom's
+	// dependencies are examined.
+	m, _, err := s.b.GetManifestAndLock(pa.id, pa.v, s.rd.an)
+	if err != nil {
+		return nil
+	}
+	gm, ok := m.(GoVersionManifest)
+	if !ok || gm.MinimumGoVersion() == "" {
+		return nil
+	}
+
+	min := gm.MinimumGoVersion()
+	minp, err := parseGoVersion(min)
+	if err != nil {
+		return &goVersionFailure{goal: pa, min: min, target: s.gover, err: err}
+	}
+	if s.goverp.less(minp) {
+		return &goVersionFailure{goal: pa, min: min, target: s.gover}
+	}
+	return nil
+}
+
 // checkAtomAllowable ensures that an atom itself is acceptable with respect to
 // the constraints established by the current solution.
 func (s *solver) checkAtomAllowable(pa atom) error {
@@ -167,12 +295,26 @@ func (s *solver) checkDepsConstraintsAllowable(a atomWithPackages, cdep complete
 		}
 	}
 
-	return &disjointConstraintFailure{
+	fail := &disjointConstraintFailure{
 		goal:      dependency{depender: a.a, dep: cdep},
 		failsib:   failsib,
 		nofailsib: nofailsib,
 		c:         constraint,
 	}
+	if len(failsib) == 0 {
+		// Every sibling overlaps with the dep on its own, so find the one that
+		// narrowed their intersection too far for it.
+		cs := make([]Constraint, 0, len(siblings)+1)
+		for _, sibling := range siblings {
+			cs = append(cs, sibling.dep.Constraint)
+		}
+		trace := IntersectTraced(append(cs, dep.Constraint)...)
+		if i, _, ok := trace.Conflict(); ok && i < len(siblings) {
+			fail.narrowing = &siblings[i]
+			fail.narrowed = trace[i].Result
+		}
+	}
+	return fail
 }
 
 // checkDepsDisallowsSelected ensures that an atom's constraints on a particular
@@ -0,0 +1,56 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "sort"
+
+// VersionScorer assigns weights to the candidate versions of projects,
+// expressing soft preferences - for recency, popularity, or membership in an
+// internal allowlist, say - that the solver honors without any change to the
+// constraints in play.
+//
+// The solver tries acceptable versions in descending order of score. Versions
+// with equal scores, including those given no score at all, which score zero,
+// retain their usual relative order. Scores only reorder candidates; they
+// never make a version acceptable that constraints disallow, nor arrange for
+// any version to be tried ahead of a locked or otherwise preferred one, and
+// deprecated versions are still tried after all others.
+type VersionScorer interface {
+	// ScoreVersions is called once per project per solve, with the project's
+	// versions in the order in which the solver would otherwise try them.
+	//
+	// The returned map need only contain the versions the scorer has an
+	// opinion about. A score applies to every candidate that its key matches,
+	// so a score keyed by NewVersion("v1.0.0") applies to that version paired
+	// with any revision. If several scores match the same candidate, the
+	// highest of them applies.
+	ScoreVersions(id ProjectIdentifier, candidates []Version) (map[Version]float64, error)
+}
+
+// preferHigherScores stably reorders the list in descending order of score.
+func preferHigherScores(vl []Version, scores map[Version]float64) {
+	if len(scores) == 0 {
+		return
+	}
+
+	vs := make(map[Version]float64, len(vl))
+	for _, v := range vl {
+		var score float64
+		first := true
+		for sv, s := range scores {
+			if sv == v || sv.Matches(v) {
+				if first || s > score {
+					score = s
+				}
+				first = false
+			}
+		}
+		vs[v] = score
+	}
+
+	sort.SliceStable(vl, func(i, j int) bool {
+		return vs[vl[i]] > vs[vl[j]]
+	})
+}
@@ -7,10 +7,12 @@ package gps
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/golang/dep/internal/fs"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 )
@@ -28,6 +30,136 @@ type Solution interface {
 	// The version of the Solver used in generating this solution.
 	SolverVersion() int
 	Attempts() int
+	// SelectionReasons reports, for each project in the solution, why the
+	// solver selected the version that it did.
+	SelectionReasons() map[ProjectRoot]SelectionReason
+	// AggregateConstraints reports, for each project in the solution, the
+	// intersection of the constraints that governed its selection, and the
+	// dependers from which they came.
+	AggregateConstraints() map[ProjectRoot]AggregateConstraint
+	// Artifacts reports the committed binaries and large files found in each
+	// project in the solution, as flagged by the ArtifactPolicy in the
+	// SolveParameters. Projects without any artifacts are omitted.
+	Artifacts() map[ProjectRoot][]Artifact
+	// Deprecations reports the projects in the solution for which a
+	// deprecated version was selected, along with the notice that applies to
+	// it. Projects with non-deprecated versions are omitted.
+	Deprecations() map[ProjectRoot]Deprecation
+	// MajorVersionWarnings reports the projects in the solution for which a
+	// version was selected whose major version is not reflected in the
+	// project's import path, under a constraint that also admits earlier major
+	// versions. They are only reported if SolveParameters.MajorVersions is
+	// WarnMajorVersionMismatches.
+	MajorVersionWarnings() map[ProjectRoot]MajorVersionWarning
+	// ExternalImports reports the root project's imports that are satisfied
+	// externally, as declared by an ExternalManifest. They are not included in
+	// InputImports, and no project is selected for them.
+	ExternalImports() []string
+	// Substitutions reports the projects in the solution that are retrieved
+	// from one of the SolveParameters.SourceFallbacks, because their declared
+	// sources could not be reached. Their LockedProjects name the substitute
+	// as their source.
+	Substitutions() map[ProjectRoot]SourceSubstitution
+	// Metadata reports the SolveParameters.ProjectMetadata of each project in
+	// the solution that has any. Projects without metadata are omitted.
+	Metadata() map[ProjectRoot]map[string]string
+	// PackageAttributions reports, for each selected project, why each of its
+	// packages in the solution is needed.
+	PackageAttributions() map[ProjectRoot]map[string]PackageAttribution
+	// VersionSnapshot reports the versions that were visible for each project
+	// in the solution, if SolveParameters.CaptureVersions was set, or nil
+	// otherwise.
+	VersionSnapshot() VersionSnapshot
+	// Alternatives reports the further distinct solutions found after this
+	// one, if more than one was requested with SolveParameters.MaxSolutions.
+	// The solutions it returns have no alternatives of their own.
+	Alternatives() []Solution
+	// PolicyPins reports the projects in the solution whose
+	// SolveParameters.PolicyPins bound, excluding versions that would
+	// otherwise have been selectable. Their SelectionReasons are
+	// SelectedByPolicyPin. Projects whose pins did not bind are omitted.
+	PolicyPins() map[ProjectRoot]BoundPolicyPin
+	// Metrics reports the work the solve did to find the solution, and the
+	// time it took. Alternatives report only zero metrics, as they are found
+	// by the same solve.
+	Metrics() SolveMetrics
+	// InputsHash reports the digest of the inputs from which the solution was
+	// solved, as computed by the Solver's HashInputs.
+	InputsHash() []byte
+}
+
+// SelectionReason describes how the solver arrived at the version it selected
+// for a project.
+type SelectionReason uint8
+
+const (
+	// SelectedByConstraint indicates the version was the best available match
+	// for the constraints on the project.
+	SelectedByConstraint SelectionReason = iota
+	// SelectedFromLock indicates the version was carried over from the root
+	// project's lock.
+	SelectedFromLock
+	// SelectedByOverride indicates the version was the best available match
+	// for an override declared by the root project.
+	SelectedByOverride
+	// SelectedByPreference indicates the version was preferred as a result of
+	// appearing in a dependency's lock.
+	SelectedByPreference
+	// SelectedByPolicyPin indicates the version was the best available match
+	// for the constraints on the project once its policy pin excluded others.
+	SelectedByPolicyPin
+)
+
+func (r SelectionReason) String() string {
+	switch r {
+	case SelectedFromLock:
+		return "lock"
+	case SelectedByOverride:
+		return "override"
+	case SelectedByPreference:
+		return "preference"
+	case SelectedByPolicyPin:
+		return "policy"
+	}
+	return "constraint"
+}
+
+// ParseSelectionReason parses the string form of a SelectionReason, as
+// produced by its String method.
+func ParseSelectionReason(s string) (SelectionReason, error) {
+	switch s {
+	case "constraint":
+		return SelectedByConstraint, nil
+	case "lock":
+		return SelectedFromLock, nil
+	case "override":
+		return SelectedByOverride, nil
+	case "preference":
+		return SelectedByPreference, nil
+	case "policy":
+		return SelectedByPolicyPin, nil
+	}
+	return 0, errors.Errorf("unknown selection reason %q", s)
+}
+
+// AggregateConstraint describes the final, intersected constraint on a project
+// in a solution.
+type AggregateConstraint struct {
+	// Constraint is the intersection of the constraints of all the dependers,
+	// with any overrides applied. Any version it admits would have satisfied
+	// every depender.
+	Constraint Constraint
+	// Dependers lists each project that depends on the constrained project,
+	// and the constraint it declared, sorted by depender. The root project is
+	// included if it imports or requires any of the project's packages.
+	Dependers []DependerConstraint
+}
+
+// DependerConstraint is the constraint that a single depender placed on a
+// project.
+type DependerConstraint struct {
+	Depender   ProjectRoot
+	Constraint Constraint
 }
 
 type solution struct {
@@ -45,19 +177,86 @@ type solution struct {
 
 	// The solver used in producing this solution
 	solv Solver
+
+	// Why each project's version was selected
+	reasons map[ProjectRoot]SelectionReason
+
+	// The aggregate constraint on each project
+	constraints map[ProjectRoot]AggregateConstraint
+
+	// The artifacts found in each project, if scanning was requested.
+	artifacts map[ProjectRoot][]Artifact
+
+	// The deprecation notices for any deprecated versions that were selected.
+	deprecated map[ProjectRoot]Deprecation
+
+	// The warnings for any major version mismatches that were selected.
+	majors map[ProjectRoot]MajorVersionWarning
+
+	// The root's imports that are satisfied externally.
+	ext []string
+
+	// The fallback sources substituted for unreachable ones.
+	substituted map[ProjectRoot]SourceSubstitution
+
+	// The metadata passed through for the selected projects.
+	meta map[ProjectRoot]map[string]string
+
+	// The versions visible to the solve, if they were captured.
+	snapshot VersionSnapshot
+
+	// Why each package from the selected projects is needed.
+	attributions map[ProjectRoot]map[string]PackageAttribution
+
+	// Further solutions found after this one, if any were requested.
+	alts []Solution
+
+	// The policy pins that bound on the selected projects.
+	pinned map[ProjectRoot]BoundPolicyPin
+
+	// The metrics of the solve that found this solution.
+	metrics SolveMetrics
+
+	// The digest of the inputs to the solve.
+	hd []byte
 }
 
+// WriteEvent is the kind of progress reported by WriteDepTree.
+type WriteEvent uint8
+
+const (
+	// WriteStarted is reported when a project begins to be written.
+	WriteStarted WriteEvent = iota
+	// WriteCompleted is reported when a project has been written
+	// successfully.
+	WriteCompleted
+	// WriteFailed is reported when a project could not be written.
+	WriteFailed
+)
+
 // WriteProgress informs about the progress of WriteDepTree.
 type WriteProgress struct {
-	Count   int
-	Total   int
-	LP      LockedProject
+	// Event is the kind of progress being reported.
+	Event WriteEvent
+	// Count is the number of projects that have finished being written,
+	// successfully or not, including LP if it has.
+	Count int
+	Total int
+	LP    LockedProject
+	// Bytes is the total size of the files written for LP. It is only set for
+	// WriteCompleted.
+	Bytes int64
+	// Failure is set for WriteFailed, in which case Err is the reason.
 	Failure bool
+	Err     error
 }
 
 func (p WriteProgress) String() string {
 	msg := "Wrote"
-	if p.Failure {
+	switch p.Event {
+	case WriteStarted:
+		msg = "Writing"
+	case WriteFailed:
 		msg = "Failed to write"
 	}
 	return fmt.Sprintf("(%d/%d) %s %s@%s", p.Count, p.Total, msg, p.LP.Ident(), p.LP.Version())
@@ -74,7 +273,10 @@ const concurrentWriters = 16
 // It requires a SourceManager to do the work. Prune options are read from the
 // passed manifest.
 //
-// If onWrite is not nil, it will be called after each project write. Calls are ordered and atomic.
+// If onWrite is not nil, it will be called when each project starts being
+// written, and again when it has been written or has failed. Calls are ordered
+// and atomic. Projects that are abandoned because another one failed are not
+// reported as failed.
 func WriteDepTree(basedir string, l Lock, sm SourceManager, co CascadingPruneOptions, onWrite func(WriteProgress)) error {
 	if l == nil {
 		return fmt.Errorf("must provide non-nil Lock to WriteDepTree")
@@ -91,11 +293,22 @@ func WriteDepTree(basedir string, l Lock, sm SourceManager, co CascadingPruneOpt
 		sync.Mutex
 		i int
 	}
+	report := func(wp WriteProgress) {
+		// Increment and call atomically to prevent re-ordering.
+		cnt.Lock()
+		if wp.Event != WriteStarted {
+			cnt.i++
+		}
+		wp.Count, wp.Total = cnt.i, len(lps)
+		onWrite(wp)
+		cnt.Unlock()
+	}
 
 	for i := range lps {
 		p := lps[i] // per-iteration copy
 
 		g.Go(func() error {
+			var to string
 			err := func() error {
 				select {
 				case sem <- struct{}{}:
@@ -106,15 +319,16 @@ func WriteDepTree(basedir string, l Lock, sm SourceManager, co CascadingPruneOpt
 
 				ident := p.Ident()
 				projectRoot := string(ident.ProjectRoot)
-				to := filepath.FromSlash(filepath.Join(basedir, projectRoot))
+				to = filepath.FromSlash(filepath.Join(basedir, projectRoot))
 
-				if err := sm.ExportProject(ctx, ident, p.Version(), to); err != nil {
-					return errors.Wrapf(err, "failed to export %s", projectRoot)
+				if onWrite != nil {
+					report(WriteProgress{Event: WriteStarted, LP: p})
 				}
 
-				err := PruneProject(to, p, co.PruneOptionsFor(ident.ProjectRoot))
-				if err != nil {
-					return errors.Wrapf(err, "failed to prune %s", projectRoot)
+				// Export and prune in a single step, so that the SourceManager
+				// can apply any normalization to the final, pruned tree.
+				if err := sm.ExportPrunedProject(ctx, p, co.PruneOptionsFor(ident.ProjectRoot), to); err != nil {
+					return errors.Wrapf(err, "failed to export %s", projectRoot)
 				}
 
 				return ctx.Err()
@@ -124,18 +338,22 @@ func WriteDepTree(basedir string, l Lock, sm SourceManager, co CascadingPruneOpt
 			case context.Canceled, context.DeadlineExceeded:
 				// Don't report "secondary" errors.
 			default:
-				if onWrite != nil {
-					// Increment and call atomically to prevent re-ordering.
-					cnt.Lock()
-					cnt.i++
-					onWrite(WriteProgress{
-						Count:   cnt.i,
-						Total:   len(lps),
-						LP:      p,
-						Failure: err != nil,
-					})
-					cnt.Unlock()
+				if onWrite == nil {
+					break
 				}
+				if err != nil {
+					report(WriteProgress{Event: WriteFailed, LP: p, Failure: true, Err: err})
+					break
+				}
+
+				var n int64
+				filepath.Walk(to, func(path string, fi os.FileInfo, err error) error {
+					if err == nil && fi.Mode().IsRegular() {
+						n += fi.Size()
+					}
+					return nil
+				})
+				report(WriteProgress{Event: WriteCompleted, LP: p, Bytes: n})
 			}
 
 			return err
@@ -149,10 +367,72 @@ func WriteDepTree(basedir string, l Lock, sm SourceManager, co CascadingPruneOpt
 	return errors.Wrap(err, "failed to write dep tree")
 }
 
+// WriteVendor writes the projects listed in the lock to dir, typically a
+// vendor directory, as WriteDepTree does, but atomically: the tree is first
+// written to a temporary directory beside dir, and only once it is complete is
+// it moved into place, replacing any existing tree at dir. A write that fails,
+// or is interrupted, leaves the existing tree as it was.
+//
+// The prune options and onWrite are as for WriteDepTree.
+func WriteVendor(dir string, l Lock, sm SourceManager, co CascadingPruneOptions, onWrite func(WriteProgress)) error {
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0777); err != nil {
+		return err
+	}
+
+	// Working beside dir keeps the renames below on a single filesystem.
+	td, err := ioutil.TempDir(parent, "."+filepath.Base(dir)+"-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create a temporary directory")
+	}
+	keep := false
+	defer func() {
+		if !keep {
+			os.RemoveAll(td)
+		}
+	}()
+
+	newdir, olddir := filepath.Join(td, "new"), filepath.Join(td, "old")
+	if err := WriteDepTree(newdir, l, sm, co, onWrite); err != nil {
+		return err
+	}
+
+	// The tree may be empty, if the lock is, but dir should still exist.
+	if err := os.MkdirAll(newdir, 0777); err != nil {
+		return err
+	}
+
+	hadOld := true
+	if err := fs.RenameWithFallback(dir, olddir); err != nil {
+		if _, serr := os.Stat(dir); !os.IsNotExist(serr) {
+			return errors.Wrapf(err, "failed to move the existing tree aside from %s", dir)
+		}
+		hadOld = false
+	}
+
+	if err := fs.RenameWithFallback(newdir, dir); err != nil {
+		if hadOld {
+			if rerr := fs.RenameWithFallback(olddir, dir); rerr != nil {
+				// Don't delete the only remaining copy of the old tree.
+				keep = true
+				return errors.Wrapf(err, "failed to move the new tree into place at %s, and to restore the existing tree from %s: %s", dir, olddir, rerr)
+			}
+		}
+		return errors.Wrapf(err, "failed to move the new tree into place at %s", dir)
+	}
+	return nil
+}
+
+// Projects returns the projects in the solution, sorted by identifier.
 func (r solution) Projects() []LockedProject {
 	return r.p
 }
 
+// IterProjects walks the solution's projects in place, without copying them.
+func (r solution) IterProjects() ProjectIterator {
+	return &sliceProjectIterator{lps: r.p, i: -1}
+}
+
 func (r solution) InputImports() []string {
 	return r.i
 }
@@ -176,3 +456,82 @@ func (r solution) SolverName() string {
 func (r solution) SolverVersion() int {
 	return r.solv.Version()
 }
+
+func (r solution) SelectionReasons() map[ProjectRoot]SelectionReason {
+	return r.reasons
+}
+
+func (r solution) AggregateConstraints() map[ProjectRoot]AggregateConstraint {
+	return r.constraints
+}
+
+func (r solution) Artifacts() map[ProjectRoot][]Artifact {
+	return r.artifacts
+}
+
+func (r solution) Deprecations() map[ProjectRoot]Deprecation {
+	return r.deprecated
+}
+
+func (r solution) MajorVersionWarnings() map[ProjectRoot]MajorVersionWarning {
+	return r.majors
+}
+
+func (r solution) ExternalImports() []string {
+	return r.ext
+}
+
+func (r solution) Substitutions() map[ProjectRoot]SourceSubstitution {
+	return r.substituted
+}
+
+func (r solution) Metadata() map[ProjectRoot]map[string]string {
+	return r.meta
+}
+
+func (r solution) PackageAttributions() map[ProjectRoot]map[string]PackageAttribution {
+	return r.attributions
+}
+
+func (r solution) VersionSnapshot() VersionSnapshot {
+	return r.snapshot
+}
+
+func (r solution) Alternatives() []Solution {
+	return r.alts
+}
+
+func (r solution) PolicyPins() map[ProjectRoot]BoundPolicyPin {
+	return r.pinned
+}
+
+func (r solution) Metrics() SolveMetrics {
+	return r.metrics
+}
+
+func (r solution) InputsHash() []byte {
+	return r.hd
+}
+
+// projectMetadata returns copies of the metadata for each of the locked
+// projects that has any, so that the solution does not share maps with the
+// SolveParameters.
+func (s *solver) projectMetadata(lps []LockedProject) map[ProjectRoot]map[string]string {
+	if len(s.meta) == 0 {
+		return nil
+	}
+
+	m := make(map[ProjectRoot]map[string]string)
+	for _, lp := range lps {
+		pr := lp.Ident().ProjectRoot
+		if len(s.meta[pr]) == 0 {
+			continue
+		}
+		md := make(map[string]string, len(s.meta[pr]))
+		for k, v := range s.meta[pr] {
+			md[k] = v
+		}
+		m[pr] = md
+	}
+	return m
+}
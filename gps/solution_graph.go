@@ -0,0 +1,103 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"sort"
+
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pkg/errors"
+)
+
+// PackageGraph is a package-level import graph. Each key is the import path of
+// a package, and the corresponding value is the sorted list of import paths that
+// package directly imports.
+//
+// Imports of packages that are not themselves in the graph - typically, the
+// standard library - are retained as edges, but do not appear as keys.
+type PackageGraph map[string][]string
+
+// NewPackageGraph computes the PackageGraph spanning the root project's
+// packages and every package selected in the provided Lock - typically, a
+// Solution. Package information for locked projects is retrieved through the
+// SourceManager, at the locked version.
+//
+// Nothing is written to disk, and no assumptions are made about GOPATH or
+// vendor directories, so this is suitable for consumers that want to treat the
+// solver purely as an analysis library.
+//
+// Test imports are included for the root project's packages, but not for
+// those of its dependencies, mirroring what the solver itself considers.
+func NewPackageGraph(rpt pkgtree.PackageTree, l Lock, sm SourceManager) (PackageGraph, error) {
+	g := make(PackageGraph)
+
+	for ip, poe := range rpt.Packages {
+		if poe.Err != nil {
+			continue
+		}
+		g.add(ip, poe.P.Imports, poe.P.TestImports)
+	}
+
+	if l == nil {
+		return g, nil
+	}
+
+	for _, lp := range l.Projects() {
+		id := lp.Ident()
+		ptree, err := sm.ListPackages(id, lp.Version())
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not list packages for %s at %s", id, lp.Version())
+		}
+
+		for _, pkg := range lp.Packages() {
+			ip := string(id.ProjectRoot)
+			if pkg != "." {
+				ip = ip + "/" + pkg
+			}
+
+			poe, has := ptree.Packages[ip]
+			if !has {
+				return nil, errors.Errorf("locked package %s does not exist in %s at %s", ip, id, lp.Version())
+			}
+			if poe.Err != nil {
+				return nil, errors.Wrapf(poe.Err, "locked package %s has errors", ip)
+			}
+			g.add(ip, poe.P.Imports)
+		}
+	}
+
+	return g, nil
+}
+
+func (g PackageGraph) add(ip string, imps ...[]string) {
+	seen := make(map[string]bool)
+	var edges []string
+	for _, il := range imps {
+		for _, imp := range il {
+			if !seen[imp] && imp != ip {
+				seen[imp] = true
+				edges = append(edges, imp)
+			}
+		}
+	}
+
+	sort.Strings(edges)
+	g[ip] = edges
+}
+
+// Importers returns the sorted list of packages in the graph that directly
+// import the provided import path.
+func (g PackageGraph) Importers(ip string) []string {
+	var importers []string
+	for pkg, imps := range g {
+		i := sort.SearchStrings(imps, ip)
+		if i < len(imps) && imps[i] == ip {
+			importers = append(importers, pkg)
+		}
+	}
+
+	sort.Strings(importers)
+	return importers
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewPackageGraph(t *testing.T) {
+	fix := basicFixtures["with compatible locked dependency"]
+	soln, err := solveBasicsAndCheck(fix, t)
+	if err != nil {
+		t.Fatalf("unexpected solve failure: %s", err)
+	}
+
+	sm := newdepspecSM(fix.ds, nil)
+	g, err := NewPackageGraph(fix.rootTree(), soln, sm)
+	if err != nil {
+		t.Fatalf("unexpected error building package graph: %s", err)
+	}
+
+	want := PackageGraph{
+		"root": {"foo"},
+		"foo":  {"bar"},
+		"bar":  nil,
+	}
+	if !reflect.DeepEqual(g, want) {
+		t.Errorf("unexpected package graph:\n\t(GOT): %v\n\t(WNT): %v", g, want)
+	}
+
+	if imps := g.Importers("bar"); !reflect.DeepEqual(imps, []string{"foo"}) {
+		t.Errorf("expected bar to be imported only by foo, got %v", imps)
+	}
+	if imps := g.Importers("root"); len(imps) != 0 {
+		t.Errorf("expected root to have no importers, got %v", imps)
+	}
+
+	// A nil lock yields just the root project's packages.
+	g, err = NewPackageGraph(fix.rootTree(), nil, sm)
+	if err != nil {
+		t.Fatalf("unexpected error building package graph: %s", err)
+	}
+	if !reflect.DeepEqual(g, PackageGraph{"root": {"foo"}}) {
+		t.Errorf("unexpected package graph for nil lock: %v", g)
+	}
+
+	// Locked packages that don't exist at the locked version are an error.
+	l := fixLock{NewLockedProject(mkPI("foo"), NewVersion("1.0.1"), []string{"nope"})}
+	if _, err = NewPackageGraph(fix.rootTree(), l, sm); err == nil {
+		t.Error("expected an error for a nonexistent locked package")
+	}
+}
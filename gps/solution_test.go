@@ -5,12 +5,15 @@
 package gps
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/golang/dep/internal/test"
@@ -163,3 +166,160 @@ func BenchmarkCreateVendorTree(b *testing.B) {
 	sm.Release()
 	os.RemoveAll(tmp) // comment this to leave temp dir behind for inspection
 }
+
+func TestSelectionReasonRoundTrip(t *testing.T) {
+	for _, r := range []SelectionReason{SelectedByConstraint, SelectedFromLock, SelectedByOverride, SelectedByPreference} {
+		r2, err := ParseSelectionReason(r.String())
+		if err != nil {
+			t.Fatalf("could not parse %q: %s", r, err)
+		}
+		if r != r2 {
+			t.Errorf("expected %q to round-trip, got %q", r, r2)
+		}
+	}
+
+	if _, err := ParseSelectionReason("whim"); err == nil {
+		t.Error("expected an error on unknown selection reason")
+	}
+}
+
+// exportingSM writes a file of a fixed size for every exported project, except
+// for the one it is told to fail.
+type exportingSM struct {
+	*depspecSourceManager
+	fail ProjectRoot
+}
+
+func (sm exportingSM) ExportPrunedProject(ctx context.Context, lp LockedProject, _ PruneOptions, to string) error {
+	if lp.Ident().ProjectRoot == sm.fail {
+		return errors.New("export failed")
+	}
+	if err := os.MkdirAll(to, 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(to, "a.go"), make([]byte, 10), 0666)
+}
+
+func TestWriteDepTreeProgress(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writeprogress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l := safeLock{p: []LockedProject{
+		NewLockedProject(mkPI("a"), NewVersion("1.0.0").Pair("abc"), []string{"."}),
+		NewLockedProject(mkPI("b"), NewVersion("1.0.0").Pair("def"), []string{"."}),
+	}}
+
+	var events []WriteProgress
+	record := func(wp WriteProgress) { events = append(events, wp) }
+
+	sm := exportingSM{depspecSourceManager: newdepspecSM(nil, nil)}
+	if err := WriteDepTree(filepath.Join(tmp, "ok"), l, sm, defaultCascadingPruneOptions(), record); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected a start and a completion for each project, got %v", events)
+	}
+	started := make(map[ProjectRoot]bool)
+	for i, wp := range events {
+		pr := wp.LP.Ident().ProjectRoot
+		switch wp.Event {
+		case WriteStarted:
+			started[pr] = true
+		case WriteCompleted:
+			if !started[pr] {
+				t.Errorf("%s was reported complete before it was started", pr)
+			}
+			if wp.Bytes != 10 {
+				t.Errorf("expected 10 bytes to be reported for %s, got %d", pr, wp.Bytes)
+			}
+		default:
+			t.Errorf("unexpected event for %s: %v", pr, wp.Event)
+		}
+		if wp.Total != 2 {
+			t.Errorf("expected a total of 2 projects, got %d", wp.Total)
+		}
+		if i == len(events)-1 && wp.Count != 2 {
+			t.Errorf("expected the final event to count 2 projects, got %d", wp.Count)
+		}
+	}
+
+	events = nil
+	sm.fail = "b"
+	if err := WriteDepTree(filepath.Join(tmp, "fail"), l, sm, defaultCascadingPruneOptions(), record); err == nil {
+		t.Fatal("expected writing the tree to fail")
+	}
+	var failed bool
+	for _, wp := range events {
+		if wp.Event == WriteFailed {
+			failed = true
+			if wp.LP.Ident().ProjectRoot != "b" || !wp.Failure || wp.Err == nil {
+				t.Errorf("unexpected failure report: %+v", wp)
+			}
+			if !strings.HasSuffix(wp.String(), "Failed to write b@1.0.0") {
+				t.Errorf("unexpected failure message %q", wp.String())
+			}
+		}
+	}
+	if !failed {
+		t.Errorf("expected the failure to be reported, got %v", events)
+	}
+}
+
+func TestWriteVendor(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writevendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	vendor := filepath.Join(tmp, "vendor")
+	if err := os.MkdirAll(filepath.Join(vendor, "old"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	sentinel := filepath.Join(vendor, "old", "old.go")
+	if err := ioutil.WriteFile(sentinel, []byte("package old"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	l := safeLock{p: []LockedProject{
+		NewLockedProject(mkPI("a"), NewVersion("1.0.0").Pair("abc"), []string{"."}),
+		NewLockedProject(mkPI("b"), NewVersion("1.0.0").Pair("def"), []string{"."}),
+	}}
+	sm := exportingSM{depspecSourceManager: newdepspecSM(nil, nil), fail: "b"}
+
+	// A failed write must leave the existing tree untouched.
+	if err := WriteVendor(vendor, l, sm, defaultCascadingPruneOptions(), nil); err == nil {
+		t.Fatal("expected writing the tree to fail")
+	}
+	if _, err := os.Stat(sentinel); err != nil {
+		t.Fatalf("expected the existing tree to survive a failed write: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(vendor, "a")); !os.IsNotExist(err) {
+		t.Error("expected no part of the failed write to be in place")
+	}
+
+	sm.fail = ""
+	if err := WriteVendor(vendor, l, sm, defaultCascadingPruneOptions(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sentinel); !os.IsNotExist(err) {
+		t.Error("expected the existing tree to be replaced")
+	}
+	for _, pr := range []string{"a", "b"} {
+		if _, err := os.Stat(filepath.Join(vendor, pr, "a.go")); err != nil {
+			t.Errorf("expected %s to be written: %s", pr, err)
+		}
+	}
+
+	// Nothing but the tree should be left beside it.
+	fis, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 1 {
+		t.Errorf("expected only the vendor directory to remain, got %d entries", len(fis))
+	}
+}
@@ -197,6 +197,8 @@ type depspec struct {
 	v    Version
 	deps []ProjectConstraint
 	pkgs []tpkg
+	// The minimum Go version required by the project, if any.
+	gov string
 }
 
 // mkDepspec creates a depspec by processing a series of strings, each of which
@@ -961,6 +963,36 @@ var basicFixtures = map[string]basicFixture{
 			},
 		},
 	},
+	"disjoint with intersection of constraints": {
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "bar 1.0.0"),
+			mkDepspec("bar 1.0.0", "shared <3.0.0", "baz 1.0.0"),
+			mkDepspec("baz 1.0.0", "shared <2.0.0 || >=3.0.0", "foo 1.0.0"),
+			mkDepspec("foo 1.0.0", "shared >=2.0.0"),
+			mkDepspec("shared 1.0.0"),
+			mkDepspec("shared 2.0.0"),
+			mkDepspec("shared 3.0.0"),
+		},
+		fail: &noVersionError{
+			pn: mkPI("foo"),
+			fails: []failedVersion{
+				{
+					v: NewVersion("1.0.0"),
+					f: &disjointConstraintFailure{
+						goal:    mkDep("foo 1.0.0", "shared >=2.0.0", "shared"),
+						failsib: nil,
+						nofailsib: []dependency{
+							mkDep("bar 1.0.0", "shared <3.0.0", "shared"),
+							mkDep("baz 1.0.0", "shared <2.0.0 || >=3.0.0", "shared"),
+						},
+						c:         mkSVC("<2.0.0"),
+						narrowing: &dependency{depender: mkAtom("baz 1.0.0"), dep: mkCDep("shared <2.0.0 || >=3.0.0", "shared")},
+						narrowed:  mkSVC("<2.0.0"),
+					},
+				},
+			},
+		},
+	},
 	"no valid solution": {
 		ds: []depspec{
 			mkDepspec("root 0.0.0", "a *", "b *"),
@@ -1429,6 +1461,14 @@ func (sm *depspecSourceManager) RevisionPresentIn(id ProjectIdentifier, r Revisi
 	return false, fmt.Errorf("project %s has no revision %s", id, r)
 }
 
+func (sm *depspecSourceManager) VersionsForRevision(id ProjectIdentifier, r Revision) ([]UnpairedVersion, error) {
+	pvl, err := sm.ListVersions(id)
+	if err != nil {
+		return nil, err
+	}
+	return versionsForRevision(pvl, r), nil
+}
+
 func (sm *depspecSourceManager) SourceExists(id ProjectIdentifier) (bool, error) {
 	src := toFold(id.normalizedSource())
 	for _, ds := range sm.specs {
@@ -1454,6 +1494,10 @@ func (sm *depspecSourceManager) ExportProject(context.Context, ProjectIdentifier
 	return fmt.Errorf("dummy sm doesn't support exporting")
 }
 
+func (sm *depspecSourceManager) DiffRevisions(context.Context, ProjectIdentifier, Revision, Revision, bool) ([]FileChange, error) {
+	return nil, fmt.Errorf("dummy sm doesn't support diffing revisions")
+}
+
 func (sm *depspecSourceManager) ExportPrunedProject(context.Context, LockedProject, PruneOptions, string) error {
 	return fmt.Errorf("dummy sm doesn't support exporting")
 }
@@ -1503,7 +1547,7 @@ func (b *depspecBridge) listVersions(id ProjectIdentifier) ([]Version, error) {
 		return vl, nil
 	}
 
-	pvl, err := b.sm.ListVersions(id)
+	pvl, err := b.listPairedVersions(id)
 	if err != nil {
 		return nil, err
 	}
@@ -1524,6 +1568,31 @@ func (b *depspecBridge) listVersions(id ProjectIdentifier) ([]Version, error) {
 	} else {
 		SortForUpgrade(vl)
 	}
+	b.orderByRecency(id, vl)
+
+	if ch, ok := b.s.rd.channelFor(id.ProjectRoot); ok {
+		sortForChannel(vl, ch, b.down)
+	}
+
+	if b.s.scorer != nil {
+		scores, err := b.s.scorer.ScoreVersions(id, append([]Version(nil), vl...))
+		if err != nil {
+			return nil, err
+		}
+		preferHigherScores(vl, scores)
+	}
+
+	if b.s.selector != nil {
+		if vl, err = selectVersions(b.s.selector, id, vl); err != nil {
+			return nil, err
+		}
+	}
+
+	ds, err := b.deprecations(id)
+	if err != nil {
+		return nil, err
+	}
+	preferNonDeprecated(vl, ds)
 
 	b.vlists[id] = vl
 	return vl, nil
@@ -1540,7 +1609,15 @@ func (b *depspecBridge) verifyRootDir(path string) error {
 }
 
 func (b *depspecBridge) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
-	return b.sm.(fixSM).ListPackages(id, v)
+	// The synthetic root of a tools solve is not in the fixture.
+	if len(b.s.rd.tools) > 0 && b.s.rd.isRoot(id.ProjectRoot) {
+		return b.s.rd.rpt, nil
+	}
+	id = b.sourceFor(id)
+	b.s.mtr.watch(id)
+	pt, err := b.sm.(fixSM).ListPackages(id, v)
+	b.chargeFetch(id)
+	return pt, err
 }
 
 func (b *depspecBridge) vendorCodeExists(id ProjectIdentifier) (bool, error) {
@@ -1557,6 +1634,10 @@ func (ds depspec) DependencyConstraints() ProjectConstraints {
 	return pcSliceToMap(ds.deps)
 }
 
+func (ds depspec) MinimumGoVersion() string {
+	return ds.gov
+}
+
 type fixLock []LockedProject
 
 // impl Lock interface
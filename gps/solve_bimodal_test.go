@@ -178,6 +178,75 @@ var bimodalFixtures = map[string]bimodalFixture{
 			"b 1.1.0",
 		),
 	},
+	// A constraint on a subpackage applies to its project, but only when the
+	// subpackage is reached.
+	"subpackage constraint reached": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0", "b/sub <2.0.0"),
+				pkg("a", "b/sub"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+				pkg("b/sub"),
+			),
+			dsp(mkDepspec("b 2.0.0"),
+				pkg("b"),
+				pkg("b/sub"),
+			),
+		},
+		r: mksolution(
+			"a 1.0.0",
+			mklp("b 1.0.0", "sub"),
+		),
+	},
+	"subpackage constraint not reached": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0"),
+				pkg("root", "a"),
+			),
+			dsp(mkDepspec("a 1.0.0", "b/sub <2.0.0"),
+				pkg("a", "b"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+				pkg("b/sub"),
+			),
+			dsp(mkDepspec("b 2.0.0"),
+				pkg("b"),
+				pkg("b/sub"),
+			),
+		},
+		r: mksolution(
+			"a 1.0.0",
+			"b 2.0.0",
+		),
+	},
+	// Constraints on a project and on its subpackages are intersected.
+	"subpackage constraint intersects project constraint": {
+		ds: []depspec{
+			dsp(mkDepspec("root 0.0.0", "b ^1.0.0", "b/sub <1.1.0"),
+				pkg("root", "b", "b/sub"),
+			),
+			dsp(mkDepspec("b 1.0.0"),
+				pkg("b"),
+				pkg("b/sub"),
+			),
+			dsp(mkDepspec("b 1.1.0"),
+				pkg("b"),
+				pkg("b/sub"),
+			),
+			dsp(mkDepspec("b 2.0.0"),
+				pkg("b"),
+				pkg("b/sub"),
+			),
+		},
+		r: mksolution(
+			mklp("b 1.0.0", ".", "sub"),
+		),
+	},
 	// Import jump is in a dep, and points to a transitive dep - but only in not
 	// the first version we try
 	"transitive bm-add on older version": {
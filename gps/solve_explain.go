@@ -0,0 +1,223 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SolveFailure is the error returned by Solve when there is no solution that
+// satisfies the constraints. Its Error method reports the conflict on which the
+// solver finally gave up, just as it would be reported on its own, while its
+// String method renders a fuller explanation, suitable for CLI output.
+type SolveFailure struct {
+	// Project is the dependency for which the solver could not find an
+	// acceptable version when it gave up.
+	Project ProjectIdentifier
+	// Constraints holds the constraints that were imposed at the time on
+	// Project, and on each dependency on which its versions conflicted with
+	// the projects already selected. Each constraint is accompanied by the
+	// constraints that had in turn been imposed on the project that imposed
+	// it, back to the root project.
+	Constraints map[ProjectRoot][]ImposedConstraint
+	// Rejections records every version that was rejected over the course of
+	// the solve, in the order in which they were rejected.
+	Rejections []Rejection
+	// Minimal holds, once Minimize has been called, a minimal set of the
+	// requirements in Constraints whose conflict causes the failure.
+	Minimal []Requirement
+
+	err error
+}
+
+// ImposedConstraint is a constraint that a selected project imposed on one of
+// its dependencies.
+type ImposedConstraint struct {
+	// By is the project that imposed the constraint, and Version the version
+	// of it that was selected. Version is nil for the root project.
+	By      ProjectIdentifier
+	Version Version
+	// Workspace is set if By is a member of the workspace being solved for,
+	// as with SolveParameters.Workspace, rather than a dependency. Version is
+	// then nil.
+	Workspace bool
+	// Constraint is the constraint that By imposed on the dependency.
+	Constraint Constraint
+	// Overridden is set if Constraint is an override from the root manifest,
+	// which took the place of whatever constraint By itself declared.
+	Overridden bool
+	// Dependers holds the constraints that had been imposed on By, under
+	// which its version was selected. Where a project imposes constraints on
+	// more than one dependency, these are only listed under the first.
+	Dependers []ImposedConstraint
+}
+
+// Rejection records the solver's rejection of a version of a project.
+type Rejection struct {
+	Project ProjectIdentifier
+	Version Version
+	// Reason is the failure that caused the version to be rejected.
+	Reason error
+}
+
+func (e *SolveFailure) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the conflict on which the solver gave up.
+func (e *SolveFailure) Cause() error {
+	return e.err
+}
+
+func (e *SolveFailure) traceString() string {
+	if te, ok := e.err.(traceError); ok {
+		return te.traceString()
+	}
+	return e.err.Error()
+}
+
+// String renders the conflict on which the solver gave up, followed by the
+// trees of constraints imposed on the projects involved, starting with
+// Project. Once the failure has been minimized, only the minimal set of
+// conflicting requirements follows instead.
+func (e *SolveFailure) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(strings.TrimSpace(e.err.Error()))
+
+	if len(e.Minimal) > 0 {
+		buf.WriteString("\n\nConflicting requirements:")
+		for _, r := range e.Minimal {
+			fmt.Fprintf(&buf, "\n  %s", r)
+		}
+		return buf.String()
+	}
+
+	prs := make([]string, 0, len(e.Constraints))
+	for pr := range e.Constraints {
+		if pr != e.Project.ProjectRoot {
+			prs = append(prs, string(pr))
+		}
+	}
+	sort.Strings(prs)
+	if _, has := e.Constraints[e.Project.ProjectRoot]; has {
+		prs = append([]string{string(e.Project.ProjectRoot)}, prs...)
+	}
+
+	for i, pr := range prs {
+		if i == 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "\nConstraints on %s:", pr)
+		writeImposedConstraints(&buf, e.Constraints[ProjectRoot(pr)], 1)
+	}
+	return buf.String()
+}
+
+func writeImposedConstraints(buf *bytes.Buffer, ics []ImposedConstraint, depth int) {
+	for _, ic := range ics {
+		by := atom{id: ic.By, v: ic.Version}
+		if ic.Workspace {
+			by.v = workspaceRev
+		}
+		fmt.Fprintf(buf, "\n%s%s from %s", strings.Repeat("  ", depth), ic.Constraint, a2vs(by))
+		if ic.Overridden {
+			buf.WriteString(" (overridden by the root project)")
+		}
+		writeImposedConstraints(buf, ic.Dependers, depth+1)
+	}
+}
+
+// reject records the rejection of an atom for the provided reason.
+func (s *solver) reject(a atom, reason error) {
+	s.rejections = append(s.rejections, Rejection{
+		Project: a.id,
+		Version: a.v,
+		Reason:  reason,
+	})
+}
+
+// imposedConstraints returns the trees of constraints currently imposed on the
+// project, and on the dependencies on which err reports that its versions
+// conflicted, as for SolveFailure.Constraints.
+func (s *solver) imposedConstraints(id ProjectIdentifier, err error) map[ProjectRoot][]ImposedConstraint {
+	ids := append([]ProjectIdentifier{id}, conflictedDependencies(err)...)
+	ics := make(map[ProjectRoot][]ImposedConstraint, len(ids))
+	for _, id := range ids {
+		if _, has := ics[id.ProjectRoot]; !has {
+			ics[id.ProjectRoot] = s.imposedConstraintsOn(id, map[ProjectRoot]bool{id.ProjectRoot: true})
+		}
+	}
+	return ics
+}
+
+// conflictedDependencies returns the dependencies on which err reports that
+// versions of a project conflicted with the projects already selected.
+func conflictedDependencies(err error) []ProjectIdentifier {
+	switch e := err.(type) {
+	case *noVersionError:
+		var ids []ProjectIdentifier
+		for _, f := range e.fails {
+			ids = append(ids, conflictedDependencies(f.f)...)
+		}
+		return ids
+	case *disjointConstraintFailure:
+		return []ProjectIdentifier{e.goal.dep.Ident}
+	case *constraintNotAllowedFailure:
+		return []ProjectIdentifier{e.goal.dep.Ident}
+	case *depHasProblemPackagesFailure:
+		return []ProjectIdentifier{e.goal.dep.Ident}
+	case *nonexistentRevisionFailure:
+		return []ProjectIdentifier{e.goal.dep.Ident}
+	case *sourceMismatchFailure:
+		return []ProjectIdentifier{{ProjectRoot: e.shared}}
+	}
+	return nil
+}
+
+func (s *solver) imposedConstraintsOn(id ProjectIdentifier, expanded map[ProjectRoot]bool) []ImposedConstraint {
+	deps := s.sel.getDependenciesOn(id)
+	ics := make([]ImposedConstraint, 0, len(deps))
+	for _, dep := range deps {
+		ic := ImposedConstraint{
+			By:         dep.depender.id,
+			Constraint: dep.dep.Constraint,
+			Overridden: dep.dep.overrConstraint,
+		}
+		switch dep.depender.v {
+		case rootRev:
+		case workspaceRev:
+			ic.Workspace = true
+		default:
+			ic.Version = dep.depender.v
+		}
+		// Expanding each depender only once keeps cycles, and the same
+		// project depended on at many points in the graph, from multiplying
+		// the tree.
+		if !expanded[ic.By.ProjectRoot] {
+			expanded[ic.By.ProjectRoot] = true
+			ic.Dependers = s.imposedConstraintsOn(ic.By, expanded)
+		}
+		ics = append(ics, ic)
+	}
+	return ics
+}
+
+// solveFailure wraps the conflict on which the solver gave up in a
+// SolveFailure, along with the constraints that had been imposed on the
+// projects involved.
+func (s *solver) solveFailure(id ProjectIdentifier, ics map[ProjectRoot][]ImposedConstraint, err error) error {
+	if contextCanceledOrSMReleased(err) {
+		return err
+	}
+	return &SolveFailure{
+		Project:     id,
+		Constraints: ics,
+		Rejections:  s.rejections,
+		err:         err,
+	}
+}
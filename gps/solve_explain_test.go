@@ -0,0 +1,103 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSolveFailureExplanation(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a 1.0.0", "b 1.0.0"),
+			mkDepspec("a 1.0.0", "c ^1.0.0"),
+			mkDepspec("b 1.0.0", "c ^2.0.0"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("c 2.0.0"),
+		},
+	}
+	params := basicFixtureParams(fix)
+
+	_, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	sf, ok := err.(*SolveFailure)
+	if !ok {
+		t.Fatalf("expected a *SolveFailure, got %T: %v", err, err)
+	}
+	if _, ok := sf.Cause().(*noVersionError); !ok {
+		t.Errorf("expected the failure to be caused by a *noVersionError, got %T", sf.Cause())
+	}
+	if sf.Error() != sf.Cause().Error() {
+		t.Errorf("expected the failure to report its cause's error, got %q", sf.Error())
+	}
+
+	if sf.Project.ProjectRoot != "b" {
+		t.Errorf("expected the solver to give up on b, got %s", sf.Project)
+	}
+	ics := sf.Constraints["c"]
+	if len(ics) != 1 || ics[0].By.ProjectRoot != "a" || ics[0].Version.String() != "1.0.0" || ics[0].Constraint.String() != "^1.0.0" {
+		t.Fatalf("expected c to be constrained to ^1.0.0 by a@1.0.0, got %v", ics)
+	}
+	if d := ics[0].Dependers; len(d) != 1 || d[0].By.ProjectRoot != "root" || d[0].Version != nil {
+		t.Errorf("expected a to have been constrained by the root project, got %v", d)
+	}
+	if len(sf.Constraints["b"]) != 1 {
+		t.Errorf("expected one constraint on b, got %v", sf.Constraints["b"])
+	}
+
+	var rejected bool
+	for _, r := range sf.Rejections {
+		if r.Project.ProjectRoot == "b" && r.Version.String() == "1.0.0" && r.Reason != nil {
+			rejected = true
+		}
+	}
+	if !rejected {
+		t.Errorf("expected the rejection of b@1.0.0 to be recorded, got %v", sf.Rejections)
+	}
+
+	want := `
+Constraints on b:
+  1.0.0 from (root)
+Constraints on c:
+  ^1.0.0 from a@1.0.0
+    1.0.0 from (root)`
+	if got := sf.String(); !strings.HasSuffix(got, want) || !strings.HasPrefix(got, "No versions of b met constraints:") {
+		t.Errorf("unexpected rendering of the failure:\n%s", got)
+	}
+}
+
+func TestSolveFailureNotesOverrides(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a 1.0.0"),
+			mkDepspec("a 1.0.0", "c ^1.0.0"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("c 2.0.0"),
+		},
+		ovr: ProjectConstraints{
+			ProjectRoot("c"): ProjectProperties{
+				Constraint: mkSVC("^3.0.0"),
+			},
+		},
+	}
+	params := basicFixtureParams(fix)
+
+	_, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	sf, ok := err.(*SolveFailure)
+	if !ok {
+		t.Fatalf("expected a *SolveFailure, got %T: %v", err, err)
+	}
+	if !strings.Contains(sf.Error(), "not allowed by constraint ^3.0.0 (overridden by the root project) from project a") {
+		t.Errorf("expected the failure to note the override, got:\n%s", sf.Error())
+	}
+
+	ics := sf.Constraints["c"]
+	if len(ics) != 1 || !ics[0].Overridden || ics[0].Constraint.String() != "^3.0.0" {
+		t.Fatalf("expected c to be constrained by the override, got %v", ics)
+	}
+	if want := "\n  ^3.0.0 from a@1.0.0 (overridden by the root project)"; !strings.Contains(sf.String(), want) {
+		t.Errorf("expected the explanation to note the override, got:\n%s", sf.String())
+	}
+}
@@ -15,10 +15,28 @@ func a2vs(a atom) string {
 	if a.v == rootRev || a.v == nil {
 		return "(root)"
 	}
+	if a.v == workspaceRev {
+		return fmt.Sprintf("(workspace member %s)", a.id)
+	}
 
 	return fmt.Sprintf("%s@%s", a.id, a.v)
 }
 
+// depConstraintString renders the constraint of a dependency, noting if it is
+// an override from the root manifest rather than the depender's own, and if it
+// was narrowed to the major version implied by the project's import path.
+func depConstraintString(d dependency) string {
+	s := d.dep.Constraint.String()
+	if d.dep.unnarrowed != nil {
+		ic, _ := ImpliedConstraint(d.dep.Ident.ProjectRoot)
+		s = fmt.Sprintf("%s (limited to %s by its import path)", d.dep.unnarrowed, ic)
+	}
+	if d.dep.overrConstraint {
+		return s + " (overridden by the root project)"
+	}
+	return s
+}
+
 type traceError interface {
 	traceString() string
 }
@@ -147,6 +165,28 @@ func (e *wrongCaseFailure) traceString() string {
 	return buf.String()
 }
 
+// sharedRepositoryFailure occurs when an atom would be selected from the same
+// repository as a project with a different root that is already selected at a
+// different revision, so that two copies of the repository's code, at
+// different revisions, would be built.
+type sharedRepositoryFailure struct {
+	// goal is the atom that could not be selected.
+	goal atom
+	// other is the already-selected atom from the same repository.
+	other atom
+	// repo is the location of the repository.
+	repo string
+}
+
+func (e *sharedRepositoryFailure) Error() string {
+	str := "Could not introduce %s, as it is retrieved from the same repository, %s, as %s; they must be at the same revision, or given distinct sources"
+	return fmt.Sprintf(str, a2vs(e.goal), e.repo, a2vs(e.other))
+}
+
+func (e *sharedRepositoryFailure) traceString() string {
+	return fmt.Sprintf("%s shares repository %s with %s at a different revision", a2vs(e.goal), e.repo, a2vs(e.other))
+}
+
 // disjointConstraintFailure occurs when attempting to introduce an atom that
 // itself has an acceptable version, but one of its dependency constraints is
 // disjoint with one or more dependency constraints already active for that
@@ -166,12 +206,18 @@ type disjointConstraintFailure struct {
 	// c is the current constraint on the target identifier. It is intersection
 	// of all the active dependencies' constraints.
 	c Constraint
+	// narrowing is set if none of the active dependencies is disjoint with
+	// the goal on its own. It is the earliest of them by which the
+	// intersection of their constraints had been narrowed to narrowed, which
+	// is disjoint with the goal.
+	narrowing *dependency
+	narrowed  Constraint
 }
 
 func (e *disjointConstraintFailure) Error() string {
 	if len(e.failsib) == 1 {
 		str := "Could not introduce %s, as it has a dependency on %s with constraint %s, which has no overlap with existing constraint %s from %s"
-		return fmt.Sprintf(str, a2vs(e.goal.depender), e.goal.dep.Ident, e.goal.dep.Constraint.String(), e.failsib[0].dep.Constraint.String(), a2vs(e.failsib[0].depender))
+		return fmt.Sprintf(str, a2vs(e.goal.depender), e.goal.dep.Ident, depConstraintString(e.goal), depConstraintString(e.failsib[0]), a2vs(e.failsib[0].depender))
 	}
 
 	var buf bytes.Buffer
@@ -181,16 +227,19 @@ func (e *disjointConstraintFailure) Error() string {
 		sibs = e.failsib
 
 		str := "Could not introduce %s, as it has a dependency on %s with constraint %s, which has no overlap with the following existing constraints:\n"
-		fmt.Fprintf(&buf, str, a2vs(e.goal.depender), e.goal.dep.Ident, e.goal.dep.Constraint.String())
+		fmt.Fprintf(&buf, str, a2vs(e.goal.depender), e.goal.dep.Ident, depConstraintString(e.goal))
 	} else {
 		sibs = e.nofailsib
 
 		str := "Could not introduce %s, as it has a dependency on %s with constraint %s, which does not overlap with the intersection of existing constraints from other currently selected packages:\n"
-		fmt.Fprintf(&buf, str, a2vs(e.goal.depender), e.goal.dep.Ident, e.goal.dep.Constraint.String())
+		fmt.Fprintf(&buf, str, a2vs(e.goal.depender), e.goal.dep.Ident, depConstraintString(e.goal))
 	}
 
 	for _, c := range sibs {
-		fmt.Fprintf(&buf, "\t%s from %s\n", c.dep.Constraint.String(), a2vs(c.depender))
+		fmt.Fprintf(&buf, "\t%s from %s\n", depConstraintString(c), a2vs(c.depender))
+	}
+	if e.narrowing != nil {
+		fmt.Fprintf(&buf, "With %s from %s, the intersection narrows to %s, which has no overlap with %s\n", depConstraintString(*e.narrowing), a2vs(e.narrowing.depender), e.narrowed.String(), e.goal.dep.Constraint.String())
 	}
 
 	return buf.String()
@@ -236,7 +285,7 @@ func (e *constraintNotAllowedFailure) Error() string {
 		"Could not introduce %s, as it has a dependency on %s with constraint %s, which does not allow the currently selected version of %s",
 		a2vs(e.goal.depender),
 		e.goal.dep.Ident,
-		e.goal.dep.Constraint,
+		depConstraintString(e.goal),
 		e.v,
 	)
 }
@@ -273,7 +322,7 @@ func (e *versionNotAllowedFailure) Error() string {
 		return fmt.Sprintf(
 			"Could not introduce %s, as it is not allowed by constraint %s from project %s.",
 			a2vs(e.goal),
-			e.failparent[0].dep.Constraint.String(),
+			depConstraintString(e.failparent[0]),
 			e.failparent[0].depender.id,
 		)
 	}
@@ -283,7 +332,7 @@ func (e *versionNotAllowedFailure) Error() string {
 	fmt.Fprintf(&buf, "Could not introduce %s, as it is not allowed by constraints from the following projects:\n", a2vs(e.goal))
 
 	for _, f := range e.failparent {
-		fmt.Fprintf(&buf, "\t%s from %s\n", f.dep.Constraint.String(), a2vs(f.depender))
+		fmt.Fprintf(&buf, "\t%s from %s\n", depConstraintString(f), a2vs(f.depender))
 	}
 
 	return buf.String()
@@ -300,6 +349,117 @@ func (e *versionNotAllowedFailure) traceString() string {
 	return buf.String()
 }
 
+// vetoedVersionFailure describes a failure where an atom is rejected because
+// the solver's ProjectHook vetoed its version.
+type vetoedVersionFailure struct {
+	goal atom
+	// note is the annotation attached to the veto, if any.
+	note string
+}
+
+func (e *vetoedVersionFailure) Error() string {
+	if e.note == "" {
+		return fmt.Sprintf("Could not introduce %s, as it was vetoed by policy.", a2vs(e.goal))
+	}
+	return fmt.Sprintf("Could not introduce %s, as it was vetoed by policy: %s", a2vs(e.goal), e.note)
+}
+
+func (e *vetoedVersionFailure) traceString() string {
+	if e.note == "" {
+		return fmt.Sprintf("%s vetoed by policy", a2vs(e.goal))
+	}
+	return fmt.Sprintf("%s vetoed by policy: %s", a2vs(e.goal), e.note)
+}
+
+// goVersionFailure describes a failure where an atom is rejected because its
+// manifest requires a newer Go toolchain than the target one, or names its
+// minimum in a form that cannot be understood.
+type goVersionFailure struct {
+	goal        atom
+	min, target string
+	// err is set if min could not be parsed.
+	err error
+}
+
+func (e *goVersionFailure) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("Could not introduce %s, as its minimum Go version is invalid: %s", a2vs(e.goal), e.err)
+	}
+	return fmt.Sprintf("Could not introduce %s, as it requires Go %s or newer, but the target is Go %s.", a2vs(e.goal), e.min, e.target)
+}
+
+func (e *goVersionFailure) traceString() string {
+	if e.err != nil {
+		return fmt.Sprintf("%s has an invalid minimum Go version: %s", a2vs(e.goal), e.err)
+	}
+	return fmt.Sprintf("%s requires Go %s, newer than target Go %s", a2vs(e.goal), e.min, e.target)
+}
+
+// policyPinFailure describes a failure where an atom is rejected because the
+// policy pin on its project does not admit its version.
+type policyPinFailure struct {
+	goal atom
+	pin  PolicyPin
+}
+
+func (e *policyPinFailure) Error() string {
+	return fmt.Sprintf("Could not introduce %s, as it is not admitted by the policy pin %s.", a2vs(e.goal), e.pin)
+}
+
+func (e *policyPinFailure) traceString() string {
+	return fmt.Sprintf("%s excluded by policy pin %s", a2vs(e.goal), e.pin)
+}
+
+// downgradeFailure describes a failure where an atom is rejected because it is
+// older than the version of its project in the root lock, and downgrades of
+// that project are forbidden.
+type downgradeFailure struct {
+	goal   atom
+	locked Version
+}
+
+func (e *downgradeFailure) Error() string {
+	return fmt.Sprintf("Could not introduce %s, as it is older than the locked version %s, and downgrades are forbidden for projects that are not explicitly being changed.", a2vs(e.goal), e.locked)
+}
+
+func (e *downgradeFailure) traceString() string {
+	return fmt.Sprintf("%s is a downgrade from locked %s", a2vs(e.goal), e.locked)
+}
+
+// majorVersionFailure describes a failure where an atom is rejected because
+// its major version is not reflected in its project's import path, and the
+// constraint on the project also admits earlier major versions.
+type majorVersionFailure struct {
+	goal atom
+	c    Constraint
+}
+
+func (e *majorVersionFailure) Error() string {
+	return fmt.Sprintf("Could not introduce %s, as its major version is not reflected in its import path, and the constraint %s also admits earlier major versions.", a2vs(e.goal), e.c)
+}
+
+func (e *majorVersionFailure) traceString() string {
+	return fmt.Sprintf("%s is a major version mismatch under %s", a2vs(e.goal), e.c)
+}
+
+// toolNotCommandFailure describes a failure where an atom is rejected because,
+// in a tools solve, packages it was to provide as tools are not commands.
+type toolNotCommandFailure struct {
+	goal atom
+	pkgs []string
+}
+
+func (e *toolNotCommandFailure) Error() string {
+	if len(e.pkgs) == 1 {
+		return fmt.Sprintf("Could not introduce %s, as its package %s is not a command, so cannot be built as a tool.", a2vs(e.goal), e.pkgs[0])
+	}
+	return fmt.Sprintf("Could not introduce %s, as its packages %s are not commands, so cannot be built as tools.", a2vs(e.goal), strings.Join(e.pkgs, ", "))
+}
+
+func (e *toolNotCommandFailure) traceString() string {
+	return fmt.Sprintf("%s: not commands: %s", a2vs(e.goal), strings.Join(e.pkgs, ", "))
+}
+
 type missingSourceFailure struct {
 	goal ProjectIdentifier
 	prob string
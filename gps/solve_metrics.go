@@ -0,0 +1,197 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SolveMetrics reports how a solve went about finding its solution, so that
+// the performance of solving can be tracked over time.
+type SolveMetrics struct {
+	// Duration is the wall time of the whole solve.
+	Duration time.Duration
+	// SourceTime is the part of Duration that the solver spent waiting on the
+	// SourceManager, and SolveTime is the rest.
+	SourceTime, SolveTime time.Duration
+	// VersionsAttempted is the number of versions of projects the solver
+	// tried to select, whether or not they were acceptable.
+	VersionsAttempted int
+	// Backtracks is the number of times the solver backtracked.
+	Backtracks int
+	// ConstraintChecks is the number of times the solver checked whether a
+	// version of a project satisfied the constraints on it.
+	ConstraintChecks int
+	// Cache counts the lookups of data about projects in the SourceManager's
+	// caches during the solve, if the SourceManager is a CacheCounter.
+	Cache CacheLookups
+	// Projects holds the metrics of each project the solver asked the
+	// SourceManager about.
+	Projects map[ProjectRoot]ProjectMetrics
+}
+
+// ProjectMetrics reports the part of a solve that concerned one project.
+type ProjectMetrics struct {
+	// SourceTime is the time the solver spent waiting on the SourceManager
+	// for the project, and SourceCalls the number of calls it made.
+	SourceTime  time.Duration
+	SourceCalls int
+	// VersionsAttempted is the number of versions of the project the solver
+	// tried to select.
+	VersionsAttempted int
+	// Cache counts the lookups of data about the project in the
+	// SourceManager's caches during the solve.
+	Cache CacheLookups
+}
+
+// CacheLookups counts the lookups of data in a cache.
+type CacheLookups struct {
+	Hits, Misses int64
+}
+
+// HitRate returns the fraction of the lookups that were hits, or zero if there
+// were none.
+func (c CacheLookups) HitRate() float64 {
+	if c.Hits+c.Misses == 0 {
+		return 0
+	}
+	return float64(c.Hits) / float64(c.Hits+c.Misses)
+}
+
+func (c CacheLookups) sub(o CacheLookups) CacheLookups {
+	return CacheLookups{Hits: c.Hits - o.Hits, Misses: c.Misses - o.Misses}
+}
+
+func (c CacheLookups) add(o CacheLookups) CacheLookups {
+	return CacheLookups{Hits: c.Hits + o.Hits, Misses: c.Misses + o.Misses}
+}
+
+// CacheCounter is implemented by SourceManagers that can report how often the
+// data they were asked for about projects - their versions, manifests and
+// locks, and package trees - was already in their caches. The solver reports
+// the lookups made during a solve in its SolveMetrics.
+type CacheCounter interface {
+	// CacheLookups returns the lookups of data about the source of the
+	// project over the lifetime of the SourceManager. It returns zero for
+	// sources that have not been contacted, and does not contact them.
+	CacheLookups(ProjectIdentifier) CacheLookups
+}
+
+// CacheLookups returns the lookups of data about the source of the project in
+// the SourceMgr's caches. It returns zero for sources the SourceMgr has not yet
+// set up.
+func (sm *SourceMgr) CacheLookups(id ProjectIdentifier) CacheLookups {
+	sg := sm.srcCoord.existingGatewayFor(id)
+	if sg == nil {
+		return CacheLookups{}
+	}
+	return CacheLookups{
+		Hits:   atomic.LoadInt64(&sg.hits),
+		Misses: atomic.LoadInt64(&sg.misses),
+	}
+}
+
+// countLookup records a lookup in the gateway's cache.
+func (sg *sourceGateway) countLookup(hit bool) {
+	if hit {
+		atomic.AddInt64(&sg.hits, 1)
+	} else {
+		atomic.AddInt64(&sg.misses, 1)
+	}
+}
+
+// solveMetrics returns the metrics of the solve so far.
+func (m *metrics) solveMetrics() SolveMetrics {
+	sm := SolveMetrics{
+		Duration:          time.Since(m.start),
+		VersionsAttempted: m.attempted,
+		Backtracks:        m.backtracks,
+		ConstraintChecks:  m.checks,
+		Projects:          make(map[ProjectRoot]ProjectMetrics, len(m.projects)),
+	}
+	for name, d := range m.times {
+		if strings.HasPrefix(name, sourceSegmentPrefix) {
+			sm.SourceTime += d
+		}
+	}
+	sm.SolveTime = sm.Duration - sm.SourceTime
+
+	for pr, pm := range m.projects {
+		sm.Projects[pr] = *pm
+	}
+	for id, d := range m.cache.lookups() {
+		pm := sm.Projects[id.ProjectRoot]
+		pm.Cache = pm.Cache.add(d)
+		sm.Projects[id.ProjectRoot] = pm
+		sm.Cache = sm.Cache.add(d)
+	}
+	return sm
+}
+
+// cacheMeter accounts for the lookups in the SourceManager's caches during a
+// solve, as reported by a CacheCounter, in the same way as a transferMeter does
+// for the bytes fetched.
+type cacheMeter struct {
+	cc CacheCounter
+
+	mu   sync.Mutex
+	base map[ProjectIdentifier]CacheLookups
+}
+
+func newCacheMeter(cc CacheCounter) *cacheMeter {
+	return &cacheMeter{
+		cc:   cc,
+		base: make(map[ProjectIdentifier]CacheLookups),
+	}
+}
+
+// watch records the lookups already made for the project, if it is not yet
+// being watched.
+func (cm *cacheMeter) watch(id ProjectIdentifier) {
+	if cm == nil {
+		return
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if _, has := cm.base[id]; !has {
+		cm.base[id] = cm.cc.CacheLookups(id)
+	}
+}
+
+// lookups returns the lookups made for each watched project since it was first
+// watched.
+func (cm *cacheMeter) lookups() map[ProjectIdentifier]CacheLookups {
+	if cm == nil {
+		return nil
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	made := make(map[ProjectIdentifier]CacheLookups, len(cm.base))
+	for id, base := range cm.base {
+		made[id] = cm.cc.CacheLookups(id).sub(base)
+	}
+	return made
+}
+
+// project returns the metrics of the project, creating them if need be.
+func (m *metrics) project(pr ProjectRoot) *ProjectMetrics {
+	pm, has := m.projects[pr]
+	if !has {
+		pm = &ProjectMetrics{}
+		m.projects[pr] = pm
+	}
+	return pm
+}
+
+// attempt records that a version of the project was tried.
+func (m *metrics) attempt(id ProjectIdentifier) {
+	m.attempted++
+	m.project(id.ProjectRoot).VersionsAttempted++
+}
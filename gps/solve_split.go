@@ -0,0 +1,190 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// splitTestSolver solves the projects that are needed only by the root
+// project's tests separately from those needed by the rest of the root
+// project. See SolveParameters.SplitTestDependencies.
+type splitTestSolver struct {
+	params SolveParameters
+	sm     SourceManager
+
+	// The solver for the build graph, which disregards the root's test
+	// imports.
+	build Solver
+
+	// The digest of the inputs to the complete solve.
+	hash []byte
+}
+
+// prepareSplitTests prepares a splitTestSolver. Prepare must already have
+// validated params.
+func prepareSplitTests(params SolveParameters, sm SourceManager) (Solver, error) {
+	params.SplitTestDependencies = false
+
+	bparams := params
+	bparams.RootPackageTree = withoutTestImports(params.RootPackageTree)
+	// Only the complete solve's alternatives and artifacts are of interest.
+	bparams.MaxSolutions = 0
+	bparams.Artifacts = ArtifactPolicy{}
+	// A successful build solve is followed by the complete one, which reports
+	// its own telemetry.
+	if bparams.Telemetry != nil {
+		bparams.Telemetry = failureTelemetry{bparams.Telemetry}
+	}
+
+	build, err := Prepare(bparams, sm)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := HashInputs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &splitTestSolver{
+		params: params,
+		sm:     sm,
+		build:  build,
+		hash:   hash,
+	}, nil
+}
+
+func (s *splitTestSolver) Solve(ctx context.Context) (Solution, error) {
+	bsoln, err := s.build.Solve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Solve again with the root's test imports, holding every project in the
+	// build graph at the version selected for it there. The lock leads with
+	// those selections so that they are tried first, and is otherwise the
+	// root lock, so that test-only projects still prefer their locked
+	// versions.
+	params := s.params
+	pins := make(map[ProjectRoot]Version)
+	lps := bsoln.Projects()
+	for _, lp := range lps {
+		pins[lp.Ident().ProjectRoot] = lp.Version()
+	}
+	if params.Lock != nil {
+		for _, lp := range params.Lock.Projects() {
+			if _, has := pins[lp.Ident().ProjectRoot]; !has {
+				lps = append(lps, lp)
+			}
+		}
+	}
+	var chng []ProjectRoot
+	for _, pr := range params.ToChange {
+		if _, has := pins[pr]; !has {
+			chng = append(chng, pr)
+		}
+	}
+
+	params.ProjectHook = pinningHook(params.ProjectHook, pins, "as selected for the build")
+	if params.Lock != nil || len(lps) > 0 {
+		params.Lock = safeLock{p: lps, i: bsoln.InputImports()}
+	}
+	params.ToChange = chng
+
+	solver, err := Prepare(params, s.sm)
+	if err != nil {
+		return nil, err
+	}
+	soln, err := solver.Solve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Report why, and under which constraints and policy pins, the projects
+	// in the build graph were selected there, rather than the pins that held
+	// them.
+	if sol, ok := soln.(solution); ok {
+		sol.att += bsoln.Attempts()
+		reasons, constraints := bsoln.SelectionReasons(), bsoln.AggregateConstraints()
+		for pr := range pins {
+			if r, has := reasons[pr]; has {
+				sol.reasons[pr] = r
+			}
+			if ac, has := constraints[pr]; has {
+				sol.constraints[pr] = ac
+			}
+			if bp, has := bsoln.PolicyPins()[pr]; has {
+				if sol.pinned == nil {
+					sol.pinned = make(map[ProjectRoot]BoundPolicyPin)
+				}
+				sol.pinned[pr] = bp
+			} else {
+				delete(sol.pinned, pr)
+			}
+		}
+		soln = sol
+	}
+	return soln, nil
+}
+
+func (s *splitTestSolver) Name() string {
+	return s.build.Name()
+}
+
+func (s *splitTestSolver) Version() int {
+	return s.build.Version()
+}
+
+func (s *splitTestSolver) HashInputs() []byte {
+	return s.hash
+}
+
+// withoutTestImports returns a copy of ptree in which no package has any test
+// imports.
+func withoutTestImports(ptree pkgtree.PackageTree) pkgtree.PackageTree {
+	return pkgtree.PackageTree{
+		ImportRoot: ptree.ImportRoot,
+		Aliases:    append([]string(nil), ptree.Aliases...),
+		Packages: pkgtree.CopyPackages(ptree.Packages, func(ip string, poe pkgtree.PackageOrErr) (string, pkgtree.PackageOrErr) {
+			poe.P.TestImports = nil
+			return ip, poe
+		}),
+	}
+}
+
+// pinningHook returns a ProjectHook that vetoes every candidate version of the
+// pinned projects other than the one they are pinned to, in addition to the
+// verdicts of hook, if any. The vetoes' notes give why as the reason.
+func pinningHook(hook ProjectHook, pins map[ProjectRoot]Version, why string) ProjectHook {
+	return func(entry ProjectEntry) map[Version]CandidateVerdict {
+		vm := make(map[Version]CandidateVerdict)
+		if hook != nil {
+			for v, verdict := range hook(entry) {
+				vm[v] = verdict
+			}
+		}
+
+		pin, has := pins[entry.Ident.ProjectRoot]
+		if !has {
+			return vm
+		}
+		for _, v := range entry.Candidates {
+			if pin.Matches(v) {
+				continue
+			}
+			verdict := vm[v]
+			verdict.Veto = true
+			if verdict.Note != "" {
+				verdict.Note += "; "
+			}
+			verdict.Note += fmt.Sprintf("held at %s, %s", pin, why)
+			vm[v] = verdict
+		}
+		return vm
+	}
+}
@@ -8,12 +8,20 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/golang/dep/gps/pkgtree"
 	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
 )
 
 // overrideMkBridge overrides the base bridge with the depspecBridge that skips
@@ -168,6 +176,12 @@ func fixtureSolveSimpleChecks(fix specfix, soln Solution, err error, t *testing.
 			t.Errorf("Solver completed in %v attempts, but expected %v or fewer", r.att, fix.maxTries())
 		}
 
+		for i := 1; i < len(r.p); i++ {
+			if !r.p[i-1].Ident().Less(r.p[i].Ident()) {
+				t.Errorf("Solution projects are not sorted: %s before %s", ppi(r.p[i-1].Ident()), ppi(r.p[i].Ident()))
+			}
+		}
+
 		// Dump result projects into a map for easier interrogation
 		rp := make(map[ProjectIdentifier]LockedProject)
 		for _, lp := range r.p {
@@ -260,3 +274,1414 @@ func TestRootLockNoVersionPairMatching(t *testing.T) {
 
 	fixtureSolveSimpleChecks(fix, res, err, t)
 }
+
+// malformedManifestSM reports a malformed manifest for specific versions of
+// projects.
+type malformedManifestSM struct {
+	*depspecSourceManager
+	bad map[ProjectRoot]Version
+}
+
+func (sm *malformedManifestSM) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
+	if bv, has := sm.bad[id.ProjectRoot]; has && bv.Matches(v) {
+		return nil, nil, errors.Wrap(MalformedManifestError{Err: errors.New("bad toml")}, "could not analyze")
+	}
+	return sm.depspecSourceManager.GetManifestAndLock(id, v, an)
+}
+
+func TestMalformedManifestPolicy(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.0.0", "b 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("b 1.0.0"),
+		},
+	}
+
+	cases := []struct {
+		pol  ManifestErrorPolicy
+		want map[ProjectRoot]string
+		fail bool
+	}{
+		{QuarantineMalformedManifests, map[ProjectRoot]string{"a": "1.0.0", "b": "1.0.0"}, false},
+		{IgnoreMalformedManifests, map[ProjectRoot]string{"a": "1.1.0"}, false},
+		{FailOnMalformedManifests, nil, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.pol.String(), func(t *testing.T) {
+			sm := &malformedManifestSM{
+				depspecSourceManager: newdepspecSM(fix.ds, nil),
+				bad:                  map[ProjectRoot]Version{"a": NewVersion("1.1.0")},
+			}
+			params := SolveParameters{
+				RootDir:             string(fix.ds[0].n),
+				RootPackageTree:     fix.rootTree(),
+				Manifest:            fix.rootmanifest(),
+				ProjectAnalyzer:     naiveAnalyzer{},
+				ManifestErrorPolicy: c.pol,
+			}
+
+			soln, err := fixSolve(params, sm, t)
+			if c.fail {
+				if err == nil {
+					t.Fatal("expected solve to fail")
+				}
+				if _, is := errors.Cause(err).(MalformedManifestError); !is {
+					t.Fatalf("expected a MalformedManifestError, got %T: %s", errors.Cause(err), err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected solve failure: %s", err)
+			}
+
+			got := make(map[ProjectRoot]string)
+			for _, lp := range soln.Projects() {
+				got[lp.Ident().ProjectRoot] = lp.Version().String()
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("unexpected solution:\n\t(GOT): %v\n\t(WNT): %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestProjectHook(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("a 2.0.0"),
+		},
+	}
+
+	solve := func(hook ProjectHook) (Solution, error) {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			ProjectHook:     hook,
+		}
+		return fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	}
+
+	var entries []ProjectEntry
+	soln, err := solve(func(e ProjectEntry) map[Version]CandidateVerdict {
+		entries = append(entries, e)
+		return map[Version]CandidateVerdict{
+			NewVersion("2.0.0"): {Veto: true, Note: "major version not approved"},
+			NewVersion("1.1.0"): {Note: "approved"},
+		}
+	})
+	if err != nil {
+		t.Fatalf("unexpected solve failure: %s", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("expected hook to be invoked once, got %d invocations", len(entries))
+	}
+	if e := entries[0]; e.Ident.ProjectRoot != "a" || len(e.Candidates) != 3 || e.Constraint.String() != "*" {
+		t.Errorf("unexpected project entry: %+v", e)
+	}
+	if lp := soln.Projects(); len(lp) != 1 || lp[0].Version().String() != "1.1.0" {
+		t.Errorf("expected a@1.1.0 to be selected, got %v", lp)
+	}
+
+	_, err = solve(func(e ProjectEntry) map[Version]CandidateVerdict {
+		vm := make(map[Version]CandidateVerdict)
+		for _, v := range e.Candidates {
+			vm[v] = CandidateVerdict{Veto: true}
+		}
+		return vm
+	})
+	if err == nil {
+		t.Fatal("expected solve to fail when every candidate is vetoed")
+	}
+	if !strings.Contains(err.Error(), "vetoed by policy") {
+		t.Errorf("expected failure to mention the veto, got: %s", err)
+	}
+}
+
+func TestAggregateConstraints(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a ^1.0.0", "b *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("a 1.2.0"),
+			mkDepspec("b 1.0.0", "a <1.2.0"),
+		},
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatalf("unexpected solve failure: %s", err)
+	}
+
+	acs := soln.AggregateConstraints()
+	if len(acs) != 2 {
+		t.Fatalf("expected aggregate constraints for 2 projects, got %v", acs)
+	}
+
+	ac := acs["a"]
+	var dependers []ProjectRoot
+	for _, dc := range ac.Dependers {
+		dependers = append(dependers, dc.Depender)
+	}
+	if !reflect.DeepEqual(dependers, []ProjectRoot{"b", "root"}) {
+		t.Errorf("unexpected dependers on a: %v", dependers)
+	}
+	for v, want := range map[string]bool{"1.0.0": true, "1.1.0": true, "1.2.0": false, "2.0.0": false} {
+		if got := ac.Constraint.Matches(NewVersion(v)); got != want {
+			t.Errorf("expected aggregate constraint %s to match %s: %v, got %v", ac.Constraint, v, want, got)
+		}
+	}
+}
+
+func TestSolveAlternatives(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a ^1.0.0", "b *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("b 1.0.0"),
+			mkDepspec("b 2.0.0", "a 1.1.0"),
+		},
+	}
+
+	versions := func(soln Solution) map[ProjectRoot]string {
+		vs := make(map[ProjectRoot]string)
+		for _, lp := range soln.Projects() {
+			vs[lp.Ident().ProjectRoot] = lp.Version().String()
+		}
+		return vs
+	}
+
+	for _, max := range []int{0, 2, 10} {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			MaxSolutions:    max,
+		}
+		soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+		if err != nil {
+			t.Fatalf("unexpected solve failure: %s", err)
+		}
+
+		// The preferred solution is unaffected by enumeration.
+		if got, want := versions(soln), map[ProjectRoot]string{"a": "1.1.0", "b": "2.0.0"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("MaxSolutions %v: unexpected preferred solution %v", max, got)
+		}
+
+		// There are only three solutions in all, as b 2.0.0 requires a 1.1.0.
+		wantAlts := []map[ProjectRoot]string{
+			{"a": "1.1.0", "b": "1.0.0"},
+			{"a": "1.0.0", "b": "1.0.0"},
+		}
+		switch max {
+		case 0:
+			wantAlts = nil
+		case 2:
+			wantAlts = wantAlts[:1]
+		}
+		var gotAlts []map[ProjectRoot]string
+		for _, alt := range soln.Alternatives() {
+			if len(alt.Alternatives()) != 0 {
+				t.Errorf("MaxSolutions %v: alternative solutions should not have alternatives", max)
+			}
+			gotAlts = append(gotAlts, versions(alt))
+		}
+		if !reflect.DeepEqual(gotAlts, wantAlts) {
+			t.Errorf("MaxSolutions %v: unexpected alternatives:\n\t(GOT): %v\n\t(WNT): %v", max, gotAlts, wantAlts)
+		}
+	}
+}
+
+// unreachableSM fails to list the versions of a single project, as though its
+// source could not be reached.
+type unreachableSM struct {
+	*depspecSourceManager
+	pr ProjectRoot
+}
+
+func (sm *unreachableSM) ListVersions(id ProjectIdentifier) ([]PairedVersion, error) {
+	if id.ProjectRoot == sm.pr {
+		return nil, &SourceUnreachableError{Ident: id, Err: errors.New("authentication failed")}
+	}
+	return sm.depspecSourceManager.ListVersions(id)
+}
+
+func TestSolveAbortsOnUnreachableSource(t *testing.T) {
+	// a has an older version that doesn't depend on b, which the solver would
+	// otherwise fall back to.
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.1.0", "b *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("b 1.0.0"),
+		},
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	sm := &unreachableSM{depspecSourceManager: newdepspecSM(fix.ds, nil), pr: "b"}
+	_, err := fixSolve(params, sm, t)
+	ue, ok := err.(*SourceUnreachableError)
+	if !ok {
+		t.Fatalf("expected solve to abort with a *SourceUnreachableError, got %T: %v", err, err)
+	}
+	if ue.Ident.ProjectRoot != "b" {
+		t.Errorf("expected b to be reported as unreachable, got %s", ue.Ident)
+	}
+}
+
+// deprecationSM reports a fixed set of deprecation notices for every project,
+// or fails to read them with err, if it is set.
+type deprecationSM struct {
+	*depspecSourceManager
+	ds  []Deprecation
+	err error
+}
+
+func (sm *deprecationSM) Deprecations(id ProjectIdentifier) ([]Deprecation, error) {
+	if sm.err != nil {
+		return nil, sm.err
+	}
+	return sm.ds, nil
+}
+
+// deprecationList is a DeprecationProvider that reports notices by project.
+type deprecationList map[ProjectRoot][]Deprecation
+
+func (dl deprecationList) Deprecations(id ProjectIdentifier) ([]Deprecation, error) {
+	return dl[id.ProjectRoot], nil
+}
+
+func TestDeprecatedVersions(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b >=2.0.0"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("b 1.0.0"),
+			mkDepspec("b 2.0.0"),
+		},
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+		Deprecations: deprecationList{
+			"a": {{Version: NewVersion("1.1.0"), Reason: "broken on windows"}},
+		},
+	}
+	sm := &deprecationSM{
+		depspecSourceManager: newdepspecSM(fix.ds, nil),
+		ds:                   []Deprecation{{Version: NewVersion("2.0.0"), Reason: "use 3.x"}},
+	}
+
+	soln, err := fixSolve(params, sm, t)
+	if err != nil {
+		t.Fatalf("unexpected solve failure: %s", err)
+	}
+
+	got := make(map[ProjectRoot]string)
+	for _, lp := range soln.Projects() {
+		got[lp.Ident().ProjectRoot] = lp.Version().String()
+	}
+	want := map[ProjectRoot]string{"a": "1.0.0", "b": "2.0.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected selected versions:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	// b's only acceptable version is deprecated, so it must be reported.
+	dm := soln.Deprecations()
+	if len(dm) != 1 || dm["b"].Reason != "use 3.x" {
+		t.Errorf("expected only b to be reported as deprecated, got %v", dm)
+	}
+
+	// Notices the SourceManager cannot read are treated as absent, rather than
+	// failing the solve.
+	sm.depspecSourceManager = newdepspecSM(fix.ds, nil)
+	sm.err = errors.New("no local repository")
+	if soln, err = fixSolve(params, sm, t); err != nil {
+		t.Fatalf("expected unreadable notices not to fail the solve, got %s", err)
+	}
+	if dm = soln.Deprecations(); len(dm) != 0 {
+		t.Errorf("expected no projects to be reported as deprecated, got %v", dm)
+	}
+}
+
+func TestNoDowngrades(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("b 1.0.0", "a <1.1.0"),
+		},
+		l: mklock("a 1.1.0"),
+	}
+
+	solve := func(nodown bool, chng ...ProjectRoot) (map[ProjectRoot]string, error) {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			Lock:            fix.l,
+			ToChange:        chng,
+			ProjectAnalyzer: naiveAnalyzer{},
+			NoDowngrades:    nodown,
+		}
+		soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+		if err != nil {
+			return nil, err
+		}
+		got := make(map[ProjectRoot]string)
+		for _, lp := range soln.Projects() {
+			got[lp.Ident().ProjectRoot] = lp.Version().String()
+		}
+		return got, nil
+	}
+
+	want := map[ProjectRoot]string{"a": "1.0.0", "b": "1.0.0"}
+	if got, err := solve(false); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("expected a to be downgraded when downgrades are allowed, got %v, %v", got, err)
+	}
+
+	if got, err := solve(true); err == nil {
+		t.Errorf("expected the solve to fail when it requires an unrequested downgrade, got %v", got)
+	}
+
+	if got, err := solve(true, "a"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("expected a to be downgraded when it is named for change, got %v, %v", got, err)
+	}
+}
+
+// scoreList is a VersionScorer that gives fixed scores by project.
+type scoreList map[ProjectRoot]map[Version]float64
+
+func (sl scoreList) ScoreVersions(id ProjectIdentifier, candidates []Version) (map[Version]float64, error) {
+	return sl[id.ProjectRoot], nil
+}
+
+func TestScoredVersions(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b >=2.0.0", "c *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("a 1.2.0"),
+			mkDepspec("b 1.0.0"),
+			mkDepspec("b 2.0.0"),
+			mkDepspec("b 2.1.0"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("c 1.1.0"),
+		},
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+		VersionScorer: scoreList{
+			"a": {NewVersion("1.1.0"): 2, NewVersion("1.0.0"): 1},
+			// The highest score goes to a version the constraint disallows.
+			"b": {NewVersion("1.0.0"): 5, NewVersion("2.0.0"): 1},
+			// Scores do not outweigh deprecation.
+			"c": {NewVersion("1.0.0"): 1},
+		},
+		Deprecations: deprecationList{
+			"c": {{Version: NewVersion("1.0.0"), Reason: "insecure"}},
+		},
+	}
+
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatalf("unexpected solve failure: %s", err)
+	}
+
+	got := make(map[ProjectRoot]string)
+	for _, lp := range soln.Projects() {
+		got[lp.Ident().ProjectRoot] = lp.Version().String()
+	}
+	want := map[ProjectRoot]string{"a": "1.1.0", "b": "2.0.0", "c": "1.1.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected selected versions:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
+
+// semverOnly is a VersionSelector that drops every version that is not a
+// semantic version, and tries prereleases after releases, for the projects it
+// holds; the last project's versions are all replaced with one that is not a
+// candidate.
+type semverOnly struct {
+	projects map[ProjectRoot]bool
+	bogus    ProjectRoot
+}
+
+func (so semverOnly) SelectVersions(id ProjectIdentifier, candidates []Version) ([]Version, error) {
+	if id.ProjectRoot == so.bogus {
+		return []Version{NewVersion("9.9.9")}, nil
+	}
+	if !so.projects[id.ProjectRoot] {
+		return candidates, nil
+	}
+
+	var rels, pres []Version
+	for _, v := range candidates {
+		sv, ok := v.(semVersion)
+		switch {
+		case !ok:
+		case sv.sv.Prerelease() != "":
+			pres = append(pres, v)
+		default:
+			rels = append(rels, v)
+		}
+	}
+	return append(pres, rels...), nil
+}
+
+func TestSelectedVersions(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0-rc.1"),
+			mkDepspec("a bmaster"),
+			mkDepspec("b 1.0.0"),
+			mkDepspec("b bmaster"),
+			mkDepspec("c 1.0.0"),
+		},
+	}
+
+	solve := func(sel VersionSelector) (map[ProjectRoot]string, error) {
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			VersionSelector: sel,
+		}
+		soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+		if err != nil {
+			return nil, err
+		}
+		got := make(map[ProjectRoot]string)
+		for _, lp := range soln.Projects() {
+			got[lp.Ident().ProjectRoot] = lp.Version().String()
+		}
+		return got, nil
+	}
+
+	// The selector puts a's prerelease first, and drops its branch; b, which
+	// it leaves alone, keeps its usual order.
+	got, err := solve(semverOnly{projects: map[ProjectRoot]bool{"a": true}})
+	want := map[ProjectRoot]string{"a": "1.1.0-rc.1", "b": "1.0.0"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected selected versions:\n\t(GOT): %v, %v\n\t(WNT): %v", got, err, want)
+	}
+
+	if got, err = solve(semverOnly{bogus: "b"}); err == nil {
+		t.Errorf("expected the solve to fail when the selector invents a version, got %v", got)
+	}
+}
+
+// lookupSM is a CacheCounter that counts every listing of a project's
+// versions as a hit in its cache.
+type lookupSM struct {
+	*depspecSourceManager
+	listed map[ProjectRoot]int64
+}
+
+func (sm *lookupSM) ListVersions(id ProjectIdentifier) ([]PairedVersion, error) {
+	sm.listed[id.ProjectRoot]++
+	return sm.depspecSourceManager.ListVersions(id)
+}
+
+func (sm *lookupSM) CacheLookups(id ProjectIdentifier) CacheLookups {
+	return CacheLookups{Hits: sm.listed[id.ProjectRoot]}
+}
+
+func TestSolveMetrics(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.0.0", "b 1.0.0"),
+			mkDepspec("a 2.0.0", "b 2.0.0"),
+			mkDepspec("b 1.0.0", "c *"),
+			mkDepspec("b 2.0.0", "c 2.0.0"),
+			mkDepspec("c 1.0.0"),
+		},
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	sm := &lookupSM{
+		depspecSourceManager: newdepspecSM(fix.ds, nil),
+		listed:               make(map[ProjectRoot]int64),
+	}
+	soln, err := fixSolve(params, sm, t)
+	if err != nil {
+		t.Fatalf("unexpected solve failure: %s", err)
+	}
+
+	m := soln.Metrics()
+	if m.Backtracks == 0 {
+		t.Error("expected the solve to have backtracked")
+	}
+	if m.VersionsAttempted < 5 || m.ConstraintChecks < m.VersionsAttempted {
+		t.Errorf("expected at least 5 versions attempted, each checked, got %d attempts and %d checks", m.VersionsAttempted, m.ConstraintChecks)
+	}
+	if m.SourceTime > m.Duration || m.SourceTime+m.SolveTime != m.Duration {
+		t.Errorf("expected source and solve time to make up the duration, got %v + %v of %v", m.SourceTime, m.SolveTime, m.Duration)
+	}
+
+	var attempted int
+	for _, pr := range []ProjectRoot{"a", "b", "c"} {
+		pm, has := m.Projects[pr]
+		if !has || pm.SourceCalls == 0 || pm.VersionsAttempted == 0 {
+			t.Errorf("expected metrics for %s, got %+v", pr, pm)
+		}
+		if pm.Cache.Hits != sm.listed[pr] {
+			t.Errorf("expected %d cache hits for %s, got %+v", sm.listed[pr], pr, pm.Cache)
+		}
+		attempted += pm.VersionsAttempted
+	}
+	if attempted != m.VersionsAttempted {
+		t.Errorf("expected the projects' attempts to add up to %d, got %d", m.VersionsAttempted, attempted)
+	}
+	if m.Cache.Hits != 3 || m.Cache.HitRate() != 1 {
+		t.Errorf("expected 3 cache hits and no misses, got %+v", m.Cache)
+	}
+}
+
+// prefetchSM records the projects for which SyncSourceFor is called, blocking
+// each call until release is closed, if it is set.
+type prefetchSM struct {
+	*depspecSourceManager
+	release chan struct{}
+	synced  chan ProjectRoot
+}
+
+func (sm *prefetchSM) SyncSourceFor(id ProjectIdentifier) error {
+	sm.synced <- id.ProjectRoot
+	if sm.release != nil {
+		<-sm.release
+	}
+	return nil
+}
+
+func TestPrefetchLock(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("b 1.0.0"),
+		},
+		l: mklock("a 1.0.0", "b 1.0.0"),
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		Lock:            fix.l,
+		ProjectAnalyzer: naiveAnalyzer{},
+		PrefetchLock:    true,
+		mkBridgeFn:      overrideMkBridge,
+		stdLibFn:        func(string) bool { return false },
+	}
+	sm := &prefetchSM{
+		depspecSourceManager: newdepspecSM(fix.ds, nil),
+		synced:               make(chan ProjectRoot, 2),
+	}
+	solv, err := Prepare(params, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drive the prefetch directly; a fixture solve is over long before any
+	// prefetching could help it.
+	s := solv.(*solver)
+	s.mtr = newMetrics()
+	pf := s.b.prefetchLock(context.Background())
+	s.mtr.prefetch = pf
+
+	got := make(map[ProjectRoot]bool)
+	for len(got) < 2 {
+		select {
+		case pr := <-sm.synced:
+			got[pr] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the lock to be prefetched, got %v", got)
+		}
+	}
+	if !got["a"] || !got["b"] {
+		t.Errorf("expected a and b to be prefetched, got %v", got)
+	}
+
+	for done := false; !done; time.Sleep(time.Millisecond) {
+		pf.mu.Lock()
+		done = !pf.fetches["a"].end.IsZero()
+		pf.mu.Unlock()
+	}
+	s.b.GetManifestAndLock(mkPI("a"), NewVersion("1.0.0"), naiveAnalyzer{})
+	s.b.GetManifestAndLock(mkPI("a"), NewVersion("1.1.0"), naiveAnalyzer{})
+	if total, ready, _ := pf.stats(); total != 2 || ready != 1 {
+		t.Errorf("expected 1 of 2 locked projects to be counted as ready, got %d of %d", ready, total)
+	}
+}
+
+func TestPrefetchLockCancel(t *testing.T) {
+	var deps, locked []string
+	var projects []depspec
+	for i := 0; i < 2*prefetchConcurrency; i++ {
+		n := fmt.Sprintf("p%02d", i)
+		deps = append(deps, n+" *")
+		locked = append(locked, n+" 1.0.0")
+		projects = append(projects, mkDepspec(n+" 1.0.0"))
+	}
+	fix := basicFixture{
+		ds: append([]depspec{mkDepspec("root 0.0.0", deps...)}, projects...),
+		l:  mklock(locked...),
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		Lock:            fix.l,
+		ProjectAnalyzer: naiveAnalyzer{},
+		PrefetchLock:    true,
+	}
+
+	sm := &prefetchSM{
+		depspecSourceManager: newdepspecSM(fix.ds, nil),
+		release:              make(chan struct{}),
+		synced:               make(chan ProjectRoot, len(locked)),
+	}
+	// The solve must not wait for the blocked prefetches.
+	if _, err := fixSolve(params, sm, t); err != nil {
+		t.Fatalf("unexpected solve failure: %s", err)
+	}
+	close(sm.release)
+
+	// Only the prefetches already in flight when the solve finished may run.
+	time.Sleep(10 * time.Millisecond)
+	if n := len(sm.synced); n > prefetchConcurrency {
+		t.Errorf("expected at most %d projects to be prefetched after the solve finished, got %d", prefetchConcurrency, n)
+	}
+}
+
+// externalManifest declares a set of packages to be satisfied externally.
+type externalManifest struct {
+	RootManifest
+	ext []string
+}
+
+func (m externalManifest) ExternalPackages() *pkgtree.IgnoredRuleset {
+	return pkgtree.NewIgnoredRuleset(m.ext)
+}
+
+func TestExternalPackages(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "gen.example/proto *"),
+			mkDepspec("a 1.0.0"),
+		},
+	}
+
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        externalManifest{RootManifest: fix.rootmanifest(), ext: []string{"gen.example/*"}},
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+
+	// No depspec exists for gen.example/proto, so the solve could only
+	// succeed if the solver leaves it alone.
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatalf("unexpected solve failure: %s", err)
+	}
+
+	if lp := soln.Projects(); len(lp) != 1 || lp[0].Ident().ProjectRoot != "a" {
+		t.Errorf("expected only a to be selected, got %v", lp)
+	}
+	if ii := soln.InputImports(); !reflect.DeepEqual(ii, []string{"a"}) {
+		t.Errorf("expected external imports to be excluded from input imports, got %v", ii)
+	}
+	if ei := soln.ExternalImports(); !reflect.DeepEqual(ei, []string{"gen.example/proto"}) {
+		t.Errorf("unexpected external imports: %v", ei)
+	}
+
+	params.Manifest = externalManifest{
+		RootManifest: simpleRootManifest{req: map[string]bool{"gen.example/proto": true}},
+		ext:          []string{"gen.example/*"},
+	}
+	if _, err = Prepare(params, newdepspecSM(fix.ds, nil)); err == nil {
+		t.Error("expected Prepare to fail when a package is both required and external")
+	}
+}
+
+// historySM lists versions as of a time according to fixed release dates.
+// Versions without a date are taken to have always existed. It records
+// whether any listing was made under a context that can be canceled.
+type historySM struct {
+	*depspecSourceManager
+	released   map[string]time.Time
+	cancelable bool
+}
+
+func (sm *historySM) ListVersionsAsOfContext(ctx context.Context, id ProjectIdentifier, t time.Time) ([]PairedVersion, error) {
+	if ctx.Done() != nil {
+		sm.cancelable = true
+	}
+	return sm.ListVersionsAsOf(id, t)
+}
+
+func (sm *historySM) ListVersionsAsOf(id ProjectIdentifier, t time.Time) ([]PairedVersion, error) {
+	pvl, err := sm.ListVersions(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var vl []PairedVersion
+	for _, pv := range pvl {
+		if rt, has := sm.released[string(id.ProjectRoot)+" "+pv.String()]; !has || !rt.After(t) {
+			vl = append(vl, pv)
+		}
+	}
+	return vl, nil
+}
+
+func TestSolveAsOf(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+		},
+	}
+
+	march := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+		AsOf:            march,
+	}
+	sm := &historySM{
+		depspecSourceManager: newdepspecSM(fix.ds, nil),
+		released:             map[string]time.Time{"a 1.1.0": march.AddDate(0, 1, 0)},
+	}
+
+	soln, err := fixSolve(params, sm, t)
+	if err != nil {
+		t.Fatalf("unexpected solve failure: %s", err)
+	}
+	if !sm.cancelable {
+		t.Error("expected versions to be listed under the solve's context")
+	}
+	if lp := soln.Projects(); len(lp) != 1 || lp[0].Version().String() != "1.0.0" {
+		t.Errorf("expected a@1.0.0 to be selected as of %s, got %v", march, lp)
+	}
+
+	if _, err = Prepare(params, newdepspecSM(fix.ds, nil)); err == nil {
+		t.Error("expected Prepare to fail when the SourceManager cannot list historical versions")
+	}
+}
+
+// artifactSM exports trees containing a binary file for selected projects,
+// which it excludes from them, as SourceMgr would, if exclude is set.
+type artifactSM struct {
+	*depspecSourceManager
+	binaries map[ProjectRoot]bool
+	exclude  bool
+}
+
+func (sm *artifactSM) ExportProject(ctx context.Context, id ProjectIdentifier, v Version, to string) error {
+	if err := sm.exportUnexcluded(ctx, id, v, to); err != nil {
+		return err
+	}
+	return excludeArtifacts(to, ArtifactPolicy{Binaries: true, Exclude: sm.exclude})
+}
+
+func (sm *artifactSM) exportUnexcluded(ctx context.Context, id ProjectIdentifier, v Version, to string) error {
+	if err := os.MkdirAll(to, 0777); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(to, "a.go"), []byte("package a"), 0666); err != nil {
+		return err
+	}
+	if sm.binaries[id.ProjectRoot] {
+		return ioutil.WriteFile(filepath.Join(to, "blob"), []byte{0, 1, 2}, 0666)
+	}
+	return nil
+}
+
+func TestSolutionArtifacts(t *testing.T) {
+	fix := basicFixtures["simple dependency tree"]
+	for _, pol := range []ArtifactPolicy{{}, {Binaries: true}, {Binaries: true, Exclude: true}} {
+		// Artifacts excluded from exported trees are reported all the same.
+		sm := &artifactSM{
+			depspecSourceManager: newdepspecSM(fix.ds, nil),
+			binaries:             map[ProjectRoot]bool{"aa": true, "bb": true},
+			exclude:              pol.Exclude,
+		}
+		params := SolveParameters{
+			RootDir:         string(fix.ds[0].n),
+			RootPackageTree: fix.rootTree(),
+			Manifest:        fix.rootmanifest(),
+			ProjectAnalyzer: naiveAnalyzer{},
+			Artifacts:       pol,
+		}
+
+		soln, err := fixSolve(params, sm, t)
+		if err != nil {
+			t.Fatalf("unexpected solve failure: %s", err)
+		}
+
+		var want map[ProjectRoot][]Artifact
+		if pol.Binaries {
+			blob := []Artifact{{Path: "blob", Size: 3, Binary: true}}
+			want = map[ProjectRoot][]Artifact{"aa": blob, "bb": blob}
+		}
+		if got := soln.Artifacts(); !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected artifacts with policy %+v:\n\t(GOT): %v\n\t(WNT): %v", pol, got, want)
+		}
+	}
+}
+
+func TestSelectionReasons(t *testing.T) {
+	cases := map[string]map[ProjectRoot]SelectionReason{
+		"with compatible locked dependency": {
+			"foo": SelectedFromLock,
+			"bar": SelectedByConstraint,
+		},
+		"override dep's constraint": {
+			"a": SelectedByConstraint,
+			"b": SelectedByOverride,
+		},
+	}
+
+	for name, want := range cases {
+		fix := basicFixtures[name]
+		t.Run(name, func(t *testing.T) {
+			soln, err := solveBasicsAndCheck(fix, t)
+			if err != nil {
+				t.Fatalf("unexpected solve failure: %s", err)
+			}
+
+			if got := soln.SelectionReasons(); !reflect.DeepEqual(got, want) {
+				t.Errorf("unexpected selection reasons:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSolutionMetadata(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a 1.0.0"),
+			mkDepspec("a 1.0.0", "b 1.0.0"),
+			mkDepspec("b 1.0.0"),
+		},
+	}
+	params := basicFixtureParams(fix)
+	params.ProjectMetadata = map[ProjectRoot]map[string]string{
+		"a":       {"owner": "team-a", "ticket": "https://example.com/T-1"},
+		"b":       {},
+		"missing": {"owner": "nobody"},
+	}
+
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatalf("unexpected solve failure: %s", err)
+	}
+
+	// Only the projects in the solution that have metadata are reported.
+	want := map[ProjectRoot]map[string]string{
+		"a": {"owner": "team-a", "ticket": "https://example.com/T-1"},
+	}
+	got := soln.Metadata()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected metadata:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+	got["a"]["owner"] = "changed"
+	if params.ProjectMetadata["a"]["owner"] != "team-a" {
+		t.Error("expected the solution's metadata not to share maps with the params")
+	}
+}
+
+func TestWarmStart(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			// The constraint on foo has changed since the lock was solved.
+			mkDepspec("root 0.0.0", "foo ^2.0.0", "bar *", "baz *"),
+			mkDepspec("foo 1.0.0", "bar 1.0.0"),
+			mkDepspec("foo 2.0.0", "bar ^1.0.0"),
+			mkDepspec("foo 2.1.0", "bar ^1.1.0"),
+			mkDepspec("bar 1.0.0"),
+			mkDepspec("bar 1.1.0"),
+			mkDepspec("baz 1.0.0"),
+			mkDepspec("baz 1.1.0"),
+		},
+		l: mklock(
+			"foo 1.0.0",
+			"bar 1.0.0",
+			"baz 1.0.0",
+		),
+	}
+	versions := func(soln Solution) map[ProjectRoot]string {
+		m := make(map[ProjectRoot]string)
+		for _, lp := range soln.Projects() {
+			m[lp.Ident().ProjectRoot] = lp.Version().String()
+		}
+		return m
+	}
+
+	// Holding bar at its locked version rules out foo 2.1.0.
+	params := basicFixtureParams(fix)
+	params.WarmStart = true
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[ProjectRoot]string{"foo": "2.0.0", "bar": "1.0.0", "baz": "1.0.0"}
+	if got := versions(soln); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected warm solution:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	// Without a solution in which bar is held, it must be allowed to change.
+	// The first solve's background syncs may still be reading its depspecs,
+	// so the second gets its own.
+	ds := append([]depspec(nil), fix.ds...)
+	ds[2] = mkDepspec("foo 2.0.0", "bar ^1.1.0")
+	soln, err = fixSolve(params, newdepspecSM(ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[ProjectRoot]string{"foo": "2.1.0", "bar": "1.1.0", "baz": "1.0.0"}
+	if got := versions(soln); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected solution after falling back:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
+
+func TestSplitTestDependencies(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "t *"),
+			mkDepspec("a 1.0.0"),
+			mkDepspec("a 1.1.0"),
+			mkDepspec("a 2.0.0"),
+			// The newest test framework would hold a back. Having fewer
+			// versions, it is selected first when solving all at once.
+			mkDepspec("t 1.1.0", "a <2.0.0"),
+			mkDepspec("t 1.0.0", "u *"),
+			mkDepspec("u 1.0.0"),
+		},
+	}
+
+	// The root imports t only from its tests.
+	ptree := fix.rootTree()
+	root := ptree.Packages["root"]
+	root.P.Imports, root.P.TestImports = []string{"a"}, []string{"t"}
+	ptree.Packages["root"] = root
+
+	params := SolveParameters{
+		RootDir:               string(fix.ds[0].n),
+		RootPackageTree:       ptree,
+		Manifest:              fix.rootmanifest(),
+		ProjectAnalyzer:       naiveAnalyzer{},
+		SplitTestDependencies: true,
+	}
+	versions := func(soln Solution) map[ProjectRoot]string {
+		m := make(map[ProjectRoot]string)
+		for _, lp := range soln.Projects() {
+			m[lp.Ident().ProjectRoot] = lp.Version().String()
+		}
+		return m
+	}
+
+	params.SplitTestDependencies = false
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[ProjectRoot]string{"a": "1.1.0", "t": "1.1.0"}
+	if got := versions(soln); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected solution without splitting:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	params.SplitTestDependencies = true
+	soln, err = fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = map[ProjectRoot]string{"a": "2.0.0", "t": "1.0.0", "u": "1.0.0"}
+	if got := versions(soln); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected solution:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	if r := soln.SelectionReasons()["a"]; r != SelectedByConstraint {
+		t.Errorf("expected a to be reported as selected by constraint, not %s", r)
+	}
+	if !reflect.DeepEqual(soln.InputImports(), []string{"a", "t"}) {
+		t.Errorf("expected the inputs to include test imports, got %v", soln.InputImports())
+	}
+}
+
+func TestMinimumGoVersion(t *testing.T) {
+	// withGo sets the minimum Go version of a depspec.
+	withGo := func(ds depspec, gov string) depspec {
+		ds.gov = gov
+		return ds
+	}
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			withGo(mkDepspec("a 1.0.0"), "1.9"),
+			withGo(mkDepspec("a 1.1.0"), "1.10"),
+			withGo(mkDepspec("a 1.2.0"), "1.11.2"),
+		},
+	}
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+
+	for gov, want := range map[string]string{
+		"":       "1.2.0",
+		"1.11.2": "1.2.0",
+		"1.11":   "1.1.0",
+		"1.10.8": "1.1.0",
+		"1.9":    "1.0.0",
+	} {
+		params.GoVersion = gov
+		soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+		if err != nil {
+			t.Errorf("Go %q: %s", gov, err)
+			continue
+		}
+		if got := soln.Projects()[0].Version().String(); got != want {
+			t.Errorf("Go %q: expected a %s to be selected, got %s", gov, want, got)
+		}
+	}
+
+	params.GoVersion = "1.8"
+	_, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err == nil {
+		t.Fatal("expected solving to fail when no version supports the target Go version")
+	}
+	if nve, ok := errors.Cause(err).(*noVersionError); !ok || len(nve.fails) != 3 {
+		t.Fatalf("expected all versions of a to fail, got %s", err)
+	} else if _, ok := nve.fails[0].f.(*goVersionFailure); !ok {
+		t.Errorf("expected a Go version failure, got %s", nve.fails[0].f)
+	}
+
+	params.GoVersion = "go1.10"
+	if _, err := Prepare(params, newdepspecSM(fix.ds, nil)); err == nil {
+		t.Error("expected an error preparing with an invalid Go version")
+	}
+}
+
+// commandsSM reports the root packages of the given fixture projects as
+// commands.
+type commandsSM struct {
+	*depspecSourceManager
+	cmds map[ProjectRoot]bool
+}
+
+func (sm *commandsSM) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
+	ptree, err := sm.depspecSourceManager.ListPackages(id, v)
+	if err != nil || !sm.cmds[id.ProjectRoot] {
+		return ptree, err
+	}
+	ptree.Packages = pkgtree.CopyPackages(ptree.Packages, func(ip string, poe pkgtree.PackageOrErr) (string, pkgtree.PackageOrErr) {
+		poe.P.Name = "main"
+		return ip, poe
+	})
+	return ptree, nil
+}
+
+func TestToolsSolve(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0"),
+			mkDepspec("tool 1.0.0", "lib *"),
+			mkDepspec("tool 1.1.0", "lib <2.0.0"),
+			mkDepspec("lib 1.0.0"),
+			mkDepspec("lib 2.0.0"),
+			mkDepspec("other 1.0.0"),
+		},
+	}
+	sm := &commandsSM{depspecSourceManager: newdepspecSM(fix.ds, nil), cmds: map[ProjectRoot]bool{"tool": true}}
+	params := SolveParameters{
+		ProjectAnalyzer: naiveAnalyzer{},
+		Tools:           []string{"tool"},
+	}
+
+	soln, err := fixSolve(params, sm, t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[ProjectRoot]string)
+	for _, lp := range soln.Projects() {
+		got[lp.Ident().ProjectRoot] = lp.Version().String()
+	}
+	want := map[ProjectRoot]string{"tool": "1.1.0", "lib": "1.0.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected solution:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+	if !reflect.DeepEqual(soln.InputImports(), []string{"tool"}) {
+		t.Errorf("expected the inputs to be the tools, got %v", soln.InputImports())
+	}
+
+	params.Tools = []string{"lib"}
+	_, err = fixSolve(params, sm, t)
+	if nve, ok := errors.Cause(err).(*noVersionError); !ok {
+		t.Errorf("expected solving for a package that is not a command to fail, got %v", err)
+	} else if _, ok := nve.fails[0].f.(*toolNotCommandFailure); !ok {
+		t.Errorf("expected a failure for a package that is not a command, got %s", nve.fails[0].f)
+	}
+
+	params.Tools = []string{"tool"}
+	params.RootPackageTree = fix.rootTree()
+	if _, err := fixSolve(params, sm, t); err == nil {
+		t.Error("expected an error solving for tools with a root package tree")
+	}
+
+	for _, tools := range [][]string{{"tool", "tool"}, {""}, {"tools.invalid/x"}, {"fmt"}} {
+		if _, _, err := toolsPackageTree(tools, nil); err == nil {
+			t.Errorf("expected an error preparing to solve for tools %q", tools)
+		}
+	}
+}
+
+// hangingSourceManager is a ContextSourceManager whose GetManifestAndLock hangs
+// until its context is done, as a stuck fetch would.
+type hangingSourceManager struct {
+	*depspecSourceManager
+}
+
+func (sm hangingSourceManager) SourceExistsContext(ctx context.Context, id ProjectIdentifier) (bool, error) {
+	return sm.SourceExists(id)
+}
+
+func (sm hangingSourceManager) SyncSourceForContext(ctx context.Context, id ProjectIdentifier) error {
+	return sm.SyncSourceFor(id)
+}
+
+func (sm hangingSourceManager) ListVersionsContext(ctx context.Context, id ProjectIdentifier) ([]PairedVersion, error) {
+	return sm.ListVersions(id)
+}
+
+func (sm hangingSourceManager) RevisionPresentInContext(ctx context.Context, id ProjectIdentifier, r Revision) (bool, error) {
+	return sm.RevisionPresentIn(id, r)
+}
+
+func (sm hangingSourceManager) VersionsForRevisionContext(ctx context.Context, id ProjectIdentifier, r Revision) ([]UnpairedVersion, error) {
+	return sm.VersionsForRevision(id, r)
+}
+
+func (sm hangingSourceManager) ListPackagesContext(ctx context.Context, id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
+	return sm.ListPackages(id, v)
+}
+
+func (sm hangingSourceManager) GetManifestAndLockContext(ctx context.Context, id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
+	<-ctx.Done()
+	return nil, nil, ctx.Err()
+}
+
+func (sm hangingSourceManager) DeduceProjectRootContext(ctx context.Context, ip string) (ProjectRoot, error) {
+	return sm.DeduceProjectRoot(ip)
+}
+
+func TestSolveCancelsSourceManagerOperations(t *testing.T) {
+	fix := basicFixtures["simple dependency tree"]
+	params := basicFixtureParams(fix)
+	params.stdLibFn = func(string) bool { return false }
+	params.mkBridgeFn = overrideMkBridge
+	s, err := Prepare(params, hangingSourceManager{newdepspecSM(fix.ds, nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Solve(ctx)
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Error("expected the solve to fail once its context was done")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("solve did not return after its context was done")
+	}
+}
+
+func TestWorkspaceSolve(t *testing.T) {
+	ds := []depspec{
+		mkDepspec("mono 0.0.0"),
+		mkDepspec("foo 1.0.0"),
+		mkDepspec("foo 1.1.0"),
+		mkDepspec("foo 2.0.0"),
+		mkDepspec("bar 1.0.0", "foo <2.0.0"),
+	}
+
+	member := func(root string, imports []string, c ProjectConstraints) WorkspaceMember {
+		return WorkspaceMember{
+			PackageTree: pkgtree.PackageTree{
+				ImportRoot: root,
+				Packages: map[string]pkgtree.PackageOrErr{
+					root: {P: pkgtree.Package{ImportPath: root, Name: "pkg", Imports: imports}},
+				},
+			},
+			Manifest: simpleRootManifest{c: c},
+		}
+	}
+	solve := func(members ...WorkspaceMember) (map[ProjectRoot]string, error) {
+		params := SolveParameters{
+			RootDir:         "mono",
+			Workspace:       members,
+			ProjectAnalyzer: naiveAnalyzer{},
+		}
+		soln, err := fixSolve(params, newdepspecSM(ds, nil), t)
+		if err != nil {
+			return nil, err
+		}
+		got := make(map[ProjectRoot]string)
+		for _, lp := range soln.Projects() {
+			got[lp.Ident().ProjectRoot] = lp.Version().String()
+		}
+		return got, nil
+	}
+
+	// b imports a, so it needs a's dependencies, too; both share one lock.
+	a := member("mono/a", []string{"foo"}, ProjectConstraints{"foo": {Constraint: mkSVC("^1.0.0")}})
+	got, err := solve(a, member("mono/b", []string{"bar", "mono/a"}, nil))
+	want := map[ProjectRoot]string{"foo": "1.1.0", "bar": "1.0.0"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected workspace solution:\n\t(GOT): %v, %v\n\t(WNT): %v", got, err, want)
+	}
+
+	// The members' constraints on foo conflict, and the failure says which
+	// members imposed them.
+	_, err = solve(a, member("mono/b", []string{"foo"}, ProjectConstraints{"foo": {Constraint: mkSVC("^2.0.0")}}))
+	sf, ok := err.(*SolveFailure)
+	if !ok {
+		t.Fatalf("expected conflicting workspace members to fail to solve with a *SolveFailure, got %v", err)
+	}
+	for _, m := range []string{"^1.0.0 from (workspace member mono/a)", "^2.0.0 from (workspace member mono/b)"} {
+		if !strings.Contains(sf.String(), m) {
+			t.Errorf("expected the failure to name %s, got:\n%s", m, sf)
+		}
+	}
+
+	if _, err = solve(a, member("mono/a/sub", nil, nil)); err == nil {
+		t.Error("expected overlapping workspace members to be rejected")
+	}
+}
+
+// backgroundSM is a depspecSourceManager that counts the work the solver asks
+// of it in the background.
+type backgroundSM struct {
+	*depspecSourceManager
+	mu                sync.Mutex
+	syncs, prefetches int
+}
+
+func (sm *backgroundSM) SyncSourceFor(id ProjectIdentifier) error {
+	sm.mu.Lock()
+	sm.syncs++
+	sm.mu.Unlock()
+	return sm.depspecSourceManager.SyncSourceFor(id)
+}
+
+func (sm *backgroundSM) PrefetchVersions(ids []ProjectIdentifier) {
+	sm.mu.Lock()
+	sm.prefetches += len(ids)
+	sm.mu.Unlock()
+}
+
+func TestDeterministicSolve(t *testing.T) {
+	ds := []depspec{
+		mkDepspec("root 0.0.0", "a ^1.0.0", "b ^1.0.0"),
+		mkDepspec("a 1.0.0", "c ^1.0.0"),
+		mkDepspec("a 1.1.0", "c ^2.0.0"),
+		mkDepspec("b 1.0.0", "c ^1.0.0"),
+		mkDepspec("b 1.1.0", "c ^1.1.0"),
+		mkDepspec("c 1.0.0"),
+		mkDepspec("c 1.1.0"),
+		mkDepspec("c 2.0.0"),
+	}
+	params := SolveParameters{
+		RootDir:         "root",
+		RootPackageTree: rootImporting("a", "b"),
+		Manifest:        simpleRootManifest{c: ProjectConstraints{"a": {Constraint: mkSVC("^1.0.0")}, "b": {Constraint: mkSVC("^1.0.0")}}},
+		ProjectAnalyzer: naiveAnalyzer{},
+		PrefetchLock:    true,
+		Deterministic:   true,
+	}
+
+	var first Solution
+	for i := 0; i < 5; i++ {
+		sm := &backgroundSM{depspecSourceManager: newdepspecSM(ds, nil)}
+		soln, err := fixSolve(params, sm, t)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Give anything started in the background the chance to run.
+		time.Sleep(10 * time.Millisecond)
+		sm.mu.Lock()
+		syncs, prefetches := sm.syncs, sm.prefetches
+		sm.mu.Unlock()
+		if syncs != 0 || prefetches != 0 {
+			t.Errorf("expected nothing to be fetched in the background, got %d syncs and %d prefetches", syncs, prefetches)
+		}
+
+		if first == nil {
+			first = soln
+			continue
+		}
+		if !reflect.DeepEqual(soln.Projects(), first.Projects()) || soln.Attempts() != first.Attempts() {
+			t.Errorf("expected identical solutions, got %v in %d attempts and %v in %d", first.Projects(), first.Attempts(), soln.Projects(), soln.Attempts())
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+)
+
+// warmSolver solves with the locked projects that are unaffected by changes
+// to the root's inputs held at their locked versions, and falls back to an
+// ordinary solve if that fails. See SolveParameters.WarmStart.
+type warmSolver struct {
+	// The solver for the warm start, and the one to fall back to.
+	warm, full Solver
+}
+
+// prepareWarmStart prepares a warmSolver. Prepare must already have validated
+// params, producing rd. If no project can be held, or alternative solutions
+// are wanted, which holding projects would hide, an ordinary Solver is
+// returned.
+func prepareWarmStart(params SolveParameters, sm SourceManager, rd rootdata) (Solver, error) {
+	params.WarmStart = false
+	full, err := Prepare(params, sm)
+	if err != nil {
+		return nil, err
+	}
+
+	held := rd.heldForWarmStart()
+	if len(held) == 0 || params.MaxSolutions > 0 {
+		return full, nil
+	}
+
+	wparams := params
+	wparams.ProjectHook = pinningHook(params.ProjectHook, held, "as locked, for a warm start")
+	// A failed warm start is followed by the ordinary solve, which reports
+	// its own telemetry.
+	if wparams.Telemetry != nil {
+		wparams.Telemetry = successTelemetry{wparams.Telemetry}
+	}
+
+	warm, err := Prepare(wparams, sm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &warmSolver{
+		warm: warm,
+		full: full,
+	}, nil
+}
+
+// heldForWarmStart returns the versions at which a warm start holds projects:
+// those of the projects in the lock that are not to change, and whose locked
+// versions the root project's constraints still admit.
+func (rd rootdata) heldForWarmStart() map[ProjectRoot]Version {
+	cm := rd.rootConstraints()
+	held := make(map[ProjectRoot]Version)
+	for pr, lp := range rd.rlm {
+		if _, has := rd.chng[pr]; has || rd.changesAll(pr) {
+			continue
+		}
+		if c, has := cm[pr]; has && !c.Matches(lp.Version()) {
+			continue
+		}
+		held[pr] = lp.Version()
+	}
+	return held
+}
+
+func (s *warmSolver) Solve(ctx context.Context) (Solution, error) {
+	soln, err := s.warm.Solve(ctx)
+	if err == nil || ctx.Err() != nil {
+		return soln, err
+	}
+	return s.full.Solve(ctx)
+}
+
+func (s *warmSolver) Name() string {
+	return s.full.Name()
+}
+
+func (s *warmSolver) Version() int {
+	return s.full.Version()
+}
+
+func (s *warmSolver) HashInputs() []byte {
+	return s.full.HashInputs()
+}
@@ -8,11 +8,16 @@ import (
 	"container/heap"
 	"context"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/armon/go-radix"
 	"github.com/golang/dep/gps/paths"
@@ -24,8 +29,8 @@ var rootRev = Revision("")
 
 // SolveParameters hold all arguments to a solver run.
 //
-// Only RootDir and RootPackageTree are absolutely required. A nil Manifest is
-// allowed, though it usually makes little sense.
+// Only RootDir and RootPackageTree are absolutely required, unless Tools is
+// set. A nil Manifest is allowed, though it usually makes little sense.
 //
 // Of these properties, only the Manifest and RootPackageTree are (directly)
 // incorporated in memoization hashing.
@@ -37,7 +42,7 @@ type SolveParameters struct {
 	// In general, it is wise for this to be under an active GOPATH, though it
 	// is not (currently) required.
 	//
-	// A real path to a readable directory is required.
+	// A real path to a readable directory is required, unless Tools is set.
 	RootDir string
 
 	// The ProjectAnalyzer is responsible for extracting Manifest and
@@ -54,9 +59,30 @@ type SolveParameters struct {
 	// directly through here.
 	//
 	// The ImportRoot property must be a non-empty string, and at least one
-	// element must be present in the Packages map.
+	// element must be present in the Packages map, unless Tools is set.
 	RootPackageTree pkgtree.PackageTree
 
+	// Tools, if set, is a list of the import paths of commands - main
+	// packages - to solve for, instead of a root project. The root is then
+	// a synthetic project, with no code of its own, that imports exactly
+	// these packages, so the solution holds just what is needed to build
+	// them. RootPackageTree must be empty, and RootDir may be, in which case
+	// there is no vendor directory to consult. The Manifest and Lock, if
+	// any, apply to the synthetic root as usual.
+	Tools []string
+
+	// Workspace, if set, lists the root projects to solve for at once, in
+	// place of a single one, so that they share one set of dependency
+	// versions. The root is then the project that holds the packages of all
+	// the members, beneath the longest import path that they have in common,
+	// and whose manifest merges theirs: the constraints of members on the
+	// same project are intersected, and their overrides, ignores and
+	// requires combined. Constraints are still attributed to the member
+	// declaring them, so conflicts between members are reported as such.
+	// RootPackageTree and Manifest must be empty; RootDir is the directory
+	// of the workspace, and the Lock, if any, the one its members share.
+	Workspace []WorkspaceMember
+
 	// The root manifest. This contains all the dependency constraints
 	// associated with normal Manifests, as well as the particular controls
 	// afforded only to the root project.
@@ -84,14 +110,215 @@ type SolveParameters struct {
 	// versions specified in the root lock file should be ignored.
 	ChangeAll bool
 
+	// ChangeAllExcept, if set, changes every project as ChangeAll does, save
+	// for those it names, whose versions in the lock are preserved as they
+	// would be without ChangeAll. It is the inverse of ToChange, and may not be
+	// combined with it or with ChangeAll. See UpgradeAllExcept, which reports
+	// how far each project got.
+	ChangeAllExcept []ProjectRoot
+
 	// Downgrade indicates whether the solver will attempt to upgrade (false) or
 	// downgrade (true) projects that are not locked, or are marked for change.
 	//
 	// Upgrading is, by far, the most typical case. The field is named
 	// 'Downgrade' so that the bool's zero value corresponds to that most
-	// typical case.
+	// typical case. It has no effect unless Preference is PreferLocked.
 	Downgrade bool
 
+	// Preference determines which admissible versions the solver tries first.
+	// By default, locked versions are tried before all others. PreferNewest
+	// and PreferOldest disregard the lock, exactly as though ChangeAll were
+	// set, and select the newest or the minimal versions satisfying all
+	// constraints, respectively. NoDowngrades still applies.
+	Preference VersionPreference
+
+	// ManifestErrorPolicy determines how the solver responds when the manifest
+	// of a candidate version of a dependency is malformed. It only has an
+	// effect if the ProjectAnalyzer reports such manifests with a
+	// MalformedManifestError.
+	ManifestErrorPolicy ManifestErrorPolicy
+
+	// ProjectHook, if set, is invoked the first time each project enters the
+	// solve, and may veto or annotate that project's candidate versions.
+	ProjectHook ProjectHook
+
+	// Listener, if set, is notified of the progress of the solve as it
+	// selects, rejects and backtracks over versions, and syncs sources.
+	Listener SolveListener
+
+	// Artifacts determines which files - typically committed binaries and
+	// unusually large files - are reported by Solution.Artifacts. If it flags
+	// anything, every selected project is exported to a temporary directory
+	// and scanned once solving succeeds, so this is relatively expensive.
+	Artifacts ArtifactPolicy
+
+	// Deprecations, if set, supplies deprecation notices for the versions of
+	// projects in addition to any supplied by the SourceManager. The solver
+	// prefers versions that are not deprecated over those that are, though a
+	// deprecated version may still be selected if it is locked or no other
+	// version is acceptable; such selections are reported by
+	// Solution.Deprecations.
+	Deprecations DeprecationProvider
+
+	// VersionScorer, if set, weights the candidate versions of each project,
+	// and the solver tries the acceptable versions with the highest scores
+	// first. Locked versions are still tried before all others.
+	VersionScorer VersionScorer
+
+	// VersionSelector, if set, filters and orders the candidate versions of
+	// each project, after any VersionScorer has weighted them. Locked
+	// versions are still tried before all others, whether or not they are
+	// selected.
+	VersionSelector VersionSelector
+
+	// NoDowngrades, if set, forbids the solver from selecting a version of a
+	// project in the root lock that is older than its locked version, unless
+	// the project is named in ToChange. ChangeAll does not count as naming
+	// any project. Only semantic versions are compared; a move between a
+	// semantic version and a branch or revision is never considered a
+	// downgrade. It has no effect if AsOf is set.
+	NoDowngrades bool
+
+	// MajorVersions determines whether versions with a major version of 2 or
+	// more are admissible for projects whose import paths do not carry one,
+	// under constraints that also admit earlier major versions. By default,
+	// they are admissible like any other version.
+	MajorVersions MajorVersionPolicy
+
+	// PolicyPins caps, for each project root, the project to the versions
+	// that its pin's constraint admits, wherever the project appears in the
+	// depgraph. The pins are typically supplied by a central service that
+	// vets versions, and take precedence over both the constraints of any
+	// project, including the root's overrides, and the root lock. Pins that
+	// exclude versions that would otherwise have been selectable are
+	// reported by Solution.PolicyPins.
+	PolicyPins map[ProjectRoot]PolicyPin
+
+	// Prereleases determines which prerelease versions semver constraints
+	// admit. By default, they admit them only as the semver package does,
+	// which is rarely: ^1.0.0 does not admit 1.1.0-rc.1. Constraints given
+	// their own policy with WithPrereleasePolicy are subject to this one
+	// instead. Admissible prereleases are still only selected if no release
+	// is acceptable, as releases are always tried first.
+	Prereleases PrereleasePolicy
+
+	// PrefetchLock, if set, causes the solver to begin fetching every project
+	// in the root lock, in parallel, as soon as solving starts, as the solver
+	// is very likely to need them. The package tree of each project at its
+	// locked version is fetched, too, unless the project is to be changed.
+	// Prefetching stops when the solve finishes or its context is canceled.
+	// The time it saved is reported with the other metrics in the trace.
+	PrefetchLock bool
+
+	// Deterministic, if set, makes the solve's course depend only on its
+	// inputs and on what the SourceManager reports, so that solves of the
+	// same inputs against the same sources make the same choices in the same
+	// order, and produce identical solutions. The dependencies of each
+	// project are considered in the order of their roots, and nothing is
+	// fetched in the background: sources are synced, and their versions
+	// listed, only when the solver needs them, and PrefetchLock is ignored.
+	// Solving is correspondingly slower.
+	Deterministic bool
+
+	// FetchBudget, if positive, is the maximum number of bytes the solve may
+	// fetch from upstream sources. Once more have been fetched, the solve is
+	// abandoned with a *FetchBudgetError. The SourceManager must be a
+	// TransferCounter. Whether or not a budget is set, the bytes fetched for
+	// each project are reported with the other metrics in the trace, if the
+	// SourceManager can count them.
+	FetchBudget int64
+
+	// SourceFallbacks is an experimental option that lists, for each project
+	// root, fallback sources - typically known forks - to use if the
+	// project's declared source cannot be reached. A fallback is only used if
+	// the project is in the root lock, and the fallback contains its locked
+	// revision; only the versions at that revision are then considered. The
+	// solution records the source actually used in each LockedProject, and
+	// reports every substitution made through Solution.Substitutions.
+	SourceFallbacks map[ProjectRoot][]string
+
+	// ProjectMetadata holds arbitrary key/value metadata for the root
+	// project's dependencies, such as the team that owns each one or why it
+	// is needed. The solver does not interpret it, but passes it through to
+	// Solution.Metadata for the projects that are in the solution.
+	ProjectMetadata map[ProjectRoot]map[string]string
+
+	// VersionSnapshot, if set, supplies the versions of the projects it
+	// covers, which the solver then uses instead of listing them from the
+	// SourceManager, so that versions published since the snapshot was
+	// captured cannot be selected. Projects it does not cover are listed as
+	// usual. It cannot be combined with AsOf.
+	VersionSnapshot VersionSnapshot
+
+	// CaptureVersions, if set, causes the solver to record the versions it
+	// sees for each project, and report them through Solution.VersionSnapshot
+	// for use in later solves. The versions of every project in the solution
+	// are captured, so those selected straight from the lock are listed once
+	// solving succeeds.
+	CaptureVersions bool
+
+	// AsOf, if non-zero, restricts the candidate versions of every project to
+	// those that existed at the given time, so that a past solve can be
+	// approximately reproduced. The root lock is disregarded, exactly as
+	// though ChangeAll were set, and the SourceManager must be a
+	// HistoricalVersionLister.
+	AsOf time.Time
+
+	// MaxSolutions, if greater than one, causes the solver to continue
+	// searching once it has found its preferred solution, until it has found
+	// up to this many distinct solutions in total. The additional solutions
+	// are reported by Solution.Alternatives, in the order in which they were
+	// found. Each one requires at least one further backtrack, so large values
+	// can be slow.
+	MaxSolutions int
+
+	// SplitTestDependencies, if set, solves the projects that are imported
+	// only by the root project's tests separately from those its other code
+	// needs. The build graph is solved first, as though the root had no test
+	// imports, so that test frameworks and their dependencies cannot force
+	// different versions onto it. The test-only projects are then solved
+	// around the build graph: projects that appear in both graphs keep the
+	// versions selected for the build, while the rest are constrained only by
+	// the root manifest and the test graph itself.
+	SplitTestDependencies bool
+
+	// WarmStart, if set, first attempts to solve with each project in the
+	// Lock held at its locked version, save for those that are to change and
+	// those whose locked versions the root project's constraints no longer
+	// admit. When only a few of the root's constraints have changed since the
+	// Lock was solved, only the projects they affect need be reconsidered,
+	// which is much faster than solving from scratch. If no such solution
+	// exists, the solver falls back to an ordinary solve, so the outcome
+	// differs only in that the held projects keep their locked versions
+	// wherever possible.
+	WarmStart bool
+
+	// GoVersion, if set, is the version of the Go toolchain with which the
+	// solution is to be built, as a major.minor[.patch] version such as
+	// "1.10". Versions of projects whose manifests are GoVersionManifests
+	// requiring a newer toolchain are not selected.
+	GoVersion string
+
+	// BuildContexts, if set, are the platforms and build tags for which the
+	// solution is to be built. The imports of the files of the root project,
+	// and of its dependencies, that are built in none of them are disregarded,
+	// so that, say, Windows-only dependencies are not required of a solution
+	// for Linux. By default, the imports of all files count, across all
+	// platforms. See pkgtree.PackageTree.ForContexts.
+	BuildContexts []pkgtree.BuildContext
+
+	// Telemetry, if set, is sent a summary of the solve once it finishes, for
+	// aggregation across many projects. The summary is limited to counts,
+	// timings and the class of any failure; it names no projects, save for
+	// those matching TelemetryAllowlist.
+	Telemetry TelemetrySink
+
+	// TelemetryAllowlist is a comma-separated list of GOPRIVATE-style glob
+	// patterns of the project roots that may be named in telemetry, such as
+	// "github.com/myorg". By default, none are. Roots that the SourceManager
+	// reports as private are never named; see PrivacyChecker.
+	TelemetryAllowlist string
+
 	// TraceLogger is the logger to use for generating trace output. If set, the
 	// solver will generate informative trace output as it moves through the
 	// solving process.
@@ -163,24 +390,157 @@ type solver struct {
 	// Indicates whether the solver has been run. It is invalid to run this type
 	// of solver more than once.
 	hasrun int32
+
+	// Whether the solver is being run one step at a time, and whether those
+	// steps have finished.
+	stepping, stepped bool
+
+	// The versions to try first for each project, while restoring from a
+	// SolverCheckpoint.
+	replay map[ProjectIdentifier]Version
+
+	// The policy to apply when a dependency's manifest is malformed.
+	mfpol ManifestErrorPolicy
+
+	// Atoms with malformed manifests that have already been reported in the
+	// trace, so that ignored manifests only produce one warning.
+	mfwarned map[atom]bool
+
+	// A fatal error, encountered during solving, that should be returned
+	// instead of whatever error is produced by unwinding.
+	fatal error
+
+	// Every rejection of a version so far, for reporting in a SolveFailure.
+	rejections []Rejection
+
+	// The requirements relaxed to Any() while minimizing a conflict, by the
+	// project that imposes them and then the dependency they are imposed on.
+	relaxed map[ProjectRoot]map[ProjectRoot]bool
+
+	// Cancels the context under which the current solve is running.
+	cancel context.CancelFunc
+
+	// The hook to consult for policy verdicts on candidate versions, and the
+	// verdicts it has returned for each project so far.
+	hook     ProjectHook
+	verdicts map[ProjectRoot]map[Version]CandidateVerdict
+
+	// Where to deliver events describing the progress of the solve.
+	events *eventSink
+
+	// The policy under which to scan selected projects for artifacts.
+	artpol ArtifactPolicy
+
+	// An additional source of deprecation notices.
+	deprp DeprecationProvider
+
+	// The scorer by which to order candidate versions, if any.
+	scorer VersionScorer
+
+	// The selector by which to filter and order candidate versions, if any.
+	selector VersionSelector
+
+	// The sink to report a summary of the solve to, if any, the patterns of
+	// the project roots it may name, and what knows which of those are
+	// private nonetheless.
+	telemetry  TelemetrySink
+	telemAllow string
+	telemPriv  PrivacyChecker
+
+	// Whether to prefetch the projects in the root lock before solving.
+	prefetch bool
+
+	// Whether to solve deterministically, as described on
+	// SolveParameters.Deterministic.
+	determ bool
+
+	// Whether locked projects not named in ToChange may be downgraded.
+	nodown bool
+
+	// The policy pins on projects, and the versions they have excluded so
+	// far.
+	pins   map[ProjectRoot]PolicyPin
+	pinned map[ProjectRoot][]Version
+
+	// Which admissible versions to try first.
+	pref VersionPreference
+
+	// The policy for major versions not reflected in import paths.
+	majpol MajorVersionPolicy
+
+	// The maximum number of bytes to fetch from upstream sources, if positive.
+	fetchBudget int64
+
+	// The fallback sources for projects whose own cannot be reached.
+	fallbacks map[ProjectRoot][]string
+
+	// The metadata to pass through for projects in the solution.
+	meta map[ProjectRoot]map[string]string
+
+	// The versions to use for the projects it covers, if any.
+	vsnap VersionSnapshot
+
+	// Whether to capture the versions listed for the solution.
+	capture bool
+
+	// If non-zero, the time at which candidate versions must have existed.
+	asOf time.Time
+
+	// The maximum number of solutions to find, including the preferred one.
+	maxSolns int
+
+	// The version of the Go toolchain that selected projects must support,
+	// if any, as given and as parsed.
+	gover  string
+	goverp goVersion
+
+	// The build contexts to which package trees are restricted, if any.
+	ctxs []pkgtree.BuildContext
+
+	// The roots of the projects containing the paths on which constraints
+	// have been declared, as they have been deduced.
+	croots map[ProjectRoot]ProjectRoot
 }
 
 func (params SolveParameters) toRootdata() (rootdata, error) {
 	if params.ProjectAnalyzer == nil {
 		return rootdata{}, badOptsFailure("must provide a ProjectAnalyzer")
 	}
-	if params.RootDir == "" {
-		return rootdata{}, badOptsFailure("params must specify a non-empty root directory")
-	}
-	if params.RootPackageTree.ImportRoot == "" {
-		return rootdata{}, badOptsFailure("params must include a non-empty import root")
+	if len(params.Workspace) > 0 {
+		if len(params.Tools) > 0 || params.RootPackageTree.ImportRoot != "" || len(params.RootPackageTree.Packages) != 0 || params.Manifest != nil {
+			return rootdata{}, badOptsFailure("params may not include a Workspace along with Tools, a RootPackageTree or a Manifest")
+		}
+		var err error
+		if params.RootPackageTree, params.Manifest, err = mergeWorkspace(params.Workspace); err != nil {
+			return rootdata{}, err
+		}
 	}
-	if len(params.RootPackageTree.Packages) == 0 {
-		return rootdata{}, badOptsFailure("at least one package must be present in the PackageTree")
+	var tools map[string]bool
+	if len(params.Tools) > 0 {
+		if params.RootPackageTree.ImportRoot != "" || len(params.RootPackageTree.Packages) != 0 {
+			return rootdata{}, badOptsFailure("params may not include both Tools and a RootPackageTree")
+		}
+		var err error
+		if params.RootPackageTree, tools, err = toolsPackageTree(params.Tools, params.stdLibFn); err != nil {
+			return rootdata{}, err
+		}
+	} else {
+		if params.RootDir == "" {
+			return rootdata{}, badOptsFailure("params must specify a non-empty root directory")
+		}
+		if params.RootPackageTree.ImportRoot == "" {
+			return rootdata{}, badOptsFailure("params must include a non-empty import root")
+		}
+		if len(params.RootPackageTree.Packages) == 0 {
+			return rootdata{}, badOptsFailure("at least one package must be present in the PackageTree")
+		}
 	}
 	if params.Lock == nil && len(params.ToChange) != 0 {
 		return rootdata{}, badOptsFailure(fmt.Sprintf("update specifically requested for %s, but no lock was provided to upgrade from", params.ToChange))
 	}
+	if len(params.ChangeAllExcept) != 0 && (params.ChangeAll || len(params.ToChange) != 0) {
+		return rootdata{}, badOptsFailure("ChangeAllExcept may not be combined with ChangeAll or ToChange")
+	}
 
 	if params.Manifest == nil {
 		params.Manifest = simpleRootManifest{}
@@ -190,12 +550,16 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 		ir:      params.Manifest.IgnoredPackages(),
 		req:     params.Manifest.RequiredPackages(),
 		ovr:     params.Manifest.Overrides(),
-		rpt:     params.RootPackageTree.Copy(),
+		pre:     params.Prereleases,
+		rpt:     params.RootPackageTree.Copy().ForContexts(params.BuildContexts),
 		chng:    make(map[ProjectRoot]struct{}),
+		keep:    make(map[ProjectRoot]struct{}),
 		rlm:     make(map[ProjectRoot]LockedProject),
-		chngall: params.ChangeAll,
+		chngall: params.ChangeAll || len(params.ChangeAllExcept) != 0 || !params.AsOf.IsZero() || params.Preference != PreferLocked,
 		dir:     params.RootDir,
 		an:      params.ProjectAnalyzer,
+		tools:   tools,
+		ws:      append([]WorkspaceMember(nil), params.Workspace...),
 	}
 
 	// Ensure the required and overrides maps are at least initialized
@@ -223,6 +587,35 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 		}
 	}
 
+	if em, ok := params.Manifest.(ExternalManifest); ok && em.ExternalPackages().Len() > 0 {
+		ext := em.ExternalPackages()
+		var both []string
+		for pkg := range rd.req {
+			if ext.IsIgnored(pkg) {
+				both = append(both, pkg)
+			}
+		}
+		sort.Strings(both)
+		switch len(both) {
+		case 0:
+			break
+		case 1:
+			return rootdata{}, badOptsFailure(fmt.Sprintf("%q was given as both a required and external package", both[0]))
+		default:
+			return rootdata{}, badOptsFailure(fmt.Sprintf("multiple packages given as both required and external: %s", strings.Join(both, ", ")))
+		}
+
+		// Record the root's imports of external packages before folding them
+		// into the ignores, which hides them from the rest of the solver.
+		rm, _ := rd.rpt.ToReachMap(true, true, false, rd.ir)
+		for _, ip := range rm.FlattenFn(nil) {
+			if ext.IsIgnored(ip) {
+				rd.ext = append(rd.ext, ip)
+			}
+		}
+		rd.ir = IgnoredAndExternalPackages(params.Manifest)
+	}
+
 	// Validate no empties in the overrides map
 	var eovr []string
 	for pr, pp := range rd.ovr {
@@ -261,6 +654,13 @@ func (params SolveParameters) toRootdata() (rootdata, error) {
 		}
 		rd.chng[p] = struct{}{}
 	}
+	for _, p := range params.ChangeAllExcept {
+		if _, exists := rd.rlm[p]; !exists {
+			return rootdata{}, badOptsFailure(fmt.Sprintf("cannot keep %s from changing as it is not in the lock", p))
+		}
+		rd.keep[p] = struct{}{}
+	}
+	rd.mergeCaseVariants()
 
 	return rd, nil
 }
@@ -280,6 +680,42 @@ func Prepare(params SolveParameters, sm SourceManager) (Solver, error) {
 		return nil, err
 	}
 
+	if params.SplitTestDependencies {
+		return prepareSplitTests(params, sm)
+	}
+	if params.WarmStart {
+		return prepareWarmStart(params, sm, rd)
+	}
+
+	if !params.AsOf.IsZero() {
+		if _, ok := sm.(HistoricalVersionLister); !ok {
+			return nil, badOptsFailure("solving as of a past time requires a SourceManager that can list historical versions")
+		}
+	}
+
+	if !params.AsOf.IsZero() && params.VersionSnapshot != nil {
+		return nil, badOptsFailure("a version snapshot cannot be combined with solving as of a past time")
+	}
+
+	if params.FetchBudget > 0 {
+		if _, ok := sm.(TransferCounter); !ok {
+			return nil, badOptsFailure("a fetch budget requires a SourceManager that can count the bytes it fetches")
+		}
+	}
+
+	for pr, pin := range params.PolicyPins {
+		if pin.Constraint == nil {
+			return nil, badOptsFailure(fmt.Sprintf("the policy pin on %s has no constraint", pr))
+		}
+	}
+
+	var goverp goVersion
+	if params.GoVersion != "" {
+		if goverp, err = parseGoVersion(params.GoVersion); err != nil {
+			return nil, badOptsFailure(fmt.Sprintf("invalid GoVersion: %s", err))
+		}
+	}
+
 	if params.stdLibFn == nil {
 		params.stdLibFn = paths.IsStandardImportPath
 	}
@@ -288,18 +724,53 @@ func Prepare(params SolveParameters, sm SourceManager) (Solver, error) {
 		tl:       params.TraceLogger,
 		stdLibFn: params.stdLibFn,
 		rd:       rd,
+		mfpol:    params.ManifestErrorPolicy,
+		mfwarned: make(map[atom]bool),
+		hook:     params.ProjectHook,
+		verdicts: make(map[ProjectRoot]map[Version]CandidateVerdict),
+		events:   newEventSink(params.Listener),
+		artpol:   params.Artifacts,
+		deprp:    params.Deprecations,
+		scorer:   params.VersionScorer,
+		selector: params.VersionSelector,
+		prefetch: params.PrefetchLock && !params.Deterministic,
+		determ:   params.Deterministic,
+		nodown:   params.NoDowngrades,
+		pins:     params.PolicyPins,
+		pinned:   make(map[ProjectRoot][]Version),
+		pref:     params.Preference,
+		majpol:   params.MajorVersions,
+		asOf:     params.AsOf,
+		maxSolns: params.MaxSolutions,
+		gover:    params.GoVersion,
+		goverp:   goverp,
+		ctxs:     params.BuildContexts,
+
+		fetchBudget: params.FetchBudget,
+		fallbacks:   params.SourceFallbacks,
+		meta:        params.ProjectMetadata,
+		vsnap:       params.VersionSnapshot,
+		capture:     params.CaptureVersions,
+		telemetry:   params.Telemetry,
+		telemAllow:  params.TelemetryAllowlist,
+	}
+	if pc, ok := sm.(PrivacyChecker); ok {
+		s.telemPriv = pc
 	}
 
 	// Set up the bridge and ensure the root dir is in good, working order
 	// before doing anything else.
+	down := params.Preference.downgrade(params.Downgrade)
 	if params.mkBridgeFn == nil {
-		s.b = mkBridge(s, sm, params.Downgrade)
+		s.b = mkBridge(s, sm, down)
 	} else {
-		s.b = params.mkBridgeFn(s, sm, params.Downgrade)
+		s.b = params.mkBridgeFn(s, sm, down)
 	}
-	err = s.b.verifyRootDir(params.RootDir)
-	if err != nil {
-		return nil, err
+	if params.RootDir != "" || len(params.Tools) == 0 {
+		err = s.b.verifyRootDir(params.RootDir)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Initialize stacks and queues
@@ -364,14 +835,31 @@ type Solver interface {
 	// Chronology is the only implication of the ordering - that lower version
 	// numbers were published before higher numbers.
 	Version() int
+
+	// HashInputs returns a digest of the inputs to the solve that are under
+	// the control of the root project, and of the tools interpreting them:
+	// the root's imports, including those of external packages, its required
+	// and ignored packages, the constraints and overrides declared by its
+	// manifest, the GoVersion, and the name and version of the
+	// ProjectAnalyzer and of the solver. It is computed without solving, so
+	// that tools can compare it with the one a Solution reports, having
+	// recorded that alongside its Lock, to tell whether the Lock is stale.
+	HashInputs() []byte
 }
 
+// The name and version of the solver, as reported by Solver.Name and
+// Solver.Version.
+const (
+	solverName    = "gps-cdcl"
+	solverVersion = 1
+)
+
 func (s *solver) Name() string {
-	return "gps-cdcl"
+	return solverName
 }
 
 func (s *solver) Version() int {
-	return 1
+	return solverVersion
 }
 
 // DeductionErrs maps package import path to errors occurring during deduction.
@@ -426,11 +914,23 @@ func (s *solver) Solve(ctx context.Context) (Solution, error) {
 	if !atomic.CompareAndSwapInt32(&s.hasrun, 0, 1) {
 		return nil, errors.New("solve method can only be run once per instance")
 	}
-	// Make sure the bridge has the context before we start.
-	//s.b.ctx = ctx
+	// Derive a cancelable context so that fatal errors encountered deep in
+	// the solving process can unwind it.
+	ctx, s.cancel = context.WithCancel(ctx)
+	defer s.cancel()
+
+	// Make sure the bridge has the context before we start, so that the
+	// SourceManager's operations are abandoned along with the solve.
+	s.b.setContext(ctx)
 
 	// Set up a metrics object
 	s.mtr = newMetrics()
+	s.mtr.xfer = s.b.meterTransfers()
+	s.mtr.cache = s.b.meterCache()
+
+	if s.prefetch {
+		s.mtr.prefetch = s.b.prefetchLock(ctx)
+	}
 
 	// Prime the queues with the root project
 	if err := s.selectRoot(); err != nil {
@@ -438,38 +938,144 @@ func (s *solver) Solve(ctx context.Context) (Solution, error) {
 	}
 
 	all, err := s.solve(ctx)
+	return s.finish(ctx, all, err)
+}
+
+// finish concludes a solve, building the solution from the selected projects
+// if solving succeeded.
+func (s *solver) finish(ctx context.Context, all map[atom]map[string]struct{}, err error) (solution, error) {
+	if s.fatal != nil {
+		err = s.fatal
+	}
 
-	s.mtr.pop()
 	var soln solution
 	if err == nil {
-		soln = solution{
-			att:  s.attempts,
-			solv: s,
-		}
-		soln.analyzerInfo = s.rd.an.Info()
-		soln.i = s.rd.externalImportList(s.stdLibFn)
-
-		// Convert ProjectAtoms into LockedProjects
-		soln.p = make([]LockedProject, 0, len(all))
-		for pa, pl := range all {
-			lp := pa2lp(pa, pl)
-			// Pass back the original inputlp directly if it Eqs what was
-			// selected.
-			if inputlp, has := s.rd.rlm[lp.Ident().ProjectRoot]; has && lp.Eq(inputlp) {
-				lp = inputlp
-			}
-
-			soln.p = append(soln.p, lp)
-		}
+		soln, err = s.newSolution(all)
 	}
+	if err == nil && s.maxSolns > 1 {
+		soln.alts, err = s.alternatives(ctx, soln)
+	}
+	s.mtr.pop()
+	soln.metrics = s.mtr.solveMetrics()
 
 	s.traceFinish(soln, err)
 	if s.tl != nil {
 		s.mtr.dump(s.tl)
 	}
+	s.reportTelemetry(soln, err)
+	return soln, err
+}
+
+// newSolution builds a solution from the projects selected by a successful
+// run of solve.
+func (s *solver) newSolution(all map[atom]map[string]struct{}) (solution, error) {
+	soln := solution{
+		att:  s.attempts,
+		solv: s,
+	}
+	soln.analyzerInfo = s.rd.an.Info()
+	soln.hd = s.HashInputs()
+	soln.i = s.rd.externalImportList(s.stdLibFn)
+	soln.ext = s.rd.ext
+	soln.reasons = s.selectionReasons()
+	soln.constraints = s.aggregateConstraints()
+
+	// Convert ProjectAtoms into LockedProjects
+	soln.p = make([]LockedProject, 0, len(all))
+	for pa, pl := range all {
+		lp := pa2lp(pa, pl)
+		// Pass back the original inputlp directly if it Eqs what was
+		// selected.
+		if inputlp, has := s.rd.rlm[lp.Ident().ProjectRoot]; has && lp.Eq(inputlp) {
+			lp = inputlp
+		}
+
+		soln.p = append(soln.p, lp)
+	}
+	soln.p = sortLockedProjects(soln.p)
+	soln.majors = s.majorVersionWarnings(soln.p, soln.constraints)
+	soln.pinned = s.boundPolicyPins(soln.p)
+
+	// Versions are captured, and packages traced, under the identifiers the
+	// solver knows, so these must precede any substitution of sources.
+	var err error
+	soln.snapshot, err = s.snapshotVersions(soln.p)
+	if err != nil {
+		return soln, err
+	}
+	soln.attributions, err = s.attributePackages(soln.p)
+	if err != nil {
+		return soln, err
+	}
+	soln.substituted = s.substituteSources(soln.p)
+	soln.meta = s.projectMetadata(soln.p)
+
+	soln.deprecated, err = s.selectedDeprecations(soln.p)
+	if err == nil {
+		soln.artifacts, err = s.findArtifacts(soln.p)
+	}
 	return soln, err
 }
 
+// alternatives resumes the search after the preferred solution has been found,
+// collecting further distinct solutions until there are s.maxSolns in total or
+// the search space is exhausted.
+func (s *solver) alternatives(ctx context.Context, first solution) ([]Solution, error) {
+	seen := map[string]bool{solutionKey(first.p): true}
+	var alts []Solution
+	for len(alts) < s.maxSolns-1 {
+		// The backtracker normally only revisits the projects implicated in a
+		// failure. Implicating all of them treats the current solution as a
+		// dead end, and turns the backtrack into a step of an exhaustive,
+		// chronological search that next varies the most recent selection.
+		for _, q := range s.vqs {
+			q.failed = true
+		}
+		s.traceInfo("looking for an alternative solution")
+
+		success, err := s.backtrack(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !success {
+			break
+		}
+
+		all, err := s.solve(ctx)
+		if s.fatal != nil {
+			return nil, s.fatal
+		}
+		if err != nil {
+			if contextCanceledOrSMReleased(err) {
+				return nil, err
+			}
+			// Any other failure means there are no further solutions.
+			break
+		}
+
+		soln, err := s.newSolution(all)
+		if err != nil {
+			return nil, err
+		}
+		if key := solutionKey(soln.p); !seen[key] {
+			seen[key] = true
+			alts = append(alts, soln)
+		}
+	}
+	return alts, nil
+}
+
+// solutionKey returns a string that uniquely identifies the versions and
+// packages selected in a solution.
+func solutionKey(lps []LockedProject) string {
+	keys := make([]string, len(lps))
+	for i, lp := range lps {
+		keys[i] = fmt.Sprintf("%s@%s%v", lp.Ident(), lp.Version(), lp.Packages())
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\n")
+}
+
 // solve is the top-level loop for the solving process.
 func (s *solver) solve(ctx context.Context) (map[atom]map[string]struct{}, error) {
 	// Pull out the donechan once up front so that we're not potentially
@@ -484,109 +1090,141 @@ func (s *solver) solve(ctx context.Context) (map[atom]map[string]struct{}, error
 		default:
 		}
 
-		bmi, has := s.nextUnselected()
-
-		if !has {
-			// no more packages to select - we're done.
+		r, err := s.step(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if r.Kind == StepDone {
 			break
 		}
+	}
 
-		// This split is the heart of "bimodal solving": we follow different
-		// satisfiability and selection paths depending on whether we've already
-		// selected the base project/repo that came off the unselected queue.
-		//
-		// (If we've already selected the project, other parts of the algorithm
-		// guarantee the bmi will contain at least one package from this project
-		// that has yet to be selected.)
-		if awp, is := s.sel.selected(bmi.id); !is {
-			s.mtr.push("new-atom")
-			// Analysis path for when we haven't selected the project yet - need
-			// to create a version queue.
-			queue, err := s.createVersionQueue(bmi)
-			if err != nil {
-				s.mtr.pop()
-				// Err means a failure somewhere down the line; try backtracking.
-				s.traceStartBacktrack(bmi, err, false)
-				success, berr := s.backtrack(ctx)
-				if berr != nil {
-					err = berr
-				} else if success {
-					// backtracking succeeded, move to the next unselected id
-					continue
-				}
-				return nil, err
-			}
+	return s.selectedAtoms(), nil
+}
 
-			if queue.current() == nil {
-				panic("canary - queue is empty, but flow indicates success")
-			}
+// step makes a single iteration of the solving loop: it takes the next
+// project or packages from the unselected queue, and either selects them or,
+// failing that, backtracks. An error means that backtracking failed, and the
+// solve cannot succeed.
+func (s *solver) step(ctx context.Context) (StepResult, error) {
+	bmi, has := s.nextUnselected()
 
-			awp := atomWithPackages{
-				a: atom{
-					id: queue.id,
-					v:  queue.current(),
-				},
-				pl: bmi.pl,
-			}
-			err = s.selectAtom(awp, false)
+	if !has {
+		// no more packages to select - we're done.
+		return StepResult{Kind: StepDone}, nil
+	}
+
+	// This split is the heart of "bimodal solving": we follow different
+	// satisfiability and selection paths depending on whether we've already
+	// selected the base project/repo that came off the unselected queue.
+	//
+	// (If we've already selected the project, other parts of the algorithm
+	// guarantee the bmi will contain at least one package from this project
+	// that has yet to be selected.)
+	awp, is := s.sel.selected(bmi.id)
+	if !is {
+		s.mtr.push("new-atom")
+		// Analysis path for when we haven't selected the project yet - need
+		// to create a version queue.
+		queue, err := s.createVersionQueue(bmi)
+		if err != nil {
 			s.mtr.pop()
-			if err != nil {
-				// Only a released SourceManager should be able to cause this.
-				return nil, err
+			// Err means a failure somewhere down the line; try backtracking.
+			failure := err
+			s.traceStartBacktrack(bmi, err, false)
+			// Backtracking unwinds the selection, so the constraints behind
+			// the failure must be captured before it.
+			ics := s.imposedConstraints(bmi.id, err)
+			success, berr := s.backtrack(ctx)
+			if berr != nil {
+				err = berr
+			} else if success {
+				// backtracking succeeded, move to the next unselected id
+				return StepResult{Kind: StepBacktracked, Project: bmi.id, Conflict: failure}, nil
+			} else {
+				err = s.solveFailure(bmi.id, ics, err)
 			}
+			return StepResult{}, err
+		}
 
-			s.vqs = append(s.vqs, queue)
-		} else {
-			s.mtr.push("add-atom")
-			// We're just trying to add packages to an already-selected project.
-			// That means it's not OK to burn through the version queue for that
-			// project as we do when first selecting a project, as doing so
-			// would upend the guarantees on which all previous selections of
-			// the project are based (both the initial one, and any package-only
-			// ones).
-
-			// Because we can only safely operate within the scope of the
-			// single, currently selected version, we can skip looking for the
-			// queue and just use the version given in what came back from
-			// s.sel.selected().
-			nawp := atomWithPackages{
-				a: atom{
-					id: bmi.id,
-					v:  awp.a.v,
-				},
-				pl: bmi.pl,
-			}
+		if queue.current() == nil {
+			panic("canary - queue is empty, but flow indicates success")
+		}
 
-			s.traceCheckPkgs(bmi)
-			err := s.check(nawp, true)
-			if err != nil {
-				s.mtr.pop()
-				// Err means a failure somewhere down the line; try backtracking.
-				s.traceStartBacktrack(bmi, err, true)
-				success, berr := s.backtrack(ctx)
-				if berr != nil {
-					err = berr
-				} else if success {
-					// backtracking succeeded, move to the next unselected id
-					continue
-				}
-				return nil, err
-			}
-			err = s.selectAtom(nawp, true)
-			s.mtr.pop()
-			if err != nil {
-				// Only a released SourceManager should be able to cause this.
-				return nil, err
-			}
+		awp := atomWithPackages{
+			a: atom{
+				id: queue.id,
+				v:  queue.current(),
+			},
+			pl: bmi.pl,
+		}
+		err = s.selectAtom(awp, false)
+		s.mtr.pop()
+		if err != nil {
+			// Only a released SourceManager should be able to cause this.
+			return StepResult{}, err
+		}
+
+		s.vqs = append(s.vqs, queue)
+		return StepResult{Kind: StepSelected, Project: awp.a.id, Version: awp.a.v, Packages: awp.pl}, nil
+	}
 
-			// We don't add anything to the stack of version queues because the
-			// backtracker knows not to pop the vqstack if it backtracks
-			// across a pure-package addition.
+	s.mtr.push("add-atom")
+	// We're just trying to add packages to an already-selected project.
+	// That means it's not OK to burn through the version queue for that
+	// project as we do when first selecting a project, as doing so
+	// would upend the guarantees on which all previous selections of
+	// the project are based (both the initial one, and any package-only
+	// ones).
+
+	// Because we can only safely operate within the scope of the
+	// single, currently selected version, we can skip looking for the
+	// queue and just use the version given in what came back from
+	// s.sel.selected().
+	nawp := atomWithPackages{
+		a: atom{
+			id: bmi.id,
+			v:  awp.a.v,
+		},
+		pl: bmi.pl,
+	}
+
+	s.traceCheckPkgs(bmi)
+	err := s.check(nawp, true)
+	if err != nil {
+		s.mtr.pop()
+		// Err means a failure somewhere down the line; try backtracking.
+		failure := err
+		s.reject(nawp.a, err)
+		s.traceStartBacktrack(bmi, err, true)
+		ics := s.imposedConstraints(bmi.id, err)
+		success, berr := s.backtrack(ctx)
+		if berr != nil {
+			err = berr
+		} else if success {
+			// backtracking succeeded, move to the next unselected id
+			return StepResult{Kind: StepBacktracked, Project: bmi.id, Conflict: failure}, nil
+		} else {
+			err = s.solveFailure(bmi.id, ics, err)
 		}
+		return StepResult{}, err
+	}
+	err = s.selectAtom(nawp, true)
+	s.mtr.pop()
+	if err != nil {
+		// Only a released SourceManager should be able to cause this.
+		return StepResult{}, err
 	}
 
-	// Getting this far means we successfully found a solution. Combine the
-	// selected projects and packages.
+	// We don't add anything to the stack of version queues because the
+	// backtracker knows not to pop the vqstack if it backtracks
+	// across a pure-package addition.
+	return StepResult{Kind: StepSelected, Project: nawp.a.id, Version: nawp.a.v, Packages: nawp.pl, PackagesOnly: true}, nil
+}
+
+// selectedAtoms combines the selected projects and packages, once solving has
+// succeeded.
+func (s *solver) selectedAtoms() map[atom]map[string]struct{} {
 	projs := make(map[atom]map[string]struct{})
 
 	// Skip the first project. It's always the root, and that shouldn't be
@@ -602,7 +1240,68 @@ func (s *solver) solve(ctx context.Context) (map[atom]map[string]struct{}, error
 			pm[path] = struct{}{}
 		}
 	}
-	return projs, nil
+	return projs
+}
+
+// selectionReasons determines why each selected project's version was chosen,
+// based on where the final version in its queue came from.
+//
+// This is only meaningful once solving has successfully completed, at which
+// point the version queue stack corresponds exactly to the selected projects.
+func (s *solver) selectionReasons() map[ProjectRoot]SelectionReason {
+	reasons := make(map[ProjectRoot]SelectionReason, len(s.vqs))
+	for _, q := range s.vqs {
+		v := q.current()
+		pr := q.id.ProjectRoot
+
+		switch {
+		case len(s.pinned[pr]) > 0:
+			reasons[pr] = SelectedByPolicyPin
+		case q.lockv != nil && v == q.lockv:
+			reasons[pr] = SelectedFromLock
+		case q.prefv != nil && v == q.prefv:
+			reasons[pr] = SelectedByPreference
+		case s.rd.ovr[pr].Constraint != nil:
+			reasons[pr] = SelectedByOverride
+		default:
+			reasons[pr] = SelectedByConstraint
+		}
+	}
+
+	return reasons
+}
+
+// aggregateConstraints computes the aggregate constraint on each selected
+// project from the dependencies recorded in the current selection.
+func (s *solver) aggregateConstraints() map[ProjectRoot]AggregateConstraint {
+	acs := make(map[ProjectRoot]AggregateConstraint, len(s.vqs))
+	for _, q := range s.vqs {
+		ac := AggregateConstraint{
+			Constraint: s.sel.getConstraint(q.id),
+		}
+
+		// A depender has a dependency entry for each time it came to need
+		// more of the project's packages, but they all carry the same
+		// constraint.
+		seen := make(map[ProjectRoot]bool)
+		for _, dep := range s.sel.getDependenciesOn(q.id) {
+			pr := dep.depender.id.ProjectRoot
+			if !seen[pr] {
+				seen[pr] = true
+				ac.Dependers = append(ac.Dependers, DependerConstraint{
+					Depender:   pr,
+					Constraint: dep.dep.Constraint,
+				})
+			}
+		}
+		sort.Slice(ac.Dependers, func(i, j int) bool {
+			return ac.Dependers[i].Depender < ac.Dependers[j].Depender
+		})
+
+		acs[q.id.ProjectRoot] = ac
+	}
+
+	return acs
 }
 
 // selectRoot is a specialized selectAtom, used solely to initially
@@ -613,9 +1312,7 @@ func (s *solver) selectRoot() error {
 	awp := s.rd.rootAtom()
 	s.sel.pushSelection(awp, false)
 
-	// If we're looking for root's deps, get it from opts and local root
-	// analysis, rather than having the sm do it.
-	deps, err := s.intersectConstraintsWithImports(s.rd.combineConstraints(), s.rd.externalImportList(s.stdLibFn))
+	deps, err := s.rootDeps(awp.a)
 	if err != nil {
 		if contextCanceledOrSMReleased(err) {
 			return err
@@ -624,24 +1321,62 @@ func (s *solver) selectRoot() error {
 		panic(fmt.Sprintf("canary - shouldn't be possible %s", err))
 	}
 
+	// The members of a workspace may depend on the same projects, each of
+	// which is only queued once, for all the packages any of them need.
+	var queued []completeDep
+	at := make(map[ProjectRoot]int)
 	for _, dep := range deps {
+		s.sel.pushDep(dep)
+		pr := dep.dep.Ident.ProjectRoot
+		if i, has := at[pr]; has {
+			queued[i].pl = unionPackages(queued[i].pl, dep.dep.pl)
+			continue
+		}
+		at[pr] = len(queued)
+		queued = append(queued, dep.dep)
+	}
+
+	var prefetch []ProjectIdentifier
+	for _, dep := range queued {
 		// If we have no lock, or if this dep isn't in the lock, then prefetch
 		// it. See longer explanation in selectAtom() for how we benefit from
 		// parallelism here.
-		if s.rd.needVersionsFor(dep.Ident.ProjectRoot) {
+		if s.rd.needVersionsFor(dep.Ident.ProjectRoot) && !s.determ {
 			go s.b.SyncSourceFor(dep.Ident)
+			prefetch = append(prefetch, dep.Ident)
 		}
 
-		s.sel.pushDep(dependency{depender: awp.a, dep: dep})
 		// Add all to unselected queue
 		heap.Push(s.unsel, bimodalIdentifier{id: dep.Ident, pl: dep.pl, fromRoot: true})
 	}
+	s.b.prefetchVersions(prefetch)
 
-	s.traceSelectRoot(s.rd.rpt, deps)
+	s.traceSelectRoot(s.rd.rpt, queued)
 	s.mtr.pop()
 	return nil
 }
 
+// rootDeps returns the dependencies of the root project, whose atom is root,
+// or those of the members of the workspace being solved for.
+func (s *solver) rootDeps(root atom) ([]dependency, error) {
+	if len(s.rd.ws) > 0 {
+		return s.workspaceDeps()
+	}
+
+	// If we're looking for root's deps, get it from opts and local root
+	// analysis, rather than having the sm do it.
+	wcs := s.relax(root.id.ProjectRoot, s.rd.combineConstraints())
+	cdeps, err := s.intersectConstraintsWithImports(wcs, s.rd.externalImportList(s.stdLibFn))
+	if err != nil {
+		return nil, err
+	}
+	deps := make([]dependency, len(cdeps))
+	for i, cdep := range cdeps {
+		deps[i] = dependency{depender: root, dep: cdep}
+	}
+	return deps, nil
+}
+
 func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []completeDep, error) {
 	var err error
 
@@ -653,7 +1388,12 @@ func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []com
 	// information.
 	m, _, err := s.b.GetManifestAndLock(a.a.id, a.a.v, s.rd.an)
 	if err != nil {
-		return nil, nil, err
+		if _, is := errors.Cause(err).(MalformedManifestError); !is {
+			return nil, nil, err
+		}
+		if m, err = s.handleMalformedManifest(a.a, err); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	ptree, err := s.b.ListPackages(a.a.id, a.a.v)
@@ -716,7 +1456,7 @@ func (s *solver) getImportsAndConstraintsOf(a atomWithPackages) ([]string, []com
 	}
 	sort.Strings(reach)
 
-	deps := s.rd.ovr.overrideAll(m.DependencyConstraints())
+	deps := s.relax(a.a.id.ProjectRoot, s.rd.overrideAll(m.DependencyConstraints()))
 	cd, err := s.intersectConstraintsWithImports(deps, reach)
 	return pl, cd, err
 }
@@ -735,6 +1475,9 @@ func (s *solver) intersectConstraintsWithImports(deps []workingConstraint, reach
 	// Step through the reached packages; if they have prefix matches in
 	// the trie, assume (mostly) it's a correct correspondence.
 	dmap := make(map[ProjectRoot]completeDep)
+	// The constraints on subpackages whose paths have been reached, by those
+	// paths, as constraints on their projects.
+	var subs map[ProjectRoot]workingConstraint
 	for _, rp := range reach {
 		// If it's a stdlib-shaped package, skip it.
 		if s.stdLibFn(rp) {
@@ -744,20 +1487,31 @@ func (s *solver) intersectConstraintsWithImports(deps []workingConstraint, reach
 		// Look for a prefix match; it'll be the root project/repo containing
 		// the reached package
 		if pre, idep, match := xt.LongestPrefix(rp); match && isPathPrefixOrEqual(pre, rp) {
-			// Match is valid; put it in the dmap, either creating a new
-			// completeDep or appending it to the existing one for this base
-			// project/prefix.
 			dep := idep.(workingConstraint)
-			if cdep, exists := dmap[dep.Ident.ProjectRoot]; exists {
-				cdep.pl = append(cdep.pl, rp)
-				dmap[dep.Ident.ProjectRoot] = cdep
+			if root, sub := s.constraintRoot(dep.Ident.ProjectRoot); sub {
+				// The constraint is on a subpackage. Set it aside to apply to
+				// the subpackage's project, and look for the project as though
+				// there were no match.
+				if subs == nil {
+					subs = make(map[ProjectRoot]workingConstraint)
+				}
+				dep.Ident.ProjectRoot = root
+				subs[ProjectRoot(pre)] = dep
 			} else {
-				dmap[dep.Ident.ProjectRoot] = completeDep{
-					workingConstraint: dep,
-					pl:                []string{rp},
+				// Match is valid; put it in the dmap, either creating a new
+				// completeDep or appending it to the existing one for this base
+				// project/prefix.
+				if cdep, exists := dmap[dep.Ident.ProjectRoot]; exists {
+					cdep.pl = append(cdep.pl, rp)
+					dmap[dep.Ident.ProjectRoot] = cdep
+				} else {
+					dmap[dep.Ident.ProjectRoot] = completeDep{
+						workingConstraint: dep,
+						pl:                []string{rp},
+					}
 				}
+				continue
 			}
-			continue
 		}
 
 		// No match. Let the SourceManager try to figure out the root
@@ -767,8 +1521,27 @@ func (s *solver) intersectConstraintsWithImports(deps []workingConstraint, reach
 			return nil, err
 		}
 
-		// Make a new completeDep with an open constraint, respecting overrides
-		pd := s.rd.ovr.override(root, ProjectProperties{Constraint: Any()})
+		// Packages of a project that has a constrained subpackage may already
+		// have been reached, or the project itself be constrained.
+		if cdep, exists := dmap[root]; exists {
+			cdep.pl = append(cdep.pl, rp)
+			dmap[root] = cdep
+			continue
+		}
+		if idep, has := xt.Get(string(root)); has {
+			dmap[root] = completeDep{
+				workingConstraint: idep.(workingConstraint),
+				pl:                []string{rp},
+			}
+			continue
+		}
+
+		// Make a new completeDep with an open constraint, respecting overrides,
+		// unless there is a constraint on a case variant of the root.
+		pd, variant := caseVariantConstraint(deps, root)
+		if !variant {
+			pd = s.rd.ovr.override(root, ProjectProperties{Constraint: Any()})
+		}
 
 		// Insert the pd into the trie so that further deps from this
 		// project get caught by the prefix search
@@ -780,11 +1553,20 @@ func (s *solver) intersectConstraintsWithImports(deps []workingConstraint, reach
 		}
 	}
 
-	// Dump all the deps from the map into the expected return slice
+	applySubpackageConstraints(dmap, subs)
+
+	// Dump all the deps from the map into the expected return slice, narrowed
+	// to the major versions their import paths imply.
 	cdeps := make([]completeDep, 0, len(dmap))
 	for _, cdep := range dmap {
+		cdep.workingConstraint = narrowToImpliedMajor(cdep.workingConstraint)
 		cdeps = append(cdeps, cdep)
 	}
+	if s.determ {
+		sort.Slice(cdeps, func(i, j int) bool {
+			return cdeps[i].Ident.Less(cdeps[j].Ident)
+		})
+	}
 
 	return cdeps, nil
 }
@@ -868,6 +1650,11 @@ func (s *solver) createVersionQueue(bmi bimodalIdentifier) (*versionQueue, error
 		// Otherwise, just use the preferred version expressed in the bmi
 		prefv = bmi.prefv
 	}
+	if s.pref != PreferLocked {
+		// Dependencies' locks are disregarded along with the root's, so that
+		// only the order of the version list decides.
+		prefv = nil
+	}
 
 	q, err := newVersionQueue(id, lockv, prefv, s.b)
 	if err != nil {
@@ -876,6 +1663,12 @@ func (s *solver) createVersionQueue(bmi bimodalIdentifier) (*versionQueue, error
 		return nil, err
 	}
 
+	// When restoring from a checkpoint, first try the version that was
+	// selected when it was taken.
+	if rv, has := s.replay[id]; has {
+		q.promote(rv)
+	}
+
 	// Hack in support for revisions.
 	//
 	// By design, revs aren't returned from ListVersion(). Thus, if the dep in
@@ -920,6 +1713,8 @@ func (s *solver) findValidVersion(q *versionQueue, pl []string) error {
 	for {
 		cur := q.current()
 		s.traceInfo("try %s@%s", q.id, cur)
+		s.events.notify(VersionAttempted{Ident: q.id, Version: cur})
+		s.mtr.attempt(q.id)
 		err := s.check(atomWithPackages{
 			a: atom{
 				id: q.id,
@@ -931,6 +1726,11 @@ func (s *solver) findValidVersion(q *versionQueue, pl []string) error {
 			// we have a good version, can return safely
 			return nil
 		}
+		if s.fatal != nil {
+			return s.fatal
+		}
+		s.reject(atom{id: q.id, v: cur}, err)
+		s.events.notify(VersionRejected{Ident: q.id, Version: cur, Reason: err})
 
 		if q.advance(err) != nil {
 			// Error on advance, have to bail out
@@ -952,6 +1752,105 @@ func (s *solver) findValidVersion(q *versionQueue, pl []string) error {
 	}
 }
 
+// selectedDeprecations returns the deprecation notices that apply to the
+// versions selected for each of the provided projects.
+func (s *solver) selectedDeprecations(lps []LockedProject) (map[ProjectRoot]Deprecation, error) {
+	var deprecated map[ProjectRoot]Deprecation
+	for _, lp := range lps {
+		id := lp.Ident()
+		ds, err := s.b.deprecations(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if d, has := findDeprecation(ds, lp.Version()); has {
+			if deprecated == nil {
+				deprecated = make(map[ProjectRoot]Deprecation)
+			}
+			deprecated[id.ProjectRoot] = d
+			s.traceInfo("warning: selected deprecated version %s of %s: %s", lp.Version(), id.ProjectRoot, d.Reason)
+		}
+	}
+
+	return deprecated, nil
+}
+
+// findArtifacts exports each of the provided projects to a temporary
+// directory, and scans it for artifacts according to the solver's
+// ArtifactPolicy. Artifacts that the SourceManager excludes from exported
+// trees are still found.
+func (s *solver) findArtifacts(lps []LockedProject) (map[ProjectRoot][]Artifact, error) {
+	if !s.artpol.enabled() {
+		return nil, nil
+	}
+
+	td, err := ioutil.TempDir("", "gps-artifacts")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary directory for artifact scanning")
+	}
+	defer os.RemoveAll(td)
+
+	arts := make(map[ProjectRoot][]Artifact)
+	for i, lp := range lps {
+		id := lp.Ident()
+		to := filepath.Join(td, strconv.Itoa(i))
+		if err := s.b.exportForScan(id, lp.Version(), to); err != nil {
+			return nil, errors.Wrapf(err, "failed to export %s for artifact scanning", id)
+		}
+
+		pa, err := FindArtifacts(to, s.artpol)
+		if err != nil {
+			return nil, err
+		}
+		if len(pa) > 0 {
+			arts[id.ProjectRoot] = pa
+			s.traceInfo("%s has %d artifacts", id.ProjectRoot, len(pa))
+		}
+	}
+
+	return arts, nil
+}
+
+// abort makes err fatal to the solve, if no other error already is, and
+// cancels it so that it unwinds promptly.
+func (s *solver) abort(err error) {
+	if s.fatal != nil {
+		return
+	}
+	s.fatal = err
+	s.traceInfo("aborting: %s", err)
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// handleMalformedManifest applies the solver's ManifestErrorPolicy to a
+// malformed manifest found for the given atom. If the atom may still be used,
+// a substitute, empty manifest is returned.
+func (s *solver) handleMalformedManifest(a atom, err error) (Manifest, error) {
+	switch s.mfpol {
+	case IgnoreMalformedManifests:
+		if !s.mfwarned[a] {
+			s.mfwarned[a] = true
+			s.traceInfo("warning: ignoring %s for %s@%s", err, a.id, a.v)
+		}
+		return SimpleManifest{}, nil
+	case FailOnMalformedManifests:
+		if s.fatal == nil {
+			s.fatal = errors.Wrapf(err, "failing on %s@%s", a.id, a.v)
+			s.traceInfo("aborting on %s@%s: %s", a.id, a.v, err)
+			s.cancel()
+		}
+		return nil, s.fatal
+	default:
+		if !s.mfwarned[a] {
+			s.mfwarned[a] = true
+			s.traceInfo("quarantining %s@%s: %s", a.id, a.v, err)
+		}
+		return nil, err
+	}
+}
+
 // getLockVersionIfValid finds an atom for the given ProjectIdentifier from the
 // root lock, assuming:
 //
@@ -964,7 +1863,7 @@ func (s *solver) findValidVersion(q *versionQueue, pl []string) error {
 func (s *solver) getLockVersionIfValid(id ProjectIdentifier) (Version, error) {
 	// If the project is specifically marked for changes, then don't look for a
 	// locked version.
-	if _, explicit := s.rd.chng[id.ProjectRoot]; explicit || s.rd.chngall {
+	if _, explicit := s.rd.chng[id.ProjectRoot]; explicit || s.rd.changesAll(id.ProjectRoot) {
 		// For projects with an upstream or cache repository, it's safe to
 		// ignore what's in the lock, because there's presumably more versions
 		// to be found and attempted in the repository. If it's only in vendor,
@@ -994,7 +1893,8 @@ func (s *solver) getLockVersionIfValid(id ProjectIdentifier) (Version, error) {
 
 	constraint := s.sel.getConstraint(id)
 	v := lp.Version()
-	if !constraint.Matches(v) {
+	pin, pinned := s.pins[id.ProjectRoot]
+	if !constraint.Matches(v) || pinned && !pin.Constraint.Matches(v) {
 		// No match found, which means we're going to be breaking the lock
 		// Still return the invalid version so that is included in the trace
 		s.b.breakLock()
@@ -1014,6 +1914,7 @@ func (s *solver) backtrack(ctx context.Context) (bool, error) {
 	donechan := ctx.Done()
 	s.mtr.push("backtrack")
 	defer s.mtr.pop()
+	s.mtr.backtracks++
 	for {
 		for {
 			select {
@@ -1045,6 +1946,7 @@ func (s *solver) backtrack(ctx context.Context) (bool, error) {
 					return false, err
 				}
 				s.traceBacktrack(awp.bmi(), !proj)
+				s.notifyBacktrack(awp, !proj)
 			}
 		}
 
@@ -1065,6 +1967,7 @@ func (s *solver) backtrack(ctx context.Context) (bool, error) {
 				return false, err
 			}
 			s.traceBacktrack(awp.bmi(), !proj)
+			s.notifyBacktrack(awp, !proj)
 		}
 
 		if !q.id.eq(awp.a.id) {
@@ -1245,6 +2148,7 @@ func (s *solver) selectAtom(a atomWithPackages, pkgonly bool) error {
 		}
 	}
 
+	var prefetch []ProjectIdentifier
 	for _, dep := range deps {
 		// Root can come back up here if there's a project-level cycle.
 		// Satisfiability checks have already ensured invariants are maintained,
@@ -1265,8 +2169,11 @@ func (s *solver) selectAtom(a atomWithPackages, pkgonly bool) error {
 		// few microseconds before blocking later. Best case, the dep doesn't
 		// come up next, but some other dep comes up that wasn't prefetched, and
 		// both fetches proceed in parallel.
-		if s.rd.needVersionsFor(dep.Ident.ProjectRoot) {
+		if s.rd.needVersionsFor(dep.Ident.ProjectRoot) && !s.determ {
 			go s.b.SyncSourceFor(dep.Ident)
+			if _, is := s.sel.selected(dep.Ident); !is {
+				prefetch = append(prefetch, dep.Ident)
+			}
 		}
 
 		s.sel.pushDep(dependency{depender: a.a, dep: dep})
@@ -1301,8 +2208,17 @@ func (s *solver) selectAtom(a atomWithPackages, pkgonly bool) error {
 			heap.Push(s.unsel, bmi)
 		}
 	}
+	// Listing the versions of all of these at once means they're likely to be
+	// ready by the time each comes out of the unselected queue.
+	s.b.prefetchVersions(prefetch)
 
 	s.traceSelect(a, pkgonly)
+	s.events.notify(ProjectSelected{
+		Ident:        a.a.id,
+		Version:      a.a.v,
+		Packages:     a.pl,
+		PackagesOnly: pkgonly,
+	})
 	s.mtr.pop()
 
 	return nil
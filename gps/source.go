@@ -8,8 +8,11 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"go/build"
 	"log"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/golang/dep/gps/pkgtree"
 	"github.com/pkg/errors"
@@ -58,17 +61,53 @@ type srcReturn struct {
 	error
 }
 
+// sourceSettings are the settings of a SourceMgr that govern how its sources
+// reach the network and run VCS commands, and how its go-get metadata is
+// fetched. The coordinators hold them, and pass them on to each source and
+// gateway they set up. The zero value imposes nothing.
+type sourceSettings struct {
+	// The log of network operations, if they are being audited.
+	audit *networkAudit
+	// The adaptive limits on concurrent network operations per host, if any.
+	limiter *hostLimiter
+	// How network operations are bounded and retried. The zero value does
+	// neither.
+	network NetworkPolicy
+	// Whether the network is never to be touched.
+	offline bool
+	// The directory in which git ref advertisements are cached, if they are.
+	refsDir string
+	// The GitPlumbing that git sources use, if not the git command line.
+	plumbing GitPlumbing
+	// The environment in which VCS commands run.
+	vcs vcsEnv
+}
+
+// gitPlumbing returns the GitPlumbing that git sources use.
+func (ss sourceSettings) gitPlumbing() GitPlumbing {
+	if ss.plumbing != nil {
+		return ss.plumbing
+	}
+	return execGitPlumbing{env: ss.vcs}
+}
+
 type sourceCoordinator struct {
 	supervisor *supervisor
 	deducer    deducer
+	settings   sourceSettings
 	srcmut     sync.RWMutex // guards srcs and srcIdx
 	srcs       map[string]*sourceGateway
 	nameToURL  map[string]string
 	psrcmut    sync.Mutex // guards protoSrcs map
 	protoSrcs  map[string][]chan srcReturn
 	cachedir   string
+	layout     CacheLayout // of cachedir
 	cache      sourceCache
 	logger     *log.Logger
+	// If the cache is shared with other processes, the directory of the
+	// repositories' lock files, and how long to wait for them.
+	locksDir    string
+	lockTimeout time.Duration
 }
 
 // newSourceCoordinator returns a new sourceCoordinator.
@@ -95,6 +134,18 @@ func (sc *sourceCoordinator) close() {
 	}
 }
 
+// gateways returns every sourceGateway the coordinator has set up.
+func (sc *sourceCoordinator) gateways() []*sourceGateway {
+	sc.srcmut.RLock()
+	defer sc.srcmut.RUnlock()
+
+	sgs := make([]*sourceGateway, 0, len(sc.srcs))
+	for _, sg := range sc.srcs {
+		sgs = append(sgs, sg)
+	}
+	return sgs
+}
+
 func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id ProjectIdentifier) (*sourceGateway, error) {
 	if err := sc.supervisor.ctx.Err(); err != nil {
 		return nil, err
@@ -225,20 +276,34 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 			srcGate = sg
 			break
 		}
-		src, err := m.try(ctx, sc.cachedir)
+		src, err := m.try(ctx, cacheDir{root: sc.cachedir, layout: sc.layout}, sc.settings)
 		if err == nil {
+			var rl *fileLock
+			if rl, err = sc.lockRepo(ctx, src); err != nil {
+				doReturn(nil, err)
+				return nil, err
+			}
 			cache := sc.cache.newSingleSourceCache(id)
-			srcGate, err = newSourceGateway(ctx, src, sc.supervisor, sc.cachedir, cache)
+			srcGate, err = newSourceGateway(ctx, src, sc.supervisor, sc.cachedir, cache, sc.settings)
+			if rl != nil {
+				rl.Unlock()
+			}
 			if err == nil {
+				srcGate.root = id.ProjectRoot
+				srcGate.repoLock, srcGate.lockTimeout = rl, sc.lockTimeout
 				sc.srcs[url] = srcGate
+				if ls, ok := src.(localSource); ok {
+					markSourceUsed(ls.localPath())
+				}
 				break
 			}
 		}
 		errs = append(errs, err)
 	}
 	if srcGate == nil {
-		doReturn(nil, errs)
-		return nil, errs
+		err := offlineErrors(errs, id.ProjectRoot)
+		doReturn(nil, err)
+		return nil, err
 	}
 
 	// Record the name -> URL mapping, making sure that we also get the
@@ -259,20 +324,48 @@ func (sc *sourceCoordinator) getSourceGatewayFor(ctx context.Context, id Project
 	return srcGate, nil
 }
 
+// lockRepo takes the lock on the local repository of src, if the cache is
+// shared with other processes, and returns it for the source's gateway to take
+// again as it operates on the repository.
+func (sc *sourceCoordinator) lockRepo(ctx context.Context, src source) (*fileLock, error) {
+	ls, ok := src.(localSource)
+	if sc.locksDir == "" || !ok {
+		return nil, nil
+	}
+
+	rl := newFileLock(repoLockPath(sc.locksDir, ls.localPath()), staleLockAge)
+	if err := waitLock(ctx, rl.TryLock, sc.lockTimeout, repoLockRetry, nil); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
 // sourceGateways manage all incoming calls for data from sources, serializing
 // and caching them as needed.
 type sourceGateway struct {
-	cachedir string
-	srcState sourceState
-	src      source
-	cache    singleSourceCache
-	mu       sync.Mutex // global lock, serializes all behaviors
-	suprvsr  *supervisor
+	// The estimated number of bytes fetched for the source, and the lookups
+	// in its cache. Accessed atomically, so kept first for alignment.
+	fetched      int64
+	hits, misses int64
+	cachedir     string
+	srcState     sourceState
+	src          source
+	cache        singleSourceCache
+	mu           sync.Mutex // global lock, serializes all behaviors
+	suprvsr      *supervisor
+	settings     sourceSettings
+	// The project for which the gateway was set up, which errors from
+	// operations that cannot be carried out offline identify.
+	root ProjectRoot
+	// The lock on the source's repository, taken along with mu, if the cache
+	// is shared with other processes, and how long to wait for it.
+	repoLock    *fileLock
+	lockTimeout time.Duration
 }
 
 // newSourceGateway returns a new gateway for src. If the source exists locally,
 // the local state may be cleaned, otherwise we ping upstream.
-func newSourceGateway(ctx context.Context, src source, superv *supervisor, cachedir string, cache singleSourceCache) (*sourceGateway, error) {
+func newSourceGateway(ctx context.Context, src source, superv *supervisor, cachedir string, cache singleSourceCache, ss sourceSettings) (*sourceGateway, error) {
 	var state sourceState
 	local := src.existsLocally(ctx)
 	if local {
@@ -290,6 +383,7 @@ func newSourceGateway(ctx context.Context, src source, superv *supervisor, cache
 		cachedir: cachedir,
 		cache:    cache,
 		suprvsr:  superv,
+		settings: ss,
 	}
 
 	if !local {
@@ -301,30 +395,98 @@ func newSourceGateway(ctx context.Context, src source, superv *supervisor, cache
 	return sg, nil
 }
 
-func (sg *sourceGateway) syncLocal(ctx context.Context) error {
+// lock takes the gateway's lock, and that on the source's repository, if there
+// is one.
+func (sg *sourceGateway) lock(ctx context.Context) error {
 	sg.mu.Lock()
-	err := sg.require(ctx, sourceExistsLocally|sourceHasLatestLocally)
+	if sg.repoLock == nil {
+		return nil
+	}
+	if err := waitLock(ctx, sg.repoLock.TryLock, sg.lockTimeout, repoLockRetry, nil); err != nil {
+		sg.mu.Unlock()
+		return err
+	}
+
+	// Another process may have evicted the repository since we last held
+	// its lock.
+	if sg.srcState&sourceExistsLocally != 0 && !sg.src.existsLocally(ctx) {
+		sg.srcState &^= sourceExistsLocally | sourceHasLatestLocally
+	}
+	return nil
+}
+
+// unlock releases the locks taken by lock.
+func (sg *sourceGateway) unlock() {
+	if sg.repoLock != nil {
+		sg.repoLock.Unlock()
+	}
 	sg.mu.Unlock()
+}
+
+func (sg *sourceGateway) syncLocal(ctx context.Context) error {
+	if err := sg.lock(ctx); err != nil {
+		return err
+	}
+	err := sg.require(ctx, sourceExistsLocally|sourceHasLatestLocally)
+	sg.unlock()
 	return err
 }
 
-func (sg *sourceGateway) existsInCache(ctx context.Context) error {
+// refresh reloads the version list from upstream and, if the source exists
+// locally, fetches the latest changes into it, regardless of whether either
+// was already done.
+func (sg *sourceGateway) refresh(ctx context.Context) error {
+	if err := sg.lock(ctx); err != nil {
+		return err
+	}
+	defer sg.unlock()
+
+	addlState, err := sg.loadLatestVersionList(ctx)
+	if err != nil {
+		return err
+	}
+	sg.srcState |= addlState
+
+	if sg.srcState&sourceExistsLocally == 0 || addlState&sourceHasLatestLocally != 0 {
+		return nil
+	}
+	sg.srcState &^= sourceHasLatestLocally
+	return sg.require(ctx, sourceHasLatestLocally)
+}
+
+// invalidate discards all the data cached for the source, so that it is
+// retrieved afresh the next time it is needed. The local copy of the source,
+// if there is one, is kept.
+func (sg *sourceGateway) invalidate() {
 	sg.mu.Lock()
-	err := sg.require(ctx, sourceExistsLocally)
+	sg.cache.invalidate()
+	sg.srcState &^= sourceHasLatestVersionList
 	sg.mu.Unlock()
+}
+
+func (sg *sourceGateway) existsInCache(ctx context.Context) error {
+	if err := sg.lock(ctx); err != nil {
+		return err
+	}
+	err := sg.require(ctx, sourceExistsLocally)
+	sg.unlock()
 	return err
 }
 
 func (sg *sourceGateway) existsUpstream(ctx context.Context) error {
-	sg.mu.Lock()
+	if err := sg.lock(ctx); err != nil {
+		return err
+	}
 	err := sg.require(ctx, sourceExistsUpstream)
-	sg.mu.Unlock()
+	sg.unlock()
 	return err
 }
 
 func (sg *sourceGateway) exportVersionTo(ctx context.Context, v Version, to string) error {
-	sg.mu.Lock()
-	defer sg.mu.Unlock()
+	if err := sg.lock(ctx); err != nil {
+		return err
+	}
+	defer sg.unlock()
 
 	err := sg.require(ctx, sourceExistsLocally)
 	if err != nil {
@@ -354,12 +516,14 @@ func (sg *sourceGateway) exportVersionTo(ctx context.Context, v Version, to stri
 		}
 	}
 
-	return err
+	return sg.checkoutErr(v, to, err)
 }
 
 func (sg *sourceGateway) exportPrunedVersionTo(ctx context.Context, lp LockedProject, prune PruneOptions, to string) error {
-	sg.mu.Lock()
-	defer sg.mu.Unlock()
+	if err := sg.lock(ctx); err != nil {
+		return err
+	}
+	defer sg.unlock()
 
 	err := sg.require(ctx, sourceExistsLocally)
 	if err != nil {
@@ -372,23 +536,106 @@ func (sg *sourceGateway) exportPrunedVersionTo(ctx context.Context, lp LockedPro
 	}
 
 	if fastprune, ok := sg.src.(sourceFastPrune); ok {
-		return sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
+		return sg.checkoutErr(lp.Version(), to, sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
 			return fastprune.exportPrunedRevisionTo(ctx, r, lp.Packages(), prune, to)
-		})
+		}))
 	}
 
 	if err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctExportTree, func(ctx context.Context) error {
 		return sg.src.exportRevisionTo(ctx, r, to)
 	}); err != nil {
-		return err
+		return sg.checkoutErr(lp.Version(), to, err)
 	}
 
 	return PruneProject(to, lp, prune)
 }
 
+// checkoutErr wraps a failure to export the version v, which exists in the
+// source, to the directory to in a CheckoutError, leaving cancellations and
+// releases of the SourceManager as they are.
+func (sg *sourceGateway) checkoutErr(v Version, to string, err error) error {
+	if err == nil || contextCanceledOrSMReleased(errors.Cause(err)) {
+		return err
+	}
+	return &CheckoutError{
+		Ident:   ProjectIdentifier{ProjectRoot: sg.root},
+		Version: v,
+		Dir:     to,
+		Err:     err,
+	}
+}
+
+func (sg *sourceGateway) diffRevisions(ctx context.Context, from, to Revision, stats bool) ([]FileChange, error) {
+	if err := sg.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer sg.unlock()
+
+	differ, ok := sg.src.(sourceDiffer)
+	if !ok {
+		return nil, errors.Errorf("%s sources do not support diffing revisions", sg.src.sourceType())
+	}
+
+	err := sg.require(ctx, sourceExistsLocally)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []FileChange
+	diff := func(ctx context.Context) error {
+		changes, err = differ.diffRevisions(ctx, from, to, stats)
+		return err
+	}
+	err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctDiffRevisions, diff)
+
+	// As with exports, either revision may be missing from a stale local
+	// repository, so update it and retry.
+	if err != nil && sg.srcState&sourceHasLatestLocally == 0 {
+		if err = sg.require(ctx, sourceHasLatestLocally); err == nil {
+			err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctDiffRevisions, diff)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (sg *sourceGateway) deprecations(ctx context.Context) ([]Deprecation, error) {
+	if err := sg.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer sg.unlock()
+
+	dsrc, ok := sg.src.(sourceDeprecations)
+	if !ok {
+		return nil, nil
+	}
+
+	// Listing versions needs no local copy, and making one only to read
+	// notices would clone every project in a solve.
+	if sg.srcState&sourceExistsLocally == 0 && !sg.src.existsLocally(ctx) {
+		return nil, nil
+	}
+
+	var ds []Deprecation
+	err := sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctDeprecations, func(ctx context.Context) error {
+		var err error
+		ds, err = dsrc.deprecations(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
 func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
-	sg.mu.Lock()
-	defer sg.mu.Unlock()
+	if err := sg.lock(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer sg.unlock()
 
 	r, err := sg.convertToRevision(ctx, v)
 	if err != nil {
@@ -396,6 +643,7 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 	}
 
 	m, l, has := sg.cache.getManifestAndLock(r, an.Info())
+	sg.countLookup(has)
 	if has {
 		return m, l, nil
 	}
@@ -440,8 +688,10 @@ func (sg *sourceGateway) getManifestAndLock(ctx context.Context, pr ProjectRoot,
 }
 
 func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Version) (pkgtree.PackageTree, error) {
-	sg.mu.Lock()
-	defer sg.mu.Unlock()
+	if err := sg.lock(ctx); err != nil {
+		return pkgtree.PackageTree{}, err
+	}
+	defer sg.unlock()
 
 	r, err := sg.convertToRevision(ctx, v)
 	if err != nil {
@@ -449,8 +699,9 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 	}
 
 	ptree, has := sg.cache.getPackageTree(r, pr)
+	sg.countLookup(has)
 	if has {
-		return ptree, nil
+		return ptree, checkGoCode(ptree, pr, v)
 	}
 
 	err = sg.require(ctx, sourceExistsLocally)
@@ -489,7 +740,19 @@ func (sg *sourceGateway) listPackages(ctx context.Context, pr ProjectRoot, v Ver
 	}
 
 	sg.cache.setPackageTree(r, ptree)
-	return ptree, nil
+	return ptree, checkGoCode(ptree, pr, v)
+}
+
+// checkGoCode returns an error with ErrNoGoCode as its cause if no directory in
+// ptree, the tree of the project at the version, has any Go source files.
+// Packages that fail to parse still count as Go code.
+func checkGoCode(ptree pkgtree.PackageTree, pr ProjectRoot, v Version) error {
+	for _, poe := range ptree.Packages {
+		if _, nogo := poe.Err.(*build.NoGoError); !nogo {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrNoGoCode, "%s at %s", pr, v)
 }
 
 // caller must hold sg.mu.
@@ -515,7 +778,7 @@ func (sg *sourceGateway) convertToRevision(ctx context.Context, v Version) (Revi
 	if sg.srcState&sourceHasLatestVersionList != 0 {
 		// We have the latest version list already and didn't get a match, so
 		// this is definitely a failure case.
-		return "", fmt.Errorf("version %q does not exist in source", v)
+		return "", &VersionNotFoundError{Ident: ProjectIdentifier{ProjectRoot: sg.root}, Version: v}
 	}
 
 	// The version list is out of date; it's possible this version might
@@ -527,33 +790,108 @@ func (sg *sourceGateway) convertToRevision(ctx context.Context, v Version) (Revi
 
 	r, has = sg.cache.toRevision(v)
 	if !has {
-		return "", fmt.Errorf("version %q does not exist in source", v)
+		return "", &VersionNotFoundError{Ident: ProjectIdentifier{ProjectRoot: sg.root}, Version: v}
 	}
 
 	return r, nil
 }
 
 func (sg *sourceGateway) listVersions(ctx context.Context) ([]PairedVersion, error) {
-	sg.mu.Lock()
-	defer sg.mu.Unlock()
+	if err := sg.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer sg.unlock()
 
-	if pvs, ok := sg.cache.getAllVersions(); ok {
-		return pvs, nil
+	pvs, ok := sg.cache.getAllVersions()
+	sg.countLookup(ok)
+	if !ok {
+		if err := sg.require(ctx, sourceHasLatestVersionList); err != nil {
+			return nil, err
+		}
+		pvs, _ = sg.cache.getAllVersions()
 	}
 
-	err := sg.require(ctx, sourceHasLatestVersionList)
+	if len(pvs) == 0 {
+		return nil, errors.Wrapf(ErrEmptyRepository, "%s", sg.src.upstreamURL())
+	}
+	return pvs, nil
+}
+
+func (sg *sourceGateway) versionsAsOf(ctx context.Context, t time.Time) ([]PairedVersion, error) {
+	// Establish the current version list first, as listVersions takes the
+	// gateway's lock itself.
+	pvl, err := sg.listVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sg.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer sg.unlock()
+
+	hsrc, ok := sg.src.(sourceHistory)
+	if !ok {
+		return nil, errors.Errorf("%s sources do not support listing historical versions", sg.src.sourceType())
+	}
+
+	err = sg.require(ctx, sourceExistsLocally)
 	if err != nil {
 		return nil, err
 	}
-	if pvs, ok := sg.cache.getAllVersions(); ok {
-		return pvs, nil
+
+	var vl []PairedVersion
+	asOf := func(ctx context.Context) error {
+		vl, err = hsrc.versionsAsOf(ctx, pvl, t)
+		return err
+	}
+	err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctVersionsAsOf, asOf)
+
+	// Every current revision must be present locally to walk back from it, so
+	// a stale local repository is updated, and the walk retried.
+	if err != nil && sg.srcState&sourceHasLatestLocally == 0 {
+		if err = sg.require(ctx, sourceHasLatestLocally); err == nil {
+			err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctVersionsAsOf, asOf)
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
+	return vl, nil
+}
+
+func (sg *sourceGateway) revisionTimes(ctx context.Context, revs []Revision) (map[Revision]time.Time, error) {
+	if err := sg.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer sg.unlock()
+
+	tsrc, ok := sg.src.(sourceRevisionTimes)
+	if !ok {
+		return nil, errors.Errorf("%s sources do not support reading revision commit times", sg.src.sourceType())
+	}
+
+	err := sg.require(ctx, sourceHasLatestLocally)
+	if err != nil {
+		return nil, err
+	}
+
+	var times map[Revision]time.Time
+	err = sg.suprvsr.do(ctx, sg.src.upstreamURL(), ctRevisionTimes, func(ctx context.Context) error {
+		times, err = tsrc.revisionTimes(ctx, revs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return times, nil
 }
 
 func (sg *sourceGateway) revisionPresentIn(ctx context.Context, r Revision) (bool, error) {
-	sg.mu.Lock()
-	defer sg.mu.Unlock()
+	if err := sg.lock(ctx); err != nil {
+		return false, err
+	}
+	defer sg.unlock()
 
 	err := sg.require(ctx, sourceExistsLocally)
 	if err != nil {
@@ -572,8 +910,10 @@ func (sg *sourceGateway) revisionPresentIn(ctx context.Context, r Revision) (boo
 }
 
 func (sg *sourceGateway) disambiguateRevision(ctx context.Context, r Revision) (Revision, error) {
-	sg.mu.Lock()
-	defer sg.mu.Unlock()
+	if err := sg.lock(ctx); err != nil {
+		return "", err
+	}
+	defer sg.unlock()
 
 	err := sg.require(ctx, sourceExistsLocally)
 	if err != nil {
@@ -583,30 +923,46 @@ func (sg *sourceGateway) disambiguateRevision(ctx context.Context, r Revision) (
 	return sg.src.disambiguateRevision(ctx, r)
 }
 
+// networkOp wraps f, an operation of the given type against the source's
+// upstream, as the networkOp function does, unless the source wraps its own
+// requests.
+func (sg *sourceGateway) networkOp(typ callType, f func(context.Context) error) func(context.Context) error {
+	if ng, ok := sg.src.(networkGuardingSource); ok && ng.guardsOwnNetworkOps() {
+		return f
+	}
+	return networkOp(sg.settings, sg.src.upstreamURL(), typ, f)
+}
+
 // sourceExistsUpstream verifies that the source exists upstream and that the
 // upstreamURL has not changed and returns any additional sourceState, or an error.
 func (sg *sourceGateway) sourceExistsUpstream(ctx context.Context) (sourceState, error) {
 	if sg.src.existsCallsListVersions() {
 		return sg.loadLatestVersionList(ctx)
 	}
-	err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourcePing, func(ctx context.Context) error {
+	err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourcePing, sg.networkOp(ctSourcePing, func(ctx context.Context) error {
 		if !sg.src.existsUpstream(ctx) {
-			return errors.Errorf("source does not exist upstream: %s: %s", sg.src.sourceType(), sg.src.upstreamURL())
+			return errors.Wrapf(ErrRepositoryNotFound, "source does not exist upstream: %s: %s", sg.src.sourceType(), sg.src.upstreamURL())
 		}
 		return nil
-	})
+	}))
 	return 0, err
 }
 
 // initLocal initializes the source locally and returns the resulting sourceState.
 func (sg *sourceGateway) initLocal(ctx context.Context) (sourceState, error) {
-	if err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceInit, func(ctx context.Context) error {
-		err := sg.src.initLocal(ctx)
-		return errors.Wrapf(err, "failed to fetch source for %s", sg.src.upstreamURL())
-	}); err != nil {
-		return 0, err
-	}
-	return sourceExistsUpstream | sourceExistsLocally | sourceHasLatestLocally, nil
+	return sg.meterFetch(func() (sourceState, error) {
+		if err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceInit, sg.networkOp(ctSourceInit, func(ctx context.Context) error {
+			err := sg.src.initLocal(ctx)
+			if ls, ok := sg.src.(localSource); ok && err != nil && !sg.src.existsLocally(ctx) {
+				// Don't leave a partial clone behind for a retry to trip over.
+				os.RemoveAll(ls.localPath())
+			}
+			return errors.Wrapf(err, "failed to fetch source for %s", sg.src.upstreamURL())
+		})); err != nil {
+			return 0, err
+		}
+		return sourceExistsUpstream | sourceExistsLocally | sourceHasLatestLocally, nil
+	})
 }
 
 // loadLatestVersionList loads the latest version list, possibly ensuring the source
@@ -621,11 +977,17 @@ func (sg *sourceGateway) loadLatestVersionList(ctx context.Context) (sourceState
 		addlState |= as
 	}
 	var pvl []PairedVersion
-	if err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctListVersions, func(ctx context.Context) error {
+	list := func(ctx context.Context) error {
 		var err error
 		pvl, err = sg.src.listVersions(ctx)
 		return errors.Wrapf(err, "failed to list versions for %s", sg.src.upstreamURL())
-	}); err != nil {
+	}
+	// Sources that list versions from their local repository don't touch the
+	// network while doing so, and nor, while offline, do git sources.
+	if !sg.src.listVersionsRequiresLocal() && !(sg.settings.offline && listsVersionsOffline(sg.src)) {
+		list = sg.networkOp(ctListVersions, list)
+	}
+	if err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctListVersions, list); err != nil {
 		return addlState, err
 	}
 	sg.cache.setVersionMap(pvl)
@@ -657,13 +1019,16 @@ func (sg *sourceGateway) require(ctx context.Context, wanted sourceState) (err e
 					addlState, err = sg.loadLatestVersionList(ctx)
 				}
 			case sourceHasLatestLocally:
-				err = sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceFetch, func(ctx context.Context) error {
-					return sg.src.updateLocal(ctx)
+				addlState, err = sg.meterFetch(func() (sourceState, error) {
+					err := sg.suprvsr.do(ctx, sg.src.sourceType(), ctSourceFetch, sg.networkOp(ctSourceFetch, func(ctx context.Context) error {
+						return sg.src.updateLocal(ctx)
+					}))
+					return sourceExistsUpstream | sourceExistsLocally, err
 				})
-				addlState = sourceExistsUpstream | sourceExistsLocally
 			}
 
 			if err != nil {
+				err = withOfflineProject(err, sg.root)
 				return
 			}
 
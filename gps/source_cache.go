@@ -71,6 +71,10 @@ type singleSourceCache interface {
 	// If the input is a revision and multiple UnpairedVersions are associated
 	// with it, whatever happens to be the first is returned.
 	toUnpaired(v Version) (UnpairedVersion, bool)
+
+	// Discard everything stored about the source, so that it must all be
+	// retrieved afresh.
+	invalidate()
 }
 
 // memoryCache is a sourceCache which creates singleSourceCacheMemory instances.
@@ -108,6 +112,16 @@ type projectInfo struct {
 	Lock
 }
 
+func (c *singleSourceCacheMemory) invalidate() {
+	c.mut.Lock()
+	c.infos = make(map[ProjectAnalyzerInfo]map[Revision]projectInfo)
+	c.ptrees = make(map[Revision]map[string]pkgtree.PackageOrErr)
+	c.vList = nil
+	c.vMap = make(map[UnpairedVersion]Revision)
+	c.rMap = make(map[Revision][]UnpairedVersion)
+	c.mut.Unlock()
+}
+
 func (c *singleSourceCacheMemory) setManifestAndLock(r Revision, pai ProjectAnalyzerInfo, m Manifest, l Lock) {
 	c.mut.Lock()
 	inner, has := c.infos[pai]
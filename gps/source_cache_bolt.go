@@ -23,7 +23,7 @@ import (
 
 // boltCacheFilename is a versioned filename for the bolt cache. The version
 // must be incremented whenever incompatible changes are made.
-const boltCacheFilename = "bolt-v1.db"
+const boltCacheFilename = "bolt-v3.db"
 
 // boltCache manages a bolt.DB cache and provides singleSourceCaches.
 type boltCache struct {
@@ -69,6 +69,92 @@ func (c *boltCache) close() error {
 	return errors.Wrapf(c.db.Close(), "error closing Bolt database %q", c.db.String())
 }
 
+// cacheMetadataBucket is the top-level bucket holding go-get metadata. It is
+// named so as not to be mistaken for the bucket of any source. It holds a
+// bucket for each import path prefix declared by the metadata, containing a
+// timestamped bucket:
+//
+//	Bucket: "v<timestamp>"
+//	Keys/Values: the VCS, repo root and meta tag of the metadata, and the URL
+//	it was fetched from
+var cacheMetadataBucket = []byte("!go-get")
+
+// getMetadata returns the go-get metadata cached for the longest prefix of ip
+// for which any is, unless it is older than the epoch.
+func (c *boltCache) getMetadata(ip string) (im metaImport, metaURL string, ok bool) {
+	err := c.db.View(func(tx *bolt.Tx) error {
+		mb := tx.Bucket(cacheMetadataBucket)
+		if mb == nil {
+			return nil
+		}
+		for p := ip; p != "." && p != "/"; p = path.Dir(p) {
+			prb := mb.Bucket([]byte(p))
+			if prb == nil {
+				continue
+			}
+			b := cacheFindLatestValid(prb, cacheVersion, c.epoch)
+			if b == nil {
+				return nil
+			}
+			im = metaImport{
+				Prefix:   p,
+				VCS:      string(b.Get(cacheKeyVCS)),
+				RepoRoot: string(b.Get(cacheKeyRepoRoot)),
+				Tag:      string(b.Get(cacheKeyMetaTag)),
+			}
+			metaURL = string(b.Get(cacheKeyMetaURL))
+			ok = true
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		c.logger.Println(errors.Wrapf(err, "failed to get cached go-get metadata for %s", ip))
+		return metaImport{}, "", false
+	}
+	return im, metaURL, ok
+}
+
+// setMetadata caches go-get metadata fetched from metaURL, replacing any
+// cached for the same prefix.
+func (c *boltCache) setMetadata(im metaImport, metaURL string) {
+	err := c.db.Batch(func(tx *bolt.Tx) error {
+		mb, err := tx.CreateBucketIfNotExists(cacheMetadataBucket)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create bucket: %s", cacheMetadataBucket)
+		}
+		prb, err := mb.CreateBucketIfNotExists([]byte(im.Prefix))
+		if err != nil {
+			return errors.Wrapf(err, "failed to create bucket: %s", im.Prefix)
+		}
+		if err := cachePrefixDelete(prb, cacheVersion); err != nil {
+			return err
+		}
+		b, err := prb.CreateBucket(cacheTimestampedKey(cacheVersion, time.Now()))
+		if err != nil {
+			return err
+		}
+
+		for _, kv := range []struct {
+			k []byte
+			v string
+		}{
+			{cacheKeyVCS, im.VCS},
+			{cacheKeyRepoRoot, im.RepoRoot},
+			{cacheKeyMetaTag, im.Tag},
+			{cacheKeyMetaURL, metaURL},
+		} {
+			if err := b.Put(kv.k, []byte(kv.v)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.logger.Println(errors.Wrapf(err, "failed to cache go-get metadata for %s", im.Prefix))
+	}
+}
+
 // singleSourceCacheBolt implements a singleSourceCache backed by a persistent BoltDB file.
 // Version mappings are timestamped, and the `epoch` field limits the age of returned values.
 // Database access methods are safe for concurrent use.
@@ -274,6 +360,18 @@ func (s *singleSourceCacheBolt) markRevisionExists(rev Revision) {
 	}
 }
 
+func (s *singleSourceCacheBolt) invalidate() {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(s.sourceName) == nil {
+			return nil
+		}
+		return tx.DeleteBucket(s.sourceName)
+	})
+	if err != nil {
+		s.logger.Println(errors.Wrapf(err, "failed to invalidate cache for %s", s.sourceName))
+	}
+}
+
 func (s *singleSourceCacheBolt) setVersionMap(pvs []PairedVersion) {
 	err := s.updateSourceBucket(func(src *bolt.Bucket) error {
 		if err := cachePrefixDelete(src, cacheVersion); err != nil {
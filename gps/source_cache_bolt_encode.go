@@ -21,6 +21,8 @@ var (
 	cacheKeyComment      = []byte("c")
 	cacheKeyConstraint   = cacheKeyComment
 	cacheKeyError        = []byte("e")
+	cacheKeyFiles        = []byte("f")
+	cacheKeyGoVersion    = []byte("g")
 	cacheKeyInputImports = []byte("m")
 	cacheKeyIgnored      = []byte("i")
 	cacheKeyImport       = cacheKeyIgnored
@@ -31,6 +33,10 @@ var (
 	cacheKeyRequired     = []byte("r")
 	cacheKeyRevision     = cacheKeyRequired
 	cacheKeyTestImport   = []byte("t")
+	cacheKeyMetaTag      = cacheKeyTestImport
+	cacheKeyMetaURL      = []byte("u")
+	cacheKeyRepoRoot     = cacheKeyRequired
+	cacheKeyVCS          = []byte("v")
 
 	cacheRevision = byte('r')
 	cacheVersion  = byte('v')
@@ -100,6 +106,12 @@ func cachePutManifest(b *bolt.Bucket, m Manifest) error {
 		}
 	}
 
+	if gm, ok := m.(GoVersionManifest); ok && gm.MinimumGoVersion() != "" {
+		if err := b.Put(cacheKeyGoVersion, []byte(gm.MinimumGoVersion())); err != nil {
+			return err
+		}
+	}
+
 	rm, ok := m.(RootManifest)
 	if !ok {
 		return nil
@@ -194,6 +206,11 @@ func cacheGetManifest(b *bolt.Bucket) (RootManifest, error) {
 		}
 	}
 
+	// Minimum Go version
+	if v := b.Get(cacheKeyGoVersion); v != nil {
+		m.gov = string(v)
+	}
+
 	// Ignored
 	if ig := b.Bucket(cacheKeyIgnored); ig != nil {
 		var igslice []string
@@ -414,6 +431,54 @@ func cachePutPackageOrErr(b *bolt.Bucket, poe pkgtree.PackageOrErr) error {
 			}
 		}
 	}
+
+	if len(poe.P.Constrained) > 0 {
+		fb, err := b.CreateBucket(cacheKeyFiles)
+		if err != nil {
+			return err
+		}
+		key := make(nuts.Key, nuts.KeyLen(uint64(len(poe.P.Constrained)-1)))
+		for i, cf := range poe.P.Constrained {
+			key.Put(uint64(i))
+			f, err := fb.CreateBucket(key)
+			if err != nil {
+				return err
+			}
+			if err := cachePutConstrainedFile(f, cf); err != nil {
+				return errors.Wrapf(err, "failed to put constrained file %s", cf.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// cachePutConstrainedFile stores the pkgtree.ConstrainedFile as fields in the
+// bolt.Bucket.
+func cachePutConstrainedFile(b *bolt.Bucket, cf pkgtree.ConstrainedFile) error {
+	if err := b.Put(cacheKeyName, []byte(cf.Name)); err != nil {
+		return err
+	}
+	if len(cf.Constraint) > 0 {
+		if err := b.Put(cacheKeyConstraint, []byte(cf.Constraint)); err != nil {
+			return err
+		}
+	}
+	if cf.Test {
+		if err := b.Put(cacheKeyTestImport, []byte{1}); err != nil {
+			return err
+		}
+	}
+	ip, err := b.CreateBucket(cacheKeyImport)
+	if err != nil {
+		return err
+	}
+	key := make(nuts.Key, nuts.KeyLen(uint64(len(cf.Imports)-1)))
+	for i := range cf.Imports {
+		key.Put(uint64(i))
+		if err := ip.Put(key, []byte(cf.Imports[i])); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -447,6 +512,33 @@ func cacheGetPackageOrErr(b *bolt.Bucket) (pkgtree.PackageOrErr, error) {
 			return pkgtree.PackageOrErr{}, err
 		}
 	}
+	if fb := b.Bucket(cacheKeyFiles); fb != nil {
+		err := fb.ForEach(func(k, _ []byte) error {
+			f := fb.Bucket(k)
+			if f == nil {
+				return errors.Errorf("constrained file %x is not a bucket", k)
+			}
+			cf := pkgtree.ConstrainedFile{
+				Name:       string(f.Get(cacheKeyName)),
+				Constraint: string(f.Get(cacheKeyConstraint)),
+				Test:       f.Get(cacheKeyTestImport) != nil,
+			}
+			if ip := f.Bucket(cacheKeyImport); ip != nil {
+				err := ip.ForEach(func(_, v []byte) error {
+					cf.Imports = append(cf.Imports, string(v))
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			p.Constrained = append(p.Constrained, cf)
+			return nil
+		})
+		if err != nil {
+			return pkgtree.PackageOrErr{}, err
+		}
+	}
 	return pkgtree.PackageOrErr{P: p}, nil
 }
 
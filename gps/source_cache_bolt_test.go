@@ -7,6 +7,7 @@ package gps
 import (
 	"io/ioutil"
 	"log"
+	"os"
 	"path"
 	"testing"
 	"time"
@@ -50,6 +51,7 @@ func TestBoltCacheTimeout(t *testing.T) {
 				Constraint: testSemverConstraint(t, "2.0.0"),
 			},
 		},
+		gov: "1.10",
 	}
 
 	lock := &safeLock{
@@ -96,6 +98,18 @@ func TestBoltCacheTimeout(t *testing.T) {
 						"os",
 						"sort",
 					},
+					Constrained: []pkgtree.ConstrainedFile{
+						{
+							Name:       "m1p_unix.go",
+							Constraint: "// +build unix",
+							Imports:    []string{"os"},
+						},
+						{
+							Name:    "m1p_windows_test.go",
+							Test:    true,
+							Imports: []string{"github.com/golang/dep/gps", "sort"},
+						},
+					},
 				},
 			},
 		},
@@ -310,3 +324,49 @@ func TestBoltCacheTimeout(t *testing.T) {
 		}
 	}
 }
+
+func TestBoltCacheMetadata(t *testing.T) {
+	cpath, err := ioutil.TempDir("", "metadatacache")
+	if err != nil {
+		t.Fatalf("Failed to create temp cache dir: %s", err)
+	}
+	defer os.RemoveAll(cpath)
+	logger := log.New(test.Writer{TB: t}, "", 0)
+
+	start := time.Now()
+	bc, err := newBoltCache(cpath, start.Unix(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im := metaImport{
+		Prefix:   "k8s.io/client-go",
+		VCS:      "git",
+		RepoRoot: "https://github.com/kubernetes/client-go",
+		Tag:      `<meta name="go-import" content="k8s.io/client-go git https://github.com/kubernetes/client-go">`,
+	}
+	const metaURL = "https://k8s.io/client-go?go-get=1"
+	bc.setMetadata(im, metaURL)
+
+	got, gotURL, ok := bc.getMetadata("k8s.io/client-go/kubernetes/scheme")
+	if !ok || got != im || gotURL != metaURL {
+		t.Errorf("unexpected cached metadata:\n\t(GOT): %#v %q\n\t(WNT): %#v %q", got, gotURL, im, metaURL)
+	}
+	for _, ip := range []string{"k8s.io/client", "k8s.io", "golang.org/x/net"} {
+		if _, _, ok := bc.getMetadata(ip); ok {
+			t.Errorf("expected no cached metadata for %s", ip)
+		}
+	}
+	if err := bc.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Metadata older than the epoch is not returned.
+	bc, err = newBoltCache(cpath, start.Add(time.Hour).Unix(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.close()
+	if _, _, ok := bc.getMetadata("k8s.io/client-go"); ok {
+		t.Error("expected cached metadata older than the epoch to be ignored")
+	}
+}
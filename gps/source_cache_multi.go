@@ -113,6 +113,18 @@ func (c *singleSourceMultiCache) markRevisionExists(r Revision) {
 	c.async <- func() { c.disk.markRevisionExists(r) }
 }
 
+// invalidate waits for the on-disk cache to be invalidated after any writes
+// already queued, so that none of them can bring back what was discarded.
+func (c *singleSourceMultiCache) invalidate() {
+	c.mem.invalidate()
+	done := make(chan struct{})
+	c.async <- func() {
+		c.disk.invalidate()
+		close(done)
+	}
+	<-done
+}
+
 func (c *singleSourceMultiCache) setVersionMap(pvs []PairedVersion) {
 	c.mem.setVersionMap(pvs)
 	c.async <- func() { c.disk.setVersionMap(pvs) }
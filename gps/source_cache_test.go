@@ -410,6 +410,40 @@ func (test singleSourceCacheTest) run(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		const rev Revision = "revision"
+
+		sc := test.newCache(t, cpath)
+		c := sc.newSingleSourceCache(pi)
+		defer func() {
+			if err := sc.close(); err != nil {
+				t.Fatal("failed to close cache:", err)
+			}
+		}()
+
+		c.setVersionMap([]PairedVersion{NewVersion("1.0.0").Pair(rev)})
+		c.setManifestAndLock(rev, testAnalyzerInfo, &simpleRootManifest{}, &safeLock{})
+		c.invalidate()
+
+		if test.persistent {
+			if err := sc.close(); err != nil {
+				t.Fatal("failed to close cache:", err)
+			}
+			sc = test.newCache(t, cpath)
+			c = sc.newSingleSourceCache(pi)
+		}
+
+		if pvs, ok := c.getAllVersions(); ok {
+			t.Errorf("expected no versions after invalidation, got %s", pvs)
+		}
+		if _, ok := c.getRevisionFor(NewVersion("1.0.0")); ok {
+			t.Error("expected no revision for 1.0.0 after invalidation")
+		}
+		if _, _, ok := c.getManifestAndLock(rev, testAnalyzerInfo); ok {
+			t.Error("expected no manifest and lock after invalidation")
+		}
+	})
 }
 
 // compareManifests compares two manifests and reports differences as test errors.
@@ -425,6 +459,16 @@ func compareManifests(t *testing.T, want, got Manifest) {
 		}
 	}
 
+	if wantGM, ok := want.(GoVersionManifest); ok {
+		var gotv string
+		if gotGM, ok := got.(GoVersionManifest); ok {
+			gotv = gotGM.MinimumGoVersion()
+		}
+		if want := wantGM.MinimumGoVersion(); gotv != want {
+			t.Errorf("unexpected minimum Go version:\n\t(GOT): %q\n\t(WNT): %q", gotv, want)
+		}
+	}
+
 	wantRM, wantOK := want.(RootManifest)
 	gotRM, gotOK := got.(RootManifest)
 	if wantOK && !gotOK {
@@ -562,7 +606,7 @@ func packageOrErrEqual(a, b pkgtree.PackageOrErr) bool {
 		}
 	}
 
-	return true
+	return reflect.DeepEqual(a.P.Constrained, b.P.Constrained)
 }
 
 // discardCache produces singleSourceDiscardCaches.
@@ -614,3 +658,5 @@ func (singleSourceDiscardCache) toRevision(v Version) (Revision, bool) {
 func (singleSourceDiscardCache) toUnpaired(v Version) (UnpairedVersion, bool) {
 	return nil, false
 }
+
+func (singleSourceDiscardCache) invalidate() {}
@@ -5,10 +5,94 @@
 package gps
 
 import (
+	"fmt"
+
 	"github.com/Masterminds/vcs"
 	"github.com/pkg/errors"
 )
 
+// SourceUnreachableError indicates that the versions of a project could not be
+// listed because its source could not be reached - for example, because the
+// network is down or access was refused. It is distinct from a source being
+// reachable but having no acceptable versions, and the solver treats it as
+// fatal rather than backtracking.
+type SourceUnreachableError struct {
+	Ident ProjectIdentifier
+	Err   error
+}
+
+func (e *SourceUnreachableError) Error() string {
+	return fmt.Sprintf("couldn't reach source for %s: %s", e.Ident, e.Err)
+}
+
+// ConstraintError indicates that a string could not be made into a Constraint:
+// by NewSemverConstraint or NewSemverConstraintIC, because it was not a valid
+// semver constraint, or by a SourceManager's InferConstraint, because it was
+// neither that nor a branch, tag or revision of the project identified.
+type ConstraintError struct {
+	// Ident is the project for which the constraint was inferred, if any.
+	Ident ProjectIdentifier
+	// Body is the string that could not be made into a Constraint.
+	Body string
+	// Err is the reason the string was not a valid semver constraint, if it
+	// was parsed as one.
+	Err error
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Ident.ProjectRoot == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s is not a valid version for the package %s(%s)", e.Body, e.Ident.ProjectRoot, e.Ident.Source)
+}
+
+// VersionNotFoundError indicates that a version passed to a SourceManager does
+// not exist in the source of the project, even once its latest versions have
+// been listed.
+type VersionNotFoundError struct {
+	Ident   ProjectIdentifier
+	Version Version
+}
+
+func (e *VersionNotFoundError) Error() string {
+	return fmt.Sprintf("version %q does not exist in source", e.Version)
+}
+
+// CheckoutError indicates that a version of a project, which exists in its
+// source, could not be exported or checked out to a directory.
+type CheckoutError struct {
+	Ident   ProjectIdentifier
+	Version Version
+	// Dir is the directory to which the project was being exported.
+	Dir string
+	Err error
+}
+
+func (e *CheckoutError) Error() string {
+	return fmt.Sprintf("failed to export %s at %s to %s: %s", e.Ident, e.Version, e.Dir, e.Err)
+}
+
+// ErrEmptyRepository is the cause of the error returned when listing the
+// versions of a source that was reached, but has no versions at all - as is
+// the case for a git repository to which nothing has yet been pushed.
+var ErrEmptyRepository = errors.New("source repository is empty, with no branches, tags or revisions")
+
+// ErrNoGoCode is the cause of the error returned when listing the packages of a
+// project at a version at which it contains no Go source files in any
+// directory.
+var ErrNoGoCode = errors.New("project contains no Go code")
+
+// sourceUnreachable wraps a failure to list the versions of a project in a
+// SourceUnreachableError, leaving cancellations and releases of the
+// SourceManager, which say nothing about the source, as they are. So, too, is
+// an empty repository, which was evidently reached.
+func sourceUnreachable(id ProjectIdentifier, err error) error {
+	if err == nil || contextCanceledOrSMReleased(errors.Cause(err)) || errors.Cause(err) == ErrEmptyRepository {
+		return err
+	}
+	return &SourceUnreachableError{Ident: id, Err: err}
+}
+
 // unwrapVcsErr recognizes *vcs.LocalError and *vsc.RemoteError, and returns a form
 // preserving the actual vcs command output and error, in addition to the message.
 // All other types pass through unchanged.
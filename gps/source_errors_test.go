@@ -5,9 +5,11 @@
 package gps
 
 import (
+	"context"
 	"testing"
 
 	"github.com/Masterminds/vcs"
+	"github.com/pkg/errors"
 )
 
 func TestUnwrapVcsErrNonNil(t *testing.T) {
@@ -28,3 +30,63 @@ func TestUnwrapVcsErrNonNil(t *testing.T) {
 		}
 	}
 }
+
+func TestSourceUnreachable(t *testing.T) {
+	id := mkPI("github.com/example/foo")
+	if sourceUnreachable(id, nil) != nil {
+		t.Error("expected nil error to remain nil")
+	}
+	for _, err := range []error{context.Canceled, context.DeadlineExceeded, ErrSourceManagerIsReleased, ErrEmptyRepository} {
+		if got := sourceUnreachable(id, errors.Wrap(err, "wrapped")); errors.Cause(got) != err {
+			t.Errorf("expected %v to pass through, got %v", err, got)
+		}
+	}
+
+	err := sourceUnreachable(id, errors.New("authentication failed"))
+	ue, ok := err.(*SourceUnreachableError)
+	if !ok {
+		t.Fatalf("expected a *SourceUnreachableError, got %T", err)
+	}
+	if ue.Ident != id || ue.Err.Error() != "authentication failed" {
+		t.Errorf("unexpected error contents: %#v", ue)
+	}
+}
+
+func TestConstraintError(t *testing.T) {
+	for _, body := range []string{"not a constraint", "^1.0.0 && nope"} {
+		for _, nc := range []func(string) (Constraint, error){NewSemverConstraint, NewSemverConstraintIC} {
+			_, err := nc(body)
+			ce, ok := err.(*ConstraintError)
+			if !ok {
+				t.Fatalf("expected a *ConstraintError parsing %q, got %T: %v", body, err, err)
+			}
+			if ce.Body != body || ce.Err == nil || ce.Error() != ce.Err.Error() {
+				t.Errorf("unexpected error contents: %#v", ce)
+			}
+		}
+	}
+
+	ce := &ConstraintError{Ident: mkPI("github.com/example/foo"), Body: "nope"}
+	if want := "nope is not a valid version for the package github.com/example/foo()"; ce.Error() != want {
+		t.Errorf("expected %q, got %q", want, ce.Error())
+	}
+}
+
+func TestCheckoutErr(t *testing.T) {
+	sg := &sourceGateway{root: "github.com/example/foo"}
+	if sg.checkoutErr(NewVersion("v1.0.0"), "dir", nil) != nil {
+		t.Error("expected nil error to remain nil")
+	}
+	if err := sg.checkoutErr(NewVersion("v1.0.0"), "dir", context.Canceled); err != context.Canceled {
+		t.Errorf("expected cancellation to pass through, got %v", err)
+	}
+
+	err := sg.checkoutErr(NewVersion("v1.0.0"), "dir", errors.New("disk full"))
+	ce, ok := err.(*CheckoutError)
+	if !ok {
+		t.Fatalf("expected a *CheckoutError, got %T", err)
+	}
+	if ce.Ident.ProjectRoot != sg.root || ce.Version != NewVersion("v1.0.0") || ce.Dir != "dir" {
+		t.Errorf("unexpected error contents: %#v", ce)
+	}
+}
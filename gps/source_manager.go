@@ -14,6 +14,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -21,7 +22,6 @@ import (
 
 	"github.com/golang/dep/gps/pkgtree"
 	"github.com/golang/dep/internal/fs"
-	"github.com/nightlyone/lockfile"
 	"github.com/pkg/errors"
 	"github.com/sdboyer/constext"
 )
@@ -32,12 +32,11 @@ var sanitizer = strings.NewReplacer("-", "--", ":", "-", "/", "-", "+", "-")
 // A locker is responsible for preventing multiple instances of dep from
 // interfering with one-another.
 //
-// Currently, anything that can either TryLock(), Unlock(), or GetOwner()
-// satisfies that need.
+// Currently, anything that can either TryLock() or Unlock() satisfies that
+// need.
 type locker interface {
 	TryLock() error
 	Unlock() error
-	GetOwner() (*os.Process, error)
 }
 
 // A falselocker adheres to the locker interface and its purpose is to quietly
@@ -48,12 +47,6 @@ type locker interface {
 // implement hard links or fnctl() style locking.
 type falseLocker struct{}
 
-// Always returns an error to indicate there's no current ower PID for our
-// lock.
-func (fl falseLocker) GetOwner() (*os.Process, error) {
-	return nil, fmt.Errorf("falseLocker always fails")
-}
-
 // Does nothing and returns a nil error so caller believes locking succeeded.
 func (fl falseLocker) TryLock() error {
 	return nil
@@ -81,13 +74,19 @@ type SourceManager interface {
 	SyncSourceFor(ProjectIdentifier) error
 
 	// ListVersions retrieves a list of the available versions for a given
-	// repository name.
+	// repository name. gps's SourceMgr returns them sorted for upgrade, as by
+	// SortPairedForUpgrade.
 	ListVersions(ProjectIdentifier) ([]PairedVersion, error)
 
 	// RevisionPresentIn indicates whether the provided Version is present in
 	// the given repository.
 	RevisionPresentIn(ProjectIdentifier, Revision) (bool, error)
 
+	// VersionsForRevision returns the tags and branches in the given
+	// repository that currently point at the provided Revision, sorted for
+	// upgrade.
+	VersionsForRevision(ProjectIdentifier, Revision) ([]UnpairedVersion, error)
+
 	// ListPackages parses the tree of the Go packages at or below root of the
 	// provided ProjectIdentifier, at the provided version.
 	ListPackages(ProjectIdentifier, Version) (pkgtree.PackageTree, error)
@@ -113,6 +112,11 @@ type SourceManager interface {
 	// hashing function used, and the prune options that were applied.
 	ExportPrunedProject(context.Context, LockedProject, PruneOptions, string) error
 
+	// DiffRevisions reports the files that differ between two revisions of
+	// the provided project, using the SourceManager's local copy of its
+	// repository. If stats is true, per-file line counts are also reported.
+	DiffRevisions(ctx context.Context, id ProjectIdentifier, from, to Revision, stats bool) ([]FileChange, error)
+
 	// DeduceProjectRoot takes an import path and deduces the corresponding
 	// project/source root.
 	DeduceProjectRoot(ip string) (ProjectRoot, error)
@@ -132,8 +136,32 @@ type SourceManager interface {
 	InferConstraint(s string, pi ProjectIdentifier) (Constraint, error)
 }
 
+// A ContextSourceManager is a SourceManager that can also run its operations
+// under a context. Canceling the context, or letting its deadline pass,
+// abandons the operation, along with any VCS command or network request it is
+// waiting on, so that a hung fetch need not hang its caller too.
+//
+// When the SourceManager passed to Prepare implements ContextSourceManager,
+// the solver runs its operations under the context passed to Solve, or to
+// each Step.
+type ContextSourceManager interface {
+	SourceManager
+
+	SourceExistsContext(context.Context, ProjectIdentifier) (bool, error)
+	SyncSourceForContext(context.Context, ProjectIdentifier) error
+	ListVersionsContext(context.Context, ProjectIdentifier) ([]PairedVersion, error)
+	RevisionPresentInContext(context.Context, ProjectIdentifier, Revision) (bool, error)
+	VersionsForRevisionContext(context.Context, ProjectIdentifier, Revision) ([]UnpairedVersion, error)
+	ListPackagesContext(context.Context, ProjectIdentifier, Version) (pkgtree.PackageTree, error)
+	GetManifestAndLockContext(context.Context, ProjectIdentifier, Version, ProjectAnalyzer) (Manifest, Lock, error)
+	DeduceProjectRootContext(ctx context.Context, ip string) (ProjectRoot, error)
+}
+
 // A ProjectAnalyzer is responsible for analyzing a given path for Manifest and
-// Lock information. Tools relying on gps must implement one.
+// Lock information. Tools relying on gps must implement one. The SourceManager
+// invokes it on each version of each project the solver visits; to understand
+// projects declaring their dependencies in several formats, combine analyzers
+// for each of them with NewAnalyzerChain.
 type ProjectAnalyzer interface {
 	// Perform analysis of the filesystem tree rooted at path, with the
 	// root import path importRoot, to determine the project's constraints, as
@@ -175,9 +203,16 @@ type SourceMgr struct {
 	qch         chan struct{}         // quit chan for signal handler
 	relonce     sync.Once             // once-er to ensure we only release once
 	releasing   int32                 // flag indicating release of sm has begun
+	norm        ExportNormalization   // normalization applied to exported trees
+	artpol      ArtifactPolicy        // policy for excluding artifacts from exported trees
+	rewrites    []ImportRewrite       // rules for rewriting imports in exported trees
+	audit       *networkAudit         // log of network operations, if auditing is enabled
+	limiter     *hostLimiter          // per-host network concurrency limits, if enabled
+	pool        *sourcePool           // bounds and deduplicates version listings and syncs
 }
 
-var _ SourceManager = &SourceMgr{}
+var _ ContextSourceManager = &SourceMgr{}
+var _ PrivacyChecker = &SourceMgr{}
 
 // ErrSourceManagerIsReleased is the error returned by any SourceManager method
 // called after the SourceManager has been released, rendering its methods no
@@ -190,6 +225,107 @@ type SourceManagerConfig struct {
 	Cachedir       string        // Where to store local instances of upstream sources.
 	Logger         *log.Logger   // Optional info/warn logger. Discards if nil.
 	DisableLocking bool          // True if the SourceManager should NOT use a lock file to protect the Cachedir from multiple processes.
+	// PrivatePatterns is a comma-separated list of GOPRIVATE-style glob
+	// patterns. Import paths matching any of them are treated as private, and
+	// their sources will only be contacted over encrypted channels.
+	PrivatePatterns string
+	// SourceProtocols is a comma-separated list of pattern=protocol entries,
+	// such as "github.com/org=ssh,*.corp.example.com=https", where patterns
+	// are GOPRIVATE-style globs and protocol is either https or ssh. Sources
+	// for import paths matching a pattern are only fetched over its protocol,
+	// regardless of the protocols their import paths deduce to. The first
+	// matching entry applies. Paths that explicitly name a scheme are
+	// unaffected.
+	SourceProtocols string
+	// SourceMirrors is a comma-separated list of prefix=url entries, such as
+	// "github.com=https://git.corp.example.com/github". Sources for import
+	// paths beneath a prefix are fetched from its URL, followed by the rest of
+	// the project's root, in place of the location they deduce to, while
+	// the projects keep their import paths. The longest matching prefix
+	// applies, and mirrors take precedence over SourceProtocols.
+	SourceMirrors string
+	// SourceRegistries is a comma-separated list of prefix=url entries, such
+	// as "github.com=https://artifacts.corp.example.com/dep", naming the
+	// registries from which to retrieve the versions and trees of projects
+	// beneath each prefix, before trying the projects' repositories; see
+	// registry_source.go for the protocol. Projects that a registry does not
+	// hold are retrieved from their repositories, as they otherwise would be.
+	// The longest matching prefix applies.
+	SourceRegistries string
+	// Normalize describes the normalization of file metadata to apply to all
+	// trees exported by the SourceManager, so that they are reproducible across
+	// machines. By default, no normalization is performed.
+	Normalize ExportNormalization
+	// Artifacts determines which files are excluded from exported trees as
+	// artifacts - typically committed binaries and unusually large files. Files
+	// are only excluded if the policy's Exclude field is set.
+	Artifacts ArtifactPolicy
+	// ImportRewrites are rules for rewriting the import paths in the Go source
+	// files of exported trees, applied after artifacts are excluded and before
+	// normalization. Where several rules match an import path, the one with
+	// the longest From applies.
+	ImportRewrites []ImportRewrite
+	// AuditNetwork enables the recording of every network operation the
+	// SourceManager performs, for later retrieval with NetworkAudit.
+	AuditNetwork bool
+	// MaxHostConcurrency enables adaptive limits on the number of concurrent
+	// network operations against each host, none of which will exceed this
+	// value. Limits rise while a host responds promptly and fall back when it
+	// errors or slows down; see HostConcurrency. Zero disables limiting.
+	MaxHostConcurrency int
+	// InheritVCSAuth passes the user's VCS authentication configuration -
+	// credential helpers, URL rewrites, client certificates and the like -
+	// through to VCS commands, which otherwise run without any of the user's
+	// or system's VCS configuration.
+	InheritVCSAuth bool
+	// Credentials are those with which git authenticates to the upstreams of
+	// private sources - an ssh key or agent, a netrc file and per-host access
+	// tokens - regardless of InheritVCSAuth. Failures to authenticate are
+	// reported as an *AuthenticationError, and repositories that do not exist
+	// with ErrRepositoryNotFound, as the error of a SourceUnreachableError.
+	Credentials VCSCredentials
+	// CacheRefAdvertisements keeps the refs last advertised by each git
+	// source's upstream in Cachedir, so that listing its versions again only
+	// transfers them if they have changed, where the upstream's server
+	// supports it.
+	CacheRefAdvertisements bool
+	// GitPlumbing, if set, is used to list, fetch and export the contents of
+	// git sources in place of the git command line.
+	GitPlumbing GitPlumbing
+	// SourceConcurrency bounds the number of sources whose versions the
+	// SourceManager lists, or which it syncs, at once; further requests wait
+	// for a free slot. Requests for a source that is already being listed or
+	// synced share the result of the operation in flight. Zero means a
+	// default of 16.
+	SourceConcurrency int
+	// Offline prevents the SourceManager from touching the network. Sources
+	// are only read from their local copies and from cached data, however old,
+	// and operations that would need the network fail with an *OfflineError.
+	Offline bool
+	// CacheLayout is the layout in which to keep the contents of Cachedir.
+	// If Cachedir is in another layout, it is migrated before the
+	// SourceManager is returned. Zero means DefaultCacheLayout.
+	CacheLayout CacheLayout
+	// SharedCache lets SourceManagers in several processes use Cachedir at
+	// once. Rather than locking Cachedir for as long as it is in use, the
+	// SourceManager locks it only while opening it, and from then on locks
+	// each source's repository while operating on it. A SourceManager that
+	// does not share Cachedir waits until every one that does is released.
+	// The persistent cache of metadata can only be open in one process at a
+	// time; the others fall back to caching it in memory. Ignored if
+	// DisableLocking is set.
+	SharedCache bool
+	// LockTimeout bounds how long the SourceManager waits for locks that
+	// other processes hold on Cachedir, or on the repositories in it, before
+	// giving up with a *CacheBusyError. Zero waits indefinitely, and a
+	// negative timeout does not wait at all.
+	LockTimeout time.Duration
+	// Network bounds the time that each attempt at a network operation on a
+	// source's upstream may take, and determines whether and how failed
+	// operations are retried. Once an operation is given up on, it fails with
+	// a *NetworkError holding the failure of each attempt. By default,
+	// operations are not bounded, and are only attempted once.
+	Network NetworkPolicy
 }
 
 // NewSourceManager produces an instance of gps's built-in SourceManager.
@@ -212,112 +348,240 @@ func NewSourceManager(c SourceManagerConfig) (*SourceMgr, error) {
 		c.Logger = log.New(ioutil.Discard, "", 0)
 	}
 
-	err := fs.EnsureDir(filepath.Join(c.Cachedir, "sources"), 0777)
+	protocols, err := parseSourceProtocols(c.SourceProtocols)
 	if err != nil {
 		return nil, err
 	}
 
-	// Fix for #820
-	//
-	// Consult https://godoc.org/github.com/nightlyone/lockfile for the lockfile
-	// behaviour. It's magic. It deals with stale processes, and if there is
-	// a process keeping the lock busy, it will pass back a temporary error that
-	// we can spin on.
-
-	glpath := filepath.Join(c.Cachedir, "sm.lock")
-
-	lockfile, err := func() (locker, error) {
-		if c.DisableLocking {
-			return falseLocker{}, nil
-		}
-		return lockfile.New(glpath)
-	}()
+	mirrors, err := parseSourceMirrors(c.SourceMirrors)
+	if err != nil {
+		return nil, err
+	}
 
+	registries, err := parseSourceRegistries(c.SourceRegistries)
 	if err != nil {
-		return nil, CouldNotCreateLockError{
-			Path: glpath,
-			Err:  errors.Wrapf(err, "unable to create lock %s", glpath),
-		}
+		return nil, err
 	}
 
-	process, err := lockfile.GetOwner()
-	if err == nil {
-		// If we didn't get an error, then the lockfile exists already. We should
-		// check to see if it's us already:
-		if process.Pid == os.Getpid() {
-			return nil, CouldNotCreateLockError{
-				Path: glpath,
-				Err:  fmt.Errorf("lockfile %s already locked by this process", glpath),
-			}
-		}
+	creds, err := c.Credentials.resolve()
+	if err != nil {
+		return nil, err
+	}
 
-		// There is a lockfile, but it's owned by someone else. We'll try to lock
-		// it anyway.
+	cd := cacheDir{root: c.Cachedir, layout: c.CacheLayout}
+	if cd.layout == 0 {
+		cd.layout = DefaultCacheLayout
+	}
+	if !cd.layout.valid() {
+		return nil, errors.Errorf("unknown cache layout %s", cd.layout)
 	}
 
-	// If it's a TemporaryError, we retry every second. Otherwise, we fail
-	// permanently.
-	//
-	// TODO: #534 needs to be implemented to provide a better way to log warnings,
-	// but until then we will just use stderr.
+	err = fs.EnsureDir(c.Cachedir, 0777)
+	if err != nil {
+		return nil, err
+	}
 
-	// Implicit Time of 0.
-	var lasttime time.Time
-	err = lockfile.TryLock()
-	for err != nil {
-		nowtime := time.Now()
-		duration := nowtime.Sub(lasttime)
+	shared := c.SharedCache && !c.DisableLocking
+	lockfile, err := lockCachedir(c.Cachedir, c.DisableLocking, shared, c.LockTimeout)
+	if err != nil {
+		return nil, err
+	}
 
-		// The first time this is evaluated, duration will be very large as lasttime is 0.
-		// Unless time travel is invented and someone travels back to the year 1, we should
-		// be ok.
-		if duration > 15*time.Second {
-			fmt.Fprintf(os.Stderr, "waiting for lockfile %s: %s\n", glpath, err.Error())
-			lasttime = nowtime
+	// Only migrate while holding the lock, so that no other process is using
+	// the cache as it moves.
+	err = migrateCache(c.Cachedir, cd.layout, c.Logger)
+	if err == nil {
+		err = fs.EnsureDir(cd.sourcesDir(), 0777)
+	}
+	if err != nil {
+		lockfile.Unlock()
+		return nil, err
+	}
+	if shared {
+		// Trade the lock on the whole cache for a registration as one of the
+		// processes sharing it.
+		reg, err := shareCachedir(c.Cachedir)
+		lockfile.Unlock()
+		if err != nil {
+			return nil, err
 		}
+		lockfile = reg
+	}
 
-		if t, ok := err.(interface {
-			Temporary() bool
-		}); ok && t.Temporary() {
-			time.Sleep(time.Second * 1)
-		} else {
-			return nil, CouldNotCreateLockError{
-				Path: glpath,
-				Err:  errors.Wrapf(err, "unable to lock %s", glpath),
-			}
-		}
-		err = lockfile.TryLock()
+	settings := sourceSettings{
+		network:  c.Network,
+		offline:  c.Offline,
+		plumbing: c.GitPlumbing,
+		vcs:      vcsEnv{inherit: c.InheritVCSAuth, creds: creds},
+	}
+	if c.AuditNetwork {
+		settings.audit = &networkAudit{}
+	}
+	if c.MaxHostConcurrency > 0 {
+		settings.limiter = newHostLimiter(c.MaxHostConcurrency)
+	}
+	if c.CacheRefAdvertisements {
+		settings.refsDir = cd.refsDir()
 	}
 
 	ctx, cf := context.WithCancel(context.TODO())
 	superv := newSupervisor(ctx)
 	deducer := newDeductionCoordinator(superv)
+	deducer.settings = settings
+	deducer.private = c.PrivatePatterns
+	deducer.protocols = protocols
+	deducer.mirrors = mirrors
+	deducer.registries = registries
 
 	var sc sourceCache
 	if c.CacheAge > 0 {
 		// Try to open the BoltDB cache from disk.
 		epoch := time.Now().Add(-c.CacheAge).Unix()
-		boltCache, err := newBoltCache(c.Cachedir, epoch, c.Logger)
+		if c.Offline {
+			// Stale data is better than none when there's no refreshing it.
+			epoch = 0
+		}
+		boltCache, err := newBoltCache(cd.metadataDir(), epoch, c.Logger)
 		if err != nil {
 			c.Logger.Println(errors.Wrapf(err, "failed to open persistent cache %q", c.Cachedir))
 		} else {
 			sc = newMultiCache(memoryCache{}, boltCache)
+			deducer.cache = boltCache
 		}
 	}
 
+	srcCoord := newSourceCoordinator(superv, deducer, c.Cachedir, sc, c.Logger)
+	srcCoord.layout = cd.layout
+	srcCoord.settings = settings
+	if shared {
+		srcCoord.locksDir = filepath.Join(c.Cachedir, cacheLocksDirectory)
+		srcCoord.lockTimeout = c.LockTimeout
+	}
+
 	sm := &SourceMgr{
 		cachedir:    c.Cachedir,
 		lf:          lockfile,
 		suprvsr:     superv,
 		cancelAll:   cf,
 		deduceCoord: deducer,
-		srcCoord:    newSourceCoordinator(superv, deducer, c.Cachedir, sc, c.Logger),
+		srcCoord:    srcCoord,
 		qch:         make(chan struct{}),
+		norm:        c.Normalize,
+		artpol:      c.Artifacts,
+		rewrites:    c.ImportRewrites,
+		audit:       settings.audit,
+		limiter:     settings.limiter,
+		pool:        newSourcePool(c.SourceConcurrency),
 	}
 
 	return sm, nil
 }
 
+// lockCachedir takes the lock that guards the cache directory against use by
+// more than one process at a time, waiting for it if another process holds it,
+// for at most timeout, as by waitLock. Unless the lock is only being taken to
+// open the cache for sharing, it also waits for the processes sharing the cache
+// to be done with it.
+func lockCachedir(cachedir string, disable, shared bool, timeout time.Duration) (locker, error) {
+	// Fix for #820
+	//
+	// See cache_lock.go for how the lock deals with stale processes. If there
+	// is a process keeping the lock busy, it will pass back a temporary error
+	// that we can spin on.
+	if disable {
+		return falseLocker{}, nil
+	}
+
+	glpath := filepath.Join(cachedir, cacheLockFilename)
+	lf := newFileLock(glpath, staleLockAge)
+
+	if owner, _, err := readLockFile(glpath); err == nil && owner.isSelf() {
+		// There is a lockfile already, and it's us.
+		return nil, CouldNotCreateLockError{
+			Path: glpath,
+			Err:  fmt.Errorf("lockfile %s already locked by this process", glpath),
+		}
+	}
+
+	// If the lock is held, we retry every second. Otherwise, we fail
+	// permanently.
+	//
+	// TODO: #534 needs to be implemented to provide a better way to log warnings,
+	// but until then we will just use stderr.
+
+	// Implicit Time of 0.
+	var lasttime time.Time
+	notify := func(err error) {
+		nowtime := time.Now()
+		duration := nowtime.Sub(lasttime)
+
+		// The first time this is evaluated, duration will be very large as lasttime is 0.
+		// Unless time travel is invented and someone travels back to the year 1, we should
+		// be ok.
+		if duration > 15*time.Second {
+			fmt.Fprintf(os.Stderr, "waiting for lockfile %s: %s\n", glpath, err.Error())
+			lasttime = nowtime
+		}
+	}
+
+	start := time.Now()
+	err := waitLock(context.Background(), lf.TryLock, timeout, cacheLockRetry, notify)
+	if err == nil && !shared {
+		// No process may start sharing the cache while we hold the lock, so
+		// once those already sharing it are done, it is ours alone.
+		locksDir := filepath.Join(cachedir, cacheLocksDirectory)
+		if timeout > 0 {
+			timeout -= time.Since(start)
+			if timeout <= 0 {
+				timeout = -1
+			}
+		}
+		err = waitLock(context.Background(), func() error { return tryUnshared(locksDir) }, timeout, cacheLockRetry, notify)
+		if err != nil {
+			lf.Unlock()
+		}
+	}
+
+	switch err.(type) {
+	case nil:
+		return lf, nil
+	case *CacheBusyError:
+		return nil, err
+	}
+	return nil, CouldNotCreateLockError{
+		Path: glpath,
+		Err:  errors.Wrapf(err, "unable to lock %s", glpath),
+	}
+}
+
+// NetworkAudit returns the network operations performed by the SourceMgr so
+// far, in the order in which they finished, with credentials redacted from all
+// destinations. It returns nil unless the SourceMgr was created with
+// AuditNetwork set.
+func (sm *SourceMgr) NetworkAudit() []NetworkAuditEntry {
+	if sm.audit == nil {
+		return nil
+	}
+	return sm.audit.list()
+}
+
+// HostConcurrency returns the current adaptive concurrency limit for each host
+// the SourceMgr has contacted, along with the observations that determined it.
+// It returns nil unless the SourceMgr was created with MaxHostConcurrency set.
+func (sm *SourceMgr) HostConcurrency() map[string]HostConcurrency {
+	if sm.limiter == nil {
+		return nil
+	}
+	return sm.limiter.stats()
+}
+
+// IsPrivate reports whether the provided import path matches the private
+// patterns with which the SourceMgr was configured. Tools building on the
+// SourceMgr should avoid disclosing private paths to third parties.
+func (sm *SourceMgr) IsPrivate(ip string) bool {
+	return sm.deduceCoord.isPrivate(ip)
+}
+
 // Cachedir returns the location of the cache directory.
 func (sm *SourceMgr) Cachedir() string {
 	return sm.cachedir
@@ -421,7 +685,6 @@ func (sm *SourceMgr) Release() {
 
 		// Close the file handle for the lock file and remove it from disk
 		sm.lf.Unlock()
-		os.Remove(filepath.Join(sm.cachedir, "sm.lock"))
 
 		// Close the qch, if non-nil, so the signal handlers run out. This will
 		// also deregister the sig channel, if any has been set up.
@@ -436,88 +699,240 @@ func (sm *SourceMgr) Release() {
 // manifest and lock is delegated to the provided ProjectAnalyzer's
 // DeriveManifestAndLock() method.
 func (sm *SourceMgr) GetManifestAndLock(id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
+	return sm.GetManifestAndLockContext(context.TODO(), id, v, an)
+}
+
+// GetManifestAndLockContext is like GetManifestAndLock, but runs under the
+// provided context.
+func (sm *SourceMgr) GetManifestAndLockContext(ctx context.Context, id ProjectIdentifier, v Version, an ProjectAnalyzer) (Manifest, Lock, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return nil, nil, ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return srcg.getManifestAndLock(context.TODO(), id.ProjectRoot, v, an)
+	return srcg.getManifestAndLock(ctx, id.ProjectRoot, v, an)
 }
 
 // ListPackages parses the tree of the Go packages at and below the ProjectRoot
-// of the given ProjectIdentifier, at the given version.
+// of the given ProjectIdentifier, at the given version. If the project contains
+// no Go code at that version, the cause of the returned error is ErrNoGoCode.
 func (sm *SourceMgr) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
+	return sm.ListPackagesContext(context.TODO(), id, v)
+}
+
+// ListPackagesContext is like ListPackages, but runs under the
+// provided context.
+func (sm *SourceMgr) ListPackagesContext(ctx context.Context, id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return pkgtree.PackageTree{}, ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		return pkgtree.PackageTree{}, err
 	}
 
-	return srcg.listPackages(context.TODO(), id.ProjectRoot, v)
+	return srcg.listPackages(ctx, id.ProjectRoot, v)
 }
 
 // ListVersions retrieves a list of the available versions for a given
 // repository name.
 //
-// The list is not sorted; while it may be returned in the order that the
-// underlying VCS reports version information, no guarantee is made. It is
-// expected that the caller either not care about order, or sort the result
-// themselves.
+// The list is sorted for upgrade, as by SortPairedForUpgrade, and is the
+// caller's own to modify.
 //
 // This list is always retrieved from upstream on the first call. Subsequent
 // calls will return a cached version of the first call's results. if upstream
 // is not accessible (network outage, access issues, or the resource actually
-// went away), an error will be returned.
+// went away), a *SourceUnreachableError will be returned. If it is accessible
+// but has no versions at all, the cause of the returned error is
+// ErrEmptyRepository.
 func (sm *SourceMgr) ListVersions(id ProjectIdentifier) ([]PairedVersion, error) {
+	return sm.ListVersionsContext(context.TODO(), id)
+}
+
+// ListVersionsContext is like ListVersions, but runs under the
+// provided context.
+func (sm *SourceMgr) ListVersionsContext(ctx context.Context, id ProjectIdentifier) ([]PairedVersion, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return nil, ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	v, err := sm.pool.do(ctx, ctListVersions, id, func(ctx context.Context) (interface{}, error) {
+		srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+		if err != nil {
+			// TODO(sdboyer) More-er proper-er errors
+			return nil, err
+		}
+
+		pvl, err := srcg.listVersions(ctx)
+		if err != nil {
+			return nil, sourceUnreachable(id, err)
+		}
+		return pvl, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The list may be shared with other callers, so each gets its own copy.
+	return sortedPairedVersions(v.([]PairedVersion)), nil
+}
+
+// PrefetchVersions lists the versions of each of the provided projects in the
+// background, as many at once as SourceConcurrency allows, so that later calls
+// to ListVersions for them return promptly. This makes SourceMgr a
+// VersionPrefetcher.
+func (sm *SourceMgr) PrefetchVersions(ids []ProjectIdentifier) {
+	for _, id := range ids {
+		go sm.ListVersions(id)
+	}
+}
+
+// sortedPairedVersions returns a copy of pvl sorted for upgrade, leaving pvl,
+// which may be shared with the source cache, untouched.
+func sortedPairedVersions(pvl []PairedVersion) []PairedVersion {
+	cp := make([]PairedVersion, len(pvl))
+	copy(cp, pvl)
+	SortPairedForUpgrade(cp)
+	return cp
+}
+
+// ListVersionsAsOf retrieves a list of the versions of the given project that
+// existed at the given time, with branches paired with the revision at which
+// they stood at that time, sorted for upgrade. This makes SourceMgr a
+// ContextHistoricalVersionLister.
+//
+// The list is derived from the current version list and the history in the
+// local copy of the repository, which is brought up to date first.
+func (sm *SourceMgr) ListVersionsAsOf(id ProjectIdentifier, t time.Time) ([]PairedVersion, error) {
+	return sm.ListVersionsAsOfContext(context.TODO(), id, t)
+}
+
+// ListVersionsAsOfContext is like ListVersionsAsOf, but runs under the
+// provided context.
+func (sm *SourceMgr) ListVersionsAsOfContext(ctx context.Context, id ProjectIdentifier, t time.Time) ([]PairedVersion, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return nil, ErrSourceManagerIsReleased
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pvl, err := srcg.versionsAsOf(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	return sortedPairedVersions(pvl), nil
+}
+
+// RevisionTimes returns the commit times of those of the given revisions that
+// are present in the repository of the given project. This makes SourceMgr a
+// ContextRevisionTimeLister.
+//
+// The local copy of the repository is brought up to date first.
+func (sm *SourceMgr) RevisionTimes(id ProjectIdentifier, revs []Revision) (map[Revision]time.Time, error) {
+	return sm.RevisionTimesContext(context.TODO(), id, revs)
+}
+
+// RevisionTimesContext is like RevisionTimes, but runs under the provided
+// context.
+func (sm *SourceMgr) RevisionTimesContext(ctx context.Context, id ProjectIdentifier, revs []Revision) (map[Revision]time.Time, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return nil, ErrSourceManagerIsReleased
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
-		// TODO(sdboyer) More-er proper-er errors
 		return nil, err
 	}
 
-	return srcg.listVersions(context.TODO())
+	return srcg.revisionTimes(ctx, revs)
 }
 
 // RevisionPresentIn indicates whether the provided Revision is present in the given
 // repository.
 func (sm *SourceMgr) RevisionPresentIn(id ProjectIdentifier, r Revision) (bool, error) {
+	return sm.RevisionPresentInContext(context.TODO(), id, r)
+}
+
+// RevisionPresentInContext is like RevisionPresentIn, but runs under the
+// provided context.
+func (sm *SourceMgr) RevisionPresentInContext(ctx context.Context, id ProjectIdentifier, r Revision) (bool, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return false, ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		// TODO(sdboyer) More-er proper-er errors
 		return false, err
 	}
 
-	return srcg.revisionPresentIn(context.TODO(), r)
+	return srcg.revisionPresentIn(ctx, r)
+}
+
+// VersionsForRevision returns the tags and branches in the given repository
+// that currently point at the provided Revision, sorted for upgrade. The
+// Revision must be in full; the result is empty if no version points at it.
+//
+// As with ListVersions, a *SourceUnreachableError is returned if the source is
+// not accessible.
+func (sm *SourceMgr) VersionsForRevision(id ProjectIdentifier, r Revision) ([]UnpairedVersion, error) {
+	return sm.VersionsForRevisionContext(context.TODO(), id, r)
+}
+
+// VersionsForRevisionContext is like VersionsForRevision, but runs under the
+// provided context.
+func (sm *SourceMgr) VersionsForRevisionContext(ctx context.Context, id ProjectIdentifier, r Revision) ([]UnpairedVersion, error) {
+	pvl, err := sm.ListVersionsContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return versionsForRevision(pvl, r), nil
+}
+
+// versionsForRevision returns the versions in pvl paired with r, sorted for
+// upgrade.
+func versionsForRevision(pvl []PairedVersion, r Revision) []UnpairedVersion {
+	var matched []PairedVersion
+	for _, pv := range pvl {
+		if pv.Revision() == r {
+			matched = append(matched, pv)
+		}
+	}
+	SortPairedForUpgrade(matched)
+
+	uvs := make([]UnpairedVersion, len(matched))
+	for i, pv := range matched {
+		uvs[i] = pv.Unpair()
+	}
+	return uvs
 }
 
 // SourceExists checks if a repository exists, either upstream or in the cache,
 // for the provided ProjectIdentifier.
 func (sm *SourceMgr) SourceExists(id ProjectIdentifier) (bool, error) {
+	return sm.SourceExistsContext(context.TODO(), id)
+}
+
+// SourceExistsContext is like SourceExists, but runs under the
+// provided context.
+func (sm *SourceMgr) SourceExistsContext(ctx context.Context, id ProjectIdentifier) (bool, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return false, ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
 	if err != nil {
 		return false, err
 	}
 
-	ctx := context.TODO()
 	if err := srcg.existsInCache(ctx); err == nil {
 		return true, nil
 	}
@@ -527,26 +942,94 @@ func (sm *SourceMgr) SourceExists(id ProjectIdentifier) (bool, error) {
 	return true, nil
 }
 
+// InvalidateCache discards all the metadata cached for the source of the given
+// ProjectIdentifier - its version list, and the manifests, locks and package
+// trees analyzed at its revisions - both in memory and in the persistent
+// cache, so that it is retrieved afresh from upstream the next time it is
+// needed.
+func (sm *SourceMgr) InvalidateCache(id ProjectIdentifier) error {
+	return sm.InvalidateCacheContext(context.TODO(), id)
+}
+
+// InvalidateCacheContext is like InvalidateCache, but runs under the provided
+// context.
+func (sm *SourceMgr) InvalidateCacheContext(ctx context.Context, id ProjectIdentifier) error {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return ErrSourceManagerIsReleased
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	srcg.invalidate()
+	return nil
+}
+
+// RefreshSource invalidates the metadata cached for the source of the given
+// ProjectIdentifier, then immediately reloads its version list from upstream
+// and brings its local copy, if there is one, up to date.
+func (sm *SourceMgr) RefreshSource(id ProjectIdentifier) error {
+	return sm.RefreshSourceContext(context.TODO(), id)
+}
+
+// RefreshSourceContext is like RefreshSource, but runs under the provided
+// context.
+func (sm *SourceMgr) RefreshSourceContext(ctx context.Context, id ProjectIdentifier) error {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return ErrSourceManagerIsReleased
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	srcg.invalidate()
+	return srcg.refresh(ctx)
+}
+
 // SyncSourceFor will ensure that all local caches and information about a
 // source are up to date with any network-acccesible information.
 //
 // The primary use case for this is prefetching.
 func (sm *SourceMgr) SyncSourceFor(id ProjectIdentifier) error {
+	return sm.SyncSourceForContext(context.TODO(), id)
+}
+
+// SyncSourceForContext is like SyncSourceFor, but runs under the
+// provided context.
+func (sm *SourceMgr) SyncSourceForContext(ctx context.Context, id ProjectIdentifier) error {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return ErrSourceManagerIsReleased
 	}
 
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), id)
-	if err != nil {
-		return err
-	}
+	_, err := sm.pool.do(ctx, ctSourceFetch, id, func(ctx context.Context) (interface{}, error) {
+		srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+		if err != nil {
+			return nil, err
+		}
 
-	return srcg.syncLocal(context.TODO())
+		return nil, srcg.syncLocal(ctx)
+	})
+	return err
 }
 
 // ExportProject writes out the tree of the provided ProjectIdentifier's
 // ProjectRoot, at the provided version, to the provided directory.
 func (sm *SourceMgr) ExportProject(ctx context.Context, id ProjectIdentifier, v Version, to string) error {
+	return sm.exportProject(ctx, id, v, to, true)
+}
+
+// exportUnexcluded is like ExportProject, but leaves in place the artifacts
+// that the SourceMgr's ArtifactPolicy would exclude, so that the solver can
+// report them.
+func (sm *SourceMgr) exportUnexcluded(ctx context.Context, id ProjectIdentifier, v Version, to string) error {
+	return sm.exportProject(ctx, id, v, to, false)
+}
+
+func (sm *SourceMgr) exportProject(ctx context.Context, id ProjectIdentifier, v Version, to string, exclude bool) error {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
 		return ErrSourceManagerIsReleased
 	}
@@ -556,7 +1039,10 @@ func (sm *SourceMgr) ExportProject(ctx context.Context, id ProjectIdentifier, v
 		return err
 	}
 
-	return srcg.exportVersionTo(ctx, v, to)
+	if err = srcg.exportVersionTo(ctx, v, to); err != nil {
+		return err
+	}
+	return sm.finishExport(to, exclude)
 }
 
 // ExportPrunedProject writes out a tree of the provided LockedProject, applying
@@ -571,7 +1057,78 @@ func (sm *SourceMgr) ExportPrunedProject(ctx context.Context, lp LockedProject,
 		return err
 	}
 
-	return srcg.exportPrunedVersionTo(ctx, lp, prune, to)
+	if err = srcg.exportPrunedVersionTo(ctx, lp, prune, to); err != nil {
+		return err
+	}
+	return sm.finishExport(to, true)
+}
+
+// DiffRevisions reports the files that differ between two revisions of the
+// provided project, sorted by path. If stats is true, the number of lines
+// added and deleted in each file is also reported.
+//
+// The local repository in the SourceManager's cache is reused, and is only
+// updated if it does not yet contain either revision. Only git and hg sources
+// are currently supported.
+func (sm *SourceMgr) DiffRevisions(ctx context.Context, id ProjectIdentifier, from, to Revision, stats bool) ([]FileChange, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return nil, ErrSourceManagerIsReleased
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return srcg.diffRevisions(ctx, from, to, stats)
+}
+
+// Deprecations returns the deprecation notices recorded in the repository for
+// the versions of the given project, sorted for upgrade by the versions they
+// apply to. This makes SourceMgr a ContextDeprecationProvider.
+//
+// Notices are read from the local copy of the repository, if there is one;
+// no copy is made just to read them, so a project that has not yet been
+// cloned reports none. Sources that have no means of recording notices also
+// report none.
+func (sm *SourceMgr) Deprecations(id ProjectIdentifier) ([]Deprecation, error) {
+	return sm.DeprecationsContext(context.TODO(), id)
+}
+
+// DeprecationsContext is like Deprecations, but runs under the provided
+// context.
+func (sm *SourceMgr) DeprecationsContext(ctx context.Context, id ProjectIdentifier) ([]Deprecation, error) {
+	if atomic.LoadInt32(&sm.releasing) == 1 {
+		return nil, ErrSourceManagerIsReleased
+	}
+
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ds, err := srcg.deprecations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		return vLess(ds[i].Version, ds[j].Version, false)
+	})
+	return ds, nil
+}
+
+// finishExport applies the SourceMgr's artifact exclusion, if exclude is set,
+// and its import rewriting and normalization rules to a freshly exported tree.
+func (sm *SourceMgr) finishExport(to string, exclude bool) error {
+	if exclude {
+		if err := excludeArtifacts(to, sm.artpol); err != nil {
+			return err
+		}
+	}
+	if err := RewriteImports(to, sm.rewrites); err != nil {
+		return err
+	}
+	return NormalizeTree(to, sm.norm)
 }
 
 // DeduceProjectRoot takes an import path and deduces the corresponding
@@ -582,18 +1139,40 @@ func (sm *SourceMgr) ExportPrunedProject(ctx context.Context, lp LockedProject,
 // paths. (A special exception is written for gopkg.in to minimize network
 // activity, as its behavior is well-structured)
 func (sm *SourceMgr) DeduceProjectRoot(ip string) (ProjectRoot, error) {
+	return sm.DeduceProjectRootContext(context.TODO(), ip)
+}
+
+// DeduceProjectRootContext is like DeduceProjectRoot, but runs under the
+// provided context.
+func (sm *SourceMgr) DeduceProjectRootContext(ctx context.Context, ip string) (ProjectRoot, error) {
+	root, _, err := sm.deduceProjectRootWithReason(ctx, ip)
+	return root, err
+}
+
+// DeduceProjectRootWithReason is like DeduceProjectRoot, but also explains how
+// the root was determined: by the static rules for a known host or a VCS
+// extension, or by go-import metadata, in which case the matching meta tag and
+// the URL from which it was fetched are included.
+func (sm *SourceMgr) DeduceProjectRootWithReason(ip string) (ProjectRoot, DeductionReason, error) {
+	return sm.deduceProjectRootWithReason(context.TODO(), ip)
+}
+
+func (sm *SourceMgr) deduceProjectRootWithReason(ctx context.Context, ip string) (ProjectRoot, DeductionReason, error) {
 	if atomic.LoadInt32(&sm.releasing) == 1 {
-		return "", ErrSourceManagerIsReleased
+		return "", DeductionReason{}, ErrSourceManagerIsReleased
 	}
 
 	// TODO(sdboyer) refactor deduceRootPath() so that this validation can move
 	// back down below a cache point, rather than executing on every call.
 	if !pathvld.MatchString(ip) {
-		return "", errors.Errorf("%q is not a valid import path", ip)
+		return "", DeductionReason{}, errors.Errorf("%q is not a valid import path", ip)
 	}
 
-	pd, err := sm.deduceCoord.deduceRootPath(context.TODO(), ip)
-	return ProjectRoot(pd.root), err
+	pd, err := sm.deduceCoord.deduceRootPath(ctx, ip)
+	if err != nil {
+		return "", DeductionReason{}, err
+	}
+	return ProjectRoot(pd.root), pd.reason, nil
 }
 
 // InferConstraint tries to puzzle out what kind of version is given in a
@@ -624,8 +1203,8 @@ func (sm *SourceMgr) InferConstraint(s string, pi ProjectIdentifier) (Constraint
 	}
 
 	// Semver Constraint
-	c, err := NewSemverConstraintIC(s)
-	if c != nil && err == nil {
+	c, cerr := NewSemverConstraintIC(s)
+	if c != nil && cerr == nil {
 		return c, nil
 	}
 
@@ -640,11 +1219,12 @@ func (sm *SourceMgr) InferConstraint(s string, pi ProjectIdentifier) (Constraint
 		return r, nil
 	}
 
-	return nil, errors.Errorf("%s is not a valid version for the package %s(%s)", s, pi.ProjectRoot, pi.Source)
+	return nil, &ConstraintError{Ident: pi, Body: s, Err: cerr}
 }
 
 // SourceURLsForPath takes an import path and deduces the set of source URLs
-// that may refer to a canonical upstream source.
+// that may refer to a canonical upstream source, in the order in which they
+// are tried.
 // In general, these URLs differ only by protocol (e.g. https vs. ssh), not path
 func (sm *SourceMgr) SourceURLsForPath(ip string) ([]*url.URL, error) {
 	deduced, err := sm.deduceCoord.deduceRootPath(context.TODO(), ip)
@@ -662,7 +1242,7 @@ func (sm *SourceMgr) SourceURLsForPath(ip string) ([]*url.URL, error) {
 // abbreviated git commit hash. disambiguateRevision would return the complete
 // hash.
 func (sm *SourceMgr) disambiguateRevision(ctx context.Context, pi ProjectIdentifier, rev Revision) (Revision, error) {
-	srcg, err := sm.srcCoord.getSourceGatewayFor(context.TODO(), pi)
+	srcg, err := sm.srcCoord.getSourceGatewayFor(ctx, pi)
 	if err != nil {
 		return "", err
 	}
@@ -798,6 +1378,10 @@ const (
 	ctSourceFetch
 	ctExportTree
 	ctValidateLocal
+	ctDiffRevisions
+	ctDeprecations
+	ctVersionsAsOf
+	ctRevisionTimes
 )
 
 func (ct callType) String() string {
@@ -818,6 +1402,14 @@ func (ct callType) String() string {
 		return "Fetching latest data into local source cache"
 	case ctExportTree:
 		return "Writing code tree out to disk"
+	case ctDiffRevisions:
+		return "Computing differences between revisions"
+	case ctDeprecations:
+		return "Reading version deprecation notices"
+	case ctVersionsAsOf:
+		return "Reconstructing historical version list"
+	case ctRevisionTimes:
+		return "Reading revision commit times"
 	default:
 		panic("unknown calltype")
 	}
@@ -0,0 +1,103 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"sync"
+)
+
+// A VersionPrefetcher can list the versions of several projects at once in the
+// background. The solver asks a SourceManager that implements it, as SourceMgr
+// does, to prefetch the version lists of each atom's dependencies as soon as
+// the atom is selected, rather than listing them one by one as it comes to
+// them.
+type VersionPrefetcher interface {
+	PrefetchVersions([]ProjectIdentifier)
+}
+
+// defaultSourceConcurrency is the number of sources whose versions a SourceMgr
+// lists, or which it syncs, at once, unless configured otherwise.
+const defaultSourceConcurrency = 16
+
+// sourcePool bounds the number of version listings and syncs that a SourceMgr
+// runs at once, and deduplicates requests for the same operation on the same
+// source, so that callers asking at the same time share its result.
+type sourcePool struct {
+	sem   chan struct{}
+	mu    sync.Mutex
+	calls map[poolKey]*poolCall
+}
+
+type poolKey struct {
+	typ callType
+	id  ProjectIdentifier
+}
+
+// poolCall is an operation in flight; done is closed once val and err are set.
+type poolCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+func newSourcePool(n int) *sourcePool {
+	if n <= 0 {
+		n = defaultSourceConcurrency
+	}
+	return &sourcePool{
+		sem:   make(chan struct{}, n),
+		calls: make(map[poolKey]*poolCall),
+	}
+}
+
+// do runs f, the operation of the given type on the source for id, once a slot
+// in the pool is free, unless the same operation is already in flight, in
+// which case it waits for that instead.
+func (p *sourcePool) do(ctx context.Context, typ callType, id ProjectIdentifier, f func(context.Context) (interface{}, error)) (interface{}, error) {
+	k := poolKey{typ: typ, id: id.normalize()}
+	for {
+		p.mu.Lock()
+		c, has := p.calls[k]
+		if !has {
+			c = &poolCall{done: make(chan struct{})}
+			p.calls[k] = c
+			p.mu.Unlock()
+			p.run(ctx, k, c, f)
+			return c.val, c.err
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// If the caller that started the operation gave up on it, while this
+		// one is still waiting, start it afresh.
+		if (c.err == context.Canceled || c.err == context.DeadlineExceeded) && ctx.Err() == nil {
+			continue
+		}
+		return c.val, c.err
+	}
+}
+
+func (p *sourcePool) run(ctx context.Context, k poolKey, c *poolCall, f func(context.Context) (interface{}, error)) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.calls, k)
+		p.mu.Unlock()
+		close(c.done)
+	}()
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		c.err = ctx.Err()
+		return
+	}
+	defer func() { <-p.sem }()
+	c.val, c.err = f(ctx)
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSourcePoolDeduplicates(t *testing.T) {
+	p := newSourcePool(4)
+	id := mkPI("github.com/foo/bar")
+
+	var runs int32
+	release := make(chan struct{})
+	f := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&runs, 1)
+		<-release
+		return "versions", nil
+	}
+
+	var wg sync.WaitGroup
+	vals := make([]interface{}, 8)
+	for i := range vals {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vals[i], _ = p.do(context.Background(), ctListVersions, id, f)
+		}(i)
+	}
+	// Give every caller the chance to join the call in flight.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if runs != 1 {
+		t.Errorf("expected concurrent requests for the same source to share one run, got %d runs", runs)
+	}
+	for i, v := range vals {
+		if v != "versions" {
+			t.Errorf("caller %d got %v instead of the shared result", i, v)
+		}
+	}
+
+	// Once the call has completed, a new request runs it again, as do requests
+	// for other operations on the same source.
+	p.do(context.Background(), ctListVersions, id, f)
+	p.do(context.Background(), ctSourceFetch, id, f)
+	if runs != 3 {
+		t.Errorf("expected completed and distinct operations to run again, got %d runs", runs)
+	}
+}
+
+func TestSourcePoolBoundsConcurrency(t *testing.T) {
+	p := newSourcePool(2)
+
+	var cur, max int32
+	f := func(context.Context) (interface{}, error) {
+		n := atomic.AddInt32(&cur, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&cur, -1)
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p.do(context.Background(), ctListVersions, mkPI(fmt.Sprintf("github.com/foo/bar%d", i)), f)
+		}(i)
+	}
+	wg.Wait()
+
+	if max != 2 {
+		t.Errorf("expected at most 2 operations to run at once, saw %d", max)
+	}
+}
+
+func TestSourcePoolWaiterCanceled(t *testing.T) {
+	p := newSourcePool(1)
+	id := mkPI("github.com/foo/bar")
+
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	go p.do(context.Background(), ctListVersions, id, func(context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+
+	// Both a caller waiting on the call in flight, and one waiting for a slot
+	// in the pool, give up as soon as their context is canceled.
+	for _, other := range []ProjectIdentifier{id, mkPI("github.com/baz/qux")} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := p.do(ctx, ctListVersions, other, func(context.Context) (interface{}, error) {
+			t.Errorf("expected no operation to run for %s", other)
+			return nil, nil
+		})
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("expected waiting for %s to fail with the context's error, got %v", other, err)
+		}
+	}
+}
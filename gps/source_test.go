@@ -9,12 +9,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/golang/dep/gps/pkgtree"
 	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
 )
 
 // Executed in parallel by TestSlowVcs
@@ -142,6 +144,8 @@ func testSourceGateway(t *testing.T) {
 				t.Fatal("wanted err on nonexistent version")
 			} else if err.Error() != wanterr.Error() {
 				t.Fatalf("wanted nonexistent err when passing bad version, got: %s", err)
+			} else if vnf, ok := err.(*VersionNotFoundError); !ok || vnf.Version != badver {
+				t.Fatalf("wanted a *VersionNotFoundError for the bad version, got: %#v", err)
 			}
 
 			_, err = sg.listPackages(ctx, ProjectRoot("github.com/sdboyer/deptest"), badver)
@@ -189,3 +193,57 @@ func testSourceGateway(t *testing.T) {
 	t.Run("empty", do(sourceExistsUpstream|sourceHasLatestVersionList))
 	t.Run("exists", do(sourceExistsLocally))
 }
+
+func TestSourceGatewayEmptyAndNoGoCode(t *testing.T) {
+	requiresBins(t, "git")
+
+	tmp, err := ioutil.TempDir("", "gps-empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	ctx := context.Background()
+	cachedir := filepath.Join(tmp, "cache")
+	if err = os.MkdirAll(filepath.Join(cachedir, "sources"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	gateway := func(repo *localGitRepo) *sourceGateway {
+		u, err := url.Parse("file://" + filepath.ToSlash(repo.dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := maybeGitSource{url: u}.try(ctx, cacheDir{root: cachedir}, sourceSettings{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sg, err := newSourceGateway(ctx, src, newSupervisor(ctx), cachedir, memoryCache{}.newSingleSourceCache(mkPI(u.String())), sourceSettings{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sg
+	}
+
+	empty := gateway(newLocalGitRepo(t, filepath.Join(tmp, "empty")))
+	if _, err := empty.listVersions(ctx); errors.Cause(err) != ErrEmptyRepository {
+		t.Errorf("expected listing an empty repository to fail with ErrEmptyRepository, got %v", err)
+	}
+
+	repo := newLocalGitRepo(t, filepath.Join(tmp, "nogo"))
+	repo.write("README.md", "no code here\n")
+	repo.write("docs/index.html", "<p>nor here</p>\n")
+	repo.git("add", "-A")
+	repo.git("commit", "-q", "-m", "docs")
+	nogo := gateway(repo)
+	if _, err := nogo.listPackages(ctx, "example.com/nogo", Revision(repo.git("rev-parse", "HEAD"))); errors.Cause(err) != ErrNoGoCode {
+		t.Errorf("expected listing a project without Go code to fail with ErrNoGoCode, got %v", err)
+	}
+
+	repo.write("docs/gen.go", "package docs\n")
+	repo.git("add", "-A")
+	repo.git("commit", "-q", "-m", "code")
+	nogo = gateway(repo)
+	if _, err := nogo.listPackages(ctx, "example.com/nogo", Revision(repo.git("rev-parse", "HEAD"))); err != nil {
+		t.Errorf("expected a project with Go code in a subdirectory to be listed, got %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// SteppingSolver is a Solver whose search can be driven one step at a time,
+// so that a tool can pause it between steps - to show the user a conflict, say,
+// or to save a checkpoint of its progress - and then carry on. The Solver
+// returned by Prepare implements it.
+//
+// A solver may either be stepped, or run all at once by Solve, but not both.
+type SteppingSolver interface {
+	Solver
+
+	// Step advances the search by a single step: it selects a project, or
+	// further packages from one already selected, or finds a conflict and
+	// backtracks from it. Once nothing remains to be selected, it builds the
+	// solution, and returns it in a StepDone result.
+	//
+	// An error means that the search has failed, and no further steps may be
+	// taken; nor may they be after StepDone. Canceling the context ends the
+	// search with an error, so to pause it, simply stop calling Step.
+	//
+	// Unlike Solve, stepping does not prefetch the projects in the root lock.
+	Step(context.Context) (StepResult, error)
+
+	// Snapshot returns a checkpoint of the selections made so far, from which
+	// a later solver may resume via Restore.
+	Snapshot() SolverCheckpoint
+
+	// Restore replays the selections recorded in the checkpoint, so that
+	// stepping resumes where the checkpoint was taken. It may only be called
+	// before any steps have been taken.
+	//
+	// The solver need not have been prepared with the same SolveParameters as
+	// the one that took the checkpoint. The version recorded for each project
+	// is always tried first, but if the replayed selections diverge from the
+	// checkpoint - as when a user has adjusted a constraint so that a version
+	// is no longer acceptable - the rest of the checkpoint is discarded, and
+	// the search carries on from there as usual.
+	Restore(context.Context, SolverCheckpoint) error
+
+	// Preview returns the best partial assignment found by the steps taken
+	// so far.
+	Preview() SolvePreview
+}
+
+// StepKind indicates what happened in a step of a SteppingSolver.
+type StepKind uint8
+
+const (
+	// StepSelected indicates that a project, or further packages from one
+	// that was already selected, were selected.
+	StepSelected StepKind = iota + 1
+
+	// StepBacktracked indicates that the project or packages from the
+	// unselected queue conflicted with the current selections, and that the
+	// solver backtracked to try other versions.
+	StepBacktracked
+
+	// StepDone indicates that nothing remains to be selected, and that a
+	// solution has been found.
+	StepDone
+)
+
+func (k StepKind) String() string {
+	switch k {
+	case StepSelected:
+		return "selected"
+	case StepBacktracked:
+		return "backtracked"
+	case StepDone:
+		return "done"
+	}
+	return "unknown"
+}
+
+// StepResult describes what happened in a step of a SteppingSolver.
+type StepResult struct {
+	Kind StepKind
+
+	// Project is the project selected, or with which the conflict was found.
+	Project ProjectIdentifier
+
+	// Version, Packages and PackagesOnly describe a selection: the version of
+	// the project selected, the packages from it selected, and whether the
+	// project had already been selected, with only further packages added.
+	Version      Version
+	Packages     []string
+	PackagesOnly bool
+
+	// Conflict is the failure that caused the solver to backtrack.
+	Conflict error
+
+	// Solution is the solution found, once the search is done.
+	Solution Solution
+}
+
+// SolverCheckpoint records the selections made by a SteppingSolver, in the
+// order they were made, from which a later solver can resume its search. It
+// encodes to and decodes from JSON, so that a long solve can be resumed after
+// its process has exited.
+type SolverCheckpoint struct {
+	Selections []CheckpointSelection
+
+	// Attempts is the number of times the search had backtracked and moved
+	// forward again.
+	Attempts int
+}
+
+// CheckpointSelection is a single selection in a SolverCheckpoint.
+type CheckpointSelection struct {
+	Ident        ProjectIdentifier
+	Version      Version
+	Packages     []string
+	PackagesOnly bool
+}
+
+func (cs CheckpointSelection) matches(r StepResult) bool {
+	return r.Kind == StepSelected &&
+		r.Project == cs.Ident &&
+		r.PackagesOnly == cs.PackagesOnly &&
+		r.Version == cs.Version
+}
+
+type jsonCheckpoint struct {
+	Attempts   int                       `json:"attempts"`
+	Selections []jsonCheckpointSelection `json:"selections"`
+}
+
+type jsonCheckpointSelection struct {
+	Name         ProjectRoot         `json:"name"`
+	Source       string              `json:"source,omitempty"`
+	Version      jsonSnapshotVersion `json:"version"`
+	Packages     []string            `json:"packages"`
+	PackagesOnly bool                `json:"packages-only,omitempty"`
+}
+
+// MarshalJSON encodes the checkpoint.
+func (cp SolverCheckpoint) MarshalJSON() ([]byte, error) {
+	jc := jsonCheckpoint{
+		Attempts:   cp.Attempts,
+		Selections: make([]jsonCheckpointSelection, 0, len(cp.Selections)),
+	}
+	for _, sel := range cp.Selections {
+		jc.Selections = append(jc.Selections, jsonCheckpointSelection{
+			Name:         sel.Ident.ProjectRoot,
+			Source:       sel.Ident.Source,
+			Version:      newJSONVersion(sel.Version),
+			Packages:     sel.Packages,
+			PackagesOnly: sel.PackagesOnly,
+		})
+	}
+	return json.Marshal(jc)
+}
+
+// UnmarshalJSON decodes a checkpoint encoded by MarshalJSON.
+func (cp *SolverCheckpoint) UnmarshalJSON(b []byte) error {
+	var jc jsonCheckpoint
+	if err := json.Unmarshal(b, &jc); err != nil {
+		return err
+	}
+
+	c := SolverCheckpoint{
+		Attempts:   jc.Attempts,
+		Selections: make([]CheckpointSelection, 0, len(jc.Selections)),
+	}
+	for _, js := range jc.Selections {
+		id := ProjectIdentifier{ProjectRoot: js.Name, Source: js.Source}
+		v, err := js.Version.version()
+		if err != nil {
+			return errors.Wrapf(err, "invalid version selected for %s in checkpoint", id)
+		}
+		c.Selections = append(c.Selections, CheckpointSelection{
+			Ident:        id,
+			Version:      v,
+			Packages:     js.Packages,
+			PackagesOnly: js.PackagesOnly,
+		})
+	}
+
+	*cp = c
+	return nil
+}
+
+// startStepping prepares the solver to be stepped, the first time it is
+// called.
+func (s *solver) startStepping() error {
+	if s.stepping {
+		return nil
+	}
+	if !atomic.CompareAndSwapInt32(&s.hasrun, 0, 1) {
+		return errors.New("a solver that has been run by Solve cannot be stepped")
+	}
+	s.stepping = true
+
+	s.mtr = newMetrics()
+	s.mtr.xfer = s.b.meterTransfers()
+	s.mtr.cache = s.b.meterCache()
+	return s.selectRoot()
+}
+
+func (s *solver) Step(ctx context.Context) (StepResult, error) {
+	// The SourceManager's operations run under the caller's context, rather
+	// than the step's own, so that work started in the background during the
+	// step can finish after it.
+	s.b.setContext(ctx)
+	if err := s.startStepping(); err != nil {
+		return StepResult{}, err
+	}
+	if s.stepped {
+		return StepResult{}, errors.New("no further steps may be taken once the search has finished")
+	}
+
+	// As with Solve, fatal errors encountered during the step unwind it by
+	// canceling its context.
+	ctx, s.cancel = context.WithCancel(ctx)
+	defer s.cancel()
+
+	var r StepResult
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	default:
+		r, err = s.step(ctx)
+	}
+	if err == nil && s.fatal == nil && r.Kind != StepDone {
+		return r, nil
+	}
+
+	s.stepped = true
+	var all map[atom]map[string]struct{}
+	if err == nil {
+		all = s.selectedAtoms()
+	}
+	soln, err := s.finish(ctx, all, err)
+	if err != nil {
+		return StepResult{}, err
+	}
+	r.Solution = soln
+	return r, nil
+}
+
+func (s *solver) Snapshot() SolverCheckpoint {
+	cp := SolverCheckpoint{Attempts: s.attempts}
+	if len(s.sel.projects) < 2 {
+		return cp
+	}
+
+	// Skip the root, which is always selected first.
+	for _, sel := range s.sel.projects[1:] {
+		cp.Selections = append(cp.Selections, CheckpointSelection{
+			Ident:        sel.a.a.id,
+			Version:      sel.a.a.v,
+			Packages:     append([]string(nil), sel.a.pl...),
+			PackagesOnly: !sel.first,
+		})
+	}
+	return cp
+}
+
+func (s *solver) Restore(ctx context.Context, cp SolverCheckpoint) error {
+	if s.stepping {
+		return errors.New("a checkpoint can only be restored before any steps are taken")
+	}
+	if err := s.startStepping(); err != nil {
+		return err
+	}
+
+	s.attempts = cp.Attempts
+	s.replay = make(map[ProjectIdentifier]Version, len(cp.Selections))
+	for _, sel := range cp.Selections {
+		if !sel.PackagesOnly {
+			s.replay[sel.Ident] = sel.Version
+		}
+	}
+	defer func() {
+		s.replay = nil
+	}()
+
+	for k, sel := range cp.Selections {
+		// Leave the final step, which builds the solution, to the caller.
+		if _, has := s.nextUnselected(); !has {
+			break
+		}
+
+		r, err := s.Step(ctx)
+		if err != nil {
+			return err
+		}
+		if !sel.matches(r) {
+			s.traceInfo("diverged from checkpoint after replaying %d of its %d selections", k, len(cp.Selections))
+			break
+		}
+	}
+	return nil
+}
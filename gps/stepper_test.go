@@ -0,0 +1,175 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func fixStepper(params SolveParameters, sm SourceManager, t *testing.T) SteppingSolver {
+	params.TraceLogger = log.New(test.Writer{TB: t}, "", 0)
+	params.stdLibFn = func(string) bool { return false }
+	params.mkBridgeFn = overrideMkBridge
+	s, err := Prepare(params, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(SteppingSolver)
+}
+
+// stepToEnd steps the solver until the search is done or fails, and returns
+// the number of times it backtracked along the way.
+func stepToEnd(s SteppingSolver) (Solution, int, error) {
+	var backtracks int
+	for {
+		r, err := s.Step(context.Background())
+		if err != nil {
+			return nil, backtracks, err
+		}
+		switch r.Kind {
+		case StepBacktracked:
+			backtracks++
+		case StepDone:
+			return r.Solution, backtracks, nil
+		}
+	}
+}
+
+func basicFixtureParams(fix basicFixture) SolveParameters {
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		Lock:            dummyLock{},
+		Downgrade:       fix.downgrade,
+		ChangeAll:       fix.changeall,
+		ToChange:        fix.changelist,
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	if fix.l != nil {
+		params.Lock = fix.l
+	}
+	return params
+}
+
+// Stepping through a solve must find exactly what Solve does.
+func TestSteppingBasicSolves(t *testing.T) {
+	names := make([]string, 0, len(basicFixtures))
+	for n := range basicFixtures {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+	for _, n := range names {
+		fix := basicFixtures[n]
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+			if fix.broken != "" {
+				t.Skip(fix.broken)
+			}
+
+			s := fixStepper(basicFixtureParams(fix), newdepspecSM(fix.ds, nil), t)
+			soln, _, err := stepToEnd(s)
+			fixtureSolveSimpleChecks(fix, soln, err, t)
+		})
+	}
+}
+
+func TestSteppingCheckpoints(t *testing.T) {
+	// a@2.0.0 is selected first, but its constraint on c is incompatible with
+	// those of all b's versions, so the solver must backtrack to a@1.0.0.
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b *"),
+			mkDepspec("a 1.0.0", "c 1.0.0"),
+			mkDepspec("a 2.0.0", "c 2.0.0"),
+			mkDepspec("b 1.0.0", "c 1.0.0"),
+			mkDepspec("b 1.1.0", "c 1.0.0"),
+			mkDepspec("c 1.0.0"),
+			mkDepspec("c 2.0.0"),
+		},
+		r: mksolution("a 1.0.0", "b 1.1.0", "c 1.0.0"),
+	}
+	params := basicFixtureParams(fix)
+
+	s := fixStepper(params, newdepspecSM(fix.ds, nil), t)
+	if _, _, err := stepToEnd(s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Step(context.Background()); err == nil {
+		t.Error("expected an error stepping after the search was done")
+	}
+	if err := s.Restore(context.Background(), SolverCheckpoint{}); err == nil {
+		t.Error("expected an error restoring a checkpoint after stepping")
+	}
+	if _, err := s.Solve(context.Background()); err == nil {
+		t.Error("expected an error solving after stepping")
+	}
+
+	// Take a checkpoint partway through, after backtracking, and round trip it
+	// through JSON as if resuming in another process.
+	s = fixStepper(params, newdepspecSM(fix.ds, nil), t)
+	var backtracked bool
+	for !backtracked {
+		r, err := s.Step(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Kind == StepDone {
+			t.Fatal("expected the solver to backtrack before it was done")
+		}
+		backtracked = r.Kind == StepBacktracked
+	}
+	cp := s.Snapshot()
+	if len(cp.Selections) == 0 || cp.Attempts == 0 {
+		t.Fatalf("expected the checkpoint to record selections and attempts, got %+v", cp)
+	}
+
+	b, err := json.Marshal(cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rcp SolverCheckpoint
+	if err := json.Unmarshal(b, &rcp); err != nil {
+		t.Fatal(err)
+	}
+
+	s = fixStepper(params, newdepspecSM(fix.ds, nil), t)
+	if err := s.Restore(context.Background(), rcp); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Snapshot(); len(got.Selections) != len(cp.Selections) || got.Attempts != cp.Attempts {
+		t.Errorf("expected restoring to replay the checkpoint:\n\t(GOT): %+v\n\t(WNT): %+v", got, cp)
+	}
+	soln, backtracks, err := stepToEnd(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backtracks != 0 {
+		t.Errorf("expected no further backtracking after the restored checkpoint, got %d", backtracks)
+	}
+	fixtureSolveSimpleChecks(fix, soln, nil, t)
+
+	// A checkpoint of the finished solve can be resumed under an adjusted
+	// constraint, which the replayed selections then give way to. The earlier
+	// solves' background syncs may still be reading their depspecs, so this
+	// one gets its own.
+	cp = s.Snapshot()
+	fix.ds = append([]depspec{mkDepspec("root 0.0.0", "a 2.0.0")}, fix.ds[1:]...)
+	fix.r = mksolution("a 2.0.0", "c 2.0.0")
+	params = basicFixtureParams(fix)
+	s = fixStepper(params, newdepspecSM(fix.ds, nil), t)
+	if err := s.Restore(context.Background(), cp); err != nil {
+		t.Fatal(err)
+	}
+	soln, _, err = stepToEnd(s)
+	fixtureSolveSimpleChecks(fix, soln, err, t)
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "sort"
+
+// A manifest may declare a constraint on a package within a project, rather
+// than on the project's root - such as on golang.org/x/tools/cmd/stringer,
+// rather than golang.org/x/tools. Such a constraint is on the project, but
+// applies only where its depender reaches that package, or one beneath it. As
+// with any other dependency, the project's own dependencies are then drawn
+// only from the packages that are reached.
+
+// constraintRoot returns the root of the project that contains the path on
+// which a constraint is declared, and whether that is not the path itself -
+// that is, whether the constraint is on a subpackage of the project. Paths
+// from which no root can be deduced are taken to be roots, as they always
+// have been.
+func (s *solver) constraintRoot(pr ProjectRoot) (ProjectRoot, bool) {
+	if root, has := s.croots[pr]; has {
+		return root, root != pr
+	}
+
+	root, err := s.b.DeduceProjectRoot(string(pr))
+	if err != nil || root == pr || !isPathPrefixOrEqual(string(root), string(pr)) {
+		root = pr
+	}
+	if s.croots == nil {
+		s.croots = make(map[ProjectRoot]ProjectRoot)
+	}
+	s.croots[pr] = root
+	return root, root != pr
+}
+
+// applySubpackageConstraints applies each of the constraints on subpackages,
+// whose paths were reached, to the dependency on the subpackage's project in
+// dmap, intersecting it with the constraint the project already has. The
+// source of a subpackage constraint is used only if the project has none, and
+// they are applied in the order of their paths, so that the first such source
+// is. Overrides of the project still take precedence.
+func applySubpackageConstraints(dmap map[ProjectRoot]completeDep, subs map[ProjectRoot]workingConstraint) {
+	paths := make([]string, 0, len(subs))
+	for path := range subs {
+		paths = append(paths, string(path))
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		wc := subs[ProjectRoot(path)]
+		pr := wc.Ident.ProjectRoot
+		cdep, has := dmap[pr]
+		if !has {
+			continue
+		}
+
+		if !cdep.overrConstraint && wc.Constraint != nil {
+			if cdep.Constraint == nil {
+				cdep.Constraint = wc.Constraint
+			} else {
+				cdep.Constraint = cdep.Constraint.Intersect(wc.Constraint)
+			}
+		}
+		if !cdep.overrNet && cdep.Ident.Source == "" {
+			cdep.Ident.Source = wc.Ident.Source
+		}
+		dmap[pr] = cdep
+	}
+}
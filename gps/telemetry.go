@@ -0,0 +1,183 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"time"
+
+	"github.com/golang/dep/gps/paths"
+	"github.com/pkg/errors"
+)
+
+// TelemetrySink receives a summary of each solve that it is set on, through
+// SolveParameters.Telemetry. It is the means by which organizations with many
+// projects can aggregate the health of their dependency resolution; gps
+// itself never sends telemetry anywhere.
+//
+// ReportSolve is called once, synchronously, as each solve finishes, so
+// implementations that send reports over the network should do so in the
+// background.
+type TelemetrySink interface {
+	ReportSolve(SolveTelemetry)
+}
+
+// A PrivacyChecker is a SourceManager that knows which import paths are
+// private, as SourceMgr does. When the SourceManager passed to Prepare is one,
+// the projects whose roots it reports as private are never named in
+// telemetry, even if they match SolveParameters.TelemetryAllowlist.
+type PrivacyChecker interface {
+	IsPrivate(ip string) bool
+}
+
+// SolveTelemetry summarizes a solve without identifying the projects involved,
+// save for those matching SolveParameters.TelemetryAllowlist.
+type SolveTelemetry struct {
+	// Duration is the wall time the solve took.
+	Duration time.Duration
+	// Attempts is the number of times the solver backtracked and started
+	// moving forward again, as reported by Solution.Attempts.
+	Attempts int
+	// Rejections is the number of versions the solver rejected.
+	Rejections int
+	// Projects and Packages are the number of projects and packages in the
+	// solution, excluding the root project. Both are zero if the solve failed.
+	Projects, Packages int
+	// Failure is the class of the failure, if the solve failed, or the empty
+	// string if it succeeded. See FailureClass.
+	Failure string
+	// Allowlisted holds the projects in the solution, or the one the solver
+	// gave up on if it failed, whose roots match the allowlist and are not
+	// private, in sorted order.
+	Allowlisted []ProjectRoot
+}
+
+// FailureClass returns a short, stable name for the kind of failure that err
+// is, suitable for aggregation, such as "disjoint-constraint" or
+// "source-unreachable". It returns the empty string for a nil error, and
+// "other" for errors that gps does not classify.
+func FailureClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	// This unwraps SolveFailures, too.
+	err = errors.Cause(err)
+	if contextCanceledOrSMReleased(err) {
+		return "canceled"
+	}
+
+	switch t := err.(type) {
+	case *noVersionError:
+		return "no-versions"
+	case *caseMismatchFailure, *wrongCaseFailure:
+		return "case-mismatch"
+	case *sharedRepositoryFailure:
+		return "shared-repository"
+	case *disjointConstraintFailure:
+		return "disjoint-constraint"
+	case *constraintNotAllowedFailure, *versionNotAllowedFailure:
+		return "constraint-not-satisfied"
+	case *vetoedVersionFailure:
+		return "vetoed"
+	case *policyPinFailure:
+		return "policy-pin"
+	case *goVersionFailure:
+		return "go-version"
+	case *downgradeFailure:
+		return "downgrade"
+	case *majorVersionFailure:
+		return "major-version"
+	case *sourceMismatchFailure:
+		return "source-mismatch"
+	case *checkeeHasProblemPackagesFailure, *depHasProblemPackagesFailure:
+		return "problem-packages"
+	case *nonexistentRevisionFailure:
+		return "nonexistent-revision"
+	case *SourceUnreachableError:
+		cause := errors.Cause(t.Err)
+		if _, ok := cause.(*AuthenticationError); ok {
+			return "access-denied"
+		}
+		if cause == ErrRepositoryNotFound {
+			return "repository-not-found"
+		}
+		return "source-unreachable"
+	case *AuthenticationError:
+		return "access-denied"
+	case *VersionNotFoundError:
+		return "nonexistent-version"
+	case *CheckoutError:
+		return "checkout"
+	case *OfflineError:
+		return "offline"
+	case *FetchBudgetError:
+		return "fetch-budget"
+	case *toolNotCommandFailure, *missingSourceFailure, badOptsFailure, *ConstraintError:
+		return "bad-input"
+	}
+	if err == ErrRepositoryNotFound {
+		return "repository-not-found"
+	}
+	return "other"
+}
+
+// reportTelemetry sends the summary of the solve that has just finished to
+// the solver's TelemetrySink, if it has one.
+func (s *solver) reportTelemetry(soln solution, err error) {
+	if s.telemetry == nil {
+		return
+	}
+
+	st := SolveTelemetry{
+		Duration:   time.Since(s.mtr.start),
+		Attempts:   s.attempts,
+		Rejections: len(s.rejections),
+		Failure:    FailureClass(err),
+	}
+	allow := func(pr ProjectRoot) {
+		if s.telemPriv != nil && s.telemPriv.IsPrivate(string(pr)) {
+			return
+		}
+		if s.telemAllow != "" && paths.MatchPrefixPatterns(s.telemAllow, string(pr)) {
+			st.Allowlisted = append(st.Allowlisted, pr)
+		}
+	}
+
+	if err == nil {
+		for _, lp := range soln.p {
+			st.Projects++
+			st.Packages += len(lp.Packages())
+			allow(lp.Ident().ProjectRoot)
+		}
+	} else if sf, ok := err.(*SolveFailure); ok {
+		allow(sf.Project.ProjectRoot)
+	}
+
+	s.telemetry.ReportSolve(st)
+}
+
+// failureTelemetry is a TelemetrySink that only passes on the reports of solves
+// that failed, for those whose successes are reported by a later solve.
+type failureTelemetry struct {
+	TelemetrySink
+}
+
+func (t failureTelemetry) ReportSolve(st SolveTelemetry) {
+	if st.Failure != "" {
+		t.TelemetrySink.ReportSolve(st)
+	}
+}
+
+// successTelemetry is a TelemetrySink that only passes on the reports of
+// solves that succeeded, for those whose failures are followed by another
+// solve.
+type successTelemetry struct {
+	TelemetrySink
+}
+
+func (t successTelemetry) ReportSolve(st SolveTelemetry) {
+	if st.Failure == "" {
+		t.TelemetrySink.ReportSolve(st)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep/gps/paths"
+	"github.com/pkg/errors"
+)
+
+type recordingTelemetry []SolveTelemetry
+
+func (r *recordingTelemetry) ReportSolve(st SolveTelemetry) {
+	*r = append(*r, st)
+}
+
+func TestSolveTelemetry(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+	params := basicFixtureParams(fix)
+	var rec recordingTelemetry
+	params.Telemetry = &rec
+	params.TelemetryAllowlist = "shared"
+
+	if _, err := fixSolve(params, newdepspecSM(fix.ds, nil), t); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec) != 1 {
+		t.Fatalf("expected one report, got %v", rec)
+	}
+	st := rec[0]
+	if st.Failure != "" || st.Projects != 3 || st.Packages != 3 || st.Rejections != 2 || st.Duration <= 0 {
+		t.Errorf("unexpected telemetry for a successful solve: %+v", st)
+	}
+	if !reflect.DeepEqual(st.Allowlisted, []ProjectRoot{"shared"}) {
+		t.Errorf("expected only allowlisted projects to be named, got %v", st.Allowlisted)
+	}
+
+	fix = basicFixtures["disjoint constraints"]
+	params = basicFixtureParams(fix)
+	rec = nil
+	params.Telemetry = &rec
+
+	if _, err := fixSolve(params, newdepspecSM(fix.ds, nil), t); err == nil {
+		t.Fatal("expected the solve to fail")
+	}
+	if len(rec) != 1 || rec[0].Failure != "no-versions" || rec[0].Projects != 0 || rec[0].Rejections == 0 || rec[0].Allowlisted != nil {
+		t.Errorf("unexpected telemetry for a failed solve: %+v", rec)
+	}
+}
+
+// privateSM is a depspecSourceManager that reports the import paths matching
+// its patterns as private.
+type privateSM struct {
+	*depspecSourceManager
+	private string
+}
+
+func (sm privateSM) IsPrivate(ip string) bool {
+	return paths.MatchPrefixPatterns(sm.private, ip)
+}
+
+func TestSolveTelemetryPrivate(t *testing.T) {
+	fix := basicFixtures["shared dependency with overlapping constraints"]
+	params := basicFixtureParams(fix)
+	var rec recordingTelemetry
+	params.Telemetry = &rec
+	params.TelemetryAllowlist = "a,shared"
+
+	sm := privateSM{depspecSourceManager: newdepspecSM(fix.ds, nil), private: "shared"}
+	if _, err := fixSolve(params, sm, t); err != nil {
+		t.Fatal(err)
+	}
+	if len(rec) != 1 || !reflect.DeepEqual(rec[0].Allowlisted, []ProjectRoot{"a"}) {
+		t.Errorf("expected private projects not to be named, even if allowlisted, got %+v", rec)
+	}
+}
+
+func TestFailureClass(t *testing.T) {
+	cases := map[string]error{
+		"":                     nil,
+		"disjoint-constraint":  &SolveFailure{err: &disjointConstraintFailure{}},
+		"source-unreachable":   errors.Wrap(&SourceUnreachableError{}, "wrapped"),
+		"access-denied":        &SourceUnreachableError{Err: &AuthenticationError{}},
+		"repository-not-found": &SourceUnreachableError{Err: errors.Wrap(ErrRepositoryNotFound, "remote")},
+		"canceled":             context.Canceled,
+		"bad-input":            badOptsFailure("bad"),
+		"nonexistent-version":  &VersionNotFoundError{Version: NewVersion("v1.0.0")},
+		"checkout":             &CheckoutError{Err: errors.New("disk full")},
+		"other":                errors.New("mystery"),
+	}
+	for want, err := range cases {
+		if got := FailureClass(err); got != want {
+			t.Errorf("expected %v to be classed as %q, got %q", err, want, got)
+		}
+	}
+}
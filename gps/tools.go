@@ -0,0 +1,90 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/gps/paths"
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// toolsImportRoot is the import root of the synthetic root project of a tools
+// solve. The .invalid top-level domain is reserved, so it cannot collide with
+// any real import path.
+const toolsImportRoot = "tools.invalid"
+
+// toolsPackageTree returns the PackageTree of the synthetic root project of a
+// solve for the given tools, which consists of a single package that imports
+// each of them, along with the set of tools.
+func toolsPackageTree(tools []string, stdLibFn func(string) bool) (pkgtree.PackageTree, map[string]bool, error) {
+	if stdLibFn == nil {
+		stdLibFn = paths.IsStandardImportPath
+	}
+
+	set := make(map[string]bool, len(tools))
+	for _, ip := range tools {
+		switch {
+		case ip == "":
+			return pkgtree.PackageTree{}, nil, badOptsFailure("tools must have non-empty import paths")
+		case ip == toolsImportRoot || strings.HasPrefix(ip, toolsImportRoot+"/"):
+			return pkgtree.PackageTree{}, nil, badOptsFailure(fmt.Sprintf("tool %q is within the reserved import path %q", ip, toolsImportRoot))
+		case stdLibFn(ip):
+			return pkgtree.PackageTree{}, nil, badOptsFailure(fmt.Sprintf("tool %q is in the standard library", ip))
+		case set[ip]:
+			return pkgtree.PackageTree{}, nil, badOptsFailure(fmt.Sprintf("tool %q was given more than once", ip))
+		}
+		set[ip] = true
+	}
+
+	imports := append([]string(nil), tools...)
+	sort.Strings(imports)
+	return pkgtree.PackageTree{
+		ImportRoot: toolsImportRoot,
+		Packages: map[string]pkgtree.PackageOrErr{
+			toolsImportRoot: {
+				P: pkgtree.Package{
+					ImportPath: toolsImportRoot,
+					Name:       "tools",
+					Imports:    imports,
+				},
+			},
+		},
+	}, set, nil
+}
+
+// checkToolsAreCommands ensures that, in a tools solve, the packages of the
+// atom's project that are solved for as tools are commands.
+func (s *solver) checkToolsAreCommands(a atomWithPackages) error {
+	if len(s.rd.tools) == 0 || s.rd.isRoot(a.a.id.ProjectRoot) {
+		return nil
+	}
+
+	ptree, err := s.b.ListPackages(a.a.id, a.a.v)
+	if err != nil {
+		return err
+	}
+
+	var notcmd []string
+	for _, pkg := range a.pl {
+		if !s.rd.tools[pkg] {
+			continue
+		}
+		// Missing and broken packages are reported elsewhere.
+		if poe, has := ptree.Packages[pkg]; has && poe.Err == nil && poe.P.Name != "main" {
+			notcmd = append(notcmd, pkg)
+		}
+	}
+
+	if len(notcmd) > 0 {
+		return &toolNotCommandFailure{
+			goal: a.a,
+			pkgs: notcmd,
+		}
+	}
+	return nil
+}
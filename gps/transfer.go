@@ -0,0 +1,254 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+)
+
+// VCS tools do not report how much they transfer, so the bytes fetched for a
+// source are estimated by how much its local repository grows while it is
+// cloned or updated. Only the repository's metadata directory is measured,
+// where there is one, so that checking out a working tree is not counted as
+// transfer. The estimate errs low for repositories that repack as they fetch,
+// but is close enough to keep a solve within a budget of the right order.
+
+// TransferCounter is implemented by SourceManagers that can report how many
+// bytes they have fetched from upstream sources. The solver uses it to account
+// for, and limit, the bytes fetched while solving. See
+// SolveParameters.FetchBudget.
+type TransferCounter interface {
+	// BytesFetched returns the number of bytes fetched for the source of the
+	// project over the lifetime of the SourceManager. It returns zero for
+	// sources that have not been contacted, and does not contact them.
+	BytesFetched(ProjectIdentifier) int64
+}
+
+// localPath returns the path of the source's local repository.
+func (bs *baseVCSSource) localPath() string {
+	return bs.repo.LocalPath()
+}
+
+// vcsMetadataDirs are the directories in which the supported VCSes keep the
+// history of a working copy.
+var vcsMetadataDirs = []string{".git", ".hg", ".bzr", ".svn"}
+
+// repositorySize returns the number of bytes occupied by the repository at
+// path, excluding its working tree, if possible. Files that cannot be read are
+// skipped.
+func repositorySize(path string) int64 {
+	root := path
+	for _, d := range vcsMetadataDirs {
+		if fi, err := os.Stat(filepath.Join(path, d)); err == nil && fi.IsDir() {
+			root = filepath.Join(path, d)
+			break
+		}
+	}
+
+	var n int64
+	filepath.Walk(root, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			n += fi.Size()
+		}
+		return nil
+	})
+	return n
+}
+
+// meterFetch calls f, which may fetch into the gateway's local repository,
+// and adds the growth of the repository to the bytes fetched for the source.
+func (sg *sourceGateway) meterFetch(f func() (sourceState, error)) (sourceState, error) {
+	ls, ok := sg.src.(interface {
+		localPath() string
+	})
+	if !ok {
+		return f()
+	}
+
+	before := repositorySize(ls.localPath())
+	state, err := f()
+	if grown := repositorySize(ls.localPath()) - before; grown > 0 {
+		atomic.AddInt64(&sg.fetched, grown)
+	}
+	return state, err
+}
+
+// BytesFetched returns an estimate of the number of bytes the SourceMgr has
+// fetched for the source of the project, by cloning or updating its local
+// repository. It returns zero for sources the SourceMgr has not yet set up.
+func (sm *SourceMgr) BytesFetched(id ProjectIdentifier) int64 {
+	sg := sm.srcCoord.existingGatewayFor(id)
+	if sg == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&sg.fetched)
+}
+
+// existingGatewayFor returns the sourceGateway already set up for the project,
+// or nil if there is none.
+func (sc *sourceCoordinator) existingGatewayFor(id ProjectIdentifier) *sourceGateway {
+	sc.srcmut.RLock()
+	defer sc.srcmut.RUnlock()
+
+	if url, has := sc.nameToURL[id.normalizedSource()]; has {
+		return sc.srcs[url]
+	}
+	return nil
+}
+
+// FetchBudgetError is returned from a solve in which the bytes fetched from
+// upstream sources exceeded the SolveParameters.FetchBudget.
+type FetchBudgetError struct {
+	// Budget is the number of bytes the solve was permitted to fetch.
+	Budget int64
+	// Fetched is the number of bytes fetched for each project by the time
+	// the solve was abandoned.
+	Fetched map[ProjectRoot]int64
+}
+
+func (e *FetchBudgetError) Error() string {
+	var total int64
+	prs := make([]string, 0, len(e.Fetched))
+	for pr, n := range e.Fetched {
+		total += n
+		prs = append(prs, string(pr))
+	}
+	sort.Slice(prs, func(i, j int) bool {
+		ni, nj := e.Fetched[ProjectRoot(prs[i])], e.Fetched[ProjectRoot(prs[j])]
+		if ni != nj {
+			return ni > nj
+		}
+		return prs[i] < prs[j]
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "solving fetched %d bytes from upstream sources, exceeding the budget of %d bytes", total, e.Budget)
+	// Name the heaviest few, as they are the likeliest to be worth pinning or
+	// vendoring.
+	for i, pr := range prs {
+		if i == 5 {
+			fmt.Fprintf(&buf, "\n\t... and %d more", len(prs)-i)
+			break
+		}
+		fmt.Fprintf(&buf, "\n\t%s: %d bytes", pr, e.Fetched[ProjectRoot(pr)])
+	}
+	return buf.String()
+}
+
+// transferMeter accounts for the bytes fetched for each project during a single
+// solve, as reported by a TransferCounter. The count for a project is taken
+// relative to what had already been fetched for it when the solve first asked
+// for it, so that fetches made by earlier solves on the same SourceManager are
+// not charged to this one.
+//
+// A nil *transferMeter counts nothing and never exceeds its budget.
+type transferMeter struct {
+	tc     TransferCounter
+	budget int64
+
+	mu      sync.Mutex
+	base    map[ProjectIdentifier]int64
+	fetched map[ProjectIdentifier]int64
+	total   int64
+}
+
+func newTransferMeter(tc TransferCounter, budget int64) *transferMeter {
+	return &transferMeter{
+		tc:      tc,
+		budget:  budget,
+		base:    make(map[ProjectIdentifier]int64),
+		fetched: make(map[ProjectIdentifier]int64),
+	}
+}
+
+// watch records the bytes already fetched for the project, if it is not yet
+// being watched. It must be called before the solve first asks the
+// SourceManager for anything that may fetch the project.
+func (tm *transferMeter) watch(id ProjectIdentifier) {
+	if tm == nil {
+		return
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if _, has := tm.base[id]; !has {
+		tm.base[id] = tm.tc.BytesFetched(id)
+	}
+}
+
+// update brings the count for the watched project up to date.
+func (tm *transferMeter) update(id ProjectIdentifier) {
+	if tm == nil {
+		return
+	}
+
+	n := tm.tc.BytesFetched(id)
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	base, has := tm.base[id]
+	if !has || n-base <= tm.fetched[id] {
+		return
+	}
+	tm.total += n - base - tm.fetched[id]
+	tm.fetched[id] = n - base
+}
+
+// exceeded returns a *FetchBudgetError if a budget was set and the solve has
+// fetched more than it.
+func (tm *transferMeter) exceeded() error {
+	if tm == nil || tm.budget <= 0 {
+		return nil
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if tm.total <= tm.budget {
+		return nil
+	}
+	return &FetchBudgetError{
+		Budget:  tm.budget,
+		Fetched: tm.byProject(),
+	}
+}
+
+// byProject returns the nonzero counts by project root. tm.mu must be held.
+func (tm *transferMeter) byProject() map[ProjectRoot]int64 {
+	m := make(map[ProjectRoot]int64)
+	for id, n := range tm.fetched {
+		if n > 0 {
+			m[id.ProjectRoot] += n
+		}
+	}
+	return m
+}
+
+// dump writes the total bytes fetched, and the counts for each project that
+// fetched any, to buf.
+func (tm *transferMeter) dump(buf *bytes.Buffer) {
+	tm.mu.Lock()
+	m := tm.byProject()
+	total := tm.total
+	tm.mu.Unlock()
+
+	prs := make([]string, 0, len(m))
+	for pr := range m {
+		prs = append(prs, string(pr))
+	}
+	sort.Strings(prs)
+
+	w := tabwriter.NewWriter(buf, 0, 0, 1, ' ', tabwriter.AlignRight)
+	for _, pr := range prs {
+		fmt.Fprintf(w, "\t%s:\t%d\t\n", pr, m[ProjectRoot(pr)])
+	}
+	fmt.Fprintf(w, "\n\tTOTAL:\t%d\t\n", total)
+	w.Flush()
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// transferSM simulates fetching each project's source, at a cost of perProject
+// bytes, the first time its packages are listed.
+type transferSM struct {
+	*depspecSourceManager
+	perProject int64
+
+	mu      sync.Mutex
+	fetched map[ProjectRoot]int64
+}
+
+func (sm *transferSM) ListPackages(id ProjectIdentifier, v Version) (pkgtree.PackageTree, error) {
+	sm.mu.Lock()
+	if _, has := sm.fetched[id.ProjectRoot]; !has {
+		sm.fetched[id.ProjectRoot] = sm.perProject
+	}
+	sm.mu.Unlock()
+	return sm.depspecSourceManager.ListPackages(id, v)
+}
+
+func (sm *transferSM) BytesFetched(id ProjectIdentifier) int64 {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.fetched[id.ProjectRoot]
+}
+
+func TestFetchBudget(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *", "b *"),
+			mkDepspec("a 1.0.0", "c *"),
+			mkDepspec("b 1.0.0"),
+			mkDepspec("c 1.0.0"),
+		},
+	}
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		ProjectAnalyzer: naiveAnalyzer{},
+	}
+	newSM := func() *transferSM {
+		return &transferSM{
+			depspecSourceManager: newdepspecSM(fix.ds, nil),
+			perProject:           100,
+			fetched:              make(map[ProjectRoot]int64),
+		}
+	}
+
+	params.FetchBudget = 300
+	if _, err := fixSolve(params, newSM(), t); err != nil {
+		t.Fatalf("expected the solve to fit within its budget, got %s", err)
+	}
+
+	params.FetchBudget = 250
+	_, err := fixSolve(params, newSM(), t)
+	fbe, ok := err.(*FetchBudgetError)
+	if !ok {
+		t.Fatalf("expected a *FetchBudgetError, got %T: %v", err, err)
+	}
+	var total int64
+	for _, n := range fbe.Fetched {
+		total += n
+	}
+	if fbe.Budget != 250 || total != 300 {
+		t.Errorf("unexpected budget error: %s", fbe)
+	}
+
+	// Bytes fetched before the solve are not charged to it.
+	sm := newSM()
+	sm.fetched["a"], sm.fetched["b"], sm.fetched["c"] = 100, 100, 100
+	if _, err := fixSolve(params, sm, t); err != nil {
+		t.Errorf("expected earlier fetches not to count against the budget, got %s", err)
+	}
+
+	if _, err := Prepare(params, newdepspecSM(fix.ds, nil)); err == nil {
+		t.Error("expected a fetch budget to require a TransferCounter")
+	}
+}
+
+func TestRepositorySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reposize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, n int) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, make([]byte, n), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("main.go", 10)
+	if n := repositorySize(dir); n != 10 {
+		t.Errorf("expected a directory without VCS metadata to be measured whole, got %d bytes", n)
+	}
+
+	write(filepath.Join(".git", "objects", "pack", "p.pack"), 100)
+	write(filepath.Join(".git", "HEAD"), 5)
+	if n := repositorySize(dir); n != 105 {
+		t.Errorf("expected only the metadata directory to be measured, got %d bytes", n)
+	}
+}
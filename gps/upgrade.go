@@ -0,0 +1,172 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// UpgradeStatus describes how far an attempt to upgrade a project got.
+type UpgradeStatus uint8
+
+const (
+	// UpgradeSucceeded indicates that the project was moved to, or already
+	// was at, the newest version the root project admits.
+	UpgradeSucceeded UpgradeStatus = iota
+	// UpgradeBlocked indicates that the project could not be moved to the
+	// newest version the root project admits.
+	UpgradeBlocked
+	// UpgradeExcluded indicates that the project was not to be upgraded.
+	UpgradeExcluded
+)
+
+func (s UpgradeStatus) String() string {
+	switch s {
+	case UpgradeSucceeded:
+		return "upgraded"
+	case UpgradeBlocked:
+		return "blocked"
+	case UpgradeExcluded:
+		return "excluded"
+	}
+	return fmt.Sprintf("UpgradeStatus(%d)", uint8(s))
+}
+
+// UpgradeOutcome reports the outcome of an attempt to upgrade a project.
+type UpgradeOutcome struct {
+	Project ProjectRoot
+	Status  UpgradeStatus
+	// From is the project's version in the root lock, or nil if it was not
+	// locked, and To its version in the solution.
+	From, To Version
+	// Newest is the newest version of the project that the root project's
+	// constraint, or override, admits, or nil if it admits none of the
+	// versions the source lists, as with a constraint to a revision. It is
+	// nil for excluded projects.
+	Newest Version
+	// BlockedBy lists, for a blocked project, the dependers whose constraints
+	// do not admit Newest, and Pin is the policy pin on the project, if it
+	// does not admit Newest either. If there are neither, Newest was ruled
+	// out by the constraints on other projects, such as its own dependencies.
+	BlockedBy []DependerConstraint
+	Pin       *PolicyPin
+}
+
+// UpgradeAllExcept solves for moving every project to its newest admissible
+// version, save for the projects in except, whose versions in the root lock
+// are kept if possible. It is the inverse of naming projects in ToChange, and
+// reports the outcome for each project in the solution, sorted by project.
+//
+// The ToChange, ChangeAll and ChangeAllExcept fields of params need not be
+// set; they are replaced.
+func UpgradeAllExcept(ctx context.Context, params SolveParameters, sm SourceManager, except []ProjectRoot) (Solution, []UpgradeOutcome, error) {
+	params.ToChange = nil
+	params.ChangeAll = len(except) == 0
+	params.ChangeAllExcept = except
+
+	s, err := Prepare(params, sm)
+	if err != nil {
+		return nil, nil, err
+	}
+	soln, err := s.Solve(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outcomes, err := upgradeOutcomes(params, sm, soln)
+	if err != nil {
+		return nil, nil, err
+	}
+	return soln, outcomes, nil
+}
+
+// upgradeOutcomes compares each project's version in soln with the newest
+// version the root project admits.
+func upgradeOutcomes(params SolveParameters, sm SourceManager, soln Solution) ([]UpgradeOutcome, error) {
+	rd, err := params.toRootdata()
+	if err != nil {
+		return nil, err
+	}
+
+	admit := rd.rootConstraints()
+	acs := soln.AggregateConstraints()
+	var outcomes []UpgradeOutcome
+	for _, lp := range soln.Projects() {
+		pr := lp.Ident().ProjectRoot
+		o := UpgradeOutcome{
+			Project: pr,
+			To:      lp.Version(),
+		}
+		if llp, has := rd.rlm[pr]; has {
+			o.From = llp.Version()
+		}
+		if _, kept := rd.keep[pr]; kept {
+			o.Status = UpgradeExcluded
+			outcomes = append(outcomes, o)
+			continue
+		}
+
+		c, has := admit[pr]
+		if !has {
+			c = Any()
+		}
+		o.Newest, err = newestAdmitted(sm, lp.Ident(), c)
+		if err != nil {
+			return nil, err
+		}
+
+		if o.Newest != nil && !unpairedVersion(o.Newest).identical(unpairedVersion(o.To)) {
+			o.Status = UpgradeBlocked
+			for _, dc := range acs[pr].Dependers {
+				if !dc.Constraint.Matches(o.Newest) {
+					o.BlockedBy = append(o.BlockedBy, dc)
+				}
+			}
+			if pin, has := params.PolicyPins[pr]; has && !pin.Constraint.Matches(o.Newest) {
+				o.Pin = &pin
+			}
+		}
+		outcomes = append(outcomes, o)
+	}
+
+	sort.Slice(outcomes, func(i, j int) bool { return outcomes[i].Project < outcomes[j].Project })
+	return outcomes, nil
+}
+
+// newestAdmitted returns the first version of the project that c admits, in
+// the order in which the solver would try them when upgrading.
+func newestAdmitted(sm SourceManager, id ProjectIdentifier, c Constraint) (Version, error) {
+	pvl, err := sm.ListVersions(id)
+	if err != nil {
+		return nil, err
+	}
+
+	vl := make([]Version, len(pvl))
+	for i, pv := range pvl {
+		vl[i] = pv
+	}
+	SortForUpgrade(vl)
+	if ch, ok := ChannelOf(c); ok {
+		sortForChannel(vl, ch, false)
+	}
+
+	for _, v := range vl {
+		if c.Matches(v) {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+// unpairedVersion returns v without its underlying revision, if it is paired
+// with one.
+func unpairedVersion(v Version) Version {
+	if pv, ok := v.(PairedVersion); ok {
+		return pv.Unpair()
+	}
+	return v
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"log"
+	"testing"
+
+	"github.com/golang/dep/internal/test"
+)
+
+func TestUpgradeAllExcept(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "foo *", "bar *", "baz *"),
+			mkDepspec("foo 1.0.0", "baz 1.0.0"),
+			mkDepspec("foo 1.0.1", "baz 1.0.0"),
+			mkDepspec("bar 1.0.0"),
+			mkDepspec("bar 1.0.1"),
+			mkDepspec("baz 1.0.0"),
+			mkDepspec("baz 1.1.0"),
+		},
+		l: mklock(
+			"foo 1.0.0",
+			"bar 1.0.0",
+			"baz 1.0.0",
+		),
+	}
+
+	params := basicFixtureParams(fix)
+	params.TraceLogger = log.New(test.Writer{TB: t}, "", 0)
+	params.stdLibFn = func(string) bool { return false }
+	params.mkBridgeFn = overrideMkBridge
+
+	_, outcomes, err := UpgradeAllExcept(context.Background(), params, newdepspecSM(fix.ds, nil), []ProjectRoot{"bar"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []struct {
+		pr             ProjectRoot
+		status         UpgradeStatus
+		from, to, newe string
+		blockedBy      []string
+	}{
+		{pr: "bar", status: UpgradeExcluded, from: "1.0.0", to: "1.0.0"},
+		{pr: "baz", status: UpgradeBlocked, from: "1.0.0", to: "1.0.0", newe: "1.1.0", blockedBy: []string{"foo"}},
+		{pr: "foo", status: UpgradeSucceeded, from: "1.0.0", to: "1.0.1", newe: "1.0.1"},
+	}
+	if len(outcomes) != len(want) {
+		t.Fatalf("expected %d outcomes, got %d: %v", len(want), len(outcomes), outcomes)
+	}
+	vstr := func(v Version) string {
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	}
+	for i, w := range want {
+		o := outcomes[i]
+		if o.Project != w.pr || o.Status != w.status {
+			t.Errorf("outcome %d: expected %s to be %s, got %s %s", i, w.pr, w.status, o.Project, o.Status)
+			continue
+		}
+		if vstr(o.From) != w.from || vstr(o.To) != w.to || vstr(o.Newest) != w.newe {
+			t.Errorf("%s: expected %q -> %q (newest %q), got %q -> %q (newest %q)", w.pr, w.from, w.to, w.newe, vstr(o.From), vstr(o.To), vstr(o.Newest))
+		}
+		var blockers []string
+		for _, dc := range o.BlockedBy {
+			blockers = append(blockers, string(dc.Depender))
+		}
+		if len(blockers) != len(w.blockedBy) || (len(blockers) > 0 && blockers[0] != w.blockedBy[0]) {
+			t.Errorf("%s: expected to be blocked by %v, got %v", w.pr, w.blockedBy, blockers)
+		}
+	}
+
+	// An excluded project must be in the lock.
+	if _, _, err = UpgradeAllExcept(context.Background(), params, newdepspecSM(fix.ds, nil), []ProjectRoot{"qux"}); err == nil {
+		t.Error("expected excluding a project not in the lock to fail")
+	}
+}
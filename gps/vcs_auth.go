@@ -0,0 +1,295 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// VCSCredentials are credentials with which git authenticates to the upstreams
+// of private sources. Unlike InheritVCSAuth, they do not depend on the user's
+// VCS configuration, so the same credentials can be provided the same way on
+// workstations and CI machines alike.
+//
+// Credentials are passed to git through its environment, never on its command
+// line, so that they are not visible to other users of the machine.
+type VCSCredentials struct {
+	// SSHKey is the path to a private key with which git authenticates to
+	// sources fetched over ssh, in place of the keys in ~/.ssh.
+	SSHKey string
+	// SSHAuthSock is the socket of the ssh agent through which git
+	// authenticates to sources fetched over ssh. If empty, the agent in
+	// SSH_AUTH_SOCK is used, as usual.
+	SSHAuthSock string
+	// Netrc is the path to a netrc file, whose machine entries hold logins for
+	// sources fetched over https. Default entries are ignored.
+	Netrc string
+	// Tokens maps hosts, with their ports if not the default, to the access
+	// tokens with which git authenticates to the sources on them fetched over
+	// https, such as an "x-access-token" for GitHub or a personal access token
+	// for GitLab. A token of the form
+	// user:password is sent as is; any other token is sent with the username
+	// "x-access-token". Tokens take precedence over entries in Netrc.
+	Tokens map[string]string
+}
+
+// ParseHostTokens parses a comma-separated list of host=token entries, such as
+// "github.com=ghp_abc,gitlab.corp.example.com=glpat-def", into a map suitable
+// for VCSCredentials.Tokens.
+func ParseHostTokens(list string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.Index(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			// The entry itself is not quoted, so as not to print the token.
+			return nil, errors.New("invalid host token: entries must be of the form host=token")
+		}
+		tokens[strings.ToLower(entry[:i])] = entry[i+1:]
+	}
+	return tokens, nil
+}
+
+// vcsCredentials are VCSCredentials resolved into what is added to git's
+// environment.
+type vcsCredentials struct {
+	// env holds the ssh variables set for every git invocation.
+	env []string
+	// auth maps lowercased hosts to the Authorization header sent to them.
+	auth map[string]string
+}
+
+// resolve reads the netrc file, if any, and resolves the credentials. It
+// returns nil if there are no credentials at all.
+func (c VCSCredentials) resolve() (*vcsCredentials, error) {
+	creds := &vcsCredentials{auth: make(map[string]string)}
+	if c.SSHKey != "" {
+		if _, err := os.Stat(c.SSHKey); err != nil {
+			return nil, errors.Wrap(err, "failed to find ssh key")
+		}
+		creds.env = append(creds.env, "GIT_SSH_COMMAND=ssh -i "+shellQuote(c.SSHKey)+" -o IdentitiesOnly=yes -o BatchMode=yes")
+	}
+	if c.SSHAuthSock != "" {
+		creds.env = append(creds.env, "SSH_AUTH_SOCK="+c.SSHAuthSock)
+	}
+
+	if c.Netrc != "" {
+		f, err := os.Open(c.Netrc)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open netrc file")
+		}
+		logins, err := parseNetrc(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse netrc file %s", c.Netrc)
+		}
+		for host, login := range logins {
+			creds.auth[host] = basicAuth(login[0], login[1])
+		}
+	}
+	for host, token := range c.Tokens {
+		user, pass := "x-access-token", token
+		if i := strings.Index(token, ":"); i >= 0 {
+			user, pass = token[:i], token[i+1:]
+		}
+		creds.auth[strings.ToLower(host)] = basicAuth(user, pass)
+	}
+
+	if len(creds.env) == 0 && len(creds.auth) == 0 {
+		return nil, nil
+	}
+	return creds, nil
+}
+
+// gitEnv returns the variables that give git the credentials. The headers are
+// passed in GIT_CONFIG_PARAMETERS, as -c flags would be, in the form that all
+// versions of git understand, and are only sent to hosts over https.
+func (c *vcsCredentials) gitEnv() []string {
+	env := append([]string(nil), c.env...)
+	if len(c.auth) == 0 {
+		return env
+	}
+
+	hosts := make([]string, 0, len(c.auth))
+	for host := range c.auth {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	params := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		params = append(params, shellQuote("http.https://"+host+"/.extraHeader=Authorization: "+c.auth[host]))
+	}
+	return append(env, "GIT_CONFIG_PARAMETERS="+strings.Join(params, " "))
+}
+
+// authHeader returns the Authorization header to send to host, if any.
+func (c *vcsCredentials) authHeader(host string) string {
+	if c == nil {
+		return ""
+	}
+	return c.auth[strings.ToLower(host)]
+}
+
+func basicAuth(user, pass string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+}
+
+// shellQuote quotes s for a POSIX shell, as git does with the values of
+// GIT_SSH_COMMAND and GIT_CONFIG_PARAMETERS.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// parseNetrc reads the machine entries of a netrc file, returning the login and
+// password for each lowercased host. macdef definitions, default entries and
+// entries without a password are skipped.
+func parseNetrc(r io.Reader) (map[string][2]string, error) {
+	logins := make(map[string][2]string)
+	var host, login, password string
+	flush := func() {
+		if host != "" && password != "" {
+			logins[strings.ToLower(host)] = [2]string{login, password}
+		}
+		host, login, password = "", "", ""
+	}
+
+	s := bufio.NewScanner(r)
+	inMacro := false
+	var pending string
+	for s.Scan() {
+		line := s.Text()
+		if inMacro {
+			// A macro runs until the next empty line.
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			if pending != "" {
+				switch pending {
+				case "machine":
+					host = fields[i]
+				case "login":
+					login = fields[i]
+				case "password":
+					password = fields[i]
+				}
+				pending = ""
+				continue
+			}
+
+			switch fields[i] {
+			case "machine":
+				flush()
+				pending = "machine"
+			case "default":
+				// Credentials for any host are never sent to sources.
+				flush()
+			case "login", "password", "account":
+				pending = fields[i]
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			default:
+				if strings.HasPrefix(fields[i], "#") {
+					i = len(fields)
+					continue
+				}
+				return nil, fmt.Errorf("unexpected token %q", fields[i])
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return logins, nil
+}
+
+// ErrRepositoryNotFound is the cause of the error returned when the server of
+// a source's upstream reports that the repository does not exist, or when a
+// check for the source's existence upstream fails to find it. Some hosts,
+// GitHub among them, also report private repositories that the credentials do
+// not grant access to as not existing.
+var ErrRepositoryNotFound = errors.New("repository not found")
+
+// AuthenticationError indicates that the server of a source's upstream refused
+// access to it, because no credentials were provided or because those provided
+// were rejected. It is distinct from the repository not existing, which is
+// reported with ErrRepositoryNotFound.
+type AuthenticationError struct {
+	// Remote is the URL of the upstream.
+	Remote string
+	// Output is the VCS command's output.
+	Output string
+}
+
+func (e *AuthenticationError) Error() string {
+	return fmt.Sprintf("access to %s was denied; check the credentials for private repositories: %s", e.Remote, strings.TrimSpace(e.Output))
+}
+
+// The fragments of git's output, lowercased, that identify refused access and
+// missing repositories. Refused access is looked for first, as git follows
+// either with a message that mentions both.
+var (
+	gitAccessDenied = []string{
+		"permission denied (publickey",
+		"could not read username",
+		"could not read password",
+		"authentication failed",
+		"invalid username or password",
+		"http basic: access denied",
+		"returned error: 401",
+		"returned error: 403",
+	}
+	gitNotFound = []string{
+		"repository not found",
+		"does not appear to be a git repository",
+		"the project you were looking for could not be found",
+		"returned error: 404",
+	}
+	// git reports a 404 from a server over http(s) this way.
+	gitHTTPNotFound = regexp.MustCompile(`repository '[^']*' not found`)
+)
+
+// gitAccessError returns the error to report for the failure of a git command
+// that talked to remote, with the output out: an *AuthenticationError if
+// access was refused, ErrRepositoryNotFound wrapped with the output if the
+// repository does not exist, and otherwise err itself.
+func gitAccessError(remote, out string, err error) error {
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	lower := strings.ToLower(out)
+	for _, s := range gitAccessDenied {
+		if strings.Contains(lower, s) {
+			return &AuthenticationError{Remote: remote, Output: out}
+		}
+	}
+	notFound := gitHTTPNotFound.MatchString(lower)
+	for _, s := range gitNotFound {
+		notFound = notFound || strings.Contains(lower, s)
+	}
+	if notFound {
+		return errors.Wrapf(ErrRepositoryNotFound, "%s: %s", remote, strings.TrimSpace(out))
+	}
+	return err
+}
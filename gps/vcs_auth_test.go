@@ -0,0 +1,210 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseHostTokens(t *testing.T) {
+	tokens, err := ParseHostTokens(" GitHub.com=ghp_abc, gitlab.example.com=me:glpat=def ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"github.com":         "ghp_abc",
+		"gitlab.example.com": "me:glpat=def",
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("unexpected tokens:\n\t(GOT): %v\n\t(WNT): %v", tokens, want)
+	}
+
+	for _, bad := range []string{"github.com", "=ghp_abc", "github.com="} {
+		_, err := ParseHostTokens(bad)
+		if err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		} else if strings.Contains(err.Error(), "ghp_abc") {
+			t.Errorf("expected the error not to contain the token, got %v", err)
+		}
+	}
+}
+
+func TestParseNetrc(t *testing.T) {
+	logins, err := parseNetrc(strings.NewReader(`# Work hosts.
+machine git.Example.com login me password secret
+machine other.example.com
+	login you
+	password hunter2
+	account ignored
+
+macdef init
+machine macro.example.com login no password no
+
+machine nopass.example.com login me
+default login anyone password anything
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]string{
+		"git.example.com":   {"me", "secret"},
+		"other.example.com": {"you", "hunter2"},
+	}
+	if !reflect.DeepEqual(logins, want) {
+		t.Errorf("unexpected logins:\n\t(GOT): %v\n\t(WNT): %v", logins, want)
+	}
+
+	if _, err := parseNetrc(strings.NewReader("machine a login b bogus c\n")); err == nil {
+		t.Error("expected an unknown token to be rejected")
+	}
+}
+
+func TestResolveVCSCredentials(t *testing.T) {
+	if creds, err := (VCSCredentials{}).resolve(); creds != nil || err != nil {
+		t.Errorf("expected no credentials, got %v (%v)", creds, err)
+	}
+
+	dir, err := ioutil.TempDir("", "vcsauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	netrc, key := filepath.Join(dir, "netrc"), filepath.Join(dir, "it's a key")
+	if err := ioutil.WriteFile(netrc, []byte("machine a.example.com login me password pw\nmachine b.example.com login me password pw\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(key, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := VCSCredentials{
+		SSHKey:      key,
+		SSHAuthSock: "/tmp/agent.sock",
+		Netrc:       netrc,
+		Tokens:      map[string]string{"B.example.com": "tok"},
+	}.resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`GIT_SSH_COMMAND=ssh -i '` + dir + `/it'\''s a key' -o IdentitiesOnly=yes -o BatchMode=yes`,
+		"SSH_AUTH_SOCK=/tmp/agent.sock",
+		"GIT_CONFIG_PARAMETERS='http.https://a.example.com/.extraHeader=Authorization: " + basicAuth("me", "pw") + "' " +
+			"'http.https://b.example.com/.extraHeader=Authorization: " + basicAuth("x-access-token", "tok") + "'",
+	}
+	if got := creds.gitEnv(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected git environment:\n\t(GOT): %q\n\t(WNT): %q", got, want)
+	}
+
+	for _, bad := range []VCSCredentials{{SSHKey: filepath.Join(dir, "nokey")}, {Netrc: filepath.Join(dir, "nonetrc")}} {
+		if _, err := bad.resolve(); err == nil {
+			t.Errorf("expected missing files in %+v to be an error", bad)
+		}
+	}
+}
+
+func TestGitAccessError(t *testing.T) {
+	other := errors.New("other")
+	cases := map[string]error{
+		"git@github.com: Permission denied (publickey).\r\nfatal: Could not read from remote repository.\n\nPlease make sure you have the correct access rights\nand the repository exists.": &AuthenticationError{},
+		"fatal: could not read Username for 'https://github.com': terminal prompts disabled":                                                                                                 &AuthenticationError{},
+		"remote: HTTP Basic: Access denied\nfatal: Authentication failed for 'https://gitlab.com/a/b.git/'":                                                                                  &AuthenticationError{},
+		"remote: Repository not found.\nfatal: repository 'https://github.com/a/b/' not found":                                                                                               ErrRepositoryNotFound,
+		"fatal: repository 'https://example.com/a/b/' not found":                                                                                                                             ErrRepositoryNotFound,
+		"ERROR: The project you were looking for could not be found or you don't have permission to view it.":                                                                                ErrRepositoryNotFound,
+		"fatal: unable to access 'https://example.com/a/b/': Could not resolve host: example.com":                                                                                            other,
+	}
+	for out, want := range cases {
+		got := gitAccessError("remote", out, other)
+		switch want.(type) {
+		case *AuthenticationError:
+			if _, ok := got.(*AuthenticationError); !ok {
+				t.Errorf("expected %q to be an authentication error, got %v", out, got)
+			}
+		default:
+			if errors.Cause(got) != want {
+				t.Errorf("expected %q to be caused by %v, got %v", out, want, got)
+			}
+		}
+	}
+
+	if got := gitAccessError("remote", "Authentication failed", context.Canceled); got != context.Canceled {
+		t.Errorf("expected a cancellation to be left as it is, got %v", got)
+	}
+}
+
+func TestGitCredentials(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	// The handler has its own copy of the expected header, as it runs
+	// concurrently with the test.
+	wantAuth := basicAuth("x-access-token", "tok")
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != wantAuth {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/repo.git/info/refs" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		fmt.Fprint(w, testRefAdvertisement(testRevA))
+	}))
+	defer srv.Close()
+
+	// The test server's certificate is self-signed.
+	defer os.Setenv("GIT_SSL_NO_VERIFY", os.Getenv("GIT_SSL_NO_VERIFY"))
+	os.Setenv("GIT_SSL_NO_VERIFY", "1")
+
+	dir, err := ioutil.TempDir("", "vcsauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	remote := srv.URL + "/repo.git"
+	u, _ := url.Parse(srv.URL)
+
+	ctx := context.Background()
+	if _, err := (execGitPlumbing{}).ListRefs(ctx, remote, filepath.Join(dir, "repo")); err == nil {
+		t.Fatal("expected listing refs without credentials to fail")
+	} else if _, ok := err.(*AuthenticationError); !ok {
+		t.Fatalf("expected an authentication error, got %v", err)
+	}
+
+	creds := &vcsCredentials{auth: map[string]string{u.Host: wantAuth}}
+	p := execGitPlumbing{env: vcsEnv{creds: creds}}
+	out, err := p.ListRefs(ctx, remote, filepath.Join(dir, "repo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(out), testRevA+"\tHEAD\n") {
+		t.Errorf("unexpected refs: %q", out)
+	}
+
+	if _, err := p.ListRefs(ctx, srv.URL+"/other.git", filepath.Join(dir, "other")); errors.Cause(err) != ErrRepositoryNotFound {
+		t.Errorf("expected a missing repository to be reported as such, got %v", err)
+	}
+
+	if _, err := cachedRemoteRefs(ctx, srv.Client(), creds, dir, remote); err != nil {
+		t.Errorf("expected the ref cache to send the credentials, got %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// VCS commands run in a hermetic environment: git and hg are kept from reading
+// the user's and the system's configuration files, so that rewrites, hooks,
+// aliases, extensions and the like cannot change what they fetch or how their
+// output looks. The environment is otherwise inherited, so variables such as
+// PATH, SSH_AUTH_SOCK and proxy settings still apply.
+//
+// A small allowlist of settings that only affect how servers are reached, such
+// as proxies and certificate authorities, is carried over from the user's
+// configuration. Authentication settings - credential helpers, URL rewrites
+// and the like - are carried over as well only if the SourceManager was
+// created with InheritVCSAuth set, in which case HOME is also left alone, so
+// that files like ~/.netrc and ~/.git-credentials are available. Credentials
+// given in VCSCredentials are added to git's environment either way.
+
+// vcsEnv is the environment in which a SourceMgr runs VCS commands.
+type vcsEnv struct {
+	// Whether the user's authentication configuration is inherited, as with
+	// InheritVCSAuth.
+	inherit bool
+	// The resolved VCSCredentials, if any were given.
+	creds *vcsCredentials
+}
+
+// vcsSetting is a configuration setting, as reported by the VCS.
+type vcsSetting struct {
+	key, value string
+}
+
+// A vcsTool knows how to make a single VCS program hermetic.
+type vcsTool struct {
+	// env holds the variables set for every invocation, and isolated those
+	// that are only set if authentication is not inherited.
+	env, isolated []string
+	// scrub lists the prefixes of inherited variables that are removed, as
+	// they would otherwise reintroduce configuration.
+	scrub []string
+	// read lists the user's configuration. It is only called once.
+	read func() []vcsSetting
+	// allow reports whether a setting is carried over in hermetic
+	// environments, and auth whether it is carried over only when
+	// authentication is inherited.
+	allow, auth func(key string) bool
+	// flags turns the carried-over settings into command line flags.
+	flags func([]vcsSetting) []string
+
+	once     sync.Once
+	settings []vcsSetting
+}
+
+var vcsTools = map[string]*vcsTool{
+	"git": {
+		env: []string{
+			"GIT_CONFIG_NOSYSTEM=1",
+			"GIT_CONFIG_GLOBAL=" + os.DevNull,
+			// Never prompt for credentials.
+			"GIT_ASKPASS=",
+			"GIT_TERMINAL_PROMPT=0",
+		},
+		// Older versions of git ignore GIT_CONFIG_GLOBAL, but git ignores a
+		// HOME without a configuration file in it.
+		isolated: []string{"HOME=" + os.DevNull, "XDG_CONFIG_HOME=" + os.DevNull},
+		scrub:    []string{"GIT_CONFIG", "GIT_ASKPASS=", "GIT_TERMINAL_PROMPT="},
+		read: func() []vcsSetting {
+			return parseVCSSettings(readVCSConfig("git", "config", "--list", "-z"), "\x00", "\n")
+		},
+		allow: gitSettingAllowed,
+		auth:  gitSettingIsAuth,
+		flags: func(settings []vcsSetting) []string {
+			var flags []string
+			for _, s := range settings {
+				flags = append(flags, "-c", s.key+"="+s.value)
+			}
+			return flags
+		},
+	},
+	"hg": {
+		// An empty HGRCPATH keeps hg from reading all but the repository's own
+		// configuration, and HGPLAIN keeps its output stable.
+		env:   []string{"HGRCPATH=", "HGPLAIN=1"},
+		scrub: []string{"HGRCPATH=", "HGPLAIN"},
+		read: func() []vcsSetting {
+			return parseVCSSettings(readVCSConfig("hg", "config"), "\n", "=")
+		},
+		allow: hgSettingAllowed,
+		auth:  hgSettingIsAuth,
+		flags: func(settings []vcsSetting) []string {
+			var flags []string
+			for _, s := range settings {
+				flags = append(flags, "--config", s.key+"="+s.value)
+			}
+			return flags
+		},
+	},
+}
+
+// hermeticCommand returns the arguments and environment with which to run the
+// named VCS program in a hermetic environment, as venv determines.
+func hermeticCommand(venv vcsEnv, name string, args []string) ([]string, []string) {
+	tool, has := vcsTools[name]
+	if !has {
+		return args, nil
+	}
+	args, env := tool.command(venv.inherit, args)
+	if venv.creds != nil && name == "git" {
+		// Later duplicates of inherited variables take precedence.
+		env = append(env, venv.creds.gitEnv()...)
+	}
+	return args, env
+}
+
+// command returns the arguments and environment for an invocation of the tool,
+// carrying over authentication settings if auth is true.
+func (tool *vcsTool) command(auth bool, args []string) ([]string, []string) {
+	var carried []vcsSetting
+	for _, s := range tool.userSettings() {
+		if tool.allow(s.key) || (auth && tool.auth(s.key)) {
+			carried = append(carried, s)
+		}
+	}
+
+	env := tool.environ(os.Environ())
+	if !auth {
+		env = append(env, tool.isolated...)
+	}
+	return append(tool.flags(carried), args...), env
+}
+
+// environ returns env without the variables the tool scrubs, and with those it
+// sets for every invocation.
+func (tool *vcsTool) environ(env []string) []string {
+	out := make([]string, 0, len(env)+len(tool.env)+len(tool.isolated))
+	for _, kv := range env {
+		scrubbed := false
+		for _, prefix := range tool.scrub {
+			if strings.HasPrefix(kv, prefix) {
+				scrubbed = true
+				break
+			}
+		}
+		if !scrubbed {
+			out = append(out, kv)
+		}
+	}
+	return append(out, tool.env...)
+}
+
+func (tool *vcsTool) userSettings() []vcsSetting {
+	tool.once.Do(func() {
+		tool.settings = tool.read()
+	})
+	return tool.settings
+}
+
+// readVCSConfig runs a VCS command that lists the user's configuration, in the
+// user's own environment. Nothing is returned if the command fails, as is the
+// case if the tool is not installed.
+func readVCSConfig(name string, args ...string) []byte {
+	c := exec.Command(name, args...)
+	// Run from somewhere there is certainly no repository, whose configuration
+	// would otherwise be included.
+	c.Dir = os.TempDir()
+	out, err := c.Output()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// parseVCSSettings splits listed configuration into settings, each separated
+// from the next by sep, and its key from its value by kvsep.
+func parseVCSSettings(out []byte, sep, kvsep string) []vcsSetting {
+	var settings []vcsSetting
+	for _, entry := range bytes.Split(out, []byte(sep)) {
+		parts := strings.SplitN(strings.TrimRight(string(entry), "\r"), kvsep, 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		settings = append(settings, vcsSetting{key: parts[0], value: parts[1]})
+	}
+	return settings
+}
+
+// splitVCSKey splits a setting key into its lowercased section and name, and
+// its optional subsection. The subsection of a key like
+// "url.https://example.com/.insteadOf" may itself contain dots.
+func splitVCSKey(key string) (section, subsection, name string) {
+	first, last := strings.Index(key, "."), strings.LastIndex(key, ".")
+	switch {
+	case first < 0:
+		return strings.ToLower(key), "", ""
+	case first == last:
+		return strings.ToLower(key[:first]), "", strings.ToLower(key[first+1:])
+	}
+	return strings.ToLower(key[:first]), key[first+1 : last], strings.ToLower(key[last+1:])
+}
+
+// Settings under git's http section, which may also be given for a single URL
+// as http.<url>.<name>.
+var (
+	gitHTTPAllowed = map[string]bool{
+		"proxy":         true,
+		"sslcainfo":     true,
+		"sslcapath":     true,
+		"sslverify":     true,
+		"sslbackend":    true,
+		"version":       true,
+		"postbuffer":    true,
+		"lowspeedlimit": true,
+		"lowspeedtime":  true,
+	}
+	gitHTTPAuth = map[string]bool{
+		"extraheader":                   true,
+		"cookiefile":                    true,
+		"sslcert":                       true,
+		"sslkey":                        true,
+		"sslcertpasswordprotected":      true,
+		"proxyauthmethod":               true,
+		"proxysslcert":                  true,
+		"proxysslkey":                   true,
+		"proxysslcertpasswordprotected": true,
+	}
+)
+
+func gitSettingAllowed(key string) bool {
+	section, _, name := splitVCSKey(key)
+	switch section {
+	case "http":
+		return gitHTTPAllowed[name]
+	case "protocol":
+		return name == "version"
+	}
+	return false
+}
+
+func gitSettingIsAuth(key string) bool {
+	section, _, name := splitVCSKey(key)
+	switch section {
+	case "credential":
+		return true
+	case "url":
+		return name == "insteadof"
+	case "core":
+		return name == "sshcommand"
+	case "http":
+		return gitHTTPAuth[name]
+	}
+	return false
+}
+
+func hgSettingAllowed(key string) bool {
+	section, _, name := splitVCSKey(key)
+	switch section {
+	case "http_proxy", "hostsecurity", "hostfingerprints":
+		return true
+	case "web":
+		return name == "cacerts"
+	}
+	return false
+}
+
+func hgSettingIsAuth(key string) bool {
+	section, _, name := splitVCSKey(key)
+	switch section {
+	case "auth":
+		return true
+	case "ui":
+		return name == "ssh"
+	}
+	return false
+}
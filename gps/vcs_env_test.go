@@ -0,0 +1,153 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGitSettingFilters(t *testing.T) {
+	cases := []struct {
+		key         string
+		allow, auth bool
+	}{
+		{key: "http.proxy", allow: true},
+		{key: "http.https://example.com/.sslCAInfo", allow: true},
+		{key: "protocol.version", allow: true},
+		{key: "http.extraheader", auth: true},
+		{key: "http.https://example.com/.extraHeader", auth: true},
+		{key: "credential.helper", auth: true},
+		{key: "credential.https://example.com.username", auth: true},
+		{key: "url.git@github.com:.insteadOf", auth: true},
+		{key: "core.sshCommand", auth: true},
+		{key: "url.git@github.com:.pushInsteadOf"},
+		{key: "alias.co"},
+		{key: "core.hooksPath"},
+		{key: "core.autocrlf"},
+		{key: "user.name"},
+	}
+
+	for _, c := range cases {
+		if got := gitSettingAllowed(c.key); got != c.allow {
+			t.Errorf("expected allowed(%q) to be %v", c.key, c.allow)
+		}
+		if got := gitSettingIsAuth(c.key); got != c.auth {
+			t.Errorf("expected auth(%q) to be %v", c.key, c.auth)
+		}
+	}
+}
+
+func TestParseVCSSettings(t *testing.T) {
+	got := parseVCSSettings([]byte("http.proxy\nhttp://proxy:8080\x00url.a=b.insteadof\nc=d\x00"), "\x00", "\n")
+	want := []vcsSetting{
+		{key: "http.proxy", value: "http://proxy:8080"},
+		{key: "url.a=b.insteadof", value: "c=d"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected git settings:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	got = parseVCSSettings([]byte("auth.x.prefix=example.com\r\nui.username=a=b\n\n"), "\n", "=")
+	want = []vcsSetting{
+		{key: "auth.x.prefix", value: "example.com"},
+		{key: "ui.username", value: "a=b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected hg settings:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
+
+func TestHermeticGitCommand(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	home, err := ioutil.TempDir("", "vcsenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	gitconfig := `[alias]
+	co = checkout
+[http]
+	proxy = http://proxy.example.com:8080
+[url "git@example.com:"]
+	insteadOf = https://example.com/
+[credential]
+	helper = store
+`
+	if err := ioutil.WriteFile(filepath.Join(home, ".gitconfig"), []byte(gitconfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Unsetenv("XDG_CONFIG_HOME")
+
+	// Use a separate instance of the tool, so that the user's settings are
+	// read from the test's configuration.
+	g := vcsTools["git"]
+	tool := &vcsTool{env: g.env, isolated: g.isolated, scrub: g.scrub, read: g.read, allow: g.allow, auth: g.auth, flags: g.flags}
+
+	list := func(auth bool) string {
+		args, env := tool.command(auth, []string{"config", "--list"})
+		c := exec.Command("git", args...)
+		c.Env = env
+		c.Dir = home
+		out, err := c.CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		return string(out)
+	}
+
+	out := list(false)
+	if want := "http.proxy=http://proxy.example.com:8080"; !strings.Contains(out, want) {
+		t.Errorf("expected hermetic configuration to contain %q, got:\n%s", want, out)
+	}
+	for _, unwanted := range []string{"alias.co", "insteadof", "credential.helper"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("expected hermetic configuration not to contain %q, got:\n%s", unwanted, out)
+		}
+	}
+
+	out = list(true)
+	for _, want := range []string{"http.proxy=", "url.git@example.com:.insteadof=https://example.com/", "credential.helper=store"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected configuration inheriting auth to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "alias.co") {
+		t.Errorf("expected configuration inheriting auth not to contain aliases, got:\n%s", out)
+	}
+}
+
+func TestInheritVCSAuth(t *testing.T) {
+	cpath, err := ioutil.TempDir("", "smcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cpath)
+
+	for _, inherit := range []bool{false, true} {
+		sm, err := NewSourceManager(SourceManagerConfig{Cachedir: cpath, InheritVCSAuth: inherit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sm.Release()
+		if got := sm.srcCoord.settings.vcs.inherit; got != inherit {
+			t.Errorf("expected sources to inherit auth: %v, got %v", inherit, got)
+		}
+		if got := sm.srcCoord.deducer.(*deductionCoordinator).settings.vcs.inherit; got != inherit {
+			t.Errorf("expected deduction to inherit auth: %v, got %v", inherit, got)
+		}
+	}
+}
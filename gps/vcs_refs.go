@@ -0,0 +1,246 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Listing the versions of a git source means fetching the entire ref
+// advertisement of its upstream, which for large repositories runs to
+// thousands of refs. When the SourceManager is created with
+// CacheRefAdvertisements set, the last advertisement seen from each http(s)
+// upstream is kept on disk, along with the validators the server sent with it.
+// Listing again then asks the server to send the advertisement only if it has
+// changed since; if it has not, the cached refs are used, and nothing but the
+// response headers crosses the network.
+//
+// The conditional request is made directly against the smart HTTP endpoint
+// that git itself uses. Servers that do not speak the smart protocol, do not
+// send validators, or refuse the request - as they may for private
+// repositories, whose credentials only git knows how to find - are listed
+// with git ls-remote, as usual.
+
+// errRefsUnsupported indicates that a server cannot be asked for its ref
+// advertisement over smart HTTP.
+var errRefsUnsupported = errors.New("server does not support smart HTTP ref advertisement")
+
+// refAdvertisement is a ref advertisement received from a server, as cached
+// on disk.
+type refAdvertisement struct {
+	// The validators the server sent with the advertisement.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// The advertised refs, in the format of git ls-remote's output.
+	Refs string `json:"refs"`
+}
+
+// refAdvertisementPath returns the path at which the ref advertisement of the
+// git remote is cached in dir.
+func refAdvertisementPath(dir, remote string) string {
+	return filepath.Join(dir, sanitizer.Replace(remote)+".json")
+}
+
+func readRefAdvertisement(path string) (refAdvertisement, bool) {
+	var adv refAdvertisement
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return adv, false
+	}
+	if err = json.Unmarshal(b, &adv); err != nil || (adv.ETag == "" && adv.LastModified == "") {
+		return refAdvertisement{}, false
+	}
+	return adv, true
+}
+
+func writeRefAdvertisement(path string, adv refAdvertisement) error {
+	b, err := json.Marshal(adv)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that concurrent readers never see a
+	// partial advertisement.
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err = ioutil.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// cachedRemoteRefs lists the refs of the git remote in the format of git
+// ls-remote's output, revalidating the advertisement cached in dir, if any,
+// with the server, authenticating with creds if they cover its host. The
+// cache is updated with whatever the server sends.
+//
+// If the remote is not served over http(s), or its server cannot be asked for
+// its refs this way, errRefsUnsupported is returned.
+func cachedRemoteRefs(ctx context.Context, client *http.Client, creds *vcsCredentials, dir, remote string) ([]byte, error) {
+	u, err := url.Parse(remote)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, errRefsUnsupported
+	}
+
+	path := refAdvertisementPath(dir, remote)
+	cached, hasCached := readRefAdvertisement(path)
+
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/info/refs"
+	u.RawQuery = "service=git-upload-pack"
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, errRefsUnsupported
+	}
+	req = req.WithContext(ctx)
+	if auth := creds.authHeader(u.Host); auth != "" && u.Scheme == "https" {
+		req.Header.Set("Authorization", auth)
+	}
+	if hasCached {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errRefsUnsupported
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && hasCached:
+		return []byte(cached.Refs), nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, errRefsUnsupported
+	case resp.Header.Get("Content-Type") != "application/x-git-upload-pack-advertisement":
+		// A dumb server, which just serves the files in the repository.
+		return nil, errRefsUnsupported
+	}
+
+	refs, err := parseRefAdvertisement(resp.Body)
+	if err != nil {
+		return nil, errRefsUnsupported
+	}
+
+	adv := refAdvertisement{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Refs:         string(refs),
+	}
+	if adv.ETag == "" && adv.LastModified == "" {
+		// Without validators, there is no way to ask whether the
+		// advertisement has changed, so there is no point in keeping it.
+		os.Remove(path)
+	} else if err := os.MkdirAll(dir, 0777); err == nil {
+		// Failing to cache the advertisement only costs a full listing the
+		// next time around.
+		writeRefAdvertisement(path, adv)
+	}
+	return refs, nil
+}
+
+// parseRefAdvertisement reads a smart HTTP ref advertisement for the
+// git-upload-pack service, as sent in response to a request for info/refs,
+// and returns the refs in it in the format of git ls-remote's output.
+func parseRefAdvertisement(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var buf bytes.Buffer
+
+	first, sawService := true, false
+	for {
+		pkt, flush, err := readPktLine(br)
+		if err == io.EOF && !first {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if flush {
+			if !sawService {
+				return nil, errors.New("ref advertisement ended before any refs were seen")
+			}
+			continue
+		}
+
+		line := strings.TrimSuffix(string(pkt), "\n")
+		if first {
+			first = false
+			if line != "# service=git-upload-pack" {
+				return nil, errors.Errorf("unexpected first line in ref advertisement: %q", line)
+			}
+			sawService = true
+			continue
+		}
+
+		// The first ref is followed by the server's capabilities.
+		if i := strings.IndexByte(line, 0); i != -1 {
+			line = line[:i]
+		}
+		if strings.HasPrefix(line, "version ") {
+			return nil, errors.Errorf("unsupported ref advertisement %q", line)
+		}
+		if len(line) < 42 || line[40] != ' ' {
+			return nil, errors.Errorf("malformed ref in advertisement: %q", line)
+		}
+		// An empty repository advertises its capabilities on a placeholder.
+		if line[41:] == "capabilities^{}" {
+			continue
+		}
+		buf.WriteString(line[:40])
+		buf.WriteByte('\t')
+		buf.WriteString(line[41:])
+		buf.WriteByte('\n')
+	}
+}
+
+// readPktLine reads a single git pkt-line from r, reporting whether it was a
+// flush packet.
+func readPktLine(r *bufio.Reader) ([]byte, bool, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, false, err
+	}
+	n, err := strconv.ParseUint(string(hdr[:]), 16, 16)
+	if err != nil {
+		return nil, false, errors.Errorf("invalid pkt-line length %q", hdr[:])
+	}
+	switch {
+	case n == 0:
+		return nil, true, nil
+	case n < 4:
+		return nil, false, errors.Errorf("invalid pkt-line length %q", hdr[:])
+	}
+
+	pkt := make([]byte, n-4)
+	if _, err := io.ReadFull(r, pkt); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, false, err
+	}
+	return pkt, false, nil
+}
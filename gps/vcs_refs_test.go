@@ -0,0 +1,146 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+const (
+	testRevA = "30605f6ac35fcb075ad0bfa9296f90a7d891523e"
+	testRevB = "4a54adf81c75375d26d376459c00d5ff9b703e5e"
+)
+
+func testRefAdvertisement(headRev string) string {
+	return pktLine("# service=git-upload-pack\n") + "0000" +
+		pktLine(headRev+" HEAD\x00multi_ack symref=HEAD:refs/heads/master\n") +
+		pktLine(headRev+" refs/heads/master\n") +
+		pktLine(testRevB+" refs/tags/v1.0.0\n") +
+		pktLine(testRevA+" refs/tags/v1.0.0^{}\n") +
+		"0000"
+}
+
+func TestParseRefAdvertisement(t *testing.T) {
+	got, err := parseRefAdvertisement(strings.NewReader(testRefAdvertisement(testRevA)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testRevA + "\tHEAD\n" +
+		testRevA + "\trefs/heads/master\n" +
+		testRevB + "\trefs/tags/v1.0.0\n" +
+		testRevA + "\trefs/tags/v1.0.0^{}\n"
+	if string(got) != want {
+		t.Errorf("unexpected refs:\n\t(GOT): %q\n\t(WNT): %q", got, want)
+	}
+
+	empty := pktLine("# service=git-upload-pack\n") + "0000" +
+		pktLine(strings.Repeat("0", 40)+" capabilities^{}\x00multi_ack\n") + "0000"
+	got, err = parseRefAdvertisement(strings.NewReader(empty))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no refs from an empty repository, got %q", got)
+	}
+
+	for _, bad := range []string{
+		"",
+		"0000",
+		pktLine("# service=git-receive-pack\n") + "0000",
+		pktLine("# service=git-upload-pack\n") + "0000" + pktLine("version 2\n"),
+		pktLine("# service=git-upload-pack\n") + "0000" + pktLine("nonsense\n"),
+		pktLine("# service=git-upload-pack\n") + "0000" + "00ff" + testRevA,
+	} {
+		if _, err := parseRefAdvertisement(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestCachedRemoteRefs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "refcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	headRev, etag := testRevA, `"1"`
+	var full, unchanged int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repo.git/info/refs" || r.URL.Query().Get("service") != "git-upload-pack" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			unchanged++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, testRefAdvertisement(headRev))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	remote := srv.URL + "/repo.git"
+	list := func() string {
+		out, err := cachedRemoteRefs(ctx, srv.Client(), nil, dir, remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	first := list()
+	if !strings.HasPrefix(first, testRevA+"\tHEAD\n") {
+		t.Fatalf("unexpected refs: %q", first)
+	}
+	if second := list(); second != first || full != 1 || unchanged != 1 {
+		t.Errorf("expected the cached refs to be revalidated (full %d, unchanged %d), got %q", full, unchanged, second)
+	}
+
+	headRev, etag = testRevB, `"2"`
+	if third := list(); !strings.HasPrefix(third, testRevB+"\tHEAD\n") || full != 2 {
+		t.Errorf("expected changed refs to be listed in full (full %d), got %q", full, third)
+	}
+
+	if _, err := cachedRemoteRefs(ctx, srv.Client(), nil, dir, srv.URL+"/other.git"); err != errRefsUnsupported {
+		t.Errorf("expected a failed request to be unsupported, got %v", err)
+	}
+	if _, err := cachedRemoteRefs(ctx, srv.Client(), nil, dir, "ssh://git@example.com/repo.git"); err != errRefsUnsupported {
+		t.Errorf("expected an ssh remote to be unsupported, got %v", err)
+	}
+}
+
+func TestCachedRemoteRefsDumbServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "refcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "%s\trefs/heads/master\n", testRevA)
+	}))
+	defer srv.Close()
+
+	if _, err := cachedRemoteRefs(context.Background(), srv.Client(), nil, dir, srv.URL+"/repo.git"); err != errRefsUnsupported {
+		t.Errorf("expected a dumb server to be unsupported, got %v", err)
+	}
+}
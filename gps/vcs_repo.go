@@ -38,6 +38,10 @@ type ensureCleaner interface {
 
 type gitRepo struct {
 	*vcs.GitRepo
+	// The environment in which VCS commands are run, and the GitPlumbing with
+	// which the repository is fetched.
+	env      vcsEnv
+	plumbing GitPlumbing
 }
 
 func newVcsRemoteErrorOr(err error, args []string, out, msg string) error {
@@ -55,47 +59,15 @@ func newVcsLocalErrorOr(err error, args []string, out, msg string) error {
 }
 
 func (r *gitRepo) get(ctx context.Context) error {
-	cmd := commandContext(
-		ctx,
-		"git",
-		"clone",
-		"--recursive",
-		"-v",
-		"--progress",
-		r.Remote(),
-		r.LocalPath(),
-	)
-	// Ensure no prompting for PWs
-	cmd.SetEnv(append([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ()...))
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
-			"unable to get repository")
-	}
-
-	return nil
+	return r.plumbing.FetchRevision(ctx, r.Remote(), r.LocalPath(), "")
 }
 
 func (r *gitRepo) fetch(ctx context.Context) error {
-	cmd := commandContext(
-		ctx,
-		"git",
-		"fetch",
-		"--tags",
-		"--prune",
-		r.RemoteLocation,
-	)
-	cmd.SetDir(r.LocalPath())
-	// Ensure no prompting for PWs
-	cmd.SetEnv(append([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ()...))
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
-			"unable to update repository")
-	}
-	return nil
+	return r.plumbing.FetchRevision(ctx, r.Remote(), r.LocalPath(), "")
 }
 
 func (r *gitRepo) updateVersion(ctx context.Context, v string) error {
-	cmd := commandContext(ctx, "git", "checkout", v)
+	cmd := commandContext(ctx, r.env, "git", "checkout", v)
 	cmd.SetDir(r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsLocalErrorOr(err, cmd.Args(), string(out),
@@ -112,6 +84,7 @@ func (r *gitRepo) defendAgainstSubmodules(ctx context.Context) error {
 	{
 		cmd := commandContext(
 			ctx,
+			r.env,
 			"git",
 			"submodule",
 			"update",
@@ -119,8 +92,6 @@ func (r *gitRepo) defendAgainstSubmodules(ctx context.Context) error {
 			"--recursive",
 		)
 		cmd.SetDir(r.LocalPath())
-		// Ensure no prompting for PWs
-		cmd.SetEnv(append([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ()...))
 		if out, err := cmd.CombinedOutput(); err != nil {
 			return newVcsLocalErrorOr(err, cmd.Args(), string(out),
 				"unexpected error while defensively updating submodules")
@@ -130,7 +101,7 @@ func (r *gitRepo) defendAgainstSubmodules(ctx context.Context) error {
 	// Now, do a special extra-aggressive clean in case changing versions caused
 	// one or more submodules to go away.
 	{
-		cmd := commandContext(ctx, "git", "clean", "-x", "-d", "-f", "-f")
+		cmd := commandContext(ctx, r.env, "git", "clean", "-x", "-d", "-f", "-f")
 		cmd.SetDir(r.LocalPath())
 		if out, err := cmd.CombinedOutput(); err != nil {
 			return newVcsLocalErrorOr(err, cmd.Args(), string(out),
@@ -142,6 +113,7 @@ func (r *gitRepo) defendAgainstSubmodules(ctx context.Context) error {
 	{
 		cmd := commandContext(
 			ctx,
+			r.env,
 			"git",
 			"submodule",
 			"foreach",
@@ -162,6 +134,7 @@ func (r *gitRepo) defendAgainstSubmodules(ctx context.Context) error {
 func (r *gitRepo) ensureClean(ctx context.Context) error {
 	cmd := commandContext(
 		ctx,
+		r.env,
 		"git",
 		"status",
 		"--porcelain",
@@ -186,6 +159,7 @@ func (r *gitRepo) ensureClean(ctx context.Context) error {
 	// might as well just throw the kitchen sink at it.
 	cmd = commandContext(
 		ctx,
+		r.env,
 		"git",
 		"reset",
 		"--hard",
@@ -206,6 +180,7 @@ func (r *gitRepo) ensureClean(ctx context.Context) error {
 	// Check status one last time. If it's still not clean, give up.
 	cmd = commandContext(
 		ctx,
+		r.env,
 		"git",
 		"status",
 		"--porcelain",
@@ -226,6 +201,7 @@ func (r *gitRepo) ensureClean(ctx context.Context) error {
 
 type bzrRepo struct {
 	*vcs.BzrRepo
+	env vcsEnv
 }
 
 func (r *bzrRepo) get(ctx context.Context) error {
@@ -237,7 +213,7 @@ func (r *bzrRepo) get(ctx context.Context) error {
 		}
 	}
 
-	cmd := commandContext(ctx, "bzr", "branch", r.Remote(), r.LocalPath())
+	cmd := commandContext(ctx, r.env, "bzr", "branch", r.Remote(), r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
 			"unable to get repository")
@@ -247,7 +223,7 @@ func (r *bzrRepo) get(ctx context.Context) error {
 }
 
 func (r *bzrRepo) fetch(ctx context.Context) error {
-	cmd := commandContext(ctx, "bzr", "pull")
+	cmd := commandContext(ctx, r.env, "bzr", "pull")
 	cmd.SetDir(r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
@@ -257,7 +233,7 @@ func (r *bzrRepo) fetch(ctx context.Context) error {
 }
 
 func (r *bzrRepo) updateVersion(ctx context.Context, version string) error {
-	cmd := commandContext(ctx, "bzr", "update", "-r", version)
+	cmd := commandContext(ctx, r.env, "bzr", "update", "-r", version)
 	cmd.SetDir(r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsLocalErrorOr(err, cmd.Args(), string(out),
@@ -268,10 +244,11 @@ func (r *bzrRepo) updateVersion(ctx context.Context, version string) error {
 
 type hgRepo struct {
 	*vcs.HgRepo
+	env vcsEnv
 }
 
 func (r *hgRepo) get(ctx context.Context) error {
-	cmd := commandContext(ctx, "hg", "clone", r.Remote(), r.LocalPath())
+	cmd := commandContext(ctx, r.env, "hg", "clone", r.Remote(), r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
 			"unable to get repository")
@@ -281,7 +258,7 @@ func (r *hgRepo) get(ctx context.Context) error {
 }
 
 func (r *hgRepo) fetch(ctx context.Context) error {
-	cmd := commandContext(ctx, "hg", "pull")
+	cmd := commandContext(ctx, r.env, "hg", "pull")
 	cmd.SetDir(r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
@@ -291,7 +268,7 @@ func (r *hgRepo) fetch(ctx context.Context) error {
 }
 
 func (r *hgRepo) updateVersion(ctx context.Context, version string) error {
-	cmd := commandContext(ctx, "hg", "update", version)
+	cmd := commandContext(ctx, r.env, "hg", "update", version)
 	cmd.SetDir(r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
@@ -303,17 +280,42 @@ func (r *hgRepo) updateVersion(ctx context.Context, version string) error {
 
 type svnRepo struct {
 	*vcs.SvnRepo
+	env vcsEnv
 }
 
-func (r *svnRepo) get(ctx context.Context) error {
-	remote := r.Remote()
+// svnRemoteURL returns remote as a URL that svn accepts, turning a local path
+// into a file:// URL.
+func svnRemoteURL(remote string) string {
 	if strings.HasPrefix(remote, "/") {
-		remote = "file://" + remote
+		return "file://" + remote
 	} else if runtime.GOOS == "windows" && filepath.VolumeName(remote) != "" {
-		remote = "file:///" + remote
+		return "file:///" + remote
 	}
+	return remote
+}
 
-	cmd := commandContext(ctx, "svn", "checkout", remote, r.LocalPath())
+// splitSvnRevision splits a peg revision, as used by svnSource, into the path
+// of the line of development in the repository and the revision number. ok is
+// false if r is a plain revision number.
+func splitSvnRevision(r string) (path, rev string, ok bool) {
+	i := strings.LastIndex(r, "@")
+	if i < 0 {
+		return "", r, false
+	}
+	return r[:i], r[i+1:], true
+}
+
+// svnPegURL returns the URL of path within the repository at remote, as of
+// revision rev.
+func svnPegURL(remote, path, rev string) string {
+	if path != "" {
+		remote = strings.TrimRight(remote, "/") + "/" + path
+	}
+	return remote + "@" + rev
+}
+
+func (r *svnRepo) get(ctx context.Context) error {
+	cmd := commandContext(ctx, r.env, "svn", "checkout", svnRemoteURL(r.Remote()), r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
 			"unable to get repository")
@@ -323,7 +325,7 @@ func (r *svnRepo) get(ctx context.Context) error {
 }
 
 func (r *svnRepo) fetch(ctx context.Context) error {
-	cmd := commandContext(ctx, "svn", "update")
+	cmd := commandContext(ctx, r.env, "svn", "update")
 	cmd.SetDir(r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
@@ -334,7 +336,16 @@ func (r *svnRepo) fetch(ctx context.Context) error {
 }
 
 func (r *svnRepo) updateVersion(ctx context.Context, version string) error {
-	cmd := commandContext(ctx, "svn", "update", "-r", version)
+	// The working copy may have been checked out empty, so the depth is set
+	// to check out everything beneath it.
+	args := []string{"update", "--set-depth", "infinity", "-r", version}
+	if path, rev, ok := splitSvnRevision(version); ok {
+		// A peg revision names a line of development as well as a revision,
+		// so the working copy is switched over to it.
+		args = []string{"switch", "--ignore-ancestry", "--set-depth", "infinity", svnPegURL(svnRemoteURL(r.Remote()), path, rev)}
+	}
+
+	cmd := commandContext(ctx, r.env, "svn", args...)
 	cmd.SetDir(r.LocalPath())
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return newVcsRemoteErrorOr(err, cmd.Args(), string(out),
@@ -358,7 +369,7 @@ func (r *svnRepo) CommitInfo(id string) (*vcs.CommitInfo, error) {
 			Commit commit `xml:"entry>commit"`
 		}
 
-		cmd := commandContext(ctx, "svn", "info", "-r", id, "--xml")
+		cmd := commandContext(ctx, r.env, "svn", "info", "-r", id, "--xml")
 		cmd.SetDir(r.LocalPath())
 		out, err := cmd.CombinedOutput()
 		if err != nil {
@@ -378,7 +389,7 @@ func (r *svnRepo) CommitInfo(id string) (*vcs.CommitInfo, error) {
 		}
 	}
 
-	cmd := commandContext(ctx, "svn", "log", "-r", id, "--xml")
+	cmd := commandContext(ctx, r.env, "svn", "log", "-r", id, "--xml")
 	cmd.SetDir(r.LocalPath())
 	out, err := cmd.CombinedOutput()
 	if err != nil {
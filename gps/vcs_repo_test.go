@@ -71,7 +71,7 @@ func testSvnRepo(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	repo := &svnRepo{rep}
+	repo := &svnRepo{SvnRepo: rep}
 
 	// Do an initial checkout.
 	err = repo.get(ctx)
@@ -166,7 +166,7 @@ func testHgRepo(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	repo := &hgRepo{rep}
+	repo := &hgRepo{HgRepo: rep}
 
 	// Do an initial clone.
 	err = repo.get(ctx)
@@ -226,7 +226,7 @@ func testGitRepo(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	repo := &gitRepo{rep}
+	repo := &gitRepo{GitRepo: rep, plumbing: execGitPlumbing{}}
 
 	// Do an initial clone.
 	err = repo.get(ctx)
@@ -303,7 +303,7 @@ func testBzrRepo(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	repo := &bzrRepo{rep}
+	repo := &bzrRepo{BzrRepo: rep}
 
 	// Do an initial clone.
 	err = repo.get(ctx)
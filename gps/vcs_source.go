@@ -7,11 +7,13 @@ package gps
 import (
 	"bytes"
 	"context"
-	"fmt"
+	"encoding/xml"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/golang/dep/gps/pkgtree"
@@ -20,7 +22,8 @@ import (
 )
 
 type baseVCSSource struct {
-	repo ctxRepo
+	repo     ctxRepo
+	settings sourceSettings
 }
 
 func (bs *baseVCSSource) sourceType() string {
@@ -160,50 +163,174 @@ type gitSource struct {
 }
 
 func (s *gitSource) exportRevisionTo(ctx context.Context, rev Revision, to string) error {
-	r := s.repo
-
 	if err := os.MkdirAll(to, 0777); err != nil {
 		return err
 	}
 
-	// Back up original index
-	idx, bak := filepath.Join(r.LocalPath(), ".git", "index"), filepath.Join(r.LocalPath(), ".git", "origindex")
-	err := fs.RenameWithFallback(idx, bak)
+	return s.settings.gitPlumbing().ExportTree(ctx, s.repo.LocalPath(), rev, to)
+}
+
+func (s *gitSource) diffRevisions(ctx context.Context, from, to Revision, stats bool) ([]FileChange, error) {
+	diff := func(format string) ([]byte, error) {
+		cmd := commandContext(ctx, s.settings.vcs, "git", "diff", "--no-renames", "--no-ext-diff", format, "-z", from.String(), to.String(), "--")
+		cmd.SetDir(s.repo.LocalPath())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, errors.Wrap(err, string(out))
+		}
+		return out, nil
+	}
+
+	out, err := diff("--name-status")
 	if err != nil {
-		return err
+		return nil, err
+	}
+	changes, err := parseGitNameStatus(out)
+	if err != nil {
+		return nil, err
+	}
+
+	if stats && len(changes) > 0 {
+		if out, err = diff("--numstat"); err != nil {
+			return nil, err
+		}
+		if err = applyGitNumstat(changes, out); err != nil {
+			return nil, err
+		}
 	}
 
-	// could have an err here...but it's hard to imagine how?
-	defer fs.RenameWithFallback(bak, idx)
+	sortFileChanges(changes)
+	return changes, nil
+}
 
-	{
-		cmd := commandContext(ctx, "git", "read-tree", rev.String())
-		cmd.SetDir(r.LocalPath())
-		if out, err := cmd.CombinedOutput(); err != nil {
-			return errors.Wrap(err, string(out))
+// deprecations reads deprecation notices from the messages of the annotated
+// tags in the local repository. A tag is deprecated if its message contains a
+// paragraph beginning with "Deprecated:".
+func (s *gitSource) deprecations(ctx context.Context) ([]Deprecation, error) {
+	cmd := commandContext(ctx, s.settings.vcs, "git", "for-each-ref", "--format=%(objecttype)%00%(refname)%00%(contents)%00", "refs/tags")
+	cmd.SetDir(s.repo.LocalPath())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrap(err, string(out))
+	}
+
+	return parseGitTagDeprecations(out)
+}
+
+// parseGitTagDeprecations parses the output of the for-each-ref invocation in
+// gitSource.deprecations.
+func parseGitTagDeprecations(out []byte) ([]Deprecation, error) {
+	fields := strings.Split(strings.TrimSpace(string(out)), "\x00")
+	if len(fields) == 1 && fields[0] == "" {
+		return nil, nil
+	}
+	// Each record is terminated by a NUL and a newline, leaving an empty
+	// field at the end.
+	fields = fields[:len(fields)-1]
+	if len(fields)%3 != 0 {
+		return nil, errors.Errorf("unexpected git for-each-ref output: %q", out)
+	}
+
+	var ds []Deprecation
+	for i := 0; i < len(fields); i += 3 {
+		// Lightweight tags have no message of their own; their contents are
+		// those of the tagged commit.
+		if strings.TrimSpace(fields[i]) != "tag" {
+			continue
+		}
+		if reason, has := parseDeprecationMessage(fields[i+2]); has {
+			ds = append(ds, Deprecation{
+				Version: NewVersion(strings.TrimPrefix(fields[i+1], "refs/tags/")),
+				Reason:  reason,
+			})
 		}
 	}
+	return ds, nil
+}
 
-	// Ensure we have exactly one trailing slash
-	to = strings.TrimSuffix(to, string(os.PathSeparator)) + string(os.PathSeparator)
-	// Checkout from our temporary index to the desired target location on
-	// disk; now it's git's job to make it fast.
-	//
-	// Sadly, this approach *does* also write out vendor dirs. There doesn't
-	// appear to be a way to make checkout-index respect sparse checkout
-	// rules (-a supersedes it). The alternative is using plain checkout,
-	// though we have a bunch of housekeeping to do to set up, then tear
-	// down, the sparse checkout controls, as well as restore the original
-	// index and HEAD.
-	{
-		cmd := commandContext(ctx, "git", "checkout-index", "-a", "--prefix="+to)
+// versionsAsOf filters the provided versions down to those that existed at
+// time t, according to the local repository. Tags are kept if they were
+// created no later than t, and branches are moved back to the newest revision
+// committed no later than t, or dropped if there is no such revision.
+func (s *gitSource) versionsAsOf(ctx context.Context, pvl []PairedVersion, t time.Time) ([]PairedVersion, error) {
+	r := s.repo
+
+	cmd := commandContext(ctx, s.settings.vcs, "git", "for-each-ref", "--format=%(refname) %(creatordate:raw)", "refs/tags")
+	cmd.SetDir(r.LocalPath())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrap(err, string(out))
+	}
+	created, err := parseGitRefTimes(out)
+	if err != nil {
+		return nil, err
+	}
+
+	// The history of all the branches is read at once, rather than with a
+	// rev-list per branch.
+	args := []string{"log", "--format=%H %ct %P"}
+	for _, pv := range pvl {
+		if pv.Unpair().Type() == IsBranch {
+			args = append(args, string(pv.Revision()))
+		}
+	}
+	var graph map[string]gitCommit
+	if len(args) > 2 {
+		cmd := commandContext(ctx, s.settings.vcs, "git", args...)
 		cmd.SetDir(r.LocalPath())
-		if out, err := cmd.CombinedOutput(); err != nil {
-			return errors.Wrap(err, string(out))
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, errors.Wrap(err, string(out))
+		}
+		if graph, err = parseGitCommitGraph(out); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	vl := make([]PairedVersion, 0, len(pvl))
+	for _, pv := range pvl {
+		uv := pv.Unpair()
+		if uv.Type() != IsBranch {
+			ct, has := created["refs/tags/"+uv.String()]
+			if !has {
+				return nil, errors.Errorf("tag %s is not in the local repository", uv)
+			}
+			if !ct.After(t) {
+				vl = append(vl, pv)
+			}
+			continue
+		}
+
+		if rev := newestCommitBefore(graph, string(pv.Revision()), t); rev != "" {
+			vl = append(vl, uv.Pair(Revision(rev)))
+		}
+	}
+	return vl, nil
+}
+
+// revisionTimes reads the commit times of those of the revisions that are in
+// the local repository.
+func (s *gitSource) revisionTimes(ctx context.Context, revs []Revision) (map[Revision]time.Time, error) {
+	args := []string{"log", "--no-walk", "--ignore-missing", "--format=%H %ct"}
+	for _, r := range revs {
+		args = append(args, string(r))
+	}
+	cmd := commandContext(ctx, s.settings.vcs, "git", args...)
+	cmd.SetDir(s.repo.LocalPath())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrap(err, string(out))
+	}
+	committed, err := parseGitRefTimes(out)
+	if err != nil {
+		return nil, err
+	}
+
+	times := make(map[Revision]time.Time, len(committed))
+	for rev, t := range committed {
+		times[Revision(rev)] = t
+	}
+	return times, nil
 }
 
 func (s *gitSource) isValidHash(hash []byte) bool {
@@ -214,30 +341,36 @@ func (*gitSource) existsCallsListVersions() bool {
 	return true
 }
 
-func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, err error) {
+// listRemoteRefs lists the refs of the source's upstream in the format of git
+// ls-remote's output, from the cached ref advertisement if it is still current.
+func (s *gitSource) listRemoteRefs(ctx context.Context) ([]byte, error) {
 	r := s.repo
 
-	cmd := commandContext(ctx, "git", "ls-remote", r.Remote())
-	// We want to invoke from a place where it's not possible for there to be a
-	// .git file instead of a .git directory, as git ls-remote will choke on the
-	// former and erroneously quit. However, we can't be sure that the repo
-	// exists on disk yet at this point; if it doesn't, then instead use the
-	// parent of the local path, as that's still likely a good bet.
-	if r.CheckLocal() {
-		cmd.SetDir(r.LocalPath())
-	} else {
-		cmd.SetDir(filepath.Dir(r.LocalPath()))
+	if s.settings.offline {
+		return s.listLocalRefs(ctx)
 	}
-	// Ensure no prompting for PWs
-	cmd.SetEnv(append([]string{"GIT_ASKPASS=", "GIT_TERMINAL_PROMPT=0"}, os.Environ()...))
-	out, err := cmd.CombinedOutput()
+	if dir := s.settings.refsDir; dir != "" {
+		out, err := cachedRemoteRefs(ctx, http.DefaultClient, s.settings.vcs.creds, dir, r.Remote())
+		if err != errRefsUnsupported {
+			return out, err
+		}
+	}
+
+	return s.settings.gitPlumbing().ListRefs(ctx, r.Remote(), r.LocalPath())
+}
+
+func (s *gitSource) listVersions(ctx context.Context) (vlist []PairedVersion, err error) {
+	out, err := s.listRemoteRefs(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, string(out))
+		return nil, err
 	}
 
 	all := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
 	if len(all) == 1 && len(all[0]) == 0 {
-		return nil, fmt.Errorf("no data returned from ls-remote")
+		// An empty repository advertises no refs at all. That it exists is
+		// still worth knowing, so the gateway reports it as empty, rather than
+		// this failing as though it could not be listed.
+		return nil, nil
 	}
 
 	// Pull out the HEAD rev (it's always first) so we know what branches to
@@ -470,7 +603,7 @@ func (s *bzrSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
 	r := s.repo
 
 	// Now, list all the tags
-	tagsCmd := commandContext(ctx, "bzr", "tags", "--show-ids", "-v")
+	tagsCmd := commandContext(ctx, s.settings.vcs, "bzr", "tags", "--show-ids", "-v")
 	tagsCmd.SetDir(r.LocalPath())
 	out, err := tagsCmd.CombinedOutput()
 	if err != nil {
@@ -479,7 +612,7 @@ func (s *bzrSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
 
 	all := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
 
-	viCmd := commandContext(ctx, "bzr", "version-info", "--custom", "--template={revision_id}", "--revision=branch:.")
+	viCmd := commandContext(ctx, s.settings.vcs, "bzr", "version-info", "--custom", "--template={revision_id}", "--revision=branch:.")
 	viCmd.SetDir(r.LocalPath())
 	branchrev, err := viCmd.CombinedOutput()
 	if err != nil {
@@ -535,17 +668,39 @@ func (s *hgSource) exportRevisionTo(ctx context.Context, rev Revision, to string
 	return os.RemoveAll(filepath.Join(to, ".hg"))
 }
 
+func (s *hgSource) diffRevisions(ctx context.Context, from, to Revision, stats bool) ([]FileChange, error) {
+	cmd := s.hgCmd(ctx, "status", "--rev", from.String(), "--rev", to.String())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrap(err, string(out))
+	}
+	changes, err := parseHgStatus(out)
+	if err != nil {
+		return nil, err
+	}
+
+	if stats && len(changes) > 0 {
+		cmd = s.hgCmd(ctx, "diff", "--git", "--rev", from.String(), "--rev", to.String())
+		if out, err = cmd.CombinedOutput(); err != nil {
+			return nil, errors.Wrap(err, string(out))
+		}
+		if err = applyGitStyleDiffStats(changes, out); err != nil {
+			return nil, err
+		}
+	}
+
+	sortFileChanges(changes)
+	return changes, nil
+}
+
 func (s *hgSource) listVersionsRequiresLocal() bool {
 	return true
 }
 
 func (s *hgSource) hgCmd(ctx context.Context, args ...string) cmd {
 	r := s.repo
-	cmd := commandContext(ctx, "hg", args...)
+	cmd := commandContext(ctx, s.settings.vcs, "hg", args...)
 	cmd.SetDir(r.LocalPath())
-	// Let's make sure extensions don't interfere with our expectations
-	// regarding the output of commands.
-	cmd.Cmd.Env = append(cmd.Cmd.Env, "HGRCPATH=")
 	return cmd
 }
 
@@ -653,3 +808,169 @@ func (s *hgSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
 
 	return vlist, nil
 }
+
+// svnCommit is the commit element of svn list and svn info XML output.
+type svnCommit struct {
+	Revision string `xml:"revision,attr"`
+}
+
+// svnSource is a generic svn repository implementation. If the repository has
+// the conventional layout, with a trunk directory at its root and branches and
+// tags directories alongside, then trunk is its default branch, and each
+// directory in branches and tags one of its branches or versions. Otherwise,
+// the repository as a whole is its default branch.
+//
+// An svn revision number identifies a state of the whole repository, rather
+// than of a line of development within it, so in the conventional layout
+// revisions are peg revisions: the path of the line of development, followed by
+// @ and the revision number, as in "tags/v1.0.0@42".
+type svnSource struct {
+	baseVCSSource
+}
+
+// initLocal checks out an empty working copy of the repository, as checking
+// out all of it would bring every branch and tag along. updateVersion fills it
+// in with whichever version is needed.
+func (s *svnSource) initLocal(ctx context.Context) error {
+	cmd := commandContext(ctx, s.settings.vcs, "svn", "checkout", "--depth", "empty", svnRemoteURL(s.repo.Remote()), s.repo.LocalPath())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return unwrapVcsErr(newVcsRemoteErrorOr(err, cmd.Args(), string(out),
+			"unable to get repository"))
+	}
+	return nil
+}
+
+func (s *svnSource) listVersions(ctx context.Context) ([]PairedVersion, error) {
+	remote := svnRemoteURL(s.repo.Remote())
+	dirs, err := s.listDirs(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	trunk, has := dirs["trunk"]
+	if !has {
+		rev, err := s.lastChanged(ctx, remote)
+		if err != nil {
+			return nil, err
+		}
+		return []PairedVersion{newDefaultBranch("(default)").Pair(Revision(rev))}, nil
+	}
+
+	vlist := []PairedVersion{newDefaultBranch("trunk").Pair(Revision("trunk@" + trunk))}
+	for _, d := range []struct {
+		dir string
+		mk  func(string) UnpairedVersion
+	}{
+		{"branches", NewBranch},
+		{"tags", NewVersion},
+	} {
+		if _, has := dirs[d.dir]; !has {
+			continue
+		}
+
+		entries, err := s.listDirs(ctx, remote+"/"+d.dir)
+		if err != nil {
+			return nil, err
+		}
+		for name, rev := range entries {
+			vlist = append(vlist, d.mk(name).Pair(Revision(d.dir+"/"+name+"@"+rev)))
+		}
+	}
+
+	return vlist, nil
+}
+
+// listDirs lists the directories in the directory at u, along with the
+// revision in which each last changed.
+func (s *svnSource) listDirs(ctx context.Context, u string) (map[string]string, error) {
+	out, err := commandContext(ctx, s.settings.vcs, "svn", "list", "--xml", u).CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrap(err, string(out))
+	}
+	return parseSvnListDirs(out)
+}
+
+// parseSvnListDirs parses the output of svn list --xml into a map from the name
+// of each directory listed to the revision in which it last changed.
+func parseSvnListDirs(out []byte) (map[string]string, error) {
+	var list struct {
+		Entries []struct {
+			Kind   string    `xml:"kind,attr"`
+			Name   string    `xml:"name"`
+			Commit svnCommit `xml:"commit"`
+		} `xml:"list>entry"`
+	}
+	if err := xml.Unmarshal(out, &list); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse svn list output")
+	}
+
+	dirs := make(map[string]string)
+	for _, e := range list.Entries {
+		if e.Kind == "dir" {
+			dirs[e.Name] = e.Commit.Revision
+		}
+	}
+	return dirs, nil
+}
+
+// lastChanged returns the revision in which u last changed.
+func (s *svnSource) lastChanged(ctx context.Context, u string) (string, error) {
+	out, err := commandContext(ctx, s.settings.vcs, "svn", "info", "--xml", u).CombinedOutput()
+	if err != nil {
+		return "", errors.Wrap(err, string(out))
+	}
+
+	var info struct {
+		Commit svnCommit `xml:"entry>commit"`
+	}
+	if err = xml.Unmarshal(out, &info); err != nil {
+		return "", errors.Wrapf(err, "unable to parse svn info output")
+	}
+	if info.Commit.Revision == "" {
+		return "", errors.Errorf("no revision in svn info output for %s", u)
+	}
+	return info.Commit.Revision, nil
+}
+
+func (s *svnSource) disambiguateRevision(ctx context.Context, r Revision) (Revision, error) {
+	path, rev, ok := splitSvnRevision(string(r))
+	if !ok {
+		return s.baseVCSSource.disambiguateRevision(ctx, r)
+	}
+
+	if _, err := s.lastChanged(ctx, svnPegURL(svnRemoteURL(s.repo.Remote()), path, rev)); err != nil {
+		return "", err
+	}
+	return r, nil
+}
+
+func (s *svnSource) revisionPresentIn(r Revision) (bool, error) {
+	path, rev, ok := splitSvnRevision(string(r))
+	if !ok {
+		return s.baseVCSSource.revisionPresentIn(r)
+	}
+
+	_, err := s.lastChanged(context.TODO(), svnPegURL(svnRemoteURL(s.repo.Remote()), path, rev))
+	return err == nil, nil
+}
+
+func (s *svnSource) exportRevisionTo(ctx context.Context, r Revision, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+		return err
+	}
+
+	// svn export leaves out the working copy metadata, and every checkout
+	// reaches out to the repository anyway, so there is nothing to be gained
+	// from going through the working copy.
+	remote := svnRemoteURL(s.repo.Remote())
+	args := []string{"export", "--force", "-r", string(r), remote, to}
+	if path, rev, ok := splitSvnRevision(string(r)); ok {
+		args = []string{"export", "--force", svnPegURL(remote, path, rev), to}
+	}
+
+	cmd := commandContext(ctx, s.settings.vcs, "svn", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrap(err, string(out))
+	}
+	return nil
+}
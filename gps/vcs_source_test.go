@@ -28,7 +28,7 @@ func TestSlowVcs(t *testing.T) {
 	t.Run("bzr-repo", testBzrRepo)
 	t.Run("bzr-source", testBzrSourceInteractions)
 	t.Run("svn-repo", testSvnRepo)
-	// TODO(sdboyer) svn-source
+	t.Run("svn-source", testSvnSourceInteractions)
 	t.Run("hg-repo", testHgRepo)
 	t.Run("hg-source", testHgSourceInteractions)
 	t.Run("git-repo", testGitRepo)
@@ -67,7 +67,7 @@ func testGitSourceInteractions(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	isrc, err := mb.try(ctx, cpath)
+	isrc, err := mb.try(ctx, cacheDir{root: cpath}, sourceSettings{})
 	if err != nil {
 		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
 	}
@@ -166,7 +166,7 @@ func testGopkginSourceInteractions(t *testing.T) {
 		}
 
 		ctx := context.Background()
-		isrc, err := mb.try(ctx, cpath)
+		isrc, err := mb.try(ctx, cacheDir{root: cpath}, sourceSettings{})
 		if err != nil {
 			t.Errorf("Unexpected error while setting up gopkginSource for test repo: %s", err)
 			return
@@ -332,7 +332,7 @@ func testBzrSourceInteractions(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	isrc, err := mb.try(ctx, cpath)
+	isrc, err := mb.try(ctx, cacheDir{root: cpath}, sourceSettings{})
 	if err != nil {
 		t.Fatalf("Unexpected error while setting up bzrSource for test repo: %s", err)
 	}
@@ -434,7 +434,7 @@ func testHgSourceInteractions(t *testing.T) {
 		}
 
 		ctx := context.Background()
-		isrc, err := mb.try(ctx, cpath)
+		isrc, err := mb.try(ctx, cacheDir{root: cpath}, sourceSettings{})
 		if err != nil {
 			t.Errorf("Unexpected error while setting up hgSource for test repo: %s", err)
 			return
@@ -567,7 +567,7 @@ func TestGitSourceListVersionsNoHEAD(t *testing.T) {
 	mb := maybeGitSource{u}
 
 	ctx := context.Background()
-	isrc, err := mb.try(ctx, cpath)
+	isrc, err := mb.try(ctx, cacheDir{root: cpath}, sourceSettings{})
 	if err != nil {
 		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
 	}
@@ -623,7 +623,7 @@ func TestGitSourceListVersionsNoDupes(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	src, err := mb.try(ctx, cpath)
+	src, err := mb.try(ctx, cacheDir{root: cpath}, sourceSettings{})
 	if err != nil {
 		t.Fatalf("Unexpected error while setting up gitSource for test repo: %s", err)
 	}
@@ -778,7 +778,7 @@ func Test_bzrSource_exportRevisionTo_removeVcsFiles(t *testing.T) {
 	mb := maybeBzrSource{u}
 
 	ctx := context.Background()
-	isrc, err := mb.try(ctx, cpath)
+	isrc, err := mb.try(ctx, cacheDir{root: cpath}, sourceSettings{})
 	if err != nil {
 		t.Fatalf("unexpected error while setting up hgSource for test repo: %s", err)
 	}
@@ -831,7 +831,7 @@ func Test_hgSource_exportRevisionTo_removeVcsFiles(t *testing.T) {
 	mb := maybeHgSource{u}
 
 	ctx := context.Background()
-	isrc, err := mb.try(ctx, cpath)
+	isrc, err := mb.try(ctx, cacheDir{root: cpath}, sourceSettings{})
 	if err != nil {
 		t.Fatalf("unexpected error while setting up hgSource for test repo: %s", err)
 	}
@@ -858,6 +858,175 @@ func Test_hgSource_exportRevisionTo_removeVcsFiles(t *testing.T) {
 	}
 }
 
+func testSvnSourceInteractions(t *testing.T) {
+	t.Parallel()
+
+	// This test is slow, so skip it on -short
+	if testing.Short() {
+		t.Skip("Skipping svn source version fetching test in short mode")
+	}
+	requiresBins(t, "svn", "svnadmin")
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("smcache")
+	h.TempDir("wc")
+	cpath := h.Path("smcache")
+	repoPath := h.Path("repo")
+
+	// Set up a repository with the conventional layout, in which trunk has
+	// moved on since it was tagged, and a branch has been cut from the tag.
+	svn := func(args ...string) {
+		cmd := exec.Command("svn", args...)
+		cmd.Dir = h.Path("wc")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("svn %s failed: %s\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	if out, err := exec.Command("svnadmin", "create", repoPath).CombinedOutput(); err != nil {
+		t.Fatalf("svnadmin create failed: %s\n%s", err, out)
+	}
+	un := "file://" + filepath.ToSlash(repoPath)
+	svn("checkout", un, ".")
+	svn("mkdir", "trunk", "branches", "tags")
+	h.TempFile("wc/trunk/foo.go", "package foo\n")
+	svn("add", "trunk/foo.go")
+	svn("commit", "-m", "initial")
+	svn("copy", "trunk", "tags/v1.0.0")
+	svn("commit", "-m", "tag v1.0.0")
+	svn("copy", "tags/v1.0.0", "branches/fix")
+	svn("commit", "-m", "branch fix")
+	h.TempFile("wc/trunk/bar.go", "package foo\n")
+	svn("add", "trunk/bar.go")
+	svn("commit", "-m", "add bar")
+
+	u, err := url.Parse(un)
+	if err != nil {
+		t.Fatalf("URL was bad, lolwut? errtext: %s", err)
+	}
+	mb := maybeSvnSource{url: u}
+
+	ctx := context.Background()
+	isrc, err := mb.try(ctx, cacheDir{root: cpath}, sourceSettings{})
+	if err != nil {
+		t.Fatalf("Unexpected error while setting up svnSource for test repo: %s", err)
+	}
+	if err = isrc.initLocal(ctx); err != nil {
+		t.Fatalf("Error on checking out svn repo: %s", err)
+	}
+	src, ok := isrc.(*svnSource)
+	if !ok {
+		t.Fatalf("Expected a svnSource, got a %T", isrc)
+	}
+
+	pvlist, err := src.listVersions(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error getting version pairs from svn repo: %s", err)
+	}
+	vlist := hidePair(pvlist)
+	SortForUpgrade(vlist)
+	evl := []Version{
+		NewVersion("v1.0.0").Pair(Revision("tags/v1.0.0@2")),
+		newDefaultBranch("trunk").Pair(Revision("trunk@4")),
+		NewBranch("fix").Pair(Revision("branches/fix@3")),
+	}
+	if !reflect.DeepEqual(vlist, evl) {
+		t.Fatalf("version list was not what we expected:\n\t(GOT): %#v\n\t(WNT): %#v", vlist, evl)
+	}
+
+	is, err := src.revisionPresentIn(Revision("tags/v1.0.0@2"))
+	if err != nil || !is {
+		t.Errorf("expected the tag's revision to be present, got %v, %v", is, err)
+	}
+	if is, _ = src.revisionPresentIn(Revision("tags/v2.0.0@2")); is {
+		t.Error("expected a revision of a path that does not exist not to be present")
+	}
+
+	ptree, err := src.listPackages(ctx, "example.com/foo", Revision("trunk@4"))
+	if err != nil {
+		t.Fatalf("Unexpected error listing packages at trunk: %s", err)
+	}
+	if _, has := ptree.Packages["example.com/foo"]; !has {
+		t.Errorf("expected the root package to be listed, got %v", ptree.Packages)
+	}
+
+	to := filepath.Join(h.Path("."), "export")
+	if err = src.exportRevisionTo(ctx, Revision("tags/v1.0.0@2"), to); err != nil {
+		t.Fatalf("unexpected error exporting tag: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(to, "foo.go")); err != nil {
+		t.Errorf("expected the tag's files to be exported: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(to, "bar.go")); !os.IsNotExist(err) {
+		t.Errorf("expected the files added to trunk after the tag not to be exported, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(to, ".svn")); !os.IsNotExist(err) {
+		t.Errorf("expected .svn/ not to be exported, got %v", err)
+	}
+}
+
+func TestParseSvnListDirs(t *testing.T) {
+	out := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<lists>
+<list path="file:///repo/tags">
+<entry kind="dir">
+<name>v1.0.0</name>
+<commit revision="12">
+<author>sam</author>
+<date>2018-01-02T03:04:05.000000Z</date>
+</commit>
+</entry>
+<entry kind="file">
+<name>README</name>
+<size>10</size>
+<commit revision="3">
+<author>sam</author>
+<date>2018-01-01T03:04:05.000000Z</date>
+</commit>
+</entry>
+<entry kind="dir">
+<name>v1.1.0</name>
+<commit revision="15">
+<author>sam</author>
+<date>2018-01-03T03:04:05.000000Z</date>
+</commit>
+</entry>
+</list>
+</lists>
+`)
+	dirs, err := parseSvnListDirs(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"v1.0.0": "12", "v1.1.0": "15"}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("unexpected directories:\n\t(GOT): %v\n\t(WNT): %v", dirs, want)
+	}
+
+	if _, err = parseSvnListDirs([]byte("svn: E170000: no such thing")); err == nil {
+		t.Error("expected an error parsing output that is not XML")
+	}
+}
+
+func TestSplitSvnRevision(t *testing.T) {
+	for _, fix := range []struct {
+		in, path, rev string
+		ok            bool
+	}{
+		{"tags/v1.0.0@42", "tags/v1.0.0", "42", true},
+		{"trunk@7", "trunk", "7", true},
+		{"42", "", "42", false},
+	} {
+		path, rev, ok := splitSvnRevision(fix.in)
+		if path != fix.path || rev != fix.rev || ok != fix.ok {
+			t.Errorf("splitSvnRevision(%q) = %q, %q, %v; want %q, %q, %v", fix.in, path, rev, ok, fix.path, fix.rev, fix.ok)
+		}
+	}
+	if u := svnPegURL("https://example.com/repo/", "tags/v1.0.0", "42"); u != "https://example.com/repo/tags/v1.0.0@42" {
+		t.Errorf("unexpected peg URL %q", u)
+	}
+}
+
 // Fail a test if the specified binaries aren't installed.
 func requiresBins(t *testing.T, bins ...string) {
 	for _, b := range bins {
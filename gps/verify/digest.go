@@ -7,6 +7,7 @@ package verify
 import (
 	"bytes"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
@@ -18,15 +19,81 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/golang/dep/gps/internal/blake3"
 	"github.com/pkg/errors"
 )
 
 // HashVersion is an arbitrary number that identifies the hash algorithm used by
-// the directory hasher.
+// the directory hasher by default. The known versions are:
 //
-//   1: SHA256, as implemented in crypto/sha256
+//	1: SHA256, as implemented in crypto/sha256
+//	2: SHA512, as implemented in crypto/sha512
+//	3: BLAKE3, with a 32 byte digest
 const HashVersion = 1
 
+// DigestAlgorithm identifies a hash algorithm with which the directory hasher
+// can digest a tree. Its value is the HashVersion recorded in the digests it
+// produces, so the algorithm that produced any VersionedDigest is always known.
+type DigestAlgorithm int
+
+// The supported digest algorithms.
+const (
+	SHA256 DigestAlgorithm = 1
+	SHA512 DigestAlgorithm = 2
+	BLAKE3 DigestAlgorithm = 3
+)
+
+// DefaultDigestAlgorithm is the algorithm used unless another is chosen.
+const DefaultDigestAlgorithm DigestAlgorithm = HashVersion
+
+var digestAlgorithmNames = map[DigestAlgorithm]string{
+	SHA256: "sha256",
+	SHA512: "sha512",
+	BLAKE3: "blake3",
+}
+
+// ParseDigestAlgorithm returns the digest algorithm with the given name, which
+// is one of "sha256", "sha512" or "blake3".
+func ParseDigestAlgorithm(name string) (DigestAlgorithm, error) {
+	for alg, n := range digestAlgorithmNames {
+		if n == name {
+			return alg, nil
+		}
+	}
+	return 0, errors.Errorf("unknown digest algorithm %q, must be one of sha256, sha512 or blake3", name)
+}
+
+func (alg DigestAlgorithm) String() string {
+	if n, has := digestAlgorithmNames[alg]; has {
+		return n
+	}
+	return fmt.Sprintf("unknown hash version %d", int(alg))
+}
+
+// Supported reports whether the directory hasher can digest trees with the
+// algorithm, and so verify digests produced by it.
+func (alg DigestAlgorithm) Supported() bool {
+	_, has := digestAlgorithmNames[alg]
+	return has
+}
+
+func (alg DigestAlgorithm) newHash() hash.Hash {
+	switch alg {
+	case SHA256:
+		return sha256.New()
+	case SHA512:
+		return sha512.New()
+	case BLAKE3:
+		return blake3.New()
+	}
+	return nil
+}
+
+// VendorMetadataName is the name of the file at the root of a vendor directory
+// in which the projects written there are recorded. It is not considered part
+// of the tree by CheckDepTree.
+const VendorMetadataName = ".dep-metadata.toml"
+
 const osPathSeparator = string(filepath.Separator)
 
 // lineEndingReader is a `io.Reader` that converts CRLF sequences to LF.
@@ -157,7 +224,18 @@ type dirWalkClosure struct {
 //
 // Symbolic links are excluded, as they are not considered valid elements in the
 // definition of a Go module.
+//
+// The hash is computed with DefaultDigestAlgorithm.
 func DigestFromDirectory(osDirname string) (VersionedDigest, error) {
+	return DigestFromDirectoryWithAlgorithm(osDirname, DefaultDigestAlgorithm)
+}
+
+// DigestFromDirectoryWithAlgorithm is like DigestFromDirectory, but hashes the
+// directory contents with the given algorithm.
+func DigestFromDirectoryWithAlgorithm(osDirname string, alg DigestAlgorithm) (VersionedDigest, error) {
+	if !alg.Supported() {
+		return VersionedDigest{}, errors.Errorf("cannot digest %q with %s", osDirname, alg)
+	}
 	osDirname = filepath.Clean(osDirname)
 
 	// Create a single hash instance for the entire operation, rather than a new
@@ -167,7 +245,7 @@ func DigestFromDirectory(osDirname string) (VersionedDigest, error) {
 		someCopyBufer: make([]byte, 4*1024), // only allocate a single page
 		someModeBytes: make([]byte, 4),      // scratch place to store encoded os.FileMode (uint32)
 		someDirLen:    len(osDirname) + len(osPathSeparator),
-		someHash:      sha256.New(),
+		someHash:      alg.newHash(),
 	}
 
 	err := filepath.Walk(osDirname, func(osPathname string, info os.FileInfo, err error) error {
@@ -260,7 +338,7 @@ func DigestFromDirectory(osDirname string) (VersionedDigest, error) {
 	}
 
 	return VersionedDigest{
-		HashVersion: HashVersion,
+		HashVersion: int(alg),
 		Digest:      closure.someHash.Sum(nil),
 	}, nil
 }
@@ -292,8 +370,8 @@ const (
 	DigestMismatchInLock
 
 	// HashVersionMismatch indicates that the hashing algorithm used to generate
-	// the digest being compared against is not the same as the one used by the
-	// current program.
+	// the digest being compared against is not one the current program
+	// supports, so the digest cannot be verified.
 	HashVersionMismatch
 )
 
@@ -367,6 +445,10 @@ func ParseVersionedDigest(input string) (VersionedDigest, error) {
 // and returns an associative array of file system nodes and their respective
 // vendor status conditions.
 //
+// Each project is hashed with the algorithm that produced its expected digest,
+// so that digests produced by any supported algorithm can be verified, whatever
+// algorithm new digests are being produced with.
+//
 // The keys to the expected digest sums associative array represent the
 // project's dependencies, and each is required to be expressed using the
 // solidus character, `/`, as its path separator. For example, even on a GOOS
@@ -459,12 +541,13 @@ func CheckDepTree(osDirname string, wantDigests map[string]VersionedDigest) (map
 
 		if expectedSum, ok := wantDigests[slashPathname]; ok {
 			ls := EmptyDigestInLock
-			if expectedSum.HashVersion != HashVersion {
+			alg := DigestAlgorithm(expectedSum.HashVersion)
+			if !alg.Supported() {
 				if !expectedSum.IsEmpty() {
 					ls = HashVersionMismatch
 				}
 			} else if len(expectedSum.Digest) > 0 {
-				projectSum, err := DigestFromDirectory(osPathname)
+				projectSum, err := DigestFromDirectoryWithAlgorithm(osPathname, alg)
 				if err != nil {
 					return nil, errors.Wrap(err, "cannot compute dependency hash")
 				}
@@ -491,6 +574,10 @@ func CheckDepTree(osDirname string, wantDigests map[string]VersionedDigest) (map
 			return nil, errors.Wrap(err, "cannot get sorted list of directory children")
 		}
 		for _, osChildName := range osChildrenNames {
+			if currentNode.osRelative == "" && osChildName == VendorMetadataName {
+				// The vendor directory's own metadata belongs to no project.
+				continue
+			}
 			switch osChildName {
 			case ".", "..", "vendor", ".bzr", ".git", ".hg", ".svn":
 				// skip
@@ -7,6 +7,7 @@ package verify
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -139,6 +140,27 @@ func TestDigestFromDirectory(t *testing.T) {
 	})
 }
 
+func TestParseDigestAlgorithm(t *testing.T) {
+	for _, alg := range []DigestAlgorithm{SHA256, SHA512, BLAKE3} {
+		got, err := ParseDigestAlgorithm(alg.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != alg {
+			t.Errorf("%q parsed as %v", alg, got)
+		}
+	}
+	if _, err := ParseDigestAlgorithm("md5"); err == nil {
+		t.Error("expected an error parsing an unknown algorithm")
+	}
+	if DigestAlgorithm(99).Supported() {
+		t.Error("expected an unknown hash version not to be supported")
+	}
+	if _, err := DigestFromDirectoryWithAlgorithm(".", 99); err == nil {
+		t.Error("expected an error digesting with an unknown hash version")
+	}
+}
+
 func TestVerifyDepTree(t *testing.T) {
 	vendorRoot := getTestdataVerifyRoot(t)
 
@@ -205,12 +227,46 @@ func TestVerifyDepTree(t *testing.T) {
 
 	})
 
+	t.Run("other-algorithms", func(t *testing.T) {
+		t.Parallel()
+		for _, alg := range []DigestAlgorithm{SHA512, BLAKE3} {
+			wantDigests := make(map[string]VersionedDigest)
+			for k, v := range wantSums {
+				wantDigests[k] = VersionedDigest{
+					HashVersion: int(alg),
+					Digest:      v,
+				}
+			}
+			for _, k := range []string{"github.com/alice/match", "github.com/bob/match", "launchpad.net/match"} {
+				vd, err := DigestFromDirectoryWithAlgorithm(filepath.Join(vendorRoot, k), alg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if vd.HashVersion != int(alg) {
+					t.Fatalf("expected a %s digest to have hash version %d, got %d", alg, alg, vd.HashVersion)
+				}
+				wantDigests[k] = vd
+			}
+
+			status, err := CheckDepTree(vendorRoot, wantDigests)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkStatus(t, status, "github.com/alice/match", NoMismatch)
+			checkStatus(t, status, "github.com/alice/mismatch", DigestMismatchInLock)
+			checkStatus(t, status, "github.com/bob/match", NoMismatch)
+			checkStatus(t, status, "github.com/bob/emptyDigest", EmptyDigestInLock)
+			checkStatus(t, status, "launchpad.net/match", NoMismatch)
+		}
+	})
+
 	t.Run("hashv-mismatch", func(t *testing.T) {
 		t.Parallel()
 		wantDigests := make(map[string]VersionedDigest)
 		for k, v := range wantSums {
 			wantDigests[k] = VersionedDigest{
-				HashVersion: HashVersion + 1,
+				HashVersion: 99, // not a supported algorithm
 				Digest:      v,
 			}
 		}
@@ -259,3 +315,31 @@ func BenchmarkVerifyDepTree(b *testing.B) {
 		}
 	}
 }
+
+func TestVerifyDepTreeSkipsVendorMetadata(t *testing.T) {
+	vendorRoot, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(vendorRoot)
+
+	if err := os.MkdirAll(filepath.Join(vendorRoot, "github.com", "alice", "match"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{VendorMetadataName, filepath.Join("github.com", VendorMetadataName)} {
+		if err := ioutil.WriteFile(filepath.Join(vendorRoot, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, err := CheckDepTree(vendorRoot, map[string]VersionedDigest{"github.com/alice/match": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, has := status[VendorMetadataName]; has {
+		t.Errorf("expected the vendor metadata not to be considered part of the tree, got %v", status)
+	}
+	if got := status["github.com/"+VendorMetadataName]; got != NotInLock {
+		t.Errorf("expected metadata file below the vendor root to be %v, got %v", NotInLock, got)
+	}
+}
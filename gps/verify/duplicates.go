@@ -0,0 +1,47 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verify
+
+import (
+	"sort"
+
+	"github.com/golang/dep/gps"
+)
+
+// FindDuplicates reports the groups of projects in the lock whose trees have
+// identical hash digests. Such projects are very likely the same repository,
+// selected under different import paths - a fork and its upstream at the same
+// revision, say, or an alias or case variant of the same path - and are
+// candidates for consolidation.
+//
+// Only projects that are VerifiableProjects with a digest are considered. Each
+// group lists its projects in sorted order, and the groups are ordered by
+// their first project.
+func FindDuplicates(l gps.Lock) [][]gps.ProjectRoot {
+	if l == nil {
+		return nil
+	}
+
+	byDigest := make(map[string][]gps.ProjectRoot)
+	for _, lp := range l.Projects() {
+		vp, ok := lp.(VerifiableProject)
+		if !ok || vp.Digest.IsEmpty() {
+			continue
+		}
+		d := vp.Digest.String()
+		byDigest[d] = append(byDigest[d], vp.Ident().ProjectRoot)
+	}
+
+	var dups [][]gps.ProjectRoot
+	for _, prs := range byDigest {
+		if len(prs) < 2 {
+			continue
+		}
+		sort.Slice(prs, func(i, j int) bool { return prs[i] < prs[j] })
+		dups = append(dups, prs)
+	}
+	sort.Slice(dups, func(i, j int) bool { return dups[i][0] < dups[j][0] })
+	return dups
+}
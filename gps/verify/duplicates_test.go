@@ -0,0 +1,48 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verify
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep/gps"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	mkvp := func(root string, hv int, digest string) gps.LockedProject {
+		return VerifiableProject{
+			LockedProject: gps.NewLockedProject(mkPI(root), gps.Revision("rev"), []string{"."}),
+			Digest:        VersionedDigest{HashVersion: hv, Digest: []byte(digest)},
+		}
+	}
+
+	l := safeLock{
+		p: []gps.LockedProject{
+			mkvp("github.com/upstream/lib", 1, "aaa"),
+			mkvp("github.com/other/thing", 1, "bbb"),
+			mkvp("github.com/Fork/lib", 1, "aaa"),
+			mkvp("gopkg.in/lib.v1", 1, "aaa"),
+			mkvp("github.com/other/Thing", 1, "bbb"),
+			// The same digest under a different hash version is unrelated.
+			mkvp("github.com/unrelated/x", 2, "bbb"),
+			mkvp("github.com/nodigest/a", 0, ""),
+			mkvp("github.com/nodigest/b", 0, ""),
+			gps.NewLockedProject(mkPI("github.com/plain/lp"), gps.Revision("rev"), []string{"."}),
+		},
+	}
+
+	want := [][]gps.ProjectRoot{
+		{"github.com/Fork/lib", "github.com/upstream/lib", "gopkg.in/lib.v1"},
+		{"github.com/other/Thing", "github.com/other/thing"},
+	}
+	if got := FindDuplicates(l); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected duplicates:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	if got := FindDuplicates(nil); got != nil {
+		t.Errorf("expected no duplicates in a nil lock, got %v", got)
+	}
+}
@@ -6,10 +6,13 @@ package verify
 
 import (
 	"bytes"
+	"fmt"
 	"sort"
 	"strings"
 
+	"github.com/Masterminds/semver"
 	"github.com/golang/dep/gps"
+	"github.com/pkg/errors"
 )
 
 // DeltaDimension defines a bitset enumerating all of the different dimensions
@@ -43,6 +46,11 @@ type LockDelta struct {
 // within a Lock. It encapsulates the property-level differences represented by
 // a LockedProjectPropertiesDelta, but can also represent existence deltas - a
 // given name came to exist, or cease to exist, across two Locks.
+//
+// The version, revision and source of a project that was added are recorded
+// as the After properties, and those of one that was removed as the Before
+// properties, but the project is only considered to have changed along the
+// ProjectAdded or ProjectRemoved dimension.
 type LockedProjectDelta struct {
 	Name                         gps.ProjectRoot
 	ProjectRemoved, ProjectAdded bool
@@ -98,6 +106,8 @@ func DiffLocks(l1, l2 gps.Lock) LockDelta {
 			// and the non-obvious case, where p2 is shorter than p1.
 			ProjectRemoved: true,
 		}
+		lpd.VersionBefore, lpd.RevisionBefore = splitLockedVersion(lp1)
+		lpd.SourceBefore = lp1.Ident().Source
 
 		for i2 := i2next; i2 < len(p2); i2++ {
 			lp2 := p2[i2]
@@ -111,10 +121,7 @@ func DiffLocks(l1, l2 gps.Lock) LockDelta {
 				}
 				i2next = i2 + 1 // Don't visit this project again
 			case +1: // Found a new project
-				diff.ProjectDeltas[pr2] = LockedProjectDelta{
-					Name:         pr2,
-					ProjectAdded: true,
-				}
+				diff.ProjectDeltas[pr2] = addedProjectDelta(lp2)
 				i2next = i2 + 1 // Don't visit this project again
 				continue        // Keep looking for a matching project
 			}
@@ -128,11 +135,7 @@ func DiffLocks(l1, l2 gps.Lock) LockDelta {
 	// Anything that still hasn't been evaluated are adds
 	for i2 := i2next; i2 < len(p2); i2++ {
 		lp2 := p2[i2]
-		pr2 := lp2.Ident().ProjectRoot
-		diff.ProjectDeltas[pr2] = LockedProjectDelta{
-			Name:         pr2,
-			ProjectAdded: true,
-		}
+		diff.ProjectDeltas[lp2.Ident().ProjectRoot] = addedProjectDelta(lp2)
 	}
 
 	diff.AddedImportInputs, diff.RemovedImportInputs = findAddedAndRemoved(l1.InputImports(), l2.InputImports())
@@ -140,6 +143,33 @@ func DiffLocks(l1, l2 gps.Lock) LockDelta {
 	return diff
 }
 
+// addedProjectDelta returns the delta for a project that is only in the second
+// lock.
+func addedProjectDelta(lp gps.LockedProject) LockedProjectDelta {
+	lpd := LockedProjectDelta{
+		Name:         lp.Ident().ProjectRoot,
+		ProjectAdded: true,
+	}
+	lpd.VersionAfter, lpd.RevisionAfter = splitLockedVersion(lp)
+	lpd.SourceAfter = lp.Ident().Source
+	return lpd
+}
+
+// splitLockedVersion returns the unpaired version, if any, and the revision, if
+// any, that make up the version of a locked project.
+func splitLockedVersion(lp gps.LockedProject) (gps.UnpairedVersion, gps.Revision) {
+	switch v := lp.Version().(type) {
+	case gps.PairedVersion:
+		return v.Unpair(), v.Revision()
+	case gps.Revision:
+		return nil, v
+	case gps.UnpairedVersion:
+		// This should ideally never happen
+		return v, ""
+	}
+	return nil, ""
+}
+
 func findAddedAndRemoved(l1, l2 []string) (add, remove []string) {
 	// Computing package add/removes might be optimizable to O(n) (?), but it's
 	// not critical path for any known case, so not worth the effort right now.
@@ -181,25 +211,8 @@ func DiffLockedProjectProperties(lp1, lp2 gps.LockedProject) LockedProjectProper
 
 	ld.PackagesAdded, ld.PackagesRemoved = findAddedAndRemoved(lp1.Packages(), lp2.Packages())
 
-	switch v := lp1.Version().(type) {
-	case gps.PairedVersion:
-		ld.VersionBefore, ld.RevisionBefore = v.Unpair(), v.Revision()
-	case gps.Revision:
-		ld.RevisionBefore = v
-	case gps.UnpairedVersion:
-		// This should ideally never happen
-		ld.VersionBefore = v
-	}
-
-	switch v := lp2.Version().(type) {
-	case gps.PairedVersion:
-		ld.VersionAfter, ld.RevisionAfter = v.Unpair(), v.Revision()
-	case gps.Revision:
-		ld.RevisionAfter = v
-	case gps.UnpairedVersion:
-		// This should ideally never happen
-		ld.VersionAfter = v
-	}
+	ld.VersionBefore, ld.RevisionBefore = splitLockedVersion(lp1)
+	ld.VersionAfter, ld.RevisionAfter = splitLockedVersion(lp2)
 
 	vp1, ok1 := lp1.(VerifiableProject)
 	vp2, ok2 := lp2.(VerifiableProject)
@@ -276,23 +289,26 @@ func (ld LockedProjectDelta) Changed(dims DeltaDimension) bool {
 		return true
 	}
 
+	if ld.WasAdded() || ld.WasRemoved() {
+		return false
+	}
 	return ld.LockedProjectPropertiesDelta.Changed(dims & ^ProjectAdded & ^ProjectRemoved)
 }
 
 // Changes returns a bitset indicating the dimensions along which there were
 // changes between the compared LockedProjects. This includes both
-// existence-level deltas (add/remove) and property-level deltas.
+// existence-level deltas (add/remove) and property-level deltas, though a
+// project that was added or removed has only the existence-level delta.
 func (ld LockedProjectDelta) Changes() DeltaDimension {
-	var dd DeltaDimension
 	if ld.WasAdded() {
-		dd |= ProjectAdded
+		return ProjectAdded
 	}
 
 	if ld.WasRemoved() {
-		dd |= ProjectRemoved
+		return ProjectRemoved
 	}
 
-	return dd | ld.LockedProjectPropertiesDelta.Changes()
+	return ld.LockedProjectPropertiesDelta.Changes()
 }
 
 // WasRemoved returns true if the named project existed in the first lock, but
@@ -421,6 +437,171 @@ func (ld LockedProjectPropertiesDelta) HashVersionWasZero() bool {
 	return ld.HashVersionBefore == 0
 }
 
+// VersionChange classifies the change in a project's locked version between
+// two locks.
+type VersionChange uint8
+
+// The ways in which a project's locked version can change.
+const (
+	// VersionUnchanged indicates that neither the version nor the revision
+	// changed, though other properties of the project may have.
+	VersionUnchanged VersionChange = iota
+	// VersionAdded indicates that the project was added.
+	VersionAdded
+	// VersionRemoved indicates that the project was removed.
+	VersionRemoved
+	// VersionUpgraded indicates that the project moved to a newer semantic
+	// version, or, as classified by VersionChangeUsing, to a more recently
+	// committed revision of a branch.
+	VersionUpgraded
+	// VersionDowngraded indicates that the project moved to an older semantic
+	// version, or, as classified by VersionChangeUsing, to a less recently
+	// committed revision of a branch.
+	VersionDowngraded
+	// VersionSwitched indicates that the project moved to a version that
+	// cannot be ordered against the old one, such as from one branch to
+	// another, or from a semantic version to a bare revision.
+	VersionSwitched
+	// RevisionOnly indicates that the project's version stayed the same, but
+	// its revision changed, as when a branch moves or a tag is replaced.
+	RevisionOnly
+)
+
+func (vc VersionChange) String() string {
+	switch vc {
+	case VersionUnchanged:
+		return "unchanged"
+	case VersionAdded:
+		return "added"
+	case VersionRemoved:
+		return "removed"
+	case VersionUpgraded:
+		return "upgraded"
+	case VersionDowngraded:
+		return "downgraded"
+	case VersionSwitched:
+		return "switched"
+	case RevisionOnly:
+		return "revision changed"
+	}
+	return fmt.Sprintf("VersionChange(%d)", uint8(vc))
+}
+
+// VersionChange classifies the change in the project's locked version.
+func (ld LockedProjectDelta) VersionChange() VersionChange {
+	switch {
+	case ld.WasAdded():
+		return VersionAdded
+	case ld.WasRemoved():
+		return VersionRemoved
+	case ld.VersionChanged():
+		before, berr := semverOf(ld.VersionBefore)
+		after, aerr := semverOf(ld.VersionAfter)
+		switch {
+		case berr != nil || aerr != nil:
+			return VersionSwitched
+		case after.GreaterThan(before):
+			return VersionUpgraded
+		case after.LessThan(before):
+			return VersionDowngraded
+		}
+		// Semantic versions that are equal but for their metadata.
+		return VersionSwitched
+	case ld.RevisionChanged():
+		return RevisionOnly
+	}
+	return VersionUnchanged
+}
+
+// VersionChangeUsing is like VersionChange, but where the project's versions
+// before and after are both branches, or bare revisions, which the versions
+// alone cannot order, it classifies the change as an upgrade or a downgrade by
+// when the revisions before and after were committed, as rtl reports. If rtl
+// cannot report both, the change is classified as by VersionChange.
+func (ld LockedProjectDelta) VersionChangeUsing(rtl gps.RevisionTimeLister) VersionChange {
+	vc := ld.VersionChange()
+	if vc != VersionSwitched && vc != RevisionOnly {
+		return vc
+	}
+	if !isBranchOrNil(ld.VersionBefore) || !isBranchOrNil(ld.VersionAfter) || ld.RevisionBefore == "" || ld.RevisionAfter == "" {
+		return vc
+	}
+
+	id := gps.ProjectIdentifier{ProjectRoot: ld.Name, Source: ld.SourceAfter}
+	times, err := rtl.RevisionTimes(id, []gps.Revision{ld.RevisionBefore, ld.RevisionAfter})
+	if err != nil {
+		return vc
+	}
+	before, bok := times[ld.RevisionBefore]
+	after, aok := times[ld.RevisionAfter]
+	switch {
+	case !bok || !aok:
+		return vc
+	case after.After(before):
+		return VersionUpgraded
+	case after.Before(before):
+		return VersionDowngraded
+	}
+	return vc
+}
+
+// isBranchOrNil reports whether v is a branch, or absent.
+func isBranchOrNil(v gps.UnpairedVersion) bool {
+	return v == nil || v.Type() == gps.IsBranch
+}
+
+// semverOf parses v as a semantic version, if it is one.
+func semverOf(v gps.UnpairedVersion) (semver.Version, error) {
+	if v == nil || v.Type() != gps.IsSemver {
+		return semver.Version{}, errors.New("not a semantic version")
+	}
+	return semver.NewVersion(v.String())
+}
+
+// String renders the changes to the versions of the projects in the delta,
+// one project per line, in order of project root. Projects whose versions and
+// revisions did not change are omitted, as are changes to input imports.
+func (ld LockDelta) String() string {
+	prs := make([]string, 0, len(ld.ProjectDeltas))
+	for pr := range ld.ProjectDeltas {
+		prs = append(prs, string(pr))
+	}
+	sort.Strings(prs)
+
+	var buf bytes.Buffer
+	for _, pr := range prs {
+		lpd := ld.ProjectDeltas[gps.ProjectRoot(pr)]
+		before := describeLockedVersion(lpd.VersionBefore, lpd.RevisionBefore)
+		after := describeLockedVersion(lpd.VersionAfter, lpd.RevisionAfter)
+		switch vc := lpd.VersionChange(); vc {
+		case VersionUnchanged:
+			continue
+		case VersionAdded:
+			fmt.Fprintf(&buf, "%s: added at %s\n", pr, after)
+		case VersionRemoved:
+			fmt.Fprintf(&buf, "%s: removed from %s\n", pr, before)
+		default:
+			fmt.Fprintf(&buf, "%s: %s from %s to %s\n", pr, vc, before, after)
+		}
+	}
+	return buf.String()
+}
+
+// describeLockedVersion renders a locked version and its revision, abbreviating
+// the revision.
+func describeLockedVersion(v gps.UnpairedVersion, r gps.Revision) string {
+	if len(r) > 7 {
+		r = r[:7]
+	}
+	switch {
+	case v == nil:
+		return string(r)
+	case r == "":
+		return v.String()
+	}
+	return fmt.Sprintf("%s (%s)", v, r)
+}
+
 // sortLockedProjects returns a sorted copy of lps, or itself if already sorted.
 func sortLockedProjects(lps []gps.LockedProject) []gps.LockedProject {
 	if len(lps) <= 1 || sort.SliceIsSorted(lps, func(i, j int) bool {
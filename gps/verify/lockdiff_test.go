@@ -9,6 +9,7 @@ import (
 	"math/bits"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/dep/gps"
 )
@@ -489,3 +490,106 @@ func (lpt lockedProjectTransformer) toPlainLP() lockedProjectTransformer {
 		return lp
 	})
 }
+
+func TestLockDeltaVersionChanges(t *testing.T) {
+	before := safeLock{
+		p: []gps.LockedProject{
+			newVerifiableProject(mkPI("branch.com/moved"), gps.NewBranch("master").Pair("1111111111"), []string{"."}),
+			newVerifiableProject(mkPI("down.com/grade"), gps.NewVersion("v1.2.0").Pair("2222222222"), []string{"."}),
+			newVerifiableProject(mkPI("pkgs.com/only"), gps.NewVersion("v1.0.0").Pair("3333333333"), []string{"."}),
+			newVerifiableProject(mkPI("removed.com/proj"), gps.NewVersion("v0.1.0").Pair("4444444444"), []string{"."}),
+			newVerifiableProject(mkPI("switch.com/proj"), gps.NewVersion("v1.0.0").Pair("5555555555"), []string{"."}),
+			newVerifiableProject(mkPI("up.com/grade"), gps.NewVersion("v1.0.0").Pair("6666666666"), []string{"."}),
+		},
+	}
+	after := safeLock{
+		p: []gps.LockedProject{
+			newVerifiableProject(mkPI("added.com/proj"), gps.Revision("7777777777"), []string{"."}),
+			newVerifiableProject(mkPI("branch.com/moved"), gps.NewBranch("master").Pair("8888888888"), []string{"."}),
+			newVerifiableProject(mkPI("down.com/grade"), gps.NewVersion("v1.1.0").Pair("9999999999"), []string{"."}),
+			newVerifiableProject(mkPI("pkgs.com/only"), gps.NewVersion("v1.0.0").Pair("3333333333"), []string{".", "sub"}),
+			newVerifiableProject(mkPI("switch.com/proj"), gps.NewBranch("dev").Pair("aaaaaaaaaa"), []string{"."}),
+			newVerifiableProject(mkPI("up.com/grade"), gps.NewVersion("v1.1.0").Pair("bbbbbbbbbb"), []string{"."}),
+		},
+	}
+
+	ld := DiffLocks(before, after)
+	want := map[gps.ProjectRoot]VersionChange{
+		"added.com/proj":   VersionAdded,
+		"branch.com/moved": RevisionOnly,
+		"down.com/grade":   VersionDowngraded,
+		"pkgs.com/only":    VersionUnchanged,
+		"removed.com/proj": VersionRemoved,
+		"switch.com/proj":  VersionSwitched,
+		"up.com/grade":     VersionUpgraded,
+	}
+	for pr, vc := range want {
+		if got := ld.ProjectDeltas[pr].VersionChange(); got != vc {
+			t.Errorf("expected %s to be %s, got %s", pr, vc, got)
+		}
+	}
+
+	if lpd := ld.ProjectDeltas["added.com/proj"]; lpd.RevisionAfter != "7777777777" || lpd.Changes() != ProjectAdded {
+		t.Errorf("expected an added project to carry its revision, and change only by being added, got %+v", lpd)
+	}
+	if lpd := ld.ProjectDeltas["removed.com/proj"]; lpd.VersionBefore.String() != "v0.1.0" || lpd.Changes() != ProjectRemoved {
+		t.Errorf("expected a removed project to carry its version, and change only by being removed, got %+v", lpd)
+	}
+
+	wantStr := `added.com/proj: added at 7777777
+branch.com/moved: revision changed from master (1111111) to master (8888888)
+down.com/grade: downgraded from v1.2.0 (2222222) to v1.1.0 (9999999)
+removed.com/proj: removed from v0.1.0 (4444444)
+switch.com/proj: switched from v1.0.0 (5555555) to dev (aaaaaaa)
+up.com/grade: upgraded from v1.0.0 (6666666) to v1.1.0 (bbbbbbb)
+`
+	if got := ld.String(); got != wantStr {
+		t.Errorf("unexpected rendering:\n\t(GOT):\n%s\n\t(WNT):\n%s", got, wantStr)
+	}
+	if got := DiffLocks(before, before).String(); got != "" {
+		t.Errorf("expected no changes to render as nothing, got %q", got)
+	}
+}
+
+// fixedRevisionTimes is a gps.RevisionTimeLister with fixed commit times.
+type fixedRevisionTimes map[gps.Revision]time.Time
+
+func (rt fixedRevisionTimes) RevisionTimes(id gps.ProjectIdentifier, revs []gps.Revision) (map[gps.Revision]time.Time, error) {
+	times := make(map[gps.Revision]time.Time)
+	for _, r := range revs {
+		if t, has := rt[r]; has {
+			times[r] = t
+		}
+	}
+	return times, nil
+}
+
+func TestLockDeltaVersionChangeUsing(t *testing.T) {
+	rt := fixedRevisionTimes{
+		"1111111111": time.Unix(100, 0),
+		"2222222222": time.Unix(200, 0),
+		"3333333333": time.Unix(300, 0),
+	}
+	mk := func(v gps.Version) safeLock {
+		return safeLock{p: []gps.LockedProject{newVerifiableProject(mkPI("foo.com/bar"), v, []string{"."})}}
+	}
+
+	for _, c := range []struct {
+		before, after gps.Version
+		want          VersionChange
+	}{
+		{gps.NewBranch("master").Pair("1111111111"), gps.NewBranch("master").Pair("2222222222"), VersionUpgraded},
+		{gps.NewBranch("master").Pair("2222222222"), gps.NewBranch("dev").Pair("1111111111"), VersionDowngraded},
+		{gps.Revision("2222222222"), gps.Revision("3333333333"), VersionUpgraded},
+		// Times are only consulted for branches and bare revisions, and only
+		// if both are known.
+		{gps.NewVersion("v1.0.0").Pair("1111111111"), gps.NewBranch("dev").Pair("2222222222"), VersionSwitched},
+		{gps.NewVersion("sometag").Pair("1111111111"), gps.NewVersion("sometag").Pair("2222222222"), RevisionOnly},
+		{gps.NewBranch("master").Pair("1111111111"), gps.NewBranch("master").Pair("4444444444"), RevisionOnly},
+	} {
+		lpd := DiffLocks(mk(c.before), mk(c.after)).ProjectDeltas["foo.com/bar"]
+		if got := lpd.VersionChangeUsing(rt); got != c.want {
+			t.Errorf("expected the change from %s to %s to be %s, got %s", c.before, c.after, c.want, got)
+		}
+	}
+}
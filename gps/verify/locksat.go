@@ -64,7 +64,7 @@ func LockSatisfiesInputs(l gps.Lock, m gps.RootManifest, ptree pkgtree.PackageTr
 	var ig *pkgtree.IgnoredRuleset
 	var req map[string]bool
 	if m != nil {
-		ig = m.IgnoredPackages()
+		ig = gps.IgnoredAndExternalPackages(m)
 		req = m.RequiredPackages()
 	}
 
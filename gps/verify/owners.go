@@ -0,0 +1,127 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verify
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/paths"
+	"github.com/pkg/errors"
+)
+
+// Owners attributes projects to the teams that own them, according to a set of
+// rules mapping import path namespaces to teams, in the manner of a CODEOWNERS
+// file. It is intended to route the review of dependency changes to the teams
+// responsible for them.
+type Owners struct {
+	rules []ownerRule
+}
+
+type ownerRule struct {
+	pattern string
+	teams   []string
+}
+
+// ParseOwners reads ownership rules, one to a line, each of which is a pattern
+// followed by the teams that own the projects matching it, separated by
+// whitespace:
+//
+//	# Comments and blank lines are ignored.
+//	github.com/myorg        @myorg/platform
+//	github.com/myorg/web-*  @myorg/web @myorg/platform
+//	*.corp.example.com      @myorg/infra
+//
+// Patterns are globs of import path prefixes, with the syntax of path.Match,
+// that must match whole path elements, as in GOPRIVATE. As in a CODEOWNERS
+// file, the last rule that matches a project determines its owners.
+func ParseOwners(r io.Reader) (*Owners, error) {
+	o := &Owners{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, errors.Errorf("line %d: no owners for %q", n, fields[0])
+		}
+		o.rules = append(o.rules, ownerRule{pattern: fields[0], teams: fields[1:]})
+	}
+	if err := s.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read ownership rules")
+	}
+	return o, nil
+}
+
+// TeamsFor returns the teams that own the project, or nil if no rule matches
+// it.
+func (o *Owners) TeamsFor(pr gps.ProjectRoot) []string {
+	for i := len(o.rules) - 1; i >= 0; i-- {
+		if paths.MatchPrefixPatterns(o.rules[i].pattern, string(pr)) {
+			return o.rules[i].teams
+		}
+	}
+	return nil
+}
+
+// OwnershipReport attributes a set of projects to the teams that own them.
+type OwnershipReport struct {
+	// Teams maps each team to the projects it owns, in sorted order.
+	Teams map[string][]gps.ProjectRoot
+	// Unowned holds the projects that no rule attributes to any team, in
+	// sorted order.
+	Unowned []gps.ProjectRoot
+}
+
+// Attribute reports the owners of each of the provided projects.
+func (o *Owners) Attribute(prs []gps.ProjectRoot) OwnershipReport {
+	sorted := append([]gps.ProjectRoot(nil), prs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	r := OwnershipReport{Teams: make(map[string][]gps.ProjectRoot)}
+	for _, pr := range sorted {
+		teams := o.TeamsFor(pr)
+		if len(teams) == 0 {
+			r.Unowned = append(r.Unowned, pr)
+		}
+		for _, team := range teams {
+			r.Teams[team] = append(r.Teams[team], pr)
+		}
+	}
+	return r
+}
+
+// AttributeLock reports the owners of each project in the lock.
+func (o *Owners) AttributeLock(l gps.Lock) OwnershipReport {
+	var prs []gps.ProjectRoot
+	if l != nil {
+		for _, lp := range l.Projects() {
+			prs = append(prs, lp.Ident().ProjectRoot)
+		}
+	}
+	return o.Attribute(prs)
+}
+
+// AttributeDelta reports the owners of each project that was added, removed
+// or changed in the delta, which is typically that between the lock before an
+// upgrade and the lock after it. The changes themselves can be found in the
+// delta's ProjectDeltas.
+func (o *Owners) AttributeDelta(ld LockDelta) OwnershipReport {
+	var prs []gps.ProjectRoot
+	for pr, lpd := range ld.ProjectDeltas {
+		if lpd.Changed(AnyChanged) {
+			prs = append(prs, pr)
+		}
+	}
+	return o.Attribute(prs)
+}
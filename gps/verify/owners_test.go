@@ -0,0 +1,83 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verify
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/gps"
+)
+
+func TestOwners(t *testing.T) {
+	o, err := ParseOwners(strings.NewReader(`
+# Platform owns the organization's projects, save for the web ones.
+github.com/myorg              @myorg/platform
+github.com/myorg/web-*        @myorg/web @myorg/platform   # shared
+*.corp.example.com            @myorg/infra
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[gps.ProjectRoot][]string{
+		"github.com/myorg/lib":            {"@myorg/platform"},
+		"github.com/myorg/web-ui":         {"@myorg/web", "@myorg/platform"},
+		"git.corp.example.com/infra/tool": {"@myorg/infra"},
+		"github.com/myorganization/lib":   nil,
+		"github.com/other/lib":            nil,
+	}
+	for pr, want := range cases {
+		if got := o.TeamsFor(pr); !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected owners of %s:\n\t(GOT): %v\n\t(WNT): %v", pr, got, want)
+		}
+	}
+
+	mklp := func(root, rev string) gps.LockedProject {
+		return gps.NewLockedProject(mkPI(root), gps.Revision(rev), []string{"."})
+	}
+	before := safeLock{p: []gps.LockedProject{
+		mklp("github.com/myorg/lib", "rev1"),
+		mklp("github.com/myorg/web-ui", "rev1"),
+		mklp("github.com/other/lib", "rev1"),
+		mklp("github.com/other/gone", "rev1"),
+	}}
+	after := safeLock{p: []gps.LockedProject{
+		mklp("github.com/myorg/lib", "rev1"),
+		mklp("github.com/myorg/web-ui", "rev2"),
+		mklp("github.com/other/lib", "rev1"),
+		mklp("git.corp.example.com/infra/tool", "rev1"),
+	}}
+
+	want := OwnershipReport{
+		Teams: map[string][]gps.ProjectRoot{
+			"@myorg/platform": {"github.com/myorg/lib", "github.com/myorg/web-ui"},
+			"@myorg/web":      {"github.com/myorg/web-ui"},
+		},
+		Unowned: []gps.ProjectRoot{"github.com/other/gone", "github.com/other/lib"},
+	}
+	if got := o.AttributeLock(before); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected ownership of the lock:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+
+	want = OwnershipReport{
+		Teams: map[string][]gps.ProjectRoot{
+			"@myorg/infra":    {"git.corp.example.com/infra/tool"},
+			"@myorg/platform": {"github.com/myorg/web-ui"},
+			"@myorg/web":      {"github.com/myorg/web-ui"},
+		},
+		Unowned: []gps.ProjectRoot{"github.com/other/gone"},
+	}
+	if got := o.AttributeDelta(DiffLocks(before, after)); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected ownership of the changes:\n\t(GOT): %v\n\t(WNT): %v", got, want)
+	}
+}
+
+func TestParseOwnersErrors(t *testing.T) {
+	if _, err := ParseOwners(strings.NewReader("github.com/myorg @myorg/platform\ngithub.com/other\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected a rule without owners to be rejected, got %v", err)
+	}
+}
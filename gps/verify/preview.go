@@ -0,0 +1,39 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verify
+
+import (
+	"context"
+
+	"github.com/golang/dep/gps"
+)
+
+// PreviewSolve prepares a solver with params, runs a full solve against
+// params.Lock, and reports how the solution differs from that lock, without
+// the caller needing to construct a new lock from it. It is intended for
+// check-style commands that fail if a solve would change anything.
+//
+// Solutions carry neither digests nor prune options for the versions they
+// newly select, so the delta reports no changes to either; only changes along
+// the other dimensions are meaningful.
+func PreviewSolve(ctx context.Context, params gps.SolveParameters, sm gps.SourceManager) (LockDelta, error) {
+	s, err := gps.Prepare(params, sm)
+	if err != nil {
+		return LockDelta{}, err
+	}
+	soln, err := s.Solve(ctx)
+	if err != nil {
+		return LockDelta{}, err
+	}
+
+	ld := DiffLocks(params.Lock, soln)
+	for pr, lpd := range ld.ProjectDeltas {
+		lpd.PruneOptsAfter = lpd.PruneOptsBefore
+		lpd.HashVersionAfter = lpd.HashVersionBefore
+		lpd.HashChanged = false
+		ld.ProjectDeltas[pr] = lpd
+	}
+	return ld, nil
+}
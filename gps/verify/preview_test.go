@@ -0,0 +1,77 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package verify
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/replay"
+)
+
+func TestPreviewSolve(t *testing.T) {
+	r, err := replay.Load(filepath.Join("..", "replay", "testdata", "corpus", "backtrack.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := r.Params()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := replay.NewSourceManager(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mkvp := func(pr string, v gps.Version) gps.LockedProject {
+		return VerifiableProject{
+			LockedProject: gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pr)}, v, []string{"."}),
+			PruneOpts:     gps.PruneNestedVendorDirs | gps.PruneUnusedPackages,
+			Digest:        VersionedDigest{HashVersion: HashVersion, Digest: []byte("digest")},
+		}
+	}
+	params.Lock = safeLock{
+		i: []string{"example.com/a", "example.com/b"},
+		p: []gps.LockedProject{
+			mkvp("example.com/a", gps.NewVersion("v1.0.0").Pair("a10a10a10a10a10a10a10a10a10a10a10a10a10a")),
+			mkvp("example.com/c", gps.NewVersion("v1.2.0").Pair("c12c12c12c12c12c12c12c12c12c12c12c12c12c")),
+			mkvp("example.com/old", gps.NewVersion("v1.0.0").Pair("0ld0ld0ld0ld0ld0ld0ld0ld0ld0ld0ld0ld0ld0")),
+		},
+	}
+
+	ld, err := PreviewSolve(context.Background(), params, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[gps.ProjectRoot]VersionChange{
+		"example.com/a":   VersionUnchanged,
+		"example.com/b":   VersionAdded,
+		"example.com/c":   VersionDowngraded,
+		"example.com/old": VersionRemoved,
+	}
+	if len(ld.ProjectDeltas) != len(want) {
+		t.Errorf("expected deltas for %d projects, got %d", len(want), len(ld.ProjectDeltas))
+	}
+	for pr, vc := range want {
+		if got := ld.ProjectDeltas[pr].VersionChange(); got != vc {
+			t.Errorf("expected %s to be %s, got %s", pr, vc, got)
+		}
+	}
+	if ld.Changed(PruneOptsChanged | HashChanged | HashVersionChanged) {
+		t.Errorf("expected no prune option or digest changes to be reported, got %s", ld.Changes())
+	}
+	if ld.ProjectDeltas["example.com/a"].Changed(AnyChanged) {
+		t.Errorf("expected the unchanged project to have no changes, got %s", ld.ProjectDeltas["example.com/a"].Changes())
+	}
+
+	params.Lock = nil
+	params.ToChange = []gps.ProjectRoot{"example.com/a"}
+	if _, err := PreviewSolve(context.Background(), params, sm); err == nil {
+		t.Error("expected invalid parameters to be reported")
+	}
+}
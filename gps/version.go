@@ -157,6 +157,8 @@ func (r Revision) MatchesAny(c Constraint) bool {
 		return true
 	case noneConstraint:
 		return false
+	case unionConstraint, exclusionConstraint, channelConstraint:
+		return tc.MatchesAny(r)
 	case Revision:
 		return r == tc
 	case versionPair:
@@ -175,6 +177,8 @@ func (r Revision) Intersect(c Constraint) Constraint {
 		return r
 	case noneConstraint:
 		return none
+	case unionConstraint, exclusionConstraint, channelConstraint:
+		return tc.Intersect(r)
 	case Revision:
 		if r == tc {
 			return r
@@ -240,6 +244,8 @@ func (v branchVersion) MatchesAny(c Constraint) bool {
 		return true
 	case noneConstraint:
 		return false
+	case unionConstraint, exclusionConstraint, channelConstraint:
+		return tc.MatchesAny(v)
 	case branchVersion:
 		return v.name == tc.name
 	case versionPair:
@@ -257,6 +263,8 @@ func (v branchVersion) Intersect(c Constraint) Constraint {
 		return v
 	case noneConstraint:
 		return none
+	case unionConstraint, exclusionConstraint, channelConstraint:
+		return tc.Intersect(v)
 	case branchVersion:
 		if v.name == tc.name {
 			return v
@@ -332,6 +340,8 @@ func (v plainVersion) MatchesAny(c Constraint) bool {
 		return true
 	case noneConstraint:
 		return false
+	case unionConstraint, exclusionConstraint, channelConstraint:
+		return tc.MatchesAny(v)
 	case plainVersion:
 		return v == tc
 	case versionPair:
@@ -349,6 +359,8 @@ func (v plainVersion) Intersect(c Constraint) Constraint {
 		return v
 	case noneConstraint:
 		return none
+	case unionConstraint, exclusionConstraint, channelConstraint:
+		return tc.Intersect(v)
 	case plainVersion:
 		if v == tc {
 			return v
@@ -388,6 +400,17 @@ type semVersion struct {
 	sv semver.Version
 }
 
+// semverOf returns the semantic version underlying v, if it has one.
+func semverOf(v Version) (semver.Version, bool) {
+	if pv, ok := v.(versionPair); ok {
+		v = pv.v
+	}
+	if sv, ok := v.(semVersion); ok {
+		return sv.sv, true
+	}
+	return semver.Version{}, false
+}
+
 func (v semVersion) String() string {
 	str := v.sv.Original()
 	if str == "" {
@@ -426,6 +449,8 @@ func (v semVersion) MatchesAny(c Constraint) bool {
 		return true
 	case noneConstraint:
 		return false
+	case unionConstraint, exclusionConstraint, channelConstraint:
+		return tc.MatchesAny(v)
 	case semVersion:
 		return v.sv.Equal(tc.sv)
 	case semverConstraint:
@@ -445,6 +470,8 @@ func (v semVersion) Intersect(c Constraint) Constraint {
 		return v
 	case noneConstraint:
 		return none
+	case unionConstraint, exclusionConstraint, channelConstraint:
+		return tc.Intersect(v)
 	case semVersion:
 		if v.sv.Equal(tc.sv) {
 			return v
@@ -545,6 +572,8 @@ func (v versionPair) Intersect(c2 Constraint) Constraint {
 		return v
 	case noneConstraint:
 		return none
+	case unionConstraint, exclusionConstraint, channelConstraint:
+		return tc.Intersect(v)
 	case versionPair:
 		if v.r == tc.r {
 			return v.r
@@ -658,6 +687,9 @@ func compareVersionType(l, r Version) int {
 //  typically appear in version lists, so the only invariant we maintain is
 //  determinism - deeper semantics, like chronology or topology, do not matter.
 //
+// Semver versions that are equal but spelled differently, as with v1.0.0 and
+// 1.0.0, are sorted lexicographically, so the order is always deterministic.
+//
 // So, given a slice of the following versions:
 //
 //  - Branch: master devel
@@ -812,6 +844,11 @@ func vLess(l, r Version, down bool) bool {
 		return lpre
 	}
 
+	if lsv.Equal(rsv) {
+		// Tags that differ only in spelling, like v1.0.0 and 1.0.0, still
+		// need a consistent order.
+		return l.String() < r.String()
+	}
 	if down {
 		return lsv.LessThan(rsv)
 	}
@@ -0,0 +1,67 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+// PairRevision returns the revision r of the project paired with the version
+// that points at it and sorts first for upgrade, as among those returned by
+// VersionsForRevision, so that a revision can be displayed under a friendly
+// name. If no tag or branch points at r, but the project has it, r is returned
+// by itself. If the project does not have r, the error is a
+// *VersionNotFoundError.
+func PairRevision(sm SourceManager, id ProjectIdentifier, r Revision) (Version, error) {
+	uvs, err := sm.VersionsForRevision(id, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(uvs) > 0 {
+		return uvs[0].Pair(r), nil
+	}
+
+	present, err := sm.RevisionPresentIn(id, r)
+	if err != nil {
+		return nil, err
+	}
+	if !present {
+		return nil, &VersionNotFoundError{Ident: id, Version: r}
+	}
+	return r, nil
+}
+
+// PairVersion returns the tag or branch uv of the project paired with the
+// revision it currently points at. If the project has no such tag or branch,
+// the error is a *VersionNotFoundError.
+//
+// The default branch is found whether or not uv is marked as being it.
+func PairVersion(sm SourceManager, id ProjectIdentifier, uv UnpairedVersion) (PairedVersion, error) {
+	pvl, err := sm.ListVersions(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, pv := range pvl {
+		if u := pv.Unpair(); u.Type() == uv.Type() && u.String() == uv.String() {
+			return pv, nil
+		}
+	}
+	return nil, &VersionNotFoundError{Ident: id, Version: uv}
+}
+
+// RevisionFor returns the immutable revision that v of the project refers to,
+// so that a lock can be pinned to revisions: v itself if it is a Revision, the
+// revision paired with it if it is paired, and otherwise the revision the tag
+// or branch currently points at, as by PairVersion.
+func RevisionFor(sm SourceManager, id ProjectIdentifier, v Version) (Revision, error) {
+	switch tv := v.(type) {
+	case Revision:
+		return tv, nil
+	case PairedVersion:
+		return tv.Revision(), nil
+	}
+
+	pv, err := PairVersion(sm, id, v.(UnpairedVersion))
+	if err != nil {
+		return "", err
+	}
+	return pv.Revision(), nil
+}
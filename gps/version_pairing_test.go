@@ -0,0 +1,55 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "testing"
+
+func TestVersionPairing(t *testing.T) {
+	sm := newdepspecSM([]depspec{
+		mkDepspec("root 0.0.0"),
+		mkDepspec("foo 1.0.0 r1"),
+		mkDepspec("foo 1.1.0 r2"),
+		mkDepspec("foo bmaster r2"),
+		mkDepspec("foo rr3"),
+	}, nil)
+	id := mkPI("foo")
+
+	v, err := PairRevision(sm, id, Revision("r2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := NewVersion("1.1.0").Pair("r2"); !v.identical(want) {
+		t.Errorf("expected r2 to pair with %s, got %s", want, v)
+	}
+	if v, err = PairRevision(sm, id, Revision("r3")); err != nil || v != Revision("r3") {
+		t.Errorf("expected a revision with no versions to remain unpaired, got %v (%v)", v, err)
+	}
+	if _, err = PairRevision(sm, id, Revision("r4")); err == nil {
+		t.Error("expected an error pairing a nonexistent revision")
+	}
+
+	pv, err := PairVersion(sm, id, NewBranch("master"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pv.Revision() != "r2" {
+		t.Errorf("expected master to pair with r2, got %s", pv.Revision())
+	}
+	if _, err = PairVersion(sm, id, NewVersion("2.0.0")); err == nil {
+		t.Error("expected an error pairing a nonexistent version")
+	} else if _, ok := err.(*VersionNotFoundError); !ok {
+		t.Errorf("expected a *VersionNotFoundError, got %T: %v", err, err)
+	}
+
+	for v, want := range map[Version]Revision{
+		Revision("r3"):                 "r3",
+		NewVersion("1.0.0").Pair("r9"): "r9",
+		NewVersion("1.0.0"):            "r1",
+	} {
+		if r, err := RevisionFor(sm, id, v); err != nil || r != want {
+			t.Errorf("expected %s to refer to %s, got %s (%v)", v, want, r, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// VersionPreference determines which of the admissible versions of each
+// project the solver tries first, and therefore which it selects if more than
+// one would do.
+type VersionPreference uint8
+
+const (
+	// PreferLocked tries the version of each project in the root lock first,
+	// then any version preferred by the lock of a project depending on it,
+	// then the rest, newest first - or oldest first, if Downgrade is set. This
+	// is the default.
+	PreferLocked VersionPreference = iota
+
+	// PreferNewest tries the versions of every project newest first,
+	// disregarding the root lock and the locks of dependencies, so that the
+	// solution holds the newest versions satisfying all constraints.
+	PreferNewest
+
+	// PreferOldest tries the versions of every project oldest first,
+	// disregarding the root lock and the locks of dependencies, so that the
+	// solution holds the minimal versions satisfying all constraints. As the
+	// minimal versions change only when constraints do, this suits those who
+	// would rather reproduce a solve than pick up new releases.
+	PreferOldest
+)
+
+func (p VersionPreference) String() string {
+	switch p {
+	case PreferLocked:
+		return "locked"
+	case PreferNewest:
+		return "newest"
+	case PreferOldest:
+		return "oldest"
+	}
+	return fmt.Sprintf("VersionPreference(%d)", uint8(p))
+}
+
+// ParseVersionPreference parses the string form of a VersionPreference, as
+// produced by its String method.
+func ParseVersionPreference(s string) (VersionPreference, error) {
+	switch s {
+	case "locked":
+		return PreferLocked, nil
+	case "newest":
+		return PreferNewest, nil
+	case "oldest":
+		return PreferOldest, nil
+	}
+	return 0, errors.Errorf("unknown version preference %q", s)
+}
+
+// downgrade reports whether version lists are to be sorted oldest first under
+// the preference, given the solve's Downgrade setting.
+func (p VersionPreference) downgrade(down bool) bool {
+	switch p {
+	case PreferNewest:
+		return false
+	case PreferOldest:
+		return true
+	}
+	return down
+}
@@ -0,0 +1,66 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "testing"
+
+func TestVersionPreferenceSolve(t *testing.T) {
+	ds := []depspec{
+		mkDepspec("root 0.0.0", "a ^1.1.0", "b ^1.0.0"),
+		mkDepspec("a 1.0.0"),
+		mkDepspec("a 1.1.0", "b ^1.1.0"),
+		mkDepspec("a 1.2.0", "b ^1.2.0"),
+		mkDepspec("b 1.0.0"),
+		mkDepspec("b 1.1.0"),
+		mkDepspec("b 1.2.0"),
+		mkDepspec("b 1.3.0"),
+	}
+
+	for _, test := range []struct {
+		pref   VersionPreference
+		down   bool
+		nodown bool
+		r      map[ProjectIdentifier]LockedProject
+	}{
+		{pref: PreferLocked, r: mksolution("a 1.1.0", "b 1.2.0")},
+		{pref: PreferLocked, down: true, r: mksolution("a 1.1.0", "b 1.2.0")},
+		{pref: PreferNewest, r: mksolution("a 1.2.0", "b 1.3.0")},
+		{pref: PreferNewest, down: true, r: mksolution("a 1.2.0", "b 1.3.0")},
+		// b 1.0.0 is tried first, but a 1.1.0 needs at least b 1.1.0.
+		{pref: PreferOldest, r: mksolution("a 1.1.0", "b 1.1.0")},
+		{pref: PreferOldest, nodown: true, r: mksolution("a 1.1.0", "b 1.2.0")},
+	} {
+		name := test.pref.String()
+		if test.down {
+			name += "/downgrade"
+		}
+		if test.nodown {
+			name += "/nodowngrades"
+		}
+		t.Run(name, func(t *testing.T) {
+			fix := basicFixture{
+				ds:        ds,
+				l:         mklock("a 1.1.0", "b 1.2.0"),
+				r:         test.r,
+				downgrade: test.down,
+			}
+			params := basicFixtureParams(fix)
+			params.Preference = test.pref
+			params.NoDowngrades = test.nodown
+
+			soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+			fixtureSolveSimpleChecks(fix, soln, err, t)
+		})
+	}
+
+	for _, p := range []VersionPreference{PreferLocked, PreferNewest, PreferOldest} {
+		if got, err := ParseVersionPreference(p.String()); err != nil || got != p {
+			t.Errorf("expected %q to parse back to itself, got %v (%v)", p, got, err)
+		}
+	}
+	if _, err := ParseVersionPreference("random"); err == nil {
+		t.Error("expected an error parsing an unknown preference")
+	}
+}
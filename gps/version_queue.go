@@ -18,6 +18,7 @@ type versionQueue struct {
 	id           ProjectIdentifier
 	pi           []Version
 	lockv, prefv Version
+	promoted     Version
 	fails        []failedVersion
 	b            sourceBridge
 	failed       bool
@@ -100,13 +101,14 @@ func (vq *versionQueue) advance(fail error) error {
 		vq.pi = make([]Version, len(vltmp))
 		copy(vq.pi, vltmp)
 
-		// search for and remove lockv and prefv, in a pointer GC-safe manner
+		// search for and remove lockv, prefv and any promoted version, in a
+		// pointer GC-safe manner
 		//
 		// could use the version comparator for binary search here to avoid
 		// O(n) each time...if it matters
 		var delkeys []int
 		for k, pi := range vq.pi {
-			if pi == vq.lockv || pi == vq.prefv {
+			if pi == vq.lockv || pi == vq.prefv || pi == vq.promoted {
 				delkeys = append(delkeys, k)
 			}
 		}
@@ -136,6 +138,21 @@ func (vq *versionQueue) advance(fail error) error {
 	return nil
 }
 
+// promote moves v to the front of the queue, adding it if it is not already
+// present, so that it is the next version tried. It is not added again when
+// the rest of the versions are loaded.
+func (vq *versionQueue) promote(v Version) {
+	pi := make([]Version, 0, len(vq.pi)+1)
+	pi = append(pi, v)
+	for _, v2 := range vq.pi {
+		if v2 != v {
+			pi = append(pi, v2)
+		}
+	}
+	vq.pi = pi
+	vq.promoted = v
+}
+
 // isExhausted indicates whether or not the queue has definitely been exhausted,
 // in which case it will return true.
 //
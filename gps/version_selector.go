@@ -0,0 +1,51 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import "github.com/pkg/errors"
+
+// VersionSelector filters and orders the candidate versions of projects, so
+// that an organization can encode its release conventions - skipping tags that
+// match a pattern, say, trying prereleases last, or preferring branches over
+// tags for some projects - without forking the solver.
+//
+// The versions a selector drops are never tried, unless they are locked or
+// otherwise preferred, as those are always tried first. The solver tries the
+// remaining versions in the order the selector returns them in, except that
+// deprecated versions are still tried after all others. Like scores, selection
+// never makes a version acceptable that constraints disallow.
+type VersionSelector interface {
+	// SelectVersions is called once per project per solve, with the project's
+	// versions in the order in which the solver would otherwise try them,
+	// after any VersionScorer has weighted them. It returns the versions to
+	// try, in the order in which to try them, all of which must be among the
+	// candidates.
+	SelectVersions(id ProjectIdentifier, candidates []Version) ([]Version, error)
+}
+
+// selectVersions returns the versions in vl that the selector selects for the
+// project, in the order it selects them in.
+func selectVersions(sel VersionSelector, id ProjectIdentifier, vl []Version) ([]Version, error) {
+	selected, err := sel.SelectVersions(id, append([]Version(nil), vl...))
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[Version]bool, len(vl))
+	for _, v := range vl {
+		candidates[v] = true
+	}
+	seen := make(map[Version]bool, len(selected))
+	for _, v := range selected {
+		if !candidates[v] {
+			return nil, errors.Errorf("version selector returned %s for %s, which is not a candidate", v, id)
+		}
+		if seen[v] {
+			return nil, errors.Errorf("version selector returned %s for %s more than once", v, id)
+		}
+		seen[v] = true
+	}
+	return selected, nil
+}
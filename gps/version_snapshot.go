@@ -0,0 +1,155 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// VersionSnapshot records the versions of each project that were visible to a
+// solve: the paired versions the SourceManager listed for it. A snapshot
+// captured by one solve, via SolveParameters.CaptureVersions, can be given to a
+// later one as SolveParameters.VersionSnapshot, which then chooses among
+// exactly the same versions, whatever has been published since.
+//
+// It encodes to and decodes from JSON, so that it can be kept alongside a
+// project, such as for its CI builds.
+type VersionSnapshot map[ProjectIdentifier][]PairedVersion
+
+type jsonSnapshotProject struct {
+	Name     ProjectRoot           `json:"name"`
+	Source   string                `json:"source,omitempty"`
+	Versions []jsonSnapshotVersion `json:"versions"`
+}
+
+type jsonSnapshotVersion struct {
+	Version  string `json:"version,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	Default  bool   `json:"default,omitempty"`
+	Revision string `json:"revision,omitempty"`
+}
+
+// newJSONVersion returns the JSON form of the version.
+func newJSONVersion(v Version) jsonSnapshotVersion {
+	var jv jsonSnapshotVersion
+	jv.Revision, jv.Branch, jv.Version = VersionComponentStrings(v)
+	if pv, ok := v.(PairedVersion); ok {
+		v = pv.Unpair()
+	}
+	if b, ok := v.(branchVersion); ok {
+		jv.Default = b.isDefault
+	}
+	return jv
+}
+
+// version returns the version that the JSON form describes.
+func (jv jsonSnapshotVersion) version() (Version, error) {
+	var v UnpairedVersion
+	switch {
+	case jv.Branch != "" && jv.Version == "" && jv.Default:
+		v = newDefaultBranch(jv.Branch)
+	case jv.Branch != "" && jv.Version == "":
+		v = NewBranch(jv.Branch)
+	case jv.Version != "" && jv.Branch == "":
+		v = NewVersion(jv.Version)
+	case jv.Version == "" && jv.Branch == "" && jv.Revision != "":
+		return Revision(jv.Revision), nil
+	default:
+		return nil, errors.New("must give at most one of a version or a branch, and a revision if neither")
+	}
+
+	if jv.Revision == "" {
+		return v, nil
+	}
+	return v.Pair(Revision(jv.Revision)), nil
+}
+
+// MarshalJSON encodes the snapshot as an array of projects, sorted by name and
+// then source, each with the versions listed for it.
+func (vs VersionSnapshot) MarshalJSON() ([]byte, error) {
+	ids := make([]ProjectIdentifier, 0, len(vs))
+	for id := range vs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Less(ids[j])
+	})
+
+	jps := make([]jsonSnapshotProject, 0, len(ids))
+	for _, id := range ids {
+		jp := jsonSnapshotProject{
+			Name:     id.ProjectRoot,
+			Source:   id.Source,
+			Versions: make([]jsonSnapshotVersion, 0, len(vs[id])),
+		}
+		for _, pv := range vs[id] {
+			jp.Versions = append(jp.Versions, newJSONVersion(pv))
+		}
+		jps = append(jps, jp)
+	}
+	return json.Marshal(jps)
+}
+
+// UnmarshalJSON decodes a snapshot encoded by MarshalJSON.
+func (vs *VersionSnapshot) UnmarshalJSON(b []byte) error {
+	var jps []jsonSnapshotProject
+	if err := json.Unmarshal(b, &jps); err != nil {
+		return err
+	}
+
+	m := make(VersionSnapshot, len(jps))
+	for _, jp := range jps {
+		id := ProjectIdentifier{ProjectRoot: jp.Name, Source: jp.Source}
+		pvl := make([]PairedVersion, 0, len(jp.Versions))
+		for _, jv := range jp.Versions {
+			if jv.Revision == "" {
+				return errors.Errorf("version snapshot of %s has a version without a revision", id)
+			}
+			v, err := jv.version()
+			if err != nil {
+				return errors.Wrapf(err, "invalid version in snapshot of %s", id)
+			}
+			pv, ok := v.(PairedVersion)
+			if !ok {
+				return errors.Errorf("version snapshot of %s has a bare revision, %s", id, jv.Revision)
+			}
+			pvl = append(pvl, pv)
+		}
+		m[id] = pvl
+	}
+
+	*vs = m
+	return nil
+}
+
+// snapshotVersions ensures that the snapshot of listed versions being captured
+// covers every project in the solution, including those that were selected
+// from the lock without their versions ever being listed, as a later solve
+// may need to look beyond the lock for them.
+func (s *solver) snapshotVersions(lps []LockedProject) (VersionSnapshot, error) {
+	listed := s.b.listedVersions()
+	if listed == nil {
+		return nil, nil
+	}
+
+	for _, lp := range lps {
+		id := lp.Ident()
+		if _, has := listed[id]; has {
+			continue
+		}
+		if _, err := s.b.listVersions(id); err != nil {
+			return nil, err
+		}
+	}
+
+	vs := make(VersionSnapshot)
+	for id, pvl := range s.b.listedVersions() {
+		vs[id] = pvl
+	}
+	return vs, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVersionSnapshotJSON(t *testing.T) {
+	vs := VersionSnapshot{
+		mkPI("a"): {
+			NewVersion("1.0.0").Pair("abc123"),
+			newDefaultBranch("master").Pair("def456"),
+			NewBranch("dev").Pair("fff000"),
+		},
+		ProjectIdentifier{ProjectRoot: "b", Source: "example.com/fork/b"}: {
+			NewVersion("v2.1.0").Pair("aaa111"),
+		},
+	}
+
+	b, err := json.Marshal(vs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got VersionSnapshot
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, vs) {
+		t.Errorf("snapshot changed in round trip through JSON:\n\t(GOT): %#v\n\t(WNT): %#v", got, vs)
+	}
+
+	for _, bad := range []string{
+		`[{"name": "a", "versions": [{"version": "1.0.0"}]}]`,
+		`[{"name": "a", "versions": [{"version": "1.0.0", "branch": "master", "revision": "abc123"}]}]`,
+		`[{"name": "a", "versions": [{"revision": "abc123"}]}]`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &got); err == nil {
+			t.Errorf("expected an error decoding %s", bad)
+		}
+	}
+}
+
+func TestVersionSnapshotSolve(t *testing.T) {
+	fix := basicFixture{
+		ds: []depspec{
+			mkDepspec("root 0.0.0", "a *"),
+			mkDepspec("a 1.0.0", "b *"),
+			mkDepspec("a 1.1.0", "b *"),
+			mkDepspec("b 1.0.0"),
+		},
+		l: mklock("b 1.0.0"),
+	}
+	params := SolveParameters{
+		RootDir:         string(fix.ds[0].n),
+		RootPackageTree: fix.rootTree(),
+		Manifest:        fix.rootmanifest(),
+		Lock:            fix.l,
+		ProjectAnalyzer: naiveAnalyzer{},
+		CaptureVersions: true,
+	}
+
+	soln, err := fixSolve(params, newdepspecSM(fix.ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs := soln.VersionSnapshot()
+	// b was selected from the lock, but must still be captured.
+	for _, pr := range []string{"a", "b"} {
+		if _, has := vs[mkPI(pr)]; !has {
+			t.Errorf("expected the snapshot to include %s", pr)
+		}
+	}
+	if len(vs[mkPI("a")]) != 2 {
+		t.Errorf("expected two versions of a in the snapshot, got %v", vs[mkPI("a")])
+	}
+
+	// A version of a published since the snapshot is not seen.
+	ds := append(fix.ds, mkDepspec("a 1.2.0", "b *"))
+	params.CaptureVersions = false
+	params.VersionSnapshot = vs
+	soln, err = fixSolve(params, newdepspecSM(ds, nil), t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lp := range soln.Projects() {
+		if lp.Ident().ProjectRoot == "a" && lp.Version().String() != "1.1.0" {
+			t.Errorf("expected a@1.1.0 from the snapshot, got %s", lp.Version())
+		}
+	}
+	if soln.VersionSnapshot() != nil {
+		t.Error("expected no snapshot without CaptureVersions")
+	}
+
+	params.AsOf = time.Now()
+	if _, err := fixSolve(params, newdepspecSM(ds, nil), t); err == nil {
+		t.Error("expected a snapshot and AsOf to be rejected together")
+	}
+}
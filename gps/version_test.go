@@ -187,3 +187,24 @@ func TestVersionSorts(t *testing.T) {
 		t.Errorf("Up-then-downgrade sort positions with wrong versions: %v", wrong)
 	}
 }
+
+func TestVersionSortsEquivalentSemver(t *testing.T) {
+	vl := []Version{NewVersion("v1.0.0"), NewVersion("1.0.0"), NewVersion("v1.0")}
+	for _, order := range [][]int{{0, 1, 2}, {2, 1, 0}, {1, 2, 0}} {
+		up := make([]Version, len(order))
+		down := make([]Version, len(order))
+		for i, o := range order {
+			up[i], down[i] = vl[o], vl[o]
+		}
+		SortForUpgrade(up)
+		SortForDowngrade(down)
+
+		want := []string{"1.0.0", "v1.0", "v1.0.0"}
+		for i, v := range up {
+			if v.String() != want[i] || down[i].String() != want[i] {
+				t.Errorf("expected equivalent versions to be sorted lexicographically, got %s up and %s down", up, down)
+				break
+			}
+		}
+	}
+}
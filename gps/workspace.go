@@ -0,0 +1,250 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gps
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/gps/pkgtree"
+)
+
+// WorkspaceMember is one of the root projects of a workspace solve, in which
+// several projects - typically those of a monorepo - are solved for at once, so
+// that they share a single set of dependency versions. See
+// SolveParameters.Workspace.
+type WorkspaceMember struct {
+	// PackageTree is the parsed tree of the member's packages. Its ImportRoot
+	// is the member's import root, beneath which all of its packages must be.
+	PackageTree pkgtree.PackageTree
+
+	// Manifest is the member's manifest, which may be nil.
+	Manifest RootManifest
+}
+
+// workspaceRev is the version of the atoms that stand for the members of a
+// workspace as the dependers of the dependencies they declare, just as rootRev
+// is for the root project.
+var workspaceRev = Revision("(workspace)")
+
+// workspaceManifest is the manifest of the root project of a workspace solve,
+// merged from those of its members.
+type workspaceManifest struct {
+	simpleRootManifest
+	ext *pkgtree.IgnoredRuleset
+}
+
+func (m workspaceManifest) ExternalPackages() *pkgtree.IgnoredRuleset {
+	return m.ext
+}
+
+// mergeWorkspace returns the package tree and manifest of the root project of a
+// workspace solve, which hold the packages, constraints, overrides, ignores and
+// requires of all its members. The import root of the tree is the longest
+// import path that all the members are beneath.
+//
+// The constraints of members on the same project are intersected. Members must
+// agree on the source of each project they constrain, and on any override of
+// it.
+func mergeWorkspace(members []WorkspaceMember) (pkgtree.PackageTree, RootManifest, error) {
+	ptree := pkgtree.PackageTree{
+		Packages: make(map[string]pkgtree.PackageOrErr),
+	}
+	m := workspaceManifest{
+		simpleRootManifest: simpleRootManifest{
+			c:   make(ProjectConstraints),
+			ovr: make(ProjectConstraints),
+			req: make(map[string]bool),
+		},
+	}
+	var ig, ext []string
+
+	roots := make([]string, 0, len(members))
+	for i, mem := range members {
+		root := mem.PackageTree.ImportRoot
+		if root == "" {
+			return pkgtree.PackageTree{}, nil, badOptsFailure(fmt.Sprintf("workspace member %d has an empty import root", i))
+		}
+		if len(mem.PackageTree.Packages) == 0 {
+			return pkgtree.PackageTree{}, nil, badOptsFailure(fmt.Sprintf("workspace member %s has no packages", root))
+		}
+		for _, other := range roots {
+			if pathWithin(root, other) || pathWithin(other, root) {
+				return pkgtree.PackageTree{}, nil, badOptsFailure(fmt.Sprintf("workspace members %s and %s overlap", other, root))
+			}
+		}
+		roots = append(roots, root)
+
+		for path, poe := range mem.PackageTree.Packages {
+			if !pathWithin(path, root) {
+				return pkgtree.PackageTree{}, nil, badOptsFailure(fmt.Sprintf("package %s is not within workspace member %s", path, root))
+			}
+			ptree.Packages[path] = poe
+		}
+
+		if mem.Manifest == nil {
+			continue
+		}
+		for pr, pp := range mem.Manifest.DependencyConstraints() {
+			prev, has := m.c[pr]
+			if !has {
+				m.c[pr] = pp
+				continue
+			}
+			if prev.Source != pp.Source {
+				return pkgtree.PackageTree{}, nil, badOptsFailure(fmt.Sprintf("workspace members disagree on the source of %s: %q and %q", pr, prev.Source, pp.Source))
+			}
+			switch {
+			case prev.Constraint == nil:
+				prev.Constraint = pp.Constraint
+			case pp.Constraint != nil:
+				prev.Constraint = prev.Constraint.Intersect(pp.Constraint)
+			}
+			m.c[pr] = prev
+		}
+		for pr, pp := range mem.Manifest.Overrides() {
+			if prev, has := m.ovr[pr]; has && !sameProperties(prev, pp) {
+				return pkgtree.PackageTree{}, nil, badOptsFailure(fmt.Sprintf("workspace members declare conflicting overrides for %s", pr))
+			}
+			m.ovr[pr] = pp
+		}
+		for pkg, required := range mem.Manifest.RequiredPackages() {
+			if required {
+				m.req[pkg] = true
+			}
+		}
+		ig = append(ig, mem.Manifest.IgnoredPackages().ToSlice()...)
+		if em, ok := mem.Manifest.(ExternalManifest); ok {
+			ext = append(ext, em.ExternalPackages().ToSlice()...)
+		}
+	}
+
+	ptree.ImportRoot = commonImportPath(roots)
+	if ptree.ImportRoot == "" {
+		return pkgtree.PackageTree{}, nil, badOptsFailure(fmt.Sprintf("workspace members %s have no import path in common", strings.Join(roots, ", ")))
+	}
+	m.ig = pkgtree.NewIgnoredRuleset(ig)
+	m.ext = pkgtree.NewIgnoredRuleset(ext)
+	return ptree, m, nil
+}
+
+// pathWithin reports whether the import path is root, or beneath it.
+func pathWithin(path, root string) bool {
+	return path == root || strings.HasPrefix(path, root+"/")
+}
+
+// commonImportPath returns the longest import path that all of the paths are,
+// or are beneath, or the empty string if there is none.
+func commonImportPath(paths []string) string {
+	common := strings.Split(paths[0], "/")
+	for _, path := range paths[1:] {
+		elems := strings.Split(path, "/")
+		n := 0
+		for n < len(common) && n < len(elems) && common[n] == elems[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return strings.Join(common, "/")
+}
+
+// sameProperties reports whether the two ProjectProperties are the same.
+func sameProperties(a, b ProjectProperties) bool {
+	if a.Source != b.Source {
+		return false
+	}
+	if a.Constraint == nil || b.Constraint == nil {
+		return a.Constraint == nil && b.Constraint == nil
+	}
+	return a.Constraint.identical(b.Constraint)
+}
+
+// isWorkspaceMember reports whether pr is the import root of a member of the
+// workspace being solved for, if any.
+func (rd rootdata) isWorkspaceMember(pr ProjectRoot) bool {
+	for _, mem := range rd.ws {
+		if pr == ProjectRoot(mem.PackageTree.ImportRoot) {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceDeps returns the dependencies of each member of the workspace, with
+// the member as their depender, so that the constraints each member declares
+// are checked, and any conflict between them reported, as the member's own.
+// They take the place of the dependencies of the root project.
+//
+// A member's dependencies are the projects reached from its packages, through
+// those of any other members they import, and from its required packages.
+func (s *solver) workspaceDeps() ([]dependency, error) {
+	rm, _ := s.rd.rpt.ToReachMap(true, true, false, s.rd.ir)
+
+	var deps []dependency
+	for _, mem := range s.rd.ws {
+		root := ProjectRoot(mem.PackageTree.ImportRoot)
+		reached := make(map[string]bool)
+		for pkg := range mem.PackageTree.Packages {
+			for _, ip := range rm[pkg].External {
+				reached[ip] = true
+			}
+		}
+
+		pc := make(ProjectConstraints)
+		if mem.Manifest != nil {
+			for pr, pp := range mem.Manifest.DependencyConstraints() {
+				pc[pr] = pp
+			}
+			for pkg, required := range mem.Manifest.RequiredPackages() {
+				if required {
+					reached[pkg] = true
+				}
+			}
+		}
+		// Every member must depend on a project at the source that any of
+		// them declares for it, or the dependencies would conflict.
+		for pr, pp := range s.rd.rm.Deps {
+			if _, has := pc[pr]; !has && pp.Source != "" {
+				pc[pr] = ProjectProperties{Source: pp.Source, Constraint: Any()}
+			}
+		}
+
+		reach := make([]string, 0, len(reached))
+		for ip := range reached {
+			if !s.stdLibFn(ip) {
+				reach = append(reach, ip)
+			}
+		}
+		sort.Strings(reach)
+
+		cdeps, err := s.intersectConstraintsWithImports(s.relax(root, s.rd.overrideAll(pc)), reach)
+		if err != nil {
+			return nil, err
+		}
+		a := atom{id: ProjectIdentifier{ProjectRoot: root}, v: workspaceRev}
+		for _, cdep := range cdeps {
+			deps = append(deps, dependency{depender: a, dep: cdep})
+		}
+	}
+	return deps, nil
+}
+
+// unionPackages returns the sorted union of the two lists of packages.
+func unionPackages(a, b []string) []string {
+	set := make(map[string]bool, len(a)+len(b))
+	for _, pkg := range a {
+		set[pkg] = true
+	}
+	for _, pkg := range b {
+		set[pkg] = true
+	}
+	pl := make([]string, 0, len(set))
+	for pkg := range set {
+		pl = append(pl, pkg)
+	}
+	sort.Strings(pl)
+	return pl
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"io"
 	"sort"
+	"time"
 
 	"github.com/golang/dep/gps"
 	"github.com/golang/dep/gps/verify"
@@ -22,6 +23,24 @@ const LockName = "Gopkg.lock"
 type Lock struct {
 	SolveMeta SolveMeta
 	P         []gps.LockedProject
+	// Audit optionally records, per project, how and when its locked version
+	// was arrived at. It is nil unless auditing has been requested.
+	Audit map[gps.ProjectRoot]ProjectAudit
+	// Metadata records, per project, the metadata declared for it in the
+	// manifest when the lock was written. Projects without any are omitted.
+	Metadata map[gps.ProjectRoot]map[string]string
+}
+
+// ProjectAudit is the audit trail for a single locked project.
+type ProjectAudit struct {
+	// Selected is the reason the solver chose the locked version.
+	Selected gps.SelectionReason
+	// Changed is the time at which the locked version or revision last changed.
+	Changed time.Time
+	// Verified is the time at which the locked revision was last confirmed to
+	// exist upstream, with a tree matching the locked digest, or the zero time
+	// if it never has been. See VerifyUpstream.
+	Verified time.Time
 }
 
 // SolveMeta holds metadata about the solving process that created the lock that
@@ -32,6 +51,13 @@ type SolveMeta struct {
 	SolverName      string
 	SolverVersion   int
 	InputImports    []string
+	// ExternalImports are the root project's imports that were declared to
+	// be satisfied externally, and so were not solved for.
+	ExternalImports []string
+	// InputsDigest is a digest of the root project's imports and manifest at
+	// the time the lock was solved, as computed by Project.InputsDigest. It is
+	// empty unless recording it was requested.
+	InputsDigest string
 }
 
 type rawLock struct {
@@ -45,6 +71,8 @@ type solveMeta struct {
 	SolverName      string   `toml:"solver-name"`
 	SolverVersion   int      `toml:"solver-version"`
 	InputImports    []string `toml:"input-imports"`
+	ExternalImports []string `toml:"external-imports,omitempty"`
+	InputsDigest    string   `toml:"inputs-digest,omitempty"`
 }
 
 type rawLockedProject struct {
@@ -56,6 +84,11 @@ type rawLockedProject struct {
 	Packages  []string `toml:"packages"`
 	PruneOpts string   `toml:"pruneopts"`
 	Digest    string   `toml:"digest"`
+	Selected  string   `toml:"selected,omitempty"`
+	Changed   string   `toml:"changed,omitempty"`
+	Verified  string   `toml:"verified,omitempty"`
+
+	Metadata map[string]string `toml:"metadata,omitempty"`
 }
 
 func readLock(r io.Reader) (*Lock, error) {
@@ -84,52 +117,105 @@ func fromRawLock(raw rawLock) (*Lock, error) {
 	l.SolveMeta.SolverName = raw.SolveMeta.SolverName
 	l.SolveMeta.SolverVersion = raw.SolveMeta.SolverVersion
 	l.SolveMeta.InputImports = raw.SolveMeta.InputImports
+	l.SolveMeta.ExternalImports = raw.SolveMeta.ExternalImports
+	l.SolveMeta.InputsDigest = raw.SolveMeta.InputsDigest
 
 	for _, ld := range raw.Projects {
-		r := gps.Revision(ld.Revision)
+		vp, err := fromRawLockedProject(ld)
+		if err != nil {
+			return nil, err
+		}
+		l.P = append(l.P, vp)
 
-		var v gps.Version = r
-		if ld.Version != "" {
-			if ld.Branch != "" {
-				return nil, errors.Errorf("lock file specified both a branch (%s) and version (%s) for %s", ld.Branch, ld.Version, ld.Name)
+		if ld.Selected != "" || ld.Changed != "" || ld.Verified != "" {
+			var pa ProjectAudit
+			if ld.Selected != "" {
+				pa.Selected, err = gps.ParseSelectionReason(ld.Selected)
+				if err != nil {
+					return nil, errors.Wrapf(err, "in audit trail for %s", ld.Name)
+				}
+			}
+			if ld.Changed != "" {
+				pa.Changed, err = time.Parse(time.RFC3339, ld.Changed)
+				if err != nil {
+					return nil, errors.Wrapf(err, "in audit trail for %s", ld.Name)
+				}
+			}
+			if ld.Verified != "" {
+				pa.Verified, err = time.Parse(time.RFC3339, ld.Verified)
+				if err != nil {
+					return nil, errors.Wrapf(err, "in audit trail for %s", ld.Name)
+				}
 			}
-			v = gps.NewVersion(ld.Version).Pair(r)
-		} else if ld.Branch != "" {
-			v = gps.NewBranch(ld.Branch).Pair(r)
-		} else if r == "" {
-			return nil, errors.Errorf("lock file has entry for %s, but specifies no branch or version", ld.Name)
-		}
 
-		id := gps.ProjectIdentifier{
-			ProjectRoot: gps.ProjectRoot(ld.Name),
-			Source:      ld.Source,
+			if l.Audit == nil {
+				l.Audit = make(map[gps.ProjectRoot]ProjectAudit)
+			}
+			l.Audit[vp.Ident().ProjectRoot] = pa
 		}
 
-		var err error
-		vp := verify.VerifiableProject{
-			LockedProject: gps.NewLockedProject(id, v, ld.Packages),
-		}
-		if ld.Digest != "" {
-			vp.Digest, err = verify.ParseVersionedDigest(ld.Digest)
-			if err != nil {
-				return nil, err
+		if len(ld.Metadata) > 0 {
+			if l.Metadata == nil {
+				l.Metadata = make(map[gps.ProjectRoot]map[string]string)
 			}
+			l.Metadata[vp.Ident().ProjectRoot] = ld.Metadata
 		}
+	}
+
+	// Hand-edited locks may list their projects out of order.
+	sort.SliceStable(l.P, func(i, j int) bool {
+		return l.P[i].Ident().Less(l.P[j].Ident())
+	})
 
-		po, err := gps.ParsePruneOptions(ld.PruneOpts)
+	return l, nil
+}
+
+// fromRawLockedProject converts a project stanza, as read from a lock or from
+// vendor metadata, into a VerifiableProject.
+func fromRawLockedProject(ld rawLockedProject) (verify.VerifiableProject, error) {
+	r := gps.Revision(ld.Revision)
+
+	var v gps.Version = r
+	if ld.Version != "" {
+		if ld.Branch != "" {
+			return verify.VerifiableProject{}, errors.Errorf("lock file specified both a branch (%s) and version (%s) for %s", ld.Branch, ld.Version, ld.Name)
+		}
+		v = gps.NewVersion(ld.Version).Pair(r)
+	} else if ld.Branch != "" {
+		v = gps.NewBranch(ld.Branch).Pair(r)
+	} else if r == "" {
+		return verify.VerifiableProject{}, errors.Errorf("lock file has entry for %s, but specifies no branch or version", ld.Name)
+	}
+
+	id := gps.ProjectIdentifier{
+		ProjectRoot: gps.ProjectRoot(ld.Name),
+		Source:      ld.Source,
+	}
+
+	var err error
+	vp := verify.VerifiableProject{
+		LockedProject: gps.NewLockedProject(id, v, ld.Packages),
+	}
+	if ld.Digest != "" {
+		vp.Digest, err = verify.ParseVersionedDigest(ld.Digest)
 		if err != nil {
-			return nil, errors.Errorf("%s in prune options for %s", err.Error(), ld.Name)
+			return verify.VerifiableProject{}, err
 		}
-		// Add the vendor pruning bit so that gps doesn't get confused
-		vp.PruneOpts = po | gps.PruneNestedVendorDirs
+	}
 
-		l.P = append(l.P, vp)
+	po, err := gps.ParsePruneOptions(ld.PruneOpts)
+	if err != nil {
+		return verify.VerifiableProject{}, errors.Errorf("%s in prune options for %s", err.Error(), ld.Name)
 	}
+	// Add the vendor pruning bit so that gps doesn't get confused
+	vp.PruneOpts = po | gps.PruneNestedVendorDirs
 
-	return l, nil
+	return vp, nil
 }
 
-// Projects returns the list of LockedProjects contained in the lock data.
+// Projects returns the list of LockedProjects contained in the lock data. Locks
+// read from Gopkg.lock, or made with LockFromSolution, list them sorted by
+// project identifier.
 func (l *Lock) Projects() []gps.LockedProject {
 	if l == nil || l == (*Lock)(nil) {
 		return nil
@@ -168,8 +254,17 @@ func (l *Lock) dup() *Lock {
 
 	l2.SolveMeta.InputImports = make([]string, len(l.SolveMeta.InputImports))
 	copy(l2.SolveMeta.InputImports, l.SolveMeta.InputImports)
+	l2.SolveMeta.ExternalImports = append([]string(nil), l.SolveMeta.ExternalImports...)
 	copy(l2.P, l.P)
 
+	if l.Audit != nil {
+		l2.Audit = make(map[gps.ProjectRoot]ProjectAudit, len(l.Audit))
+		for pr, pa := range l.Audit {
+			l2.Audit[pr] = pa
+		}
+	}
+	l2.Metadata = copyMetadata(l.Metadata)
+
 	return l2
 }
 
@@ -180,6 +275,8 @@ func (l *Lock) toRaw() rawLock {
 			AnalyzerName:    l.SolveMeta.AnalyzerName,
 			AnalyzerVersion: l.SolveMeta.AnalyzerVersion,
 			InputImports:    l.SolveMeta.InputImports,
+			ExternalImports: l.SolveMeta.ExternalImports,
+			InputsDigest:    l.SolveMeta.InputsDigest,
 			SolverName:      l.SolveMeta.SolverName,
 			SolverVersion:   l.SolveMeta.SolverVersion,
 		},
@@ -192,22 +289,18 @@ func (l *Lock) toRaw() rawLock {
 
 	for _, lp := range l.P {
 		id := lp.Ident()
-		ld := rawLockedProject{
-			Name:     string(id.ProjectRoot),
-			Source:   id.Source,
-			Packages: lp.Packages(),
-		}
+		ld := toRawLockedProject(lp)
 
-		v := lp.Version()
-		ld.Revision, ld.Branch, ld.Version = gps.VersionComponentStrings(v)
-
-		// This will panic if the lock isn't the expected dynamic type. We can
-		// relax this later if it turns out to create real problems, but there's
-		// no intended case in which this is untrue, so it's preferable to start
-		// by failing hard if those expectations aren't met.
-		vp := lp.(verify.VerifiableProject)
-		ld.Digest = vp.Digest.String()
-		ld.PruneOpts = (vp.PruneOpts & ^gps.PruneNestedVendorDirs).String()
+		if pa, has := l.Audit[id.ProjectRoot]; has {
+			ld.Selected = pa.Selected.String()
+			if !pa.Changed.IsZero() {
+				ld.Changed = pa.Changed.UTC().Format(time.RFC3339)
+			}
+			if !pa.Verified.IsZero() {
+				ld.Verified = pa.Verified.UTC().Format(time.RFC3339)
+			}
+		}
+		ld.Metadata = l.Metadata[id.ProjectRoot]
 
 		raw.Projects = append(raw.Projects, ld)
 	}
@@ -215,6 +308,30 @@ func (l *Lock) toRaw() rawLock {
 	return raw
 }
 
+// toRawLockedProject converts a locked project into a project stanza, as
+// written to a lock or to vendor metadata.
+func toRawLockedProject(lp gps.LockedProject) rawLockedProject {
+	id := lp.Ident()
+	ld := rawLockedProject{
+		Name:     string(id.ProjectRoot),
+		Source:   id.Source,
+		Packages: lp.Packages(),
+	}
+
+	v := lp.Version()
+	ld.Revision, ld.Branch, ld.Version = gps.VersionComponentStrings(v)
+
+	// This will panic if the lock isn't the expected dynamic type. We can
+	// relax this later if it turns out to create real problems, but there's
+	// no intended case in which this is untrue, so it's preferable to start
+	// by failing hard if those expectations aren't met.
+	vp := lp.(verify.VerifiableProject)
+	ld.Digest = vp.Digest.String()
+	ld.PruneOpts = (vp.PruneOpts & ^gps.PruneNestedVendorDirs).String()
+
+	return ld
+}
+
 // MarshalTOML serializes this lock into TOML via an intermediate raw form.
 func (l *Lock) MarshalTOML() ([]byte, error) {
 	raw := l.toRaw()
@@ -238,6 +355,7 @@ func LockFromSolution(in gps.Solution, prune gps.CascadingPruneOptions) *Lock {
 			AnalyzerName:    in.AnalyzerName(),
 			AnalyzerVersion: in.AnalyzerVersion(),
 			InputImports:    in.InputImports(),
+			ExternalImports: in.ExternalImports(),
 			SolverName:      in.SolverName(),
 			SolverVersion:   in.SolverVersion(),
 		},
@@ -254,6 +372,72 @@ func LockFromSolution(in gps.Solution, prune gps.CascadingPruneOptions) *Lock {
 			})
 		}
 	}
+	l.Metadata = copyMetadata(in.Metadata())
 
 	return l
 }
+
+// recordMetadata sets the metadata of each project in l to that declared for
+// it in m, so that changes to the manifest's metadata are reflected in the
+// lock without solving again.
+func (l *Lock) recordMetadata(m *Manifest) {
+	md := make(map[gps.ProjectRoot]map[string]string)
+	for _, lp := range l.P {
+		pr := lp.Ident().ProjectRoot
+		if len(m.Metadata[pr]) > 0 {
+			md[pr] = m.Metadata[pr]
+		}
+	}
+	l.Metadata = copyMetadata(md)
+}
+
+// copyMetadata returns a deep copy of md, or nil if it is empty.
+func copyMetadata(md map[gps.ProjectRoot]map[string]string) map[gps.ProjectRoot]map[string]string {
+	if len(md) == 0 {
+		return nil
+	}
+	md2 := make(map[gps.ProjectRoot]map[string]string, len(md))
+	for pr, kv := range md {
+		kv2 := make(map[string]string, len(kv))
+		for k, v := range kv {
+			kv2[k] = v
+		}
+		md2[pr] = kv2
+	}
+	return md2
+}
+
+// RecordAudit populates the audit trail of l from the selection reasons in the
+// solution that produced it. The change and verification times of each project
+// are carried over from prev if the project's version and revision are
+// unchanged there; otherwise, the change time is set to now, and the project
+// is treated as never having been verified.
+//
+// prev may be nil, in which case every project is treated as having changed.
+func (l *Lock) RecordAudit(in gps.Solution, prev *Lock, now time.Time) {
+	reasons := in.SelectionReasons()
+	prevlps := make(map[gps.ProjectRoot]gps.LockedProject)
+	for _, lp := range prev.Projects() {
+		prevlps[lp.Ident().ProjectRoot] = lp
+	}
+
+	l.Audit = make(map[gps.ProjectRoot]ProjectAudit, len(l.P))
+	for _, lp := range l.P {
+		pr := lp.Ident().ProjectRoot
+		pa := ProjectAudit{
+			Selected: reasons[pr],
+			Changed:  now,
+		}
+
+		if plp, has := prevlps[pr]; has && plp.Version() == lp.Version() && plp.Ident() == lp.Ident() {
+			if ppa, has := prev.Audit[pr]; has {
+				if !ppa.Changed.IsZero() {
+					pa.Changed = ppa.Changed
+				}
+				pa.Verified = ppa.Verified
+			}
+		}
+
+		l.Audit[pr] = pa
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/verify"
+	"github.com/pkg/errors"
+)
+
+// LockSnapshot is a lock as it stood at some point in a project's history.
+type LockSnapshot struct {
+	// Time is when the lock took this form.
+	Time time.Time
+	// Revision is the commit in which the lock took this form, if the
+	// snapshot was read from version control.
+	Revision string
+	Lock     *Lock
+}
+
+// LockHistory reads the history of the lock file of the project rooted at dir
+// from the git repository that contains it, oldest first. If limit is
+// positive, only that many of the most recent versions of the lock are read.
+func LockHistory(ctx context.Context, dir string, limit int) ([]LockSnapshot, error) {
+	args := []string{"log", "--format=%H %ct", "--diff-filter=ACMRT"}
+	if limit > 0 {
+		args = append(args, "-n", strconv.Itoa(limit))
+	}
+	out, err := runGit(ctx, dir, append(args, "--", LockName)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []LockSnapshot
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		secs, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("unexpected git log output: %q", line)
+		}
+
+		data, err := runGit(ctx, dir, "show", fields[0]+":./"+LockName)
+		if err != nil {
+			return nil, err
+		}
+		l, err := readLock(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read %s as of %s", LockName, fields[0])
+		}
+		snaps = append(snaps, LockSnapshot{
+			Time:     time.Unix(secs, 0),
+			Revision: fields[0],
+			Lock:     l,
+		})
+	}
+
+	// git log lists the most recent commit first.
+	for i, j := 0, len(snaps)-1; i < j; i, j = i+1, j-1 {
+		snaps[i], snaps[j] = snaps[j], snaps[i]
+	}
+	return snaps, nil
+}
+
+// runGit runs git in dir, returning its standard output.
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// DependencyChurn summarizes how often a dependency's locked version changed
+// over a series of lock snapshots, to help decide which dependencies to
+// constrain more tightly, or replace.
+type DependencyChurn struct {
+	Project gps.ProjectRoot
+	// Present is the number of snapshots in which the project was locked.
+	Present int
+	// Moves is the number of times the project's locked version or revision
+	// changed from one snapshot to the next. Upgrades, Downgrades and
+	// Switches count the moves classified as such; the rest changed only the
+	// revision.
+	Moves      int
+	Upgrades   int
+	Downgrades int
+	Switches   int
+	// Conflicts estimates how often the project was in conflict with the
+	// rest of the depgraph, as the number of moves that were downgrades, or
+	// after which the lock's audit trail reports that its version was chosen
+	// by an override or a policy pin. Either suggests that the version it
+	// would otherwise have had was not acceptable.
+	Conflicts int
+	// LastMoved is the time of the snapshot in which the project last moved,
+	// or the zero time if it never did.
+	LastMoved time.Time
+	// Stability ranges from 1, for a project that never moved, to 0, for one
+	// that moved, and conflicted, between every pair of consecutive snapshots
+	// in which it was locked.
+	Stability float64
+}
+
+// AnalyzeChurn computes the churn of every project locked in any of the
+// snapshots, which need not be in order. The results are sorted from least to
+// most stable, then by project root.
+func AnalyzeChurn(snaps []LockSnapshot) []DependencyChurn {
+	snaps = append([]LockSnapshot(nil), snaps...)
+	sort.SliceStable(snaps, func(i, j int) bool { return snaps[i].Time.Before(snaps[j].Time) })
+
+	churn := make(map[gps.ProjectRoot]*DependencyChurn)
+	// The number of consecutive pairs of snapshots in which each project was
+	// locked in both, and so could have moved.
+	pairs := make(map[gps.ProjectRoot]int)
+
+	var prev *Lock
+	for _, snap := range snaps {
+		for _, lp := range snap.Lock.Projects() {
+			pr := lp.Ident().ProjectRoot
+			if churn[pr] == nil {
+				churn[pr] = &DependencyChurn{Project: pr}
+			}
+			churn[pr].Present++
+		}
+		if prev == nil {
+			prev = snap.Lock
+			continue
+		}
+
+		for pr, lpd := range verify.DiffLocks(prev, snap.Lock).ProjectDeltas {
+			vc := lpd.VersionChange()
+			if vc == verify.VersionAdded || vc == verify.VersionRemoved {
+				continue
+			}
+			pairs[pr]++
+
+			dc := churn[pr]
+			switch vc {
+			case verify.VersionUnchanged:
+				continue
+			case verify.VersionUpgraded:
+				dc.Upgrades++
+			case verify.VersionDowngraded:
+				dc.Downgrades++
+			case verify.VersionSwitched:
+				dc.Switches++
+			}
+			dc.Moves++
+			dc.LastMoved = snap.Time
+
+			switch snap.Lock.Audit[pr].Selected {
+			case gps.SelectedByOverride, gps.SelectedByPolicyPin:
+				dc.Conflicts++
+			default:
+				if vc == verify.VersionDowngraded {
+					dc.Conflicts++
+				}
+			}
+		}
+		prev = snap.Lock
+	}
+
+	out := make([]DependencyChurn, 0, len(churn))
+	for pr, dc := range churn {
+		dc.Stability = 1
+		if n := pairs[pr]; n > 0 {
+			dc.Stability = float64(2*n-dc.Moves-dc.Conflicts) / float64(2*n)
+		}
+		out = append(out, *dc)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Stability != out[j].Stability {
+			return out[i].Stability < out[j].Stability
+		}
+		return out[i].Project < out[j].Project
+	})
+	return out
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/verify"
+	"github.com/golang/dep/internal/test"
+)
+
+// mkChurnLock returns a lock of the projects, given as alternating project
+// roots and versions, each paired with a revision derived from its version.
+func mkChurnLock(pvs ...string) *Lock {
+	l := &Lock{}
+	for i := 0; i < len(pvs); i += 2 {
+		rev := gps.Revision(pvs[i+1] + "-rev")
+		l.P = append(l.P, verify.VerifiableProject{
+			LockedProject: gps.NewLockedProject(
+				gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pvs[i])},
+				gps.NewVersion(pvs[i+1]).Pair(rev),
+				[]string{"."},
+			),
+		})
+	}
+	return l
+}
+
+func TestAnalyzeChurn(t *testing.T) {
+	t0 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return t0.AddDate(0, 0, n) }
+
+	overridden := mkChurnLock("a", "v1.2.0", "b", "v1.0.0", "c", "v2.0.0")
+	overridden.Audit = map[gps.ProjectRoot]ProjectAudit{
+		"c": {Selected: gps.SelectedByOverride},
+	}
+	// Out of order, to check that the snapshots are sorted.
+	snaps := []LockSnapshot{
+		{Time: day(3), Lock: overridden},
+		{Time: day(0), Lock: mkChurnLock("a", "v1.0.0", "b", "v1.0.0")},
+		{Time: day(1), Lock: mkChurnLock("a", "v1.1.0", "b", "v1.0.0", "c", "v1.0.0")},
+		{Time: day(2), Lock: mkChurnLock("a", "v1.0.1", "b", "v1.0.0", "c", "v1.0.0")},
+	}
+
+	want := []DependencyChurn{
+		{Project: "a", Present: 4, Moves: 3, Upgrades: 2, Downgrades: 1, Conflicts: 1, LastMoved: day(3), Stability: 2.0 / 6},
+		{Project: "c", Present: 3, Moves: 1, Upgrades: 1, Conflicts: 1, LastMoved: day(3), Stability: 2.0 / 4},
+		{Project: "b", Present: 4, Stability: 1},
+	}
+	if got := AnalyzeChurn(snaps); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected churn:\n\t(GOT): %+v\n\t(WNT): %+v", got, want)
+	}
+}
+
+func TestLockHistory(t *testing.T) {
+	test.NeedsGit(t)
+
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempDir("repo")
+	repo := h.Path("repo")
+	h.RunGit(repo, "init")
+	h.RunGit(repo, "config", "--local", "user.email", "test@example.com")
+	h.RunGit(repo, "config", "--local", "user.name", "Test author")
+
+	for _, l := range []*Lock{
+		mkChurnLock("a", "v1.0.0"),
+		mkChurnLock("a", "v1.1.0", "b", "v1.0.0"),
+	} {
+		data, err := l.MarshalTOML()
+		h.Must(err)
+		h.TempFile("repo/"+LockName, string(data))
+		h.RunGit(repo, "add", LockName)
+		h.RunGit(repo, "commit", "--message=update lock")
+	}
+	// Commits that do not touch the lock are not in its history.
+	h.RunGit(repo, "commit", "--allow-empty", "--message=unrelated")
+
+	snaps, err := LockHistory(context.Background(), repo, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 {
+		t.Fatalf("expected 2 versions of the lock, got %d", len(snaps))
+	}
+	if n := len(snaps[0].Lock.Projects()); n != 1 {
+		t.Errorf("expected the oldest lock to have 1 project, got %d", n)
+	}
+	if n := len(snaps[1].Lock.Projects()); n != 2 {
+		t.Errorf("expected the newest lock to have 2 projects, got %d", n)
+	}
+	if snaps[0].Revision == "" || snaps[0].Revision == snaps[1].Revision {
+		t.Errorf("expected each snapshot to have its own revision, got %q and %q", snaps[0].Revision, snaps[1].Revision)
+	}
+
+	snaps, err = LockHistory(context.Background(), repo, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 1 || len(snaps[0].Lock.Projects()) != 2 {
+		t.Errorf("expected only the newest lock with a limit of 1, got %v", snaps)
+	}
+}
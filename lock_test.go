@@ -5,9 +5,11 @@
 package dep
 
 import (
+	"bytes"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/dep/gps"
 	"github.com/golang/dep/gps/verify"
@@ -164,6 +166,7 @@ func TestReadLockErrors(t *testing.T) {
 		{"specified both", "lock/error0.toml"},
 		{"odd length", "lock/error1.toml"},
 		{"no branch or version", "lock/error2.toml"},
+		{"unknown selection reason", "lock/error3.toml"},
 	}
 
 	for _, tst := range tests {
@@ -177,3 +180,245 @@ func TestReadLockErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestLockAuditRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	golden := "lock/golden2.toml"
+	want := h.GetTestFileString(golden)
+	l := &Lock{
+		P: []gps.LockedProject{
+			verify.VerifiableProject{
+				LockedProject: gps.NewLockedProject(
+					gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot("github.com/golang/dep")},
+					gps.NewVersion("0.12.2").Pair(gps.Revision("d05d5aca9f895d19e9265839bffeadd74a2d2ecb")),
+					[]string{"."},
+				),
+				PruneOpts: gps.PruneOptions(15),
+				Digest: verify.VersionedDigest{
+					HashVersion: verify.HashVersion,
+					Digest:      []byte("foo"),
+				},
+			},
+		},
+		Audit: map[gps.ProjectRoot]ProjectAudit{
+			"github.com/golang/dep": {
+				Selected: gps.SelectedByOverride,
+				Changed:  time.Date(2018, 6, 1, 12, 30, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	got, err := l.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid lock to TOML: %q", err)
+	}
+
+	if string(got) != want {
+		if *test.UpdateGolden {
+			if err = h.WriteTestFile(golden, string(got)); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			t.Errorf("Valid lock did not marshal to TOML as expected:\n\t(GOT): %s\n\t(WNT): %s", string(got), want)
+		}
+	}
+
+	gf := h.GetTestFile(golden)
+	defer gf.Close()
+	rl, err := readLock(gf)
+	if err != nil {
+		t.Fatalf("Should have read Lock correctly, but got err %q", err)
+	}
+
+	if !reflect.DeepEqual(rl.Audit, l.Audit) {
+		t.Errorf("Audit trail did not survive a round trip:\n\t(GOT): %v\n\t(WNT): %v", rl.Audit, l.Audit)
+	}
+}
+
+func TestLockExternalImportsRoundTrip(t *testing.T) {
+	l := &Lock{
+		SolveMeta: SolveMeta{
+			InputImports:    []string{"github.com/golang/dep"},
+			ExternalImports: []string{"example.com/gen/proto"},
+		},
+	}
+
+	got, err := l.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid lock to TOML: %q", err)
+	}
+	if !bytes.Contains(got, []byte("external-imports")) {
+		t.Errorf("expected external imports to be written to the lock:\n%s", got)
+	}
+
+	rl, err := readLock(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("Should have read Lock correctly, but got err %q", err)
+	}
+	if !reflect.DeepEqual(rl.SolveMeta.ExternalImports, l.SolveMeta.ExternalImports) {
+		t.Errorf("External imports did not survive a round trip:\n\t(GOT): %v\n\t(WNT): %v", rl.SolveMeta.ExternalImports, l.SolveMeta.ExternalImports)
+	}
+}
+
+func TestLockInputsDigestRoundTrip(t *testing.T) {
+	l := &Lock{
+		SolveMeta: SolveMeta{
+			InputImports: []string{"github.com/golang/dep"},
+			InputsDigest: "2a3e3c4d",
+		},
+	}
+
+	got, err := l.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid lock to TOML: %q", err)
+	}
+	rl, err := readLock(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("Should have read Lock correctly, but got err %q", err)
+	}
+	if rl.SolveMeta.InputsDigest != l.SolveMeta.InputsDigest {
+		t.Errorf("Inputs digest did not survive a round trip:\n\t(GOT): %v\n\t(WNT): %v", rl.SolveMeta.InputsDigest, l.SolveMeta.InputsDigest)
+	}
+
+	l.SolveMeta.InputsDigest = ""
+	if got, _ = l.MarshalTOML(); bytes.Contains(got, []byte("inputs-digest")) {
+		t.Errorf("expected no inputs digest to be written to the lock:\n%s", got)
+	}
+}
+
+func TestLockMetadataRoundTrip(t *testing.T) {
+	l := &Lock{
+		P: []gps.LockedProject{
+			verify.VerifiableProject{
+				LockedProject: gps.NewLockedProject(
+					gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot("github.com/golang/dep")},
+					gps.NewVersion("0.12.2").Pair(gps.Revision("d05d5aca9f895d19e9265839bffeadd74a2d2ecb")),
+					[]string{"."},
+				),
+			},
+		},
+		Metadata: map[gps.ProjectRoot]map[string]string{
+			"github.com/golang/dep": {"owner": "tools-team", "ticket": "https://example.com/T-1"},
+		},
+	}
+
+	got, err := l.MarshalTOML()
+	if err != nil {
+		t.Fatalf("Error while marshaling valid lock to TOML: %q", err)
+	}
+	rl, err := readLock(bytes.NewReader(got))
+	if err != nil {
+		t.Fatalf("Should have read Lock correctly, but got err %q", err)
+	}
+	if !reflect.DeepEqual(rl.Metadata, l.Metadata) {
+		t.Errorf("Metadata did not survive a round trip:\n\t(GOT): %v\n\t(WNT): %v\n%s", rl.Metadata, l.Metadata, got)
+	}
+
+	// Metadata is refreshed from the manifest, and dropped for projects whose
+	// constraints no longer declare any.
+	m := NewManifest()
+	m.Metadata = map[gps.ProjectRoot]map[string]string{
+		"github.com/golang/dep":   {"owner": "build-team"},
+		"github.com/golang/other": {"owner": "nobody"},
+	}
+	rl.recordMetadata(m)
+	want := map[gps.ProjectRoot]map[string]string{
+		"github.com/golang/dep": {"owner": "build-team"},
+	}
+	if !reflect.DeepEqual(rl.Metadata, want) {
+		t.Errorf("unexpected metadata recorded from the manifest:\n\t(GOT): %v\n\t(WNT): %v", rl.Metadata, want)
+	}
+	rl.recordMetadata(NewManifest())
+	if got, _ = rl.MarshalTOML(); bytes.Contains(got, []byte("metadata")) {
+		t.Errorf("expected no metadata to be written to the lock:\n%s", got)
+	}
+}
+
+type auditSolution struct {
+	gps.Solution
+	reasons map[gps.ProjectRoot]gps.SelectionReason
+}
+
+func (s auditSolution) SelectionReasons() map[gps.ProjectRoot]gps.SelectionReason {
+	return s.reasons
+}
+
+func TestLockRecordAudit(t *testing.T) {
+	mkvp := func(pr string, v gps.Version) gps.LockedProject {
+		return verify.VerifiableProject{
+			LockedProject: gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pr)}, v, []string{"."}),
+		}
+	}
+
+	then := time.Date(2018, 6, 1, 12, 30, 0, 0, time.UTC)
+	now := then.Add(48 * time.Hour)
+
+	prev := &Lock{
+		P: []gps.LockedProject{
+			mkvp("github.com/a/same", gps.NewVersion("v1.0.0").Pair("rev1")),
+			mkvp("github.com/a/bumped", gps.NewVersion("v1.0.0").Pair("rev2")),
+			mkvp("github.com/a/unaudited", gps.NewVersion("v1.0.0").Pair("rev3")),
+		},
+		Audit: map[gps.ProjectRoot]ProjectAudit{
+			"github.com/a/same":   {Selected: gps.SelectedByConstraint, Changed: then},
+			"github.com/a/bumped": {Selected: gps.SelectedByConstraint, Changed: then},
+		},
+	}
+
+	l := &Lock{
+		P: []gps.LockedProject{
+			mkvp("github.com/a/same", gps.NewVersion("v1.0.0").Pair("rev1")),
+			mkvp("github.com/a/bumped", gps.NewVersion("v1.1.0").Pair("rev4")),
+			mkvp("github.com/a/unaudited", gps.NewVersion("v1.0.0").Pair("rev3")),
+			mkvp("github.com/a/new", gps.NewBranch("master").Pair("rev5")),
+		},
+	}
+
+	l.RecordAudit(auditSolution{
+		reasons: map[gps.ProjectRoot]gps.SelectionReason{
+			"github.com/a/same":      gps.SelectedFromLock,
+			"github.com/a/bumped":    gps.SelectedByOverride,
+			"github.com/a/unaudited": gps.SelectedFromLock,
+		},
+	}, prev, now)
+
+	want := map[gps.ProjectRoot]ProjectAudit{
+		"github.com/a/same":      {Selected: gps.SelectedFromLock, Changed: then},
+		"github.com/a/bumped":    {Selected: gps.SelectedByOverride, Changed: now},
+		"github.com/a/unaudited": {Selected: gps.SelectedFromLock, Changed: now},
+		"github.com/a/new":       {Selected: gps.SelectedByConstraint, Changed: now},
+	}
+
+	if !reflect.DeepEqual(l.Audit, want) {
+		t.Errorf("Unexpected audit trail:\n\t(GOT): %v\n\t(WNT): %v", l.Audit, want)
+	}
+
+	// Without a previous lock, everything is new.
+	l.RecordAudit(auditSolution{}, nil, now)
+	for pr, pa := range l.Audit {
+		if !pa.Changed.Equal(now) {
+			t.Errorf("expected %s to be marked as changed at %s without a previous lock, got %s", pr, now, pa.Changed)
+		}
+	}
+}
+
+func TestReadLockSortsProjects(t *testing.T) {
+	rl, err := readLock(strings.NewReader(`
+[[projects]]
+  name = "github.com/sdboyer/deptestdos"
+  revision = "5c607206be5decd28e6263ffffdcee067266015e"
+
+[[projects]]
+  name = "github.com/sdboyer/deptest"
+  revision = "ff2948a2ac8f538c4ecd55962e919d1e13e74baf"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lps := rl.Projects()
+	if len(lps) != 2 || lps[0].Ident().ProjectRoot != "github.com/sdboyer/deptest" || lps[1].Ident().ProjectRoot != "github.com/sdboyer/deptestdos" {
+		t.Errorf("expected the lock's projects to be sorted, got %v", lps)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/verify"
+	"github.com/pkg/errors"
+)
+
+// DueForVerification returns the roots of the projects in the lock that have
+// not been verified upstream within window of now, including those that never
+// have been, in sorted order. Passing a few of them at a time to VerifyUpstream
+// spreads the work of keeping a large lock verified, without solving.
+func (l *Lock) DueForVerification(window time.Duration, now time.Time) []gps.ProjectRoot {
+	var due []gps.ProjectRoot
+	for _, lp := range l.Projects() {
+		pr := lp.Ident().ProjectRoot
+		if v := l.Audit[pr].Verified; v.IsZero() || now.Sub(v) > window {
+			due = append(due, pr)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i] < due[j] })
+	return due
+}
+
+// VerifyUpstream confirms, for each of the named projects in the lock, that
+// its locked revision still exists in its upstream source, and that its tree
+// at that revision, pruned as the lock says, still hashes to the locked digest.
+// The time of each successful verification is recorded as now in the lock's
+// audit trail, which is created if need be.
+//
+// The projects that could not be verified are returned along with the reason,
+// and their verification times are left as they were. Projects that are not
+// in the lock are reported in the same way.
+func (l *Lock) VerifyUpstream(ctx context.Context, sm gps.SourceManager, prs []gps.ProjectRoot, now time.Time) (map[gps.ProjectRoot]error, error) {
+	lps := make(map[gps.ProjectRoot]gps.LockedProject, len(l.P))
+	for _, lp := range l.P {
+		lps[lp.Ident().ProjectRoot] = lp
+	}
+
+	failed := make(map[gps.ProjectRoot]error)
+	for _, pr := range prs {
+		if err := ctx.Err(); err != nil {
+			return failed, err
+		}
+
+		lp, has := lps[pr]
+		if !has {
+			failed[pr] = errors.Errorf("%s is not in the lock", pr)
+			continue
+		}
+		if err := verifyUpstream(ctx, sm, lp); err != nil {
+			failed[pr] = err
+			continue
+		}
+
+		if l.Audit == nil {
+			l.Audit = make(map[gps.ProjectRoot]ProjectAudit)
+		}
+		pa := l.Audit[pr]
+		pa.Verified = now
+		l.Audit[pr] = pa
+	}
+	return failed, nil
+}
+
+// verifyUpstream fetches the upstream source of the locked project, and
+// ensures that the locked revision is present in it, with a tree matching the
+// locked digest.
+func verifyUpstream(ctx context.Context, sm gps.SourceManager, lp gps.LockedProject) error {
+	vp, ok := lp.(verify.VerifiableProject)
+	if !ok || vp.Digest.IsEmpty() {
+		return errors.New("no digest is locked to verify against")
+	}
+
+	var rev gps.Revision
+	switch v := lp.Version().(type) {
+	case gps.PairedVersion:
+		rev = v.Revision()
+	case gps.Revision:
+		rev = v
+	}
+	if rev == "" {
+		return errors.New("no revision is locked to verify")
+	}
+
+	id := lp.Ident()
+	if err := sm.SyncSourceFor(id); err != nil {
+		return errors.Wrap(err, "failed to fetch from upstream")
+	}
+	present, err := sm.RevisionPresentIn(id, rev)
+	if err != nil {
+		return errors.Wrapf(err, "failed to look up revision %s", rev)
+	}
+	if !present {
+		return errors.Errorf("revision %s no longer exists upstream", rev)
+	}
+
+	td, err := ioutil.TempDir("", "dep-verify")
+	if err != nil {
+		return errors.Wrap(err, "failed to create a temporary directory")
+	}
+	defer os.RemoveAll(td)
+
+	if err = sm.ExportPrunedProject(ctx, lp, vp.PruneOpts, td); err != nil {
+		return errors.Wrapf(err, "failed to export revision %s", rev)
+	}
+	digest, err := verify.DigestFromDirectoryWithAlgorithm(td, verify.DigestAlgorithm(vp.Digest.HashVersion))
+	if err != nil {
+		return errors.Wrapf(err, "failed to hash revision %s", rev)
+	}
+	if !bytes.Equal(digest.Digest, vp.Digest.Digest) {
+		return errors.Errorf("the tree at revision %s hashes to %s, not the locked %s", rev, digest, vp.Digest)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/verify"
+)
+
+// verifySourceManager serves projects whose revisions hold a single file with
+// the given contents.
+type verifySourceManager struct {
+	gps.SourceManager
+	trees map[gps.Revision]string
+}
+
+func (sm verifySourceManager) SyncSourceFor(gps.ProjectIdentifier) error {
+	return nil
+}
+
+func (sm verifySourceManager) RevisionPresentIn(_ gps.ProjectIdentifier, r gps.Revision) (bool, error) {
+	_, has := sm.trees[r]
+	return has, nil
+}
+
+func (sm verifySourceManager) ExportPrunedProject(_ context.Context, lp gps.LockedProject, _ gps.PruneOptions, to string) error {
+	r := lp.Version().(gps.PairedVersion).Revision()
+	return ioutil.WriteFile(filepath.Join(to, "main.go"), []byte(sm.trees[r]), 0644)
+}
+
+func TestLockVerifyUpstream(t *testing.T) {
+	td, err := ioutil.TempDir("", "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(td)
+	if err = ioutil.WriteFile(filepath.Join(td, "main.go"), []byte("package a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := verify.DigestFromDirectory(td)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mkvp := func(pr string, rev gps.Revision, digest verify.VersionedDigest) gps.LockedProject {
+		return verify.VerifiableProject{
+			LockedProject: gps.NewLockedProject(gps.ProjectIdentifier{ProjectRoot: gps.ProjectRoot(pr)}, gps.NewVersion("v1.0.0").Pair(rev), []string{"."}),
+			Digest:        digest,
+		}
+	}
+
+	then := time.Date(2018, 6, 1, 12, 30, 0, 0, time.UTC)
+	now := then.Add(30 * 24 * time.Hour)
+	l := &Lock{
+		P: []gps.LockedProject{
+			mkvp("github.com/a/changed", "rev2", digest),
+			mkvp("github.com/a/fresh", "rev1", digest),
+			mkvp("github.com/a/gone", "rev3", digest),
+			mkvp("github.com/a/nodigest", "rev1", verify.VersionedDigest{}),
+			mkvp("github.com/a/stale", "rev1", digest),
+		},
+		Audit: map[gps.ProjectRoot]ProjectAudit{
+			"github.com/a/fresh": {Selected: gps.SelectedFromLock, Verified: now.Add(-time.Hour)},
+			"github.com/a/stale": {Selected: gps.SelectedFromLock, Changed: then, Verified: then},
+		},
+	}
+
+	due := l.DueForVerification(7*24*time.Hour, now)
+	want := []gps.ProjectRoot{"github.com/a/changed", "github.com/a/gone", "github.com/a/nodigest", "github.com/a/stale"}
+	if !reflect.DeepEqual(due, want) {
+		t.Errorf("unexpected projects due for verification:\n\t(GOT): %v\n\t(WNT): %v", due, want)
+	}
+
+	sm := verifySourceManager{trees: map[gps.Revision]string{
+		"rev1": "package a",
+		"rev2": "package b",
+	}}
+	failed, err := l.VerifyUpstream(context.Background(), sm, append(due, "github.com/a/missing"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pr, reason := range map[gps.ProjectRoot]string{
+		"github.com/a/changed":  "hashes to",
+		"github.com/a/gone":     "no longer exists",
+		"github.com/a/nodigest": "no digest",
+		"github.com/a/missing":  "not in the lock",
+	} {
+		if err := failed[pr]; err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("expected %s to fail verification with %q, got %v", pr, reason, err)
+		}
+	}
+	if len(failed) != 4 {
+		t.Errorf("expected only four projects to fail verification, got %v", failed)
+	}
+
+	if pa := l.Audit["github.com/a/stale"]; !pa.Verified.Equal(now) || !pa.Changed.Equal(then) {
+		t.Errorf("expected only the verification time to be updated, got %+v", pa)
+	}
+	if _, has := l.Audit["github.com/a/changed"]; has {
+		t.Error("expected no verification to be recorded for a project that failed it")
+	}
+	if due := l.DueForVerification(7*24*time.Hour, now); len(due) != 3 {
+		t.Errorf("expected the failures to remain due for verification, got %v", due)
+	}
+
+	// Verification times survive being written out, and a solve that keeps
+	// the locked version.
+	raw, err := l.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rl, err := readLock(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rl.Audit, l.Audit) {
+		t.Errorf("audit trail did not survive a round trip:\n\t(GOT): %v\n\t(WNT): %v", rl.Audit, l.Audit)
+	}
+	next := &Lock{P: []gps.LockedProject{
+		mkvp("github.com/a/fresh", "rev1", digest),
+		mkvp("github.com/a/stale", "rev4", digest),
+	}}
+	next.RecordAudit(auditSolution{}, rl, now)
+	if !next.Audit["github.com/a/fresh"].Verified.Equal(now.Add(-time.Hour)) || !next.Audit["github.com/a/stale"].Verified.IsZero() {
+		t.Errorf("expected verification times to be kept only for unchanged projects, got %v", next.Audit)
+	}
+}
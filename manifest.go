@@ -11,10 +11,12 @@ import (
 	"reflect"
 	"regexp"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/golang/dep/gps"
 	"github.com/golang/dep/gps/pkgtree"
+	"github.com/golang/dep/gps/verify"
 	"github.com/pelletier/go-toml"
 	"github.com/pkg/errors"
 )
@@ -29,9 +31,17 @@ var (
 	errInvalidRequired     = errors.Errorf("%q must be a TOML list of strings", "required")
 	errInvalidIgnored      = errors.Errorf("%q must be a TOML list of strings", "ignored")
 	errInvalidNoVerify     = errors.Errorf("%q must be a TOML list of strings", "noverify")
+	errInvalidExternal     = errors.Errorf("%q must be a TOML list of strings", "external")
 	errInvalidPrune        = errors.Errorf("%q must be a TOML table of booleans", "prune")
 	errInvalidPruneProject = errors.Errorf("%q must be a TOML array of tables", "prune.project")
 	errInvalidMetadata     = errors.New("metadata should be a TOML table")
+	errInvalidGoVersion    = errors.Errorf("%q must be a major.minor[.patch] version string, such as \"1.10\"", "go")
+	errInvalidVariables    = errors.Errorf("%q must be a TOML table of strings", "variables")
+	errInvalidFallbacks    = errors.Errorf("%q must be a TOML list of strings", "fallback-sources")
+	errInvalidDigestAlg    = errors.Errorf("%q must be one of \"sha256\", \"sha512\" or \"blake3\"", "digest-algorithm")
+	errInvalidBase         = errors.Errorf("%q must be a path or URL string", "base")
+	errInvalidChannel      = errors.Errorf("%q must be a TOML array of tables", "channel")
+	errInvalidBuildContext = errors.Errorf("%q must be a TOML list of strings", "build-contexts")
 
 	errInvalidProjectRoot = errors.New("ProjectRoot name validation failed")
 
@@ -54,16 +64,76 @@ type Manifest struct {
 
 	NoVerify []string
 
+	// External lists import paths, or import path patterns, that are
+	// satisfied outside of dep, such as by code generated at build time.
+	External []string
+
+	// GoVersion is the minimum version of the Go toolchain that can build
+	// the project, if any.
+	GoVersion string
+
+	// BuildContexts are the platforms and build tags for which the project is
+	// built, if it is not built for all of them. Imports from files that are
+	// built in none of them are disregarded, in the project and in its
+	// dependencies. See gps.SolveParameters.BuildContexts.
+	BuildContexts []pkgtree.BuildContext
+
+	// Variables are the values that were substituted for ${name} references
+	// in the constraints and overrides when the manifest was read. The
+	// constraints themselves hold the expanded values, and are what
+	// MarshalTOML writes, so the input digest changes whenever an expansion
+	// does.
+	Variables map[string]string
+
+	// SourceFallbacks lists, for each project root, the fallback sources
+	// declared by its constraint or override, to be used if its own source
+	// cannot be reached. See gps.SolveParameters.SourceFallbacks.
+	SourceFallbacks map[gps.ProjectRoot][]string
+
+	// Metadata holds, for each project root, the string values of the
+	// metadata table of its constraint or override. dep does not interpret
+	// them, but records them with the project in the lock. See
+	// gps.SolveParameters.ProjectMetadata.
+	Metadata map[gps.ProjectRoot]map[string]string
+
+	// Channels holds the release channels defined by the manifest, by name,
+	// to which its constraints and overrides may subscribe in addition to
+	// the ones every project has; see gps.DefaultReleaseChannel. A channel
+	// defined here takes the place of a default one of the same name.
+	Channels map[string]gps.ReleaseChannel
+
+	// DigestAlgorithm is the algorithm with which vendored projects are
+	// hashed when their digests are recorded in the lock. The zero value
+	// means verify.DefaultDigestAlgorithm.
+	DigestAlgorithm verify.DigestAlgorithm
+
 	PruneOptions gps.CascadingPruneOptions
+
+	// Base is the path or URL of the manifest that this one inherits from, if
+	// any, as written. A relative path is relative to the directory of this
+	// manifest. Only the root project's manifest is composed with its base,
+	// when it is loaded by Ctx.LoadProject; see Inherit.
+	Base string
+
+	// hasPrune indicates that the manifest has a prune table, rather than
+	// just the default prune options.
+	hasPrune bool
 }
 
 type rawManifest struct {
-	Constraints  []rawProject    `toml:"constraint,omitempty"`
-	Overrides    []rawProject    `toml:"override,omitempty"`
-	Ignored      []string        `toml:"ignored,omitempty"`
-	Required     []string        `toml:"required,omitempty"`
-	NoVerify     []string        `toml:"noverify,omitempty"`
-	PruneOptions rawPruneOptions `toml:"prune,omitempty"`
+	Base         string            `toml:"base,omitempty"`
+	GoVersion    string            `toml:"go,omitempty"`
+	BuildCtxs    []string          `toml:"build-contexts,omitempty"`
+	Variables    map[string]string `toml:"variables,omitempty"`
+	DigestAlg    string            `toml:"digest-algorithm,omitempty"`
+	Constraints  []rawProject      `toml:"constraint,omitempty"`
+	Overrides    []rawProject      `toml:"override,omitempty"`
+	Channels     []rawChannel      `toml:"channel,omitempty"`
+	Ignored      []string          `toml:"ignored,omitempty"`
+	Required     []string          `toml:"required,omitempty"`
+	NoVerify     []string          `toml:"noverify,omitempty"`
+	External     []string          `toml:"external,omitempty"`
+	PruneOptions rawPruneOptions   `toml:"prune,omitempty"`
 }
 
 type rawProject struct {
@@ -72,6 +142,19 @@ type rawProject struct {
 	Revision string `toml:"revision,omitempty"`
 	Version  string `toml:"version,omitempty"`
 	Source   string `toml:"source,omitempty"`
+	Channel  string `toml:"channel,omitempty"`
+
+	FallbackSources []string          `toml:"fallback-sources,omitempty"`
+	Metadata        map[string]string `toml:"metadata,omitempty"`
+}
+
+type rawChannel struct {
+	Name          string   `toml:"name"`
+	Releases      bool     `toml:"releases,omitempty"`
+	Prereleases   bool     `toml:"prereleases,omitempty"`
+	Tags          []string `toml:"tags,omitempty"`
+	Branch        string   `toml:"branch,omitempty"`
+	DefaultBranch bool     `toml:"default-branch,omitempty"`
 }
 
 type rawPruneOptions struct {
@@ -108,6 +191,24 @@ func NewManifest() *Manifest {
 	}
 }
 
+// unknownFieldError is the warning produced by validateManifest for a field that
+// dep does not recognize.
+type unknownFieldError struct {
+	field string
+	// The table containing the field, or empty for the top level.
+	in string
+}
+
+func (e unknownFieldError) Error() string {
+	switch e.in {
+	case "":
+		return fmt.Sprintf("unknown field in manifest: %v", e.field)
+	case "constraint", "override", "channel":
+		return fmt.Sprintf("invalid key %q in %q", e.field, e.in)
+	}
+	return fmt.Sprintf("unknown field %q in %q", e.field, e.in)
+}
+
 func validateManifest(s string) ([]error, error) {
 	var warns []error
 	// Load the TomlTree from string
@@ -120,6 +221,8 @@ func validateManifest(s string) ([]error, error) {
 
 	// match abbreviated git hash (7chars) or hg hash (12chars)
 	abbrevRevHash := regexp.MustCompile("^[a-f0-9]{7}([a-f0-9]{5})?$")
+	goVersion := regexp.MustCompile(`^[0-9]+\.[0-9]+(\.[0-9]+)?$`)
+	variableName := regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
 	// Look for unknown fields and collect errors
 	for prop, val := range manifest {
 		switch prop {
@@ -148,7 +251,7 @@ func validateManifest(s string) ([]error, error) {
 							// Check if the key is valid
 							switch key {
 							case "name":
-							case "branch", "version", "source":
+							case "branch", "version", "source", "channel":
 								ruleProvided = true
 							case "revision":
 								ruleProvided = true
@@ -157,14 +260,30 @@ func validateManifest(s string) ([]error, error) {
 										warns = append(warns, fmt.Errorf("revision %q should not be in abbreviated form", valueStr))
 									}
 								}
+							case "fallback-sources":
+								list, ok := value.([]interface{})
+								if !ok {
+									return warns, errInvalidFallbacks
+								}
+								for _, f := range list {
+									if _, ok := f.(string); !ok {
+										return warns, errInvalidFallbacks
+									}
+								}
 							case "metadata":
 								// Check if metadata is of Map type
 								if reflect.TypeOf(value).Kind() != reflect.Map {
 									warns = append(warns, fmt.Errorf("metadata in %q should be a TOML table", prop))
+								} else if md, ok := value.(map[string]interface{}); ok {
+									for k, v := range md {
+										if _, ok := v.(string); !ok {
+											warns = append(warns, fmt.Errorf("metadata %q in %q is not a string, and will not be recorded in the lock", k, prop))
+										}
+									}
 								}
 							default:
 								// unknown/invalid key
-								warns = append(warns, fmt.Errorf("invalid key %q in %q", key, prop))
+								warns = append(warns, unknownFieldError{field: key, in: prop})
 							}
 						}
 						if _, ok := props["name"]; !ok {
@@ -186,7 +305,28 @@ func validateManifest(s string) ([]error, error) {
 					return warns, errInvalidOverride
 				}
 			}
-		case "ignored", "required", "noverify":
+		case "channel":
+			chans, ok := val.([]interface{})
+			if !ok {
+				return warns, errInvalidChannel
+			}
+			for _, c := range chans {
+				props, ok := c.(map[string]interface{})
+				if !ok {
+					return warns, errInvalidChannel
+				}
+				for key := range props {
+					switch key {
+					case "name", "releases", "prereleases", "tags", "branch", "default-branch":
+					default:
+						warns = append(warns, unknownFieldError{field: key, in: prop})
+					}
+				}
+				if _, ok := props["name"]; !ok {
+					warns = append(warns, errNoName)
+				}
+			}
+		case "ignored", "required", "noverify", "external":
 			valid := true
 			if rawList, ok := val.([]interface{}); ok {
 				// Check element type of the array. TOML doesn't let mixing of types in
@@ -208,6 +348,48 @@ func validateManifest(s string) ([]error, error) {
 				if prop == "noverify" {
 					return warns, errInvalidNoVerify
 				}
+				if prop == "external" {
+					return warns, errInvalidExternal
+				}
+			}
+		case "base":
+			if v, ok := val.(string); !ok || v == "" {
+				return warns, errInvalidBase
+			}
+		case "build-contexts":
+			rawList, ok := val.([]interface{})
+			if !ok {
+				return warns, errInvalidBuildContext
+			}
+			for _, v := range rawList {
+				if _, ok := v.(string); !ok {
+					return warns, errInvalidBuildContext
+				}
+			}
+		case "go":
+			if v, ok := val.(string); !ok || !goVersion.MatchString(v) {
+				return warns, errInvalidGoVersion
+			}
+		case "digest-algorithm":
+			v, ok := val.(string)
+			if !ok {
+				return warns, errInvalidDigestAlg
+			}
+			if _, err := verify.ParseDigestAlgorithm(v); err != nil {
+				return warns, errInvalidDigestAlg
+			}
+		case "variables":
+			vars, ok := val.(map[string]interface{})
+			if !ok {
+				return warns, errInvalidVariables
+			}
+			for name, v := range vars {
+				if _, ok := v.(string); !ok {
+					return warns, errInvalidVariables
+				}
+				if !variableName.MatchString(name) {
+					warns = append(warns, fmt.Errorf("variable %q cannot be referenced; names may only contain letters, digits and underscores", name))
+				}
 			}
 		case "prune":
 			pruneWarns, err := validatePruneOptions(val, true)
@@ -216,7 +398,7 @@ func validateManifest(s string) ([]error, error) {
 				return warns, err
 			}
 		default:
-			warns = append(warns, fmt.Errorf("unknown field in manifest: %v", prop))
+			warns = append(warns, unknownFieldError{field: prop})
 		}
 	}
 
@@ -260,9 +442,9 @@ func validatePruneOptions(val interface{}, root bool) (warns []error, err error)
 
 		default:
 			if root {
-				warns = append(warns, errors.Errorf("unknown field %q in %q", key, "prune"))
+				warns = append(warns, unknownFieldError{field: key, in: "prune"})
 			} else {
-				warns = append(warns, errors.Errorf("unknown field %q in %q", key, "prune.project"))
+				warns = append(warns, unknownFieldError{field: key, in: "prune.project"})
 			}
 		}
 	}
@@ -295,33 +477,35 @@ func checkRedundantPruneOptions(co gps.CascadingPruneOptions) (warns []error) {
 }
 
 // ValidateProjectRoots validates the project roots present in manifest.
+// Constraints may also name a package within a project, to constrain the
+// project only where that package, or one beneath it, is imported.
 func ValidateProjectRoots(c *Ctx, m *Manifest, sm gps.SourceManager) error {
 	// Channel to receive all the errors
 	errorCh := make(chan error, len(m.Constraints)+len(m.Ovr))
 
 	var wg sync.WaitGroup
 
-	validate := func(pr gps.ProjectRoot) {
+	validate := func(pr gps.ProjectRoot, pkgok bool) {
 		defer wg.Done()
 		origPR, err := sm.DeduceProjectRoot(string(pr))
 		if err != nil {
 			errorCh <- err
-		} else if origPR != pr {
+		} else if origPR != pr && !(pkgok && strings.HasPrefix(string(pr), string(origPR)+"/")) {
 			errorCh <- fmt.Errorf("the name for %q should be changed to %q", pr, origPR)
 		}
 	}
 
 	for pr := range m.Constraints {
 		wg.Add(1)
-		go validate(pr)
+		go validate(pr, true)
 	}
 	for pr := range m.Ovr {
 		wg.Add(1)
-		go validate(pr)
+		go validate(pr, false)
 	}
 	for pr := range m.PruneOptions.PerProjectOptions {
 		wg.Add(1)
-		go validate(pr)
+		go validate(pr, false)
 	}
 
 	wg.Wait()
@@ -354,7 +538,11 @@ func readManifest(r io.Reader) (*Manifest, []error, error) {
 	}
 
 	raw := rawManifest{}
-	err = toml.Unmarshal(buf.Bytes(), &raw)
+	tree, err := toml.LoadBytes(buf.Bytes())
+	if err == nil {
+		stringMetadata(tree)
+		err = tree.Unmarshal(&raw)
+	}
 	if err != nil {
 		return nil, warns, errors.Wrap(err, "unable to parse the manifest as TOML")
 	}
@@ -376,9 +564,39 @@ func fromRawManifest(raw rawManifest, buf *bytes.Buffer) (*Manifest, error) {
 	m.Ignored = raw.Ignored
 	m.Required = raw.Required
 	m.NoVerify = raw.NoVerify
+	m.External = raw.External
+	m.GoVersion = raw.GoVersion
+	m.Variables = raw.Variables
+	m.Base = raw.Base
+
+	for _, s := range raw.BuildCtxs {
+		c, err := pkgtree.ParseBuildContext(s)
+		if err != nil {
+			return nil, err
+		}
+		m.BuildContexts = append(m.BuildContexts, c)
+	}
+
+	if raw.DigestAlg != "" {
+		alg, err := verify.ParseDigestAlgorithm(raw.DigestAlg)
+		if err != nil {
+			return nil, err
+		}
+		m.DigestAlgorithm = alg
+	}
+
+	chans, err := fromRawChannels(raw.Channels)
+	if err != nil {
+		return nil, err
+	}
+	m.Channels = chans
 
 	for i := 0; i < len(raw.Constraints); i++ {
-		name, prj, err := toProject(raw.Constraints[i])
+		rp, err := expandVariables(raw.Constraints[i], raw.Variables)
+		if err != nil {
+			return nil, err
+		}
+		name, prj, err := toProject(rp, m.Channels)
 		if err != nil {
 			return nil, err
 		}
@@ -386,10 +604,16 @@ func fromRawManifest(raw rawManifest, buf *bytes.Buffer) (*Manifest, error) {
 			return nil, errors.Errorf("multiple dependencies specified for %s, can only specify one", name)
 		}
 		m.Constraints[name] = prj
+		m.setFallbacks(name, rp.FallbackSources)
+		m.setMetadata(name, rp.Metadata)
 	}
 
 	for i := 0; i < len(raw.Overrides); i++ {
-		name, prj, err := toProject(raw.Overrides[i])
+		rp, err := expandVariables(raw.Overrides[i], raw.Variables)
+		if err != nil {
+			return nil, err
+		}
+		name, prj, err := toProject(rp, m.Channels)
 		if err != nil {
 			return nil, err
 		}
@@ -397,6 +621,9 @@ func fromRawManifest(raw rawManifest, buf *bytes.Buffer) (*Manifest, error) {
 			return nil, errors.Errorf("multiple overrides specified for %s, can only specify one", name)
 		}
 		m.Ovr[name] = prj
+		// An override's fallbacks and metadata supersede the constraint's.
+		m.setFallbacks(name, rp.FallbackSources)
+		m.setMetadata(name, rp.Metadata)
 	}
 
 	// TODO(sdboyer) it is awful that we have to do this manual extraction
@@ -412,6 +639,7 @@ func fromRawManifest(raw rawManifest, buf *bytes.Buffer) (*Manifest, error) {
 	// Previous validation already guaranteed that, if it exists, it's this map
 	// type.
 	m.PruneOptions = fromRawPruneOptions(iprunemap.(*toml.Tree).ToMap())
+	m.hasPrune = true
 
 	return m, nil
 }
@@ -489,13 +717,78 @@ func toRawPruneOptions(co gps.CascadingPruneOptions) rawPruneOptions {
 	return raw
 }
 
+// fromRawChannels converts the channels defined in a manifest, checking that
+// each is well-formed and defined only once.
+func fromRawChannels(raw []rawChannel) (map[string]gps.ReleaseChannel, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	chans := make(map[string]gps.ReleaseChannel, len(raw))
+	for _, rc := range raw {
+		ch := gps.ReleaseChannel{
+			Name:          rc.Name,
+			Releases:      rc.Releases,
+			Prereleases:   rc.Prereleases,
+			Tags:          rc.Tags,
+			Branch:        rc.Branch,
+			DefaultBranch: rc.DefaultBranch,
+		}
+		if err := ch.Validate(); err != nil {
+			return nil, err
+		}
+		if _, exists := chans[ch.Name]; exists {
+			return nil, errors.Errorf("multiple definitions of release channel %s, can only specify one", ch.Name)
+		}
+		chans[ch.Name] = ch
+	}
+	return chans, nil
+}
+
 // toProject interprets the string representations of project information held in
 // a rawProject, converting them into a proper gps.ProjectProperties. An
 // error is returned if the rawProject contains some invalid combination -
 // for example, if both a branch and version constraint are specified.
-func toProject(raw rawProject) (n gps.ProjectRoot, pp gps.ProjectProperties, err error) {
+// variableRef matches a reference to a manifest variable.
+var variableRef = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// expandVariables substitutes the values of vars for the ${name} references
+// in the branch, version, revision and source of raw.
+func expandVariables(raw rawProject, vars map[string]string) (rawProject, error) {
+	var err error
+	expand := func(field, s string) string {
+		return variableRef.ReplaceAllStringFunc(s, func(ref string) string {
+			name := variableRef.FindStringSubmatch(ref)[1]
+			v, has := vars[name]
+			if !has && err == nil {
+				err = errors.Errorf("undefined variable %q in %s for %s", name, field, raw.Name)
+			}
+			return v
+		})
+	}
+
+	raw.Branch = expand("branch", raw.Branch)
+	raw.Version = expand("version", raw.Version)
+	raw.Revision = expand("revision", raw.Revision)
+	raw.Source = expand("source", raw.Source)
+	return raw, err
+}
+
+func toProject(raw rawProject, chans map[string]gps.ReleaseChannel) (n gps.ProjectRoot, pp gps.ProjectProperties, err error) {
 	n = gps.ProjectRoot(raw.Name)
-	if raw.Branch != "" {
+	if raw.Channel != "" {
+		if raw.Branch != "" || raw.Version != "" || raw.Revision != "" {
+			return n, pp, errors.Errorf("multiple constraints specified for %s, can only specify one", n)
+		}
+		ch, has := chans[raw.Channel]
+		if !has {
+			ch, has = gps.DefaultReleaseChannel(raw.Channel)
+		}
+		if !has {
+			return n, pp, errors.Errorf("unknown release channel %q for %s", raw.Channel, n)
+		}
+		pp.Constraint = gps.NewChannelConstraint(ch)
+	} else if raw.Branch != "" {
 		if raw.Version != "" || raw.Revision != "" {
 			return n, pp, errors.Errorf("multiple constraints specified for %s, can only specify one", n)
 		}
@@ -508,6 +801,11 @@ func toProject(raw rawProject) (n gps.ProjectRoot, pp gps.ProjectProperties, err
 		// always semver if we can
 		pp.Constraint, err = gps.NewSemverConstraintIC(raw.Version)
 		if err != nil {
+			// Constraint expressions can never be plain versions, so report
+			// why they are invalid rather than silently falling back.
+			if gps.IsConstraintExpr(raw.Version) {
+				return n, pp, errors.Wrapf(err, "invalid version for %s", n)
+			}
 			// but if not, fall back on plain versions
 			pp.Constraint = gps.NewVersion(raw.Version)
 		}
@@ -533,6 +831,57 @@ func (m *Manifest) MarshalTOML() ([]byte, error) {
 	return buf.Bytes(), errors.Wrap(err, "unable to marshal the lock to a TOML string")
 }
 
+// setFallbacks records the fallback sources for the project, if there are any.
+func (m *Manifest) setFallbacks(pr gps.ProjectRoot, forks []string) {
+	if len(forks) == 0 {
+		return
+	}
+	if m.SourceFallbacks == nil {
+		m.SourceFallbacks = make(map[gps.ProjectRoot][]string)
+	}
+	m.SourceFallbacks[pr] = forks
+}
+
+// setMetadata records a copy of the project's metadata, if it has any.
+func (m *Manifest) setMetadata(pr gps.ProjectRoot, md map[string]string) {
+	if len(md) == 0 {
+		return
+	}
+	if m.Metadata == nil {
+		m.Metadata = make(map[gps.ProjectRoot]map[string]string)
+	}
+	md2 := make(map[string]string, len(md))
+	for k, v := range md {
+		md2[k] = v
+	}
+	m.Metadata[pr] = md2
+}
+
+// stringMetadata drops the values that are not strings from the metadata
+// tables of the constraints and overrides in tree, so that it can be
+// unmarshaled. Only string values are recorded in the lock; others are left to
+// the tools that read the manifest for themselves.
+func stringMetadata(tree *toml.Tree) {
+	for _, key := range []string{"constraint", "override"} {
+		projects, _ := tree.Get(key).([]*toml.Tree)
+		for _, p := range projects {
+			md, ok := p.Get("metadata").(*toml.Tree)
+			if !ok {
+				continue
+			}
+			strs := make(map[string]interface{})
+			for k, v := range md.ToMap() {
+				if s, ok := v.(string); ok {
+					strs[k] = s
+				}
+			}
+			if smd, err := toml.TreeFromMap(strs); err == nil {
+				p.Set("metadata", smd)
+			}
+		}
+	}
+}
+
 // toRaw converts the manifest into a representation suitable to write to the manifest file
 func (m *Manifest) toRaw() rawManifest {
 	raw := rawManifest{
@@ -541,18 +890,51 @@ func (m *Manifest) toRaw() rawManifest {
 		Ignored:     m.Ignored,
 		Required:    m.Required,
 		NoVerify:    m.NoVerify,
+		External:    m.External,
+		GoVersion:   m.GoVersion,
+		Base:        m.Base,
+	}
+
+	for _, c := range m.BuildContexts {
+		raw.BuildCtxs = append(raw.BuildCtxs, c.String())
 	}
 
+	if m.DigestAlgorithm != 0 {
+		raw.DigestAlg = m.DigestAlgorithm.String()
+	}
+
+	// Fallback sources and metadata are written with the override for a
+	// project, if it has one, as that is the rule that governs it.
 	for n, prj := range m.Constraints {
-		raw.Constraints = append(raw.Constraints, toRawProject(n, prj))
+		rp := toRawProject(n, prj)
+		if _, has := m.Ovr[n]; !has {
+			rp.FallbackSources = m.SourceFallbacks[n]
+			rp.Metadata = m.Metadata[n]
+		}
+		raw.Constraints = append(raw.Constraints, rp)
 	}
 	sort.Sort(sortedRawProjects(raw.Constraints))
 
 	for n, prj := range m.Ovr {
-		raw.Overrides = append(raw.Overrides, toRawProject(n, prj))
+		rp := toRawProject(n, prj)
+		rp.FallbackSources = m.SourceFallbacks[n]
+		rp.Metadata = m.Metadata[n]
+		raw.Overrides = append(raw.Overrides, rp)
 	}
 	sort.Sort(sortedRawProjects(raw.Overrides))
 
+	for _, ch := range m.Channels {
+		raw.Channels = append(raw.Channels, rawChannel{
+			Name:          ch.Name,
+			Releases:      ch.Releases,
+			Prereleases:   ch.Prereleases,
+			Tags:          ch.Tags,
+			Branch:        ch.Branch,
+			DefaultBranch: ch.DefaultBranch,
+		})
+	}
+	sort.Slice(raw.Channels, func(i, j int) bool { return raw.Channels[i].Name < raw.Channels[j].Name })
+
 	raw.PruneOptions = toRawPruneOptions(m.PruneOptions)
 
 	return raw
@@ -593,6 +975,11 @@ func toRawProject(name gps.ProjectRoot, project gps.ProjectProperties) rawProjec
 		return raw
 	}
 
+	if ch, ok := gps.ChannelOf(project.Constraint); ok {
+		raw.Channel = ch.Name
+		return raw
+	}
+
 	// We simply don't allow for a case where the user could directly
 	// express a 'none' constraint, so we can ignore it here. We also ignore
 	// the 'any' case, because that's the other possibility, and it's what
@@ -624,6 +1011,24 @@ func (m *Manifest) IgnoredPackages() *pkgtree.IgnoredRuleset {
 	return pkgtree.NewIgnoredRuleset(m.Ignored)
 }
 
+// ExternalPackages returns a pkgtree.IgnoredRuleset of the import paths that
+// are satisfied externally. This makes Manifest a gps.ExternalManifest.
+func (m *Manifest) ExternalPackages() *pkgtree.IgnoredRuleset {
+	if m == nil {
+		return pkgtree.NewIgnoredRuleset(nil)
+	}
+	return pkgtree.NewIgnoredRuleset(m.External)
+}
+
+// MinimumGoVersion returns the minimum version of the Go toolchain that can
+// build the project. This makes Manifest a gps.GoVersionManifest.
+func (m *Manifest) MinimumGoVersion() string {
+	if m == nil {
+		return ""
+	}
+	return m.GoVersion
+}
+
 // HasConstraintsOn checks if the manifest contains either constraints or
 // overrides on the provided ProjectRoot.
 func (m *Manifest) HasConstraintsOn(root gps.ProjectRoot) bool {
@@ -654,3 +1059,59 @@ func (m *Manifest) RequiredPackages() map[string]bool {
 
 	return mp
 }
+
+// dup returns a deep copy of the manifest.
+func (m *Manifest) dup() *Manifest {
+	m2 := &Manifest{
+		Constraints: make(gps.ProjectConstraints, len(m.Constraints)),
+		Ovr:         make(gps.ProjectConstraints, len(m.Ovr)),
+		Ignored:     append([]string(nil), m.Ignored...),
+		Required:    append([]string(nil), m.Required...),
+		NoVerify:    append([]string(nil), m.NoVerify...),
+		External:    append([]string(nil), m.External...),
+		GoVersion:   m.GoVersion,
+		PruneOptions: gps.CascadingPruneOptions{
+			DefaultOptions:    m.PruneOptions.DefaultOptions,
+			PerProjectOptions: make(map[gps.ProjectRoot]gps.PruneOptionSet, len(m.PruneOptions.PerProjectOptions)),
+		},
+		DigestAlgorithm: m.DigestAlgorithm,
+		Base:            m.Base,
+		hasPrune:        m.hasPrune,
+	}
+
+	for _, c := range m.BuildContexts {
+		c.Tags = append([]string(nil), c.Tags...)
+		m2.BuildContexts = append(m2.BuildContexts, c)
+	}
+
+	if m.Variables != nil {
+		m2.Variables = make(map[string]string, len(m.Variables))
+		for name, v := range m.Variables {
+			m2.Variables[name] = v
+		}
+	}
+	for pr, pp := range m.Constraints {
+		m2.Constraints[pr] = pp
+	}
+	for pr, pp := range m.Ovr {
+		m2.Ovr[pr] = pp
+	}
+	for pr, pos := range m.PruneOptions.PerProjectOptions {
+		m2.PruneOptions.PerProjectOptions[pr] = pos
+	}
+	for pr, forks := range m.SourceFallbacks {
+		m2.setFallbacks(pr, append([]string(nil), forks...))
+	}
+	for pr, md := range m.Metadata {
+		m2.setMetadata(pr, md)
+	}
+	for name, ch := range m.Channels {
+		if m2.Channels == nil {
+			m2.Channels = make(map[string]gps.ReleaseChannel, len(m.Channels))
+		}
+		ch.Tags = append([]string(nil), ch.Tags...)
+		m2.Channels[name] = ch
+	}
+
+	return m2
+}
@@ -0,0 +1,209 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/dep/gps"
+	"github.com/pkg/errors"
+)
+
+// baseManifestTimeout bounds how long fetching a base manifest over HTTP may
+// take.
+const baseManifestTimeout = 30 * time.Second
+
+// Inherit returns a new manifest composed of base, with m's own rules added
+// on top. Where both declare the same thing, m takes precedence:
+//
+//   - A constraint or override in m replaces base's for the same project
+//     entirely, including its source, fallback sources and metadata.
+//   - The ignored, required, noverify and external lists are combined.
+//   - The go version, build contexts, digest algorithm, variables and
+//     release channels are m's where it sets them, and base's otherwise.
+//   - If m has a prune table, it replaces base's entirely.
+//
+// Neither m nor base is modified. The result keeps m's Base.
+func (m *Manifest) Inherit(base *Manifest) *Manifest {
+	m2 := base.dup()
+	m2.Base = m.Base
+
+	for pr, pp := range m.Constraints {
+		m2.Constraints[pr] = pp
+		delete(m2.SourceFallbacks, pr)
+		delete(m2.Metadata, pr)
+	}
+	for pr, pp := range m.Ovr {
+		m2.Ovr[pr] = pp
+		delete(m2.SourceFallbacks, pr)
+		delete(m2.Metadata, pr)
+	}
+	for pr, forks := range m.SourceFallbacks {
+		m2.setFallbacks(pr, append([]string(nil), forks...))
+	}
+	for pr, md := range m.Metadata {
+		m2.setMetadata(pr, md)
+	}
+
+	m2.Ignored = appendMissing(m2.Ignored, m.Ignored)
+	m2.Required = appendMissing(m2.Required, m.Required)
+	m2.NoVerify = appendMissing(m2.NoVerify, m.NoVerify)
+	m2.External = appendMissing(m2.External, m.External)
+
+	if m.GoVersion != "" {
+		m2.GoVersion = m.GoVersion
+	}
+	if len(m.BuildContexts) > 0 {
+		m2.BuildContexts = m.BuildContexts
+	}
+	if m.DigestAlgorithm != 0 {
+		m2.DigestAlgorithm = m.DigestAlgorithm
+	}
+	for name, v := range m.Variables {
+		if m2.Variables == nil {
+			m2.Variables = make(map[string]string, len(m.Variables))
+		}
+		m2.Variables[name] = v
+	}
+	for name, ch := range m.Channels {
+		if m2.Channels == nil {
+			m2.Channels = make(map[string]gps.ReleaseChannel, len(m.Channels))
+		}
+		m2.Channels[name] = ch
+	}
+
+	if m.hasPrune {
+		m2.hasPrune = true
+		m2.PruneOptions = gps.CascadingPruneOptions{
+			DefaultOptions:    m.PruneOptions.DefaultOptions,
+			PerProjectOptions: make(map[gps.ProjectRoot]gps.PruneOptionSet, len(m.PruneOptions.PerProjectOptions)),
+		}
+		for pr, pos := range m.PruneOptions.PerProjectOptions {
+			m2.PruneOptions.PerProjectOptions[pr] = pos
+		}
+	}
+
+	return m2
+}
+
+// appendMissing appends the elements of add to l that it does not already
+// contain.
+func appendMissing(l, add []string) []string {
+	have := make(map[string]bool, len(l))
+	for _, s := range l {
+		have[s] = true
+	}
+	for _, s := range add {
+		if !have[s] {
+			have[s] = true
+			l = append(l, s)
+		}
+	}
+	return l
+}
+
+// inheritBaseManifests composes m with the chain of base manifests it names,
+// each of which may name a base of its own. A relative base is resolved
+// against the location of the manifest that names it, which for m is the
+// directory dir.
+func inheritBaseManifests(m *Manifest, dir string) (*Manifest, []error, error) {
+	var warns []error
+	var chain []*Manifest
+	seen := make(map[string]bool)
+
+	from, ref := dir, m.Base
+	for ref != "" {
+		loc, err := resolveBaseManifest(from, ref)
+		if err != nil {
+			return nil, warns, err
+		}
+		if seen[loc] {
+			return nil, warns, errors.Errorf("base manifest %s inherits from itself", loc)
+		}
+		seen[loc] = true
+
+		base, bwarns, err := readBaseManifest(loc)
+		for _, warn := range bwarns {
+			warns = append(warns, errors.Wrapf(warn, "in base manifest %s", loc))
+		}
+		if err != nil {
+			return nil, warns, errors.Wrapf(err, "could not read base manifest %s", loc)
+		}
+		chain = append(chain, base)
+
+		from, ref = loc, base.Base
+		if !isBaseManifestURL(loc) {
+			from = filepath.Dir(loc)
+		}
+	}
+
+	if len(chain) == 0 {
+		return m, warns, nil
+	}
+
+	// Compose from the outermost base inwards, so that each manifest takes
+	// precedence over those it inherits from.
+	base := chain[len(chain)-1]
+	for i := len(chain) - 2; i >= 0; i-- {
+		base = chain[i].Inherit(base)
+	}
+	return m.Inherit(base), warns, nil
+}
+
+func isBaseManifestURL(loc string) bool {
+	return strings.HasPrefix(loc, "https://") || strings.HasPrefix(loc, "http://")
+}
+
+// resolveBaseManifest returns the location of the base manifest ref, named by
+// a manifest at, or in the directory, from.
+func resolveBaseManifest(from, ref string) (string, error) {
+	if isBaseManifestURL(ref) {
+		return ref, nil
+	}
+	if isBaseManifestURL(from) {
+		u, err := url.Parse(from)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid base manifest URL %q", from)
+		}
+		r, err := url.Parse(filepath.ToSlash(ref))
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid base manifest reference %q", ref)
+		}
+		return u.ResolveReference(r).String(), nil
+	}
+	if filepath.IsAbs(ref) {
+		return filepath.Clean(ref), nil
+	}
+	return filepath.Join(from, ref), nil
+}
+
+// readBaseManifest reads the base manifest at loc, which is either a local
+// path or an HTTP(S) URL.
+func readBaseManifest(loc string) (*Manifest, []error, error) {
+	if !isBaseManifestURL(loc) {
+		f, err := os.Open(loc)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		return readManifest(f)
+	}
+
+	client := &http.Client{Timeout: baseManifestTimeout}
+	resp, err := client.Get(loc)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, errors.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return readManifest(resp.Body)
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/internal/test"
+	"github.com/pkg/errors"
+)
+
+func TestInheritBaseManifests(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	// The organization's root policy is served over HTTP, and names a
+	// further base relative to its own URL.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/policy/root.toml":
+			fmt.Fprint(w, `base = "extra.toml"
+required = ["example.com/r/cmd"]
+`)
+		case "/policy/extra.toml":
+			fmt.Fprint(w, `[[constraint]]
+  name = "example.com/d"
+  version = "^4.0.0"
+
+[[constraint]]
+  name = "example.com/b"
+  version = "^1.0.0"
+`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	h.TempFile("team/Gopkg.toml", `base = "`+srv.URL+`/policy/root.toml"
+go = "1.9"
+ignored = ["example.com/x"]
+
+[[constraint]]
+  name = "example.com/a"
+  version = "^1.0.0"
+  fallback-sources = ["https://example.com/fork/a.git"]
+
+[[constraint]]
+  name = "example.com/b"
+  version = "^2.0.0"
+
+[[override]]
+  name = "example.com/c"
+  branch = "stable"
+
+[prune]
+  go-tests = true
+`)
+	h.TempFile("project/Gopkg.toml", `base = "../team/Gopkg.toml"
+ignored = ["example.com/y", "example.com/x"]
+
+[[constraint]]
+  name = "example.com/a"
+  version = "^1.2.0"
+`)
+
+	m := readTestManifest(t, h.Path("project/Gopkg.toml"))
+	got, warns, err := inheritBaseManifests(m, h.Path("project"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Errorf("unexpected warnings: %v", warns)
+	}
+
+	want := map[gps.ProjectRoot]string{
+		"example.com/a": "^1.2.0",
+		"example.com/b": "^2.0.0",
+		"example.com/d": "^4.0.0",
+	}
+	if len(got.Constraints) != len(want) {
+		t.Errorf("expected constraints on %d projects, got %v", len(want), got.Constraints)
+	}
+	for pr, c := range want {
+		if pp, has := got.Constraints[pr]; !has || pp.Constraint.String() != c {
+			t.Errorf("expected the constraint on %s to be %s, got %v", pr, c, pp.Constraint)
+		}
+	}
+	if pp := got.Ovr["example.com/c"]; pp.Constraint != gps.NewBranch("stable") {
+		t.Errorf("expected the base's override to be inherited, got %v", got.Ovr)
+	}
+	if len(got.SourceFallbacks) != 0 {
+		t.Errorf("expected the project's constraint to replace the base's fallbacks, got %v", got.SourceFallbacks)
+	}
+	if !reflect.DeepEqual(got.Ignored, []string{"example.com/x", "example.com/y"}) {
+		t.Errorf("expected ignored packages to be combined, got %v", got.Ignored)
+	}
+	if !reflect.DeepEqual(got.Required, []string{"example.com/r/cmd"}) {
+		t.Errorf("expected required packages to be inherited, got %v", got.Required)
+	}
+	if got.GoVersion != "1.9" {
+		t.Errorf("expected the go version to be inherited, got %q", got.GoVersion)
+	}
+	if got.PruneOptions.DefaultOptions != gps.PruneNestedVendorDirs|gps.PruneGoTestFiles {
+		t.Errorf("expected prune options to be inherited, got %v", got.PruneOptions.DefaultOptions)
+	}
+	if got.Base != "../team/Gopkg.toml" {
+		t.Errorf("expected the project's base to be kept, got %q", got.Base)
+	}
+
+	// The manifests themselves are untouched.
+	if len(m.Constraints) != 1 || len(m.Ignored) != 2 {
+		t.Errorf("expected the project's manifest to be unmodified, got %+v", m)
+	}
+
+	// The composed manifest is what is recorded as the inputs to solving.
+	tb, err := got.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(tb), `name = "example.com/d"`) {
+		t.Errorf("expected the inherited constraints to be marshaled, got:\n%s", tb)
+	}
+}
+
+func TestInheritBaseManifestsErrors(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile("loop/a.toml", `base = "b.toml"`)
+	h.TempFile("loop/b.toml", `base = "./a.toml"`)
+	h.TempFile("project/Gopkg.toml", `base = "../loop/a.toml"`)
+	m := readTestManifest(t, h.Path("project/Gopkg.toml"))
+	if _, _, err := inheritBaseManifests(m, h.Path("project")); err == nil || !strings.Contains(err.Error(), "inherits from itself") {
+		t.Errorf("expected an error for a cycle of base manifests, got %v", err)
+	}
+
+	m.Base = "missing.toml"
+	if _, _, err := inheritBaseManifests(m, h.Path("project")); err == nil {
+		t.Error("expected an error for a missing base manifest")
+	}
+
+	if _, _, err := readManifest(strings.NewReader("base = 7")); errors.Cause(err) != errInvalidBase {
+		t.Errorf("expected %v for a base that is not a string, got %v", errInvalidBase, err)
+	}
+}
+
+func readTestManifest(t *testing.T, path string) *Manifest {
+	m, _, err := readBaseManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
@@ -0,0 +1,220 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// ManifestDiagnosticKind classifies the problems reported by ValidateManifest.
+type ManifestDiagnosticKind uint8
+
+const (
+	// DiagnosticGeneral is any problem not covered by a more specific kind,
+	// such as an abbreviated revision or a constraint lacking any rules.
+	DiagnosticGeneral ManifestDiagnosticKind = iota
+	// DiagnosticDuplicateProject indicates that a project is declared more
+	// than once in the same set of constraints or overrides.
+	DiagnosticDuplicateProject
+	// DiagnosticRootConstraint indicates a constraint or override on the root
+	// project itself, which has no effect.
+	DiagnosticRootConstraint
+	// DiagnosticShadowedConstraint indicates that a project has both a
+	// constraint and an override. Overrides supersede constraints, so the
+	// constraint has no effect.
+	DiagnosticShadowedConstraint
+	// DiagnosticUnknownField indicates a field that dep does not recognize.
+	DiagnosticUnknownField
+	// DiagnosticIgnoredRequired indicates a required package that is also
+	// matched by an ignore rule.
+	DiagnosticIgnoredRequired
+	// DiagnosticExternalRequired indicates a required package that is also
+	// declared to be satisfied externally.
+	DiagnosticExternalRequired
+)
+
+func (k ManifestDiagnosticKind) String() string {
+	switch k {
+	case DiagnosticGeneral:
+		return "general"
+	case DiagnosticDuplicateProject:
+		return "duplicate-project"
+	case DiagnosticRootConstraint:
+		return "root-constraint"
+	case DiagnosticShadowedConstraint:
+		return "shadowed-constraint"
+	case DiagnosticUnknownField:
+		return "unknown-field"
+	case DiagnosticIgnoredRequired:
+		return "ignored-required"
+	case DiagnosticExternalRequired:
+		return "external-required"
+	}
+	return fmt.Sprintf("ManifestDiagnosticKind(%d)", uint8(k))
+}
+
+// ManifestDiagnostic describes a single problem found in a manifest by
+// ValidateManifest.
+type ManifestDiagnostic struct {
+	Kind ManifestDiagnosticKind
+	// Project is the project to which the problem pertains, if any.
+	Project gps.ProjectRoot
+	// Package is the package to which the problem pertains, if any.
+	Package string
+	// Message describes the problem in human-readable form.
+	Message string
+}
+
+func (d ManifestDiagnostic) String() string {
+	return d.Message
+}
+
+// Fatal reports whether the problem would prevent the manifest from being used
+// for solving, as opposed to merely being a likely mistake.
+func (d ManifestDiagnostic) Fatal() bool {
+	switch d.Kind {
+	case DiagnosticDuplicateProject, DiagnosticIgnoredRequired, DiagnosticExternalRequired:
+		return true
+	}
+	return false
+}
+
+// ValidateManifest reads a manifest from r and reports all of the problems it
+// can find in it, so that they can be surfaced before any attempt to solve.
+// root is the import path of the project to which the manifest belongs; if it
+// is empty, constraints on the root project cannot be detected.
+//
+// Unlike readManifest, problems in the manifest's contents do not stop
+// validation; they are all returned as diagnostics, sorted by project, package
+// and kind. An error is only returned if the manifest is so malformed that it
+// cannot be inspected at all.
+func ValidateManifest(r io.Reader, root gps.ProjectRoot) ([]ManifestDiagnostic, error) {
+	buf := &bytes.Buffer{}
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read byte stream")
+	}
+
+	warns, err := validateManifest(buf.String())
+	if err != nil {
+		return nil, errors.Wrap(err, "manifest validation failed")
+	}
+
+	var diags []ManifestDiagnostic
+	for _, w := range warns {
+		d := ManifestDiagnostic{Kind: DiagnosticGeneral, Message: w.Error()}
+		if _, ok := w.(unknownFieldError); ok {
+			d.Kind = DiagnosticUnknownField
+		}
+		diags = append(diags, d)
+	}
+
+	raw := rawManifest{}
+	err = toml.Unmarshal(buf.Bytes(), &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse the manifest as TOML")
+	}
+
+	chans, err := fromRawChannels(raw.Channels)
+	if err != nil {
+		diags = append(diags, ManifestDiagnostic{Kind: DiagnosticGeneral, Message: err.Error()})
+	}
+
+	constraints := lintProjects(raw.Constraints, "constraint", chans, root, &diags)
+	overrides := lintProjects(raw.Overrides, "override", chans, root, &diags)
+
+	for pr := range constraints {
+		if _, has := overrides[pr]; has {
+			diags = append(diags, ManifestDiagnostic{
+				Kind:    DiagnosticShadowedConstraint,
+				Project: pr,
+				Message: fmt.Sprintf("constraint on %s has no effect, as it is superseded by an override", pr),
+			})
+		}
+	}
+
+	ir := pkgtree.NewIgnoredRuleset(raw.Ignored)
+	ext := pkgtree.NewIgnoredRuleset(raw.External)
+	for _, pkg := range raw.Required {
+		if ir.IsIgnored(pkg) {
+			diags = append(diags, ManifestDiagnostic{
+				Kind:    DiagnosticIgnoredRequired,
+				Package: pkg,
+				Message: fmt.Sprintf("%q is required, but is also ignored", pkg),
+			})
+		}
+		if ext.IsIgnored(pkg) {
+			diags = append(diags, ManifestDiagnostic{
+				Kind:    DiagnosticExternalRequired,
+				Package: pkg,
+				Message: fmt.Sprintf("%q is required, but is also declared external", pkg),
+			})
+		}
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		l, r := diags[i], diags[j]
+		if l.Project != r.Project {
+			return l.Project < r.Project
+		}
+		if l.Package != r.Package {
+			return l.Package < r.Package
+		}
+		return l.Kind < r.Kind
+	})
+
+	return diags, nil
+}
+
+// lintProjects checks a list of raw constraints or overrides for duplicates,
+// unparseable rules and references to the root project, appending diagnostics
+// for any it finds. It returns the set of projects that were declared.
+func lintProjects(raw []rawProject, what string, chans map[string]gps.ReleaseChannel, root gps.ProjectRoot, diags *[]ManifestDiagnostic) map[gps.ProjectRoot]bool {
+	seen := make(map[gps.ProjectRoot]bool, len(raw))
+	for _, rp := range raw {
+		if rp.Name == "" {
+			// validateManifest has already reported the missing name.
+			continue
+		}
+
+		pr, _, err := toProject(rp, chans)
+		if err != nil {
+			*diags = append(*diags, ManifestDiagnostic{
+				Kind:    DiagnosticGeneral,
+				Project: pr,
+				Message: fmt.Sprintf("invalid %s: %s", what, err),
+			})
+		}
+
+		if seen[pr] {
+			*diags = append(*diags, ManifestDiagnostic{
+				Kind:    DiagnosticDuplicateProject,
+				Project: pr,
+				Message: fmt.Sprintf("multiple %ss specified for %s, can only specify one", what, pr),
+			})
+			continue
+		}
+		seen[pr] = true
+
+		if root != "" && (pr == root || strings.HasPrefix(string(pr), string(root)+"/")) {
+			*diags = append(*diags, ManifestDiagnostic{
+				Kind:    DiagnosticRootConstraint,
+				Project: pr,
+				Message: fmt.Sprintf("%s on %s has no effect, as it is part of the root project", what, pr),
+			})
+		}
+	}
+
+	return seen
+}
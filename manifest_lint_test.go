@@ -0,0 +1,97 @@
+// Copyright 2017 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateManifestDiagnostics(t *testing.T) {
+	const manifest = `
+required = ["github.com/foo/bar/cmd", "github.com/baz/qux"]
+ignored = ["github.com/foo/bar*"]
+external = ["github.com/baz/qux"]
+colour = "red"
+
+[[constraint]]
+  name = "github.com/foo/bar"
+  version = "1.0.0"
+
+[[constraint]]
+  name = "github.com/foo/bar"
+  branch = "master"
+
+[[constraint]]
+  name = "github.com/golang/dep/internal"
+  branch = "master"
+
+[[constraint]]
+  name = "github.com/baz/qux"
+  version = "^2.0.0"
+  nick = "q"
+
+[[override]]
+  name = "github.com/baz/qux"
+  version = "2.1.0"
+`
+
+	diags, err := ValidateManifest(strings.NewReader(manifest), "github.com/golang/dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type kp struct {
+		kind    ManifestDiagnosticKind
+		project string
+		pkg     string
+		fatal   bool
+	}
+	want := []kp{
+		{DiagnosticUnknownField, "", "", false},
+		{DiagnosticUnknownField, "", "", false},
+		{DiagnosticExternalRequired, "", "github.com/baz/qux", true},
+		{DiagnosticIgnoredRequired, "", "github.com/foo/bar/cmd", true},
+		{DiagnosticShadowedConstraint, "github.com/baz/qux", "", false},
+		{DiagnosticDuplicateProject, "github.com/foo/bar", "", true},
+		{DiagnosticRootConstraint, "github.com/golang/dep/internal", "", false},
+	}
+
+	var got []kp
+	for _, d := range diags {
+		got = append(got, kp{d.Kind, string(d.Project), d.Package, d.Fatal()})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected diagnostics:\n\t(GOT): %v\n\t(WNT): %v\n%v", got, want, diags)
+	}
+}
+
+func TestValidateManifestClean(t *testing.T) {
+	const manifest = `
+[[constraint]]
+  name = "github.com/foo/bar"
+  version = "1.0.0"
+
+[[override]]
+  name = "github.com/baz/qux"
+  branch = "master"
+`
+
+	diags, err := ValidateManifest(strings.NewReader(manifest), "github.com/golang/dep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 0 {
+		t.Errorf("expected no diagnostics, got %v", diags)
+	}
+}
+
+func TestValidateManifestUninspectable(t *testing.T) {
+	_, err := ValidateManifest(strings.NewReader(`constraint = "nope"`), "")
+	if err == nil {
+		t.Error("expected an error for a manifest with an invalid constraint table")
+	}
+}
@@ -15,6 +15,8 @@ import (
 	"testing"
 
 	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
+	"github.com/golang/dep/gps/verify"
 	"github.com/golang/dep/internal/test"
 )
 
@@ -119,6 +121,7 @@ func TestReadManifestErrors(t *testing.T) {
 		{"multiple constraints", "manifest/error1.toml"},
 		{"multiple dependencies", "manifest/error2.toml"},
 		{"multiple overrides", "manifest/error3.toml"},
+		{"invalid constraint expression", "manifest/error4.toml"},
 	}
 
 	for _, tst := range tests {
@@ -156,6 +159,91 @@ func TestValidateManifest(t *testing.T) {
 			wantWarn:  []error{},
 			wantError: errInvalidRequired,
 		},
+		{
+			name: "valid external",
+			tomlString: `
+			external = ["github.com/foo/bar/gen"]
+			`,
+			wantWarn:  []error{},
+			wantError: nil,
+		},
+		{
+			name: "invalid external",
+			tomlString: `
+			external = "github.com/foo/bar/gen"
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidExternal,
+		},
+		{
+			name: "valid go version",
+			tomlString: `
+			go = "1.10"
+			`,
+			wantWarn:  []error{},
+			wantError: nil,
+		},
+		{
+			name: "invalid go version",
+			tomlString: `
+			go = "go1.10"
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidGoVersion,
+		},
+		{
+			name: "go version not a string",
+			tomlString: `
+			go = 1.10
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidGoVersion,
+		},
+		{
+			name: "invalid digest algorithm",
+			tomlString: `
+			digest-algorithm = "md5"
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidDigestAlg,
+		},
+		{
+			name: "valid variables",
+			tomlString: `
+			[variables]
+			  grpc_version = "^1.10.0"
+			`,
+			wantWarn:  []error{},
+			wantError: nil,
+		},
+		{
+			name: "variables not a table",
+			tomlString: `
+			variables = ["^1.10.0"]
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidVariables,
+		},
+		{
+			name: "variable not a string",
+			tomlString: `
+			[variables]
+			  grpc_version = 1
+			`,
+			wantWarn:  []error{},
+			wantError: errInvalidVariables,
+		},
+		{
+			name: "unreferenceable variable name",
+			tomlString: `
+			[variables]
+			  "grpc-version" = "^1.10.0"
+			`,
+			wantWarn: []error{
+				errors.New(`variable "grpc-version" cannot be referenced; names may only contain letters, digits and underscores`),
+			},
+			wantError: nil,
+		},
 		{
 			name: "empty required",
 			tomlString: `
@@ -577,7 +665,7 @@ func TestValidateProjectRoots(t *testing.T) {
 			wantWarn:  []string{},
 		},
 		{
-			name: "invalid project roots in Constraints and Overrides",
+			name: "subpackage constraints",
 			manifest: Manifest{
 				Constraints: map[gps.ProjectRoot]gps.ProjectProperties{
 					gps.ProjectRoot("github.com/golang/dep/foo"): {
@@ -586,6 +674,18 @@ func TestValidateProjectRoots(t *testing.T) {
 					gps.ProjectRoot("github.com/golang/go/xyz"): {
 						Constraint: gps.Any(),
 					},
+				},
+			},
+			wantError: nil,
+			wantWarn:  []string{},
+		},
+		{
+			name: "invalid project roots in Constraints and Overrides",
+			manifest: Manifest{
+				Constraints: map[gps.ProjectRoot]gps.ProjectProperties{
+					gps.ProjectRoot("github.com/golang/dep/foo"): {
+						Constraint: gps.Any(),
+					},
 					gps.ProjectRoot("github.com/golang/fmt"): {
 						Constraint: gps.Any(),
 					},
@@ -601,9 +701,7 @@ func TestValidateProjectRoots(t *testing.T) {
 			},
 			wantError: errInvalidProjectRoot,
 			wantWarn: []string{
-				"the name for \"github.com/golang/dep/foo\" should be changed to \"github.com/golang/dep\"",
 				"the name for \"github.com/golang/mock/bar\" should be changed to \"github.com/golang/mock\"",
-				"the name for \"github.com/golang/go/xyz\" should be changed to \"github.com/golang/go\"",
 			},
 		},
 		{
@@ -819,3 +917,330 @@ func containsErr(s []error, e error) bool {
 	}
 	return false
 }
+
+func TestManifestGoVersion(t *testing.T) {
+	m, _, err := readManifest(strings.NewReader(`go = "1.10.3"
+
+[[constraint]]
+  name = "github.com/foo/bar"
+  version = "1.0.0"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MinimumGoVersion() != "1.10.3" {
+		t.Errorf("unexpected minimum Go version %q", m.MinimumGoVersion())
+	}
+	if m.dup().GoVersion != "1.10.3" {
+		t.Error("expected the minimum Go version to be copied")
+	}
+
+	b, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, _, err := readManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s in:\n%s", err, b)
+	}
+	if m2.GoVersion != m.GoVersion {
+		t.Errorf("minimum Go version did not survive the round trip:\n%s", b)
+	}
+}
+
+func TestManifestDigestAlgorithm(t *testing.T) {
+	m, _, err := readManifest(strings.NewReader(`digest-algorithm = "blake3"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DigestAlgorithm != verify.BLAKE3 {
+		t.Errorf("unexpected digest algorithm %v", m.DigestAlgorithm)
+	}
+	if m.dup().DigestAlgorithm != verify.BLAKE3 {
+		t.Error("expected the digest algorithm to be copied")
+	}
+
+	b, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, _, err := readManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s in:\n%s", err, b)
+	}
+	if m2.DigestAlgorithm != m.DigestAlgorithm {
+		t.Errorf("digest algorithm did not survive the round trip:\n%s", b)
+	}
+
+	m, _, err = readManifest(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := m.MarshalTOML(); strings.Contains(string(b), "digest-algorithm") {
+		t.Errorf("expected an unset digest algorithm to be omitted:\n%s", b)
+	}
+}
+
+func TestManifestSourceFallbacks(t *testing.T) {
+	m, _, err := readManifest(strings.NewReader(`[[constraint]]
+  name = "github.com/foo/bar"
+  version = "1.0.0"
+  fallback-sources = ["https://example.com/fork/bar.git"]
+
+[[constraint]]
+  name = "github.com/foo/baz"
+  version = "1.0.0"
+  fallback-sources = ["https://example.com/fork/baz.git"]
+
+[[override]]
+  name = "github.com/foo/baz"
+  version = "1.1.0"
+  fallback-sources = ["https://example.com/mirror/baz.git"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[gps.ProjectRoot][]string{
+		"github.com/foo/bar": {"https://example.com/fork/bar.git"},
+		"github.com/foo/baz": {"https://example.com/mirror/baz.git"},
+	}
+	if !reflect.DeepEqual(m.SourceFallbacks, want) {
+		t.Errorf("unexpected fallbacks %v", m.SourceFallbacks)
+	}
+	if !reflect.DeepEqual(m.dup().SourceFallbacks, want) {
+		t.Error("expected the fallbacks to be copied")
+	}
+
+	b, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, _, err := readManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s in:\n%s", err, b)
+	}
+	if !reflect.DeepEqual(m2.SourceFallbacks, want) {
+		t.Errorf("fallbacks did not survive the round trip:\n%s", b)
+	}
+
+	_, _, err = readManifest(strings.NewReader(`[[constraint]]
+  name = "github.com/foo/bar"
+  fallback-sources = "https://example.com/fork/bar.git"
+`))
+	if err == nil || !strings.Contains(err.Error(), errInvalidFallbacks.Error()) {
+		t.Errorf("expected a fallback that is not a list to be rejected, got %v", err)
+	}
+}
+
+func TestManifestMetadata(t *testing.T) {
+	m, warns, err := readManifest(strings.NewReader(`[[constraint]]
+  name = "github.com/foo/bar"
+  version = "1.0.0"
+  [constraint.metadata]
+    owner = "team-a"
+    priority = 1
+
+[[constraint]]
+  name = "github.com/foo/baz"
+  version = "1.0.0"
+  [constraint.metadata]
+    owner = "team-b"
+
+[[override]]
+  name = "github.com/foo/baz"
+  version = "1.1.0"
+  [override.metadata]
+    reason = "CVE-2018-0001"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 1 || !strings.Contains(warns[0].Error(), `metadata "priority"`) {
+		t.Errorf("expected a warning for the metadata that is not a string, got %v", warns)
+	}
+	want := map[gps.ProjectRoot]map[string]string{
+		"github.com/foo/bar": {"owner": "team-a"},
+		"github.com/foo/baz": {"reason": "CVE-2018-0001"},
+	}
+	if !reflect.DeepEqual(m.Metadata, want) {
+		t.Errorf("unexpected metadata %v", m.Metadata)
+	}
+	if !reflect.DeepEqual(m.dup().Metadata, want) {
+		t.Error("expected the metadata to be copied")
+	}
+
+	b, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, _, err := readManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s in:\n%s", err, b)
+	}
+	if !reflect.DeepEqual(m2.Metadata, want) {
+		t.Errorf("metadata did not survive the round trip:\n%s", b)
+	}
+}
+
+func TestManifestVariables(t *testing.T) {
+	m, _, err := readManifest(strings.NewReader(`[variables]
+  grpc_version = "^1.10.0"
+  fork = "github.com/example"
+
+[[constraint]]
+  name = "google.golang.org/grpc"
+  version = "${grpc_version}"
+
+[[constraint]]
+  name = "google.golang.org/grpc/examples"
+  version = "${grpc_version}"
+  source = "${fork}/grpc-examples"
+
+[[override]]
+  name = "github.com/golang/protobuf"
+  branch = "release-${grpc_version}"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := gps.NewSemverConstraintIC("^1.10.0")
+	for _, pr := range []gps.ProjectRoot{"google.golang.org/grpc", "google.golang.org/grpc/examples"} {
+		if c := m.Constraints[pr].Constraint; c.String() != want.String() {
+			t.Errorf("expected %s to be constrained to %s, got %s", pr, want, c)
+		}
+	}
+	if src := m.Constraints["google.golang.org/grpc/examples"].Source; src != "github.com/example/grpc-examples" {
+		t.Errorf("unexpected source %q", src)
+	}
+	if c := m.Ovr["github.com/golang/protobuf"].Constraint; c.String() != "release-^1.10.0" {
+		t.Errorf("unexpected override %s", c)
+	}
+	if m.dup().Variables["grpc_version"] != "^1.10.0" {
+		t.Error("expected the variables to be copied")
+	}
+
+	// The expanded constraints are written back, so the digest of the
+	// manifest's inputs follows the variables.
+	b, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("${")) || !bytes.Contains(b, []byte(`version = "1.10.0"`)) {
+		t.Errorf("expected the expanded constraints to be written:\n%s", b)
+	}
+
+	_, _, err = readManifest(strings.NewReader(`[[constraint]]
+  name = "google.golang.org/grpc"
+  version = "${grpc_version}"
+`))
+	if err == nil || !strings.Contains(err.Error(), `undefined variable "grpc_version" in version for google.golang.org/grpc`) {
+		t.Errorf("expected an undefined variable to be reported, got %v", err)
+	}
+}
+
+func TestManifestChannels(t *testing.T) {
+	m, warns, err := readManifest(strings.NewReader(`[[constraint]]
+  name = "github.com/foo/bar"
+  channel = "beta"
+
+[[constraint]]
+  name = "github.com/foo/baz"
+  channel = "rc"
+
+[[channel]]
+  name = "rc"
+  tags = ["v*-rc.*"]
+  branch = "release"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warns) != 0 {
+		t.Errorf("unexpected warnings %v", warns)
+	}
+
+	rc := gps.ReleaseChannel{Name: "rc", Tags: []string{"v*-rc.*"}, Branch: "release"}
+	if !reflect.DeepEqual(m.Channels, map[string]gps.ReleaseChannel{"rc": rc}) {
+		t.Errorf("unexpected channels %v", m.Channels)
+	}
+	if ch, ok := gps.ChannelOf(m.Constraints["github.com/foo/bar"].Constraint); !ok || ch.Name != "beta" || !ch.Prereleases {
+		t.Errorf("expected github.com/foo/bar to be subscribed to the default beta channel, got %v", m.Constraints["github.com/foo/bar"].Constraint)
+	}
+	if ch, ok := gps.ChannelOf(m.Constraints["github.com/foo/baz"].Constraint); !ok || !reflect.DeepEqual(ch, rc) {
+		t.Errorf("expected github.com/foo/baz to be subscribed to the rc channel, got %v", m.Constraints["github.com/foo/baz"].Constraint)
+	}
+	if !reflect.DeepEqual(m.dup().Channels, m.Channels) {
+		t.Error("expected the channels to be copied")
+	}
+
+	b, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, _, err := readManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s in:\n%s", err, b)
+	}
+	if !reflect.DeepEqual(m2.Channels, m.Channels) || !reflect.DeepEqual(m2.Constraints, m.Constraints) {
+		t.Errorf("channels did not survive the round trip:\n%s", b)
+	}
+
+	for _, fix := range []struct {
+		manifest, wantErr string
+	}{
+		{"[[constraint]]\n  name = \"github.com/foo/bar\"\n  channel = \"canary\"\n", `unknown release channel "canary"`},
+		{"[[constraint]]\n  name = \"github.com/foo/bar\"\n  channel = \"beta\"\n  branch = \"master\"\n", "multiple constraints"},
+		{"[[channel]]\n  name = \"empty\"\n", "contains no versions"},
+		{"channel = \"beta\"\n", errInvalidChannel.Error()},
+	} {
+		_, _, err = readManifest(strings.NewReader(fix.manifest))
+		if err == nil || !strings.Contains(err.Error(), fix.wantErr) {
+			t.Errorf("expected an error containing %q, got %v", fix.wantErr, err)
+		}
+	}
+}
+
+func TestManifestBuildContexts(t *testing.T) {
+	m, _, err := readManifest(strings.NewReader(`build-contexts = ["linux/amd64", "windows/amd64:sqlite_omit_load_extension"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []pkgtree.BuildContext{
+		{GOOS: "linux", GOARCH: "amd64"},
+		{GOOS: "windows", GOARCH: "amd64", Tags: []string{"sqlite_omit_load_extension"}},
+	}
+	if !reflect.DeepEqual(m.BuildContexts, want) {
+		t.Errorf("expected build contexts %v, got %v", want, m.BuildContexts)
+	}
+	if !reflect.DeepEqual(m.dup().BuildContexts, want) {
+		t.Error("expected the build contexts to be copied")
+	}
+
+	b, err := m.MarshalTOML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, _, err := readManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("%s in:\n%s", err, b)
+	}
+	if !reflect.DeepEqual(m2.BuildContexts, want) {
+		t.Errorf("build contexts did not survive the round trip:\n%s", b)
+	}
+
+	for _, fix := range []struct {
+		manifest, wantErr string
+	}{
+		{"build-contexts = \"linux/amd64\"\n", errInvalidBuildContext.Error()},
+		{"build-contexts = [\"linux\"]\n", "must be of the form GOOS/GOARCH"},
+	} {
+		_, _, err = readManifest(strings.NewReader(fix.manifest))
+		if err == nil || !strings.Contains(err.Error(), fix.wantErr) {
+			t.Errorf("expected an error containing %q, got %v", fix.wantErr, err)
+		}
+	}
+}
@@ -5,10 +5,12 @@
 package dep
 
 import (
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/golang/dep/gps"
@@ -103,6 +105,10 @@ type Project struct {
 	ResolvedAbsRoot string
 	// ImportRoot is the import path of the project's root directory.
 	ImportRoot gps.ProjectRoot
+	// ImportAliases are any other import paths under which the project's
+	// packages may be imported, such as the GOPATH-derived path of a project
+	// whose ImportRoot was set explicitly.
+	ImportAliases []string
 	// The Manifest, as read from Gopkg.toml on disk.
 	Manifest *Manifest
 	// The Lock, as read from Gopkg.lock on disk.
@@ -125,7 +131,7 @@ type Project struct {
 }
 
 // VerifyVendor checks the vendor directory against the hash digests in
-// Gopkg.lock.
+// Gopkg.lock, or in the vendor directory's own metadata if there is no lock.
 //
 // This operation is overseen by the sync.Once in CheckVendor. This is intended
 // to facilitate running verification in the background while solving, then
@@ -135,11 +141,7 @@ func (p *Project) VerifyVendor() (map[string]verify.VendorStatus, error) {
 		p.VendorStatus = make(map[string]verify.VendorStatus)
 		vendorDir := filepath.Join(p.AbsRoot, "vendor")
 
-		var lps []gps.LockedProject
-		if p.Lock != nil {
-			lps = p.Lock.Projects()
-		}
-
+		lps := p.lockOrVendorMetadata().Projects()
 		sums := make(map[string]verify.VersionedDigest)
 		for _, lp := range lps {
 			sums[string(lp.Ident().ProjectRoot)] = lp.(verify.VerifiableProject).Digest
@@ -151,6 +153,53 @@ func (p *Project) VerifyVendor() (map[string]verify.VendorStatus, error) {
 	return p.VendorStatus, p.CheckVendorErr
 }
 
+// lockOrVendorMetadata returns the project's Lock or, if it has none, the
+// projects recorded in the metadata of its vendor directory. It returns nil if
+// there is neither.
+func (p *Project) lockOrVendorMetadata() *Lock {
+	if p.Lock != nil {
+		return p.Lock
+	}
+
+	l, err := ReadVendorMetadata(filepath.Join(p.AbsRoot, "vendor"))
+	if err != nil {
+		return nil
+	}
+	return l
+}
+
+// InputsDigest returns the digest of the inputs to solving that gps computes
+// for the project's solve parameters, hex-encoded: the root project's
+// imports, its manifest's declarations, and the analyzer and solver that
+// interpret them. Nothing beyond the root project is consulted, so it is cheap
+// to compute.
+func (p *Project) InputsDigest() (string, error) {
+	if _, err := p.parseRootPackageTree(); err != nil {
+		return "", err
+	}
+
+	digest, err := gps.HashInputs(p.MakeParams())
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest), nil
+}
+
+// InputsUnchanged reports whether the inputs digest recorded in the project's
+// Lock matches its current inputs. If it does, neither the imports nor the
+// manifest have changed since the lock was solved, and there is no need to
+// solve again.
+//
+// It returns false if there is no Lock, or if the Lock records no digest.
+func (p *Project) InputsUnchanged() bool {
+	if p.Lock == nil || p.Lock.SolveMeta.InputsDigest == "" {
+		return false
+	}
+
+	digest, err := p.InputsDigest()
+	return err == nil && digest == p.Lock.SolveMeta.InputsDigest
+}
+
 // SetRoot sets the project AbsRoot and ResolvedAbsRoot. If root is not a symlink, ResolvedAbsRoot will be set to root.
 func (p *Project) SetRoot(root string) error {
 	rroot, err := filepath.EvalSymlinks(root)
@@ -173,12 +222,21 @@ func (p *Project) MakeParams() gps.SolveParameters {
 
 	if p.Manifest != nil {
 		params.Manifest = p.Manifest
+		// Dependencies must be buildable with the oldest toolchain the
+		// project itself supports.
+		params.GoVersion = p.Manifest.GoVersion
+		params.SourceFallbacks = p.Manifest.SourceFallbacks
+		params.ProjectMetadata = p.Manifest.Metadata
+		params.BuildContexts = p.Manifest.BuildContexts
 	}
 
 	// It should be impossible for p.ChangedLock to be nil if p.Lock is non-nil;
 	// we always want to use the former for solving.
 	if p.ChangedLock != nil {
 		params.Lock = p.ChangedLock
+		// The locked projects are very likely to be needed, so start fetching
+		// them straight away.
+		params.PrefetchLock = true
 	}
 
 	return params
@@ -200,7 +258,10 @@ func (p *Project) parseRootPackageTree() (pkgtree.PackageTree, error) {
 		var ig *pkgtree.IgnoredRuleset
 		if p.Manifest != nil {
 			ig = p.Manifest.IgnoredPackages()
+			// Nor for the imports of files built for none of its contexts.
+			ptree = ptree.ForContexts(p.Manifest.BuildContexts)
 		}
+		ptree.Aliases = p.ImportAliases
 		p.RootPackageTree = ptree.TrimHiddenPackages(true, true, ig)
 	}
 	return p.RootPackageTree, nil
@@ -222,13 +283,21 @@ func (p *Project) parseRootPackageTree() (pkgtree.PackageTree, error) {
 // manifest, if one is present, but will also do the right thing without a
 // manifest.
 func (p *Project) GetDirectDependencyNames(sm gps.SourceManager) (map[gps.ProjectRoot]bool, error) {
+	directDeps, _, err := p.directDependencies(sm)
+	return directDeps, err
+}
+
+// directDependencies returns the roots of the projects that are direct
+// dependencies of the Project, as GetDirectDependencyNames does, along with the
+// external packages it imports or requires.
+func (p *Project) directDependencies(sm gps.SourceManager) (map[gps.ProjectRoot]bool, []string, error) {
 	var reach []string
 	if p.ChangedLock != nil {
 		reach = p.ChangedLock.InputImports()
 	} else {
 		ptree, err := p.parseRootPackageTree()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		reach = externalImportList(ptree, p.Manifest)
 	}
@@ -237,12 +306,12 @@ func (p *Project) GetDirectDependencyNames(sm gps.SourceManager) (map[gps.Projec
 	for _, ip := range reach {
 		pr, err := sm.DeduceProjectRoot(ip)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		directDeps[pr] = true
 	}
 
-	return directDeps, nil
+	return directDeps, reach, nil
 }
 
 // FindIneffectualConstraints looks for constraint rules expressed in the
@@ -250,20 +319,22 @@ func (p *Project) GetDirectDependencyNames(sm gps.SourceManager) (map[gps.Projec
 // projects that are not direct dependencies of the Project.
 //
 // "Direct dependency" here is as implemented by GetDirectDependencyNames();
-// it correctly incorporates all "ignored" and "required" rules.
+// it correctly incorporates all "ignored" and "required" rules. A constraint
+// on a subpackage of a project is effective if that subpackage, or a package
+// beneath it, is imported or required.
 func (p *Project) FindIneffectualConstraints(sm gps.SourceManager) []gps.ProjectRoot {
 	if p.Manifest == nil {
 		return nil
 	}
 
-	dd, err := p.GetDirectDependencyNames(sm)
+	dd, reach, err := p.directDependencies(sm)
 	if err != nil {
 		return nil
 	}
 
 	var ineff []gps.ProjectRoot
 	for pr := range p.Manifest.DependencyConstraints() {
-		if !dd[pr] {
+		if !dd[pr] && !reachesPath(reach, string(pr)) {
 			ineff = append(ineff, pr)
 		}
 	}
@@ -274,6 +345,16 @@ func (p *Project) FindIneffectualConstraints(sm gps.SourceManager) []gps.Project
 	return ineff
 }
 
+// reachesPath reports whether any of the import paths is path, or beneath it.
+func reachesPath(reach []string, path string) bool {
+	for _, ip := range reach {
+		if ip == path || strings.HasPrefix(ip, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // BackupVendor looks for existing vendor directory and if it's not empty,
 // creates a backup of it to a new directory with the provided suffix.
 func BackupVendor(vpath, suffix string) (string, error) {
@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/pkgtree"
 	"github.com/golang/dep/internal/test"
 )
 
@@ -159,6 +160,104 @@ func TestProjectMakeParams(t *testing.T) {
 	if solveParam.Lock != p.Lock {
 		t.Error("makeParams() returned gps.SolveParameters with incorrect Lock")
 	}
+
+	if !solveParam.PrefetchLock {
+		t.Error("makeParams() returned gps.SolveParameters that do not prefetch the Lock")
+	}
+}
+
+func TestProjectInputsDigest(t *testing.T) {
+	ptree := pkgtree.PackageTree{
+		ImportRoot: "example.com/root",
+		Packages: map[string]pkgtree.PackageOrErr{
+			"example.com/root": {
+				P: pkgtree.Package{
+					ImportPath: "example.com/root",
+					Name:       "root",
+					Imports:    []string{"fmt", "github.com/foo/bar"},
+				},
+			},
+		},
+	}
+	p := Project{
+		AbsRoot:         "/go/src/example.com/root",
+		ImportRoot:      "example.com/root",
+		Manifest:        NewManifest(),
+		Lock:            &Lock{},
+		RootPackageTree: ptree,
+	}
+
+	if p.InputsUnchanged() {
+		t.Error("expected inputs to be reported as changed when the lock records no digest")
+	}
+
+	digest, err := p.InputsDigest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Lock.SolveMeta.InputsDigest = digest
+	if !p.InputsUnchanged() {
+		t.Error("expected inputs to be unchanged after recording their digest")
+	}
+
+	// Imports from the standard library are not inputs to solving.
+	pkg := ptree.Packages["example.com/root"]
+	pkg.P.Imports = append(pkg.P.Imports, "os")
+	ptree.Packages["example.com/root"] = pkg
+	if !p.InputsUnchanged() {
+		t.Error("expected a new standard library import not to change the inputs")
+	}
+
+	p.Manifest.Constraints["github.com/foo/bar"] = gps.ProjectProperties{
+		Constraint: gps.NewBranch("master"),
+	}
+	if p.InputsUnchanged() {
+		t.Error("expected a new constraint to change the inputs")
+	}
+	p.Manifest = NewManifest()
+
+	// Constraints are recorded as expanded from the manifest's variables.
+	var expanded []string
+	for _, ver := range []string{"1.0.0", "1.1.0"} {
+		m, _, err := readManifest(strings.NewReader(`[variables]
+  bar_version = "` + ver + `"
+
+[[constraint]]
+  name = "github.com/foo/bar"
+  version = "${bar_version}"
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Manifest = m
+		d, err := p.InputsDigest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expanded = append(expanded, d)
+	}
+	if expanded[0] == expanded[1] {
+		t.Error("expected a change to the expansion of a variable to change the inputs")
+	}
+	p.Manifest = NewManifest()
+
+	p.Manifest.Required = []string{"github.com/baz/qux"}
+	if p.InputsUnchanged() {
+		t.Error("expected a new required package to change the inputs")
+	}
+	p.Manifest = NewManifest()
+
+	p.Manifest.GoVersion = "1.10"
+	if p.InputsUnchanged() {
+		t.Error("expected a new Go version to change the inputs")
+	}
+	p.Manifest = NewManifest()
+
+	pkg.P.Imports = append(pkg.P.Imports, "github.com/baz/qux")
+	ptree.Packages["example.com/root"] = pkg
+	if p.InputsUnchanged() {
+		t.Error("expected a new external import to change the inputs")
+	}
 }
 
 func TestBackupVendor(t *testing.T) {
@@ -73,6 +73,11 @@ type SafeWriter struct {
 	writeVendor  bool
 	writeLock    bool
 	pruneOptions gps.CascadingPruneOptions
+
+	// DigestAlgorithm is the algorithm with which vendored projects are
+	// hashed. It is taken from the manifest, if one is provided, and the zero
+	// value means verify.DefaultDigestAlgorithm.
+	DigestAlgorithm verify.DigestAlgorithm
 }
 
 // NewSafeWriter sets up a SafeWriter to write a set of manifest, lock, and
@@ -96,6 +101,9 @@ func NewSafeWriter(manifest *Manifest, oldLock, newLock *Lock, vendor VendorBeha
 		lock:         newLock,
 		pruneOptions: prune,
 	}
+	if manifest != nil {
+		sw.DigestAlgorithm = manifest.DigestAlgorithm
+	}
 
 	if oldLock != nil {
 		if newLock == nil {
@@ -231,7 +239,9 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool, lo
 		var onWrite func(gps.WriteProgress)
 		if logger != nil {
 			onWrite = func(progress gps.WriteProgress) {
-				logger.Println(progress)
+				if progress.Event != gps.WriteStarted {
+					logger.Println(progress)
+				}
 			}
 		}
 		err = gps.WriteDepTree(filepath.Join(td, "vendor"), sw.lock, sm, sw.pruneOptions, onWrite)
@@ -241,12 +251,16 @@ func (sw *SafeWriter) Write(root string, sm gps.SourceManager, examples bool, lo
 
 		for k, lp := range sw.lock.Projects() {
 			vp := lp.(verify.VerifiableProject)
-			vp.Digest, err = verify.DigestFromDirectory(filepath.Join(td, "vendor", string(lp.Ident().ProjectRoot)))
+			vp.Digest, err = verify.DigestFromDirectoryWithAlgorithm(filepath.Join(td, "vendor", string(lp.Ident().ProjectRoot)), digestAlgorithmOrDefault(sw.DigestAlgorithm))
 			if err != nil {
 				return errors.Wrapf(err, "error while hashing tree of %s in vendor", lp.Ident().ProjectRoot)
 			}
 			sw.lock.P[k] = vp
 		}
+
+		if err := writeVendorMetadata(filepath.Join(td, "vendor"), sw.lock); err != nil {
+			return errors.Wrap(err, "failed to write vendor metadata")
+		}
 	}
 
 	if sw.writeLock {
@@ -418,6 +432,9 @@ type DeltaWriter struct {
 	vendorDir string
 	changed   map[gps.ProjectRoot]changeType
 	behavior  VendorBehavior
+	digestAlg verify.DigestAlgorithm
+	// verified holds the projects whose vendored trees matched their digests.
+	verified map[gps.ProjectRoot]bool
 }
 
 type changeType uint8
@@ -444,6 +461,8 @@ func NewDeltaWriter(p *Project, newLock *Lock, behavior VendorBehavior) (TreeWri
 		vendorDir: filepath.Join(p.AbsRoot, "vendor"),
 		changed:   make(map[gps.ProjectRoot]changeType),
 		behavior:  behavior,
+		digestAlg: digestAlgorithmOrDefault(p.Manifest.DigestAlgorithm),
+		verified:  make(map[gps.ProjectRoot]bool),
 	}
 
 	if newLock == nil {
@@ -460,12 +479,17 @@ func NewDeltaWriter(p *Project, newLock *Lock, behavior VendorBehavior) (TreeWri
 		if os.IsNotExist(err) {
 			// Provided dir does not exist, so there's no disk contents to compare
 			// against. Fall back to the old SafeWriter.
-			return NewSafeWriter(nil, p.Lock, newLock, behavior, p.Manifest.PruneOptions, status)
+			sw, err := NewSafeWriter(nil, p.Lock, newLock, behavior, p.Manifest.PruneOptions, status)
+			if err != nil {
+				return nil, err
+			}
+			sw.DigestAlgorithm = dw.digestAlg
+			return sw, nil
 		}
 		return nil, err
 	}
 
-	dw.lockDiff = verify.DiffLocks(p.Lock, newLock)
+	dw.lockDiff = verify.DiffLocks(p.lockOrVendorMetadata(), newLock)
 
 	for pr, lpd := range dw.lockDiff.ProjectDeltas {
 		// Hash changes aren't relevant at this point, as they could be empty
@@ -485,6 +509,9 @@ func NewDeltaWriter(p *Project, newLock *Lock, behavior VendorBehavior) (TreeWri
 
 	for spr, stat := range status {
 		pr := gps.ProjectRoot(spr)
+		if stat == verify.NoMismatch {
+			dw.verified[pr] = true
+		}
 		// These cases only matter if there was no change already recorded via
 		// the differ.
 		if _, has := dw.changed[pr]; !has {
@@ -601,7 +628,7 @@ func (dw *DeltaWriter) Write(path string, sm gps.SourceManager, examples bool, l
 			logger.Printf("(%d/%d) Wrote %s@%s: %s", i, tot, id, v, changeExplanation(reason, lpd))
 		}
 
-		digest, err := verify.DigestFromDirectory(to)
+		digest, err := verify.DigestFromDirectoryWithAlgorithm(to, dw.digestAlg)
 		if err != nil {
 			return errors.Wrapf(err, "failed to hash %s", pr)
 		}
@@ -620,6 +647,23 @@ func (dw *DeltaWriter) Write(path string, sm gps.SourceManager, examples bool, l
 		}
 	}
 
+	// Projects that are left in place, and whose vendored trees were verified
+	// against digests produced by some other algorithm, are rehashed with the
+	// current one, so that digests migrate as vendor/ is kept in sync.
+	for k, lp := range dw.lock.P {
+		pr := lp.Ident().ProjectRoot
+		vp, ok := lp.(verify.VerifiableProject)
+		if _, has := dw.changed[pr]; has || !ok || !dw.verified[pr] || vp.Digest.HashVersion == int(dw.digestAlg) {
+			continue
+		}
+
+		vp.Digest, err = verify.DigestFromDirectoryWithAlgorithm(filepath.Join(vpath, string(pr)), dw.digestAlg)
+		if err != nil {
+			return errors.Wrapf(err, "failed to rehash %s", pr)
+		}
+		dw.lock.P[k] = vp
+	}
+
 	// Write out the lock, now that it's fully updated with digests.
 	l, err := dw.lock.MarshalTOML()
 	if err != nil {
@@ -652,6 +696,10 @@ func (dw *DeltaWriter) Write(path string, sm gps.SourceManager, examples bool, l
 		}
 	}
 
+	if err := writeVendorMetadata(vnewpath, dw.lock); err != nil {
+		return errors.Wrap(err, "failed to write vendor metadata")
+	}
+
 	for i, pr := range dropped {
 		// Kind of a lie to print this. ¯\_(ツ)_/¯
 		fi, err := os.Stat(filepath.Join(vpath, string(pr)))
@@ -786,3 +834,12 @@ func trimSHA(revision gps.Revision) string {
 
 	return string(revision)
 }
+
+// digestAlgorithmOrDefault returns alg, or the default digest algorithm if alg
+// is the zero value.
+func digestAlgorithmOrDefault(alg verify.DigestAlgorithm) verify.DigestAlgorithm {
+	if alg == 0 {
+		return verify.DefaultDigestAlgorithm
+	}
+	return alg
+}
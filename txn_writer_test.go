@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/verify"
 	"github.com/golang/dep/internal/test"
 	"github.com/pkg/errors"
 )
@@ -259,6 +260,9 @@ func TestSafeWriter_ManifestAndUnmodifiedLockWithForceVendor(t *testing.T) {
 	if err := pc.VendorFileShouldExist("github.com/sdboyer/dep-test"); err != nil {
 		t.Fatal(err)
 	}
+	if err := pc.VendorFileShouldExist(verify.VendorMetadataName); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestSafeWriter_ForceVendorWhenVendorAlreadyExists(t *testing.T) {
@@ -469,3 +473,78 @@ func TestSafeWriter_VendorDotGitPreservedWithForceVendor(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDeltaWriter_UpgradesDigestAlgorithm(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+
+	h.TempFile("vendor/github.com/sdboyer/deptest/deptest.go", "package deptest\n")
+	h.TempFile("vendor/github.com/sdboyer/deptestdos/deptestdos.go", "package deptestdos\n")
+	root := h.Path(".")
+
+	mkvp := func(pr gps.ProjectRoot, digest verify.VersionedDigest) verify.VerifiableProject {
+		return verify.VerifiableProject{
+			LockedProject: gps.NewLockedProject(
+				gps.ProjectIdentifier{ProjectRoot: pr},
+				gps.NewVersion("v1.0.0").Pair("ff2948a2ac8f538c4ecd55962e919d1e13e74baf"),
+				[]string{"."},
+			),
+			PruneOpts: gps.PruneNestedVendorDirs,
+			Digest:    digest,
+		}
+	}
+	digest, err := verify.DigestFromDirectoryWithAlgorithm(filepath.Join(root, "vendor", "github.com/sdboyer/deptest"), verify.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Lock{
+		P: []gps.LockedProject{
+			mkvp("github.com/sdboyer/deptest", digest),
+			// A digest that does not match is not upgraded with the others, as
+			// the tree in vendor cannot be trusted.
+			mkvp("github.com/sdboyer/deptestdos", verify.VersionedDigest{HashVersion: 1, Digest: []byte("nope")}),
+		},
+	}
+
+	m := NewManifest()
+	m.DigestAlgorithm = verify.BLAKE3
+	m.NoVerify = []string{"github.com/sdboyer/deptestdos"}
+	p := &Project{AbsRoot: root, Manifest: m, Lock: l}
+
+	dw, err := NewDeltaWriter(p, l.dup(), VendorOnChanged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dw.Write(root, nil, false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lf, err := os.Open(filepath.Join(root, LockName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+	got, err := readLock(lf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digests := make(map[string]verify.VersionedDigest)
+	for _, lp := range got.Projects() {
+		digests[string(lp.Ident().ProjectRoot)] = lp.(verify.VerifiableProject).Digest
+	}
+	if hv := digests["github.com/sdboyer/deptest"].HashVersion; hv != int(verify.BLAKE3) {
+		t.Errorf("expected the verified project's digest to be upgraded to BLAKE3, got hash version %d", hv)
+	}
+	if hv := digests["github.com/sdboyer/deptestdos"].HashVersion; hv != int(verify.SHA256) {
+		t.Errorf("expected the unverified project's digest to be left alone, got hash version %d", hv)
+	}
+
+	status, err := verify.CheckDepTree(filepath.Join(root, "vendor"), digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status["github.com/sdboyer/deptest"] != verify.NoMismatch {
+		t.Errorf("expected the upgraded digest to verify, got %s", status["github.com/sdboyer/deptest"])
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/verify"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// The vendor metadata file records the projects dep wrote to vendor/, in the
+// same form as the project stanzas of a lock. It lets vendor/ be verified, and
+// updated incrementally, even if Gopkg.lock is missing.
+
+type rawVendorMetadata struct {
+	Projects []rawLockedProject `toml:"projects"`
+}
+
+var vendorMetadataComment = []byte(`# This file is autogenerated, do not edit; it records the projects dep wrote to this directory.
+
+`)
+
+// ReadVendorMetadata reads back the projects recorded in the metadata of the
+// vendor directory at vendorDir. They are returned as a Lock without any solve
+// metadata, in which each project carries the version, revision, prune options
+// and digest with which it was written.
+//
+// If vendorDir has no metadata, as is the case if it was not written by dep,
+// the returned error satisfies os.IsNotExist.
+func ReadVendorMetadata(vendorDir string) (*Lock, error) {
+	b, err := ioutil.ReadFile(filepath.Join(vendorDir, verify.VendorMetadataName))
+	if err != nil {
+		return nil, err
+	}
+
+	raw := rawVendorMetadata{}
+	if err = toml.Unmarshal(b, &raw); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse %s as TOML", verify.VendorMetadataName)
+	}
+
+	l := &Lock{
+		P: make([]gps.LockedProject, 0, len(raw.Projects)),
+	}
+	for _, ld := range raw.Projects {
+		vp, err := fromRawLockedProject(ld)
+		if err != nil {
+			return nil, errors.Wrapf(err, "in %s", verify.VendorMetadataName)
+		}
+		l.P = append(l.P, vp)
+	}
+
+	return l, nil
+}
+
+// writeVendorMetadata records the projects in l in the metadata of the vendor
+// directory at vendorDir. The projects' digests must already reflect what was
+// written there.
+func writeVendorMetadata(vendorDir string, l *Lock) error {
+	lps := l.Projects()
+	raw := rawVendorMetadata{
+		Projects: make([]rawLockedProject, 0, len(lps)),
+	}
+	for _, lp := range lps {
+		raw.Projects = append(raw.Projects, toRawLockedProject(lp))
+	}
+	sort.Slice(raw.Projects, func(i, j int) bool {
+		return raw.Projects[i].Name < raw.Projects[j].Name
+	})
+
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf).ArraysWithOneElementPerLine(true)
+	if err := enc.Encode(raw); err != nil {
+		return errors.Wrap(err, "unable to marshal vendor metadata to TOML")
+	}
+
+	return ioutil.WriteFile(filepath.Join(vendorDir, verify.VendorMetadataName), append(vendorMetadataComment, buf.Bytes()...), 0666)
+}
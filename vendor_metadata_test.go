@@ -0,0 +1,78 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dep
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/golang/dep/gps"
+	"github.com/golang/dep/gps/verify"
+	"github.com/golang/dep/internal/test"
+)
+
+func TestVendorMetadataRoundTrip(t *testing.T) {
+	h := test.NewHelper(t)
+	defer h.Cleanup()
+	h.TempDir("vendor")
+	vendorDir := h.Path("vendor")
+
+	if _, err := ReadVendorMetadata(vendorDir); !os.IsNotExist(err) {
+		t.Fatalf("expected a not-exist error reading missing vendor metadata, got %v", err)
+	}
+
+	l := &Lock{
+		SolveMeta: SolveMeta{InputImports: []string{"github.com/golang/dep"}},
+		P: []gps.LockedProject{
+			verify.VerifiableProject{
+				LockedProject: gps.NewLockedProject(
+					gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptestdos"},
+					gps.NewVersion("v2.0.0").Pair("5c607206be5decd28e6263ffffdcee067266015e"),
+					[]string{"."},
+				),
+				PruneOpts: gps.PruneNestedVendorDirs | gps.PruneGoTestFiles,
+				Digest: verify.VersionedDigest{
+					HashVersion: verify.HashVersion,
+					Digest:      []byte("foo"),
+				},
+			},
+			verify.VerifiableProject{
+				LockedProject: gps.NewLockedProject(
+					gps.ProjectIdentifier{ProjectRoot: "github.com/sdboyer/deptest", Source: "https://example.com/deptest"},
+					gps.NewBranch("master").Pair("3f4c3bea144e112a69bbe5d8d01c1b09a544253f"),
+					[]string{".", "subpkg"},
+				),
+				PruneOpts: gps.PruneNestedVendorDirs,
+				Digest: verify.VersionedDigest{
+					HashVersion: verify.HashVersion,
+					Digest:      []byte("bar"),
+				},
+			},
+		},
+	}
+	if err := writeVendorMetadata(vendorDir, l); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadVendorMetadata(vendorDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Lock{P: []gps.LockedProject{l.P[1], l.P[0]}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("vendor metadata did not survive a round trip:\n\t(GOT): %#v\n\t(WNT): %#v", got, want)
+	}
+
+	// Without a lock, the project falls back to its vendor metadata.
+	p := Project{AbsRoot: h.Path(".")}
+	if fallback := p.lockOrVendorMetadata(); !reflect.DeepEqual(fallback, want) {
+		t.Errorf("expected the project to fall back to its vendor metadata, got %#v", fallback)
+	}
+	p.Lock = l
+	if p.lockOrVendorMetadata() != l {
+		t.Error("expected the project to prefer its lock over its vendor metadata")
+	}
+}